@@ -0,0 +1,85 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+const archiveShortHelp = `Write a reproducible archive of vendor/`
+const archiveLongHelp = `
+Write the project's vendor directory as a gzipped tar archive, and print its
+SHA-256 digest.
+
+The archive depends only on the contents of vendor/: entries are sorted, and
+their modification times, owners and permissions are fixed. Archiving the same
+vendor tree always produces the same archive, and so the same digest, which
+can be compared across builds or recorded in release attestations.
+
+The archive is written to vendor.tar.gz in the project root, unless another
+path is given with -out.
+`
+
+type archiveCommand struct {
+	outFilePath string
+}
+
+func (cmd *archiveCommand) Name() string      { return "archive" }
+func (cmd *archiveCommand) Args() string      { return "[-out path]" }
+func (cmd *archiveCommand) ShortHelp() string { return archiveShortHelp }
+func (cmd *archiveCommand) LongHelp() string  { return archiveLongHelp }
+func (cmd *archiveCommand) Hidden() bool      { return false }
+
+func (cmd *archiveCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.outFilePath, "out", "", "path to a file to which to write the archive. Blank value will use vendor.tar.gz in the project root")
+}
+
+func (cmd *archiveCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.Errorf("too many args (%d)", len(args))
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	vendorDir := filepath.Join(p.AbsRoot, "vendor")
+	if isDir, err := fs.IsDir(vendorDir); !isDir {
+		if os.IsNotExist(err) {
+			return errors.New("no vendor directory to archive; run dep ensure to populate it")
+		}
+		return err
+	}
+
+	path := cmd.outFilePath
+	if path == "" {
+		path = filepath.Join(p.AbsRoot, "vendor.tar.gz")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "error creating output file")
+	}
+
+	h := sha256.New()
+	err = dep.WriteVendorArchive(io.MultiWriter(f, h), vendorDir)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return errors.Wrap(err, "error writing archive")
+	}
+
+	ctx.Out.Printf("sha256:%x  %s\n", h.Sum(nil), path)
+	return nil
+}
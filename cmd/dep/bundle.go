@@ -0,0 +1,332 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
+)
+
+const bundleShortHelp = `Package dependencies for use without network access`
+const bundleLongHelp = `
+Write a bundle, a gzipped tar archive, holding everything needed to reproduce
+the project's dependencies without network access: Gopkg.toml, Gopkg.lock, the
+local copies of the locked projects' sources from the cache directory, and the
+metadata needed to use those sources without deducing them from import paths.
+
+With -restore, add the sources in a bundle to the cache directory instead. If
+there is no project in the current directory, the bundled Gopkg.toml and
+Gopkg.lock are written into it; otherwise, the project's own are left alone,
+and a warning printed if its Gopkg.lock differs from the bundled one.
+
+Once restored, run "dep ensure -vendor-only" with the DEPCACHEAGE environment
+variable set to populate vendor from the bundled sources, without any network
+access. The bundled metadata is only used when DEPCACHEAGE is set.
+`
+
+// bundleCacheDir is the directory, within a bundle, that is laid out as a
+// cache directory holding the bundled sources.
+const bundleCacheDir = "cache"
+
+type bundleCommand struct {
+	restore bool
+}
+
+func (cmd *bundleCommand) Name() string      { return "bundle" }
+func (cmd *bundleCommand) Args() string      { return "[-restore] <path>" }
+func (cmd *bundleCommand) ShortHelp() string { return bundleShortHelp }
+func (cmd *bundleCommand) LongHelp() string  { return bundleLongHelp }
+func (cmd *bundleCommand) Hidden() bool      { return false }
+
+func (cmd *bundleCommand) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&cmd.restore, "restore", false, "restore from the bundle at path, rather than writing one")
+}
+
+func (cmd *bundleCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) != 1 {
+		return errors.Errorf("expected the path of a bundle, got %d args", len(args))
+	}
+
+	tmp, err := ioutil.TempDir("", "dep-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if cmd.restore {
+		return cmd.runRestore(ctx, args[0], tmp)
+	}
+	return cmd.runBundle(ctx, args[0], tmp)
+}
+
+func (cmd *bundleCommand) runBundle(ctx *dep.Ctx, path, tmp string) error {
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.New("Gopkg.lock does not exist, cannot bundle the sources it locks")
+	}
+
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	defer sm.Release()
+
+	var ids []gps.ProjectIdentifier
+	for _, lp := range p.Lock.Projects() {
+		ids = append(ids, lp.Ident())
+	}
+	if err = sm.BundleSources(context.TODO(), ids, filepath.Join(tmp, bundleCacheDir)); err != nil {
+		return err
+	}
+
+	for _, name := range []string{dep.ManifestName, dep.LockName} {
+		b, err := ioutil.ReadFile(filepath.Join(p.AbsRoot, name))
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(filepath.Join(tmp, name), b, 0666); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create bundle")
+	}
+	if err = writeBundle(f, tmp); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write bundle")
+	}
+	if err = f.Close(); err != nil {
+		return errors.Wrap(err, "failed to write bundle")
+	}
+
+	if ctx.Verbose {
+		ctx.Err.Printf("Bundled the sources of %d projects into %s\n", len(ids), path)
+	}
+	return nil
+}
+
+func (cmd *bundleCommand) runRestore(ctx *dep.Ctx, path, tmp string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open bundle")
+	}
+	err = readBundle(f, tmp)
+	f.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to read bundle")
+	}
+
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	defer sm.Release()
+
+	if err = sm.UnbundleSources(filepath.Join(tmp, bundleCacheDir)); err != nil {
+		return err
+	}
+
+	bundled, err := ioutil.ReadFile(filepath.Join(tmp, dep.LockName))
+	if err != nil {
+		return errors.Wrap(err, "bundle has no Gopkg.lock")
+	}
+
+	root, err := dep.FindProjectRoot(ctx.WorkingDir)
+	if err != nil {
+		return err
+	}
+	if root == "" {
+		// There's no project here yet; set one up from the bundle.
+		for _, name := range []string{dep.ManifestName, dep.LockName} {
+			b, err := ioutil.ReadFile(filepath.Join(tmp, name))
+			if err != nil {
+				return errors.Wrapf(err, "bundle has no %s", name)
+			}
+			if err = ioutil.WriteFile(filepath.Join(ctx.WorkingDir, name), b, 0666); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	own, err := ioutil.ReadFile(filepath.Join(p.AbsRoot, dep.LockName))
+	if err != nil || !bytes.Equal(own, bundled) {
+		ctx.Err.Printf("Warning: %s does not match the one in the bundle, so the bundled sources may not be all it needs\n", dep.LockName)
+	}
+	return nil
+}
+
+// writeBundle writes the tree rooted at dir to w as a gzipped tar archive.
+// Only directories, regular files and symlinks are included.
+func writeBundle(w io.Writer, dir string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case !fi.IsDir() && !fi.Mode().IsRegular():
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// readBundle extracts the gzipped tar archive read from r into dir, refusing
+// any entries that would be written outside of it. Nothing is written through
+// a symlink, so that links in the archive cannot be used to lead later entries
+// astray, however they are chained.
+func readBundle(r io.Reader, dir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(strings.TrimSuffix(hdr.Name, "/"))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) || filepath.Clean(name) != name {
+			return errors.Errorf("invalid path %q in bundle", hdr.Name)
+		}
+		path := filepath.Join(dir, name)
+		if err = checkBundleParents(dir, name); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0777)
+		case tar.TypeSymlink:
+			// Links must not lead out of dir, or later entries could be
+			// written through them.
+			target := filepath.Join(filepath.Dir(name), filepath.FromSlash(hdr.Linkname))
+			if filepath.IsAbs(hdr.Linkname) || target == ".." || strings.HasPrefix(target, ".."+string(filepath.Separator)) {
+				return errors.Errorf("invalid link %q to %q in bundle", hdr.Name, hdr.Linkname)
+			}
+			if err = os.MkdirAll(filepath.Dir(path), 0777); err == nil {
+				err = os.Symlink(hdr.Linkname, path)
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			err = extractBundleFile(tr, path, os.FileMode(hdr.Mode).Perm())
+		default:
+			err = errors.Errorf("unexpected type of entry %q in bundle", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkBundleParents returns an error if any of the directories that name,
+// relative to dir, is within is a symlink on disk.
+func checkBundleParents(dir, name string) error {
+	parent := dir
+	for _, elem := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if elem == "." {
+			return nil
+		}
+		parent = filepath.Join(parent, elem)
+		fi, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("invalid path %q in bundle, it is within a link", name)
+		}
+	}
+	return nil
+}
+
+func extractBundleFile(r io.Reader, path string, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile("in/Gopkg.lock", "lock")
+	h.TempFile("in/cache/sources/https---example.com-a/a.go", "package a\n")
+	h.TempDir("in/cache/sources/https---example.com-a/empty")
+
+	var buf bytes.Buffer
+	if err := writeBundle(&buf, h.Path("in")); err != nil {
+		t.Fatal(err)
+	}
+	h.TempDir("out")
+	if err := readBundle(&buf, h.Path("out")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(h.Path("out"), "cache", "sources", "https---example.com-a", "a.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "package a\n" {
+		t.Errorf("unexpected contents after round trip: %q", b)
+	}
+	h.MustExist(filepath.Join(h.Path("out"), "Gopkg.lock"))
+	h.MustExist(filepath.Join(h.Path("out"), "cache", "sources", "https---example.com-a", "empty"))
+}
+
+func TestReadBundleRejectsEscapes(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("out")
+
+	for _, hdr := range []*tar.Header{
+		{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "/abs", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+	} {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Close()
+		gw.Close()
+
+		if err := readBundle(&buf, h.Path("out")); err == nil {
+			t.Errorf("expected an error for entry %q -> %q", hdr.Name, hdr.Linkname)
+		}
+	}
+}
+
+func TestReadBundleRejectsChainedLinks(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("top/out")
+
+	// Each link is harmless on its own, but d/l is really top/out/.., so
+	// that d/l/x would be written outside of out.
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, hdr := range []*tar.Header{
+		{Name: "d", Typeflag: tar.TypeSymlink, Linkname: "."},
+		{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "d/l/x", Typeflag: tar.TypeReg, Mode: 0644},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+
+	if err := readBundle(&buf, h.Path("top/out")); err == nil {
+		t.Error("expected an error writing through a link")
+	}
+	h.MustNotExist(filepath.Join(h.Path("top"), "x"))
+	h.MustNotExist(filepath.Join(h.Path("top"), "l"))
+}
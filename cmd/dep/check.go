@@ -6,6 +6,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -24,7 +26,8 @@ import (
 const checkShortHelp = `Check if imports, Gopkg.toml, and Gopkg.lock are in sync`
 const checkLongHelp = `
 Check determines if your project is in a good state. If problems are found, it
-prints a description of each issue, then exits 1. Passing -q suppresses output.
+prints a description of each issue, then exits 37 if Gopkg.lock is out of sync,
+or 36 if only vendor is. Passing -q suppresses output.
 
 Flags control which specific checks will be run. By default, dep check verifies
 that Gopkg.lock is in sync with Gopkg.toml and the imports in your project's .go
@@ -34,19 +37,50 @@ can be disabled with -skip-lock and -skip-vendor, respectively.
 (See https://golang.github.io/dep/docs/ensure-mechanics.html#staying-in-sync for
 more information on what it means to be "in sync.")
 
+When the vendored copy of a project no longer matches Gopkg.lock, check lists
+the files in it that were added, removed, or modified since dep last wrote it
+out, if dep recorded them then. With -diff, check also exports a fresh copy of
+the locked revision of each such project, and prints a unified diff from it to
+the vendored copy, showing exactly what was changed by hand. The diff can be
+applied elsewhere with "patch -p1" or "git apply", such as to upstream the
+changes.
+
 If your workflow necessitates that you modify the contents of vendor, you can
 force check to ignore hash mismatches on a per-project basis by naming
 project roots in Gopkg.toml's "noverify" list.
+
+With -json, check prints a JSON report of everything it found instead, for use
+in CI pipelines, and exits with a code that identifies the classes of problem
+found. The code is the sum of:
+
+    2   imports and Gopkg.lock's input-imports differ
+    4   locked versions are not allowed by Gopkg.toml's constraints or overrides
+    8   Gopkg.lock is missing digests, or its prune options differ from
+        Gopkg.toml's
+    16  vendor is out of sync with Gopkg.lock
+
+An exit code of 1 means that the checks could not be run at all.
 `
 
+// The exit codes of dep check -json, for each class of problem found. They
+// are combined by addition, so each combination is distinct.
+const (
+	checkFailImports     = 1 << (iota + 1) // imports and input-imports differ
+	checkFailConstraints                   // constraints or overrides unmet
+	checkFailLock                          // digests missing, or prune options changed
+	checkFailVendor                        // vendor out of sync
+)
+
 type checkCommand struct {
 	quiet                bool
+	json                 bool
+	diff                 bool
 	skiplock, skipvendor bool
 }
 
 func (cmd *checkCommand) Name() string { return "check" }
 func (cmd *checkCommand) Args() string {
-	return "[-q] [-skip-lock] [-skip-vendor]"
+	return "[-q] [-json] [-diff] [-skip-lock] [-skip-vendor]"
 }
 func (cmd *checkCommand) ShortHelp() string { return checkShortHelp }
 func (cmd *checkCommand) LongHelp() string  { return checkLongHelp }
@@ -56,25 +90,70 @@ func (cmd *checkCommand) Register(fs *flag.FlagSet) {
 	fs.BoolVar(&cmd.skiplock, "skip-lock", false, "Skip checking that imports and Gopkg.toml are in sync with Gopkg.lock")
 	fs.BoolVar(&cmd.skipvendor, "skip-vendor", false, "Skip checking that vendor is in sync with Gopkg.lock")
 	fs.BoolVar(&cmd.quiet, "q", false, "Suppress non-error output")
+	fs.BoolVar(&cmd.json, "json", false, "Output a JSON report, and exit with a code identifying the problems found")
+	fs.BoolVar(&cmd.diff, "diff", false, "Print a diff of the changes made to each vendored project that no longer matches Gopkg.lock")
+}
+
+// checkReport is the report printed by dep check -json.
+type checkReport struct {
+	InSync   bool
+	Failures []string           // "imports", "constraints", "lock" or "vendor", for each class of problem found.
+	Lock     *checkLockReport   `json:",omitempty"` // Absent with -skip-lock.
+	Vendor   *checkVendorReport `json:",omitempty"` // Absent with -skip-vendor.
+}
+
+type checkLockReport struct {
+	MissingImports   []string // Imported or required, but missing from input-imports.
+	ExcessImports    []string // In input-imports, but neither imported nor required.
+	UnmetConstraints []checkUnmet
+	UnmetOverrides   []checkUnmet
+	PruneOptsChanged []checkPruneChange
+	MissingDigests   []string // Projects with no hash digest in Gopkg.lock.
+}
+
+type checkUnmet struct {
+	ProjectRoot string
+	Version     string
+	Constraint  string
+}
+
+type checkPruneChange struct {
+	ProjectRoot string
+	Before      string
+	After       string
+}
+
+type checkVendorReport struct {
+	Projects []checkVendorProject
+}
+
+type checkVendorProject struct {
+	ProjectRoot string
+	Status      string   // "missing", "unused", "orphaned", "digest-mismatch", "no-digest" or "hash-version-mismatch".
+	Ignored     bool     `json:",omitempty"` // Whether the problem is ignored, as the project is marked noverify.
+	Added       []string `json:",omitempty"`
+	Removed     []string `json:",omitempty"`
+	Modified    []string `json:",omitempty"`
+	Diff        string   `json:",omitempty"` // With -diff, a unified diff from the locked revision to the vendored copy.
 }
 
 func (cmd *checkCommand) Run(ctx *dep.Ctx, args []string) error {
 	logger := ctx.Out
-	if cmd.quiet {
+	if cmd.quiet || cmd.json {
 		logger = log.New(ioutil.Discard, "", 0)
 	}
+	report := checkReport{Failures: []string{}}
+	var failed int
 
 	p, err := ctx.LoadProject()
 	if err != nil {
 		return err
 	}
 
-	sm, err := ctx.SourceManager()
+	sm, err := sourceManager(ctx)
 	if err != nil {
 		return err
 	}
-
-	sm.UseDefaultSignalHandling()
 	defer sm.Release()
 
 	var fail bool
@@ -86,6 +165,16 @@ func (cmd *checkCommand) Run(ctx *dep.Ctx, args []string) error {
 		lsat := verify.LockSatisfiesInputs(p.Lock, p.Manifest, p.RootPackageTree)
 		delta := verify.DiffLocks(p.Lock, p.ChangedLock)
 		sat, changed := lsat.Satisfied(), delta.Changed(verify.PruneOptsChanged|verify.HashVersionChanged)
+		report.Lock = newCheckLockReport(lsat)
+		if len(lsat.MissingImports) > 0 || len(lsat.ExcessImports) > 0 {
+			failed |= checkFailImports
+		}
+		if len(lsat.UnmetConstraints) > 0 || len(lsat.UnmetOverrides) > 0 {
+			failed |= checkFailConstraints
+		}
+		if changed {
+			failed |= checkFailLock
+		}
 
 		if changed || !sat {
 			fail = true
@@ -113,9 +202,15 @@ func (cmd *checkCommand) Run(ctx *dep.Ctx, args []string) error {
 						old := lpd.PruneOptsBefore & ^gps.PruneNestedVendorDirs
 						new := lpd.PruneOptsAfter & ^gps.PruneNestedVendorDirs
 						logger.Printf("%s: prune options changed (%s -> %s)\n", pr, old, new)
+						report.Lock.PruneOptsChanged = append(report.Lock.PruneOptsChanged, checkPruneChange{
+							ProjectRoot: pr,
+							Before:      old.String(),
+							After:       new.String(),
+						})
 					}
 					if lpd.HashVersionWasZero() {
 						logger.Printf("%s: no hash digest in lock\n", pr)
+						report.Lock.MissingDigests = append(report.Lock.MissingDigests, pr)
 					}
 				}
 			}
@@ -157,6 +252,7 @@ func (cmd *checkCommand) Run(ctx *dep.Ctx, args []string) error {
 				fallthrough
 			case verify.NotInTree, verify.NotInLock:
 				fail = true
+				failed |= checkFailVendor
 				if !vendorfail {
 					vendorfail = true
 					logger.Println("# vendor is out of sync:")
@@ -166,16 +262,33 @@ func (cmd *checkCommand) Run(ctx *dep.Ctx, args []string) error {
 		}
 		sort.Strings(ordered)
 
+		// For projects whose vendored trees no longer match Gopkg.lock, find
+		// out exactly which files were changed since they were vendored, if
+		// that was recorded.
+		var mismatched []string
+		for _, pr := range ordered {
+			if statuses[pr] == verify.DigestMismatchInLock {
+				mismatched = append(mismatched, pr)
+			}
+		}
+		changes, err := verify.CheckVendorFiles(filepath.Join(p.AbsRoot, "vendor"), mismatched)
+		if err != nil {
+			return errors.Wrap(err, "error while checking vendored files")
+		}
+
+		report.Vendor = &checkVendorReport{Projects: []checkVendorProject{}}
 		for _, pr := range ordered {
 			var nvSuffix string
 			if noverify[pr] {
 				nvSuffix = "  (CHECK IGNORED: marked noverify in Gopkg.toml)"
 			}
 
+			vp := checkVendorProject{ProjectRoot: pr}
 			status := statuses[pr]
 			switch status {
 			case verify.NotInTree:
 				logger.Printf("%s: missing from vendor\n", pr)
+				vp.Status = "missing"
 			case verify.NotInLock:
 				fi, err := os.Stat(filepath.Join(p.AbsRoot, "vendor", pr))
 				if err != nil {
@@ -183,28 +296,149 @@ func (cmd *checkCommand) Run(ctx *dep.Ctx, args []string) error {
 				}
 				if fi.IsDir() {
 					logger.Printf("%s: unused project\n", pr)
+					vp.Status = "unused"
 				} else {
 					logger.Printf("%s: orphaned file\n", pr)
+					vp.Status = "orphaned"
 				}
 			case verify.DigestMismatchInLock:
 				logger.Printf("%s: hash of vendored tree not equal to digest in Gopkg.lock%s\n", pr, nvSuffix)
+				fc := changes[pr]
+				for _, f := range fc.Added {
+					logger.Printf("    added:    %s\n", f)
+				}
+				for _, f := range fc.Removed {
+					logger.Printf("    removed:  %s\n", f)
+				}
+				for _, f := range fc.Modified {
+					logger.Printf("    modified: %s\n", f)
+				}
+				vp.Status = "digest-mismatch"
+				vp.Added, vp.Removed, vp.Modified = fc.Added, fc.Removed, fc.Modified
+				if cmd.diff {
+					if vp.Diff, err = vendorDiff(sm, p, pr); err != nil {
+						return err
+					}
+					logger.Print(vp.Diff)
+				}
 			case verify.EmptyDigestInLock:
 				logger.Printf("%s: no digest in Gopkg.lock to compare against hash of vendored tree%s\n", pr, nvSuffix)
+				vp.Status = "no-digest"
 			case verify.HashVersionMismatch:
 				// This will double-print if the hash version is zero, but
 				// that's a rare case that really only occurs before the first
 				// run with a version of dep >=0.5.0, so it's fine.
 				logger.Printf("%s: hash algorithm mismatch, want version %v%s\n", pr, verify.HashVersion, nvSuffix)
+				vp.Status = "hash-version-mismatch"
+			}
+			if vp.Status != "" {
+				vp.Ignored = noverify[pr] && status != verify.NotInTree && status != verify.NotInLock
+				report.Vendor.Projects = append(report.Vendor.Projects, vp)
 			}
 		}
 	}
 
+	if cmd.json {
+		for _, f := range []struct {
+			bit  int
+			name string
+		}{
+			{checkFailImports, "imports"},
+			{checkFailConstraints, "constraints"},
+			{checkFailLock, "lock"},
+			{checkFailVendor, "vendor"},
+		} {
+			if failed&f.bit != 0 {
+				report.Failures = append(report.Failures, f.name)
+			}
+		}
+		report.InSync = failed == 0
+
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		ctx.Out.Print(buf.String())
+		if failed != 0 {
+			return classifiedError{checkFailureClass(failed), silentExit(failed)}
+		}
+		return nil
+	}
+
 	if fail {
-		return silentfail{}
+		return classifiedError{checkFailureClass(failed), silentfail{}}
 	}
 	return nil
 }
 
+// checkFailureClass returns the class of the problems in failed, a combination
+// of the exit codes of dep check -json: lock-mismatch if Gopkg.lock is out of
+// sync, or otherwise vendor-verification.
+func checkFailureClass(failed int) failureClass {
+	if failed&^checkFailVendor != 0 {
+		return failureLockMismatch
+	}
+	return failureVendorVerification
+}
+
+// vendorDiff returns a unified diff from a fresh export of the locked revision
+// of the project pr, pruned as it was when vendored, to its copy in vendor.
+// Pathnames in it are relative to the project root, to apply the diff there.
+func vendorDiff(sm gps.SourceManager, p *dep.Project, pr string) (string, error) {
+	var lp gps.LockedProject
+	for _, candidate := range p.Lock.Projects() {
+		if string(candidate.Ident().ProjectRoot) == pr {
+			lp = candidate
+		}
+	}
+	if lp == nil {
+		return "", nil
+	}
+
+	tmp, err := ioutil.TempDir("", "dep-check")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	to := filepath.Join(tmp, "src")
+	if err = sm.ExportPrunedProject(context.TODO(), lp, lp.(verify.VerifiableProject).PruneOpts, to); err != nil {
+		return "", errors.Wrapf(err, "failed to export %s", pr)
+	}
+
+	var buf bytes.Buffer
+	prefix := "vendor/" + pr + "/"
+	err = verify.DiffTrees(&buf, to, filepath.Join(p.AbsRoot, "vendor", filepath.FromSlash(pr)), "a/"+prefix, "b/"+prefix)
+	return buf.String(), errors.Wrapf(err, "failed to diff vendored copy of %s", pr)
+}
+
+// newCheckLockReport returns the report of lsat, sorted for deterministic
+// output. Lists are empty rather than nil, so that they are never null in
+// JSON.
+func newCheckLockReport(lsat verify.LockSatisfaction) *checkLockReport {
+	r := &checkLockReport{
+		MissingImports:   append([]string{}, lsat.MissingImports...),
+		ExcessImports:    append([]string{}, lsat.ExcessImports...),
+		PruneOptsChanged: []checkPruneChange{},
+		MissingDigests:   []string{},
+	}
+	sort.Strings(r.MissingImports)
+	sort.Strings(r.ExcessImports)
+
+	unmet := func(m map[gps.ProjectRoot]verify.ConstraintMismatch) []checkUnmet {
+		l := []checkUnmet{}
+		for pr, mm := range m {
+			l = append(l, checkUnmet{ProjectRoot: string(pr), Version: mm.V.String(), Constraint: mm.C.String()})
+		}
+		sort.Slice(l, func(i, j int) bool { return l[i].ProjectRoot < l[j].ProjectRoot })
+		return l
+	}
+	r.UnmetConstraints = unmet(lsat.UnmetConstraints)
+	r.UnmetOverrides = unmet(lsat.UnmetOverrides)
+	return r
+}
+
 func sprintLockUnsat(lsat verify.LockSatisfaction) string {
 	var buf bytes.Buffer
 	sort.Strings(lsat.MissingImports)
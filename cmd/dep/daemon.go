@@ -0,0 +1,134 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/smrpc"
+	"github.com/pkg/errors"
+)
+
+const daemonShortHelp = `Serve a shared source manager to other processes`
+const daemonLongHelp = `
+Run a long-lived source manager, serving requests to list, analyze and export
+dependencies over a unix socket until interrupted.
+
+Processes that connect to the socket share the source manager's warm caches,
+and its deduplication and limiting of work on sources, rather than each
+starting from cold. By default, the socket is created in the cache directory,
+where other dep commands look for it: while the daemon runs, they use its
+source manager, and so its configuration, instead of their own.
+
+This command is experimental.
+`
+
+// daemonSocketName is the default name of the socket, within the cache
+// directory, on which the daemon listens.
+const daemonSocketName = "sm.sock"
+
+type daemonCommand struct {
+	socket        string
+	maxConcurrent int
+}
+
+func (cmd *daemonCommand) Name() string      { return "daemon" }
+func (cmd *daemonCommand) Args() string      { return "[-socket path]" }
+func (cmd *daemonCommand) ShortHelp() string { return daemonShortHelp }
+func (cmd *daemonCommand) LongHelp() string  { return daemonLongHelp }
+func (cmd *daemonCommand) Hidden() bool      { return true }
+
+func (cmd *daemonCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.socket, "socket", "", "path of the unix socket to listen on")
+	fs.IntVar(&cmd.maxConcurrent, "max-concurrent", 0, "maximum number of requests to handle at once (0 for no limit)")
+}
+
+func (cmd *daemonCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.Errorf("too many args (%d)", len(args))
+	}
+
+	socket := cmd.socket
+	if socket == "" {
+		socket = daemonSocket(ctx)
+	}
+
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		return err
+	}
+	defer sm.Release()
+
+	// The source manager's lock on the cache directory ensures that no other
+	// daemon is using the socket, so any existing one is stale.
+	os.Remove(socket)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for connections")
+	}
+	defer os.Remove(socket)
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt)
+	defer signal.Stop(sigch)
+	interrupted := make(chan struct{})
+	go func() {
+		<-sigch
+		close(interrupted)
+		l.Close()
+	}()
+
+	ctx.Err.Printf("Serving source manager on %s\n", socket)
+	err = smrpc.NewServer(sm, cmd.maxConcurrent).Serve(l)
+	select {
+	case <-interrupted:
+		return nil
+	default:
+		return errors.Wrap(err, "failed to accept connection")
+	}
+}
+
+// daemonSocket returns the path of the socket on which a daemon for ctx's cache
+// directory listens by default.
+func daemonSocket(ctx *dep.Ctx) string {
+	cachedir := ctx.Cachedir
+	if cachedir == "" {
+		cachedir = filepath.Join(ctx.GOPATH, "pkg", "dep")
+	}
+	return filepath.Join(cachedir, daemonSocketName)
+}
+
+// sourceManager returns the source manager for a command to use: the one
+// served by a daemon on ctx's cache directory, if one is running, or else a
+// new one of its own.
+func sourceManager(ctx *dep.Ctx) (gps.SourceManager, error) {
+	socket := daemonSocket(ctx)
+	if _, err := os.Stat(socket); err == nil {
+		c, err := smrpc.Dial(socket)
+		if err == nil {
+			if ctx.Verbose {
+				ctx.Err.Printf("Using the source manager served on %s\n", socket)
+			}
+			return c, nil
+		}
+		// Most likely a daemon that was killed before it could clean up.
+		if ctx.Verbose {
+			ctx.Err.Println(err)
+		}
+	}
+
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		return nil, err
+	}
+	sm.UseDefaultSignalHandling()
+	return sm, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/smrpc"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestSourceManagerUsesDaemon(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the daemon listens on a unix socket")
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	ctx := &dep.Ctx{
+		Cachedir: h.Path("cache"),
+		Out:      log.New(ioutil.Discard, "", 0),
+		Err:      log.New(ioutil.Discard, "", 0),
+	}
+
+	// Without a daemon, a command has a source manager of its own.
+	sm, err := sourceManager(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sm.(*gps.SourceMgr); !ok {
+		t.Errorf("expected a *gps.SourceMgr without a daemon, got %T", sm)
+	}
+
+	l, err := net.Listen("unix", daemonSocket(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go smrpc.NewServer(sm, 0).Serve(l)
+	defer sm.Release()
+
+	// With one, it uses the daemon's, despite the daemon holding the lock on
+	// the cache directory.
+	c, err := sourceManager(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Release()
+	if _, ok := c.(*smrpc.Client); !ok {
+		t.Errorf("expected a *smrpc.Client with a daemon, got %T", c)
+	}
+}
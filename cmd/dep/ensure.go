@@ -110,6 +110,13 @@ dep ensure -update -no-vendor
 
     As above, but only modify Gopkg.lock; leave vendor/ unchanged.
 
+dep ensure -unpin-mirrors
+
+    Retrieve dependencies that Gopkg.lock records as having been retrieved
+    through a mirror or proxy as currently configured instead, and record
+    where they come from now. Otherwise, they are only ever retrieved through
+    the mirror or proxy recorded in Gopkg.lock.
+
 dep ensure -no-vendor -dry-run
 
     This fails with a non zero exit code if Gopkg.lock is not up to date with
@@ -125,7 +132,7 @@ var (
 
 func (cmd *ensureCommand) Name() string { return "ensure" }
 func (cmd *ensureCommand) Args() string {
-	return "[-update | -add] [-no-vendor | -vendor-only] [-dry-run] [-v] [<spec>...]"
+	return "[-update | -add] [-no-vendor | -vendor-only] [-unpin-mirrors] [-dry-run] [-v] [<spec>...]"
 }
 func (cmd *ensureCommand) ShortHelp() string { return ensureShortHelp }
 func (cmd *ensureCommand) LongHelp() string  { return ensureLongHelp }
@@ -138,15 +145,17 @@ func (cmd *ensureCommand) Register(fs *flag.FlagSet) {
 	fs.BoolVar(&cmd.vendorOnly, "vendor-only", false, "populate vendor/ from Gopkg.lock without updating it first")
 	fs.BoolVar(&cmd.noVendor, "no-vendor", false, "update Gopkg.lock (if needed), but do not update vendor/")
 	fs.BoolVar(&cmd.dryRun, "dry-run", false, "only report the changes that would be made")
+	fs.BoolVar(&cmd.unpinMirrors, "unpin-mirrors", false, "ignore the mirrors and proxies that Gopkg.lock records dependencies being retrieved through, and retrieve them as currently configured")
 }
 
 type ensureCommand struct {
-	examples   bool
-	update     bool
-	add        bool
-	noVendor   bool
-	vendorOnly bool
-	dryRun     bool
+	examples     bool
+	update       bool
+	add          bool
+	noVendor     bool
+	vendorOnly   bool
+	dryRun       bool
+	unpinMirrors bool
 }
 
 func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
@@ -164,11 +173,20 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 
-	sm, err := ctx.SourceManager()
+	// Projects retrieved through a mirror or proxy keep being retrieved
+	// through it, rather than whatever is configured now, unless the user
+	// asks for them not to be.
+	if cmd.unpinMirrors {
+		p.ChangedLock.UnpinMirrors()
+	} else {
+		ctx.PinnedMirrors = p.Lock.PinnedMirrors()
+	}
+	ctx.Signatures = p.Manifest.Signatures
+
+	sm, err := sourceManager(ctx)
 	if err != nil {
 		return err
 	}
-	sm.UseDefaultSignalHandling()
 	defer sm.Release()
 
 	if err := dep.ValidateProjectRoots(ctx, p.Manifest, sm); err != nil {
@@ -179,6 +197,9 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 	if ctx.Verbose {
 		params.TraceLogger = ctx.Err
 	}
+	if params.ProjectAnalyzer, err = projectAnalyzer(ctx, p, sm); err != nil {
+		return err
+	}
 
 	if cmd.vendorOnly {
 		return cmd.runVendorOnly(ctx, args, p, sm, params)
@@ -234,6 +255,9 @@ func (cmd *ensureCommand) validateFlags() error {
 			// TODO(sdboyer) can't think of anything not snarky right now
 			return errors.New("really?")
 		}
+		if cmd.unpinMirrors {
+			return errors.New("-vendor-only populates vendor/ from Gopkg.lock as it is; cannot pass -unpin-mirrors with it")
+		}
 	}
 	return nil
 }
@@ -278,11 +302,14 @@ func (cmd *ensureCommand) runDefault(ctx *dep.Ctx, args []string, p *dep.Project
 			return errors.Wrap(err, "prepare solver")
 		}
 
-		solution, err := solver.Solve(context.TODO())
+		solution, err := solveAndReport(ctx, cmd.Name(), solver, sm)
 		if err != nil {
 			return handleAllTheFailuresOfTheWorld(err)
 		}
 		lock = dep.LockFromSolution(solution, p.Manifest.PruneOptions)
+		if err := ctx.CheckPinnedRevisions(lock); err != nil {
+			return err
+		}
 	}
 
 	dw, err := dep.NewDeltaWriter(p, lock, cmd.vendorBehavior())
@@ -298,7 +325,20 @@ func (cmd *ensureCommand) runDefault(ctx *dep.Ctx, args []string, p *dep.Project
 	if ctx.Verbose {
 		logger = ctx.Err
 	}
-	return errors.WithMessage(dw.Write(p.AbsRoot, sm, true, logger), "grouped write of manifest, lock and vendor")
+	if err := dw.Write(p.AbsRoot, sm, true, logger); err != nil {
+		return errors.WithMessage(err, "grouped write of manifest, lock and vendor")
+	}
+	return cmd.updateNotices(p, lock)
+}
+
+// updateNotices regenerates the project's notices file, if it has one, from the
+// newly written vendor/ and l, the lock it was written from. If vendor/ was left
+// as it was, so is the notices file.
+func (cmd *ensureCommand) updateNotices(p *dep.Project, l *dep.Lock) error {
+	if cmd.vendorBehavior() == dep.VendorNever {
+		return nil
+	}
+	return updateNotices(p, l)
 }
 
 func (cmd *ensureCommand) runVendorOnly(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.SourceManager, params gps.SolveParameters) error {
@@ -326,7 +366,10 @@ func (cmd *ensureCommand) runVendorOnly(ctx *dep.Ctx, args []string, p *dep.Proj
 	if ctx.Verbose {
 		logger = ctx.Err
 	}
-	return errors.WithMessage(dw.Write(p.AbsRoot, sm, true, logger), "grouped write of manifest, lock and vendor")
+	if err := dw.Write(p.AbsRoot, sm, true, logger); err != nil {
+		return errors.WithMessage(err, "grouped write of manifest, lock and vendor")
+	}
+	return cmd.updateNotices(p, p.Lock)
 }
 
 func (cmd *ensureCommand) runUpdate(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.SourceManager, params gps.SolveParameters) error {
@@ -353,7 +396,7 @@ func (cmd *ensureCommand) runUpdate(ctx *dep.Ctx, args []string, p *dep.Project,
 	if err != nil {
 		return errors.Wrap(err, "fastpath solver prepare")
 	}
-	solution, err := solver.Solve(context.TODO())
+	solution, err := solveAndReport(ctx, cmd.Name(), solver, sm)
 	if err != nil {
 		// TODO(sdboyer) special handling for warning cases as described in spec
 		// - e.g., named projects did not upgrade even though newer versions
@@ -361,7 +404,12 @@ func (cmd *ensureCommand) runUpdate(ctx *dep.Ctx, args []string, p *dep.Project,
 		return handleAllTheFailuresOfTheWorld(err)
 	}
 
-	dw, err := dep.NewDeltaWriter(p, dep.LockFromSolution(solution, p.Manifest.PruneOptions), cmd.vendorBehavior())
+	lock := dep.LockFromSolution(solution, p.Manifest.PruneOptions)
+	if err := ctx.CheckPinnedRevisions(lock); err != nil {
+		return err
+	}
+
+	dw, err := dep.NewDeltaWriter(p, lock, cmd.vendorBehavior())
 	if err != nil {
 		return err
 	}
@@ -373,7 +421,10 @@ func (cmd *ensureCommand) runUpdate(ctx *dep.Ctx, args []string, p *dep.Project,
 	if ctx.Verbose {
 		logger = ctx.Err
 	}
-	return errors.Wrap(dw.Write(p.AbsRoot, sm, false, logger), "grouped write of manifest, lock and vendor")
+	if err := dw.Write(p.AbsRoot, sm, false, logger); err != nil {
+		return errors.Wrap(err, "grouped write of manifest, lock and vendor")
+	}
+	return cmd.updateNotices(p, lock)
 }
 
 func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.SourceManager, params gps.SolveParameters) error {
@@ -472,7 +523,7 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 				return
 			}
 
-			err = sm.SyncSourceFor(pc.Ident)
+			err = sm.SyncSourceFor(context.TODO(), pc.Ident)
 			if err != nil {
 				errCh <- errors.Wrapf(err, "failed to fetch source for %s", pc.Ident.ProjectRoot)
 				return
@@ -584,7 +635,7 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 	if err != nil {
 		return errors.Wrap(err, "fastpath solver prepare")
 	}
-	solution, err := solver.Solve(context.TODO())
+	solution, err := solveAndReport(ctx, cmd.Name(), solver, sm)
 	if err != nil {
 		// TODO(sdboyer) detect if the failure was specifically about some of the -add arguments
 		return handleAllTheFailuresOfTheWorld(err)
@@ -630,7 +681,12 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 	}
 	sort.Strings(reqlist)
 
-	dw, err := dep.NewDeltaWriter(p, dep.LockFromSolution(solution, p.Manifest.PruneOptions), cmd.vendorBehavior())
+	lock := dep.LockFromSolution(solution, p.Manifest.PruneOptions)
+	if err := ctx.CheckPinnedRevisions(lock); err != nil {
+		return err
+	}
+
+	dw, err := dep.NewDeltaWriter(p, lock, cmd.vendorBehavior())
 	if err != nil {
 		return err
 	}
@@ -646,6 +702,9 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 	if err := errors.Wrap(dw.Write(p.AbsRoot, sm, true, logger), "grouped write of manifest, lock and vendor"); err != nil {
 		return err
 	}
+	if err := cmd.updateNotices(p, lock); err != nil {
+		return err
+	}
 
 	// FIXME(sdboyer) manifest writes ABSOLUTELY need verification - follow up!
 	f, err := os.OpenFile(filepath.Join(p.AbsRoot, dep.ManifestName), os.O_APPEND|os.O_WRONLY, 0666)
@@ -710,13 +769,13 @@ func getProjectConstraint(arg string, sm gps.SourceManager) (gps.ProjectConstrai
 		source = parts[1]
 	}
 
-	pr, err := sm.DeduceProjectRoot(arg)
+	pr, err := sm.DeduceProjectRoot(context.TODO(), arg)
 	if err != nil {
 		return emptyPC, "", errors.Wrapf(err, "could not infer project root from dependency path: %s", arg) // this should go through to the user
 	}
 
 	pi := gps.ProjectIdentifier{ProjectRoot: pr, Source: source}
-	c, err := sm.InferConstraint(versionStr, pi)
+	c, err := sm.InferConstraint(context.TODO(), versionStr, pi)
 	if err != nil {
 		return emptyPC, "", err
 	}
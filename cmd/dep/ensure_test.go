@@ -43,7 +43,12 @@ func TestInvalidEnsureFlagCombinations(t *testing.T) {
 	if err := ec.validateFlags(); err == nil {
 		t.Error("-vendor-only with -no-vendor should fail validation")
 	}
-	ec.noVendor = false
+
+	ec.unpinMirrors, ec.noVendor = true, false
+	if err := ec.validateFlags(); err == nil {
+		t.Error("-vendor-only with -unpin-mirrors should fail validation")
+	}
+	ec.unpinMirrors = false
 
 	// Also verify that the plain ensure path takes no args. This is a shady
 	// test, as lots of other things COULD return errors, and we don't check
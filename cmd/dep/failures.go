@@ -6,11 +6,148 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
 
 	"github.com/golang/dep/gps"
 	"github.com/pkg/errors"
 )
 
+// failureClass is a class of failure that dep exits with a distinct code for,
+// so that CI systems can react to each differently. Names and codes are
+// stable; the codes are above those dep check -json exits with.
+type failureClass struct {
+	name string
+	code int
+}
+
+var (
+	failureOther              = failureClass{"other", errorExitCode}
+	failureNetwork            = failureClass{"network", 32}
+	failureAuth               = failureClass{"auth", 33}
+	failureDeduction          = failureClass{"deduction", 34}
+	failureNoSolution         = failureClass{"no-solution", 35}
+	failureVendorVerification = failureClass{"vendor-verification", 36}
+	failureLockMismatch       = failureClass{"lock-mismatch", 37}
+)
+
+// classifiedError is an error whose class is known where it arises, such as a
+// problem found by dep check, rather than by classifyFailure.
+type classifiedError struct {
+	class failureClass
+	err   error
+}
+
+func (e classifiedError) Error() string {
+	return e.err.Error()
+}
+
+// authFailure matches what hosts, and git and hg, say when credentials are
+// missing or refused.
+var authFailure = regexp.MustCompile(`(?i)authentication failed|authentication required|could not read (username|password)|permission denied \(publickey|terminal prompts disabled|bad credentials|returned error: 40[13]\b|\b40[13] (unauthorized|forbidden)\b`)
+
+// networkFailure matches what git and hg, and Go's HTTP client, say when a host
+// cannot be reached.
+var networkFailure = regexp.MustCompile(`(?i)could not resolve host|no such host|connection (refused|reset|timed out)|network is unreachable|i/o timeout|tls handshake timeout|could not read from remote repository|unable to access|abort: error:`)
+
+// classifyFailure returns the class of err, the failure of a command. Where a
+// failure has several causes, such as a solve that failed for both network
+// and constraint problems, the one most likely to be at the root of the others
+// wins: auth, then network, deduction, vendor-verification and no-solution.
+func classifyFailure(err error) failureClass {
+	if ce, ok := errors.Cause(err).(classifiedError); ok {
+		return ce.class
+	}
+
+	var auth, network, deduction, verification, noSolution bool
+	_, deduction = errors.Cause(err).(gps.DeductionErrs)
+	for _, cause := range gps.FailureCauses(err) {
+		msg := cause.Error()
+		switch c := errors.Cause(cause).(type) {
+		case gps.ChecksumMismatchError, *gps.ExportMismatchError:
+			verification = true
+			continue
+		case *gps.GitHubRateLimitError:
+			network = true
+			continue
+		case *url.Error, net.Error:
+			network = true
+			continue
+		default:
+			if c == context.DeadlineExceeded {
+				network = true
+				continue
+			}
+		}
+
+		switch {
+		case authFailure.MatchString(msg):
+			auth = true
+		case networkFailure.MatchString(msg):
+			network = true
+		case gps.IsSolveFailure(cause):
+			noSolution = true
+		case strings.Contains(msg, "unable to deduce repository and source type"):
+			deduction = true
+		}
+	}
+
+	switch {
+	case auth:
+		return failureAuth
+	case network:
+		return failureNetwork
+	case deduction:
+		return failureDeduction
+	case verification:
+		return failureVendorVerification
+	case noSolution:
+		return failureNoSolution
+	}
+	return failureOther
+}
+
+// errorEnvelope is what dep writes to stderr about a failure when
+// DEPERRORFORMAT is json.
+type errorEnvelope struct {
+	Class    string `json:"class"`
+	ExitCode int    `json:"exit_code"`
+	Message  string `json:"message,omitempty"`
+}
+
+// reportFailure reports err, the failure of a command, to logger, as JSON if
+// asJSON is set, and returns the code to exit with.
+func reportFailure(logger *log.Logger, asJSON bool, err error) int {
+	class := classifyFailure(err)
+	code, msg := class.code, fmt.Sprintf("%v", err)
+	if ce, ok := err.(classifiedError); ok {
+		err = ce.err
+	}
+	switch e := err.(type) {
+	case silentExit:
+		code, msg = int(e), ""
+	case silentfail:
+		msg = ""
+	}
+
+	if asJSON {
+		b, jerr := json.Marshal(errorEnvelope{Class: class.name, ExitCode: code, Message: strings.TrimSpace(msg)})
+		if jerr == nil {
+			logger.Printf("%s\n", b)
+			return code
+		}
+	}
+	if msg != "" {
+		logger.Printf("%s\n", msg)
+	}
+	return code
+}
+
 // TODO solve failures can be really creative - we need to be similarly creative
 // in handling them and informing the user appropriately
 func handleAllTheFailuresOfTheWorld(err error) error {
@@ -19,5 +156,16 @@ func handleAllTheFailuresOfTheWorld(err error) error {
 		return nil
 	}
 
+	// Policy violations are what the user most needs to act on, but they are
+	// buried in the failures of every version they ruled out, so list them
+	// up front.
+	if pvs := gps.PolicyViolations(err); len(pvs) > 0 {
+		msgs := make([]string, 0, len(pvs))
+		for _, pv := range pvs {
+			msgs = append(msgs, pv.Error())
+		}
+		return errors.Wrapf(err, "Solving failure, with dependencies violating policy:\n\t%s\n", strings.Join(msgs, "\n\t"))
+	}
+
 	return errors.Wrap(err, "Solving failure")
 }
@@ -0,0 +1,79 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want failureClass
+	}{
+		{"plain", errors.New("no such file"), failureOther},
+		{"classified", errors.Wrap(classifiedError{failureLockMismatch, silentfail{}}, "check"), failureLockMismatch},
+		{"unresolvable host", errors.Wrap(errors.New("fatal: Could not resolve host: example.com"), "unable to clone"), failureNetwork},
+		{"timeout", errors.Wrap(context.DeadlineExceeded, "list-versions"), failureNetwork},
+		{"rate limit", errors.Wrap(&gps.GitHubRateLimitError{}, "listing versions"), failureNetwork},
+		{"refused credentials", errors.New("fatal: Authentication failed for 'https://example.com/a.git/'"), failureAuth},
+		{"missing credentials", errors.New("fatal: could not read Username for 'https://github.com': terminal prompts disabled"), failureAuth},
+		{"forbidden", errors.New("fatal: unable to access 'https://example.com/a.git/': The requested URL returned error: 403"), failureAuth},
+		{"deduction", gps.DeductionErrs{"example.com/a": errors.New("example.com/a is not a valid path for a source on example.com")}, failureDeduction},
+		{"unreachable deduction", gps.DeductionErrs{"example.com/a": errors.New("unable to deduce repository and source type for \"example.com/a\": dial tcp: i/o timeout")}, failureNetwork},
+		{"checksum", errors.Wrap(gps.ChecksumMismatchError{Module: "example.com/a"}, "verifying"), failureVendorVerification},
+	}
+	for _, c := range cases {
+		if got := classifyFailure(c.err); got != c.want {
+			t.Errorf("%s: expected class %s, got %s", c.name, c.want.name, got.name)
+		}
+	}
+}
+
+func TestReportFailure(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	err := errors.New("fatal: Could not resolve host: example.com")
+	if code := reportFailure(logger, false, err); code != failureNetwork.code {
+		t.Errorf("expected exit code %d, got %d", failureNetwork.code, code)
+	}
+	if got, want := buf.String(), err.Error()+"\n"; got != want {
+		t.Errorf("unexpected output:\n\t(GOT): %q\n\t(WNT): %q", got, want)
+	}
+
+	buf.Reset()
+	if code := reportFailure(logger, true, err); code != failureNetwork.code {
+		t.Errorf("expected exit code %d, got %d", failureNetwork.code, code)
+	}
+	var env errorEnvelope
+	if err := json.Unmarshal(buf.Bytes(), &env); err != nil {
+		t.Fatalf("expected a JSON envelope, got %q: %v", buf.String(), err)
+	}
+	if want := (errorEnvelope{Class: "network", ExitCode: failureNetwork.code, Message: err.Error()}); env != want {
+		t.Errorf("unexpected envelope:\n\t(GOT): %+v\n\t(WNT): %+v", env, want)
+	}
+
+	// Silent failures say nothing, except in an envelope, and keep any exit
+	// code of their own.
+	buf.Reset()
+	if code := reportFailure(logger, false, classifiedError{failureLockMismatch, silentExit(6)}); code != 6 || buf.Len() != 0 {
+		t.Errorf("expected a silent exit with code 6, got %d and %q", code, buf.String())
+	}
+	if code := reportFailure(logger, true, classifiedError{failureVendorVerification, silentfail{}}); code != failureVendorVerification.code {
+		t.Errorf("expected exit code %d, got %d", failureVendorVerification.code, code)
+	}
+	if got, want := buf.String(), `{"class":"vendor-verification","exit_code":36}`+"\n"; got != want {
+		t.Errorf("unexpected output:\n\t(GOT): %q\n\t(WNT): %q", got, want)
+	}
+}
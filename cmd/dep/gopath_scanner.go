@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -210,7 +211,7 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 
 	var syncDepGroup sync.WaitGroup
 	syncDep := func(pr gps.ProjectRoot, sm gps.SourceManager) {
-		if err := sm.SyncSourceFor(gps.ProjectIdentifier{ProjectRoot: pr}); err != nil {
+		if err := sm.SyncSourceFor(context.TODO(), gps.ProjectIdentifier{ProjectRoot: pr}); err != nil {
 			g.ctx.Err.Printf("%+v", errors.Wrapf(err, "Unable to cache %s", pr))
 		}
 		syncDepGroup.Done()
@@ -224,7 +225,7 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 		// TODO(sdboyer) these are not import paths by this point, they've
 		// already been worked down to project roots.
 		ip := string(ippr)
-		pr, err := g.sm.DeduceProjectRoot(ip)
+		pr, err := g.sm.DeduceProjectRoot(context.TODO(), ip)
 		if err != nil {
 			return projectData{}, errors.Wrap(err, "sm.DeduceProjectRoot")
 		}
@@ -277,7 +278,7 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 		case white:
 			colors[pkg] = grey
 
-			pr, err := g.sm.DeduceProjectRoot(pkg)
+			pr, err := g.sm.DeduceProjectRoot(context.TODO(), pkg)
 			if err != nil {
 				return errors.Wrap(err, "could not deduce project root for "+pkg)
 			}
@@ -5,7 +5,6 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"log"
 	"os"
@@ -91,11 +90,10 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 
-	sm, err := ctx.SourceManager()
+	sm, err := sourceManager(ctx)
 	if err != nil {
 		return errors.Wrap(err, "init failed: unable to create a source manager")
 	}
-	sm.UseDefaultSignalHandling()
 	defer sm.Release()
 
 	if ctx.Verbose {
@@ -152,12 +150,15 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		return errors.Wrap(err, "init failed: unable to prepare the solver")
 	}
 
-	soln, err := s.Solve(context.TODO())
+	soln, err := solveAndReport(ctx, cmd.Name(), s, sm)
 	if err != nil {
 		err = handleAllTheFailuresOfTheWorld(err)
 		return errors.Wrap(err, "init failed: unable to solve the dependency graph")
 	}
 	p.Lock = dep.LockFromSolution(soln, p.Manifest.PruneOptions)
+	if err = ctx.CheckPinnedRevisions(p.Lock); err != nil {
+		return errors.Wrap(err, "init failed")
+	}
 
 	rootAnalyzer.FinalizeRootManifestAndLock(p.Manifest, p.Lock, copyLock)
 
@@ -11,6 +11,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -21,6 +22,7 @@ import (
 	"time"
 
 	"github.com/golang/dep"
+	"github.com/golang/dep/gps/sandbox"
 	"github.com/golang/dep/internal/fs"
 )
 
@@ -47,7 +49,24 @@ func (silentfail) Error() string {
 	return ""
 }
 
+// Helper type so that commands can fail with a particular exit code, without
+// generating any additional output.
+type silentExit int
+
+func (silentExit) Error() string {
+	return ""
+}
+
 func main() {
+	// dep runs its own analyzer in a sandbox by running itself.
+	if os.Getenv(sandbox.ChildEnv) != "" {
+		if err := sandbox.Serve(dep.Analyzer{}, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	p := &profile{}
 
 	// Redefining Usage() customizes the output of `dep -h`
@@ -172,21 +191,62 @@ func (c *Config) Run() int {
 				return errorExitCode
 			}
 
+			// Settings in the user's config file apply unless the project's
+			// config file overrides them, and the environment overrides both.
+			cfg, err := dep.LoadConfig(getEnv(c.Env, "DEPCONFIG"))
+			if err != nil {
+				errLogger.Printf("dep: %v\n", err)
+				return errorExitCode
+			}
+			repoCfg, err := dep.LoadRepoConfig(c.WorkingDir)
+			if err != nil {
+				errLogger.Printf("dep: %v\n", err)
+				return errorExitCode
+			}
+			cfg = cfg.Override(repoCfg)
+			env := append(cfg.Env(), c.Env...)
+
 			// Cachedir is loaded from env if present. `$GOPATH/pkg/dep` is used as the
-			// default cache location.
-			cachedir := getEnv(c.Env, "DEPCACHEDIR")
-			if cachedir != "" {
-				if err := fs.EnsureDir(cachedir, 0777); err != nil {
+			// default cache location. The env may list several cache directories,
+			// checked in order; the first writable one is written to, and the rest
+			// are only read from.
+			var cachedir string
+			var sharedCachedirs []string
+			for _, dir := range filepath.SplitList(getEnv(env, "DEPCACHEDIR")) {
+				if err := fs.EnsureDir(dir, 0777); err != nil {
 					errLogger.Printf(
-						"dep: $DEPCACHEDIR set to an invalid or inaccessible path: %q\n", cachedir,
+						"dep: $DEPCACHEDIR set to an invalid or inaccessible path: %q\n", dir,
 					)
 					errLogger.Printf("dep: failed to ensure cache directory: %v\n", err)
 					return errorExitCode
 				}
+				if cachedir == "" && isWritableDir(dir) {
+					cachedir = dir
+				} else {
+					sharedCachedirs = append(sharedCachedirs, dir)
+				}
+			}
+			if cachedir == "" && len(sharedCachedirs) > 0 {
+				errLogger.Println("dep: none of the directories in $DEPCACHEDIR is writable")
+				return errorExitCode
+			}
+
+			// Shared caches are only ever read from, so they must already exist.
+			for _, dir := range filepath.SplitList(getEnv(env, "DEPSHAREDCACHEDIR")) {
+				if isDir, err := fs.IsDir(dir); !isDir {
+					errLogger.Printf(
+						"dep: $DEPSHAREDCACHEDIR set to an invalid or inaccessible path: %q\n", dir,
+					)
+					if err != nil {
+						errLogger.Printf("dep: %v\n", err)
+					}
+					return errorExitCode
+				}
+				sharedCachedirs = append(sharedCachedirs, dir)
 			}
 
 			var cacheAge time.Duration
-			if env := getEnv(c.Env, "DEPCACHEAGE"); env != "" {
+			if env := getEnv(env, "DEPCACHEAGE"); env != "" {
 				var err error
 				cacheAge, err = time.ParseDuration(env)
 				if err != nil {
@@ -195,14 +255,59 @@ func (c *Config) Run() int {
 				}
 			}
 
+			registries, err := parseHostMap(getEnv(env, "DEPREGISTRIES"), "URL")
+			if err != nil {
+				errLogger.Printf("dep: failed to parse $DEPREGISTRIES: %v\n", err)
+				return errorExitCode
+			}
+
+			githubTokens, err := parseHostMap(getEnv(env, "DEPGITHUBTOKENS"), "token")
+			if err != nil {
+				errLogger.Printf("dep: failed to parse $DEPGITHUBTOKENS: %v\n", err)
+				return errorExitCode
+			}
+			if token := getEnv(env, "GITHUB_TOKEN"); token != "" && getEnv(env, "DEPGITHUBAPI") != "" {
+				if githubTokens == nil {
+					githubTokens = make(map[string]string)
+				}
+				if _, has := githubTokens["github.com"]; !has {
+					githubTokens["github.com"] = token
+				}
+			}
+
 			// Set up dep context.
 			ctx := &dep.Ctx{
-				Out:            outLogger,
-				Err:            errLogger,
-				Verbose:        verbose,
-				DisableLocking: getEnv(c.Env, "DEPNOLOCK") != "",
-				Cachedir:       cachedir,
-				CacheAge:       cacheAge,
+				Out:              outLogger,
+				Err:              errLogger,
+				Verbose:          verbose,
+				DisableLocking:   getEnv(env, "DEPNOLOCK") != "",
+				Cachedir:         cachedir,
+				SharedCachedirs:  sharedCachedirs,
+				CacheAge:         cacheAge,
+				Keyring:          getEnv(env, "DEPKEYRING"),
+				Registries:       registries,
+				Athens:           getEnv(env, "DEPATHENS"),
+				AthensExclude:    splitList(getEnv(env, "DEPATHENSEXCLUDE")),
+				SumDB:            getEnv(env, "DEPSUMDB"),
+				SumDBFailClosed:  getEnv(env, "DEPSUMDBFAILCLOSED") != "",
+				AllowedHosts:     splitList(getEnv(env, "DEPALLOWEDHOSTS")),
+				DeniedPrefixes:   splitList(getEnv(env, "DEPDENIEDPREFIXES")),
+				AllowedLicenses:  splitList(getEnv(env, "DEPALLOWEDLICENSES")),
+				AllowlistFile:    getEnv(env, "DEPREVISIONALLOWLIST"),
+				NetworkAudit:     getEnv(env, "DEPNETWORKAUDIT"),
+				SandboxAnalyzers: getEnv(env, "DEPSANDBOXANALYZERS") != "",
+				GitHubTokens:     githubTokens,
+				ProxyOnly:        getEnv(env, "DEPPROXYONLY") != "",
+				Provenance:       getEnv(env, "DEPPROVENANCE") != "",
+				StrictRevisions:  getEnv(env, "DEPSTRICTREVISIONS") != "",
+				CallTimeouts:     cfg.CallTimeouts,
+				MaxNetworkCalls:  cfg.MaxNetworkCalls,
+				Telemetry:        getEnv(env, "DEPTELEMETRY"),
+				FileDigests:      cfg.FileDigests,
+				NormalizeExports: cfg.NormalizeExports,
+				HardlinkExports:  cfg.HardlinkExports,
+				SparseExports:    cfg.SparseExports,
+				Mirrors:          cfg.Mirrors,
 			}
 
 			GOPATHS := filepath.SplitList(getEnv(c.Env, "GOPATH"))
@@ -210,10 +315,7 @@ func (c *Config) Run() int {
 
 			// Run the command with the post-flag-processing args.
 			if err := cmd.Run(ctx, flags.Args()); err != nil {
-				if _, ok := err.(silentfail); !ok {
-					errLogger.Printf("%v\n", err)
-				}
-				return errorExitCode
+				return reportFailure(errLogger, getEnv(env, "DEPERRORFORMAT") == "json", err)
 			}
 
 			// Easy peasy livin' breezy.
@@ -221,6 +323,15 @@ func (c *Config) Run() int {
 		}
 	}
 
+	// Commands dep doesn't have may be provided by a plugin on PATH.
+	if exe := findPlugin(cmdName, getEnv(c.Env, "PATH")); exe != "" {
+		args := c.Args[2:]
+		if printCommandHelp {
+			args = []string{"-h"}
+		}
+		return c.runPlugin(exe, args)
+	}
+
 	errLogger.Printf("dep: %s: no such command\n", cmdName)
 	fprintUsage(c.Stderr)
 	return errorExitCode
@@ -238,6 +349,11 @@ func commandList() []command {
 		&pruneCommand{},
 		&versionCommand{},
 		&checkCommand{},
+		&sbomCommand{},
+		&noticesCommand{},
+		&bundleCommand{},
+		&archiveCommand{},
+		&daemonCommand{},
 	}
 }
 
@@ -358,6 +474,47 @@ func getEnv(env []string, key string) string {
 	return ""
 }
 
+// parseHostMap parses a comma-separated list of host=value pairs, such as the
+// Go module registry to retrieve each host's projects from. what names the
+// value in errors.
+func parseHostMap(env, what string) (map[string]string, error) {
+	if env == "" {
+		return nil, nil
+	}
+
+	m := make(map[string]string)
+	for _, pair := range strings.Split(env, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("expected host=%s, got %q", what, pair)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m, nil
+}
+
+// splitList splits a comma-separated list, dropping empty elements.
+func splitList(env string) []string {
+	var l []string
+	for _, e := range strings.Split(env, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+// isWritableDir reports whether files can be created in the directory dir.
+func isWritableDir(dir string) bool {
+	f, err := ioutil.TempFile(dir, ".dep-write-check")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
 // commentWriter writes a Go comment to the underlying io.Writer,
 // using line comment form (//).
 //
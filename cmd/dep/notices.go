@@ -0,0 +1,75 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/notices"
+	"github.com/pkg/errors"
+)
+
+const noticesShortHelp = `Collect the license and notice texts of dependencies into one file`
+const noticesLongHelp = `
+Write a THIRD_PARTY_NOTICES file in the root of the project, which gathers the
+texts of the license and notice files in the vendored copy of each project in
+Gopkg.lock, under a header naming the project and its locked version.
+
+Once the file exists, dep ensure regenerates it whenever it writes vendor/, so
+that it stays in step with what is vendored.
+`
+
+type noticesCommand struct{}
+
+func (cmd *noticesCommand) Name() string      { return "notices" }
+func (cmd *noticesCommand) Args() string      { return "" }
+func (cmd *noticesCommand) ShortHelp() string { return noticesShortHelp }
+func (cmd *noticesCommand) LongHelp() string  { return noticesLongHelp }
+func (cmd *noticesCommand) Hidden() bool      { return false }
+
+func (cmd *noticesCommand) Register(fs *flag.FlagSet) {}
+
+func (cmd *noticesCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.Errorf("too many args (%d)", len(args))
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.Errorf("%s does not exist, cannot collect the notices of the projects in it", dep.LockName)
+	}
+
+	return writeNotices(p, p.Lock)
+}
+
+// writeNotices writes the notices file for the projects in l, as vendored in
+// p, to the root of p.
+func writeNotices(p *dep.Project, l *dep.Lock) error {
+	var buf bytes.Buffer
+	if err := notices.Write(&buf, l, filepath.Join(p.AbsRoot, "vendor")); err != nil {
+		return err
+	}
+	return errors.Wrapf(ioutil.WriteFile(filepath.Join(p.AbsRoot, notices.FileName), buf.Bytes(), 0666), "error writing %s", notices.FileName)
+}
+
+// updateNotices regenerates the notices file for the projects in l, if p has
+// one.
+func updateNotices(p *dep.Project, l *dep.Lock) error {
+	if _, err := os.Stat(filepath.Join(p.AbsRoot, notices.FileName)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return writeNotices(p, l)
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	"github.com/golang/dep"
+)
+
+// pluginPrefix prefixes the names of the executables that provide commands dep
+// doesn't have itself: "dep release" runs dep-release, if it's on PATH.
+const pluginPrefix = "dep-"
+
+// pluginName matches the names of commands that may be provided by plugins, so
+// that a command name can't be used to run an arbitrary path.
+var pluginName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// findPlugin returns the path of the executable providing the command name, in
+// one of the directories in path, a list like PATH, or the empty string if no
+// such executable exists.
+func findPlugin(name, path string) string {
+	if !pluginName.MatchString(name) {
+		return ""
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		// LookPath only checks the named file, given a path, but still tries
+		// the executable extensions of the platform.
+		if exe, err := exec.LookPath(filepath.Join(dir, pluginPrefix+name)); err == nil {
+			return exe
+		}
+	}
+	return ""
+}
+
+// runPlugin runs the plugin executable exe with args, in the same working
+// directory and environment as dep, and returns its exit code. What dep knows
+// of the project it was run within is added to the environment:
+//
+//	DEP_VERSION       the version of dep running the plugin
+//	DEP_EXECUTABLE    the path of that dep, for the plugin to run it
+//	DEP_PROJECT_ROOT  the project's root directory
+//	DEP_IMPORT_ROOT   the project's root import path
+//	DEP_MANIFEST      the path of the project's Gopkg.toml
+//	DEP_LOCK          the path of the project's Gopkg.lock, whether or not it exists
+//	DEP_VENDOR        the path of the project's vendor directory
+//	DEP_GOPATH        the GOPATH the project is in
+//
+// All but DEP_VERSION and DEP_EXECUTABLE are only set when dep is run within a
+// project.
+func (c *Config) runPlugin(exe string, args []string) int {
+	env := append(c.Env[:len(c.Env):len(c.Env)], "DEP_VERSION="+version)
+	if self, err := os.Executable(); err == nil {
+		env = append(env, "DEP_EXECUTABLE="+self)
+	}
+
+	errLogger := log.New(c.Stderr, "", 0)
+	ctx := &dep.Ctx{
+		Out: log.New(ioutil.Discard, "", 0),
+		Err: errLogger,
+	}
+	ctx.SetPaths(c.WorkingDir, filepath.SplitList(getEnv(c.Env, "GOPATH"))...)
+	env = append(env, pluginProjectEnv(ctx)...)
+
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = c.WorkingDir
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	if err := cmd.Run(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() > 0 {
+			return ee.ExitCode()
+		}
+		errLogger.Printf("dep: failed to run %s: %v\n", exe, err)
+		return errorExitCode
+	}
+	return successExitCode
+}
+
+// pluginProjectEnv returns the environment variables describing the project
+// that ctx's working directory is within, or none if it is not within one.
+// Unlike ctx.LoadProject, it only locates the project, reading nothing within
+// it, so that plugins run however broken the project's files are, and it
+// does not roll back interrupted writes.
+func pluginProjectEnv(ctx *dep.Ctx) []string {
+	root, err := dep.FindProjectRoot(ctx.WorkingDir)
+	if err != nil || root == "" {
+		return nil
+	}
+	p := new(dep.Project)
+	if err = p.SetRoot(root); err != nil {
+		return nil
+	}
+	if ctx.GOPATH, err = ctx.DetectProjectGOPATH(p); err != nil {
+		return nil
+	}
+	ir := ctx.ExplicitRoot
+	if ir == "" {
+		if ir, err = ctx.ImportForAbs(p.AbsRoot); err != nil {
+			return nil
+		}
+	}
+
+	return []string{
+		"DEP_PROJECT_ROOT=" + p.AbsRoot,
+		"DEP_IMPORT_ROOT=" + ir,
+		"DEP_MANIFEST=" + filepath.Join(p.AbsRoot, dep.ManifestName),
+		"DEP_LOCK=" + filepath.Join(p.AbsRoot, dep.LockName),
+		"DEP_VENDOR=" + filepath.Join(p.AbsRoot, "vendor"),
+		"DEP_GOPATH=" + ctx.GOPATH,
+	}
+}
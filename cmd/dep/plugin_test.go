@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestFindPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins in this test are shell scripts")
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("empty")
+	h.TempDir("bin")
+	h.TempFile("bin/dep-release", "#!/bin/sh\n")
+	h.TempFile("bin/dep-noexec", "#!/bin/sh\n")
+	if err := os.Chmod(h.Path("bin/dep-release"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := strings.Join([]string{h.Path("empty"), "", h.Path("bin")}, string(filepath.ListSeparator))
+
+	if got, want := findPlugin("release", path), h.Path("bin/dep-release"); got != want {
+		t.Errorf("expected to find %s, got %q", want, got)
+	}
+	for _, name := range []string{"noexec", "missing", "../bin/dep-release", "-release", ""} {
+		if got := findPlugin(name, path); got != "" {
+			t.Errorf("expected no plugin for %q, got %s", name, got)
+		}
+	}
+}
+
+func TestRunPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins in this test are shell scripts")
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("bin")
+	h.TempDir("src/github.com/golang/notexist")
+	// The project is described even if its manifest can't be read.
+	h.TempFile("src/github.com/golang/notexist/Gopkg.toml", "[[constraint")
+	h.TempFile("bin/dep-release", `#!/bin/sh
+echo "args: $*"
+echo "version: $DEP_VERSION"
+echo "import root: $DEP_IMPORT_ROOT"
+echo "manifest: $DEP_MANIFEST"
+exit 3
+`)
+	if err := os.Chmod(h.Path("bin/dep-release"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := &Config{
+		Args:       []string{"dep", "release", "-n", "v1.0.0"},
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+		WorkingDir: h.Path("src/github.com/golang/notexist"),
+		Env:        []string{"PATH=" + h.Path("bin"), "GOPATH=" + h.Path(".")},
+	}
+	if exit := c.Run(); exit != 3 {
+		t.Errorf("expected the plugin's exit code, 3, got %d; stderr:\n%s", exit, stderr.String())
+	}
+	want := strings.Join([]string{
+		"args: -n v1.0.0",
+		"version: " + version,
+		"import root: github.com/golang/notexist",
+		"manifest: " + h.Path("src/github.com/golang/notexist/Gopkg.toml"),
+	}, "\n") + "\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("unexpected plugin output:\n\t(GOT): %q\n\t(WNT): %q", got, want)
+	}
+
+	// Help for the command is the plugin's own.
+	stdout.Reset()
+	c.Args = []string{"dep", "help", "release"}
+	c.Run()
+	if !strings.HasPrefix(stdout.String(), "args: -h\n") {
+		t.Errorf("expected the plugin to be asked for help, got %q", stdout.String())
+	}
+
+	// Outside of a project, there is no project to describe.
+	stdout.Reset()
+	c.Args = []string{"dep", "release"}
+	c.WorkingDir = h.Path("bin")
+	c.Run()
+	if !strings.Contains(stdout.String(), "import root: \n") {
+		t.Errorf("expected no project outside of one, got %q", stdout.String())
+	}
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"io/ioutil"
 	"log"
@@ -52,11 +53,10 @@ func (cmd *pruneCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 
-	sm, err := ctx.SourceManager()
+	sm, err := sourceManager(ctx)
 	if err != nil {
 		return err
 	}
-	sm.UseDefaultSignalHandling()
 	defer sm.Release()
 
 	// While the network churns on ListVersions() requests, statically analyze
@@ -69,6 +69,9 @@ func (cmd *pruneCommand) Run(ctx *dep.Ctx, args []string) error {
 	// Set up a solver in order to check the InputHash.
 	params := p.MakeParams()
 	params.RootPackageTree = ptree
+	if params.ProjectAnalyzer, err = projectAnalyzer(ctx, p, sm); err != nil {
+		return err
+	}
 
 	if ctx.Verbose {
 		params.TraceLogger = ctx.Err
@@ -96,7 +99,7 @@ func pruneProject(p *dep.Project, sm gps.SourceManager, logger *log.Logger) erro
 	onWrite := func(progress gps.WriteProgress) {
 		logger.Println(progress)
 	}
-	if err := gps.WriteDepTree(td, p.Lock, sm, gps.CascadingPruneOptions{DefaultOptions: gps.PruneNestedVendorDirs}, onWrite); err != nil {
+	if err := gps.WriteDepTree(context.TODO(), td, p.Lock, sm, gps.CascadingPruneOptions{DefaultOptions: gps.PruneNestedVendorDirs}, onWrite); err != nil {
 		return err
 	}
 
@@ -187,13 +190,34 @@ func calculatePrune(vendorDir string, keep []string, logger *log.Logger) ([]stri
 	return toDelete, err
 }
 
+// deleteDirs deletes the files directly within each of toDelete, and then the
+// directories themselves, if they're left empty. License and legal files (see
+// pkgtree.IsLicenseFile) are never deleted, so the directories holding them
+// are kept.
 func deleteDirs(toDelete []string) error {
 	// sort by length so we delete sub dirs first
 	sort.Sort(byLen(toDelete))
 	for _, path := range toDelete {
-		if err := os.RemoveAll(path); err != nil {
+		fis, err := ioutil.ReadDir(path)
+		if err != nil {
 			return err
 		}
+
+		empty := true
+		for _, fi := range fis {
+			if fi.IsDir() || pkgtree.IsLicenseFile(fi.Name()) {
+				empty = false
+				continue
+			}
+			if err := os.Remove(filepath.Join(path, fi.Name())); err != nil {
+				return err
+			}
+		}
+		if empty {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
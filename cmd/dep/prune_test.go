@@ -0,0 +1,40 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestDeleteDirsKeepsLicenses(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile("vendor/example.com/foo/unused/unused.go", "package unused")
+	h.TempFile("vendor/example.com/foo/unused/NOTICE", "notice")
+	h.TempFile("vendor/example.com/foo/unused/sub/sub.go", "package sub")
+	h.TempFile("vendor/example.com/foo/other/other.go", "package other")
+	h.TempFile("vendor/example.com/foo/other/deep/PATENTS", "patents")
+
+	foo := filepath.Join(h.Path("vendor"), "example.com", "foo")
+	err := deleteDirs([]string{
+		filepath.Join(foo, "unused"),
+		filepath.Join(foo, "unused", "sub"),
+		filepath.Join(foo, "other"),
+		filepath.Join(foo, "other", "deep"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.MustNotExist(filepath.Join(foo, "unused", "unused.go"))
+	h.MustNotExist(filepath.Join(foo, "unused", "sub"))
+	h.MustExist(filepath.Join(foo, "unused", "NOTICE"))
+	h.MustNotExist(filepath.Join(foo, "other", "other.go"))
+	h.MustExist(filepath.Join(foo, "other", "deep", "PATENTS"))
+}
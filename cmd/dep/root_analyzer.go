@@ -13,6 +13,7 @@ import (
 	"github.com/golang/dep/gps"
 	fb "github.com/golang/dep/internal/feedback"
 	"github.com/golang/dep/internal/importers"
+	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -61,11 +62,11 @@ func (a *rootAnalyzer) InitializeRootManifestAndLock(dir string, pr gps.ProjectR
 
 func (a *rootAnalyzer) cacheDeps(pr gps.ProjectRoot) error {
 	logger := a.ctx.Err
-	g, _ := errgroup.WithContext(context.TODO())
+	g, gctx := errgroup.WithContext(context.TODO())
 	concurrency := 4
 
 	syncDep := func(pr gps.ProjectRoot, sm gps.SourceManager) error {
-		if err := sm.SyncSourceFor(gps.ProjectIdentifier{ProjectRoot: pr}); err != nil {
+		if err := sm.SyncSourceFor(gctx, gps.ProjectIdentifier{ProjectRoot: pr}); err != nil {
 			logger.Printf("Unable to cache %s - %s", pr, err)
 			return err
 		}
@@ -164,6 +165,38 @@ func (a *rootAnalyzer) DeriveManifestAndLock(dir string, pr gps.ProjectRoot) (gp
 	return gps.SimpleManifest{}, nil, nil
 }
 
+// DeriveManifestAndLockContext is DeriveManifestAndLock, but gives up if ctx
+// is done before the configuration of other tools has been imported.
+func (a *rootAnalyzer) DeriveManifestAndLockContext(ctx context.Context, dir string, pr gps.ProjectRoot) (gps.Manifest, gps.Lock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	m, l, err := a.DeriveManifestAndLock(dir, pr)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, nil, ctxErr
+	}
+	return m, l, err
+}
+
+// projectAnalyzer returns the analyzer to solve p with: dep's own, or, if the
+// manifest names the other dependency managers whose configuration should be
+// read too, a registry of them all.
+func projectAnalyzer(ctx *dep.Ctx, p *dep.Project, sm gps.SourceManager) (gps.ProjectAnalyzer, error) {
+	if p.Manifest == nil || len(p.Manifest.Analyzers) == 0 {
+		return dep.Analyzer{}, nil
+	}
+	if ctx.SandboxAnalyzers {
+		return nil, errors.New("only dep's own analyzer can be sandboxed; remove analyzers from Gopkg.toml to sandbox it")
+	}
+
+	logger := log.New(ioutil.Discard, "", 0)
+	if ctx.Verbose {
+		logger = ctx.Err
+	}
+	r, err := importers.NewRegistry(p.Manifest.Analyzers, logger, ctx.Verbose, sm)
+	return r, errors.Wrap(err, "invalid analyzers in Gopkg.toml")
+}
+
 func (a *rootAnalyzer) FinalizeRootManifestAndLock(m *dep.Manifest, l *dep.Lock, ol dep.Lock) {
 	// Iterate through the new projects in solved lock and add them to manifest
 	// if they are direct deps and log feedback for all the new projects.
@@ -0,0 +1,115 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/internal/sbom"
+	"github.com/pkg/errors"
+)
+
+const sbomShortHelp = `Generate a software bill of materials from Gopkg.lock`
+const sbomLongHelp = `
+Generate a software bill of materials (SBOM), an inventory of the project's
+dependencies, from Gopkg.lock.
+
+For each locked project, the SBOM records its project root, version, revision,
+and the URL of its source, along with the licenses detected in its vendored
+copy, if any. Licenses are identified by their SPDX identifiers.
+
+The SBOM is written as JSON, in SPDX 2.3 format by default, or in CycloneDX 1.4
+format with -format cyclonedx.
+`
+
+type sbomCommand struct {
+	format      string
+	outFilePath string
+}
+
+func (cmd *sbomCommand) Name() string      { return "sbom" }
+func (cmd *sbomCommand) Args() string      { return "[-format spdx|cyclonedx] [-out path]" }
+func (cmd *sbomCommand) ShortHelp() string { return sbomShortHelp }
+func (cmd *sbomCommand) LongHelp() string  { return sbomLongHelp }
+func (cmd *sbomCommand) Hidden() bool      { return false }
+
+func (cmd *sbomCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.format, "format", "spdx", "format of the SBOM: spdx or cyclonedx")
+	fs.StringVar(&cmd.outFilePath, "out", "", "path to a file to which to write the SBOM. Blank value will be ignored")
+}
+
+func (cmd *sbomCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.Errorf("too many args (%d)", len(args))
+	}
+
+	var write func(io.Writer, sbom.Document) error
+	switch cmd.format {
+	case "spdx":
+		write = sbom.WriteSPDX
+	case "cyclonedx":
+		write = sbom.WriteCycloneDX
+	default:
+		return errors.Errorf("unknown SBOM format %q, must be spdx or cyclonedx", cmd.format)
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.New("Gopkg.lock does not exist, cannot generate an SBOM from it")
+	}
+
+	sm, err := sourceManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer sm.Release()
+
+	// Resolve each project's source as the solver would: from its source, if
+	// it has an alternate one, or else its root, trying URLs in order.
+	sourceURL := func(id gps.ProjectIdentifier) (string, error) {
+		path := id.Source
+		if path == "" {
+			path = string(id.ProjectRoot)
+		}
+		urls, err := sm.SourceURLsForPath(context.TODO(), path)
+		if err != nil {
+			return "", err
+		}
+		if len(urls) == 0 {
+			return "", errors.Errorf("no source URLs for %s", id)
+		}
+		return urls[0].String(), nil
+	}
+
+	components, err := sbom.Components(p.Lock, sourceURL, filepath.Join(p.AbsRoot, "vendor"))
+	if err != nil {
+		return err
+	}
+	doc, err := sbom.New(string(p.ImportRoot), "dep", version, components)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = write(&buf, doc); err != nil {
+		return errors.Wrap(err, "failed to write SBOM")
+	}
+
+	if cmd.outFilePath == "" {
+		ctx.Out.Print(buf.String())
+		return nil
+	}
+	return errors.Wrap(ioutil.WriteFile(cmd.outFilePath, buf.Bytes(), 0666), "error writing output file")
+}
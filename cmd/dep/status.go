@@ -445,11 +445,10 @@ func (cmd *statusCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 
-	sm, err := ctx.SourceManager()
+	sm, err := sourceManager(ctx)
 	if err != nil {
 		return err
 	}
-	sm.UseDefaultSignalHandling()
 	defer sm.Release()
 
 	if err := dep.ValidateProjectRoots(ctx, p.Manifest, sm); err != nil {
@@ -644,8 +643,12 @@ func (cmd *statusCommand) runOld(ctx *dep.Ctx, out oldOutputter, p *dep.Project,
 	ptree := p.RootPackageTree
 
 	// Set up a solver in order to check the InputHash.
+	an, err := projectAnalyzer(ctx, p, sm)
+	if err != nil {
+		return err
+	}
 	params := gps.SolveParameters{
-		ProjectAnalyzer: dep.Analyzer{},
+		ProjectAnalyzer: an,
 		RootDir:         p.AbsRoot,
 		RootPackageTree: ptree,
 		Manifest:        p.Manifest,
@@ -891,8 +894,12 @@ func (cmd *statusCommand) runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Proje
 	ptree := p.RootPackageTree
 
 	// Set up a solver in order to check the InputHash.
+	an, err := projectAnalyzer(ctx, p, sm)
+	if err != nil {
+		return false, 0, err
+	}
 	params := gps.SolveParameters{
-		ProjectAnalyzer: dep.Analyzer{},
+		ProjectAnalyzer: an,
 		RootDir:         p.AbsRoot,
 		RootPackageTree: ptree,
 		Manifest:        p.Manifest,
@@ -961,7 +968,7 @@ func (cmd *statusCommand) runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Proje
 				// in order to avoid slower status process.
 				switch out.(type) {
 				case *dotOutput:
-					ptr, err := sm.ListPackages(proj.Ident(), proj.Version())
+					ptr, err := sm.ListPackages(context.TODO(), proj.Ident(), proj.Version())
 
 					if err != nil {
 						bs.hasError = true
@@ -1016,22 +1023,14 @@ func (cmd *statusCommand) runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Proje
 					// transitive project deps will always show "any" here.
 					bs.Constraint = c.Constraint
 
-					vl, err := sm.ListVersions(proj.Ident())
+					vl, err := sm.ListVersions(context.TODO(), proj.Ident())
 					if err == nil {
-						gps.SortPairedForUpgrade(vl)
-
-						for _, v := range vl {
-							// Because we've sorted the version list for
-							// upgrade, the first version we encounter that
-							// matches our constraint will be what we want.
-							if c.Constraint.Matches(v) {
-								// Latest should be of the same type as the Version.
-								if bs.Version.Type() == gps.IsSemver {
-									bs.Latest = v
-								} else {
-									bs.Latest = v.Revision()
-								}
-								break
+						if v := gps.NewVersionUnifier(vl).Latest(c.Constraint); v != nil {
+							// Latest should be of the same type as the Version.
+							if bs.Version.Type() == gps.IsSemver {
+								bs.Latest = v
+							} else {
+								bs.Latest = v.Revision()
 							}
 						}
 					} else {
@@ -1137,7 +1136,7 @@ func (cmd *statusCommand) runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Proje
 	}
 	var errs []fail
 	for _, e := range external {
-		root, err := sm.DeduceProjectRoot(e)
+		root, err := sm.DeduceProjectRoot(context.TODO(), e)
 		if err != nil {
 			errs = append(errs, fail{
 				ex:  e,
@@ -1327,7 +1326,7 @@ func collectConstraints(ctx *dep.Ctx, p *dep.Project, sm gps.SourceManager) (con
 		go func(proj gps.LockedProject) {
 			defer wg.Done()
 
-			manifest, _, err := sm.GetManifestAndLock(proj.Ident(), proj.Version(), rootAnalyzer)
+			manifest, _, err := sm.GetManifestAndLock(context.TODO(), proj.Ident(), proj.Version(), rootAnalyzer)
 			if err != nil {
 				errCh <- errors.Wrap(err, "error getting manifest and lock")
 				return
@@ -0,0 +1,44 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/internal/telemetry"
+)
+
+// solveAndReport runs solver on behalf of the command named cmdName and, if
+// the user has configured a telemetry endpoint, reports anonymized statistics
+// about the solve to it. Failing to report them never fails the command.
+func solveAndReport(ctx *dep.Ctx, cmdName string, solver gps.Solver, sm gps.SourceManager) (gps.Solution, error) {
+	start := time.Now()
+	soln, err := solver.Solve(context.TODO())
+	if ctx.Telemetry == "" {
+		return soln, err
+	}
+
+	var stats gps.SourceManagerStats
+	if s, ok := sm.(interface{ Stats() gps.SourceManagerStats }); ok {
+		stats = s.Stats()
+	}
+	// The solver, rather than the solution, has the count of backtracks, as
+	// there is no solution if solving failed.
+	var backtracks int
+	if a, ok := solver.(interface{ Attempts() int }); ok {
+		backtracks = a.Attempts()
+	} else if soln != nil {
+		backtracks = soln.Attempts()
+	}
+	r := telemetry.NewReport(soln, err, backtracks, time.Since(start), stats)
+	r.Command, r.DepVersion = cmdName, version
+	if rerr := telemetry.Send(context.TODO(), ctx.Telemetry, r); rerr != nil && ctx.Verbose {
+		ctx.Err.Printf("Unable to report solve statistics: %v\n", rerr)
+	}
+	return soln, err
+}
@@ -0,0 +1,524 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// ConfigName is the name of the user's dep configuration file, which is looked
+// for in the dep directory of their user configuration directory, such as
+// ~/.config/dep/config.toml.
+const ConfigName = "config.toml"
+
+// RepoConfigName is the name of a project's own config file, which is checked
+// in alongside the manifest.
+const RepoConfigName = ".depconfig.toml"
+
+// Config holds a user's configuration of dep, shared by all of their projects:
+// where to cache sources, where to retrieve them from and how, and with what
+// credentials. A project's own config overrides it, and the environment
+// variables that configure the same things take precedence over both.
+type Config struct {
+	Cachedirs        []string            // As in DEPCACHEDIR.
+	SharedCachedirs  []string            // As in DEPSHAREDCACHEDIR.
+	CacheAge         time.Duration       // As in DEPCACHEAGE.
+	Keyring          string              // As in DEPKEYRING.
+	Athens           string              // As in DEPATHENS.
+	AthensExclude    []string            // As in DEPATHENSEXCLUDE.
+	ProxyOnly        bool                // As in DEPPROXYONLY.
+	Registries       map[string]string   // As in DEPREGISTRIES, with any credentials in the URLs.
+	GitHubTokens     map[string]string   // As in DEPGITHUBTOKENS.
+	Mirrors          map[string][]string // Mirror URLs to fail over to, keyed by source URL.
+	CallTimeouts     gps.CallTimeouts    // Timeouts for each kind of work done on sources.
+	MaxNetworkCalls  int                 // Maximum number of network operations in flight at once. <=0: Unlimited.
+	Telemetry        string              // As in DEPTELEMETRY.
+	FileDigests      bool                // Write a per-file digest listing into each vendored project.
+	NormalizeExports bool                // Give vendored files fixed permissions and modification times.
+	HardlinkExports  bool                // Hard link vendored files out of the cache, where possible, rather than copy them.
+	SparseExports    bool                // Write out only the used packages of git sources, rather than pruning the rest.
+}
+
+type rawConfig struct {
+	Cachedirs        []string          `toml:"cache-dirs"`
+	SharedCachedirs  []string          `toml:"shared-cache-dirs"`
+	CacheAge         string            `toml:"cache-age"`
+	Keyring          string            `toml:"keyring"`
+	Athens           string            `toml:"athens"`
+	AthensExclude    []string          `toml:"athens-exclude"`
+	ProxyOnly        bool              `toml:"proxy-only"`
+	MaxNetworkCalls  int               `toml:"max-network-calls"`
+	Telemetry        string            `toml:"telemetry"`
+	FileDigests      bool              `toml:"file-digests"`
+	NormalizeExports bool              `toml:"normalize-exports"`
+	HardlinkExports  bool              `toml:"hardlink-exports"`
+	SparseExports    bool              `toml:"sparse-exports"`
+	Registries       []rawRegistry     `toml:"registry"`
+	GitHubTokens     []rawGitHubToken  `toml:"github-token"`
+	Mirrors          []rawMirror       `toml:"mirror"`
+	Timeouts         rawConfigTimeouts `toml:"timeouts"`
+}
+
+type rawRegistry struct {
+	Host        string `toml:"host"`
+	URL         string `toml:"url"`
+	Credentials string `toml:"credentials"`
+}
+
+type rawGitHubToken struct {
+	Host  string `toml:"host"`
+	Token string `toml:"token"`
+}
+
+type rawMirror struct {
+	Source string   `toml:"source"`
+	URLs   []string `toml:"urls"`
+}
+
+type rawConfigTimeouts struct {
+	HTTPMetadata       string `toml:"http-metadata"`
+	SourcePing         string `toml:"source-ping"`
+	SourceInit         string `toml:"source-init"`
+	SourceFetch        string `toml:"source-fetch"`
+	ListVersions       string `toml:"list-versions"`
+	GetManifestAndLock string `toml:"get-manifest-and-lock"`
+	ListPackages       string `toml:"list-packages"`
+	ExportTree         string `toml:"export-tree"`
+}
+
+// configKeys are the keys that may be set in a config file, and in each of its
+// tables.
+var configKeys = map[string][]string{
+	"": {"cache-dirs", "shared-cache-dirs", "cache-age", "keyring", "athens", "athens-exclude",
+		"proxy-only", "max-network-calls", "telemetry", "file-digests", "normalize-exports", "hardlink-exports",
+		"sparse-exports", "registry", "github-token", "mirror", "timeouts"},
+	"registry":     {"host", "url", "credentials"},
+	"github-token": {"host", "token"},
+	"mirror":       {"source", "urls"},
+	"timeouts": {"http-metadata", "source-ping", "source-init", "source-fetch", "list-versions",
+		"get-manifest-and-lock", "list-packages", "export-tree"},
+}
+
+// DefaultConfigPath returns the path of the user's config file, within their
+// user configuration directory, or the empty string if they have none.
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dep", ConfigName)
+}
+
+// LoadConfig reads the config file at path. If path is empty, the one at
+// DefaultConfigPath is read, if it exists; if it does not, the config is
+// empty.
+func LoadConfig(path string) (*Config, error) {
+	mustExist := path != ""
+	if !mustExist {
+		if path = DefaultConfigPath(); path == "" {
+			return &Config{}, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) && !mustExist {
+			return &Config{}, nil
+		}
+		return nil, errors.Wrap(err, "failed to open config file")
+	}
+	defer f.Close()
+
+	c, err := readConfig(f, filepath.Dir(path), true)
+	return c, errors.Wrapf(err, "failed to read config file %s", path)
+}
+
+// LoadRepoConfig reads the config file of the project containing the directory
+// wd, if it has one, or else returns nil. Settings that depend on the machine
+// dep runs on, rather than the project, such as where to cache sources, cannot
+// be made in it, and nor can telemetry be turned on, which is for the user to
+// decide. Nor can it refer to credentials, such as those of registries, or
+// GitHub tokens, as a project that is not trusted could have them sent to
+// hosts of its choosing.
+func LoadRepoConfig(wd string) (*Config, error) {
+	root, err := findProjectRoot(wd)
+	if err != nil {
+		return nil, nil
+	}
+
+	path := filepath.Join(root, RepoConfigName)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to open project config file")
+	}
+	defer f.Close()
+
+	c, err := readConfig(f, root, false)
+	if err == nil {
+		for _, s := range []struct {
+			name string
+			set  bool
+		}{
+			{"cache-dirs", len(c.Cachedirs) > 0},
+			{"shared-cache-dirs", len(c.SharedCachedirs) > 0},
+			{"keyring", c.Keyring != ""},
+			{"telemetry", c.Telemetry != ""},
+			{"hardlink-exports", c.HardlinkExports},
+		} {
+			if s.set {
+				err = errors.Errorf("%s can only be set in the user's config, not a project's", s.name)
+				break
+			}
+		}
+	}
+	return c, errors.Wrapf(err, "failed to read project config file %s", path)
+}
+
+// Override returns a copy of c with the settings made in o, such as a
+// project's config, taking precedence. Mirrors, registries and GitHub tokens
+// are overridden for each source or host that o has them for. o can turn on
+// proxy-only, but not off, so that a project cannot loosen a user's
+// restrictions on where dependencies come from. The same goes for
+// file-digests, normalize-exports and sparse-exports.
+func (c *Config) Override(o *Config) *Config {
+	merged := *c
+	if o == nil {
+		return &merged
+	}
+
+	if len(o.Cachedirs) > 0 {
+		merged.Cachedirs = o.Cachedirs
+	}
+	if len(o.SharedCachedirs) > 0 {
+		merged.SharedCachedirs = o.SharedCachedirs
+	}
+	if o.CacheAge != 0 {
+		merged.CacheAge = o.CacheAge
+	}
+	if o.Keyring != "" {
+		merged.Keyring = o.Keyring
+	}
+	if o.Athens != "" {
+		merged.Athens = o.Athens
+	}
+	if len(o.AthensExclude) > 0 {
+		merged.AthensExclude = o.AthensExclude
+	}
+	merged.ProxyOnly = c.ProxyOnly || o.ProxyOnly
+	if o.MaxNetworkCalls != 0 {
+		merged.MaxNetworkCalls = o.MaxNetworkCalls
+	}
+	if o.Telemetry != "" {
+		merged.Telemetry = o.Telemetry
+	}
+	merged.FileDigests = c.FileDigests || o.FileDigests
+	merged.NormalizeExports = c.NormalizeExports || o.NormalizeExports
+	merged.SparseExports = c.SparseExports || o.SparseExports
+
+	overrideMap := func(m, o map[string]string) map[string]string {
+		if len(o) == 0 {
+			return m
+		}
+		merged := make(map[string]string, len(m)+len(o))
+		for k, v := range m {
+			merged[k] = v
+		}
+		for k, v := range o {
+			merged[k] = v
+		}
+		return merged
+	}
+	merged.Registries = overrideMap(c.Registries, o.Registries)
+	merged.GitHubTokens = overrideMap(c.GitHubTokens, o.GitHubTokens)
+	if len(o.Mirrors) > 0 {
+		merged.Mirrors = make(map[string][]string, len(c.Mirrors)+len(o.Mirrors))
+		for src, urls := range c.Mirrors {
+			merged.Mirrors[src] = urls
+		}
+		for src, urls := range o.Mirrors {
+			merged.Mirrors[src] = urls
+		}
+	}
+
+	for _, t := range []struct {
+		d *time.Duration
+		o time.Duration
+	}{
+		{&merged.CallTimeouts.HTTPMetadata, o.CallTimeouts.HTTPMetadata},
+		{&merged.CallTimeouts.SourcePing, o.CallTimeouts.SourcePing},
+		{&merged.CallTimeouts.SourceInit, o.CallTimeouts.SourceInit},
+		{&merged.CallTimeouts.SourceFetch, o.CallTimeouts.SourceFetch},
+		{&merged.CallTimeouts.ListVersions, o.CallTimeouts.ListVersions},
+		{&merged.CallTimeouts.GetManifestAndLock, o.CallTimeouts.GetManifestAndLock},
+		{&merged.CallTimeouts.ListPackages, o.CallTimeouts.ListPackages},
+		{&merged.CallTimeouts.ExportTree, o.CallTimeouts.ExportTree},
+	} {
+		if t.o != 0 {
+			*t.d = t.o
+		}
+	}
+
+	return &merged
+}
+
+// readConfig reads a config from r. Credentials read from files are looked for
+// relative to dir. Unless secrets is true, any reference to credentials in the
+// config is an error, and none are read.
+func readConfig(r io.Reader, dir string, secrets bool) (*Config, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := toml.LoadBytes(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse the config as TOML")
+	}
+	if err = checkConfigKeys(tree); err != nil {
+		return nil, err
+	}
+	var raw rawConfig
+	if err = tree.Unmarshal(&raw); err != nil {
+		return nil, errors.Wrap(err, "unable to parse the config as TOML")
+	}
+
+	c := &Config{
+		Cachedirs:        raw.Cachedirs,
+		SharedCachedirs:  raw.SharedCachedirs,
+		Keyring:          raw.Keyring,
+		Athens:           raw.Athens,
+		AthensExclude:    raw.AthensExclude,
+		ProxyOnly:        raw.ProxyOnly,
+		MaxNetworkCalls:  raw.MaxNetworkCalls,
+		Telemetry:        raw.Telemetry,
+		FileDigests:      raw.FileDigests,
+		NormalizeExports: raw.NormalizeExports,
+		HardlinkExports:  raw.HardlinkExports,
+		SparseExports:    raw.SparseExports,
+	}
+	if raw.CacheAge != "" {
+		if c.CacheAge, err = time.ParseDuration(raw.CacheAge); err != nil {
+			return nil, errors.Wrap(err, "invalid cache-age")
+		}
+	}
+
+	for _, reg := range raw.Registries {
+		if reg.Host == "" || reg.URL == "" {
+			return nil, errors.New("each registry must have a host and a url")
+		}
+		if c.Registries == nil {
+			c.Registries = make(map[string]string)
+		}
+		if _, has := c.Registries[reg.Host]; has {
+			return nil, errors.Errorf("multiple registries for %s", reg.Host)
+		}
+		u := reg.URL
+		if reg.Credentials != "" {
+			if !secrets {
+				return nil, errors.New("registry credentials can only be set in the user's config, not a project's")
+			}
+			creds, err := resolveCredential(reg.Credentials, dir)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid credentials for the registry for %s", reg.Host)
+			}
+			if u, err = withUserinfo(u, creds); err != nil {
+				return nil, errors.Wrapf(err, "invalid url for the registry for %s", reg.Host)
+			}
+		}
+		c.Registries[reg.Host] = u
+	}
+
+	if len(raw.GitHubTokens) > 0 && !secrets {
+		return nil, errors.New("github-token can only be set in the user's config, not a project's")
+	}
+	for _, tok := range raw.GitHubTokens {
+		if tok.Host == "" || tok.Token == "" {
+			return nil, errors.New("each github-token must have a host and a token")
+		}
+		token, err := resolveCredential(tok.Token, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid github-token for %s", tok.Host)
+		}
+		if c.GitHubTokens == nil {
+			c.GitHubTokens = make(map[string]string)
+		}
+		c.GitHubTokens[tok.Host] = token
+	}
+
+	for _, m := range raw.Mirrors {
+		if m.Source == "" || len(m.URLs) == 0 {
+			return nil, errors.New("each mirror must have a source and urls")
+		}
+		if c.Mirrors == nil {
+			c.Mirrors = make(map[string][]string)
+		}
+		c.Mirrors[m.Source] = append(c.Mirrors[m.Source], m.URLs...)
+	}
+
+	for _, t := range []struct {
+		name string
+		raw  string
+		d    *time.Duration
+	}{
+		{"http-metadata", raw.Timeouts.HTTPMetadata, &c.CallTimeouts.HTTPMetadata},
+		{"source-ping", raw.Timeouts.SourcePing, &c.CallTimeouts.SourcePing},
+		{"source-init", raw.Timeouts.SourceInit, &c.CallTimeouts.SourceInit},
+		{"source-fetch", raw.Timeouts.SourceFetch, &c.CallTimeouts.SourceFetch},
+		{"list-versions", raw.Timeouts.ListVersions, &c.CallTimeouts.ListVersions},
+		{"get-manifest-and-lock", raw.Timeouts.GetManifestAndLock, &c.CallTimeouts.GetManifestAndLock},
+		{"list-packages", raw.Timeouts.ListPackages, &c.CallTimeouts.ListPackages},
+		{"export-tree", raw.Timeouts.ExportTree, &c.CallTimeouts.ExportTree},
+	} {
+		if t.raw == "" {
+			continue
+		}
+		if *t.d, err = time.ParseDuration(t.raw); err != nil {
+			return nil, errors.Wrapf(err, "invalid timeouts.%s", t.name)
+		}
+	}
+
+	return c, nil
+}
+
+// checkConfigKeys returns an error for the first key in tree, or any of its
+// tables, that isn't in configKeys, so that misspelled settings aren't
+// silently ignored.
+func checkConfigKeys(tree *toml.Tree) error {
+	check := func(table string, t *toml.Tree) error {
+		for _, key := range t.Keys() {
+			known := false
+			for _, k := range configKeys[table] {
+				if k == key {
+					known = true
+					break
+				}
+			}
+			if !known {
+				if table != "" {
+					key = table + "." + key
+				}
+				return errors.Errorf("unknown setting %q", key)
+			}
+		}
+		return nil
+	}
+
+	if err := check("", tree); err != nil {
+		return err
+	}
+	for table := range configKeys {
+		if table == "" {
+			continue
+		}
+		switch v := tree.Get(table).(type) {
+		case *toml.Tree:
+			if err := check(table, v); err != nil {
+				return err
+			}
+		case []*toml.Tree:
+			for _, t := range v {
+				if err := check(table, t); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveCredential returns the credential that ref refers to, so that
+// credentials need not be written in the config file itself: "env:NAME" is the
+// value of the environment variable NAME, and "file:PATH" is the contents of
+// the file at PATH, relative to dir, without surrounding whitespace.
+func resolveCredential(ref, dir string) (string, error) {
+	var cred string
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		cred = os.Getenv(name)
+		if cred == "" {
+			return "", errors.Errorf("environment variable %s is not set", name)
+		}
+	case strings.HasPrefix(ref, "file:"):
+		path := strings.TrimPrefix(ref, "file:")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		if cred = strings.TrimSpace(string(b)); cred == "" {
+			return "", errors.Errorf("%s is empty", path)
+		}
+	default:
+		return "", errors.New(`credentials must be referred to as "env:NAME" or "file:PATH", not given directly`)
+	}
+	return cred, nil
+}
+
+// withUserinfo returns rawurl with its userinfo set to creds, which is either
+// a user and password separated by a colon, or a lone token.
+func withUserinfo(rawurl, creds string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if i := strings.IndexByte(creds, ':'); i >= 0 {
+		u.User = url.UserPassword(creds[:i], creds[i+1:])
+	} else {
+		u.User = url.User(creds)
+	}
+	return u.String(), nil
+}
+
+// Env returns those settings in c that environment variables can also set, as
+// KEY=value pairs in the environment's format, so that they can be put before
+// the environment for it to override them.
+func (c *Config) Env() []string {
+	var env []string
+	add := func(key, value string) {
+		if value != "" {
+			env = append(env, key+"="+value)
+		}
+	}
+	hostMap := func(m map[string]string) string {
+		pairs := make([]string, 0, len(m))
+		for host, v := range m {
+			pairs = append(pairs, host+"="+v)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+
+	add("DEPCACHEDIR", strings.Join(c.Cachedirs, string(filepath.ListSeparator)))
+	add("DEPSHAREDCACHEDIR", strings.Join(c.SharedCachedirs, string(filepath.ListSeparator)))
+	if c.CacheAge != 0 {
+		add("DEPCACHEAGE", c.CacheAge.String())
+	}
+	add("DEPKEYRING", c.Keyring)
+	add("DEPATHENS", c.Athens)
+	add("DEPATHENSEXCLUDE", strings.Join(c.AthensExclude, ","))
+	if c.ProxyOnly {
+		add("DEPPROXYONLY", "1")
+	}
+	add("DEPREGISTRIES", hostMap(c.Registries))
+	add("DEPGITHUBTOKENS", hostMap(c.GitHubTokens))
+	add("DEPTELEMETRY", c.Telemetry)
+	return env
+}
@@ -5,16 +5,19 @@
 package dep
 
 import (
+	"context"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang/dep/gps"
 	"github.com/golang/dep/gps/paths"
 	"github.com/golang/dep/gps/pkgtree"
+	"github.com/golang/dep/gps/sandbox"
 	"github.com/golang/dep/gps/verify"
 	"github.com/golang/dep/internal/fs"
 	"github.com/pkg/errors"
@@ -39,15 +42,52 @@ import (
 //	}
 //
 type Ctx struct {
-	WorkingDir     string        // Where to execute.
-	GOPATH         string        // Selected Go path, containing WorkingDir.
-	GOPATHs        []string      // Other Go paths.
-	ExplicitRoot   string        // An explicitly-set path to use as the project root.
-	Out, Err       *log.Logger   // Required loggers.
-	Verbose        bool          // Enables more verbose logging.
-	DisableLocking bool          // When set, no lock file will be created to protect against simultaneous dep processes.
-	Cachedir       string        // Cache directory loaded from environment.
-	CacheAge       time.Duration // Maximum valid age of cached source data. <=0: Don't cache.
+	WorkingDir       string            // Where to execute.
+	GOPATH           string            // Selected Go path, containing WorkingDir.
+	GOPATHs          []string          // Other Go paths.
+	ExplicitRoot     string            // An explicitly-set path to use as the project root.
+	Out, Err         *log.Logger       // Required loggers.
+	Verbose          bool              // Enables more verbose logging.
+	DisableLocking   bool              // When set, no lock file will be created to protect against simultaneous dep processes.
+	Cachedir         string            // Cache directory loaded from environment.
+	SharedCachedirs  []string          // Read-only cache directories, shared by a team, checked in order for sources and cached data missing from Cachedir.
+	CacheAge         time.Duration     // Maximum valid age of cached source data. <=0: Don't cache.
+	Keyring          string            // GnuPG home directory of the keys trusted to sign dependencies' versions. Empty: Don't verify signatures.
+	Registries       map[string]string // Base URLs of the Go module registries to retrieve projects from instead of upstream, keyed by import path host.
+	Athens           string            // Base URL of an Athens proxy to retrieve projects through instead of upstream. Empty: Don't use a proxy.
+	AthensExclude    []string          // Import path prefixes of projects to retrieve from upstream even with Athens set.
+	SumDB            string            // Verifier key of a checksum database to verify dependencies against, optionally followed by a space and its URL. Empty: Don't verify.
+	SumDBFailClosed  bool              // When set, dependencies that cannot be verified against SumDB are rejected.
+	AllowedHosts     []string          // Hosts that dependencies may be retrieved from. Empty: Any.
+	DeniedPrefixes   []string          // Import path prefixes that may not be depended upon.
+	AllowedLicenses  []string          // SPDX identifiers of the licenses that dependencies may carry. Empty: Any.
+	AllowlistFile    string            // File listing the only revisions of dependencies that may be used; any other is quarantined. Empty: Any.
+	NetworkAudit     string            // File to append a JSON record of each network operation to. Empty: Don't record them.
+	SandboxAnalyzers bool              // Analyze dependencies in a sandboxed process.
+	GitHubTokens     map[string]string // API tokens for GitHub hosts, keyed by host, to list git sources' versions through the API with.
+	ProxyOnly        bool              // When set, dependencies may only be retrieved from Registries or Athens, never upstream.
+	Provenance       bool              // When set, where each dependency came from is recorded in the lock.
+	StrictRevisions  bool              // When set, every dependency in Gopkg.lock must be pinned to a revision.
+	CallTimeouts     gps.CallTimeouts  // Timeouts for each kind of work done on sources. Zero fields use the defaults.
+	MaxNetworkCalls  int               // Maximum number of network operations in flight at once. <=0: Unlimited.
+	Telemetry        string            // URL to report anonymized statistics about each solve to. Empty: Don't report them.
+	FileDigests      bool              // When set, a per-file digest listing is written into each vendored project.
+	NormalizeExports bool              // When set, vendored files are given fixed permissions and modification times.
+	HardlinkExports  bool              // When set, vendored files may be hard linked out of the cache rather than copied.
+	SparseExports    bool              // When set, only the used packages of git sources are written out, rather than pruned down to.
+
+	// Mirrors are the mirror URLs to fail over to, in order, if a source's
+	// upstream cannot be reached, keyed by source URL.
+	Mirrors map[string][]string
+
+	// PinnedMirrors are the only mirrors or proxies that dependencies may be
+	// retrieved through, keyed by project root.
+	PinnedMirrors map[gps.ProjectRoot]string
+
+	// Signatures are the dependencies whose versions must be signed, keyed by
+	// project root. Unless Keyring is set, they are verified with the keys in
+	// GnuPG's default home directory.
+	Signatures map[gps.ProjectRoot]gps.SignatureRequirement
 }
 
 // SetPaths sets the WorkingDir and GOPATHs fields. If GOPATHs is empty, then
@@ -94,6 +134,17 @@ func defaultGOPATH() string {
 	return ""
 }
 
+// defaultGnuPGHome gets the home directory that GnuPG uses by default.
+func defaultGnuPGHome() string {
+	if home := os.Getenv("GNUPGHOME"); home != "" {
+		return home
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "gnupg")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".gnupg")
+}
+
 // SourceManager produces an instance of gps's built-in SourceManager
 // initialized to log to the receiver's logger.
 func (c *Ctx) SourceManager() (*gps.SourceMgr, error) {
@@ -107,12 +158,75 @@ func (c *Ctx) SourceManager() (*gps.SourceMgr, error) {
 		}
 	}
 
-	return gps.NewSourceManager(gps.SourceManagerConfig{
-		CacheAge:       c.CacheAge,
-		Cachedir:       cachedir,
-		Logger:         c.Out,
-		DisableLocking: c.DisableLocking,
-	})
+	smc := gps.SourceManagerConfig{
+		CacheAge:         c.CacheAge,
+		Cachedir:         cachedir,
+		SharedCachedirs:  c.SharedCachedirs,
+		Logger:           c.Out,
+		DisableLocking:   c.DisableLocking,
+		SignatureKeyring: c.Keyring,
+		Registries:       c.Registries,
+		GitHubTokens:     c.GitHubTokens,
+		ProxyOnly:        c.ProxyOnly,
+		RecordProvenance: c.Provenance,
+		PinnedMirrors:    c.PinnedMirrors,
+		Mirrors:          c.Mirrors,
+		CallTimeouts:     c.CallTimeouts,
+		MaxNetworkCalls:  c.MaxNetworkCalls,
+		FileDigests:      c.FileDigests,
+		NormalizeExports: c.NormalizeExports,
+		HardlinkExports:  c.HardlinkExports,
+		SparseExports:    c.SparseExports,
+	}
+	if c.Athens != "" {
+		smc.Athens = &gps.AthensProxy{URL: c.Athens, Exclude: c.AthensExclude}
+	}
+	if fields := strings.Fields(c.SumDB); len(fields) > 0 {
+		smc.ChecksumDB = &gps.ChecksumDB{Key: fields[0], FailClosed: c.SumDBFailClosed}
+		if len(fields) > 1 {
+			smc.ChecksumDB.URL = fields[1]
+		}
+	}
+	if len(c.AllowedHosts) > 0 || len(c.DeniedPrefixes) > 0 || len(c.AllowedLicenses) > 0 || c.AllowlistFile != "" {
+		smc.Policy = &gps.Policy{
+			AllowedHosts:    c.AllowedHosts,
+			DeniedPrefixes:  c.DeniedPrefixes,
+			AllowedLicenses: c.AllowedLicenses,
+		}
+		if c.AllowlistFile != "" {
+			allowed, err := readRevisionAllowlist(c.AllowlistFile)
+			if err != nil {
+				return nil, err
+			}
+			smc.Policy.AllowedRevisions = allowed
+		}
+	}
+	if len(c.Signatures) > 0 {
+		smc.RequiredSignatures = make(map[gps.ProjectRoot]gps.SignatureRequirement, len(c.Signatures))
+		for pr, req := range c.Signatures {
+			if req.Keyring == "" && c.Keyring == "" {
+				req.Keyring = defaultGnuPGHome()
+			}
+			smc.RequiredSignatures[pr] = req
+		}
+	}
+	if c.SandboxAnalyzers {
+		smc.AnalyzerSandbox = sandbox.Exec{Limits: sandbox.DefaultLimits}
+	}
+	if c.NetworkAudit != "" {
+		f, err := os.OpenFile(c.NetworkAudit, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open network audit log")
+		}
+		// The SourceMgr closes the log when it is released.
+		smc.NetworkAudit = f
+	}
+
+	sm, err := gps.NewSourceManager(smc)
+	if err != nil && smc.NetworkAudit != nil {
+		smc.NetworkAudit.(*os.File).Close()
+	}
+	return sm, err
 }
 
 // LoadProject starts from the current working directory and searches up the
@@ -133,6 +247,16 @@ func (c *Ctx) LoadProject() (*Project, error) {
 		return nil, err
 	}
 
+	// A write of the lock and vendor/ that was interrupted before it
+	// committed leaves them out of step, so it is rolled back before either
+	// is read, even by commands that only read them.
+	if HasInterruptedWrite(root) {
+		if _, err = RecoverInterruptedWrite(root); err != nil {
+			return nil, err
+		}
+		c.Err.Printf("dep: rolled back an interrupted write of %s and vendor/ in %s\n", LockName, root)
+	}
+
 	p := new(Project)
 
 	if err = p.SetRoot(root); err != nil {
@@ -190,6 +314,9 @@ func (c *Ctx) LoadProject() (*Project, error) {
 		if err != nil {
 			return nil, errors.Wrapf(err, "error while parsing %s", lp)
 		}
+		if err = c.CheckPinnedRevisions(p.Lock); err != nil {
+			return nil, err
+		}
 
 		// If there's a current Lock, apply the input and pruneopt changes that we
 		// can know without solving.
@@ -213,6 +340,25 @@ func (c *Ctx) LoadProject() (*Project, error) {
 	return p, nil
 }
 
+// CheckPinnedRevisions returns an error naming the projects in l that are not
+// pinned to a revision, if StrictRevisions is set, so that nothing is built
+// from anything but content-addressable revisions.
+func (c *Ctx) CheckPinnedRevisions(l *Lock) error {
+	if !c.StrictRevisions || l == nil {
+		return nil
+	}
+	unpinned := l.UnpinnedProjects()
+	if len(unpinned) == 0 {
+		return nil
+	}
+
+	roots := make([]string, len(unpinned))
+	for i, pr := range unpinned {
+		roots[i] = string(pr)
+	}
+	return errors.Errorf("%s is not pinned to a revision for %s, which DEPSTRICTREVISIONS requires", LockName, strings.Join(roots, ", "))
+}
+
 func externalImportList(rpt pkgtree.PackageTree, m gps.RootManifest) []string {
 	rm, _ := rpt.ToReachMap(true, true, false, m.IgnoredPackages())
 	reach := rm.FlattenFn(paths.IsStandardImportPath)
@@ -346,7 +492,7 @@ func (c *Ctx) AbsForImport(path string) (string, error) {
 
 // ValidateParams ensure that solving can be completed with the specified params.
 func (c *Ctx) ValidateParams(sm gps.SourceManager, params gps.SolveParameters) error {
-	err := gps.ValidateParams(params, sm)
+	err := gps.ValidateParams(context.TODO(), params, sm)
 	if err != nil {
 		if deduceErrs, ok := err.(gps.DeductionErrs); ok {
 			c.Err.Println("The following errors occurred while deducing packages:")
@@ -15,6 +15,7 @@ import (
 	"testing"
 	"unicode"
 
+	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -215,6 +216,48 @@ func TestExplicitRootProject(t *testing.T) {
 	}
 }
 
+func TestLoadProjectRollsBackInterruptedWrite(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	lock := `memo = "cdafe8641b28cd16fe025df278b0a49b9416859345d8b6ba0ace0272b74925ee"`
+	h.TempFile(filepath.Join("src", "test1", ManifestName), "")
+	h.TempFile(filepath.Join("src", "test1", LockName), lock)
+	root := h.Path(filepath.Join("src", "test1"))
+
+	// Move a lock that can't be read into place, as if dep had been killed
+	// before it could move in the vendor tree to match.
+	txn, err := newWriteTxn(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.TempFile(filepath.Join("src", "test1", txnDirName, LockName), "not a lock")
+	txn.replace(LockName)
+	h.Must(writeTxnJournal(filepath.Join(txn.dir, txnJournalName), txn.renames))
+	for _, r := range txn.renames {
+		h.Must(fs.RenameWithFallback(filepath.Join(root, r.From), filepath.Join(root, r.To)))
+	}
+	h.Must(txn.lf.Unlock())
+
+	ctx := &Ctx{
+		Out: discardLogger(),
+		Err: discardLogger(),
+	}
+	if err = ctx.SetPaths(root, h.Path(".")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	p, err := ctx.LoadProject()
+	if err != nil {
+		t.Fatalf("expected the interrupted write to be rolled back, got %+v", err)
+	}
+	if p.Lock == nil {
+		t.Fatal("expected the lock from before the interrupted write to be loaded")
+	}
+	if HasInterruptedWrite(root) {
+		t.Error("expected no interrupted write to be left")
+	}
+}
+
 func TestLoadProjectNotFoundErrors(t *testing.T) {
 	tg := test.NewHelper(t)
 	defer tg.Cleanup()
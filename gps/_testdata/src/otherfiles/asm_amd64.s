@@ -0,0 +1 @@
+#include "textflag.h"
@@ -0,0 +1,10 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otherfiles
+
+import _ "embed"
+
+//go:embed templates/*.tmpl
+var tmpl string
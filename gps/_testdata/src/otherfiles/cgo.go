@@ -0,0 +1,12 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otherfiles
+
+/*
+#include <stdlib.h>
+#include "include/thing.h"
+#include "missing.h"
+*/
+import "C"
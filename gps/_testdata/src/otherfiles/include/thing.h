@@ -0,0 +1 @@
+#define THING 1
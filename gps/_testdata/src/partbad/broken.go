@@ -0,0 +1,11 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This ill-formed Go source file is here to ensure that, when tolerating parse
+// errors, it doesn't spoil the rest of the package.
+
+package partbad
+
+import (
+	"unicode"
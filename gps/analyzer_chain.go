@@ -0,0 +1,108 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AnalyzerChain is a ProjectAnalyzer that falls back through the analyzers in
+// it, in order: the first to find a manifest for a project wins, and its
+// manifest and lock are returned. This allows analyzers for the conventions of
+// an organization to be layered over the default one, such as
+//
+//	gps.AnalyzerChain{orgAnalyzer{}, dep.Analyzer{}}
+//
+// An analyzer that fails is passed over like one that finds nothing, so long
+// as a later one finds a manifest. If none does, and any failed, the chain
+// fails with an AnalyzerErrs of each failure.
+type AnalyzerChain []ProjectAnalyzer
+
+// DeriveManifestAndLock runs the analyzers in the chain in turn, as described
+// for AnalyzerChain.
+func (c AnalyzerChain) DeriveManifestAndLock(path string, importRoot ProjectRoot) (Manifest, Lock, error) {
+	return c.DeriveManifestAndLockContext(context.Background(), path, importRoot)
+}
+
+// DeriveManifestAndLockContext is DeriveManifestAndLock, but gives up as soon
+// as ctx is cancelled, running the analyzers in the chain with ctx if they are
+// ContextProjectAnalyzers.
+func (c AnalyzerChain) DeriveManifestAndLockContext(ctx context.Context, path string, importRoot ProjectRoot) (Manifest, Lock, error) {
+	var errs AnalyzerErrs
+	for _, an := range c {
+		m, l, err := DeriveManifestAndLock(ctx, an, path, importRoot)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, ctxErr
+		}
+		if err != nil {
+			if errs == nil {
+				errs = make(AnalyzerErrs)
+			}
+			errs[an.Info()] = err
+			continue
+		}
+		if m != nil {
+			return m, l, nil
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return nil, nil, nil
+}
+
+// Info reports the chain's name, made up of the names and versions of the
+// analyzers in it, so that what any of them derive is cached apart from what
+// the same analyzers derive in another chain, or outside of one.
+func (c AnalyzerChain) Info() ProjectAnalyzerInfo {
+	names := make([]string, 0, len(c))
+	for _, an := range c {
+		names = append(names, an.Info().String())
+	}
+	return ProjectAnalyzerInfo{
+		Name:    "chain(" + strings.Join(names, ",") + ")",
+		Version: 1,
+	}
+}
+
+// AnalyzerErrs maps the info of each analyzer in an AnalyzerChain that failed
+// to its failure.
+type AnalyzerErrs map[ProjectAnalyzerInfo]error
+
+// infos returns the infos of the analyzers that failed, in order of their
+// names and versions.
+func (e AnalyzerErrs) infos() []ProjectAnalyzerInfo {
+	infos := make([]ProjectAnalyzerInfo, 0, len(e))
+	for info := range e {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].String() < infos[j].String()
+	})
+	return infos
+}
+
+func (e AnalyzerErrs) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, "no analyzer found a manifest, and some failed:")
+	for _, info := range e.infos() {
+		fmt.Fprintf(&buf, "\n\t%s: %s", info, e[info])
+	}
+	return buf.String()
+}
+
+// Unwrap returns the failures, in order of the names and versions of the
+// analyzers, so that errors.Is and errors.As find any of them.
+func (e AnalyzerErrs) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, info := range e.infos() {
+		errs = append(errs, e[info])
+	}
+	return errs
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fixedAnalyzer is a ProjectAnalyzer that derives the same thing for every
+// project, counting how many times it has been run.
+type fixedAnalyzer struct {
+	name string
+	m    Manifest
+	l    Lock
+	err  error
+	runs *int
+}
+
+func (a fixedAnalyzer) DeriveManifestAndLock(string, ProjectRoot) (Manifest, Lock, error) {
+	if a.runs != nil {
+		*a.runs++
+	}
+	return a.m, a.l, a.err
+}
+
+func (a fixedAnalyzer) Info() ProjectAnalyzerInfo {
+	return ProjectAnalyzerInfo{Name: a.name, Version: 1}
+}
+
+func TestAnalyzerChain(t *testing.T) {
+	m := SimpleManifest{Deps: ProjectConstraints{"example.com/a": ProjectProperties{Constraint: Any()}}}
+	l := SimpleLock{NewLockedProject(mkPI("example.com/a"), NewVersion("v1.0.0").Pair("abc"), nil)}
+	failure := errors.New("malformed")
+
+	var lastRuns int
+	c := AnalyzerChain{
+		fixedAnalyzer{name: "none"},
+		fixedAnalyzer{name: "broken", err: failure},
+		fixedAnalyzer{name: "found", m: m, l: l},
+		fixedAnalyzer{name: "last", m: SimpleManifest{}, runs: &lastRuns},
+	}
+	gotm, gotl, err := c.DeriveManifestAndLock("", "example.com/root")
+	if err != nil {
+		t.Fatalf("expected the first manifest found to win over the failure, got %s", err)
+	}
+	if gotm == nil || gotl == nil || len(gotm.DependencyConstraints()) != 1 || len(gotl.Projects()) != 1 {
+		t.Errorf("expected the manifest and lock of the first analyzer to find a manifest, got %v and %v", gotm, gotl)
+	}
+	if lastRuns != 0 {
+		t.Error("expected analyzers after the first to find a manifest not to be run")
+	}
+
+	if want := "chain(none.1,broken.1,found.1,last.1)"; c.Info().Name != want {
+		t.Errorf("expected the chain to be named %q, got %q", want, c.Info().Name)
+	}
+
+	// With no manifest found, every failure is reported.
+	c = AnalyzerChain{
+		fixedAnalyzer{name: "b", err: failure},
+		fixedAnalyzer{name: "none"},
+		fixedAnalyzer{name: "a", err: errors.New("unreadable")},
+	}
+	_, _, err = c.DeriveManifestAndLock("", "example.com/root")
+	errs, ok := err.(AnalyzerErrs)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected the failures of both analyzers, got %v", err)
+	}
+	if errs[ProjectAnalyzerInfo{Name: "b", Version: 1}] != failure {
+		t.Errorf("expected the failure of b to be kept, got %v", errs)
+	}
+	if !errors.Is(err, failure) {
+		t.Error("expected errors.Is to find the failure of b")
+	}
+	if msg := err.Error(); strings.Index(msg, "a.1: unreadable") > strings.Index(msg, "b.1: malformed") {
+		t.Errorf("expected failures to be listed in order of analyzer, got %q", msg)
+	}
+
+	// With nothing found and nothing failed, there is nothing.
+	gotm, gotl, err = AnalyzerChain{fixedAnalyzer{name: "none"}}.DeriveManifestAndLock("", "example.com/root")
+	if gotm != nil || gotl != nil || err != nil {
+		t.Errorf("expected nothing from a chain that finds nothing, got %v, %v, %v", gotm, gotl, err)
+	}
+
+	// A cancelled context stops the chain.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var runs int
+	_, _, err = AnalyzerChain{fixedAnalyzer{name: "found", m: m, runs: &runs}}.DeriveManifestAndLockContext(ctx, "", "example.com/root")
+	if err != context.Canceled || runs != 0 {
+		t.Errorf("expected a cancelled chain to run nothing and fail, got %v after %d runs", err, runs)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "context"
+
+// AnalyzerSandbox runs ProjectAnalyzers confined. Analyzers parse whatever is
+// in the repositories of dependencies, which is under the control of whoever
+// publishes them, so a bug in an analyzer could otherwise be exploited to
+// reach the network, or tamper with the source cache.
+//
+// The gps/sandbox package provides an implementation that runs analyzers in
+// a separate process.
+type AnalyzerSandbox interface {
+	// DeriveManifestAndLock returns what an.DeriveManifestAndLock would for
+	// the tree at path, but runs the analysis confined, such that it cannot
+	// reach the network or modify the tree.
+	DeriveManifestAndLock(ctx context.Context, an ProjectAnalyzer, path string, importRoot ProjectRoot) (Manifest, Lock, error)
+}
+
+// sandboxedAnalyzer is a ProjectAnalyzer that runs another in a sandbox.
+type sandboxedAnalyzer struct {
+	ctx context.Context
+	sb  AnalyzerSandbox
+	an  ProjectAnalyzer
+}
+
+func (a sandboxedAnalyzer) DeriveManifestAndLock(path string, importRoot ProjectRoot) (Manifest, Lock, error) {
+	return a.sb.DeriveManifestAndLock(a.ctx, a.an, path, importRoot)
+}
+
+func (a sandboxedAnalyzer) DeriveManifestAndLockContext(ctx context.Context, path string, importRoot ProjectRoot) (Manifest, Lock, error) {
+	return a.sb.DeriveManifestAndLock(ctx, a.an, path, importRoot)
+}
+
+func (a sandboxedAnalyzer) Info() ProjectAnalyzerInfo {
+	return a.an.Info()
+}
+
+// confine returns an, run in the gateway's sandbox if it has one.
+func (sg *sourceGateway) confine(ctx context.Context, an ProjectAnalyzer) ProjectAnalyzer {
+	if sg.sandbox == nil {
+		return an
+	}
+	return sandboxedAnalyzer{ctx: ctx, sb: sg.sandbox, an: an}
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// AthensProxy configures retrieving projects through an Athens proxy rather
+// than directly from their upstream repositories.
+type AthensProxy struct {
+	URL     string   // Base URL of the proxy. Credentials may be given in it.
+	Exclude []string // Import path prefixes of projects to retrieve directly from upstream instead.
+}
+
+// athensCatalogPageSize is the number of modules requested from an Athens
+// proxy's catalog at a time.
+const athensCatalogPageSize = 1000
+
+// athensProxy is a parsed AthensProxy.
+type athensProxy struct {
+	base    *url.URL
+	exclude []string
+	catalog *athensCatalog
+}
+
+func newAthensProxy(a AthensProxy) (*athensProxy, error) {
+	u, err := url.Parse(a.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("invalid base URL %q for the Athens proxy", a.URL)
+	}
+	return &athensProxy{
+		base:    u,
+		exclude: a.Exclude,
+		catalog: &athensCatalog{base: u},
+	}, nil
+}
+
+// serves reports whether path should be retrieved through the proxy.
+func (a *athensProxy) serves(path string) bool {
+	for _, prefix := range a.exclude {
+		if strings.HasPrefix(path, prefix) && isPathPrefixOrEqual(prefix, path) {
+			return false
+		}
+	}
+	return true
+}
+
+// athensCatalog looks up the versions of modules in the catalog of modules and
+// versions that an Athens proxy holds in its storage. Athens lists its catalog
+// in order of module path, so the catalog is only paged through as far as the
+// module looked up, and what is found for each module is remembered.
+type athensCatalog struct {
+	base *url.URL
+
+	mu      sync.Mutex
+	modules map[string][]string
+	err     error // Why the proxy's catalog can't be read, if it can't.
+}
+
+// versions returns the versions of module in the catalog.
+func (c *athensCatalog) versions(ctx context.Context, module string) ([]string, error) {
+	c.mu.Lock()
+	vl, has := c.modules[module]
+	err := c.err
+	c.mu.Unlock()
+	if has || err != nil {
+		return vl, err
+	}
+
+	vl, err = c.lookup(ctx, module)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		// A lookup that was canceled or timed out may yet succeed, so only
+		// failures of the proxy itself are remembered.
+		if ctx.Err() == nil {
+			c.err = err
+		}
+		return nil, err
+	}
+	if c.modules == nil {
+		c.modules = make(map[string][]string)
+	}
+	c.modules[module] = vl
+	return vl, nil
+}
+
+// lookup pages through the catalog for the versions of module, stopping at the
+// first module listed after it.
+func (c *athensCatalog) lookup(ctx context.Context, module string) ([]string, error) {
+	var vl []string
+	var token string
+	for {
+		var page struct {
+			Modules []struct {
+				Module  string `json:"module"`
+				Version string `json:"version"`
+			} `json:"modules"`
+			Next string `json:"next"`
+		}
+
+		q := url.Values{"pagesize": {strconv.Itoa(athensCatalogPageSize)}}
+		if token != "" {
+			q.Set("token", token)
+		}
+		rc, err := registryGet(ctx, c.base, "", "catalog?"+q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		err = json.NewDecoder(rc).Decode(&page)
+		rc.Close()
+		if err != nil {
+			return nil, wrapError(err, "failed to read Athens catalog")
+		}
+
+		for _, m := range page.Modules {
+			switch {
+			case m.Module == module:
+				vl = append(vl, m.Version)
+			case m.Module > module:
+				return vl, nil
+			}
+		}
+		if page.Next == "" || page.Next == token {
+			return vl, nil
+		}
+		token = page.Next
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestAthensCatalogRetriesCanceledLookups(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modules":[{"module":"example.com/a","version":"v1.0.0"}]}`))
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &athensCatalog{base: u}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = c.versions(ctx, "example.com/a"); err == nil {
+		t.Fatal("expected a canceled lookup to fail")
+	}
+	vl, err := c.versions(context.Background(), "example.com/a")
+	if err != nil || len(vl) != 1 || vl[0] != "v1.0.0" {
+		t.Errorf("expected the lookup to succeed once no longer canceled, got %v, %v", vl, err)
+	}
+}
+
+func TestAthensProxy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/example.com/a/@v/list", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.0.0\n"))
+	})
+	var pages []string
+	mux.HandleFunc("/catalog", func(w http.ResponseWriter, r *http.Request) {
+		// Three pages in order of module, each reached by its token.
+		token := r.URL.Query().Get("token")
+		pages = append(pages, token)
+		switch token {
+		case "":
+			w.Write([]byte(`{"modules":[{"module":"example.com/0","version":"v1.0.0"},{"module":"example.com/a","version":"v0.9.0"}],"next":"page2"}`))
+		case "page2":
+			w.Write([]byte(`{"modules":[{"module":"example.com/a","version":"v1.0.0"},{"module":"example.com/b","version":"v2.0.0"}],"next":"page3"}`))
+		default:
+			w.Write([]byte(`{"modules":[{"module":"example.com/c","version":"v3.0.0"}]}`))
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir: h.Path("cache"),
+		Logger:   log.New(test.Writer{TB: t}, "", 0),
+		Athens:   &AthensProxy{URL: srv.URL, Exclude: []string{"example.com/private"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	ctx := context.Background()
+	vl, err := sm.ListVersions(ctx, ProjectIdentifier{ProjectRoot: "example.com/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range vl {
+		got = append(got, v.String())
+	}
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "v0.9.0" || got[1] != "v1.0.0" {
+		t.Errorf("expected versions from both the list and the catalog, got %v", got)
+	}
+	if len(pages) != 2 {
+		t.Errorf("expected the catalog to be read only as far as the module, got pages %q", pages)
+	}
+
+	dc := sm.deduceCoord
+	for path, want := range map[string]bool{
+		"example.com/a/pkg":         true,
+		"example.com/private":       false,
+		"example.com/private/pkg":   false,
+		"example.com/privateer":     true,
+		"https://example.com/a/pkg": false,
+	} {
+		if _, got := dc.registryFor(path); got != want {
+			t.Errorf("expected registryFor(%q) to be %v, got %v", path, want, got)
+		}
+	}
+}
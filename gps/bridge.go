@@ -5,6 +5,7 @@
 package gps
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -29,6 +30,7 @@ type sourceBridge interface {
 	verifyRootDir(path string) error
 	vendorCodeExists(ProjectIdentifier) (bool, error)
 	breakLock()
+	setContext(context.Context)
 }
 
 // bridge is an adapter around a proper SourceManager. It provides localized
@@ -63,8 +65,7 @@ type bridge struct {
 	// The cancellation context provided to the solver. Threading it through the
 	// various solver methods is needlessly verbose so long as we maintain the
 	// lifetime guarantees that a solver can only be run once.
-	// TODO(sdboyer) uncomment this and thread it through SourceManager methods
-	//ctx context.Context
+	ctx context.Context
 }
 
 // mkBridge creates a bridge
@@ -74,16 +75,22 @@ func mkBridge(s *solver, sm SourceManager, down bool) *bridge {
 		s:      s,
 		down:   down,
 		vlists: make(map[ProjectIdentifier][]Version),
+		ctx:    context.Background(),
 	}
 }
 
+// setContext sets the context with which the bridge calls the SourceManager.
+func (b *bridge) setContext(ctx context.Context) {
+	b.ctx = ctx
+}
+
 func (b *bridge) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
 	if b.s.rd.isRoot(id.ProjectRoot) {
 		return b.s.rd.rm, b.s.rd.rl, nil
 	}
 
 	b.s.mtr.push("b-gmal")
-	m, l, e := b.sm.GetManifestAndLock(id, v, an)
+	m, l, e := b.sm.GetManifestAndLock(b.ctx, id, v, an)
 	b.s.mtr.pop()
 	return m, l, e
 }
@@ -94,7 +101,7 @@ func (b *bridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 	}
 
 	b.s.mtr.push("b-list-versions")
-	pvl, err := b.sm.ListVersions(id)
+	pvl, err := b.sm.ListVersions(b.ctx, id)
 	if err != nil {
 		b.s.mtr.pop()
 		return nil, err
@@ -114,14 +121,14 @@ func (b *bridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 
 func (b *bridge) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
 	b.s.mtr.push("b-rev-present-in")
-	i, e := b.sm.RevisionPresentIn(id, r)
+	i, e := b.sm.RevisionPresentIn(b.ctx, id, r)
 	b.s.mtr.pop()
 	return i, e
 }
 
 func (b *bridge) SourceExists(id ProjectIdentifier) (bool, error) {
 	b.s.mtr.push("b-source-exists")
-	i, e := b.sm.SourceExists(id)
+	i, e := b.sm.SourceExists(b.ctx, id)
 	b.s.mtr.pop()
 	return i, e
 }
@@ -148,7 +155,7 @@ func (b *bridge) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageT
 	}
 
 	b.s.mtr.push("b-list-pkgs")
-	pt, err := b.sm.ListPackages(id, v)
+	pt, err := b.sm.ListPackages(b.ctx, id, v)
 	b.s.mtr.pop()
 	return pt, err
 }
@@ -172,7 +179,7 @@ func (b *bridge) verifyRootDir(path string) error {
 
 func (b *bridge) DeduceProjectRoot(ip string) (ProjectRoot, error) {
 	b.s.mtr.push("b-deduce-proj-root")
-	pr, e := b.sm.DeduceProjectRoot(ip)
+	pr, e := b.sm.DeduceProjectRoot(b.ctx, ip)
 	b.s.mtr.pop()
 	return pr, e
 }
@@ -199,10 +206,10 @@ func (b *bridge) breakLock() {
 			pi, v := lp.Ident(), lp.Version()
 			go func() {
 				// Sync first
-				b.sm.SyncSourceFor(pi)
+				b.sm.SyncSourceFor(b.ctx, pi)
 				// Preload the package info for the locked version, too, as
 				// we're more likely to need that
-				b.sm.ListPackages(pi, v)
+				b.sm.ListPackages(b.ctx, pi, v)
 			}()
 		}
 	}
@@ -211,5 +218,5 @@ func (b *bridge) breakLock() {
 func (b *bridge) SyncSourceFor(id ProjectIdentifier) error {
 	// we don't track metrics here b/c this is often called in its own goroutine
 	// by the solver, and the metrics design is for wall time on a single thread
-	return b.sm.SyncSourceFor(id)
+	return b.sm.SyncSourceFor(b.ctx, id)
 }
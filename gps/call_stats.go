@@ -0,0 +1,239 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"sort"
+	"time"
+)
+
+// callLatencyBounds are the upper bounds of the latency buckets in CallStats.
+var callLatencyBounds = []time.Duration{
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// SourceManagerStats describes the work a SourceMgr has done, as reported by
+// SourceMgr.Stats.
+type SourceManagerStats struct {
+	Calls              []CallStats   // One entry for each type of call made so far
+	Sources            []SourceStats // One entry for each source that calls were made for, in order of URL
+	FoldedSourceSetups int           // Requests for a source that joined an identical request already in flight
+}
+
+// SourceStats describes the calls a SourceMgr has made for a single source.
+type SourceStats struct {
+	URL   string      // The upstream URL of the source
+	Calls []CallStats // One entry for each type of call made for the source
+}
+
+// CallStats describes the calls of a single type made by a SourceMgr.
+type CallStats struct {
+	Type      string          // Description of the type of call
+	Issued    int             // Calls actually made
+	Folded    int             // Calls avoided by joining an identical call already in flight
+	Cached    int             // Calls avoided by answering from the source's cache
+	Retried   int             // Calls made again after updating the local source
+	Failed    int             // Issued calls that returned an error
+	Total     time.Duration   // Combined latency of all issued calls
+	Max       time.Duration   // Highest latency of any issued call
+	Latencies []LatencyBucket // Distribution of the latencies of issued calls
+}
+
+// LatencyBucket counts the calls whose latency was less than UpTo, and no less
+// than the UpTo of the preceding bucket. An UpTo of zero indicates the final,
+// unbounded bucket.
+type LatencyBucket struct {
+	UpTo  time.Duration
+	Count int
+}
+
+// callStatsKey identifies the calls that a callStats accumulates CallStats
+// for: those of a single callType, made for a single source, or for none if
+// source is empty.
+type callStatsKey struct {
+	typ    callType
+	source string
+}
+
+// callStats accumulates CallStats for a single callStatsKey.
+type callStats struct {
+	issued, folded, cached, retried, failed int
+	total, max                              time.Duration
+	latencies                               []int // len(callLatencyBounds)+1
+}
+
+func newCallStats() *callStats {
+	return &callStats{latencies: make([]int, len(callLatencyBounds)+1)}
+}
+
+// add adds the statistics of o to those of cs.
+func (cs *callStats) add(o *callStats) {
+	cs.issued += o.issued
+	cs.folded += o.folded
+	cs.cached += o.cached
+	cs.retried += o.retried
+	cs.failed += o.failed
+	cs.total += o.total
+	if o.max > cs.max {
+		cs.max = o.max
+	}
+	for i, n := range o.latencies {
+		cs.latencies[i] += n
+	}
+}
+
+// export returns the CallStats that cs has accumulated for calls of type typ.
+func (cs *callStats) export(typ callType) CallStats {
+	lbs := make([]LatencyBucket, len(cs.latencies))
+	for i, n := range cs.latencies {
+		lbs[i].Count = n
+		if i < len(callLatencyBounds) {
+			lbs[i].UpTo = callLatencyBounds[i]
+		}
+	}
+	return CallStats{
+		Type:      typ.String(),
+		Issued:    cs.issued,
+		Folded:    cs.folded,
+		Cached:    cs.cached,
+		Retried:   cs.retried,
+		Failed:    cs.failed,
+		Total:     cs.total,
+		Max:       cs.max,
+		Latencies: lbs,
+	}
+}
+
+// statsFor returns the callStats for calls of type typ made for source,
+// creating it if needed.
+//
+// caller must hold sup.mu.
+func (sup *supervisor) statsFor(typ callType, source string) *callStats {
+	if sup.stats == nil {
+		sup.stats = make(map[callStatsKey]*callStats)
+	}
+	k := callStatsKey{typ: typ, source: source}
+	cs, has := sup.stats[k]
+	if !has {
+		cs = newCallStats()
+		sup.stats[k] = cs
+	}
+	return cs
+}
+
+// record adds a completed call of type typ, made for source, to the
+// supervisor's statistics.
+func (sup *supervisor) record(typ callType, source string, latency time.Duration, err error) {
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+
+	cs := sup.statsFor(typ, source)
+	cs.issued++
+	if err != nil {
+		cs.failed++
+	}
+	cs.total += latency
+	if latency > cs.max {
+		cs.max = latency
+	}
+	cs.latencies[sort.Search(len(callLatencyBounds), func(i int) bool {
+		return latency < callLatencyBounds[i]
+	})]++
+}
+
+// fold records that a call of type typ, made for source, was avoided by
+// joining an identical call already in flight.
+func (sup *supervisor) fold(typ callType, source string) {
+	sup.mu.Lock()
+	sup.statsFor(typ, source).folded++
+	sup.mu.Unlock()
+}
+
+// cacheHit records that a call of type typ was avoided by answering it from the
+// cache of source.
+func (sup *supervisor) cacheHit(typ callType, source string) {
+	sup.mu.Lock()
+	sup.statsFor(typ, source).cached++
+	sup.mu.Unlock()
+}
+
+// retry records that a call of type typ, made for source, is being made again.
+func (sup *supervisor) retry(typ callType, source string) {
+	sup.mu.Lock()
+	sup.statsFor(typ, source).retried++
+	sup.mu.Unlock()
+}
+
+// foldSetup records that a request for a source joined an identical request
+// already in flight.
+func (sup *supervisor) foldSetup() {
+	sup.mu.Lock()
+	sup.folds++
+	sup.mu.Unlock()
+}
+
+// snapshot returns a copy of the supervisor's statistics so far.
+func (sup *supervisor) snapshot() SourceManagerStats {
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	return sup.snapshotLocked()
+}
+
+// resetStats returns a copy of the supervisor's statistics so far, and then
+// discards them, so that the next snapshot only describes calls after it.
+func (sup *supervisor) resetStats() SourceManagerStats {
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	stats := sup.snapshotLocked()
+	sup.stats, sup.folds = nil, 0
+	return stats
+}
+
+// caller must hold sup.mu.
+func (sup *supervisor) snapshotLocked() SourceManagerStats {
+	keys := make([]callStatsKey, 0, len(sup.stats))
+	for k := range sup.stats {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].source != keys[j].source {
+			return keys[i].source < keys[j].source
+		}
+		return keys[i].typ < keys[j].typ
+	})
+
+	stats := SourceManagerStats{FoldedSourceSetups: sup.folds}
+	byType := make(map[callType]*callStats)
+	var types []callType
+	for _, k := range keys {
+		cs := sup.stats[k]
+		all, has := byType[k.typ]
+		if !has {
+			all = newCallStats()
+			byType[k.typ] = all
+			types = append(types, k.typ)
+		}
+		all.add(cs)
+
+		if k.source == "" {
+			continue
+		}
+		if n := len(stats.Sources); n == 0 || stats.Sources[n-1].URL != k.source {
+			stats.Sources = append(stats.Sources, SourceStats{URL: k.source})
+		}
+		ss := &stats.Sources[len(stats.Sources)-1]
+		ss.Calls = append(ss.Calls, cs.export(k.typ))
+	}
+
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, typ := range types {
+		stats.Calls = append(stats.Calls, byType[typ].export(typ))
+	}
+	return stats
+}
@@ -0,0 +1,588 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+// cassetteLogName is the name of the file in a cassette's directory that holds
+// its interactions.
+const cassetteLogName = "interactions.json"
+
+// A Cassette is a recording of what a SourceMgr retrieved over the network,
+// kept in a directory, so that the same run can be repeated later without
+// network access: set as SourceManagerConfig.Cassette, one made by
+// RecordCassette records, and one opened by ReplayCassette replays.
+//
+// HTTP responses, such as those to go get metadata requests, are recorded as
+// they were received. Operations on VCS sources are recorded by their outcome:
+// whether the source existed, the versions it listed, and the local copy that
+// cloning or fetching it left behind, which replaying puts in place of the
+// local copy rather than running the VCS at all. Everything else a SourceMgr
+// does with a local copy, such as listing its packages or exporting it, runs
+// as usual.
+//
+// Credentials are scrubbed from what is recorded, as they are from errors and
+// logs: from URLs, error messages and response headers, and from the
+// configuration of the VCS in recorded local copies, which is otherwise left
+// out. Failures are recorded in enough detail to be replayed as errors of the
+// same type, such as *SourceNotFoundError.
+//
+// When replaying, an interaction that was recorded more than once is replayed
+// in the order it was recorded in, with the last recording repeated once
+// those run out. An interaction that was never recorded fails.
+type Cassette struct {
+	dir    string
+	replay bool
+	redact *redactor // Set by the SourceMgr using the Cassette.
+
+	mu           sync.Mutex
+	interactions []cassetteInteraction
+	played       map[string]int // In replay, how many of the interactions with each key have been replayed
+	snapshots    int
+}
+
+// cassetteInteraction is a single recorded interaction with the network.
+type cassetteInteraction struct {
+	// Key identifies what the interaction was, such as "GET <url>" for an HTTP
+	// request, or "list-versions <url>" for listing a VCS source's versions.
+	Key string `json:"key"`
+
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+
+	Exists   bool              `json:"exists,omitempty"`
+	Versions []cassetteVersion `json:"versions,omitempty"`
+	Snapshot string            `json:"snapshot,omitempty"` // The directory, relative to the cassette's, holding the local copy left behind.
+
+	Error *cassetteError `json:"error,omitempty"`
+}
+
+// cassetteError is the recorded form of an error. If it was caused by one of
+// the errors that callers may tell apart by type, Kind says which, and the
+// fields of that type are recorded alongside the error's message.
+type cassetteError struct {
+	Message string `json:"message"`
+	Kind    string `json:"kind,omitempty"`
+
+	Type       string           `json:"type,omitempty"`
+	URL        string           `json:"url,omitempty"`
+	Version    *cassetteVersion `json:"version,omitempty"`
+	ImportPath string           `json:"import_path,omitempty"`
+	Root       string           `json:"root,omitempty"`
+	Source     string           `json:"source,omitempty"`
+	Path       string           `json:"path,omitempty"`
+	Cause      string           `json:"cause,omitempty"`
+}
+
+// The kinds of cassetteError.
+const (
+	cassetteSourceNotFound  = "source-not-found"
+	cassetteVersionNotFound = "version-not-found"
+	cassettePackageNotFound = "package-not-found"
+	cassetteDeduction       = "deduction"
+	cassetteCanceled        = "canceled"
+	cassetteDeadline        = "deadline-exceeded"
+)
+
+// cassetteVersion is the recorded form of a PairedVersion.
+type cassetteVersion struct {
+	Revision string `json:"revision,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+	Version  string `json:"version,omitempty"`
+}
+
+// RecordCassette creates dir, which must not exist, and returns a Cassette
+// that records into it. The recording is written out when the SourceMgr using
+// it is released.
+func RecordCassette(dir string) (*Cassette, error) {
+	if _, err := os.Stat(dir); err == nil {
+		return nil, errors.Errorf("cannot record a cassette into %s, it already exists", dir)
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	return &Cassette{dir: dir}, nil
+}
+
+// ReplayCassette opens the cassette recorded into dir, to replay it.
+func ReplayCassette(dir string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, cassetteLogName))
+	if err != nil {
+		return nil, wrapError(err, "failed to read cassette")
+	}
+	c := &Cassette{dir: dir, replay: true, played: make(map[string]int)}
+	if err := json.Unmarshal(b, &c.interactions); err != nil {
+		return nil, wrapErrorf(err, "failed to parse cassette %s", dir)
+	}
+	return c, nil
+}
+
+// close writes out the recorded interactions, if the Cassette is recording.
+func (c *Cassette) close() error {
+	if c.replay {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(c.dir, cassetteLogName), b, 0666)
+}
+
+// record adds in to the recording, with credentials scrubbed from it.
+func (c *Cassette) record(in cassetteInteraction) {
+	in.Key = c.redact.redact(in.Key)
+	if in.Header != nil {
+		h := make(http.Header, len(in.Header))
+		for k, vs := range in.Header {
+			switch http.CanonicalHeaderKey(k) {
+			case "Set-Cookie", "Authorization", "Proxy-Authorization":
+				continue
+			}
+			for _, v := range vs {
+				h.Add(k, c.redact.redact(v))
+			}
+		}
+		in.Header = h
+	}
+	c.mu.Lock()
+	c.interactions = append(c.interactions, in)
+	c.mu.Unlock()
+}
+
+// play returns the next recorded interaction with key.
+func (c *Cassette) play(key string) (cassetteInteraction, error) {
+	key = c.redact.redact(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var last *cassetteInteraction
+	var seen int
+	for i := range c.interactions {
+		if c.interactions[i].Key != key {
+			continue
+		}
+		last = &c.interactions[i]
+		if seen == c.played[key] {
+			break
+		}
+		seen++
+	}
+	if last == nil {
+		return cassetteInteraction{}, errors.Errorf("cassette %s has no recording of %s", c.dir, key)
+	}
+	c.played[key]++
+	return *last, nil
+}
+
+// snapshot copies the local copy of a source at path into the cassette, and
+// returns where it was copied to, relative to the cassette.
+func (c *Cassette) snapshot(path string) (string, error) {
+	c.mu.Lock()
+	c.snapshots++
+	name := filepath.Join("snapshots", fmt.Sprint(c.snapshots))
+	c.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(c.dir, "snapshots"), 0777); err != nil {
+		return "", err
+	}
+	if err := fs.CopyDir(path, filepath.Join(c.dir, name)); err != nil {
+		return "", err
+	}
+	for _, cfg := range vcsConfigFiles {
+		if err := c.scrubConfig(filepath.Join(c.dir, name, cfg)); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+// vcsConfigFiles are the files, relative to a local copy of a source, in which
+// VCSs keep the configuration of the copy, such as its remotes and how to
+// authenticate to them.
+var vcsConfigFiles = []string{
+	filepath.Join(".git", "config"),
+	filepath.Join(".git", "FETCH_HEAD"),
+	filepath.Join(".hg", "hgrc"),
+	filepath.Join(".bzr", "branch", "branch.conf"),
+}
+
+// vcsCredentialSetting matches the lines of VCS configuration that set
+// credentials, or how to get them: git's http.extraHeader and credential
+// helpers, and the usernames and passwords of hg's [auth] section.
+var vcsCredentialSetting = regexp.MustCompile(`(?i)^\s*[\w.-]*(extraheader|helper|username|password|token)\s*=`)
+
+// scrubConfig removes the settings of credentials from the VCS configuration
+// file at path, if there is one, and scrubs credentials from the rest.
+func (c *Cassette) scrubConfig(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		if vcsCredentialSetting.MatchString(s.Text()) {
+			continue
+		}
+		fmt.Fprintln(&buf, c.redact.redact(s.Text()))
+	}
+	if err = s.Err(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// restore replaces the local copy of a source at path with the snapshot name.
+func (c *Cassette) restore(name, path string) error {
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return fs.CopyDir(filepath.Join(c.dir, name), path)
+}
+
+// errorOf returns the recorded form of err, with credentials scrubbed from it.
+func (c *Cassette) errorOf(err error) *cassetteError {
+	if err == nil {
+		return nil
+	}
+	ce := &cassetteError{Message: c.redact.redact(err.Error())}
+	for _, cause := range FailureCauses(err) {
+		for cause != nil && !ce.setKind(c.redact, cause) {
+			cr, ok := cause.(interface {
+				Cause() error
+			})
+			if !ok {
+				break
+			}
+			cause = cr.Cause()
+		}
+		if ce.Kind != "" {
+			break
+		}
+	}
+	return ce
+}
+
+// setKind records the details of err in ce, and reports whether it did so: if
+// err is of one of the kinds of cassetteError.
+func (ce *cassetteError) setKind(r *redactor, err error) bool {
+	switch e := err.(type) {
+	case *SourceNotFoundError:
+		ce.Kind, ce.Type, ce.URL = cassetteSourceNotFound, e.Type, r.redact(e.URL)
+	case *VersionNotFoundError:
+		ce.Kind, ce.URL = cassetteVersionNotFound, r.redact(e.URL)
+		cv := toCassetteAnyVersion(e.Version)
+		ce.Version = &cv
+	case *PackageNotFoundError:
+		ce.Kind, ce.ImportPath = cassettePackageNotFound, e.ImportPath
+		ce.Root, ce.Source = string(e.Project.ProjectRoot), r.redact(e.Project.Source)
+	case *DeductionError:
+		ce.Kind, ce.Path, ce.Cause = cassetteDeduction, e.Path, r.redact(e.Err.Error())
+	default:
+		switch err {
+		case context.Canceled:
+			ce.Kind = cassetteCanceled
+		case context.DeadlineExceeded:
+			ce.Kind = cassetteDeadline
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// err returns the error ce records, as an error of the same type as the one
+// that caused it, if it was of one of the kinds of cassetteError, with the
+// message the original error had.
+func (ce *cassetteError) err() error {
+	if ce == nil {
+		return nil
+	}
+
+	var cause error
+	switch ce.Kind {
+	case cassetteSourceNotFound:
+		cause = &SourceNotFoundError{Type: ce.Type, URL: ce.URL}
+	case cassetteVersionNotFound:
+		var v Version
+		if ce.Version != nil {
+			v = ce.Version.anyVersion()
+		}
+		cause = &VersionNotFoundError{Version: v, URL: ce.URL}
+	case cassettePackageNotFound:
+		cause = &PackageNotFoundError{
+			ImportPath: ce.ImportPath,
+			Project:    ProjectIdentifier{ProjectRoot: ProjectRoot(ce.Root), Source: ce.Source},
+		}
+	case cassetteDeduction:
+		cause = &DeductionError{Path: ce.Path, Err: errors.New(ce.Cause)}
+	case cassetteCanceled:
+		cause = context.Canceled
+	case cassetteDeadline:
+		cause = context.DeadlineExceeded
+	default:
+		return errors.New(ce.Message)
+	}
+	if cause.Error() == ce.Message {
+		return cause
+	}
+	return &replayedError{msg: ce.Message, err: cause}
+}
+
+// replayedError is an error replayed from a cassette, with the message of the
+// error that was recorded, and a cause of the same type as it had.
+type replayedError struct {
+	msg string
+	err error
+}
+
+func (e *replayedError) Error() string {
+	return e.msg
+}
+
+func (e *replayedError) Cause() error {
+	return e.err
+}
+
+func (e *replayedError) Unwrap() error {
+	return e.err
+}
+
+type cassetteKey struct{}
+
+// roundTrip makes req with rt, or in replay, returns the response that was
+// recorded for it.
+func (c *Cassette) roundTrip(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+	// Credentials in the URL are not recorded.
+	u := *req.URL
+	u.User = nil
+	key := req.Method + " " + u.String()
+	if c.replay {
+		in, err := c.play(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := in.Error.err(); err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+			StatusCode:    in.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Header,
+			Body:          ioutil.NopCloser(bytes.NewReader(in.Body)),
+			ContentLength: int64(len(in.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		c.record(cassetteInteraction{Key: key, Error: c.errorOf(err)})
+		return nil, err
+	}
+	// The body is read in full, so that it can be recorded, and then handed
+	// on as though it had not been.
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		c.record(cassetteInteraction{Key: key, Error: c.errorOf(err)})
+		return nil, err
+	}
+	c.record(cassetteInteraction{Key: key, Status: resp.StatusCode, Header: resp.Header, Body: body})
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// cassetteFor returns the Cassette that sg's operations on its upstream are
+// recorded into or replayed from, if any, along with where the source's local
+// copy is kept. Only sources with local copies of their own, as VCS sources
+// have, are recorded by operation; sources that make HTTP requests are
+// recorded request by request instead.
+func (sg *sourceGateway) cassetteFor() (*Cassette, string) {
+	lp, ok := sg.src.(localPather)
+	if sg.suprvsr.cassette == nil || !ok {
+		return nil, ""
+	}
+	return sg.suprvsr.cassette, lp.localPath()
+}
+
+func (sg *sourceGateway) cassetteKey(op string) string {
+	return op + " " + sg.src.upstreamURL()
+}
+
+// upstreamExists reports whether the source exists upstream.
+func (sg *sourceGateway) upstreamExists(ctx context.Context) bool {
+	c, _ := sg.cassetteFor()
+	if c == nil {
+		return sg.src.existsUpstream(ctx)
+	}
+
+	key := sg.cassetteKey("exists")
+	if c.replay {
+		in, err := c.play(key)
+		return err == nil && in.Exists
+	}
+	exists := sg.src.existsUpstream(ctx)
+	c.record(cassetteInteraction{Key: key, Exists: exists})
+	return exists
+}
+
+// retrieve sets up or updates the local copy of the source with f.
+//
+// Setting up and updating the local copy are replayed alike, by putting the
+// recorded local copy in place, so that replaying does not depend on whether
+// the source was already cached when it was recorded.
+func (sg *sourceGateway) retrieve(ctx context.Context, f func(context.Context) error) error {
+	c, path := sg.cassetteFor()
+	if c == nil {
+		return f(ctx)
+	}
+
+	key := sg.cassetteKey("retrieve")
+	if c.replay {
+		in, err := c.play(key)
+		if err != nil {
+			return err
+		}
+		if err := in.Error.err(); err != nil {
+			return err
+		}
+		return c.restore(in.Snapshot, path)
+	}
+
+	err := f(ctx)
+	in := cassetteInteraction{Key: key, Error: c.errorOf(err)}
+	if err == nil {
+		if in.Snapshot, err = c.snapshot(path); err != nil {
+			return wrapErrorf(err, "failed to record local copy of %s", sg.src.upstreamURL())
+		}
+	}
+	c.record(in)
+	return err
+}
+
+// upstreamVersions lists the versions of the source.
+func (sg *sourceGateway) upstreamVersions(ctx context.Context) ([]PairedVersion, error) {
+	c, _ := sg.cassetteFor()
+	if c == nil {
+		return sg.src.listVersions(ctx)
+	}
+
+	key := sg.cassetteKey("list-versions")
+	if c.replay {
+		in, err := c.play(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := in.Error.err(); err != nil {
+			return nil, err
+		}
+		pvl := make([]PairedVersion, 0, len(in.Versions))
+		for _, cv := range in.Versions {
+			pvl = append(pvl, cv.version())
+		}
+		return pvl, nil
+	}
+
+	pvl, err := sg.src.listVersions(ctx)
+	in := cassetteInteraction{Key: key, Error: c.errorOf(err)}
+	for _, pv := range pvl {
+		in.Versions = append(in.Versions, toCassetteVersion(pv))
+	}
+	c.record(in)
+	return pvl, err
+}
+
+func toCassetteVersion(pv PairedVersion) cassetteVersion {
+	cv := cassetteVersion{Revision: string(pv.Revision())}
+	switch tv := pv.Unpair().(type) {
+	case branchVersion:
+		cv.Branch, cv.Default = tv.name, tv.isDefault
+	default:
+		cv.Version = tv.String()
+	}
+	return cv
+}
+
+// toCassetteAnyVersion returns the recorded form of v, which may be unpaired,
+// or a bare revision.
+func toCassetteAnyVersion(v Version) cassetteVersion {
+	switch tv := v.(type) {
+	case PairedVersion:
+		return toCassetteVersion(tv)
+	case Revision:
+		return cassetteVersion{Revision: string(tv)}
+	case branchVersion:
+		return cassetteVersion{Branch: tv.name, Default: tv.isDefault}
+	case nil:
+		return cassetteVersion{}
+	default:
+		return cassetteVersion{Version: tv.String()}
+	}
+}
+
+// anyVersion returns the version cv records, which, unlike with version, need
+// not be paired.
+func (cv cassetteVersion) anyVersion() Version {
+	var uv UnpairedVersion
+	switch {
+	case cv.Default:
+		uv = newDefaultBranch(cv.Branch)
+	case cv.Branch != "":
+		uv = NewBranch(cv.Branch)
+	case cv.Version != "":
+		uv = NewVersion(cv.Version)
+	case cv.Revision != "":
+		return Revision(cv.Revision)
+	default:
+		return nil
+	}
+	if cv.Revision == "" {
+		return uv
+	}
+	return uv.Pair(Revision(cv.Revision))
+}
+
+func (cv cassetteVersion) version() PairedVersion {
+	var uv UnpairedVersion
+	switch {
+	case cv.Default:
+		uv = newDefaultBranch(cv.Branch)
+	case cv.Branch != "":
+		uv = NewBranch(cv.Branch)
+	default:
+		uv = NewVersion(cv.Version)
+	}
+	return uv.Pair(Revision(cv.Revision))
+}
@@ -18,7 +18,8 @@ import (
 )
 
 type cmd struct {
-	// ctx is provided by the caller; SIGINT is sent when it is cancelled.
+	// ctx is provided by the caller; SIGINT is sent to the subprocess's process
+	// group when it is cancelled.
 	ctx context.Context
 	Cmd *exec.Cmd
 }
@@ -42,6 +43,11 @@ func commandContext(ctx context.Context, name string, arg ...string) cmd {
 // CombinedOutput is like (*os/exec.Cmd).CombinedOutput except that it
 // terminates subprocesses gently (via os.Interrupt), but resorts to Kill if
 // the subprocess fails to exit after 1 minute.
+//
+// Signals are sent to the subprocess's entire process group, so that any
+// processes it has started in turn, such as the ssh or remote helper processes
+// started by git, are stopped along with it. Once a cancelled subprocess has
+// exited, whatever remains of its process group is killed.
 func (c cmd) CombinedOutput() ([]byte, error) {
 	// Adapted from (*os/exec.Cmd).CombinedOutput
 	if c.Cmd.Stdout != nil {
@@ -50,33 +56,64 @@ func (c cmd) CombinedOutput() ([]byte, error) {
 	if c.Cmd.Stderr != nil {
 		return nil, errors.New("exec: Stderr already set")
 	}
-	var b bytes.Buffer
-	c.Cmd.Stdout = &b
-	c.Cmd.Stderr = &b
-	if err := c.Cmd.Start(); err != nil {
+
+	// The subprocess writes directly to a pipe of our own, rather than to one
+	// that (*os/exec.Cmd).Wait waits to be drained, so that Wait returns as
+	// soon as the subprocess exits, even if descendants still hold the pipe.
+	r, w, err := os.Pipe()
+	if err != nil {
 		return nil, err
 	}
+	c.Cmd.Stdout = w
+	c.Cmd.Stderr = w
+	err = c.Cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		_, _ = b.ReadFrom(r)
+		r.Close()
+	}()
 
 	// Adapted from (*os/exec.Cmd).Start
+	pgid := c.Cmd.Process.Pid
 	waitDone := make(chan struct{})
-	defer close(waitDone)
+	watchDone := make(chan struct{})
 	go func() {
+		defer close(watchDone)
 		select {
 		case <-c.ctx.Done():
-			if err := c.Cmd.Process.Signal(os.Interrupt); err != nil {
+			if err := signalProcessGroup(pgid, syscall.SIGINT); err != nil {
 				// If an error comes back from attempting to signal, proceed
 				// immediately to hard kill.
-				_ = c.Cmd.Process.Kill()
+				_ = signalProcessGroup(pgid, syscall.SIGKILL)
 			} else {
 				defer time.AfterFunc(time.Minute, func() {
-					_ = c.Cmd.Process.Kill()
+					_ = signalProcessGroup(pgid, syscall.SIGKILL)
 				}).Stop()
-				<-waitDone
 			}
+			<-waitDone
+			// While any members of the group remain, its id cannot be reused,
+			// so this cannot reach unrelated processes.
+			_ = signalProcessGroup(pgid, syscall.SIGKILL)
 		case <-waitDone:
 		}
 	}()
 
-	err := c.Cmd.Wait()
+	err = c.Cmd.Wait()
+	close(waitDone)
+	<-watchDone
+	<-readDone
 	return b.Bytes(), err
 }
+
+// signalProcessGroup sends sig to every process in the process group pgid.
+func signalProcessGroup(pgid int, sig syscall.Signal) error {
+	return syscall.Kill(-pgid, sig)
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCombinedOutputKillsProcessGroupOnCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pidfile := filepath.Join(dir, "pid")
+
+	// Background processes of a non-interactive shell ignore SIGINT, so the
+	// sleep outlives the shell unless its process group is killed.
+	ctx, cancel := context.WithCancel(context.Background())
+	c := commandContext(ctx, "sh", "-c", "sleep 60 & echo $! > "+pidfile+"; wait")
+
+	go func() {
+		for {
+			if _, err := os.Stat(pidfile); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		// Let the shell finish writing the file.
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		c.CombinedOutput()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("subprocess was not stopped on cancellation")
+	}
+
+	b, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The orphaned sleep may linger briefly until it is reaped.
+	for i := 0; i < 50; i++ {
+		if syscall.Kill(pid, 0) == syscall.ESRCH || isZombie(pid) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	syscall.Kill(pid, syscall.SIGKILL)
+	t.Errorf("descendant process %d survived cancellation", pid)
+}
+
+// isZombie reports whether pid has exited but not been reaped. It can only tell
+// where /proc is available.
+func isZombie(pid int) bool {
+	b, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name.
+	s := string(b)
+	i := strings.LastIndex(s, ")")
+	return i >= 0 && i+2 < len(s) && s[i+2] == 'Z'
+}
@@ -5,14 +5,116 @@
 package gps
 
 import (
+	"bytes"
 	"context"
 	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
 )
 
 type cmd struct {
-	*exec.Cmd
+	// ctx is provided by the caller; the subprocess and its descendants are
+	// terminated when it is cancelled.
+	ctx context.Context
+	Cmd *exec.Cmd
 }
 
 func commandContext(ctx context.Context, name string, arg ...string) cmd {
-	return cmd{Cmd: exec.CommandContext(ctx, name, arg...)}
+	return cmd{ctx: ctx, Cmd: exec.Command(name, arg...)}
+}
+
+// CombinedOutput is like (*os/exec.Cmd).CombinedOutput except that, when the
+// context is cancelled, it terminates not only the subprocess but also any
+// processes it has started in turn, such as the ssh or remote helper processes
+// started by git.
+//
+// This is done by assigning the subprocess to a job object. If that fails,
+// such as on versions of Windows that do not permit nested jobs, only the
+// subprocess itself is killed.
+func (c cmd) CombinedOutput() ([]byte, error) {
+	// Adapted from (*os/exec.Cmd).CombinedOutput
+	if c.Cmd.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	if c.Cmd.Stderr != nil {
+		return nil, errors.New("exec: Stderr already set")
+	}
+	var b bytes.Buffer
+	c.Cmd.Stdout = &b
+	c.Cmd.Stderr = &b
+	if err := c.Cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	job, jerr := newJobObject(c.Cmd.Process.Pid)
+	if jerr == nil {
+		defer job.close()
+	}
+
+	waitDone := make(chan struct{})
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		select {
+		case <-c.ctx.Done():
+			if jerr != nil || job.terminate() != nil {
+				_ = c.Cmd.Process.Kill()
+			}
+		case <-waitDone:
+		}
+	}()
+
+	err := c.Cmd.Wait()
+	close(waitDone)
+	<-watchDone
+	return b.Bytes(), err
+}
+
+const processSetQuota = 0x0100
+
+var (
+	modkernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = modkernel32.NewProc("CreateJobObjectW")
+	procAssignProcessToJobObject = modkernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = modkernel32.NewProc("TerminateJobObject")
+)
+
+// jobObject is a handle to a Windows job object, which allows a process and
+// all of its descendants to be terminated together.
+type jobObject syscall.Handle
+
+// newJobObject creates a job object and assigns the process pid to it.
+// Processes subsequently started by that process are assigned to it too.
+func newJobObject(pid int) (jobObject, error) {
+	j, _, err := procCreateJobObjectW.Call(0, 0)
+	if j == 0 {
+		return 0, wrapError(err, "failed to create job object")
+	}
+	job := jobObject(j)
+
+	h, err := syscall.OpenProcess(processSetQuota|syscall.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		job.close()
+		return 0, wrapErrorf(err, "failed to open process %d", pid)
+	}
+	defer syscall.CloseHandle(h)
+
+	if r, _, err := procAssignProcessToJobObject.Call(uintptr(job), uintptr(h)); r == 0 {
+		job.close()
+		return 0, wrapErrorf(err, "failed to assign process %d to job object", pid)
+	}
+	return job, nil
+}
+
+// terminate terminates every process in the job.
+func (j jobObject) terminate() error {
+	if r, _, err := procTerminateJobObject.Call(uintptr(j), 1); r == 0 {
+		return err
+	}
+	return nil
+}
+
+func (j jobObject) close() error {
+	return syscall.CloseHandle(syscall.Handle(j))
 }
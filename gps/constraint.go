@@ -6,10 +6,13 @@ package gps
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/Masterminds/semver"
 	"github.com/golang/dep/gps/internal/pb"
+	"github.com/pkg/errors"
 )
 
 var (
@@ -113,7 +116,7 @@ func unpairedVersionFromCache(m *pb.Constraint) (UnpairedVersion, error) {
 // If the input string cannot be made into a valid semver Constraint, an error
 // is returned.
 func NewSemverConstraint(body string) (Constraint, error) {
-	c, err := semver.NewConstraint(body)
+	c, err := semver.NewConstraint(expandHyphenRanges(body))
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +136,7 @@ func NewSemverConstraint(body string) (Constraint, error) {
 // If the input string cannot be made into a valid semver Constraint, an error
 // is returned.
 func NewSemverConstraintIC(body string) (Constraint, error) {
-	c, err := semver.NewConstraintIC(body)
+	c, err := semver.NewConstraintIC(expandHyphenRanges(body))
 	if err != nil {
 		return nil, err
 	}
@@ -145,6 +148,107 @@ func NewSemverConstraintIC(body string) (Constraint, error) {
 	return semverConstraint{c: c}, nil
 }
 
+// hyphenRange matches a hyphen range, such as "1.2.3 - 1.4.5", that makes up
+// the whole of one of the comma-separated parts of a semver range.
+var hyphenRange = regexp.MustCompile(`^(\s*\S+\s+-\s+)(\S+)(\s*)$`)
+
+// expandHyphenRanges rewrites each hyphen range in body whose upper bound is a
+// partial version, such as "1.2.3 - 2" or "1.2.3 - 2.3", to end in a wildcard
+// in place of what is missing, so that the range includes all of 2.x or 2.3.x
+// as it does in npm and cargo, rather than stopping at 2.0.0 or 2.3.0.
+func expandHyphenRanges(body string) string {
+	if !strings.Contains(body, " - ") {
+		return body
+	}
+
+	ors := strings.Split(body, "||")
+	for i, or := range ors {
+		parts := strings.Split(or, ",")
+		for j, part := range parts {
+			m := hyphenRange.FindStringSubmatch(part)
+			if m == nil {
+				continue
+			}
+			upper := m[2]
+			core := strings.TrimLeft(upper, "vV")
+			if strings.ContainsAny(core, "-+") {
+				// Prereleases and build metadata only follow full versions.
+				continue
+			}
+			nums := strings.Split(core, ".")
+			if len(nums) >= 3 {
+				continue
+			}
+			switch nums[len(nums)-1] {
+			case "x", "X", "*":
+				continue
+			}
+			parts[j] = m[1] + upper + ".x" + m[3]
+		}
+		ors[i] = strings.Join(parts, ",")
+	}
+	return strings.Join(ors, "||")
+}
+
+// rangeChars are those characters of semver ranges that git does not allow in
+// tag names, so that a body with any of them can only have been meant as a
+// range. Others, such as <, =, | and the comma, are allowed in tags.
+const rangeChars = "~^* "
+
+// ParseConstraint interprets body as the version field of a dep manifest is
+// interpreted. The empty string accepts any version. Otherwise, body is a
+// semver range, with ^ as the default operator, if it can be parsed as one,
+// and the plain version it names if not.
+//
+// A body that is not a valid semver range, but has characters that only a
+// range could have, such as a space or ^, is reported as an error rather than
+// taken for a plain version that can't exist.
+func ParseConstraint(body string) (Constraint, error) {
+	if body == "" {
+		return Any(), nil
+	}
+	c, err := NewSemverConstraintIC(body)
+	if err == nil {
+		return c, nil
+	}
+	if strings.ContainsAny(body, rangeChars) {
+		return nil, wrapErrorf(err, "%q is neither a valid semver range nor a plain version", body)
+	}
+	return plainVersion(body), nil
+}
+
+// FormatConstraint returns the string that ParseConstraint parses back into a
+// Constraint identical to c, for use as the version field of a dep manifest.
+// A paired version is formatted as its unpaired version alone.
+//
+// An error is returned if there is no such string: for a branch or revision,
+// which have fields of their own, for the constraint that matches nothing, and
+// for a plain version that would be parsed as a semver range instead.
+func FormatConstraint(c Constraint) (string, error) {
+	if pv, ok := c.(PairedVersion); ok {
+		c = pv.Unpair()
+	}
+
+	switch tc := c.(type) {
+	case nil, anyConstraint:
+		return "", nil
+	case noneConstraint:
+		return "", errors.New("no version field matches no versions")
+	case branchVersion:
+		return "", errors.Errorf("branch %s must be given as a branch, not a version", tc)
+	case Revision:
+		return "", errors.Errorf("revision %s must be given as a revision, not a version", tc)
+	case plainVersion:
+		if s := string(tc); s != "" && !strings.ContainsAny(s, rangeChars) {
+			if _, err := NewSemverConstraintIC(s); err != nil {
+				return s, nil
+			}
+		}
+		return "", errors.Errorf("version %q would be taken for a semver range", string(tc))
+	}
+	return c.ImpliedCaretString(), nil
+}
+
 type semverConstraint struct {
 	c semver.Constraint
 }
@@ -194,17 +298,16 @@ func (c semverConstraint) Intersect(c2 Constraint) Constraint {
 			return semverConstraint{c: rc}
 		}
 	case semVersion:
-		rc := c.c.Intersect(tc.sv)
-		if !semver.IsNone(rc) {
-			// If single version intersected with constraint, we know the result
-			// must be the single version, so just return it back out
+		// The intersection of a range with a single version is either that
+		// version or nothing. Unions of ranges report the version as their
+		// intersection with it unconditionally, so ask whether it matches.
+		if c.c.Matches(tc.sv) == nil {
 			return c2
 		}
 	case versionPair:
 		if tc2, ok := tc.v.(semVersion); ok {
-			rc := c.c.Intersect(tc2.sv)
-			if !semver.IsNone(rc) {
-				// same reasoning as previous case
+			// same reasoning as previous case
+			if c.c.Matches(tc2.sv) == nil {
 				return c2
 			}
 		}
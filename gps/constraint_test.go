@@ -6,6 +6,7 @@ package gps
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/golang/dep/gps/internal/pb"
@@ -675,6 +676,87 @@ func TestSemverConstraintOps(t *testing.T) {
 	}
 }
 
+func TestSemverConstraintUnionsAndHyphenRanges(t *testing.T) {
+	for _, tc := range []struct {
+		body      string
+		match, no []string
+	}{
+		{
+			body:  "^1.2.0 || ^3.0.0",
+			match: []string{"1.2.0", "1.9.9", "3.0.0", "3.4.5"},
+			no:    []string{"1.1.9", "2.0.0", "2.5.0", "4.0.0"},
+		},
+		{
+			body:  "1.2.3 - 1.4.5",
+			match: []string{"1.2.3", "1.3.0", "1.4.5"},
+			no:    []string{"1.2.2", "1.4.6"},
+		},
+		{
+			// A partial upper bound includes all that it leaves out.
+			body:  "1.2.3 - 2",
+			match: []string{"1.2.3", "2.0.0", "2.9.9"},
+			no:    []string{"1.2.2", "3.0.0"},
+		},
+		{
+			body:  "1.2.3 - 1.4",
+			match: []string{"1.4.0", "1.4.9"},
+			no:    []string{"1.5.0"},
+		},
+		{
+			body:  "1.2.3 - 1.4.x",
+			match: []string{"1.4.9"},
+			no:    []string{"1.5.0"},
+		},
+		{
+			body:  "1.0 - 1.1 || 2.1.0 - 2.2",
+			match: []string{"1.0.0", "1.1.7", "2.1.0", "2.2.3"},
+			no:    []string{"1.2.0", "2.0.0", "2.3.0"},
+		},
+	} {
+		c, err := ParseConstraint(tc.body)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %s", tc.body, err)
+			continue
+		}
+		for _, v := range tc.match {
+			sv := NewVersion(v)
+			if !c.Matches(sv) {
+				t.Errorf("%q (%s) should match %s", tc.body, c, v)
+			}
+			if c.Intersect(sv) != sv || !c.MatchesAny(sv) {
+				t.Errorf("%q (%s) intersected with %s should be %s, got %s", tc.body, c, v, v, c.Intersect(sv))
+			}
+			if pv := sv.Pair("abc123"); c.Intersect(pv) != pv {
+				t.Errorf("%q (%s) intersected with paired %s should be it, got %s", tc.body, c, v, c.Intersect(pv))
+			}
+		}
+		for _, v := range tc.no {
+			sv := NewVersion(v)
+			if c.Matches(sv) {
+				t.Errorf("%q (%s) should not match %s", tc.body, c, v)
+			}
+			if c.Intersect(sv) != none || c.MatchesAny(sv) || sv.MatchesAny(c) {
+				t.Errorf("%q (%s) intersected with %s should be none, got %s", tc.body, c, v, c.Intersect(sv))
+			}
+			if c.Intersect(sv.Pair("abc123")) != none {
+				t.Errorf("%q (%s) intersected with paired %s should be none", tc.body, c, v)
+			}
+		}
+	}
+
+	// Unions intersect with other ranges piecewise.
+	c1, _ := ParseConstraint("^1.2.0 || ^3.0.0")
+	c2, _ := ParseConstraint(">=1.5.0, <3.1.0")
+	want, _ := ParseConstraint(">=1.5.0, <2.0.0 || >=3.0.0, <3.1.0")
+	if got := c1.Intersect(c2); !got.identical(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	c2, _ = ParseConstraint("2.x")
+	if c1.MatchesAny(c2) {
+		t.Errorf("expected %s not to overlap %s", c1, c2)
+	}
+}
+
 func TestSemverConstraint_ImpliedCaret(t *testing.T) {
 	c, _ := NewSemverConstraintIC("1.0.0")
 
@@ -697,6 +779,46 @@ func TestSemverConstraint_ImpliedCaret(t *testing.T) {
 	}
 }
 
+func TestParseFormatConstraint(t *testing.T) {
+	for _, body := range []string{
+		"", "1.0.0", "=1.0.0", "~1.2.3", ">=1.0.0, <2.0.0", "1.x", "*",
+		"^1.2.3 || ^2.0", "1.2 - 1.4.5", "1.2 - 2", "!=1.0.0", "0.1.0-beta.1", "v1.2.3",
+		"release-1", "latest",
+	} {
+		c, err := ParseConstraint(body)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %s", body, err)
+			continue
+		}
+		s, err := FormatConstraint(c)
+		if err != nil {
+			t.Errorf("unexpected error formatting %q: %s", body, err)
+			continue
+		}
+		if c2, err := ParseConstraint(s); err != nil || !c2.identical(c) {
+			t.Errorf("%q was formatted as %q, which parses as %v (%v), not %v", body, s, c2, err, c)
+		}
+	}
+
+	for _, body := range []string{"release-1", "build=42", "<weird>", "a|b"} {
+		if c, err := ParseConstraint(body); err != nil || c != plainVersion(body) {
+			t.Errorf("expected %q to be a plain version, as it may be a tag, got %#v (%v)", body, c, err)
+		}
+	}
+	if _, err := ParseConstraint(">= 1.0 bad"); err == nil || !strings.Contains(err.Error(), "semver range") {
+		t.Errorf("expected an invalid range to be an error, got %v", err)
+	}
+
+	if s, err := FormatConstraint(NewVersion("v1.1.0").Pair("abc123")); err != nil || s != "=1.1.0" {
+		t.Errorf("expected a paired version to be formatted as its version, got %q (%v)", s, err)
+	}
+	for _, c := range []Constraint{none, NewBranch("master"), Revision("abc123"), plainVersion("1.x"), plainVersion("")} {
+		if s, err := FormatConstraint(c); err == nil {
+			t.Errorf("expected no version field for %#v, got %q", c, s)
+		}
+	}
+}
+
 func TestTypedConstraintString(t *testing.T) {
 	// Also tests typedVersionString(), as this nests down into that
 	rev := Revision("flooboofoobooo")
@@ -79,7 +79,14 @@ var (
 // Other helper regexes
 var (
 	scpSyntaxRe = regexp.MustCompile(`^([a-zA-Z0-9_]+)@([a-zA-Z0-9._-]+):(.*)$`)
-	pathvld     = regexp.MustCompile(`^([A-Za-z0-9-]+)(\.[A-Za-z0-9-]+)+(/[A-Za-z0-9-_.~]+)*$`)
+	pathvld     = regexp.MustCompile(`^` + pathvldHost + `(/` + pathvldElem + `)*$`)
+)
+
+// The host and element patterns that pathvld is built from, shared with
+// ValidateImportPath so that the two agree on what a valid path is.
+const (
+	pathvldHost = `([A-Za-z0-9-]+)(\.[A-Za-z0-9-]+)+`
+	pathvldElem = `[A-Za-z0-9-_.~]+`
 )
 
 func pathDeducerTrie() *deducerTrie {
@@ -487,7 +494,7 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSources
 	}
 
 	switch v[4] {
-	case "git", "hg", "bzr":
+	case "git", "hg", "bzr", "svn":
 		x := strings.SplitN(v[1], "/", 2)
 		// TODO(sdboyer) is this actually correct for bzr?
 		u.Host = x[0]
@@ -505,6 +512,8 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSources
 				return maybeSources{maybeBzrSource{url: u}}, nil
 			case "hg":
 				return maybeSources{maybeHgSource{url: u}}, nil
+			case "svn":
+				return maybeSources{maybeSvnSource{url: u}}, nil
 			}
 		}
 
@@ -528,6 +537,11 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSources
 			f = func(k int, u *url.URL) {
 				mb[k] = maybeHgSource{url: u}
 			}
+		case "svn":
+			schemes = svnSchemes
+			f = func(k int, u *url.URL) {
+				mb[k] = maybeSvnSource{url: u}
+			}
 		}
 
 		mb = make(maybeSources, len(schemes))
@@ -559,6 +573,21 @@ type deductionCoordinator struct {
 	mut      sync.RWMutex
 	rootxt   *radix.Tree
 	deducext *deducerTrie
+	// registries maps import path hosts to the base URLs of the Go module
+	// registries that serve their projects in place of upstream.
+	registries map[string]*url.URL
+	// athens, if non-nil, is the Athens proxy serving all projects that are
+	// not served by one of registries, and not excluded from it.
+	athens *athensProxy
+	// policy, if non-nil, denies deducing import paths beneath some
+	// prefixes.
+	policy *Policy
+	// proxyOnly is whether deductions that require go get metadata from the
+	// import path's host are refused.
+	proxyOnly bool
+	// how records how each completed deduction in rootxt was made, by root,
+	// for explaining it later.
+	how map[string]deductionHow
 }
 
 func newDeductionCoordinator(superv *supervisor) *deductionCoordinator {
@@ -566,6 +595,7 @@ func newDeductionCoordinator(superv *supervisor) *deductionCoordinator {
 		suprvsr:  superv,
 		rootxt:   radix.New(),
 		deducext: pathDeducerTrie(),
+		how:      make(map[string]deductionHow),
 	}
 
 	return dc
@@ -582,6 +612,9 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 	if err := dc.suprvsr.ctx.Err(); err != nil {
 		return pathDeduction{}, err
 	}
+	if err := dc.policy.checkImportPath(path); err != nil {
+		return pathDeduction{}, err
+	}
 
 	// First, check the rootxt to see if there's a prefix match - if so, we
 	// can return that and move on.
@@ -596,30 +629,43 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 			// Multiple calls have come in for a similar path shape during
 			// the window in which the HTTP request to retrieve go get
 			// metadata is in flight. Fold this request in with the existing
-			// one(s) by calling the deduction method, which will avoid
-			// duplication of work through a sync.Once.
+			// one(s) by calling the deduction method, which waits for the
+			// request in flight rather than duplicating its work.
+			dc.suprvsr.fold(ctHTTPMetadata, "")
 			return d.deduce(ctx, path)
 		}
 
 		panic(fmt.Sprintf("unexpected %T in deductionCoordinator.rootxt: %v", data, data))
 	}
 
-	// No match. Try known path deduction first.
+	// No match. Projects on hosts served by a registry are never retrieved
+	// from upstream, so check for those first.
+	if m, has := dc.registryFor(path); has {
+		pd, err := dc.deduceRegistryPath(ctx, m, path)
+		if err != nil {
+			return pathDeduction{}, err
+		}
+		dc.store(pd)
+		return pd, nil
+	}
+
+	// Try known path deduction next.
 	pd, err := dc.deduceKnownPaths(path)
 	if err == nil {
 		// Deduction worked; store it in the rootxt, send on retchan and
 		// terminate.
 		// FIXME(sdboyer) deal with changing path vs. root. Probably needs
 		// to be predeclared and reused in the hmd returnFunc
-		dc.mut.Lock()
-		dc.rootxt.Insert(pd.root, pd.mb)
-		dc.mut.Unlock()
+		dc.store(pd)
 		return pd, nil
 	}
 
 	if err != errNoKnownPathMatch {
 		return pathDeduction{}, err
 	}
+	if dc.proxyOnly {
+		return pathDeduction{}, &DirectAccessError{Path: path}
+	}
 
 	// The err indicates no known path matched. It's still possible that
 	// retrieving go get metadata might do the trick.
@@ -630,11 +676,7 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 		// pathDeduction if it succeeds in finding one. We process it
 		// back through the action channel to ensure serialized
 		// access to the rootxt map.
-		returnFunc: func(pd pathDeduction) {
-			dc.mut.Lock()
-			dc.rootxt.Insert(pd.root, pd.mb)
-			dc.mut.Unlock()
-		},
+		returnFunc: dc.store,
 	}
 
 	// Save the hmd in the rootxt so that calls checking on similar
@@ -647,12 +689,97 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 	return hmd.deduce(ctx, path)
 }
 
+// store holds on to the completed deduction pd, so that import paths beneath its
+// root are deduced without repeating the work.
+func (dc *deductionCoordinator) store(pd pathDeduction) {
+	dc.mut.Lock()
+	dc.rootxt.Insert(pd.root, pd.mb)
+	dc.how[pd.root] = pd.how
+	dc.mut.Unlock()
+}
+
+// explain deduces path as deduceRootPath does, and also reports how the
+// deduction was made, and whether it had already been made before.
+func (dc *deductionCoordinator) explain(ctx context.Context, path string) (pd pathDeduction, cached bool, err error) {
+	dc.mut.RLock()
+	prefix, data, has := dc.rootxt.LongestPrefix(path)
+	dc.mut.RUnlock()
+	if has && isPathPrefixOrEqual(prefix, path) {
+		_, cached = data.(maybeSources)
+	}
+
+	pd, err = dc.deduceRootPath(ctx, path)
+	if err != nil {
+		return pathDeduction{}, false, err
+	}
+	dc.mut.RLock()
+	pd.how = dc.how[pd.root]
+	dc.mut.RUnlock()
+	return pd, cached, nil
+}
+
+// cachedDeductions returns all the completed deductions currently held by the
+// coordinator, sorted by root. Deductions that are still in flight are omitted.
+func (dc *deductionCoordinator) cachedDeductions() []pathDeduction {
+	var pds []pathDeduction
+	dc.mut.RLock()
+	dc.rootxt.Walk(func(root string, data interface{}) bool {
+		if mb, ok := data.(maybeSources); ok {
+			pds = append(pds, pathDeduction{root: root, mb: mb})
+		}
+		return false
+	})
+	dc.mut.RUnlock()
+
+	// radix.Tree walks in lexical order, so pds is already sorted.
+	return pds
+}
+
+// invalidate drops all deductions, completed or in flight, for roots that
+// are equal to or beneath the given import path prefix, as well as any root
+// that itself contains the prefix. It returns the dropped roots.
+func (dc *deductionCoordinator) invalidate(prefix string) []string {
+	var roots []string
+	dc.mut.Lock()
+	if root, _, has := dc.rootxt.LongestPrefix(prefix); has && isPathPrefixOrEqual(root, prefix) {
+		roots = append(roots, root)
+	}
+	dc.rootxt.WalkPrefix(prefix, func(root string, _ interface{}) bool {
+		if isPathPrefixOrEqual(prefix, root) && (len(roots) == 0 || roots[0] != root) {
+			roots = append(roots, root)
+		}
+		return false
+	})
+	for _, root := range roots {
+		dc.rootxt.Delete(root)
+		delete(dc.how, root)
+	}
+	dc.mut.Unlock()
+
+	return roots
+}
+
+// purge drops all deductions, completed or in flight.
+func (dc *deductionCoordinator) purge() {
+	dc.mut.Lock()
+	dc.rootxt = radix.New()
+	dc.how = make(map[string]deductionHow)
+	dc.mut.Unlock()
+}
+
 // pathDeduction represents the results of a successful import path deduction -
 // a root path, plus a maybeSource that can be used to attempt to connect to
 // the source.
 type pathDeduction struct {
 	root string
 	mb   maybeSources
+	how  deductionHow
+}
+
+// deductionHow describes how a pathDeduction was made.
+type deductionHow struct {
+	by      string // What deduced the root, as described by DeductionExplanation.Deducer
+	network bool   // Whether deducing it took requests over the network
 }
 
 var errNoKnownPathMatch = errors.New("no known path match")
@@ -664,7 +791,7 @@ func (dc *deductionCoordinator) deduceKnownPaths(path string) (pathDeduction, er
 	}
 
 	// First, try the root path-based matches
-	if _, mtch, has := dc.deducext.LongestPrefix(path); has {
+	if prefix, mtch, has := dc.deducext.LongestPrefix(path); has {
 		root, err := mtch.deduceRoot(path)
 		if err != nil {
 			return pathDeduction{}, err
@@ -677,6 +804,7 @@ func (dc *deductionCoordinator) deduceKnownPaths(path string) (pathDeduction, er
 		return pathDeduction{
 			root: root,
 			mb:   mb,
+			how:  deductionHow{by: "known path rules for " + strings.TrimSuffix(prefix, "/")},
 		}, nil
 	}
 
@@ -691,85 +819,97 @@ func (dc *deductionCoordinator) deduceKnownPaths(path string) (pathDeduction, er
 		return pathDeduction{
 			root: root,
 			mb:   mb,
+			how:  deductionHow{by: "VCS extension in path"},
 		}, nil
 	}
 
 	return pathDeduction{}, errNoKnownPathMatch
 }
 
-type httpMetadataDeducer struct {
-	once       sync.Once
-	deduced    pathDeduction
-	deduceErr  error
-	basePath   string
-	returnFunc func(pathDeduction)
-	suprvsr    *supervisor
+// registryFor returns a maybeRegistrySource, lacking only its module, for the
+// registry serving path, if path is a plain import path that one serves. A
+// registry serving path's host takes precedence over an Athens proxy.
+func (dc *deductionCoordinator) registryFor(path string) (maybeRegistrySource, bool) {
+	if (len(dc.registries) == 0 && dc.athens == nil) || strings.Contains(path, "://") || scpSyntaxRe.MatchString(path) {
+		return maybeRegistrySource{}, false
+	}
+	host := path
+	if i := strings.Index(path, "/"); i != -1 {
+		host = path[:i]
+	}
+	if base, has := dc.registries[host]; has {
+		return maybeRegistrySource{base: base}, true
+	}
+	if dc.athens != nil && dc.athens.serves(path) {
+		return maybeRegistrySource{base: dc.athens.base, catalog: dc.athens.catalog}, true
+	}
+	return maybeRegistrySource{}, false
 }
 
-func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDeduction, error) {
-	hmd.once.Do(func() {
-		opath := path
-		u, path, err := normalizeURI(path)
+// deduceRegistryPath deduces the root of path, which is served by m's
+// registry. Roots on hosts with known path rules follow those rules;
+// elsewhere, the root is the longest prefix of path that the registry has a
+// module for.
+func (dc *deductionCoordinator) deduceRegistryPath(ctx context.Context, m maybeRegistrySource, path string) (pathDeduction, error) {
+	if prefix, mtch, has := dc.deducext.LongestPrefix(path); has {
+		root, err := mtch.deduceRoot(path)
 		if err != nil {
-			err = errors.Wrapf(err, "unable to normalize URI")
-			hmd.deduceErr = err
-			return
+			return pathDeduction{}, err
 		}
+		m.module = root
+		how := deductionHow{by: fmt.Sprintf("known path rules for %s, served by registry at %s", strings.TrimSuffix(prefix, "/"), m.base)}
+		return pathDeduction{root: root, mb: maybeSources{m}, how: how}, nil
+	}
 
-		pd := pathDeduction{}
-
-		// Make the HTTP call to attempt to retrieve go-get metadata
-		var root, vcs, reporoot string
-		err = hmd.suprvsr.do(ctx, path, ctHTTPMetadata, func(ctx context.Context) error {
-			root, vcs, reporoot, err = getMetadata(ctx, path, u.Scheme)
-			if err != nil {
-				err = errors.Wrapf(err, "unable to read metadata")
+	err := dc.suprvsr.do(ctx, path, ctHTTPMetadata, func(ctx context.Context) error {
+		for prefix := path; strings.Contains(prefix, "/"); prefix = prefix[:strings.LastIndex(prefix, "/")] {
+			rc, err := registryGet(ctx, m.base, prefix, "@v/list")
+			if err == nil {
+				rc.Close()
+				m.module = prefix
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
-			return err
-		})
-		if err != nil {
-			err = errors.Wrapf(err, "unable to deduce repository and source type for %q", opath)
-			hmd.deduceErr = err
-			return
 		}
-		pd.root = root
+		return errors.Errorf("registry at %s has no module for %q", registryModuleURL(m.base, ""), path)
+	})
+	if err != nil {
+		return pathDeduction{}, &DeductionError{Path: path, Err: err}
+	}
 
-		// If we got something back at all, then it supersedes the actual input for
-		// the real URL to hit
-		repoURL, err := url.Parse(reporoot)
-		if err != nil {
-			err = errors.Wrapf(err, "server returned bad URL in go-get metadata, reporoot=%q", reporoot)
-			hmd.deduceErr = err
-			return
-		}
+	how := deductionHow{by: fmt.Sprintf("modules listed by registry at %s", m.base), network: true}
+	return pathDeduction{root: m.module, mb: maybeSources{m}, how: how}, nil
+}
 
-		// If the input path specified a scheme, then try to honor it.
-		if u.Scheme != "" && repoURL.Scheme != u.Scheme {
-			// If the input scheme was http, but the go-get metadata
-			// nevertheless indicated https should be used for the repo, then
-			// trust the metadata and use https.
-			//
-			// To err on the secure side, do NOT allow the same in the other
-			// direction (https -> http).
-			if u.Scheme != "http" || repoURL.Scheme != "https" {
-				hmd.deduceErr = errors.Errorf("scheme mismatch for %q: input asked for %q, but go-get metadata specified %q", path, u.Scheme, repoURL.Scheme)
-				return
-			}
-		}
+type httpMetadataDeducer struct {
+	mu         sync.Mutex
+	done       bool
+	deduced    pathDeduction
+	deduceErr  error
+	basePath   string
+	returnFunc func(pathDeduction)
+	suprvsr    *supervisor
+}
 
-		switch vcs {
-		case "git":
-			pd.mb = maybeSources{maybeGitSource{url: repoURL}}
-		case "bzr":
-			pd.mb = maybeSources{maybeBzrSource{url: repoURL}}
-		case "hg":
-			pd.mb = maybeSources{maybeHgSource{url: repoURL}}
-		default:
-			hmd.deduceErr = errors.Errorf("unsupported vcs type %s in go-get metadata from %s", vcs, path)
-			return
-		}
+// deduce deduces path from its go-get metadata. Callers deducing the same path
+// at once wait on the first, and share its outcome, which is kept for later
+// callers; but if the first's ctx ended first, it alone fails, and the next
+// caller tries again.
+func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDeduction, error) {
+	hmd.mu.Lock()
+	defer hmd.mu.Unlock()
+	if hmd.done {
+		return hmd.deduced, hmd.deduceErr
+	}
 
-		hmd.deduced = pd
+	pd, err := hmd.fetch(ctx, path)
+	if err != nil && ctx.Err() != nil {
+		return pathDeduction{}, err
+	}
+	hmd.deduced, hmd.deduceErr, hmd.done = pd, err, true
+	if err == nil {
 		// All data is assigned for other goroutines that may be waiting. Now,
 		// send the pathDeduction back to the deductionCoordinator by calling
 		// the returnFunc. This will also remove the reference to this hmd in
@@ -781,9 +921,68 @@ func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDe
 		// request the same path before the pathDeduction can be processed, but
 		// after this hmd has been dereferenced from the trie.
 		hmd.returnFunc(pd)
+	}
+	return pd, err
+}
+
+// fetch retrieves and interprets the go-get metadata for path.
+func (hmd *httpMetadataDeducer) fetch(ctx context.Context, path string) (pathDeduction, error) {
+	opath := path
+	u, path, err := normalizeURI(path)
+	if err != nil {
+		return pathDeduction{}, wrapErrorf(err, "unable to normalize URI")
+	}
+
+	pd := pathDeduction{how: deductionHow{by: "go-get metadata", network: true}}
+
+	// Make the HTTP call to attempt to retrieve go-get metadata
+	var root, vcs, reporoot string
+	err = hmd.suprvsr.do(ctx, path, ctHTTPMetadata, func(ctx context.Context) error {
+		root, vcs, reporoot, err = getMetadata(ctx, path, u.Scheme)
+		if err != nil {
+			err = wrapErrorf(err, "unable to read metadata")
+		}
+		return err
 	})
+	if err != nil {
+		return pathDeduction{}, &DeductionError{Path: opath, Err: err}
+	}
+	pd.root = root
+
+	// If we got something back at all, then it supersedes the actual input for
+	// the real URL to hit
+	repoURL, err := url.Parse(reporoot)
+	if err != nil {
+		return pathDeduction{}, wrapErrorf(err, "server returned bad URL in go-get metadata, reporoot=%q", reporoot)
+	}
+
+	// If the input path specified a scheme, then try to honor it.
+	if u.Scheme != "" && repoURL.Scheme != u.Scheme {
+		// If the input scheme was http, but the go-get metadata
+		// nevertheless indicated https should be used for the repo, then
+		// trust the metadata and use https.
+		//
+		// To err on the secure side, do NOT allow the same in the other
+		// direction (https -> http).
+		if u.Scheme != "http" || repoURL.Scheme != "https" {
+			return pathDeduction{}, errors.Errorf("scheme mismatch for %q: input asked for %q, but go-get metadata specified %q", path, u.Scheme, repoURL.Scheme)
+		}
+	}
+
+	switch vcs {
+	case "git":
+		pd.mb = maybeSources{maybeGitSource{url: repoURL}}
+	case "bzr":
+		pd.mb = maybeSources{maybeBzrSource{url: repoURL}}
+	case "hg":
+		pd.mb = maybeSources{maybeHgSource{url: repoURL}}
+	case "svn":
+		pd.mb = maybeSources{maybeSvnSource{url: repoURL}}
+	default:
+		return pathDeduction{}, errors.Errorf("unsupported vcs type %s in go-get metadata from %s", vcs, path)
+	}
 
-	return hmd.deduced, hmd.deduceErr
+	return pd, nil
 }
 
 // normalizeURI takes a path string - which can be a plain import path, or a
@@ -845,12 +1044,12 @@ func doFetchMetadata(ctx context.Context, scheme, path string) (io.ReadCloser, e
 	case "https", "http":
 		req, err := http.NewRequest("GET", url, nil)
 		if err != nil {
-			return nil, errors.Wrapf(err, "unable to build HTTP request for URL %q", url)
+			return nil, wrapErrorf(err, "unable to build HTTP request for URL %q", url)
 		}
 
-		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		resp, err := httpClient.Do(req.WithContext(ctx))
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed HTTP request to URL %q", url)
+			return nil, wrapErrorf(err, "failed HTTP request to URL %q", url)
 		}
 
 		return resp.Body, nil
@@ -867,13 +1066,13 @@ func doFetchMetadata(ctx context.Context, scheme, path string) (io.ReadCloser, e
 func getMetadata(ctx context.Context, path, scheme string) (string, string, string, error) {
 	rc, err := fetchMetadata(ctx, path, scheme)
 	if err != nil {
-		return "", "", "", errors.Wrapf(err, "unable to fetch raw metadata")
+		return "", "", "", wrapErrorf(err, "unable to fetch raw metadata")
 	}
 	defer rc.Close()
 
 	imports, err := parseMetaGoImports(rc)
 	if err != nil {
-		return "", "", "", errors.Wrapf(err, "unable to parse go-import metadata")
+		return "", "", "", wrapErrorf(err, "unable to parse go-import metadata")
 	}
 	match := -1
 	for i, im := range imports {
@@ -9,8 +9,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -431,6 +434,16 @@ var pathDeductionFixtures = map[string][]pathDeductionFixture{
 				maybeHgSource{url: mkurl("http://foo-bar.com/baz.hg")},
 			},
 		},
+		{
+			in:   "foobar.com/baz.svn/sub",
+			root: "foobar.com/baz.svn",
+			mb: maybeSources{
+				maybeSvnSource{url: mkurl("https://foobar.com/baz.svn")},
+				maybeSvnSource{url: mkurl("http://foobar.com/baz.svn")},
+				maybeSvnSource{url: mkurl("svn://foobar.com/baz.svn")},
+				maybeSvnSource{url: mkurl("svn+ssh://foobar.com/baz.svn")},
+			},
+		},
 		{
 			in:   "git@foobar.com:baz.git",
 			root: "foobar.com/baz.git",
@@ -459,6 +472,13 @@ var pathDeductionFixtures = map[string][]pathDeductionFixture{
 				maybeHgSource{url: mkurl("https://foobar.com/baz.hg")},
 			},
 		},
+		{
+			in:   "svn://foobar.com/baz.svn",
+			root: "foobar.com/baz.svn",
+			mb: maybeSources{
+				maybeSvnSource{url: mkurl("svn://foobar.com/baz.svn")},
+			},
+		},
 		{
 			in:     "git://foobar.com/baz.hg",
 			root:   "foobar.com/baz.hg",
@@ -620,7 +640,7 @@ func TestVanityDeduction(t *testing.T) {
 			t.Run(fix.in, func(t *testing.T) {
 				t.Parallel()
 
-				pr, err := sm.DeduceProjectRoot(fix.in)
+				pr, err := sm.DeduceProjectRoot(context.Background(), fix.in)
 				if err != nil {
 					t.Errorf("Unexpected err on deducing project root: %s", err)
 					return
@@ -644,7 +664,7 @@ func TestVanityDeduction(t *testing.T) {
 					t.Errorf("Deduced repo ident does not match fixture:\n\t(GOT) %s\n\t(WNT) %s", goturl, wanturl)
 				}
 
-				urls, err := sm.SourceURLsForPath(fix.in)
+				urls, err := sm.SourceURLsForPath(context.Background(), fix.in)
 				if err != nil {
 					t.Errorf("Unexpected err on deducing source urls: %s", err)
 					return
@@ -679,3 +699,35 @@ func TestVanityDeductionSchemeMismatch(t *testing.T) {
 		t.Error("should have errored on scheme mismatch between input and go-get metadata")
 	}
 }
+
+func TestVanityDeductionCancellation(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprintf(w, `<meta name="go-import" content="%s/foo git https://example.com/foo">`, r.Host)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	dc := newDeductionCoordinator(newSupervisor(ctx))
+	path := srv.URL + "/foo"
+
+	// A caller that gives up first fails alone, without spoiling the
+	// deduction for those that come after it.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := dc.deduceRootPath(cctx, path); err == nil {
+		t.Fatal("expected deduction with a cancelled context to fail")
+	}
+
+	pd, err := dc.deduceRootPath(ctx, path)
+	if err != nil {
+		t.Fatalf("expected deduction to be retried after a cancelled one, got %s", err)
+	}
+	if want := strings.TrimPrefix(srv.URL, "http://") + "/foo"; pd.root != want {
+		t.Errorf("expected root %q, got %q", want, pd.root)
+	}
+	if hits != 1 {
+		t.Errorf("expected metadata to be retrieved once, got %d", hits)
+	}
+}
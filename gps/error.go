@@ -7,8 +7,130 @@ package gps
 import (
 	"bytes"
 	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Sentinels for the causes of failure that callers are most likely to want to
+// tell apart. Each is matched, by errors.Is, by the error type of the same
+// cause, which carries the details of the failure.
+var (
+	ErrSourceNotFound  = errors.New("source does not exist upstream")
+	ErrVersionNotFound = errors.New("version does not exist in source")
+	ErrPackageNotFound = errors.New("package does not exist within project")
+	ErrCannotDeduce    = errors.New("unable to deduce repository and source type")
 )
 
+// SourceNotFoundError is returned when a source does not exist upstream.
+type SourceNotFoundError struct {
+	Type string // The type of the source, such as "git".
+	URL  string // The upstream URL of the source.
+}
+
+func (e *SourceNotFoundError) Error() string {
+	return fmt.Sprintf("source does not exist upstream: %s: %s", e.Type, e.URL)
+}
+
+// Is reports whether target is ErrSourceNotFound.
+func (e *SourceNotFoundError) Is(target error) bool {
+	return target == ErrSourceNotFound
+}
+
+// VersionNotFoundError is returned when a version is sought in a source that
+// does not have it.
+type VersionNotFoundError struct {
+	Version Version
+	URL     string // The upstream URL of the source, if known.
+}
+
+func (e *VersionNotFoundError) Error() string {
+	return fmt.Sprintf("version %q does not exist in source", e.Version)
+}
+
+// Is reports whether target is ErrVersionNotFound.
+func (e *VersionNotFoundError) Is(target error) bool {
+	return target == ErrVersionNotFound
+}
+
+// PackageNotFoundError is returned when a package is sought in a version of a
+// project that does not have it.
+type PackageNotFoundError struct {
+	ImportPath string
+	Project    ProjectIdentifier
+}
+
+func (e *PackageNotFoundError) Error() string {
+	return fmt.Sprintf("package %s does not exist within project %s", e.ImportPath, e.Project)
+}
+
+// Is reports whether target is ErrPackageNotFound.
+func (e *PackageNotFoundError) Is(target error) bool {
+	return target == ErrPackageNotFound
+}
+
+// DeductionError is returned when the project root and source of an import
+// path cannot be deduced.
+type DeductionError struct {
+	Path string
+	Err  error // Why, such as a failure to retrieve go-get metadata. Never nil.
+}
+
+func (e *DeductionError) Error() string {
+	return fmt.Sprintf("unable to deduce repository and source type for %q: ", e.Path) + e.Err.Error()
+}
+
+// Is reports whether target is ErrCannotDeduce.
+func (e *DeductionError) Is(target error) bool {
+	return target == ErrCannotDeduce
+}
+
+// Unwrap returns Err.
+func (e *DeductionError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns Err, as the errors of github.com/pkg/errors do.
+func (e *DeductionError) Cause() error {
+	return e.Err
+}
+
+// wrappedError is an error with a message giving the context it occurred in.
+// Unlike the errors of github.com/pkg/errors, it can be unwrapped by both
+// errors.Cause and the standard library's errors.Is and errors.As, so gps
+// wraps the errors it returns with it, rather than with errors.Wrap, so that
+// the error types above can be found through them.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+// wrapError returns err with msg added before its own message, or nil if err
+// is nil, as errors.Wrap does.
+func wrapError(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	return &wrappedError{msg: msg, err: err}
+}
+
+// wrapErrorf returns err with a message, formatted from format and args, added
+// before its own, or nil if err is nil, as errors.Wrapf does.
+func wrapErrorf(err error, format string, args ...interface{}) error {
+	return wrapError(err, fmt.Sprintf(format, args...))
+}
+
+func (e *wrappedError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *wrappedError) Cause() error {
+	return e.err
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
 type errorSlice []error
 
 func (errs errorSlice) Error() string {
@@ -20,6 +142,11 @@ func (errs errorSlice) Error() string {
 	return buf.String()
 }
 
+// Unwrap returns the errors, so that errors.Is and errors.As find any of them.
+func (errs errorSlice) Unwrap() []error {
+	return errs
+}
+
 func (errs errorSlice) Format(f fmt.State, c rune) {
 	fmt.Fprintln(f)
 	for i, err := range errs {
@@ -32,3 +159,46 @@ func (errs errorSlice) Format(f fmt.State, c rune) {
 		}
 	}
 }
+
+// FailureCauses returns the errors that ultimately caused err, such as the error
+// returned from Solve: each failure of each version tried for a project, and
+// each failure to reach one of the sources tried for it. Errors not made up of
+// others are their own cause. The causes keep any messages they were wrapped
+// in.
+func FailureCauses(err error) []error {
+	var causes []error
+	var walk func(error)
+	walk = func(err error) {
+		switch e := errors.Cause(err).(type) {
+		case errorSlice:
+			for _, err := range e {
+				walk(err)
+			}
+		case DeductionErrs:
+			for _, err := range e {
+				walk(err)
+			}
+		case *noVersionError:
+			if len(e.fails) == 0 {
+				causes = append(causes, err)
+			}
+			for _, fv := range e.fails {
+				walk(fv.f)
+			}
+		default:
+			causes = append(causes, err)
+		}
+	}
+	if err != nil {
+		walk(err)
+	}
+	return causes
+}
+
+// IsSolveFailure reports whether err, or what it wraps, is the solver's account
+// of why versions could not meet their constraints, rather than a failure to
+// retrieve or analyze what it needed to try them.
+func IsSolveFailure(err error) bool {
+	_, ok := errors.Cause(err).(traceError)
+	return ok
+}
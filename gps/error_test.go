@@ -0,0 +1,125 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	stderrors "errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFailureCauses(t *testing.T) {
+	network := errors.Wrap(errors.New("Could not resolve host: example.com"), "unable to clone")
+	constraint := &disjointConstraintFailure{goal: dependency{depender: atom{id: mkPI("example.com/a")}}}
+	deduce := errors.New("unable to deduce repository and source type for \"example.com/c\"")
+	err := errors.Wrap(&noVersionError{
+		pn: ProjectIdentifier{ProjectRoot: "example.com/b"},
+		fails: []failedVersion{
+			{v: NewVersion("v1.0.0"), f: constraint},
+			{v: NewVersion("v0.9.0"), f: errors.Wrap(errorSlice{network, DeductionErrs{"example.com/c": deduce}}, "wrapped")},
+			{v: NewVersion("v0.8.0"), f: &noVersionError{pn: ProjectIdentifier{ProjectRoot: "example.com/d"}}},
+		},
+	}, "Solving failure")
+
+	causes := FailureCauses(err)
+	if len(causes) != 4 {
+		t.Fatalf("expected 4 causes, got %v", causes)
+	}
+	if causes[0] != error(constraint) || causes[1] != network || causes[2] != deduce {
+		t.Errorf("unexpected causes %v", causes)
+	}
+	if !IsSolveFailure(causes[0]) || !IsSolveFailure(causes[3]) || !IsSolveFailure(err) {
+		t.Error("expected the solver's failures to be reported as such")
+	}
+	if IsSolveFailure(network) {
+		t.Error("expected a failure to reach a source not to be a solve failure")
+	}
+
+	plain := errors.New("plain")
+	if causes := FailureCauses(plain); len(causes) != 1 || causes[0] != plain {
+		t.Errorf("expected a plain error to be its own cause, got %v", causes)
+	}
+	if causes := FailureCauses(nil); len(causes) != 0 {
+		t.Errorf("expected no causes of a nil error, got %v", causes)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	netErr := &url.Error{Op: "Get", URL: "https://example.com/c?go-get=1", Err: errors.New("i/o timeout")}
+	deduce := &DeductionError{Path: "example.com/c", Err: netErr}
+	notFound := &SourceNotFoundError{Type: "git", URL: "https://example.com/b"}
+	noVersion := &VersionNotFoundError{Version: NewVersion("v2.0.0")}
+	r := newRedactor([]string{"secret"}, nil)
+	err := wrapErrorf(&noVersionError{
+		pn: ProjectIdentifier{ProjectRoot: "example.com/a"},
+		fails: []failedVersion{
+			{v: NewVersion("v1.0.0"), f: errorSlice{wrapErrorf(notFound, "failed to list versions"), DeductionErrs{"example.com/c": deduce}}},
+			{v: NewVersion("v0.9.0"), f: r.redactErr(wrapErrorf(noVersion, "secret"))},
+		},
+	}, "solving failed")
+
+	for _, sentinel := range []error{ErrSourceNotFound, ErrVersionNotFound, ErrCannotDeduce} {
+		if !stderrors.Is(err, sentinel) {
+			t.Errorf("expected errors.Is to find %q", sentinel)
+		}
+	}
+	if stderrors.Is(err, ErrPackageNotFound) {
+		t.Errorf("did not expect errors.Is to find %q", ErrPackageNotFound)
+	}
+
+	var snf *SourceNotFoundError
+	if !stderrors.As(err, &snf) || snf != notFound {
+		t.Errorf("expected errors.As to find %v, got %v", notFound, snf)
+	}
+	var ue *url.Error
+	if !stderrors.As(err, &ue) || ue != netErr {
+		t.Errorf("expected errors.As to find the network failure under the deduction failure, got %v", ue)
+	}
+
+	// The errors of github.com/pkg/errors are still found the same way too.
+	if errors.Cause(wrapErrorf(notFound, "wrapped")) != error(notFound) {
+		t.Error("expected errors.Cause to unwrap a wrapped error")
+	}
+	if errors.Cause(deduce) != error(netErr) {
+		t.Error("expected errors.Cause to return what a DeductionError wraps")
+	}
+	if wrapErrorf(nil, "wrapped") != nil {
+		t.Error("expected wrapping a nil error to be nil")
+	}
+
+	// A DeductionError reads as the error it replaced did.
+	if want := errors.Wrapf(netErr, "unable to deduce repository and source type for %q", "example.com/c").Error(); deduce.Error() != want {
+		t.Errorf("expected DeductionError to read %q, got %q", want, deduce.Error())
+	}
+}
+
+func TestTypedErrorsThroughWriteDepTree(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writetree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l := solution{p: []LockedProject{NewLockedProject(mkPI("example.com/a"), NewVersion("v1.0.0").Pair("abc"), nil)}}
+	err = WriteDepTree(context.Background(), tmp, l, notFoundSM{}, defaultCascadingPruneOptions(), nil)
+	if !stderrors.Is(err, ErrVersionNotFound) {
+		t.Errorf("expected errors.Is to find %q through the failure to write, got %v", ErrVersionNotFound, err)
+	}
+}
+
+// notFoundSM is a SourceManager whose exports fail, as the version does not
+// exist.
+type notFoundSM struct {
+	SourceManager
+}
+
+func (notFoundSM) ExportProject(ctx context.Context, id ProjectIdentifier, v Version, to string) error {
+	return &VersionNotFoundError{Version: v}
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+// A SolveEvent is a step taken by the solver, as sent on the Events channel of
+// SolveParameters. It is one of ProjectSelected, VersionRejected, Backtracked
+// or SolveFinished.
+//
+// The events describe the same steps as the output of a TraceLogger, in the
+// same order, but as values to be inspected rather than text to be read.
+type SolveEvent interface {
+	solveEvent()
+}
+
+// ProjectSelected is sent when the solver selects a version of a project, or,
+// if PackagesOnly is set, when it adds more packages from a project it had
+// already selected.
+type ProjectSelected struct {
+	Project      ProjectIdentifier
+	Version      Version
+	Packages     []string
+	PackagesOnly bool
+}
+
+// VersionRejected is sent when a version of a project, or the packages to be
+// added from it if PackagesOnly is set, fail the solver's checks.
+type VersionRejected struct {
+	Project      ProjectIdentifier
+	Version      Version
+	PackagesOnly bool
+
+	// Reason is why the version was rejected. Most often it is one of the
+	// failures the solver reports when solving fails, describing the
+	// conflicting constraints or missing packages.
+	Reason error
+}
+
+// Backtracked is sent when the solver undoes the selection of a project, or,
+// if PackagesOnly is set, of some of the packages from one, to try another
+// version.
+type Backtracked struct {
+	Project      ProjectIdentifier
+	PackagesOnly bool
+}
+
+// SolveFinished is always the last event sent by a solving run, with the
+// results of Solve.
+type SolveFinished struct {
+	Solution Solution
+	Err      error
+}
+
+func (ProjectSelected) solveEvent() {}
+func (VersionRejected) solveEvent() {}
+func (Backtracked) solveEvent()     {}
+func (SolveFinished) solveEvent()   {}
+
+// emit sends e on the events channel, if there is one, unless the solving run
+// is canceled first.
+func (s *solver) emit(e SolveEvent) {
+	if s.events == nil {
+		return
+	}
+	select {
+	case s.events <- e:
+	case <-s.done:
+	}
+}
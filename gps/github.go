@@ -0,0 +1,313 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GitHubRateLimitError is returned by operations that use the GitHub API when
+// the rate limit of the token used for it has been exhausted, and does not
+// reset soon enough to wait for.
+type GitHubRateLimitError struct {
+	Host  string    // The GitHub host whose API was called.
+	Limit int       // The number of calls the token may make per window.
+	Reset time.Time // When calls may be made again.
+}
+
+func (e *GitHubRateLimitError) Error() string {
+	return fmt.Sprintf("GitHub API rate limit of %d calls for %s is exhausted until %s; wait until then, or use a token with a limit of its own",
+		e.Limit, e.Host, e.Reset.Format(time.RFC3339))
+}
+
+const (
+	// githubMaxWait is the longest githubAPI waits for a rate limit to reset,
+	// rather than failing with a *GitHubRateLimitError.
+	githubMaxWait = time.Minute
+	// githubPaceBelow is the fraction of a rate limit below which the calls
+	// remaining are spread out until it resets, rather than made at once.
+	githubPaceBelow = 10
+)
+
+// githubAPI makes calls to the APIs of GitHub hosts that it has tokens for,
+// tracking the rate limit of each token from the responses it gets.
+type githubAPI struct {
+	tokens map[string]string // API tokens, keyed by host
+	client *http.Client
+
+	mu     sync.Mutex
+	limits map[string]githubRateLimit // keyed by host
+}
+
+type githubRateLimit struct {
+	limit, remaining int
+	reset            time.Time
+}
+
+// newGitHubAPI returns a githubAPI for the hosts in tokens, or nil if there
+// are none.
+func newGitHubAPI(tokens map[string]string) *githubAPI {
+	if len(tokens) == 0 {
+		return nil
+	}
+	return &githubAPI{
+		tokens: tokens,
+		client: httpClient,
+		limits: make(map[string]githubRateLimit),
+	}
+}
+
+// serves reports whether u is the URL of a repository on a host that g has a
+// token for.
+func (g *githubAPI) serves(u *url.URL) bool {
+	_, _, ok := g.repository(u)
+	return ok
+}
+
+var githubRepoRegex = regexp.MustCompile(`^/([A-Za-z0-9][-A-Za-z0-9]*)/([A-Za-z0-9_.\-]+?)(?:\.git)?/?$`)
+
+// repository returns the host and the owner/name path of the repository at u,
+// if g has a token for its host.
+func (g *githubAPI) repository(u *url.URL) (host, repo string, ok bool) {
+	if _, has := g.tokens[u.Host]; !has {
+		return "", "", false
+	}
+	m := githubRepoRegex.FindStringSubmatch(u.Path)
+	if m == nil {
+		return "", "", false
+	}
+	return u.Host, m[1] + "/" + m[2], true
+}
+
+// githubAPIURL returns the base URL of the API of host. GitHub Enterprise
+// serves it beneath /api/v3 of the host itself.
+func githubAPIURL(host string) string {
+	if host == "github.com" {
+		return "https://api.github.com"
+	}
+	return "https://" + host + "/api/v3"
+}
+
+// listVersions lists the branches and tags of the repository at u through the
+// API, as `git ls-remote` would, keeping only the refs that refspecs match, if
+// there are any.
+func (g *githubAPI) listVersions(ctx context.Context, u *url.URL, refspecs []string) ([]PairedVersion, error) {
+	host, repo, ok := g.repository(u)
+	if !ok {
+		return nil, errors.Errorf("no GitHub API token for %s", u.Host)
+	}
+	base := githubAPIURL(host) + "/repos/" + repo
+
+	var info struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if _, err := g.get(ctx, host, base, &info); err != nil {
+		return nil, err
+	}
+
+	type ref struct {
+		Name   string `json:"name"`
+		Commit struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	list := func(kind string) ([]ref, error) {
+		var all []ref
+		next := base + "/" + kind + "?per_page=100"
+		for next != "" {
+			var page []ref
+			var err error
+			if next, err = g.get(ctx, host, next, &page); err != nil {
+				return nil, err
+			}
+			all = append(all, page...)
+		}
+		return all, nil
+	}
+	branches, err := list("branches")
+	if err != nil {
+		return nil, err
+	}
+	tags, err := list("tags")
+	if err != nil {
+		return nil, err
+	}
+
+	matches := func(ref string) bool {
+		return len(refspecs) == 0 || refspecsMatch(refspecs, ref)
+	}
+	vlist := make([]PairedVersion, 0, len(branches)+len(tags))
+	for _, b := range branches {
+		if matches("refs/heads/" + b.Name) {
+			v := branchVersion{name: b.Name, isDefault: b.Name == info.DefaultBranch}
+			vlist = append(vlist, v.Pair(Revision(b.Commit.SHA)))
+		}
+	}
+	// Tags are listed with the commits they point to, so, unlike with
+	// ls-remote, there are no annotated tag objects to see through.
+	for _, t := range tags {
+		if matches("refs/tags/" + t.Name) {
+			vlist = append(vlist, NewVersion(t.Name).Pair(Revision(t.Commit.SHA)))
+		}
+	}
+	return vlist, nil
+}
+
+// get calls the API of host at u, and decodes the response into v. It returns
+// the URL of the next page of results, if there is one.
+//
+// Calls are paced while the rate limit for host runs low, and wait for it to
+// reset if it has run out, unless that is too long to wait.
+func (g *githubAPI) get(ctx context.Context, host, u string, v interface{}) (string, error) {
+	for retried := false; ; retried = true {
+		if err := g.pace(ctx, host); err != nil {
+			return "", err
+		}
+
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return "", wrapErrorf(err, "unable to build GitHub API request for %s", host)
+		}
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		req.Header.Set("Authorization", "token "+g.tokens[host])
+		resp, err := g.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return "", wrapErrorf(err, "failed GitHub API request to %s", host)
+		}
+		exhausted := g.noteLimit(host, resp.Header)
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			err = json.NewDecoder(resp.Body).Decode(v)
+			resp.Body.Close()
+			if err != nil {
+				return "", wrapErrorf(err, "malformed GitHub API response from %s", host)
+			}
+			return githubNextPage(resp.Header.Get("Link")), nil
+		case exhausted && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests):
+			// The limit ran out since it was last checked; pace will now
+			// either wait for it to reset, or give up.
+			resp.Body.Close()
+			if retried {
+				return "", g.limitError(host)
+			}
+		default:
+			resp.Body.Close()
+			return "", errors.Errorf("GitHub API request to %s failed: %s", u, resp.Status)
+		}
+	}
+}
+
+// pace waits before a call to the API of host, as long as its rate limit
+// requires. If the limit has run out and does not reset within githubMaxWait,
+// it returns a *GitHubRateLimitError instead.
+func (g *githubAPI) pace(ctx context.Context, host string) error {
+	g.mu.Lock()
+	rl, has := g.limits[host]
+	g.mu.Unlock()
+	if !has {
+		return nil
+	}
+
+	until := time.Until(rl.reset)
+	var wait time.Duration
+	switch {
+	case until <= 0:
+		return nil
+	case rl.remaining == 0:
+		if until > githubMaxWait {
+			return g.limitError(host)
+		}
+		wait = until
+	case rl.remaining < rl.limit/githubPaceBelow:
+		// Spread the calls left evenly over the rest of the window.
+		wait = until / time.Duration(rl.remaining+1)
+		if wait > githubMaxWait {
+			wait = githubMaxWait
+		}
+	default:
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitError returns a *GitHubRateLimitError for the last recorded rate limit
+// of host.
+func (g *githubAPI) limitError(host string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	rl := g.limits[host]
+	return &GitHubRateLimitError{Host: host, Limit: rl.limit, Reset: rl.reset}
+}
+
+// noteLimit records the rate limit of host from the headers of a response,
+// and reports whether it has run out.
+func (g *githubAPI) noteLimit(host string, h http.Header) bool {
+	limit, lerr := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	remaining, rerr := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	reset, serr := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if lerr != nil || rerr != nil || serr != nil {
+		return false
+	}
+
+	g.mu.Lock()
+	g.limits[host] = githubRateLimit{limit: limit, remaining: remaining, reset: time.Unix(reset, 0)}
+	g.mu.Unlock()
+	return remaining == 0
+}
+
+// githubNextPage returns the URL of the next page from a Link header, if it
+// has one.
+func githubNextPage(link string) string {
+	for _, l := range strings.Split(link, ",") {
+		parts := strings.Split(l, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, p := range parts[1:] {
+			if strings.TrimSpace(p) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// maybeGitHubSource is a maybeSource whose git source lists its versions
+// through the GitHub API.
+type maybeGitHubSource struct {
+	maybeSource
+	api *githubAPI
+}
+
+func (m maybeGitHubSource) try(ctx context.Context, cachedir string) (source, error) {
+	src, err := m.maybeSource.try(ctx, cachedir)
+	if err != nil {
+		return nil, err
+	}
+	if gs, ok := src.(*gitSource); ok {
+		gs.github = m.api
+	}
+	return src, nil
+}
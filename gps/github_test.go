@@ -0,0 +1,210 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/test"
+)
+
+const (
+	ghRev1 = Revision("1111111111111111111111111111111111111111")
+	ghRev2 = Revision("2222222222222222222222222222222222222222")
+)
+
+// newTestGitHub returns a GitHub Enterprise API server for the repository
+// alice/a, and a githubAPI with a token for it. It reports remaining as the
+// calls left within the rate limit, and counts the calls made in calls.
+func newTestGitHub(t *testing.T, remaining int, calls *int32) (*httptest.Server, *githubAPI, *url.URL) {
+	var srv *httptest.Server
+	reply := func(w http.ResponseWriter, r *http.Request, body string) {
+		atomic.AddInt32(calls, 1)
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		if remaining == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, body)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/alice/a", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, r, `{"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/api/v3/repos/alice/a/branches", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "2" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/repos/alice/a/branches?page=2>; rel="next", <%[1]s/api/v3/repos/alice/a/branches?page=2>; rel="last"`, srv.URL))
+			reply(w, r, `[{"name":"main","commit":{"sha":"`+string(ghRev1)+`"}}]`)
+			return
+		}
+		reply(w, r, `[{"name":"dev","commit":{"sha":"`+string(ghRev2)+`"}}]`)
+	})
+	mux.HandleFunc("/api/v3/repos/alice/a/tags", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, r, `[{"name":"v1.0.0","commit":{"sha":"`+string(ghRev1)+`"}}]`)
+	})
+	srv = httptest.NewTLSServer(mux)
+
+	u, err := url.Parse(srv.URL + "/alice/a.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := newGitHubAPI(map[string]string{u.Host: "secret"})
+	api.client = srv.Client()
+	return srv, api, u
+}
+
+func TestGitHubListVersions(t *testing.T) {
+	var calls int32
+	srv, api, u := newTestGitHub(t, 4000, &calls)
+	defer srv.Close()
+
+	got, err := api.listVersions(context.Background(), u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PairedVersion{
+		newDefaultBranch("main").Pair(ghRev1),
+		NewBranch("dev").Pair(ghRev2),
+		NewVersion("v1.0.0").Pair(ghRev1),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected versions %v, got %v", want, got)
+	}
+
+	got, err = api.listVersions(context.Background(), u, []string{"+refs/tags/*:refs/tags/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := want[2:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected only the tags matching the refspec, %v, got %v", want, got)
+	}
+
+	if api.serves(&url.URL{Host: "github.com", Path: "/alice/a"}) {
+		t.Error("expected a host without a token not to be served")
+	}
+}
+
+func TestGitHubRateLimit(t *testing.T) {
+	var calls int32
+	srv, api, u := newTestGitHub(t, 0, &calls)
+	defer srv.Close()
+
+	_, err := api.listVersions(context.Background(), u, nil)
+	rerr, ok := err.(*GitHubRateLimitError)
+	if !ok {
+		t.Fatalf("expected a *GitHubRateLimitError, got %v", err)
+	}
+	if rerr.Host != u.Host || rerr.Limit != 5000 || time.Until(rerr.Reset) < 59*time.Minute {
+		t.Errorf("unexpected rate limit error: %+v", rerr)
+	}
+
+	// Once the limit is known to have run out, no more calls are made until
+	// it resets.
+	_, err = api.listVersions(context.Background(), u, nil)
+	if _, ok := err.(*GitHubRateLimitError); !ok {
+		t.Errorf("expected a *GitHubRateLimitError, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call before the limit was known to have run out, got %d", calls)
+	}
+}
+
+func TestGitHubRateLimitFallsBackToGit(t *testing.T) {
+	requiresBins(t, "git")
+
+	var calls int32
+	srv, api, u := newTestGitHub(t, 0, &calls)
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	cpath := h.Path("smcache")
+	os.Mkdir(filepath.Join(cpath, "sources"), 0777)
+
+	// The API server is no git server, so git can only list the versions
+	// from the mirror.
+	h.TempDir("mirror")
+	mirrorPath := h.Path("mirror")
+	h.RunGit(mirrorPath, "init")
+	h.RunGit(mirrorPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(mirrorPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(mirrorPath, "commit", "--allow-empty", `--message="Initial commit"`)
+
+	mb := maybeGitHubSource{
+		maybeSource: maybeMirroredSource{
+			maybeSource: maybeGitSource{url: u},
+			mirrors:     []string{"file://" + filepath.ToSlash(mirrorPath)},
+		},
+		api: api,
+	}
+	ctx := context.Background()
+	src, err := mb.try(ctx, cpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.(*gitSource).close()
+
+	pvlist, err := src.listVersions(ctx)
+	if err != nil {
+		t.Fatalf("expected versions to be listed with git once the rate limit ran out, got %v", err)
+	}
+	if len(pvlist) != 1 {
+		t.Errorf("expected the mirror's one branch, got %v", pvlist)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call to the API, got %d", calls)
+	}
+}
+
+func TestGitHubPace(t *testing.T) {
+	api := newGitHubAPI(map[string]string{"github.com": "secret"})
+	api.limits["github.com"] = githubRateLimit{limit: 5000, remaining: 9, reset: time.Now().Add(time.Second)}
+
+	start := time.Now()
+	if err := api.pace(context.Background(), "github.com"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("expected calls to be paced while the limit runs low, waited only %s", d)
+	}
+
+	api.limits["github.com"] = githubRateLimit{limit: 5000, remaining: 0, reset: time.Now().Add(time.Hour)}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, ok := api.pace(ctx, "github.com").(*GitHubRateLimitError); !ok {
+		t.Error("expected a limit that resets too late to wait for to fail")
+	}
+}
+
+func TestGitHubNextPage(t *testing.T) {
+	for link, want := range map[string]string{
+		"": "",
+		`<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`: "https://api.github.com/x?page=2",
+		`<https://api.github.com/x?page=1>; rel="prev"`:                                                "",
+	} {
+		if got := githubNextPage(link); got != want {
+			t.Errorf("githubNextPage(%q) = %q, want %q", link, got, want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpstest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"path"
+	"sort"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// Fixture declares projects, and the versions they have, for a SourceManager
+// to serve. A declaration of a version, such as
+//
+//	f.Version("example.com/a", gps.NewVersion("v1.0.0")).
+//		Constrain("example.com/b", c)
+//
+// says all that a solver needs to know of it: that example.com/a has a tag
+// v1.0.0, which depends on example.com/b within c.
+//
+// Versions must be declared before the SourceManager is made.
+type Fixture struct {
+	versions []*VersionSpec
+}
+
+// VersionSpec declares the contents of a single version of a project.
+type VersionSpec struct {
+	root    string
+	v       gps.PairedVersion
+	deps    gps.ProjectConstraints
+	pkgs    map[string][]string
+	files   map[string]string
+	lock    []gps.LockedProject
+	hasLock bool
+}
+
+// NewFixture creates an empty Fixture.
+func NewFixture() *Fixture {
+	return &Fixture{}
+}
+
+// Version declares that the project root has the version v. An unpaired v is
+// paired with a revision made up from root and v, so each version is at its
+// own revision unless given one; versions given the same revision are the
+// same code, and only the first to be declared should be given its contents.
+func (f *Fixture) Version(root string, v gps.Version) *VersionSpec {
+	var pv gps.PairedVersion
+	switch tv := v.(type) {
+	case gps.PairedVersion:
+		pv = tv
+	case gps.UnpairedVersion:
+		pv = tv.Pair(fakeRevision(root, tv))
+	default:
+		panic("gpstest: a fixture version must not be a bare revision")
+	}
+
+	vs := &VersionSpec{
+		root: root,
+		v:    pv,
+		deps: make(gps.ProjectConstraints),
+		pkgs: make(map[string][]string),
+	}
+	f.versions = append(f.versions, vs)
+	return vs
+}
+
+// fakeRevision makes up a revision for v of root, which looks like that of a
+// git commit.
+func fakeRevision(root string, v gps.Version) gps.Revision {
+	sum := sha1.Sum([]byte(root + "@" + v.String()))
+	return gps.Revision(hex.EncodeToString(sum[:]))
+}
+
+// Revision returns the revision of the version.
+func (vs *VersionSpec) Revision() gps.Revision {
+	return vs.v.Revision()
+}
+
+// Constrain declares that the version depends on the project root, within c.
+func (vs *VersionSpec) Constrain(root string, c gps.Constraint) *VersionSpec {
+	vs.deps[gps.ProjectRoot(root)] = gps.ProjectProperties{Constraint: c}
+	return vs
+}
+
+// Package declares a package of the version, with the import path ip, that
+// imports each of imports. If no packages are declared, the version has a
+// single package at its root, importing the root of each project it depends
+// on.
+func (vs *VersionSpec) Package(ip string, imports ...string) *VersionSpec {
+	vs.pkgs[ip] = imports
+	return vs
+}
+
+// File declares a file of the version, by its slash-separated path relative to
+// the project's root, to be written out when the version is exported.
+func (vs *VersionSpec) File(name, contents string) *VersionSpec {
+	if vs.files == nil {
+		vs.files = make(map[string]string)
+	}
+	vs.files[name] = contents
+	return vs
+}
+
+// Lock declares that the version has a lock, of the locked projects lps.
+func (vs *VersionSpec) Lock(lps ...gps.LockedProject) *VersionSpec {
+	vs.lock, vs.hasLock = lps, true
+	return vs
+}
+
+// packageTree returns the package tree the version declares.
+func (vs *VersionSpec) packageTree() pkgtree.PackageTree {
+	pkgs := vs.pkgs
+	if len(pkgs) == 0 {
+		var imports []string
+		for root := range vs.deps {
+			imports = append(imports, string(root))
+		}
+		sort.Strings(imports)
+		pkgs = map[string][]string{vs.root: imports}
+	}
+
+	ptree := pkgtree.PackageTree{
+		ImportRoot: vs.root,
+		Packages:   make(map[string]pkgtree.PackageOrErr, len(pkgs)),
+	}
+	for ip, imports := range pkgs {
+		ptree.Packages[ip] = pkgtree.PackageOrErr{P: pkgtree.Package{
+			Name:       path.Base(ip),
+			ImportPath: ip,
+			Imports:    imports,
+		}}
+	}
+	return ptree
+}
+
+// SourceManager returns a SourceManager serving the declared projects.
+func (f *Fixture) SourceManager() *SourceManager {
+	sm := &SourceManager{Projects: make(map[string]*Project)}
+	for _, vs := range f.versions {
+		p, has := sm.Projects[vs.root]
+		if !has {
+			p = &Project{
+				Manifests: make(map[gps.Revision]gps.Manifest),
+				Locks:     make(map[gps.Revision]gps.Lock),
+				Packages:  make(map[gps.Revision]pkgtree.PackageTree),
+				Files:     make(map[gps.Revision]map[string]string),
+			}
+			sm.Projects[vs.root] = p
+		}
+		p.Versions = append(p.Versions, vs.v)
+
+		r := vs.v.Revision()
+		if _, has := p.Packages[r]; has {
+			continue
+		}
+		p.Manifests[r] = gps.SimpleManifest{Deps: vs.deps}
+		p.Packages[r] = vs.packageTree()
+		if vs.files != nil {
+			p.Files[r] = vs.files
+		}
+		if vs.hasLock {
+			p.Locks[r] = gps.SimpleLock(vs.lock)
+		}
+	}
+	return sm
+}
+
+// RootManifest is a gps.RootManifest for the project being solved for in a
+// test.
+type RootManifest struct {
+	Deps     gps.ProjectConstraints
+	Ovr      gps.ProjectConstraints
+	Ignored  []string
+	Required []string
+}
+
+var _ gps.RootManifest = RootManifest{}
+
+// DependencyConstraints returns Deps.
+func (m RootManifest) DependencyConstraints() gps.ProjectConstraints {
+	return m.Deps
+}
+
+// Overrides returns Ovr.
+func (m RootManifest) Overrides() gps.ProjectConstraints {
+	return m.Ovr
+}
+
+// IgnoredPackages returns the ruleset of the Ignored import paths and patterns.
+func (m RootManifest) IgnoredPackages() *pkgtree.IgnoredRuleset {
+	return pkgtree.NewIgnoredRuleset(m.Ignored)
+}
+
+// RequiredPackages returns the Required import paths, as a set.
+func (m RootManifest) RequiredPackages() map[string]bool {
+	req := make(map[string]bool, len(m.Required))
+	for _, ip := range m.Required {
+		req[ip] = true
+	}
+	return req
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpstest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/dep/gps"
+)
+
+func TestFixture(t *testing.T) {
+	ctx := context.Background()
+	c1, _ := gps.NewSemverConstraintIC("v1.0.0")
+	c2, _ := gps.NewSemverConstraintIC("v2.0.0")
+
+	f := NewFixture()
+	f.Version("example.com/a", gps.NewVersion("v1.0.0")).Constrain("example.com/b", c1)
+	a2 := f.Version("example.com/a", gps.NewVersion("v1.1.0")).Constrain("example.com/b", c2)
+	f.Version("example.com/a", gps.NewBranch("master").Pair(a2.Revision()))
+	f.Version("example.com/b", gps.NewVersion("v1.0.0"))
+	f.Version("example.com/b", gps.NewVersion("v1.5.0")).
+		Package("example.com/b", "example.com/b/internal").
+		Package("example.com/b/internal")
+	f.Version("example.com/b", gps.NewVersion("v2.0.0")).
+		Constrain("example.com/c", gps.Any()).
+		File("b.go", "package b\n")
+	f.Version("example.com/c", gps.NewBranch("master"))
+	sm := f.SourceManager()
+
+	a := gps.ProjectIdentifier{ProjectRoot: "example.com/a"}
+	vl, err := sm.ListVersions(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vl) != 3 || vl[0].Revision() == vl[1].Revision() || vl[1].Revision() != vl[2].Revision() {
+		t.Errorf("expected v1.1.0 and master to share a revision, and v1.0.0 to have its own, got %v", vl)
+	}
+	m, _, err := sm.GetManifestAndLock(ctx, a, gps.NewBranch("master"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m.DependencyConstraints()["example.com/b"].Constraint; c.String() != c2.String() {
+		t.Errorf("expected master to have the constraints of v1.1.0, got %v", c)
+	}
+
+	b := gps.ProjectIdentifier{ProjectRoot: "example.com/b"}
+	pt, err := sm.ListPackages(ctx, b, gps.NewVersion("v1.5.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pt.Packages) != 2 {
+		t.Errorf("expected the declared packages, got %v", pt.Packages)
+	}
+
+	dir, err := ioutil.TempDir("", "gpstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Without an upper bound, the solver should upgrade through b to c.
+	params := gps.SolveParameters{
+		RootDir:         dir,
+		RootPackageTree: ptree("example.com/root", "example.com/a"),
+		Manifest:        RootManifest{Required: []string{"example.com/b"}},
+		ProjectAnalyzer: nullAnalyzer{},
+	}
+	s, err := gps.Prepare(params, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soln, err := s.Solve(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[gps.ProjectRoot]string)
+	for _, lp := range soln.Projects() {
+		got[lp.Ident().ProjectRoot] = lp.Version().String()
+	}
+	want := map[gps.ProjectRoot]string{"example.com/a": "v1.1.0", "example.com/b": "v2.0.0", "example.com/c": "master"}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected solution:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+	for root, v := range want {
+		if got[root] != v {
+			t.Errorf("expected %s at %s, got %s", root, v, got[root])
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpstest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// Case is a regression test of the solver: given a root project, and the
+// projects declared by a Fixture, it expects the same solution, or failure,
+// every time.
+type Case struct {
+	// Fixture declares the projects the root project may depend on.
+	Fixture *Fixture
+
+	// Root is the import path of the root project, and Imports the imports of
+	// its only package.
+	Root    string
+	Imports []string
+
+	// Manifest and Lock are those of the root project. Both are optional.
+	Manifest gps.RootManifest
+	Lock     gps.Lock
+
+	// ToChange, ChangeAll and Downgrade are as in gps.SolveParameters.
+	ToChange  []gps.ProjectRoot
+	ChangeAll bool
+	Downgrade bool
+}
+
+// Solve solves for the root project.
+func (c Case) Solve(ctx context.Context) (gps.Solution, error) {
+	dir, err := ioutil.TempDir("", "gpstest")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	params := gps.SolveParameters{
+		RootDir: dir,
+		RootPackageTree: pkgtree.PackageTree{
+			ImportRoot: c.Root,
+			Packages: map[string]pkgtree.PackageOrErr{
+				c.Root: {P: pkgtree.Package{
+					Name:       filepath.Base(c.Root),
+					ImportPath: c.Root,
+					Imports:    c.Imports,
+				}},
+			},
+		},
+		Manifest:        c.Manifest,
+		Lock:            c.Lock,
+		ToChange:        c.ToChange,
+		ChangeAll:       c.ChangeAll,
+		Downgrade:       c.Downgrade,
+		ProjectAnalyzer: nullAnalyzer{},
+	}
+	s, err := gps.Prepare(params, c.Fixture.SourceManager())
+	if err != nil {
+		return nil, err
+	}
+	return s.Solve(ctx)
+}
+
+// TB is the part of testing.TB that Golden reports through, so that importing
+// gpstest does not import the testing package along with it.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Golden solves for the root project, and fails t unless the solution, as
+// formatted by FormatLock, or the failure is as recorded in the golden file.
+// If update is true, the golden file is instead rewritten with whatever the
+// outcome was.
+func (c Case) Golden(t TB, golden string, update bool) {
+	t.Helper()
+
+	var got string
+	if soln, err := c.Solve(context.Background()); err != nil {
+		got = fmt.Sprintf("solve failed:\n%s\n", err)
+	} else {
+		got = FormatLock(soln)
+	}
+
+	if update {
+		if err := ioutil.WriteFile(golden, []byte(got), 0666); err != nil {
+			t.Fatalf("%s", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if got != string(want) {
+		t.Errorf("solution differs from %s:\n\t(GOT):\n%s\n\t(WNT):\n%s", golden, got, want)
+	}
+}
+
+// FormatLock formats a Lock as text for comparison, giving each project, in
+// order of its root, on a line of its own with its version and revision and
+// any source it is from, followed by a line for each of its packages.
+func FormatLock(l gps.Lock) string {
+	if l == nil {
+		return ""
+	}
+
+	lps := append([]gps.LockedProject(nil), l.Projects()...)
+	sort.Slice(lps, func(i, j int) bool {
+		return lps[i].Ident().Less(lps[j].Ident())
+	})
+
+	var buf bytes.Buffer
+	for _, lp := range lps {
+		id := lp.Ident()
+		fmt.Fprintf(&buf, "%s", id.ProjectRoot)
+		if id.Source != "" {
+			fmt.Fprintf(&buf, " (from %s)", id.Source)
+		}
+		rev, branch, version := gps.VersionComponentStrings(lp.Version())
+		if v := version + branch; v != "" {
+			fmt.Fprintf(&buf, " %s", v)
+		}
+		if rev != "" {
+			fmt.Fprintf(&buf, " %s", rev)
+		}
+		buf.WriteByte('\n')
+		for _, pkg := range lp.Packages() {
+			fmt.Fprintf(&buf, "\t%s\n", pkg)
+		}
+	}
+	return buf.String()
+}
+
+// nullAnalyzer finds nothing, leaving the SourceManager to provide each
+// project's manifest and lock.
+type nullAnalyzer struct{}
+
+func (nullAnalyzer) DeriveManifestAndLock(string, gps.ProjectRoot) (gps.Manifest, gps.Lock, error) {
+	return nil, nil, nil
+}
+
+func (nullAnalyzer) Info() gps.ProjectAnalyzerInfo {
+	return gps.ProjectAnalyzerInfo{Name: "gpstest", Version: 1}
+}
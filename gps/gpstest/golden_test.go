@@ -0,0 +1,64 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpstest
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/gps"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func goldenFixture() *Fixture {
+	c1, _ := gps.NewSemverConstraintIC("v1.0.0")
+	c2, _ := gps.NewSemverConstraintIC("v2.0.0")
+
+	f := NewFixture()
+	f.Version("example.com/a", gps.NewVersion("v1.0.0")).Constrain("example.com/b", c1)
+	f.Version("example.com/a", gps.NewVersion("v1.1.0")).Constrain("example.com/b", c2)
+	f.Version("example.com/b", gps.NewVersion("v1.0.0"))
+	f.Version("example.com/b", gps.NewVersion("v2.0.0")).
+		Package("example.com/b").
+		Package("example.com/b/sub")
+	f.Version("example.com/c", gps.NewBranch("master")).Constrain("example.com/b", c1)
+	return f
+}
+
+func TestGolden(t *testing.T) {
+	c1, _ := gps.NewSemverConstraintIC("v1.0.0")
+	cases := map[string]Case{
+		"upgrade": {
+			Imports: []string{"example.com/a"},
+		},
+		"downgrade": {
+			Imports:   []string{"example.com/a"},
+			Downgrade: true,
+		},
+		"overridden": {
+			Imports: []string{"example.com/a"},
+			Manifest: RootManifest{Ovr: gps.ProjectConstraints{
+				"example.com/b": {Constraint: c1},
+			}},
+		},
+		"conflict": {
+			Imports: []string{"example.com/c", "example.com/b/sub"},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			c.Fixture = goldenFixture()
+			c.Root = "example.com/root"
+			c.Golden(t, filepath.Join("testdata", name+".golden"), *update)
+		})
+	}
+
+	if got := FormatLock(nil); got != "" {
+		t.Errorf("expected nothing for no lock, got %q", got)
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gpstest provides a gps.SourceManager for use in tests, which answers
+// from data given to it up front instead of from the network, or any cache on
+// disk.
+package gpstest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// Project is the canned data for a single source.
+//
+// The manifest, lock, package tree and files of the project at a version are
+// all looked up by the revision that version is at, so that every version at
+// the same revision has the same contents, as with a real source.
+type Project struct {
+	// Versions are the versions the source has, as ListVersions returns them.
+	Versions []gps.PairedVersion
+
+	// Manifests and Locks are returned by GetManifestAndLock. A revision with
+	// no manifest has an empty one, and one with no lock has none.
+	Manifests map[gps.Revision]gps.Manifest
+	Locks     map[gps.Revision]gps.Lock
+
+	// Packages are returned by ListPackages. A revision with no package tree
+	// has an empty one.
+	Packages map[gps.Revision]pkgtree.PackageTree
+
+	// Files are written out by ExportProject and ExportPrunedProject, by path,
+	// slash-separated and relative to the project's root, to their contents.
+	Files map[gps.Revision]map[string]string
+}
+
+// revision returns the revision v is at in p, or an error if it is at none.
+func (p *Project) revision(v gps.Version) (gps.Revision, error) {
+	switch tv := v.(type) {
+	case gps.PairedVersion:
+		return tv.Revision(), nil
+	case gps.Revision:
+		if p.hasRevision(tv) {
+			return tv, nil
+		}
+	case gps.UnpairedVersion:
+		for _, pv := range p.Versions {
+			if pv.Type() == tv.Type() && pv.String() == tv.String() {
+				return pv.Revision(), nil
+			}
+		}
+	}
+	return "", &gps.VersionNotFoundError{Version: v}
+}
+
+// hasRevision reports whether p has anything at all at r.
+func (p *Project) hasRevision(r gps.Revision) bool {
+	for _, pv := range p.Versions {
+		if pv.Revision() == r {
+			return true
+		}
+	}
+	_, m := p.Manifests[r]
+	_, l := p.Locks[r]
+	_, t := p.Packages[r]
+	_, f := p.Files[r]
+	return m || l || t || f
+}
+
+// SourceManager is a gps.SourceManager that answers entirely from its fields.
+// Its fields must not be modified while it is in use, but its methods are safe
+// for concurrent use.
+type SourceManager struct {
+	// Projects are the sources the SourceManager knows of, keyed by the
+	// Source of a ProjectIdentifier or, for one with no Source, its
+	// ProjectRoot. Any other source does not exist.
+	Projects map[string]*Project
+
+	// Deductions map import paths to the project roots deduced from them.
+	// Paths that are not listed are deduced to be in the project whose key in
+	// Projects is the longest prefix of them, if any.
+	Deductions map[string]gps.ProjectRoot
+
+	mu       sync.Mutex
+	released bool
+}
+
+var _ gps.SourceManager = &SourceManager{}
+
+// project returns the project identified by id.
+func (sm *SourceManager) project(id gps.ProjectIdentifier) (*Project, error) {
+	sm.mu.Lock()
+	released := sm.released
+	sm.mu.Unlock()
+	if released {
+		return nil, gps.ErrSourceManagerIsReleased
+	}
+
+	src := id.Source
+	if src == "" {
+		src = string(id.ProjectRoot)
+	}
+	if p, has := sm.Projects[src]; has {
+		return p, nil
+	}
+	return nil, errors.Errorf("no source for %s", src)
+}
+
+// SourceExists reports whether there is a project for id.
+func (sm *SourceManager) SourceExists(ctx context.Context, id gps.ProjectIdentifier) (bool, error) {
+	if _, err := sm.project(id); err != nil {
+		if err == gps.ErrSourceManagerIsReleased {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// SyncSourceFor does nothing, as there is nothing to sync with, unless there
+// is no project for id.
+func (sm *SourceManager) SyncSourceFor(ctx context.Context, id gps.ProjectIdentifier) error {
+	_, err := sm.project(id)
+	return err
+}
+
+// ListVersions returns a copy of the Versions of the project for id.
+func (sm *SourceManager) ListVersions(ctx context.Context, id gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	p, err := sm.project(id)
+	if err != nil {
+		return nil, err
+	}
+	return append([]gps.PairedVersion(nil), p.Versions...), nil
+}
+
+// ListVersionsMatching returns the Versions of the project for id that satisfy
+// c, sorted for upgrade.
+func (sm *SourceManager) ListVersionsMatching(ctx context.Context, id gps.ProjectIdentifier, c gps.Constraint) ([]gps.PairedVersion, error) {
+	p, err := sm.project(id)
+	if err != nil {
+		return nil, err
+	}
+	var matching []gps.PairedVersion
+	for _, pv := range p.Versions {
+		if c.Matches(pv) {
+			matching = append(matching, pv)
+		}
+	}
+	gps.SortPairedForUpgrade(matching)
+	return matching, nil
+}
+
+// RevisionPresentIn reports whether any version of the project for id is at r,
+// or the project has any contents given for r.
+func (sm *SourceManager) RevisionPresentIn(ctx context.Context, id gps.ProjectIdentifier, r gps.Revision) (bool, error) {
+	p, err := sm.project(id)
+	if err != nil {
+		return false, err
+	}
+	return p.hasRevision(r), nil
+}
+
+// ListPackages returns the package tree of the project for id at v.
+func (sm *SourceManager) ListPackages(ctx context.Context, id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+	p, err := sm.project(id)
+	if err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	r, err := p.revision(v)
+	if err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	if ptree, has := p.Packages[r]; has {
+		return ptree, nil
+	}
+	return pkgtree.PackageTree{
+		ImportRoot: string(id.ProjectRoot),
+		Packages:   map[string]pkgtree.PackageOrErr{},
+	}, nil
+}
+
+// GetManifestAndLock returns the manifest and lock of the project for id at v.
+// The analyzer is not consulted.
+func (sm *SourceManager) GetManifestAndLock(ctx context.Context, id gps.ProjectIdentifier, v gps.Version, an gps.ProjectAnalyzer) (gps.Manifest, gps.Lock, error) {
+	p, err := sm.project(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := p.revision(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := p.Manifests[r]
+	if m == nil {
+		m = gps.SimpleManifest{}
+	}
+	return m, p.Locks[r], nil
+}
+
+// ExportProject writes the Files of the project for id at v to to.
+func (sm *SourceManager) ExportProject(ctx context.Context, id gps.ProjectIdentifier, v gps.Version, to string) error {
+	p, err := sm.project(id)
+	if err != nil {
+		return err
+	}
+	r, err := p.revision(v)
+	if err != nil {
+		return err
+	}
+	return writeFiles(p.Files[r], to)
+}
+
+// ExportPrunedProject writes the Files of the locked project to to, as
+// ExportProject does. The prune options are not applied.
+func (sm *SourceManager) ExportPrunedProject(ctx context.Context, lp gps.LockedProject, prune gps.PruneOptions, to string) error {
+	return sm.ExportProject(ctx, lp.Ident(), lp.Version(), to)
+}
+
+// writeFiles writes files into dir, creating it and any directories within it
+// as needed.
+func writeFiles(files map[string]string, dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeduceProjectRoot returns the project root ip is in, from Deductions or else
+// the keys of Projects.
+func (sm *SourceManager) DeduceProjectRoot(ctx context.Context, ip string) (gps.ProjectRoot, error) {
+	sm.mu.Lock()
+	released := sm.released
+	sm.mu.Unlock()
+	if released {
+		return "", gps.ErrSourceManagerIsReleased
+	}
+
+	if root, has := sm.Deductions[ip]; has {
+		return root, nil
+	}
+	var root string
+	for src := range sm.Projects {
+		if len(src) > len(root) && (ip == src || strings.HasPrefix(ip, src+"/")) {
+			root = src
+		}
+	}
+	if root == "" {
+		return "", &gps.DeductionError{Path: ip, Err: errors.New("no project in the fixture contains it")}
+	}
+	return gps.ProjectRoot(root), nil
+}
+
+// SourceURLsForPath returns the https URL of the project root ip is in.
+func (sm *SourceManager) SourceURLsForPath(ctx context.Context, ip string) ([]*url.URL, error) {
+	root, err := sm.DeduceProjectRoot(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse("https://" + string(root))
+	if err != nil {
+		return nil, err
+	}
+	return []*url.URL{u}, nil
+}
+
+// InferConstraint works out the kind of version s is, as the SourceMgr does,
+// from the Versions of the project for pi. Only full revisions are recognized.
+func (sm *SourceManager) InferConstraint(ctx context.Context, s string, pi gps.ProjectIdentifier) (gps.Constraint, error) {
+	if s == "" {
+		return gps.Any(), nil
+	}
+
+	versions, err := sm.ListVersions(ctx, pi)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list versions for %s", pi)
+	}
+	gps.SortPairedForUpgrade(versions)
+	var version gps.PairedVersion
+	for _, v := range versions {
+		if s == v.String() {
+			version = v
+			break
+		}
+	}
+
+	if version != nil && version.Type() == gps.IsBranch {
+		return version.Unpair(), nil
+	}
+	if c, err := gps.NewSemverConstraintIC(s); err == nil {
+		return c, nil
+	}
+	if version != nil {
+		return version.Unpair(), nil
+	}
+	if p, err := sm.project(pi); err == nil && p.hasRevision(gps.Revision(s)) {
+		return gps.Revision(s), nil
+	}
+
+	return nil, errors.Errorf("%s is not a valid version for the package %s(%s)", s, pi.ProjectRoot, pi.Source)
+}
+
+// Release makes all further calls to the SourceManager fail.
+func (sm *SourceManager) Release() {
+	sm.mu.Lock()
+	sm.released = true
+	sm.mu.Unlock()
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpstest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+func ptree(root string, imports ...string) pkgtree.PackageTree {
+	return pkgtree.PackageTree{
+		ImportRoot: root,
+		Packages: map[string]pkgtree.PackageOrErr{
+			root: {P: pkgtree.Package{
+				Name:       filepath.Base(root),
+				ImportPath: root,
+				Imports:    imports,
+			}},
+		},
+	}
+}
+
+func newSM() *SourceManager {
+	return &SourceManager{
+		Projects: map[string]*Project{
+			"example.com/a": {
+				Versions: []gps.PairedVersion{
+					gps.NewVersion("v1.0.0").Pair("reva1"),
+					gps.NewVersion("v1.1.0").Pair("reva2"),
+					gps.NewBranch("master").Pair("reva2"),
+				},
+				Packages: map[gps.Revision]pkgtree.PackageTree{
+					"reva1": ptree("example.com/a"),
+					"reva2": ptree("example.com/a", "example.com/b/sub"),
+				},
+				Files: map[gps.Revision]map[string]string{
+					"reva2": {"a.go": "package a\n", "sub/doc.go": "package sub\n"},
+				},
+			},
+			"example.com/b": {
+				Versions: []gps.PairedVersion{gps.NewVersion("v0.1.0").Pair("revb1")},
+				Packages: map[gps.Revision]pkgtree.PackageTree{
+					"revb1": ptree("example.com/b/sub"),
+				},
+			},
+		},
+		Deductions: map[string]gps.ProjectRoot{"vanity.example/a": "example.com/a"},
+	}
+}
+
+func TestSolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, _ := gps.NewSemverConstraintIC("v1.0.0")
+	params := gps.SolveParameters{
+		RootDir:         dir,
+		RootPackageTree: ptree("example.com/root", "example.com/a"),
+		Manifest: RootManifest{Deps: gps.ProjectConstraints{
+			"example.com/a": {Constraint: c},
+		}},
+		ProjectAnalyzer: nullAnalyzer{},
+	}
+	s, err := gps.Prepare(params, newSM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	soln, err := s.Solve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[gps.ProjectRoot]string{"example.com/a": "v1.1.0", "example.com/b": "v0.1.0"}
+	got := make(map[gps.ProjectRoot]string)
+	for _, lp := range soln.Projects() {
+		got[lp.Ident().ProjectRoot] = lp.Version().String()
+	}
+	if len(got) != len(want) || got["example.com/a"] != want["example.com/a"] || got["example.com/b"] != want["example.com/b"] {
+		t.Errorf("unexpected solution:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
+func TestSourceManager(t *testing.T) {
+	ctx := context.Background()
+	sm := newSM()
+	a := gps.ProjectIdentifier{ProjectRoot: "example.com/a"}
+
+	for ip, want := range map[string]gps.ProjectRoot{
+		"example.com/a":        "example.com/a",
+		"example.com/b/sub":    "example.com/b",
+		"vanity.example/a":     "example.com/a",
+		"example.com/abc":      "",
+		"example.com/missing":  "",
+		"vanity.example/a/sub": "",
+	} {
+		got, err := sm.DeduceProjectRoot(ctx, ip)
+		if got != want || (err == nil) != (want != "") {
+			t.Errorf("expected %s to be deduced to %q, got %q (%v)", ip, want, got, err)
+		}
+	}
+
+	if exists, _ := sm.SourceExists(ctx, gps.ProjectIdentifier{ProjectRoot: "example.com/c"}); exists {
+		t.Error("expected no source for a project not given")
+	}
+	if exists, _ := sm.SourceExists(ctx, gps.ProjectIdentifier{ProjectRoot: "vanity.example/a", Source: "example.com/a"}); !exists {
+		t.Error("expected a project to be found by its source")
+	}
+	if present, _ := sm.RevisionPresentIn(ctx, a, "reva1"); !present {
+		t.Error("expected reva1 to be present")
+	}
+
+	for s, want := range map[string]string{
+		"":       "*",
+		"master": "master",
+		"v1.0.0": "^1.0.0",
+		"reva1":  "reva1",
+	} {
+		c, err := sm.InferConstraint(ctx, s, a)
+		if err != nil || c.String() != want {
+			t.Errorf("expected %q to be inferred as %s, got %v (%v)", s, want, c, err)
+		}
+	}
+	if _, err := sm.InferConstraint(ctx, "nope", a); err == nil {
+		t.Error("expected an error inferring a constraint from nothing upstream has")
+	}
+
+	c, _ := gps.NewSemverConstraintIC("v1.0.0")
+	if pvl, err := sm.ListVersionsMatching(ctx, a, c); err != nil || len(pvl) != 2 || pvl[0].String() != "v1.1.0" {
+		t.Errorf("expected v1.1.0 and v1.0.0 to match ^1.0.0, newest first, got %v (%v)", pvl, err)
+	}
+
+	// Every version at a revision has the same contents.
+	if ptree, err := sm.ListPackages(ctx, a, gps.NewBranch("master")); err != nil || len(ptree.Packages["example.com/a"].P.Imports) != 1 {
+		t.Errorf("expected master to have the packages at reva2, got %v (%v)", ptree, err)
+	}
+	if _, err := sm.ListPackages(ctx, a, gps.NewBranch("dev")); err == nil {
+		t.Error("expected an error listing packages at a missing version")
+	}
+
+	dir, err := ioutil.TempDir("", "gpstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lp := gps.NewLockedProject(a, gps.NewVersion("v1.1.0").Pair("reva2"), nil)
+	if err := sm.ExportPrunedProject(ctx, lp, gps.PruneNestedVendorDirs, dir); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "sub", "doc.go")); err != nil || string(b) != "package sub\n" {
+		t.Errorf("expected sub/doc.go to be exported, got %q (%v)", b, err)
+	}
+
+	sm.Release()
+	if _, err := sm.ListVersions(ctx, a); err != gps.ErrSourceManagerIsReleased {
+		t.Errorf("expected ErrSourceManagerIsReleased after release, got %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dirhash holds the deterministic directory walking and file hashing
+// routines shared by gps' source layer and the verify package, so that digests
+// computed when exporting a project agree with those computed when verifying
+// it later.
+package dirhash
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FileHashVersion is an arbitrary number that identifies the hash algorithm
+// used for per-file digests.
+//
+//   1: SHA256, as implemented in crypto/sha256
+const FileHashVersion = 1
+
+// FileDigestsName is the name of the file, written into the root of an
+// exported project, that holds the per-file digest listing for that project.
+//
+// Walk never visits a file with this name, so its presence does not perturb
+// any digest computed over the directory that contains it.
+const FileDigestsName = ".dep-files"
+
+// LineEndingReader is a `io.Reader` that converts CRLF sequences to LF.
+//
+// When cloning or checking out repositories, some Version Control Systems,
+// VCSs, on some supported Go Operating System architectures, GOOS, will
+// automatically convert line endings that end in a single line feed byte, LF,
+// to line endings that end in a two byte sequence of carriage return, CR,
+// followed by LF. This LF to CRLF conversion would cause otherwise identical
+// versioned files to have different on disk contents simply based on which VCS
+// and GOOS are involved. Different file contents for the same file would cause
+// the resultant hashes to differ. In order to ensure file contents normalize
+// and produce the same hash, this structure wraps an io.Reader that modifies
+// the file's contents when it is read, translating all CRLF sequences to LF.
+type LineEndingReader struct {
+	src             io.Reader // source io.Reader from which this reads
+	prevReadEndedCR bool      // used to track whether final byte of previous Read was CR
+}
+
+// NewLineEndingReader returns a new LineEndingReader that reads from the
+// specified source io.Reader.
+func NewLineEndingReader(src io.Reader) *LineEndingReader {
+	return &LineEndingReader{src: src}
+}
+
+var crlf = []byte("\r\n")
+
+// Read consumes bytes from the structure's source io.Reader to fill the
+// specified slice of bytes. It converts all CRLF byte sequences to LF, and
+// handles cases where CR and LF straddle across two Read operations.
+func (f *LineEndingReader) Read(buf []byte) (int, error) {
+	buflen := len(buf)
+	if f.prevReadEndedCR {
+		// Read one fewer bytes so we have room if the first byte of the
+		// upcoming Read is not a LF, in which case we will need to insert
+		// trailing CR from previous read.
+		buflen--
+	}
+	nr, er := f.src.Read(buf[:buflen])
+	if nr > 0 {
+		if f.prevReadEndedCR && buf[0] != '\n' {
+			// Having a CRLF split across two Read operations is rare, so the
+			// performance impact of copying entire buffer to the right by one
+			// byte, while suboptimal, will at least will not happen very
+			// often. This negative performance impact is mitigated somewhat on
+			// many Go compilation architectures, GOARCH, because the `copy`
+			// builtin uses a machine opcode for performing the memory copy on
+			// possibly overlapping regions of memory. This machine opcodes is
+			// not instantaneous and does require multiple CPU cycles to
+			// complete, but is significantly faster than the application
+			// looping through bytes.
+			copy(buf[1:nr+1], buf[:nr]) // shift data to right one byte
+			buf[0] = '\r'               // insert the previous skipped CR byte at start of buf
+			nr++                        // pretend we read one more byte
+		}
+
+		// Remove any CRLF sequences in the buffer using `bytes.Index` because,
+		// like the `copy` builtin on many GOARCHs, it also takes advantage of a
+		// machine opcode to search for byte patterns.
+		var searchOffset int // index within buffer from whence the search will commence for each loop; set to the index of the end of the previous loop.
+		var shiftCount int   // each subsequenct shift operation needs to shift bytes to the left by one more position than the shift that preceded it.
+		previousIndex := -1  // index of previously found CRLF; -1 means no previous index
+		for {
+			index := bytes.Index(buf[searchOffset:nr], crlf)
+			if index == -1 {
+				break
+			}
+			index += searchOffset // convert relative index to absolute
+			if previousIndex != -1 {
+				// shift substring between previous index and this index
+				copy(buf[previousIndex-shiftCount:], buf[previousIndex+1:index])
+				shiftCount++ // next shift needs to be 1 byte to the left
+			}
+			previousIndex = index
+			searchOffset = index + 2 // start next search after len(crlf)
+		}
+		if previousIndex != -1 {
+			// handle final shift
+			copy(buf[previousIndex-shiftCount:], buf[previousIndex+1:nr])
+			shiftCount++
+		}
+		nr -= shiftCount // shorten byte read count by number of shifts executed
+
+		// When final byte from a read operation is CR, do not emit it until
+		// ensure first byte on next read is not LF.
+		if f.prevReadEndedCR = buf[nr-1] == '\r'; f.prevReadEndedCR {
+			nr-- // pretend byte was never read from source
+		}
+	} else if f.prevReadEndedCR {
+		// Reading from source returned nothing, but this struct is sitting on a
+		// trailing CR from previous Read, so let's give it to client now.
+		buf[0] = '\r'
+		nr = 1
+		er = nil
+		f.prevReadEndedCR = false // prevent infinite loop
+	}
+	return nr, er
+}
+
+// WalkFunc is the type of the function called by Walk for each file system
+// node it visits.
+//
+// osRelative is the os-specific pathname of the node relative to the walk root,
+// and is the empty string for the root itself. modeType is the type bits of the
+// node's mode; it is zero for regular files.
+type WalkFunc func(osPathname, osRelative string, modeType os.FileMode) error
+
+// Walk visits every file system node in the tree rooted at osDirname, in
+// lexical order, calling fn for each.
+//
+// Symbolic links are not visited, as they are not considered valid elements in
+// the definition of a Go module. Nodes named `vendor`, `.bzr`, `.git`, `.hg`,
+// and `.svn` are skipped along with all their children, as is the file named
+// FileDigestsName at the root, which lists the digests of the rest. Files of
+// that name elsewhere in the tree are visited like any other.
+func Walk(osDirname string, fn WalkFunc) error {
+	osDirname = filepath.Clean(osDirname)
+	dirLen := len(osDirname) + len(string(filepath.Separator))
+
+	return filepath.Walk(osDirname, func(osPathname string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Completely ignore symlinks.
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+
+		var osRelative string
+		if len(osPathname) > dirLen {
+			osRelative = osPathname[dirLen:]
+		}
+
+		switch filepath.Base(osRelative) {
+		case "vendor", ".bzr", ".git", ".hg", ".svn":
+			return filepath.SkipDir
+		}
+		if osRelative == FileDigestsName && !info.IsDir() {
+			return nil
+		}
+
+		return fn(osPathname, osRelative, info.Mode()&os.ModeType)
+	})
+}
+
+// CopyFile writes the contents of the file at osPathname to w, normalizing
+// line endings through a LineEndingReader, and returns the number of bytes
+// written. buf is used as scratch space for the copy.
+func CopyFile(w io.Writer, osPathname string, buf []byte) (int64, error) {
+	fh, err := os.Open(osPathname)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot Open")
+	}
+
+	n, err := io.CopyBuffer(w, NewLineEndingReader(fh), buf)
+	err = errors.Wrap(err, "cannot Copy") // errors.Wrap only wraps non-nil, so skip extra check
+
+	// Close the file handle to the open file without masking possible previous
+	// error value.
+	if er := fh.Close(); err == nil {
+		err = errors.Wrap(er, "cannot Close")
+	}
+	return n, err
+}
+
+// writeBytesWithNull appends the specified data to the specified hash, followed by
+// the NULL byte, in order to make accidental hash collisions less likely.
+func writeBytesWithNull(h hash.Hash, data []byte) {
+	// Ignore return values from writing to the hash, because hash write always
+	// returns nil error.
+	_, _ = h.Write(append(data, 0))
+}
+
+// FileDigests maps the slash-separated relative pathnames of the regular files
+// in a directory tree to the digests of their contents.
+type FileDigests map[string][]byte
+
+// DigestFiles computes the digest of every regular file visited by Walk in the
+// tree rooted at osDirname.
+//
+// Each digest covers the file's line ending-normalized contents and its
+// normalized size, so digests are stable across platforms and VCSs in the same
+// way as those computed for entire directories.
+func DigestFiles(osDirname string) (FileDigests, error) {
+	fd := make(FileDigests)
+	buf := make([]byte, 4*1024) // only allocate a single page
+	h := sha256.New()
+
+	err := Walk(osDirname, func(osPathname, osRelative string, modeType os.FileMode) error {
+		if modeType != 0 {
+			return nil
+		}
+
+		h.Reset()
+		n, err := CopyFile(h, osPathname, buf)
+		if err != nil {
+			return err
+		}
+		writeBytesWithNull(h, []byte(strconv.FormatInt(n, 10)))
+
+		fd[filepath.ToSlash(osRelative)] = h.Sum(nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fd, nil
+}
+
+// WriteTo writes the digest listing to w, one file per line in lexical order
+// of pathname. Each line contains the hash version and hex-encoded digest,
+// separated by a colon, then two spaces and the pathname.
+func (fd FileDigests) WriteTo(w io.Writer) (int64, error) {
+	paths := make([]string, 0, len(fd))
+	for path := range fd {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var total int64
+	for _, path := range paths {
+		n, err := fmt.Fprintf(w, "%d:%s  %s\n", FileHashVersion, hex.EncodeToString(fd[path]), path)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// ReadFileDigests parses a digest listing in the format written by
+// FileDigests.WriteTo.
+func ReadFileDigests(r io.Reader) (FileDigests, error) {
+	fd := make(FileDigests)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, errors.Errorf("malformed file digest line %q", line)
+		}
+		vd := strings.SplitN(parts[0], ":", 2)
+		if len(vd) != 2 {
+			return nil, errors.Errorf("malformed file digest line %q", line)
+		}
+		if vd[0] != strconv.Itoa(FileHashVersion) {
+			return nil, errors.Errorf("unsupported hash version %s for %s", vd[0], parts[1])
+		}
+		digest, err := hex.DecodeString(vd[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed digest for %s", parts[1])
+		}
+		fd[parts[1]] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fd, nil
+}
+
+// WriteFileDigests computes the per-file digests for the tree rooted at
+// osDirname and writes the listing into that directory, as FileDigestsName.
+func WriteFileDigests(osDirname string) error {
+	fd, err := DigestFiles(osDirname)
+	if err != nil {
+		return errors.Wrapf(err, "cannot compute file digests for %s", osDirname)
+	}
+
+	var buf bytes.Buffer
+	if _, err = fd.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	return errors.Wrap(ioutil.WriteFile(filepath.Join(osDirname, FileDigestsName), buf.Bytes(), 0666), "cannot write file digests")
+}
@@ -0,0 +1,244 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dirhash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// crossBuffer is a test io.Reader that emits a few canned responses.
+type crossBuffer struct {
+	readCount  int
+	iterations []string
+}
+
+func (cb *crossBuffer) Read(buf []byte) (int, error) {
+	if cb.readCount == len(cb.iterations) {
+		return 0, io.EOF
+	}
+	cb.readCount++
+	return copy(buf, cb.iterations[cb.readCount-1]), nil
+}
+
+func streamThruLineEndingReader(t *testing.T, iterations []string) []byte {
+	dst := new(bytes.Buffer)
+	n, err := io.Copy(dst, NewLineEndingReader(&crossBuffer{iterations: iterations}))
+	if got, want := err, error(nil); got != want {
+		t.Errorf("(GOT): %v; (WNT): %v", got, want)
+	}
+	if got, want := n, int64(dst.Len()); got != want {
+		t.Errorf("(GOT): %v; (WNT): %v", got, want)
+	}
+	return dst.Bytes()
+}
+
+func TestLineEndingReader(t *testing.T) {
+	testCases := []struct {
+		input  []string
+		output string
+	}{
+		{[]string{"\r"}, "\r"},
+		{[]string{"\r\n"}, "\n"},
+		{[]string{"now is the time\r\n"}, "now is the time\n"},
+		{[]string{"now is the time\r\n(trailing data)"}, "now is the time\n(trailing data)"},
+		{[]string{"now is the time\n"}, "now is the time\n"},
+		{[]string{"now is the time\r"}, "now is the time\r"},     // trailing CR ought to convey
+		{[]string{"\rnow is the time"}, "\rnow is the time"},     // CR not followed by LF ought to convey
+		{[]string{"\rnow is the time\r"}, "\rnow is the time\r"}, // CR not followed by LF ought to convey
+
+		// no line splits
+		{[]string{"first", "second", "third"}, "firstsecondthird"},
+
+		// 1->2 and 2->3 both break across a CRLF
+		{[]string{"first\r", "\nsecond\r", "\nthird"}, "first\nsecond\nthird"},
+
+		// 1->2 breaks across CRLF and 2->3 does not
+		{[]string{"first\r", "\nsecond", "third"}, "first\nsecondthird"},
+
+		// 1->2 breaks across CRLF and 2 ends in CR but 3 does not begin LF
+		{[]string{"first\r", "\nsecond\r", "third"}, "first\nsecond\rthird"},
+
+		// 1 ends in CR but 2 does not begin LF, and 2->3 breaks across CRLF
+		{[]string{"first\r", "second\r", "\nthird"}, "first\rsecond\nthird"},
+
+		// 1 ends in CR but 2 does not begin LF, and 2->3 does not break across CRLF
+		{[]string{"first\r", "second\r", "\nthird"}, "first\rsecond\nthird"},
+
+		// 1->2 and 2->3 both break across a CRLF, but 3->4 does not
+		{[]string{"first\r", "\nsecond\r", "\nthird\r", "fourth"}, "first\nsecond\nthird\rfourth"},
+		{[]string{"first\r", "\nsecond\r", "\nthird\n", "fourth"}, "first\nsecond\nthird\nfourth"},
+
+		{[]string{"this is the result\r\nfrom the first read\r", "\nthis is the result\r\nfrom the second read\r"},
+			"this is the result\nfrom the first read\nthis is the result\nfrom the second read\r"},
+		{[]string{"now is the time\r\nfor all good engineers\r\nto improve their test coverage!\r\n"},
+			"now is the time\nfor all good engineers\nto improve their test coverage!\n"},
+		{[]string{"now is the time\r\nfor all good engineers\r", "\nto improve their test coverage!\r\n"},
+			"now is the time\nfor all good engineers\nto improve their test coverage!\n"},
+	}
+
+	for _, testCase := range testCases {
+		got := streamThruLineEndingReader(t, testCase.input)
+		if want := []byte(testCase.output); !bytes.Equal(got, want) {
+			t.Errorf("Input: %#v; (GOT): %#q; (WNT): %#q", testCase.input, got, want)
+		}
+	}
+}
+
+func TestDigestFilesRoundTrip(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(cwd, "..", "..", "_testdata", "digest")
+
+	fd, err := DigestFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"github.com/alice/match/match.go",
+		"github.com/alice/mismatch/mismatch.go",
+		"github.com/alice/notInLock/notInLock.go",
+		"github.com/bob/emptyDigest/emptyDigest.go",
+		"github.com/bob/match/match.go",
+		"launchpad.net/match/match.go",
+	}
+	if len(fd) != len(want) {
+		t.Fatalf("expected %d file digests, got %d: %v", len(want), len(fd), fd)
+	}
+	for _, path := range want {
+		if len(fd[path]) == 0 {
+			t.Errorf("missing digest for %s", path)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err = fd.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFileDigests(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fd) {
+		t.Errorf("round trip mismatch:\n\t(GOT): %v\n\t(WNT): %v", got, fd)
+	}
+}
+
+func TestWriteFileDigestsExcludesListing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dirhash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\r\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteFileDigests(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	fh, err := os.Open(filepath.Join(dir, FileDigestsName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	listed, err := ReadFileDigests(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := DigestFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(listed, current) {
+		t.Errorf("listing should not include itself:\n\t(GOT): %v\n\t(WNT): %v", listed, current)
+	}
+
+	// Only the listing at the root is excluded; one elsewhere is a file like
+	// any other, so that tampering with it is noticed.
+	if err = os.Mkdir(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "sub", FileDigestsName), []byte("nested\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	nested, err := DigestFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, has := nested["sub/"+FileDigestsName]; !has || len(nested) != 2 {
+		t.Errorf("expected a nested listing to be digested, got %v", nested)
+	}
+	if err = os.RemoveAll(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Line endings are normalized, so a CRLF and LF variant hash the same.
+	if err = ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	current, err = DigestFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(listed, current) {
+		t.Errorf("expected line ending normalization:\n\t(GOT): %v\n\t(WNT): %v", current, listed)
+	}
+}
+
+func TestModuleHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dirhash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{
+		"a.go":            "package a\r\n",
+		"sub/b.go":        "package sub\n",
+		"nested/go.mod":   "module example.com/a/nested\n",
+		"nested/c.go":     "package nested\n",
+		"vendor/v/v.go":   "package v\n",
+		".git/HEAD":       "ref: refs/heads/master\n",
+		FileDigestsName:   "listing\n",
+		"sub/deeper/d.go": "package deeper\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only a.go, sub/b.go and sub/deeper/d.go belong in the module, and a.go
+	// keeps its CRLF.
+	summary := fmt.Sprintf("%x  example.com/a@v1.0.0/a.go\n%x  example.com/a@v1.0.0/sub/b.go\n%x  example.com/a@v1.0.0/sub/deeper/d.go\n",
+		sha256.Sum256([]byte("package a\r\n")), sha256.Sum256([]byte("package sub\n")), sha256.Sum256([]byte("package deeper\n")))
+	sum := sha256.Sum256([]byte(summary))
+	want := "h1:" + base64.StdEncoding.EncodeToString(sum[:])
+
+	got, err := ModuleHash(dir, "example.com/a", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dirhash
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ModuleHash computes the "h1:" hash that the go command, and checksum
+// databases such as sum.golang.org, record for version of module, from the
+// tree rooted at osDirname, an export of that version.
+//
+// The files hashed are those Walk visits, less any in directories holding
+// modules of their own, which mirrors what the go command puts in a module's
+// zip file. Unlike other digests, file contents are hashed as they are, without
+// normalizing line endings.
+func ModuleHash(osDirname, module, version string) (string, error) {
+	prefix := module + "@" + version + "/"
+	var names []string
+	paths := make(map[string]string)
+
+	err := Walk(osDirname, func(osPathname, osRelative string, modeType os.FileMode) error {
+		if modeType&os.ModeDir != 0 {
+			if osRelative != "" {
+				if _, err := os.Stat(filepath.Join(osPathname, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if modeType != 0 {
+			return nil
+		}
+
+		name := prefix + filepath.ToSlash(osRelative)
+		names = append(names, name)
+		paths[name] = osPathname
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(names)
+	summary := sha256.New()
+	for _, name := range names {
+		h := sha256.New()
+		if err := hashFile(h, paths[name]); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", h.Sum(nil), name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, osPathname string) error {
+	f, err := os.Open(osPathname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
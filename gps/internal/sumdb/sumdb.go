@@ -0,0 +1,363 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sumdb is a client for checksum databases, such as sum.golang.org,
+// that record the hashes of Go modules' versions in a transparency log.
+//
+// Each hash looked up is only trusted once the tree of the log has been found
+// to be signed by the database's key, and the record holding the hash has been
+// proven to be part of that tree.
+package sumdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned by Lookup when the database has no record of a
+// module's version.
+var ErrNotFound = errors.New("not found in checksum database")
+
+// tileHeight is the height of the tiles the log's hashes are served in.
+const tileHeight = 8
+
+// DB is a checksum database.
+type DB struct {
+	// Client is used to make requests to the database. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	url  *url.URL
+	name string
+	hash uint32
+	key  ed25519.PublicKey
+
+	mu    sync.Mutex
+	tiles map[string][]byte
+}
+
+// New returns a client for the checksum database whose verifier key is key,
+// as in "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+// served at rawurl. If rawurl is empty, it is https:// followed by the name
+// in key.
+func New(key, rawurl string) (*DB, error) {
+	parts := strings.SplitN(key, "+", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, errors.Errorf("malformed checksum database key %q", key)
+	}
+	name := parts[0]
+	hash, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil || len(parts[1]) != 8 {
+		return nil, errors.Errorf("malformed checksum database key %q", key)
+	}
+	kb, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(kb) != 1+ed25519.PublicKeySize || kb[0] != 1 {
+		return nil, errors.Errorf("malformed or unsupported checksum database key %q", key)
+	}
+	if keyHash(name, kb) != uint32(hash) {
+		return nil, errors.Errorf("checksum database key %q does not match its hash", key)
+	}
+
+	if rawurl == "" {
+		rawurl = "https://" + name
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("invalid checksum database URL %q", rawurl)
+	}
+
+	return &DB{
+		url:   u,
+		name:  name,
+		hash:  uint32(hash),
+		key:   ed25519.PublicKey(kb[1:]),
+		tiles: make(map[string][]byte),
+	}, nil
+}
+
+// Name returns the name of the database, as given in its key.
+func (db *DB) Name() string {
+	return db.name
+}
+
+// Lookup returns the hash that the database records for version of module,
+// such as "h1:8X1gzZpR+nVQLAht+L/foqOeX2l9DTZoaIPbEQHxsds=".
+func (db *DB) Lookup(ctx context.Context, module, version string) (string, error) {
+	body, err := db.get(ctx, "lookup/"+escape(module)+"@"+escape(version))
+	if err != nil {
+		return "", err
+	}
+
+	// The record's ID, the record, then the signed tree of the log.
+	malformed := errors.Errorf("malformed lookup response for %s@%s", module, version)
+	i := bytes.IndexByte(body, '\n')
+	if i < 0 {
+		return "", malformed
+	}
+	id, err := strconv.ParseInt(string(body[:i]), 10, 64)
+	if err != nil || id < 0 {
+		return "", malformed
+	}
+	rest := body[i+1:]
+	j := bytes.Index(rest, []byte("\n\n"))
+	if j < 0 {
+		return "", malformed
+	}
+	data, note := rest[:j+1], rest[j+2:]
+
+	size, root, err := db.verifyTree(note)
+	if err != nil {
+		return "", err
+	}
+	if id >= size {
+		return "", errors.Errorf("record %d for %s@%s is beyond the signed tree of %d records", id, module, version, size)
+	}
+	got, err := db.treeHash(ctx, size, 0, size, id, recordHash(data))
+	if err != nil {
+		return "", err
+	}
+	if got != root {
+		return "", errors.Errorf("record for %s@%s is not in the signed tree of the checksum database", module, version)
+	}
+
+	prefix := module + " " + version + " "
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimPrefix(line, prefix), nil
+		}
+	}
+	return "", errors.Errorf("record for %s@%s has no hash of it", module, version)
+}
+
+// verifyTree checks that note is signed by the database, and returns the size
+// and root hash of the tree it describes.
+func (db *DB) verifyTree(note []byte) (int64, [sha256.Size]byte, error) {
+	var root [sha256.Size]byte
+	i := bytes.LastIndex(note, []byte("\n\n"))
+	if i < 0 {
+		return 0, root, errors.New("malformed signed tree from checksum database")
+	}
+	text, sigs := note[:i+1], note[i+2:]
+
+	verified := false
+	for _, line := range strings.Split(string(sigs), "\n") {
+		if !strings.HasPrefix(line, "— ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "— "))
+		if len(fields) != 2 || fields[0] != db.name {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(sig) < 4 || binary.BigEndian.Uint32(sig) != db.hash {
+			continue
+		}
+		if ed25519.Verify(db.key, text, sig[4:]) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return 0, root, errors.Errorf("tree from checksum database is not signed by %s", db.name)
+	}
+
+	lines := strings.Split(string(text), "\n")
+	if len(lines) < 3 || lines[0] != "go.sum database tree" {
+		return 0, root, errors.New("malformed signed tree from checksum database")
+	}
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	hash, herr := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || size < 0 || herr != nil || len(hash) != sha256.Size {
+		return 0, root, errors.New("malformed signed tree from checksum database")
+	}
+	copy(root[:], hash)
+	return size, root, nil
+}
+
+// treeHash computes the hash of the records [lo, hi) in the log of size
+// records, using leaf as the hash of record id, and the hashes served by the
+// database for everything else. If the result is the signed root hash, then
+// record id is proven to be in the log.
+func (db *DB) treeHash(ctx context.Context, size, lo, hi, id int64, leaf [sha256.Size]byte) ([sha256.Size]byte, error) {
+	n := hi - lo
+	if n == 1 && lo == id {
+		return leaf, nil
+	}
+	if n&(n-1) == 0 && (id < lo || id >= hi) {
+		level := 0
+		for int64(1)<<uint(level) < n {
+			level++
+		}
+		return db.storedHash(ctx, size, level, lo>>uint(level))
+	}
+
+	// Split at the largest power of two less than n, as RFC 6962 does.
+	k := int64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	left, err := db.treeHash(ctx, size, lo, lo+k, id, leaf)
+	if err != nil {
+		return left, err
+	}
+	right, err := db.treeHash(ctx, size, lo+k, hi, id, leaf)
+	if err != nil {
+		return right, err
+	}
+	return nodeHash(left, right), nil
+}
+
+// storedHash returns the hash of the complete subtree at index of level, in
+// the log of size records, from the tile that holds it.
+func (db *DB) storedHash(ctx context.Context, size int64, level int, index int64) ([sha256.Size]byte, error) {
+	var h [sha256.Size]byte
+
+	// Tiles only hold every tileHeight-th level; hashes in between are
+	// computed from the level below them.
+	tl, within := level/tileHeight, uint(level%tileHeight)
+	first, count := index<<within, int64(1)<<within
+	tileIndex := first >> tileHeight
+	width := size>>uint(tl*tileHeight) - tileIndex<<tileHeight
+	if width > 1<<tileHeight {
+		width = 1 << tileHeight
+	}
+
+	tile, err := db.tile(ctx, tl, tileIndex, width)
+	if err != nil {
+		return h, err
+	}
+	start := (first - tileIndex<<tileHeight) * sha256.Size
+	end := start + count*sha256.Size
+	if end > int64(len(tile)) {
+		return h, errors.New("malformed tile from checksum database")
+	}
+
+	hashes := make([][sha256.Size]byte, count)
+	for i := range hashes {
+		copy(hashes[i][:], tile[start+int64(i)*sha256.Size:])
+	}
+	for len(hashes) > 1 {
+		for i := 0; i < len(hashes)/2; i++ {
+			hashes[i] = nodeHash(hashes[2*i], hashes[2*i+1])
+		}
+		hashes = hashes[:len(hashes)/2]
+	}
+	return hashes[0], nil
+}
+
+// tile returns the hashes held in a tile of the given width.
+func (db *DB) tile(ctx context.Context, level int, index, width int64) ([]byte, error) {
+	p := fmt.Sprintf("tile/%d/%d/%s", tileHeight, level, tileIndexPath(index))
+	if width < 1<<tileHeight {
+		p += fmt.Sprintf(".p/%d", width)
+	}
+
+	db.mu.Lock()
+	t, has := db.tiles[p]
+	db.mu.Unlock()
+	if has {
+		return t, nil
+	}
+
+	t, err := db.get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(t)) != width*sha256.Size {
+		return nil, errors.Errorf("malformed tile %s from checksum database", p)
+	}
+	db.mu.Lock()
+	db.tiles[p] = t
+	db.mu.Unlock()
+	return t, nil
+}
+
+func (db *DB) get(ctx context.Context, rel string) ([]byte, error) {
+	u := *db.url
+	u.Path = path.Join(u.Path, rel)
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to build HTTP request for %s", rel)
+	}
+	client := db.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed HTTP request to checksum database %s", db.name)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return nil, ErrNotFound
+	default:
+		return nil, errors.Errorf("checksum database %s failed to serve %s: %s", db.name, rel, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// tileIndexPath formats index as a tile's path does: in groups of three
+// digits, all but the last prefixed by "x".
+func tileIndexPath(index int64) string {
+	s := fmt.Sprintf("%03d", index%1000)
+	for index >= 1000 {
+		index /= 1000
+		s = fmt.Sprintf("x%03d/%s", index%1000, s)
+	}
+	return s
+}
+
+func keyHash(name string, key []byte) uint32 {
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte("\n"))
+	h.Write(key)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+func recordHash(data []byte) [sha256.Size]byte {
+	return sha256.Sum256(append([]byte{0x00}, data...))
+}
+
+func nodeHash(left, right [sha256.Size]byte) [sha256.Size]byte {
+	b := make([]byte, 0, 1+2*sha256.Size)
+	b = append(b, 0x01)
+	b = append(b, left[:]...)
+	b = append(b, right[:]...)
+	return sha256.Sum256(b)
+}
+
+// escape escapes a module path or version as the checksum database protocol
+// does: each upper case letter is replaced by an exclamation mark followed by
+// the letter in lower case.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sumdb
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testDB serves a log of records, signed by a key of its own.
+type testDB struct {
+	name    string
+	priv    ed25519.PrivateKey
+	key     string
+	records []string
+	// lookup maps escaped module@version paths to the IDs of their records.
+	lookup map[string]int
+}
+
+func newTestDB(t *testing.T, name string) *testDB {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb := append([]byte{1}, pub...)
+	return &testDB{
+		name:   name,
+		priv:   priv,
+		key:    fmt.Sprintf("%s+%08x+%s", name, keyHash(name, kb), base64.StdEncoding.EncodeToString(kb)),
+		lookup: make(map[string]int),
+	}
+}
+
+func (db *testDB) add(module, version, hash string) {
+	db.lookup[escape(module)+"@"+escape(version)] = len(db.records)
+	db.records = append(db.records, fmt.Sprintf("%s %s %s\n%s %s/go.mod h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n", module, version, hash, module, version))
+}
+
+// root computes the root hash of the log as RFC 6962 does.
+func (db *testDB) root(lo, hi int) [sha256.Size]byte {
+	if hi-lo == 1 {
+		return recordHash([]byte(db.records[lo]))
+	}
+	k := 1
+	for k<<1 < hi-lo {
+		k <<= 1
+	}
+	return nodeHash(db.root(lo, lo+k), db.root(lo+k, hi))
+}
+
+func (db *testDB) signedTree() string {
+	root := db.root(0, len(db.records))
+	text := fmt.Sprintf("go.sum database tree\n%d\n%s\n", len(db.records), base64.StdEncoding.EncodeToString(root[:]))
+	sig := make([]byte, 4, 4+ed25519.SignatureSize)
+	binary.BigEndian.PutUint32(sig, keyHashOf(db.key))
+	sig = append(sig, ed25519.Sign(db.priv, []byte(text))...)
+	return fmt.Sprintf("%s\n— %s %s\n", text, db.name, base64.StdEncoding.EncodeToString(sig))
+}
+
+func keyHashOf(key string) uint32 {
+	var h uint32
+	fmt.Sscanf(strings.SplitN(key, "+", 3)[1], "%08x", &h)
+	return h
+}
+
+// ServeHTTP serves lookups, and the level 0 tile, which is all a log of fewer
+// than 256 records needs.
+func (db *testDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/lookup/"):
+		id, has := db.lookup[strings.TrimPrefix(r.URL.Path, "/lookup/")]
+		if !has {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "%d\n%s\n%s", id, db.records[id], db.signedTree())
+	case r.URL.Path == fmt.Sprintf("/tile/8/0/000.p/%d", len(db.records)):
+		for i := range db.records {
+			h := recordHash([]byte(db.records[i]))
+			w.Write(h[:])
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tdb := newTestDB(t, "sum.example.com")
+	for i := 0; i < 7; i++ {
+		tdb.add(fmt.Sprintf("example.com/m%d", i), "v1.0.0", fmt.Sprintf("h1:hash%d=", i))
+	}
+	tdb.add("example.com/Upper", "v1.0.0", "h1:upper=")
+	srv := httptest.NewServer(tdb)
+	defer srv.Close()
+
+	db, err := New(tdb.key, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 7; i++ {
+		got, err := db.Lookup(ctx, fmt.Sprintf("example.com/m%d", i), "v1.0.0")
+		if err != nil {
+			t.Fatalf("unexpected error looking up record %d: %s", i, err)
+		}
+		if want := fmt.Sprintf("h1:hash%d=", i); got != want {
+			t.Errorf("expected %s for record %d, got %s", want, i, got)
+		}
+	}
+	if got, err := db.Lookup(ctx, "example.com/Upper", "v1.0.0"); err != nil || got != "h1:upper=" {
+		t.Errorf("expected the escaped module path to be looked up, got %q (%v)", got, err)
+	}
+	if _, err = db.Lookup(ctx, "example.com/missing", "v1.0.0"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// A record that isn't the one in the log must not be proven to be in it,
+	// even alongside the genuine tree.
+	forged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/lookup/") {
+			record := strings.Replace(tdb.records[3], "h1:hash3=", "h1:forged=", 1)
+			fmt.Fprintf(w, "3\n%s\n%s", record, tdb.signedTree())
+			return
+		}
+		tdb.ServeHTTP(w, r)
+	}))
+	defer forged.Close()
+	if db, err = New(tdb.key, forged.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Lookup(ctx, "example.com/m3", "v1.0.0"); err == nil {
+		t.Error("expected a forged record not to be proven to be in the log")
+	}
+}
+
+func TestLookupRejectsUnsignedTree(t *testing.T) {
+	tdb := newTestDB(t, "sum.example.com")
+	tdb.add("example.com/m", "v1.0.0", "h1:hash=")
+	srv := httptest.NewServer(tdb)
+	defer srv.Close()
+
+	// A database with another key, but the same name.
+	other := newTestDB(t, "sum.example.com")
+	db, err := New(other.key, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Lookup(context.Background(), "example.com/m", "v1.0.0"); err == nil {
+		t.Error("expected a tree signed by another key to be rejected")
+	}
+}
+
+func TestTileIndexPath(t *testing.T) {
+	for index, want := range map[int64]string{
+		5:       "005",
+		172640:  "x172/640",
+		1234567: "x001/x234/567",
+	} {
+		if got := tileIndexPath(index); got != want {
+			t.Errorf("tileIndexPath(%d): expected %q, got %q", index, want, got)
+		}
+	}
+}
@@ -204,6 +204,49 @@ func (lp lockedProject) String() string {
 		lp.Ident(), lp.Version(), lp.pkgs)
 }
 
+// Annotations are data that tools attach to a locked project, such as build or
+// review metadata, that gps attaches no meaning to.
+type Annotations map[string]string
+
+// AnnotatedProject is a LockedProject that carries Annotations.
+//
+// The solver returns the LockedProjects of its input Lock in a Solution, as
+// they are, for those projects it leaves unchanged. So the annotations of a
+// project are preserved through solving for as long as the project stays at
+// the same version, with the same packages; they are dropped when it changes.
+type AnnotatedProject interface {
+	LockedProject
+	Annotations() Annotations
+}
+
+type annotatedProject struct {
+	LockedProject
+	a Annotations
+}
+
+func (lp annotatedProject) Annotations() Annotations {
+	return lp.a
+}
+
+// Annotate returns lp with the annotations a, replacing any it had.
+func Annotate(lp LockedProject, a Annotations) LockedProject {
+	if alp, ok := lp.(annotatedProject); ok {
+		lp = alp.LockedProject
+	}
+	if len(a) == 0 {
+		return lp
+	}
+	return annotatedProject{LockedProject: lp, a: a}
+}
+
+// ProjectAnnotations returns the annotations of lp, or nil if it has none.
+func ProjectAnnotations(lp LockedProject) Annotations {
+	if alp, ok := lp.(AnnotatedProject); ok {
+		return alp.Annotations()
+	}
+	return nil
+}
+
 type safeLock struct {
 	p []LockedProject
 	i []string
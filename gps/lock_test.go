@@ -133,3 +133,26 @@ func TestLockedProjectsString(t *testing.T) {
 	}
 
 }
+
+func TestAnnotate(t *testing.T) {
+	lp := NewLockedProject(mkPI("foo"), NewVersion("v1.0.0").Pair("foorev"), []string{"."})
+	if a := ProjectAnnotations(lp); a != nil {
+		t.Errorf("expected no annotations, got %v", a)
+	}
+
+	alp := Annotate(lp, Annotations{"reviewed-by": "someone"})
+	if a := ProjectAnnotations(alp); !reflect.DeepEqual(a, Annotations{"reviewed-by": "someone"}) {
+		t.Errorf("unexpected annotations %v", a)
+	}
+	if !lp.Eq(alp) || alp.String() != lp.String() {
+		t.Error("expected annotations not to change the locked project")
+	}
+
+	alp = Annotate(alp, Annotations{"build": "42"})
+	if a := ProjectAnnotations(alp); !reflect.DeepEqual(a, Annotations{"build": "42"}) {
+		t.Errorf("expected annotations to be replaced, got %v", a)
+	}
+	if alp = Annotate(alp, nil); !reflect.DeepEqual(alp, lp) {
+		t.Errorf("expected removing the annotations to leave the locked project, got %#v", alp)
+	}
+}
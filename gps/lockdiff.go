@@ -0,0 +1,164 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"sort"
+	"strings"
+)
+
+// ProjectChange is a set of the ways in which a locked project can differ
+// between two Locks.
+type ProjectChange uint8
+
+// Each flag is one way in which a locked project can differ. A project that was
+// added or removed has no other changes.
+const (
+	ProjectAdded ProjectChange = 1 << iota
+	ProjectRemoved
+	VersionChanged  // The version, or branch, it is locked to changed.
+	RevisionChanged // The revision it is locked to changed.
+	SourceChanged   // The source it is retrieved from changed.
+	PackagesChanged // The packages used from it changed.
+)
+
+// LockDiff is the set of differences between two Locks, project by project.
+type LockDiff struct {
+	Projects []ProjectDiff // Only those projects that differ, ordered by root.
+}
+
+// Changed reports whether any project differs in any of the ways in c.
+func (d LockDiff) Changed(c ProjectChange) bool {
+	for _, pd := range d.Projects {
+		if pd.Changes&c != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectDiff describes how a single project differs between two Locks.
+type ProjectDiff struct {
+	Root    ProjectRoot
+	Changes ProjectChange
+
+	// Old and New are the project as locked in each of the Locks, Old being
+	// nil if the project was added, and New if it was removed.
+	Old, New LockedProject
+
+	// PackagesAdded and PackagesRemoved are the packages now used from the
+	// project, or no longer, in sorted order. All of the packages of a project
+	// that was added or removed are counted.
+	PackagesAdded, PackagesRemoved []string
+}
+
+// Has reports whether the project differs in any of the ways in c.
+func (d ProjectDiff) Has(c ProjectChange) bool {
+	return d.Changes&c != 0
+}
+
+// DiffLocks compares old and new, and returns the differences between them. A
+// nil Lock is treated as an empty one.
+func DiffLocks(old, new Lock) LockDiff {
+	var p1, p2 []LockedProject
+	if old != nil {
+		p1 = sortLockedProjects(old.Projects())
+	}
+	if new != nil {
+		p2 = sortLockedProjects(new.Projects())
+	}
+
+	var diff LockDiff
+	var i1, i2 int
+	for i1 < len(p1) || i2 < len(p2) {
+		var cmp int
+		switch {
+		case i1 == len(p1):
+			cmp = +1
+		case i2 == len(p2):
+			cmp = -1
+		default:
+			cmp = strings.Compare(string(p1[i1].Ident().ProjectRoot), string(p2[i2].Ident().ProjectRoot))
+		}
+
+		switch cmp {
+		case -1:
+			lp := p1[i1]
+			diff.Projects = append(diff.Projects, ProjectDiff{
+				Root:            lp.Ident().ProjectRoot,
+				Changes:         ProjectRemoved,
+				Old:             lp,
+				PackagesRemoved: sortedPackages(lp),
+			})
+			i1++
+		case +1:
+			lp := p2[i2]
+			diff.Projects = append(diff.Projects, ProjectDiff{
+				Root:          lp.Ident().ProjectRoot,
+				Changes:       ProjectAdded,
+				New:           lp,
+				PackagesAdded: sortedPackages(lp),
+			})
+			i2++
+		default:
+			if pd := DiffLockedProjects(p1[i1], p2[i2]); pd.Changes != 0 {
+				diff.Projects = append(diff.Projects, pd)
+			}
+			i1++
+			i2++
+		}
+	}
+	return diff
+}
+
+// DiffLockedProjects returns the differences between two locked versions of
+// the same project. Its Changes are zero if there are none.
+func DiffLockedProjects(lp1, lp2 LockedProject) ProjectDiff {
+	pd := ProjectDiff{Root: lp1.Ident().ProjectRoot, Old: lp1, New: lp2}
+
+	if lp1.Ident().Source != lp2.Ident().Source {
+		pd.Changes |= SourceChanged
+	}
+	r1, b1, v1 := VersionComponentStrings(lp1.Version())
+	r2, b2, v2 := VersionComponentStrings(lp2.Version())
+	if b1 != b2 || v1 != v2 {
+		pd.Changes |= VersionChanged
+	}
+	if r1 != r2 {
+		pd.Changes |= RevisionChanged
+	}
+
+	pkgs1, pkgs2 := sortedPackages(lp1), sortedPackages(lp2)
+	var i1, i2 int
+	for i1 < len(pkgs1) || i2 < len(pkgs2) {
+		switch {
+		case i2 == len(pkgs2) || (i1 < len(pkgs1) && pkgs1[i1] < pkgs2[i2]):
+			pd.PackagesRemoved = append(pd.PackagesRemoved, pkgs1[i1])
+			i1++
+		case i1 == len(pkgs1) || pkgs2[i2] < pkgs1[i1]:
+			pd.PackagesAdded = append(pd.PackagesAdded, pkgs2[i2])
+			i2++
+		default:
+			i1++
+			i2++
+		}
+	}
+	if len(pd.PackagesAdded) > 0 || len(pd.PackagesRemoved) > 0 {
+		pd.Changes |= PackagesChanged
+	}
+	return pd
+}
+
+// sortedPackages returns the packages of lp in sorted order, copying them if
+// they are not already.
+func sortedPackages(lp LockedProject) []string {
+	pkgs := lp.Packages()
+	if sort.StringsAreSorted(pkgs) {
+		return pkgs
+	}
+	pkgs = append([]string(nil), pkgs...)
+	sort.Strings(pkgs)
+	return pkgs
+}
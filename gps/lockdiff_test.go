@@ -0,0 +1,60 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLocks(t *testing.T) {
+	l1 := SimpleLock{
+		NewLockedProject(mkPI("github.com/sdboyer/gps"), NewVersion("v0.10.0").Pair("278a227dfc3d595a33a77ff3f841fd8ca1bc8cd0"), []string{"."}),
+		NewLockedProject(mkPI("github.com/sdboyer/gps2"), NewVersion("v1.0.0").Pair("bb2a1b8b5b6a1a7b11d7ed5d1b0e4f0a2ba74c90"), []string{"b", "a"}),
+		NewLockedProject(mkPI("github.com/sdboyer/gps3"), NewBranch("master").Pair("a1e5b8dd2da92c5e2d3c2a8a0f1f38a6b6ab4e15"), []string{"."}),
+		NewLockedProject(mkPI("github.com/sdboyer/gone"), NewVersion("v1.0.0").Pair("09baf36a7cd6e5e1c40e3d0c6eb1e7a9f2e0a7a1"), []string{"."}),
+	}
+	l2 := SimpleLock{
+		NewLockedProject(mkPI("github.com/sdboyer/new"), NewVersion("v2.0.0").Pair("4b34b4c8a7e91e0a1e0f05e8c1b5f3a5e4e8b5a3"), []string{"b", "."}),
+		NewLockedProject(mkPI("github.com/sdboyer/gps3"), NewBranch("master").Pair("f0a3f0e7fcd4b2ff6f6b8e6c2cfe0c5a57d0b8b9"), []string{"."}),
+		NewLockedProject(mkPI("github.com/sdboyer/gps2"), NewVersion("v1.0.0").Pair("bb2a1b8b5b6a1a7b11d7ed5d1b0e4f0a2ba74c90"), []string{"a", "b"}),
+		NewLockedProject(ProjectIdentifier{ProjectRoot: "github.com/sdboyer/gps", Source: "https://github.com/fork/gps"}, NewVersion("v0.11.0").Pair("278a227dfc3d595a33a77ff3f841fd8ca1bc8cd0"), []string{".", "c"}),
+	}
+
+	diff := DiffLocks(l1, l2)
+	var roots []ProjectRoot
+	for _, pd := range diff.Projects {
+		roots = append(roots, pd.Root)
+	}
+	wantRoots := []ProjectRoot{"github.com/sdboyer/gone", "github.com/sdboyer/gps", "github.com/sdboyer/gps3", "github.com/sdboyer/new"}
+	if !reflect.DeepEqual(roots, wantRoots) {
+		t.Fatalf("expected changes to %v, got %v", wantRoots, roots)
+	}
+
+	gone, gps, gps3, added := diff.Projects[0], diff.Projects[1], diff.Projects[2], diff.Projects[3]
+	if gone.Changes != ProjectRemoved || gone.New != nil || !reflect.DeepEqual(gone.PackagesRemoved, []string{"."}) {
+		t.Errorf("unexpected diff of a removed project: %+v", gone)
+	}
+	if gps.Changes != SourceChanged|VersionChanged|PackagesChanged || !reflect.DeepEqual(gps.PackagesAdded, []string{"c"}) || gps.PackagesRemoved != nil {
+		t.Errorf("unexpected diff of a modified project: %+v", gps)
+	}
+	if gps3.Changes != RevisionChanged {
+		t.Errorf("expected only the revision of a branch to change, got %+v", gps3)
+	}
+	if added.Changes != ProjectAdded || added.Old != nil || !reflect.DeepEqual(added.PackagesAdded, []string{".", "b"}) {
+		t.Errorf("unexpected diff of an added project: %+v", added)
+	}
+
+	if !diff.Changed(SourceChanged) || DiffLocks(l1, l1).Changed(^ProjectChange(0)) {
+		t.Error("unexpected result of Changed")
+	}
+
+	if diff := DiffLocks(l1, l1); len(diff.Projects) != 0 {
+		t.Errorf("expected no differences between a lock and itself, got %+v", diff)
+	}
+	if diff := DiffLocks(nil, l1); len(diff.Projects) != len(l1) || diff.Changed(^ProjectAdded) {
+		t.Errorf("expected every project to be added to a nil lock, got %+v", diff)
+	}
+}
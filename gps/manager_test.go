@@ -13,6 +13,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"sort"
 	"sync"
@@ -22,6 +23,7 @@ import (
 	"time"
 
 	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 // An analyzer that passes nothing back, but doesn't error. This is the naive
@@ -40,6 +42,36 @@ func (a naiveAnalyzer) Info() ProjectAnalyzerInfo {
 	}
 }
 
+// ctxAnalyzer is a naiveAnalyzer that records the context it was given.
+type ctxAnalyzer struct {
+	naiveAnalyzer
+	ctx context.Context
+}
+
+func (a *ctxAnalyzer) DeriveManifestAndLockContext(ctx context.Context, path string, pr ProjectRoot) (Manifest, Lock, error) {
+	a.ctx = ctx
+	return nil, nil, nil
+}
+
+func TestDeriveManifestAndLockContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	an := &ctxAnalyzer{}
+	if _, _, err := DeriveManifestAndLock(ctx, an, "path", "root"); err != nil || an.ctx != ctx {
+		t.Errorf("expected the analyzer to be given the context, got %v (%v)", an.ctx, err)
+	}
+
+	cancel()
+	an.ctx = nil
+	for _, a := range []ProjectAnalyzer{an, naiveAnalyzer{}} {
+		if _, _, err := DeriveManifestAndLock(ctx, a, "path", "root"); err != context.Canceled {
+			t.Errorf("expected no analysis once the context is cancelled, got %v", err)
+		}
+	}
+	if an.ctx != nil {
+		t.Error("expected the analyzer not to be run")
+	}
+}
+
 func mkNaiveSM(t *testing.T) (*SourceMgr, func()) {
 	cpath, err := ioutil.TempDir("", "smcache")
 	if err != nil {
@@ -168,7 +200,7 @@ func TestSourceInit(t *testing.T) {
 	}()
 
 	id := mkPI("github.com/sdboyer/gpkt").normalize()
-	pvl, err := sm.ListVersions(id)
+	pvl, err := sm.ListVersions(context.Background(), id)
 	if err != nil {
 		t.Errorf("Unexpected error during initial project setup/fetching %s", err)
 	}
@@ -267,7 +299,7 @@ func TestSourceInit(t *testing.T) {
 
 	// Ensure source existence values are what we expect
 	var exists bool
-	exists, err = sm.SourceExists(id)
+	exists, err = sm.SourceExists(context.Background(), id)
 	if err != nil {
 		t.Errorf("Error on checking SourceExists: %s", err)
 	}
@@ -285,7 +317,7 @@ func TestDefaultBranchAssignment(t *testing.T) {
 	defer clean()
 
 	id := mkPI("github.com/sdboyer/test-multibranch")
-	v, err := sm.ListVersions(id)
+	v, err := sm.ListVersions(context.Background(), id)
 	if err != nil {
 		t.Errorf("Unexpected error during initial project setup/fetching %s", err)
 	}
@@ -328,22 +360,22 @@ func TestMgrMethodsFailWithBadPath(t *testing.T) {
 	defer clean()
 
 	var err error
-	if _, err = sm.SourceExists(bad); err == nil {
+	if _, err = sm.SourceExists(context.Background(), bad); err == nil {
 		t.Error("SourceExists() did not error on bad input")
 	}
-	if err = sm.SyncSourceFor(bad); err == nil {
+	if err = sm.SyncSourceFor(context.Background(), bad); err == nil {
 		t.Error("SyncSourceFor() did not error on bad input")
 	}
-	if _, err = sm.ListVersions(bad); err == nil {
+	if _, err = sm.ListVersions(context.Background(), bad); err == nil {
 		t.Error("ListVersions() did not error on bad input")
 	}
-	if _, err = sm.RevisionPresentIn(bad, Revision("")); err == nil {
+	if _, err = sm.RevisionPresentIn(context.Background(), bad, Revision("")); err == nil {
 		t.Error("RevisionPresentIn() did not error on bad input")
 	}
-	if _, err = sm.ListPackages(bad, nil); err == nil {
+	if _, err = sm.ListPackages(context.Background(), bad, nil); err == nil {
 		t.Error("ListPackages() did not error on bad input")
 	}
-	if _, _, err = sm.GetManifestAndLock(bad, nil, naiveAnalyzer{}); err == nil {
+	if _, _, err = sm.GetManifestAndLock(context.Background(), bad, nil, naiveAnalyzer{}); err == nil {
 		t.Error("GetManifestAndLock() did not error on bad input")
 	}
 	if err = sm.ExportProject(context.Background(), bad, nil, ""); err == nil {
@@ -362,7 +394,7 @@ func (f sourceCreationTestFixture) run(t *testing.T) {
 	defer clean()
 
 	for _, pi := range f.roots {
-		_, err := sm.SourceExists(pi)
+		_, err := sm.SourceExists(context.Background(), pi)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -524,13 +556,13 @@ func TestFSCaseSensitivityConvergesSources(t *testing.T) {
 			sm, clean := mkNaiveSM(t)
 			defer clean()
 
-			sm.SyncSourceFor(pi1)
+			sm.SyncSourceFor(context.Background(), pi1)
 			sg1, err := sm.srcCoord.getSourceGatewayFor(context.Background(), pi1)
 			if err != nil {
 				t.Fatal(err)
 			}
 
-			sm.SyncSourceFor(pi2)
+			sm.SyncSourceFor(context.Background(), pi2)
 			sg2, err := sm.srcCoord.getSourceGatewayFor(context.Background(), pi2)
 			if err != nil {
 				t.Fatal(err)
@@ -581,12 +613,12 @@ func TestGetInfoListVersionsOrdering(t *testing.T) {
 
 	id := mkPI("github.com/sdboyer/gpkt").normalize()
 
-	_, _, err := sm.GetManifestAndLock(id, NewVersion("v1.0.0"), naiveAnalyzer{})
+	_, _, err := sm.GetManifestAndLock(context.Background(), id, NewVersion("v1.0.0"), naiveAnalyzer{})
 	if err != nil {
 		t.Errorf("Unexpected error from GetInfoAt %s", err)
 	}
 
-	v, err := sm.ListVersions(id)
+	v, err := sm.ListVersions(context.Background(), id)
 	if err != nil {
 		t.Errorf("Unexpected error from ListVersions %s", err)
 	}
@@ -601,7 +633,7 @@ func TestDeduceProjectRoot(t *testing.T) {
 	defer clean()
 
 	in := "github.com/sdboyer/gps"
-	pr, err := sm.DeduceProjectRoot(in)
+	pr, err := sm.DeduceProjectRoot(context.Background(), in)
 	if err != nil {
 		t.Errorf("Problem while detecting root of %q %s", in, err)
 	}
@@ -612,7 +644,7 @@ func TestDeduceProjectRoot(t *testing.T) {
 		t.Errorf("Root path trie should have one element after one deduction, has %v", sm.deduceCoord.rootxt.Len())
 	}
 
-	pr, err = sm.DeduceProjectRoot(in)
+	pr, err = sm.DeduceProjectRoot(context.Background(), in)
 	if err != nil {
 		t.Errorf("Problem while detecting root of %q %s", in, err)
 	} else if string(pr) != in {
@@ -624,7 +656,7 @@ func TestDeduceProjectRoot(t *testing.T) {
 
 	// Now do a subpath
 	sub := path.Join(in, "foo")
-	pr, err = sm.DeduceProjectRoot(sub)
+	pr, err = sm.DeduceProjectRoot(context.Background(), sub)
 	if err != nil {
 		t.Errorf("Problem while detecting root of %q %s", sub, err)
 	} else if string(pr) != in {
@@ -637,7 +669,7 @@ func TestDeduceProjectRoot(t *testing.T) {
 	// Now do a fully different root, but still on github
 	in2 := "github.com/bagel/lox"
 	sub2 := path.Join(in2, "cheese")
-	pr, err = sm.DeduceProjectRoot(sub2)
+	pr, err = sm.DeduceProjectRoot(context.Background(), sub2)
 	if err != nil {
 		t.Errorf("Problem while detecting root of %q %s", sub2, err)
 	} else if string(pr) != in2 {
@@ -649,7 +681,7 @@ func TestDeduceProjectRoot(t *testing.T) {
 
 	// Ensure that our prefixes are bounded by path separators
 	in4 := "github.com/bagel/loxx"
-	pr, err = sm.DeduceProjectRoot(in4)
+	pr, err = sm.DeduceProjectRoot(context.Background(), in4)
 	if err != nil {
 		t.Errorf("Problem while detecting root of %q %s", in4, err)
 	} else if string(pr) != in4 {
@@ -661,7 +693,7 @@ func TestDeduceProjectRoot(t *testing.T) {
 
 	// Ensure that vcs extension-based matching comes through
 	in5 := "ffffrrrraaaaaapppppdoesnotresolve.com/baz.git"
-	pr, err = sm.DeduceProjectRoot(in5)
+	pr, err = sm.DeduceProjectRoot(context.Background(), in5)
 	if err != nil {
 		t.Errorf("Problem while detecting root of %q %s", in5, err)
 	} else if string(pr) != in5 {
@@ -718,14 +750,14 @@ func TestMultiFetchThreadsafe(t *testing.T) {
 				case 0:
 					t.Run(fmt.Sprintf("deduce:%v:%s", opcount, id), func(t *testing.T) {
 						t.Parallel()
-						if _, err := sm.DeduceProjectRoot(string(id.ProjectRoot)); err != nil {
+						if _, err := sm.DeduceProjectRoot(context.Background(), string(id.ProjectRoot)); err != nil {
 							t.Error(err)
 						}
 					})
 				case 1:
 					t.Run(fmt.Sprintf("sync:%v:%s", opcount, id), func(t *testing.T) {
 						t.Parallel()
-						err := sm.SyncSourceFor(id)
+						err := sm.SyncSourceFor(context.Background(), id)
 						if err != nil {
 							t.Error(err)
 						}
@@ -733,7 +765,7 @@ func TestMultiFetchThreadsafe(t *testing.T) {
 				case 2:
 					t.Run(fmt.Sprintf("listVersions:%v:%s", opcount, id), func(t *testing.T) {
 						t.Parallel()
-						vl, err := sm.ListVersions(id)
+						vl, err := sm.ListVersions(context.Background(), id)
 						if err != nil {
 							t.Fatal(err)
 						}
@@ -744,7 +776,7 @@ func TestMultiFetchThreadsafe(t *testing.T) {
 				case 3:
 					t.Run(fmt.Sprintf("exists:%v:%s", opcount, id), func(t *testing.T) {
 						t.Parallel()
-						y, err := sm.SourceExists(id)
+						y, err := sm.SourceExists(context.Background(), id)
 						if err != nil {
 							t.Fatal(err)
 						}
@@ -793,7 +825,7 @@ func TestListVersionsRacey(t *testing.T) {
 	for i := 0; i < 20; i++ {
 		wg.Add(1)
 		go func() {
-			_, err := sm.ListVersions(id)
+			_, err := sm.ListVersions(context.Background(), id)
 			if err != nil {
 				t.Errorf("listing versions failed with err %s", err.Error())
 			}
@@ -809,42 +841,42 @@ func TestErrAfterRelease(t *testing.T) {
 	clean()
 	id := ProjectIdentifier{}
 
-	_, err := sm.SourceExists(id)
+	_, err := sm.SourceExists(context.Background(), id)
 	if err == nil {
 		t.Errorf("SourceExists did not error after calling Release()")
 	} else if err != ErrSourceManagerIsReleased {
 		t.Errorf("SourceExists errored after Release(), but with unexpected error: %T %s", err, err.Error())
 	}
 
-	err = sm.SyncSourceFor(id)
+	err = sm.SyncSourceFor(context.Background(), id)
 	if err == nil {
 		t.Errorf("SyncSourceFor did not error after calling Release()")
 	} else if err != ErrSourceManagerIsReleased {
 		t.Errorf("SyncSourceFor errored after Release(), but with unexpected error: %T %s", err, err.Error())
 	}
 
-	_, err = sm.ListVersions(id)
+	_, err = sm.ListVersions(context.Background(), id)
 	if err == nil {
 		t.Errorf("ListVersions did not error after calling Release()")
 	} else if err != ErrSourceManagerIsReleased {
 		t.Errorf("ListVersions errored after Release(), but with unexpected error: %T %s", err, err.Error())
 	}
 
-	_, err = sm.RevisionPresentIn(id, "")
+	_, err = sm.RevisionPresentIn(context.Background(), id, "")
 	if err == nil {
 		t.Errorf("RevisionPresentIn did not error after calling Release()")
 	} else if err != ErrSourceManagerIsReleased {
 		t.Errorf("RevisionPresentIn errored after Release(), but with unexpected error: %T %s", err, err.Error())
 	}
 
-	_, err = sm.ListPackages(id, nil)
+	_, err = sm.ListPackages(context.Background(), id, nil)
 	if err == nil {
 		t.Errorf("ListPackages did not error after calling Release()")
 	} else if err != ErrSourceManagerIsReleased {
 		t.Errorf("ListPackages errored after Release(), but with unexpected error: %T %s", err, err.Error())
 	}
 
-	_, _, err = sm.GetManifestAndLock(id, nil, naiveAnalyzer{})
+	_, _, err = sm.GetManifestAndLock(context.Background(), id, nil, naiveAnalyzer{})
 	if err == nil {
 		t.Errorf("GetManifestAndLock did not error after calling Release()")
 	} else if err != ErrSourceManagerIsReleased {
@@ -858,7 +890,7 @@ func TestErrAfterRelease(t *testing.T) {
 		t.Errorf("ExportProject errored after Release(), but with unexpected error: %T %s", err, err.Error())
 	}
 
-	_, err = sm.DeduceProjectRoot("")
+	_, err = sm.DeduceProjectRoot(context.Background(), "")
 	if err == nil {
 		t.Errorf("DeduceProjectRoot did not error after calling Release()")
 	} else if err != ErrSourceManagerIsReleased {
@@ -891,7 +923,7 @@ func TestSignalHandling(t *testing.T) {
 
 	errchan := make(chan error)
 	go func() {
-		_, callerr := sm.DeduceProjectRoot("k8s.io/kubernetes")
+		_, callerr := sm.DeduceProjectRoot(context.Background(), "k8s.io/kubernetes")
 		errchan <- callerr
 	}()
 	go func() { sigch <- os.Interrupt }()
@@ -914,7 +946,7 @@ func TestSignalHandling(t *testing.T) {
 	sm.HandleSignals(sigch)
 
 	go func() {
-		_, callerr := sm.DeduceProjectRoot("k8s.io/kubernetes")
+		_, callerr := sm.DeduceProjectRoot(context.Background(), "k8s.io/kubernetes")
 		errchan <- callerr
 	}()
 	go func() {
@@ -944,7 +976,7 @@ func TestUnreachableSource(t *testing.T) {
 	defer clean()
 
 	id := mkPI("github.com/golang/notexist").normalize()
-	err := sm.SyncSourceFor(id)
+	err := sm.SyncSourceFor(context.Background(), id)
 	if err == nil {
 		t.Error("expected err when listing versions of a bogus source, but got nil")
 	}
@@ -1053,3 +1085,454 @@ func TestSupervisor(t *testing.T) {
 		return nil
 	})
 }
+
+func TestDeductionCacheControls(t *testing.T) {
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+
+	for _, ip := range []string{"github.com/sdboyer/gps/foo", "github.com/sdboyer/deptest", "gopkg.in/yaml.v2"} {
+		if _, err := sm.DeduceProjectRoot(context.Background(), ip); err != nil {
+			t.Fatalf("unexpected error deducing %s: %s", ip, err)
+		}
+	}
+	// Simulate a source having been set up for one of the deduced roots.
+	sm.srcCoord.nameToURL["github.com/sdboyer/gps"] = "https://github.com/sdboyer/gps"
+	sm.srcCoord.nameToURL["github.com/sdboyer/deptest"] = "https://github.com/sdboyer/deptest"
+
+	roots := func() []ProjectRoot {
+		drs, err := sm.CachedDeductions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var roots []ProjectRoot
+		for _, dr := range drs {
+			if len(dr.URLs) == 0 {
+				t.Errorf("expected candidate URLs for %s", dr.Root)
+			}
+			roots = append(roots, dr.Root)
+		}
+		return roots
+	}
+
+	want := []ProjectRoot{"github.com/sdboyer/deptest", "github.com/sdboyer/gps", "gopkg.in/yaml.v2"}
+	if got := roots(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected cached deductions:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	// Invalidating a path within a root invalidates the root, and nothing else.
+	if err := sm.InvalidateDeductions("github.com/sdboyer/gps/foo"); err != nil {
+		t.Fatal(err)
+	}
+	want = []ProjectRoot{"github.com/sdboyer/deptest", "gopkg.in/yaml.v2"}
+	if got := roots(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected cached deductions after invalidation:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+	if _, has := sm.srcCoord.nameToURL["github.com/sdboyer/gps"]; has {
+		t.Error("expected name mapping for invalidated root to be dropped")
+	}
+	if _, has := sm.srcCoord.nameToURL["github.com/sdboyer/deptest"]; !has {
+		t.Error("expected name mapping for other roots to be retained")
+	}
+
+	if err := sm.InvalidateDeductions(""); err == nil {
+		t.Error("expected an error when invalidating an empty prefix")
+	}
+
+	if err := sm.PurgeDeductions(); err != nil {
+		t.Fatal(err)
+	}
+	if got := roots(); len(got) != 0 {
+		t.Errorf("expected no cached deductions after purge, got %v", got)
+	}
+	if len(sm.srcCoord.nameToURL) != 0 {
+		t.Errorf("expected no name mappings after purge, got %v", sm.srcCoord.nameToURL)
+	}
+}
+
+func TestExplainDeduction(t *testing.T) {
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+
+	x, err := sm.ExplainDeduction(context.Background(), "github.com/sdboyer/gps/pkgtree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.ImportPath != "github.com/sdboyer/gps/pkgtree" || x.Root != "github.com/sdboyer/gps" {
+		t.Errorf("unexpected import path and root: %+v", x)
+	}
+	if x.Deducer != "known path rules for github.com" || x.Cached || x.Network {
+		t.Errorf("expected a fresh deduction by the github.com rules, without the network, got %+v", x)
+	}
+	if len(x.URLs) == 0 || x.URLs[0].String() != "https://github.com/sdboyer/gps" {
+		t.Errorf("unexpected URLs %v", x.URLs)
+	}
+
+	// Another path beneath the same root is answered from the cache, by the
+	// same deducer.
+	x, err = sm.ExplainDeduction(context.Background(), "github.com/sdboyer/gps/internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Root != "github.com/sdboyer/gps" || x.Deducer != "known path rules for github.com" || !x.Cached {
+		t.Errorf("expected a cached deduction by the github.com rules, got %+v", x)
+	}
+
+	x, err = sm.ExplainDeduction(context.Background(), "example.com/repo.git/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Root != "example.com/repo.git" || x.Deducer != "VCS extension in path" || x.Cached {
+		t.Errorf("expected a fresh deduction from the VCS extension, got %+v", x)
+	}
+
+	// Once purged, deductions are no longer cached.
+	if err := sm.PurgeDeductions(); err != nil {
+		t.Fatal(err)
+	}
+	if x, err = sm.ExplainDeduction(context.Background(), "github.com/sdboyer/gps"); err != nil || x.Cached {
+		t.Errorf("expected a fresh deduction after purging, got %+v, %v", x, err)
+	}
+
+	if _, err := sm.ExplainDeduction(context.Background(), "not a path"); err == nil {
+		t.Error("expected an error explaining an invalid import path")
+	}
+}
+
+func TestListVersionsMatching(t *testing.T) {
+	pvl := []PairedVersion{
+		NewBranch("master").Pair("rev3"),
+		NewVersion("v1.0.0").Pair("rev1"),
+		NewVersion("v2.0.0").Pair("rev3"),
+		NewVersion("v1.2.0").Pair("rev2"),
+		NewVersion("v1.3.0-beta").Pair("rev2"),
+	}
+
+	c, _ := NewSemverConstraintIC("v1.0.0")
+	want := []PairedVersion{
+		NewVersion("v1.2.0").Pair("rev2"),
+		NewVersion("v1.0.0").Pair("rev1"),
+	}
+	if got := matchingVersions(pvl, c); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected versions matching ^1.0.0:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	want = []PairedVersion{
+		NewVersion("v2.0.0").Pair("rev3"),
+		NewBranch("master").Pair("rev3"),
+	}
+	if got := matchingVersions(pvl, Revision("rev3")); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected versions matching rev3:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+	if got := matchingVersions(pvl, none); len(got) != 0 {
+		t.Errorf("expected no versions to match none, got %v", got)
+	}
+	if pvl[0].String() != "master" {
+		t.Error("expected the listed versions not to be sorted in place")
+	}
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+	sm.Release()
+	if _, err := sm.ListVersionsMatching(context.Background(), mkPI("github.com/sdboyer/gpkt"), Any()); err != ErrSourceManagerIsReleased {
+		t.Errorf("expected ErrSourceManagerIsReleased from a released SourceMgr, got %v", err)
+	}
+}
+
+func TestListVersionsBatch(t *testing.T) {
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+
+	ids := []ProjectIdentifier{
+		mkPI("github.com/sdboyer/gpkt"),
+		mkPI("github.com/sdboyer/gogl"),
+		mkPI("github.com/sdboyer/deptest"),
+	}
+
+	// With a canceled context, every project should fail without being
+	// attempted, but still be reported.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var reported []ProjectRoot
+	results, err := sm.ListVersionsBatch(ctx, ids, 2, func(res VersionListResult) {
+		reported = append(reported, res.ID.ProjectRoot)
+	})
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(results) != len(ids) || len(reported) != len(ids) {
+		t.Fatalf("expected a result for each of %v projects, got %v results and %v reports", len(ids), len(results), len(reported))
+	}
+	for i, res := range results {
+		if res.ID != ids[i] {
+			t.Errorf("expected result %v to be for %s, got %s", i, ids[i], res.ID)
+		}
+		if res.Err != context.Canceled {
+			t.Errorf("expected %s to fail with context.Canceled, got %v", res.ID, res.Err)
+		}
+	}
+
+	if !testing.Short() {
+		results, err = sm.ListVersionsBatch(context.Background(), ids, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, res := range results {
+			if res.Err != nil {
+				t.Errorf("unexpected error listing versions for %s: %s", res.ID, res.Err)
+			} else if len(res.Versions) == 0 {
+				t.Errorf("expected versions for %s", res.ID)
+			}
+		}
+	}
+
+	sm.Release()
+	if _, err = sm.ListVersionsBatch(context.Background(), ids, 0, nil); err != ErrSourceManagerIsReleased {
+		t.Errorf("expected ErrSourceManagerIsReleased, got %v", err)
+	}
+}
+
+func TestSupervisorTimeouts(t *testing.T) {
+	superv := newSupervisor(context.Background())
+	superv.timeouts = CallTimeouts{
+		SourceFetch:  10 * time.Millisecond,
+		ListVersions: -1,
+	}.durations()
+
+	if _, has := superv.timeouts[ctListVersions]; has {
+		t.Error("expected a negative timeout to disable the timeout")
+	}
+	if d := superv.timeouts[ctSourceInit]; d != 30*time.Minute {
+		t.Errorf("expected the default timeout for an unset field, got %s", d)
+	}
+
+	err := superv.do(context.Background(), "foo", ctSourceFetch, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err == nil {
+		t.Fatal("expected the fetch to time out")
+	}
+	if errors.Cause(err) != context.DeadlineExceeded {
+		t.Errorf("expected the cause of the error to be the deadline, got %v", err)
+	}
+
+	// Calls without a timeout are unaffected.
+	err = superv.do(context.Background(), "foo", ctListVersions, func(ctx context.Context) error {
+		if _, has := ctx.Deadline(); has {
+			return fmt.Errorf("unexpected deadline")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if superv.count() != 0 {
+		t.Errorf("expected no calls left running, got %v", superv.count())
+	}
+}
+
+func TestSupervisorNetworkLimit(t *testing.T) {
+	superv := newSupervisor(context.Background())
+	superv.netSlots = make(chan struct{}, 2)
+
+	var mu sync.Mutex
+	var inFlight, max int
+	call := func(ctx context.Context) error {
+		mu.Lock()
+		if inFlight++; inFlight > max {
+			max = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(typ callType) {
+			defer wg.Done()
+			superv.do(context.Background(), "foo", typ, call)
+		}([]callType{ctSourceFetch, ctListVersions}[i%2])
+	}
+	wg.Wait()
+	if max != 2 {
+		t.Errorf("expected at most 2 network calls in flight at once, got %v", max)
+	}
+
+	// Calls that don't use the network aren't held up by those that do.
+	superv.netSlots <- struct{}{}
+	superv.netSlots <- struct{}{}
+	if err := superv.do(context.Background(), "foo", ctExportTree, func(context.Context) error { return nil }); err != nil {
+		t.Error(err)
+	}
+
+	// Waiting for a turn ends with the caller's context.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := superv.do(ctx, "foo", ctSourceInit, func(context.Context) error {
+		t.Error("expected the call to never run")
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the wait for a turn to time out, got %v", err)
+	}
+	if superv.count() != 0 {
+		t.Errorf("expected no calls left running, got %v", superv.count())
+	}
+}
+
+func TestSupervisorStats(t *testing.T) {
+	superv := newSupervisor(context.Background())
+
+	for i := 0; i < 3; i++ {
+		source := "https://example.com/a"
+		if i == 2 {
+			source = "https://example.com/b"
+		}
+		superv.doFor(context.Background(), source, "foo", ctListVersions, func(context.Context) error {
+			if i == 2 {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		})
+	}
+	superv.fold(ctListVersions, "https://example.com/a")
+	superv.retry(ctListVersions, "https://example.com/a")
+	superv.cacheHit(ctListVersions, "https://example.com/b")
+	superv.cacheHit(ctListVersions, "https://example.com/b")
+	superv.fold(ctHTTPMetadata, "")
+	superv.foldSetup()
+	superv.foldSetup()
+
+	stats := superv.snapshot()
+	if stats.FoldedSourceSetups != 2 {
+		t.Errorf("expected 2 folded source setups, got %v", stats.FoldedSourceSetups)
+	}
+	if len(stats.Calls) != 2 {
+		t.Fatalf("expected stats for 2 call types, got %v", stats.Calls)
+	}
+
+	// Ordered by call type.
+	hmd, lv := stats.Calls[0], stats.Calls[1]
+	if hmd.Type != ctHTTPMetadata.String() || lv.Type != ctListVersions.String() {
+		t.Fatalf("unexpected call types %q and %q", hmd.Type, lv.Type)
+	}
+	if hmd.Issued != 0 || hmd.Folded != 1 {
+		t.Errorf("unexpected stats for folded-only call type: %+v", hmd)
+	}
+	if lv.Issued != 3 || lv.Folded != 1 || lv.Cached != 2 || lv.Retried != 1 || lv.Failed != 1 {
+		t.Errorf("unexpected stats for issued call type: %+v", lv)
+	}
+	if lv.Max > lv.Total {
+		t.Errorf("max latency %s exceeds total %s", lv.Max, lv.Total)
+	}
+
+	if len(lv.Latencies) != len(callLatencyBounds)+1 {
+		t.Fatalf("expected %v latency buckets, got %v", len(callLatencyBounds)+1, len(lv.Latencies))
+	}
+	var n int
+	for _, lb := range lv.Latencies {
+		n += lb.Count
+	}
+	if n != lv.Issued {
+		t.Errorf("expected latency buckets to account for all %v issued calls, got %v", lv.Issued, n)
+	}
+	if lv.Latencies[len(lv.Latencies)-1].UpTo != 0 {
+		t.Error("expected final latency bucket to be unbounded")
+	}
+
+	// Calls for a source are also reported for it, ordered by URL; those for
+	// no source are not.
+	if len(stats.Sources) != 2 {
+		t.Fatalf("expected stats for 2 sources, got %v", stats.Sources)
+	}
+	a, b := stats.Sources[0], stats.Sources[1]
+	if a.URL != "https://example.com/a" || b.URL != "https://example.com/b" {
+		t.Fatalf("unexpected sources %q and %q", a.URL, b.URL)
+	}
+	if len(a.Calls) != 1 || a.Calls[0].Issued != 2 || a.Calls[0].Folded != 1 || a.Calls[0].Retried != 1 || a.Calls[0].Failed != 0 {
+		t.Errorf("unexpected stats for the first source: %+v", a.Calls)
+	}
+	if len(b.Calls) != 1 || b.Calls[0].Issued != 1 || b.Calls[0].Cached != 2 || b.Calls[0].Failed != 1 {
+		t.Errorf("unexpected stats for the second source: %+v", b.Calls)
+	}
+
+	// Resetting reports the stats so far, and then starts afresh.
+	if reset := superv.resetStats(); !reflect.DeepEqual(reset, stats) {
+		t.Errorf("expected reset to report the stats so far:\n\t(GOT): %+v\n\t(WNT): %+v", reset, stats)
+	}
+	superv.cacheHit(ctListPackages, "https://example.com/a")
+	stats = superv.snapshot()
+	if stats.FoldedSourceSetups != 0 || len(stats.Calls) != 1 || len(stats.Sources) != 1 || stats.Calls[0].Cached != 1 {
+		t.Errorf("expected only the stats of calls since the reset, got %+v", stats)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("drains", func(t *testing.T) {
+		sm, clean := mkNaiveSM(t)
+		defer clean()
+
+		started, finish := make(chan struct{}), make(chan struct{})
+		callErr := make(chan error, 1)
+		go func() {
+			callErr <- sm.suprvsr.do(context.Background(), "foo", ctSourceFetch, func(ctx context.Context) error {
+				close(started)
+				<-finish
+				return ctx.Err()
+			})
+		}()
+		<-started
+
+		time.AfterFunc(10*time.Millisecond, func() { close(finish) })
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := sm.Shutdown(ctx); err != nil {
+			t.Errorf("unexpected error from Shutdown: %s", err)
+		}
+		if err := <-callErr; err != nil {
+			t.Errorf("expected running call to complete without being canceled, got %s", err)
+		}
+
+		if _, err := sm.ListVersions(context.Background(), mkPI("github.com/sdboyer/gpkt")); err != ErrSourceManagerIsReleased {
+			t.Errorf("expected ErrSourceManagerIsReleased after Shutdown, got %v", err)
+		}
+		if err := sm.Shutdown(context.Background()); err != nil {
+			t.Errorf("expected repeated Shutdown to do nothing, got %s", err)
+		}
+	})
+
+	t.Run("cancels after deadline", func(t *testing.T) {
+		sm, clean := mkNaiveSM(t)
+		defer clean()
+
+		started := make(chan struct{})
+		callErr := make(chan error, 1)
+		go func() {
+			callErr <- sm.suprvsr.do(context.Background(), "foo", ctSourceFetch, func(ctx context.Context) error {
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			})
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := sm.Shutdown(ctx); err != context.DeadlineExceeded {
+			t.Errorf("expected context.DeadlineExceeded from Shutdown, got %v", err)
+		}
+		if err := <-callErr; err != context.Canceled {
+			t.Errorf("expected running call to be canceled, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(sm.cachedir, "sm.lock")); !os.IsNotExist(err) {
+			t.Error("expected lock file to be removed after Shutdown")
+		}
+	})
+}
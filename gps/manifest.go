@@ -4,7 +4,11 @@
 
 package gps
 
-import "github.com/golang/dep/gps/pkgtree"
+import (
+	"strings"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
 
 // Manifest represents manifest-type data for a project at a particular version.
 // The constraints expressed in a manifest determine the set of versions that
@@ -61,6 +65,64 @@ type RootManifest interface {
 	RequiredPackages() map[string]bool
 }
 
+// ScopedConstraint is a root project constraint that applies only when the
+// constrained project is reachable from at least one of the listed root
+// packages.
+type ScopedConstraint struct {
+	ProjectProperties
+
+	// Packages is the list of import paths, within the root project's
+	// PackageTree, from which the constrained project must be (transitively)
+	// reachable in order for the constraint to apply.
+	Packages []string
+}
+
+// appliesIn reports whether the scoped constraint on pr applies to a root
+// project with the reach map rm: whether any of the external imports reachable
+// from its listed packages fall within pr.
+func (scc ScopedConstraint) appliesIn(pr ProjectRoot, rm pkgtree.ReachMap) bool {
+	for _, pkg := range scc.Packages {
+		for _, ex := range rm[pkg].External {
+			if ex == string(pr) || strings.HasPrefix(ex, string(pr)+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ScopedConstraints is a map of projects, as identified by their import path
+// roots, to the corresponding ScopedConstraint.
+type ScopedConstraints map[ProjectRoot]ScopedConstraint
+
+// Applicable returns the scoped constraints in sc that apply to a root project
+// with the reach map rm, as the solver decides it. rm should be computed as the
+// solver does, including tests and ignoring the root's ignored packages.
+func (sc ScopedConstraints) Applicable(rm pkgtree.ReachMap) ScopedConstraints {
+	app := make(ScopedConstraints)
+	for pr, scc := range sc {
+		if scc.appliesIn(pr, rm) {
+			app[pr] = scc
+		}
+	}
+	return app
+}
+
+// ScopedRootManifest is an optional extension of RootManifest that allows the
+// root project to express constraints that are only applicable when the
+// dependency is reached through particular root packages - for example, a
+// stricter pin that only matters to one of the project's commands.
+//
+// Applicability is decided once, up front, from the root project's reach map.
+// An applicable scoped constraint is intersected with any unscoped constraint
+// declared on the same project; an inapplicable one is discarded entirely.
+type ScopedRootManifest interface {
+	RootManifest
+
+	// ScopedConstraints returns the set of package-scoped constraints.
+	ScopedConstraints() ScopedConstraints
+}
+
 // SimpleManifest is a helper for tools to enumerate manifest data. It's
 // generally intended for ephemeral manifests, such as those Analyzers create on
 // the fly for projects with no manifest metadata, or metadata through a foreign
@@ -80,10 +142,13 @@ func (m SimpleManifest) DependencyConstraints() ProjectConstraints {
 // params when a nil Manifest is provided.
 type simpleRootManifest struct {
 	c, ovr ProjectConstraints
+	sc     ScopedConstraints
 	ig     *pkgtree.IgnoredRuleset
 	req    map[string]bool
 }
 
+var _ ScopedRootManifest = simpleRootManifest{}
+
 func (m simpleRootManifest) DependencyConstraints() ProjectConstraints {
 	return m.c
 }
@@ -96,6 +161,9 @@ func (m simpleRootManifest) IgnoredPackages() *pkgtree.IgnoredRuleset {
 func (m simpleRootManifest) RequiredPackages() map[string]bool {
 	return m.req
 }
+func (m simpleRootManifest) ScopedConstraints() ScopedConstraints {
+	return m.sc
+}
 
 // prepManifest ensures a manifest is prepared and safe for use by the solver.
 // This is mostly about ensuring that no outside routine can modify the manifest
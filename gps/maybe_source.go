@@ -10,8 +10,10 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/Masterminds/vcs"
+	"github.com/pkg/errors"
 )
 
 // A maybeSource represents a set of information that, given some
@@ -43,6 +45,87 @@ func sourceCachePath(cacheDir, sourceURL string) string {
 	return filepath.Join(cacheDir, "sources", sanitizer.Replace(sourceURL))
 }
 
+// maybeSourceCachePath returns the source cache dir path that m uses when it is
+// tried.
+func maybeSourceCachePath(cacheDir string, m maybeSource) string {
+	if gm, ok := m.(maybeGopkginSource); ok {
+		// Mirror the alias used by maybeGopkginSource.try().
+		return sourceCachePath(cacheDir, gm.url.Scheme+"://"+gm.opath)
+	}
+	return sourceCachePath(cacheDir, m.URL().String())
+}
+
+// mirrorableSource is an optional extension of source, for sources that can
+// fail over to mirrors of their upstream.
+type mirrorableSource interface {
+	source
+	// setMirrors sets the URLs of the mirrors to fail over to, in order. If
+	// only is true, upstream is never contacted, only the mirrors.
+	setMirrors(urls []string, only bool)
+}
+
+// maybeMirroredSource is a maybeSource with an ordered list of mirrors of its
+// upstream, to be failed over to when upstream cannot be reached. The source
+// set up from it occupies the same place in the cache, and has the same
+// identity, as though it had no mirrors.
+type maybeMirroredSource struct {
+	maybeSource
+	mirrors []string
+	only    bool // Whether upstream itself is never to be contacted.
+}
+
+func (m maybeMirroredSource) try(ctx context.Context, cachedir string) (source, error) {
+	src, err := m.maybeSource.try(ctx, cachedir)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, ok := src.(mirrorableSource)
+	if !ok {
+		return nil, errors.Errorf("%s sources do not support mirrors", src.sourceType())
+	}
+	ms.setMirrors(m.mirrors, m.only)
+	return ms, nil
+}
+
+func (m maybeMirroredSource) String() string {
+	return fmt.Sprintf("%s (mirrors: %s)", m.maybeSource, strings.Join(m.mirrors, ", "))
+}
+
+// refspecSource is an optional extension of source, for sources that can be
+// restricted to fetching only some of the refs upstream.
+type refspecSource interface {
+	source
+	// setFetchRefspecs sets the refspecs restricting what is fetched.
+	setFetchRefspecs([]string)
+}
+
+// maybeRefspecSource is a maybeSource whose source fetches only the refs that
+// its refspecs match, rather than every branch and tag upstream. Versions that
+// are not fetched are not listed, either.
+type maybeRefspecSource struct {
+	maybeSource
+	refspecs []string
+}
+
+func (m maybeRefspecSource) try(ctx context.Context, cachedir string) (source, error) {
+	src, err := m.maybeSource.try(ctx, cachedir)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, ok := src.(refspecSource)
+	if !ok {
+		return nil, errors.Errorf("%s sources do not support fetch refspecs", src.sourceType())
+	}
+	rs.setFetchRefspecs(m.refspecs)
+	return rs, nil
+}
+
+func (m maybeRefspecSource) String() string {
+	return fmt.Sprintf("%s (refspecs: %s)", m.maybeSource, strings.Join(m.refspecs, " "))
+}
+
 type maybeGitSource struct {
 	url *url.URL
 }
@@ -62,8 +145,9 @@ func (m maybeGitSource) try(ctx context.Context, cachedir string) (source, error
 
 	return &gitSource{
 		baseVCSSource: baseVCSSource{
-			repo: &gitRepo{r},
+			repo: &gitRepo{GitRepo: r},
 		},
+		batch: newGitBatchChecker(path),
 	}, nil
 }
 
@@ -109,8 +193,9 @@ func (m maybeGopkginSource) try(ctx context.Context, cachedir string) (source, e
 	return &gopkginSource{
 		gitSource: gitSource{
 			baseVCSSource: baseVCSSource{
-				repo: &gitRepo{r},
+				repo: &gitRepo{GitRepo: r},
 			},
+			batch: newGitBatchChecker(path),
 		},
 		major:    m.major,
 		unstable: m.unstable,
@@ -137,6 +222,23 @@ func (m maybeBzrSource) try(ctx context.Context, cachedir string) (source, error
 	ustr := m.url.String()
 	path := sourceCachePath(cachedir, ustr)
 
+	if bzrBinary() == "brz" {
+		r, err := newBrzRepo(ustr, path)
+		if err != nil {
+			os.RemoveAll(path)
+			r, err = newBrzRepo(ustr, path)
+			if err != nil {
+				return nil, unwrapVcsErr(err)
+			}
+		}
+
+		return &bzrSource{
+			baseVCSSource: baseVCSSource{
+				repo: r,
+			},
+		}, nil
+	}
+
 	r, err := vcs.NewBzrRepo(ustr, path)
 	if err != nil {
 		os.RemoveAll(path)
@@ -161,6 +263,38 @@ func (m maybeBzrSource) String() string {
 	return fmt.Sprintf("%T: %s", m, ufmt(m.url))
 }
 
+type maybeSvnSource struct {
+	url *url.URL
+}
+
+func (m maybeSvnSource) try(ctx context.Context, cachedir string) (source, error) {
+	ustr := m.url.String()
+	path := sourceCachePath(cachedir, ustr)
+
+	r, err := vcs.NewSvnRepo(ustr, path)
+	if err != nil {
+		os.RemoveAll(path)
+		r, err = vcs.NewSvnRepo(ustr, path)
+		if err != nil {
+			return nil, unwrapVcsErr(err)
+		}
+	}
+
+	return &svnSource{
+		baseVCSSource: baseVCSSource{
+			repo: &svnRepo{SvnRepo: r, sparse: true},
+		},
+	}, nil
+}
+
+func (m maybeSvnSource) URL() *url.URL {
+	return m.url
+}
+
+func (m maybeSvnSource) String() string {
+	return fmt.Sprintf("%T: %s", m, ufmt(m.url))
+}
+
 type maybeHgSource struct {
 	url *url.URL
 }
@@ -180,7 +314,7 @@ func (m maybeHgSource) try(ctx context.Context, cachedir string) (source, error)
 
 	return &hgSource{
 		baseVCSSource: baseVCSSource{
-			repo: &hgRepo{r},
+			repo: &hgRepo{HgRepo: r, server: newHgCommandServer(path)},
 		},
 	}, nil
 }
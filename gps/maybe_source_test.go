@@ -95,6 +95,21 @@ func TestMaybeGitSource_try_recovery(t *testing.T) {
 	}
 }
 
+func TestMaybeNativeGitSourceUnsupported(t *testing.T) {
+	if newNativeGitSource != nil {
+		t.Skip("built with native git support")
+	}
+
+	u, err := url.Parse(gitRemoteTestRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ms maybeSource = maybeNativeGitSource{maybeGitSource{url: u}}
+	if _, err = ms.try(context.Background(), ""); err != errNoNativeGit {
+		t.Fatalf("expected errNoNativeGit, got %v", err)
+	}
+}
+
 func untar(dst string, r io.Reader) error {
 	gzr, err := gzip.NewReader(r)
 	if err != nil {
@@ -0,0 +1,215 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// NetworkOperation is a record of an operation that reached out over the
+// network, as written to SourceManagerConfig.NetworkAudit.
+type NetworkOperation struct {
+	Time     time.Time     `json:"time"`              // When the operation began.
+	Op       string        `json:"op"`                // What the operation was for: "deduce", "ping", "clone", "fetch", "list-versions", "download" or "checksum-lookup".
+	Protocol string        `json:"protocol"`          // "http", or the VCS used, such as "git".
+	Host     string        `json:"host"`              // The host contacted, if known.
+	URL      string        `json:"url"`               // The URL contacted, without any credentials.
+	Bytes    int64         `json:"bytes"`             // For HTTP, the bytes of the response body read. VCS tools do not report what they transfer, so for clones and fetches, the growth of the local copy on disk.
+	Duration time.Duration `json:"duration_ns"`       // How long the operation took.
+	Project  ProjectRoot   `json:"project,omitempty"` // The project, or for deductions the import path, the operation was done on behalf of, if known.
+	Error    string        `json:"error,omitempty"`   // Why the operation failed, if it did.
+}
+
+// networkAuditor writes a NetworkOperation to a log for each operation that
+// reaches out over the network.
+type networkAuditor struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	w      io.Writer
+	redact *redactor // Scrubs credentials from the errors recorded
+}
+
+func newNetworkAuditor(w io.Writer) *networkAuditor {
+	return &networkAuditor{enc: json.NewEncoder(w), w: w}
+}
+
+// record writes op to the log. Failing to write it must not fail the
+// operation, so errors are dropped.
+func (a *networkAuditor) record(op NetworkOperation) {
+	a.mu.Lock()
+	_ = a.enc.Encode(op)
+	a.mu.Unlock()
+}
+
+// close closes the log, if it can be closed.
+func (a *networkAuditor) close() error {
+	if c, ok := a.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type auditProjectKey struct{}
+type auditCallKey struct{}
+
+// auditCall is what the supervisor tells operations beneath it about the call
+// they are part of, so that they can be audited.
+type auditCall struct {
+	a   *networkAuditor
+	typ callType
+}
+
+// auditProject returns ctx, noting pr as the project that network operations
+// done with it are on behalf of, if they are being audited. For deductions,
+// pr is the import path being deduced.
+func (sm *SourceMgr) auditProject(ctx context.Context, pr ProjectRoot) context.Context {
+	if sm.suprvsr.audit == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, auditProjectKey{}, pr)
+}
+
+// auditVCS runs f, an operation of type ct on the upstream of sg's source,
+// and records it if network operations are being audited. Operations on
+// sources that make HTTP requests are recorded request by request instead.
+func (sg *sourceGateway) auditVCS(ctx context.Context, ct callType, f func() error) error {
+	a := sg.suprvsr.audit
+	if a == nil {
+		return f()
+	}
+	if _, ok := sg.src.(*registrySource); ok {
+		return f()
+	}
+
+	// Clones and fetches are measured by how much they grow the local copy.
+	var path string
+	var before int64
+	if (ct == ctSourceInit || ct == ctSourceFetch) && sg.maybe != nil {
+		path = maybeSourceCachePath(sg.cachedir, sg.maybe)
+		before, _ = dirSize(path)
+	}
+
+	start := time.Now()
+	err := f()
+	var bytes int64
+	if path != "" {
+		if after, serr := dirSize(path); serr == nil && after > before {
+			bytes = after - before
+		}
+	}
+
+	ctx = context.WithValue(ctx, auditCallKey{}, auditCall{a: a, typ: ct})
+	recordNetwork(ctx, sg.src.sourceType(), sg.src.upstreamURL(), bytes, start, err)
+	return err
+}
+
+// recordNetwork records a network operation done as part of the call that ctx
+// belongs to, if that call is being audited. url may hold credentials, which
+// are not recorded.
+func recordNetwork(ctx context.Context, protocol, rawurl string, bytes int64, start time.Time, err error) {
+	ac, ok := ctx.Value(auditCallKey{}).(auditCall)
+	if !ok {
+		return
+	}
+
+	op := NetworkOperation{
+		Time:     start,
+		Op:       ac.typ.auditOp(),
+		Protocol: protocol,
+		URL:      rawurl,
+		Bytes:    bytes,
+		Duration: time.Since(start),
+	}
+	if u, perr := url.Parse(rawurl); perr == nil {
+		u.User = nil
+		op.Host = u.Hostname()
+		op.URL = u.String()
+	}
+	op.Project, _ = ctx.Value(auditProjectKey{}).(ProjectRoot)
+	if err != nil {
+		op.Error = ac.a.redact.redact(err.Error())
+	}
+	ac.a.record(op)
+}
+
+// auditOp returns the name that operations done as part of calls of type ct
+// are recorded under.
+func (ct callType) auditOp() string {
+	switch ct {
+	case ctHTTPMetadata:
+		return "deduce"
+	case ctSourcePing:
+		return "ping"
+	case ctSourceInit:
+		return "clone"
+	case ctSourceFetch:
+		return "fetch"
+	case ctListVersions, ctBackgroundRefresh:
+		return "list-versions"
+	case ctVerifyChecksum:
+		return "checksum-lookup"
+	default:
+		return "download"
+	}
+}
+
+// httpClient is the client used for all HTTP requests made on behalf of
+// sources. It records each request made as part of an audited call.
+var httpClient = &http.Client{Transport: auditTransport{}}
+
+type auditTransport struct{}
+
+func (auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	roundTrip := http.DefaultTransport.RoundTrip
+	if c, ok := ctx.Value(cassetteKey{}).(*Cassette); ok {
+		roundTrip = func(req *http.Request) (*http.Response, error) {
+			return c.roundTrip(http.DefaultTransport, req)
+		}
+	}
+	if _, ok := ctx.Value(auditCallKey{}).(auditCall); !ok {
+		return roundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := roundTrip(req)
+	if err != nil {
+		recordNetwork(ctx, "http", req.URL.String(), 0, start, err)
+		return nil, err
+	}
+	resp.Body = &auditBody{ReadCloser: resp.Body, ctx: ctx, url: req.URL.String(), start: start}
+	return resp, nil
+}
+
+// auditBody records its request once the response body is closed, so that
+// the bytes read from it can be counted.
+type auditBody struct {
+	io.ReadCloser
+	ctx   context.Context
+	url   string
+	start time.Time
+	n     int64
+	once  sync.Once
+}
+
+func (b *auditBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *auditBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		recordNetwork(b.ctx, "http", b.url, b.n, b.start, nil)
+	})
+	return err
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestNetworkAudit(t *testing.T) {
+	srv := newTestRegistry(t, map[string]string{
+		"example.com/Foo/bar@v1.0.0/bar.go": "package bar\n",
+	})
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	var buf bytes.Buffer
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir:     h.Path("cache"),
+		Logger:       log.New(test.Writer{TB: t}, "", 0),
+		Registries:   map[string]string{"example.com": strings.Replace(srv.URL, "http://", "http://user:secret@", 1) + "/go"},
+		NetworkAudit: &buf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	ctx := context.Background()
+	id := ProjectIdentifier{ProjectRoot: "example.com/Foo/bar"}
+	if _, err = sm.ListPackages(ctx, id, NewVersion("v1.0.0").Pair("v1.0.0")); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("expected credentials to be left out of the audit log:\n%s", buf.String())
+	}
+
+	ops := make(map[string]NetworkOperation)
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var op NetworkOperation
+		if err = dec.Decode(&op); err != nil {
+			t.Fatal(err)
+		}
+		if op.Protocol != "http" || op.Host != "127.0.0.1" || op.Project != id.ProjectRoot {
+			t.Errorf("unexpected operation in audit log: %+v", op)
+		}
+		ops[op.Op+" "+op.URL[len(srv.URL):]] = op
+	}
+
+	if op, has := ops["download /go/example.com/%21foo/bar/@v/v1.0.0.zip"]; !has {
+		t.Errorf("expected the download of v1.0.0 to be audited, got %v", ops)
+	} else if op.Bytes == 0 {
+		t.Errorf("expected the bytes downloaded to be recorded, got %+v", op)
+	}
+	if _, has := ops["deduce /go/example.com/%21foo/bar/@v/list"]; !has {
+		t.Errorf("expected the deduction of example.com/Foo/bar to be audited, got %v", ops)
+	}
+}
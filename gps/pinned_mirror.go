@@ -0,0 +1,89 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// PinnedMirrorError is returned for projects pinned to a mirror or proxy (see
+// SourceManagerConfig.PinnedMirrors) that none of their sources can be
+// retrieved through.
+type PinnedMirrorError struct {
+	ProjectRoot ProjectRoot
+	URL         string // The mirror or proxy that the project is pinned to.
+}
+
+func (e *PinnedMirrorError) Error() string {
+	return fmt.Sprintf("%s is pinned to %s, which does not serve it", e.ProjectRoot, e.URL)
+}
+
+// pinnedSources returns the sources among mbs that can be set up for pr if it
+// is pinned to a mirror or proxy. If the pinned URL is that of a registry
+// source, only that source is returned. Otherwise, registry sources are left
+// out, and the pinned URL is used as the only mirror of those that remain. If
+// there are none, it returns a *PinnedMirrorError.
+//
+// Unless pr is pinned, mbs are returned as they are.
+func (sc *sourceCoordinator) pinnedSources(pr ProjectRoot, mbs maybeSources) (maybeSources, error) {
+	pin := sc.pinnedMirrors[pr]
+	if pin == "" {
+		return mbs, nil
+	}
+
+	var mirrorable maybeSources
+	for _, m := range mbs {
+		if _, ok := m.(maybeRegistrySource); !ok {
+			mirrorable = append(mirrorable, m)
+		} else if m.URL().String() == pin {
+			return maybeSources{m}, nil
+		}
+	}
+	if len(mirrorable) == 0 {
+		return nil, &PinnedMirrorError{ProjectRoot: pr, URL: pin}
+	}
+	return mirrorable, nil
+}
+
+// Mirror returns the URL of the mirror or proxy through which the source of
+// the project identified by id was retrieved or its versions listed, or the
+// empty string if it was upstream, and whether that is known. A project pinned
+// to a mirror or proxy always reports it, whether or not anything was
+// retrieved. Otherwise, it is only known once the project's source has been set
+// up by this SourceMgr, and, if it has mirrors to fail over to, retrieved or
+// listed; Mirror never sets up a source, nor retrieves anything, itself.
+func (sm *SourceMgr) Mirror(ctx context.Context, id ProjectIdentifier) (string, bool, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return "", false, ErrSourceManagerIsReleased
+	}
+
+	if pin := sm.srcCoord.pinnedMirrors[id.ProjectRoot]; pin != "" {
+		return pin, true, nil
+	}
+	srcg, has := sm.srcCoord.existingSourceGatewayFor(id)
+	if !has {
+		return "", false, nil
+	}
+	url, known := srcg.mirror()
+	return url, known, nil
+}
+
+// mirror returns the URL of the mirror or proxy that the source is pinned to,
+// or else that it was last retrieved through, if any, and whether that is
+// known.
+func (sg *sourceGateway) mirror() (string, bool) {
+	if sg.pinnedMirror != "" {
+		return sg.pinnedMirror, true
+	}
+	if _, ok := sg.src.(*registrySource); ok {
+		return sg.src.upstreamURL(), true
+	}
+	if rr, ok := sg.src.(retrievalReporter); ok {
+		return rr.retrievedFrom()
+	}
+	return "", true
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestPinnedMirrors(t *testing.T) {
+	requiresBins(t, "git")
+
+	srv := newTestRegistry(t, map[string]string{
+		"example.com/Foo/bar@v1.0.0/bar.go": "package bar\n",
+	})
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("mirror")
+	mirrorPath := h.Path("mirror")
+	h.RunGit(mirrorPath, "init")
+	h.RunGit(mirrorPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(mirrorPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(mirrorPath, "commit", "--allow-empty", `--message="Initial commit"`)
+	h.RunGit(mirrorPath, "tag", "v1.0.0")
+
+	mirrorURL := "file://" + filepath.ToSlash(mirrorPath)
+	registryURL := srv.URL + "/go/example.com/%21foo/bar"
+	newSM := func(cachedir string, pins map[ProjectRoot]string) *SourceMgr {
+		h.TempDir(cachedir)
+		sm, err := NewSourceManager(SourceManagerConfig{
+			Cachedir:      h.Path(cachedir),
+			Logger:        log.New(test.Writer{TB: t}, "", 0),
+			Registries:    map[string]string{"example.com": srv.URL + "/go"},
+			PinnedMirrors: pins,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sm
+	}
+
+	// No mirrors are configured; the pin alone sets this one up.
+	sm := newSM("cache", map[ProjectRoot]string{"github.com/sdboyer/gpkt": mirrorURL})
+	defer sm.Release()
+
+	ctx := context.Background()
+	gpkt := ProjectIdentifier{ProjectRoot: "github.com/sdboyer/gpkt"}
+	vl, err := sm.ListVersions(ctx, gpkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortPairedForUpgrade(vl)
+	if len(vl) != 2 || vl[0].String() != "v1.0.0" || vl[1].String() != "master" {
+		t.Errorf("expected the pinned mirror's versions, got %v", vl)
+	}
+	if m, known, err := sm.Mirror(ctx, gpkt); err != nil || !known || m != mirrorURL {
+		t.Errorf("expected the pinned mirror to be reported, got %q, %t, %v", m, known, err)
+	}
+
+	// Projects retrieved through a registry report it, to be pinned to it,
+	// but only once their source has been set up.
+	bar := ProjectIdentifier{ProjectRoot: "example.com/Foo/bar"}
+	if m, known, err := sm.Mirror(ctx, bar); err != nil || known {
+		t.Errorf("expected the mirror of a project not yet set up to be unknown, got %q, %t, %v", m, known, err)
+	}
+	if _, err = sm.ListVersions(ctx, bar); err != nil {
+		t.Fatal(err)
+	}
+	if m, known, err := sm.Mirror(ctx, bar); err != nil || !known || m != registryURL {
+		t.Errorf("expected the registry to be reported as %q, got %q, %t, %v", registryURL, m, known, err)
+	}
+
+	sm = newSM("other", map[ProjectRoot]string{"example.com/Foo/bar": "https://elsewhere.example.org/bar"})
+	defer sm.Release()
+	_, err = sm.ListVersions(ctx, bar)
+	if _, ok := errors.Cause(err).(*PinnedMirrorError); !ok {
+		t.Errorf("expected a project pinned to a mirror its sources can't use to be refused, got %v", err)
+	}
+}
+
+func TestGitSourceRetrievedFrom(t *testing.T) {
+	if from, known := (&gitSource{}).retrievedFrom(); !known || from != "" {
+		t.Errorf("expected a source without mirrors to be known to come from upstream, got %q, %t", from, known)
+	}
+
+	s := &gitSource{mirrors: []string{"https://mirror.example.org/foo"}}
+	if from, known := s.retrievedFrom(); known {
+		t.Errorf("expected where a source with mirrors came from to be unknown until it is retrieved, got %q", from)
+	}
+	s.setRetrievedFrom("")
+	if from, known := s.retrievedFrom(); !known || from != "" {
+		t.Errorf("expected a source retrieved from upstream to report it, got %q, %t", from, known)
+	}
+	s.setRetrievedFrom(s.mirrors[0])
+	if from, known := s.retrievedFrom(); !known || from != s.mirrors[0] {
+		t.Errorf("expected a source retrieved from a mirror to report it, got %q, %t", from, known)
+	}
+}
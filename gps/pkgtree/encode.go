@@ -0,0 +1,163 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+)
+
+// encodingVersion is the version of the JSON encoding of PackageTrees written
+// by WriteJSON. It must be incremented whenever the encoding changes in a way
+// that older versions of ReadJSON could not read.
+const encodingVersion = 1
+
+// encodedTree is the JSON encoding of a PackageTree. It is kept apart from
+// PackageTree itself, so that the encoding stays the same when the Go types
+// change.
+type encodedTree struct {
+	Version      int                       `json:"version"`
+	ImportRoot   string                    `json:"importRoot"`
+	Packages     map[string]encodedPackage `json:"packages"`
+	LicenseFiles map[string][]string       `json:"licenseFiles,omitempty"`
+}
+
+// encodedPackage is the JSON encoding of a PackageOrErr, which has either a
+// package or an error.
+type encodedPackage struct {
+	Name            string                      `json:"name,omitempty"`
+	ImportPath      string                      `json:"importPath,omitempty"`
+	CommentPath     string                      `json:"commentPath,omitempty"`
+	Imports         []string                    `json:"imports,omitempty"`
+	TestImports     []string                    `json:"testImports,omitempty"`
+	OtherFiles      []string                    `json:"otherFiles,omitempty"`
+	ParseErrors     []string                    `json:"parseErrors,omitempty"`
+	ImportPositions map[string][]ImportPosition `json:"importPositions,omitempty"`
+
+	Error *encodedError `json:"error,omitempty"`
+}
+
+// Kinds of encodedError, for the errors that ListPackages reports and that
+// callers are known to check the type of.
+const (
+	errKindNoGo                = "no-go"
+	errKindLocalImports        = "local-imports"
+	errKindNonCanonical        = "non-canonical-import-root"
+	errKindConflictingComments = "conflicting-import-comments"
+)
+
+// encodedError is the JSON encoding of the error of a PackageOrErr. Errors of
+// the kinds above are decoded to the same type they were encoded from; any
+// other error is decoded to one with the same message, and nothing more.
+type encodedError struct {
+	Kind       string   `json:"kind,omitempty"`
+	Message    string   `json:"message"`
+	ImportPath string   `json:"importPath,omitempty"`
+	Dir        string   `json:"dir,omitempty"`
+	Paths      []string `json:"paths,omitempty"`
+	ImportRoot string   `json:"importRoot,omitempty"`
+	Canonical  string   `json:"canonical,omitempty"`
+}
+
+func encodeError(err error) *encodedError {
+	ee := &encodedError{Message: err.Error()}
+	switch terr := err.(type) {
+	case *build.NoGoError:
+		ee.Kind, ee.Dir = errKindNoGo, terr.Dir
+	case *LocalImportsError:
+		ee.Kind, ee.ImportPath, ee.Dir, ee.Paths = errKindLocalImports, terr.ImportPath, terr.Dir, terr.LocalImports
+	case *NonCanonicalImportRoot:
+		ee.Kind, ee.ImportRoot, ee.Canonical = errKindNonCanonical, terr.ImportRoot, terr.Canonical
+	case *ConflictingImportComments:
+		ee.Kind, ee.ImportPath, ee.Paths = errKindConflictingComments, terr.ImportPath, terr.ConflictingImportComments
+	}
+	return ee
+}
+
+func (ee *encodedError) decode() error {
+	switch ee.Kind {
+	case errKindNoGo:
+		return &build.NoGoError{Dir: ee.Dir}
+	case errKindLocalImports:
+		return &LocalImportsError{ImportPath: ee.ImportPath, Dir: ee.Dir, LocalImports: ee.Paths}
+	case errKindNonCanonical:
+		return &NonCanonicalImportRoot{ImportRoot: ee.ImportRoot, Canonical: ee.Canonical}
+	case errKindConflictingComments:
+		return &ConflictingImportComments{ImportPath: ee.ImportPath, ConflictingImportComments: ee.Paths}
+	}
+	return errors.New(ee.Message)
+}
+
+// WriteJSON writes the PackageTree to w as a JSON object, which ReadJSON reads
+// back. The encoding is versioned, so that trees written out, as by a
+// persistent cache, are either read back as they were written or not at all.
+//
+// Errors in the tree of the types ListPackages reports, such as
+// *build.NoGoError and *LocalImportsError, are read back as the same type.
+// Other errors are read back with only their messages.
+func (t PackageTree) WriteJSON(w io.Writer) error {
+	et := encodedTree{
+		Version:      encodingVersion,
+		ImportRoot:   t.ImportRoot,
+		Packages:     make(map[string]encodedPackage, len(t.Packages)),
+		LicenseFiles: t.LicenseFiles,
+	}
+	for ip, poe := range t.Packages {
+		if poe.Err != nil {
+			et.Packages[ip] = encodedPackage{Error: encodeError(poe.Err)}
+			continue
+		}
+		p := poe.P
+		et.Packages[ip] = encodedPackage{
+			Name:            p.Name,
+			ImportPath:      p.ImportPath,
+			CommentPath:     p.CommentPath,
+			Imports:         p.Imports,
+			TestImports:     p.TestImports,
+			OtherFiles:      p.OtherFiles,
+			ParseErrors:     p.ParseErrors,
+			ImportPositions: p.ImportPositions,
+		}
+	}
+	return json.NewEncoder(w).Encode(et)
+}
+
+// ReadJSON reads a PackageTree written by WriteJSON from r. It fails if the
+// tree was written in a version of the encoding it does not know.
+func ReadJSON(r io.Reader) (PackageTree, error) {
+	var et encodedTree
+	if err := json.NewDecoder(r).Decode(&et); err != nil {
+		return PackageTree{}, fmt.Errorf("failed to decode package tree: %v", err)
+	}
+	if et.Version != encodingVersion {
+		return PackageTree{}, fmt.Errorf("unsupported package tree encoding version %d, expected %d", et.Version, encodingVersion)
+	}
+
+	t := PackageTree{
+		ImportRoot:   et.ImportRoot,
+		Packages:     make(map[string]PackageOrErr, len(et.Packages)),
+		LicenseFiles: et.LicenseFiles,
+	}
+	for ip, ep := range et.Packages {
+		if ep.Error != nil {
+			t.Packages[ip] = PackageOrErr{Err: ep.Error.decode()}
+			continue
+		}
+		t.Packages[ip] = PackageOrErr{P: Package{
+			Name:            ep.Name,
+			ImportPath:      ep.ImportPath,
+			CommentPath:     ep.CommentPath,
+			Imports:         ep.Imports,
+			TestImports:     ep.TestImports,
+			OtherFiles:      ep.OtherFiles,
+			ParseErrors:     ep.ParseErrors,
+			ImportPositions: ep.ImportPositions,
+		}}
+	}
+	return t, nil
+}
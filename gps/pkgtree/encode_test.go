@@ -0,0 +1,100 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"bytes"
+	"errors"
+	"go/build"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackageTreeJSONRoundTrip(t *testing.T) {
+	ptree := PackageTree{
+		ImportRoot: "root",
+		Packages: map[string]PackageOrErr{
+			"root": {
+				P: Package{
+					Name:        "root",
+					ImportPath:  "root",
+					CommentPath: "root",
+					Imports:     []string{"ext/a", "root/foo"},
+					TestImports: []string{"ext/test"},
+					OtherFiles:  []string{"data.txt"},
+					ParseErrors: []string{"bad.go:1:1: expected 'package'"},
+					ImportPositions: map[string][]ImportPosition{
+						"ext/a": {{File: "root.go", Line: 3, Column: 8}},
+					},
+				},
+			},
+			"root/foo": {
+				P: Package{
+					Name:       "foo",
+					ImportPath: "root/foo",
+				},
+			},
+			"root/nogo":    {Err: &build.NoGoError{Dir: "/src/root/nogo"}},
+			"root/relimp":  {Err: &LocalImportsError{ImportPath: "root/relimp", Dir: "/src/root/relimp", LocalImports: []string{"../foo"}}},
+			"root/canon":   {Err: &NonCanonicalImportRoot{ImportRoot: "root", Canonical: "other/canon"}},
+			"root/confl":   {Err: &ConflictingImportComments{ImportPath: "root/confl", ConflictingImportComments: []string{"a", "b"}}},
+			"root/unknown": {Err: errors.New("something else")},
+		},
+		LicenseFiles: map[string][]string{
+			"root": {"LICENSE"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := ptree.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, ptree) {
+		t.Errorf("package tree was not read back as written:\n\t(GOT): %#v\n\t(WNT): %#v", got, ptree)
+	}
+}
+
+func TestPackageTreeJSONListed(t *testing.T) {
+	// A tree as ListPackages returns it, errors and all, reads back the same.
+	fix := filepath.Join(getTestdataRootDir(t), "src", "varied")
+	ptree, err := ListPackages(fix, "varied")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = ptree.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := ptree.ToReachMap(true, true, false, nil)
+	rm, _ := got.ToReachMap(true, true, false, nil)
+	if !reflect.DeepEqual(rm, want) {
+		t.Errorf("reach map of read tree differs:\n\t(GOT): %v\n\t(WNT): %v", rm, want)
+	}
+}
+
+func TestReadJSONVersion(t *testing.T) {
+	for _, in := range []string{
+		`{"importRoot": "root", "packages": {}}`,
+		`{"version": 2, "importRoot": "root", "packages": {}}`,
+		`not json`,
+	} {
+		if _, err := ReadJSON(strings.NewReader(in)); err == nil {
+			t.Errorf("expected reading %s to fail", in)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ImportGraph is the direct import graph of the reachable packages in a
+// PackageTree. It is produced by PackageTree.ImportGraph().
+type ImportGraph struct {
+	// ImportRoot is the ImportRoot of the PackageTree the graph was built from.
+	ImportRoot string `json:"importRoot"`
+	// Internal maps the import path of each reachable tree-internal package to
+	// the sorted list of import paths it directly imports. Packages with errors
+	// are present, but have no imports.
+	Internal map[string][]string `json:"internal"`
+	// External is the sorted list of tree-external import paths directly
+	// imported by at least one package in Internal.
+	External []string `json:"external"`
+}
+
+// ImportGraph computes the direct import graph of the packages in the
+// PackageTree, for consumption by visualization tools.
+//
+// The "main", "tests" and "ignore" parameters behave as they do for
+// PackageTree.ToReachMap(). Only packages that would be retained by
+// TrimHiddenPackages() with the same parameters appear in the graph, and
+// imports of ignored packages are omitted, as are imports of tree-internal
+// packages that are not in the graph (e.g. because they don't exist).
+func (t PackageTree) ImportGraph(main, tests bool, ignore *IgnoredRuleset) ImportGraph {
+	g := ImportGraph{
+		ImportRoot: t.ImportRoot,
+		Internal:   make(map[string][]string),
+		External:   []string{},
+	}
+
+	t2 := t.TrimHiddenPackages(main, tests, ignore)
+	exm := make(map[string]bool)
+	for ip, poe := range t2.Packages {
+		imps := []string{}
+		if poe.Err != nil {
+			g.Internal[ip] = imps
+			continue
+		}
+
+		all := poe.P.Imports
+		if tests {
+			all = dedupeStrings(poe.P.Imports, poe.P.TestImports)
+		}
+
+		for _, imp := range all {
+			if ignore.IsIgnored(imp) || imp == "." {
+				continue
+			}
+
+			if eqOrSlashedPrefix(imp, t.ImportRoot) {
+				if _, has := t2.Packages[imp]; !has {
+					continue
+				}
+			} else {
+				exm[imp] = true
+			}
+			imps = append(imps, imp)
+		}
+
+		sort.Strings(imps)
+		g.Internal[ip] = imps
+	}
+
+	for ex := range exm {
+		g.External = append(g.External, ex)
+	}
+	sort.Strings(g.External)
+
+	return g
+}
+
+// WriteJSON writes the ImportGraph to w as a JSON object.
+func (g ImportGraph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the ImportGraph to w in the Graphviz DOT language.
+//
+// Tree-internal packages are drawn as boxes, and tree-external packages as
+// ellipses. Output is sorted, so that equivalent graphs produce identical
+// output.
+func (g ImportGraph) WriteDOT(w io.Writer) error {
+	var b bytes.Buffer
+
+	pkgs := make([]string, 0, len(g.Internal))
+	for ip := range g.Internal {
+		pkgs = append(pkgs, ip)
+	}
+	sort.Strings(pkgs)
+
+	b.WriteString("digraph {\n\tnode [shape=box];")
+	for _, ip := range pkgs {
+		fmt.Fprintf(&b, "\n\t%s;", strconv.Quote(ip))
+	}
+	for _, ex := range g.External {
+		fmt.Fprintf(&b, "\n\t%s [shape=ellipse];", strconv.Quote(ex))
+	}
+	for _, ip := range pkgs {
+		for _, imp := range g.Internal[ip] {
+			fmt.Fprintf(&b, "\n\t%s -> %s;", strconv.Quote(ip), strconv.Quote(imp))
+		}
+	}
+	b.WriteString("\n}\n")
+
+	_, err := b.WriteTo(w)
+	return err
+}
@@ -0,0 +1,175 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func importGraphTree() PackageTree {
+	return PackageTree{
+		ImportRoot: "root",
+		Packages: map[string]PackageOrErr{
+			"root": {
+				P: Package{
+					Name:        "root",
+					ImportPath:  "root",
+					Imports:     []string{"ext/a", "root/foo", "root/missing"},
+					TestImports: []string{"ext/test"},
+				},
+			},
+			"root/foo": {
+				P: Package{
+					Name:       "foo",
+					ImportPath: "root/foo",
+					Imports:    []string{"ext/b", "root/_hidden"},
+				},
+			},
+			"root/_hidden": {
+				P: Package{
+					Name:       "hidden",
+					ImportPath: "root/_hidden",
+					Imports:    []string{"ext/c"},
+				},
+			},
+			"root/_unreached": {
+				P: Package{
+					Name:       "unreached",
+					ImportPath: "root/_unreached",
+					Imports:    []string{"ext/d"},
+				},
+			},
+			"root/cmd": {
+				P: Package{
+					Name:       "main",
+					ImportPath: "root/cmd",
+					Imports:    []string{"ext/e", "root/foo"},
+				},
+			},
+			"root/bad": {
+				Err: errors.New("bad package"),
+			},
+		},
+	}
+}
+
+func TestImportGraph(t *testing.T) {
+	table := map[string]struct {
+		main, tests bool
+		ignore      []string
+		out         ImportGraph
+	}{
+		"no main, no tests": {
+			out: ImportGraph{
+				ImportRoot: "root",
+				Internal: map[string][]string{
+					"root":         {"ext/a", "root/foo"},
+					"root/foo":     {"ext/b", "root/_hidden"},
+					"root/_hidden": {"ext/c"},
+					"root/bad":     {},
+				},
+				External: []string{"ext/a", "ext/b", "ext/c"},
+			},
+		},
+		"main and tests": {
+			main:  true,
+			tests: true,
+			out: ImportGraph{
+				ImportRoot: "root",
+				Internal: map[string][]string{
+					"root":         {"ext/a", "ext/test", "root/foo"},
+					"root/foo":     {"ext/b", "root/_hidden"},
+					"root/_hidden": {"ext/c"},
+					"root/cmd":     {"ext/e", "root/foo"},
+					"root/bad":     {},
+				},
+				External: []string{"ext/a", "ext/b", "ext/c", "ext/e", "ext/test"},
+			},
+		},
+		"ignored": {
+			ignore: []string{"ext/a", "root/foo"},
+			out: ImportGraph{
+				ImportRoot: "root",
+				Internal: map[string][]string{
+					"root":     {},
+					"root/bad": {},
+				},
+				External: []string{},
+			},
+		},
+	}
+
+	for name, fix := range table {
+		fix := fix
+		t.Run(name, func(t *testing.T) {
+			got := importGraphTree().ImportGraph(fix.main, fix.tests, NewIgnoredRuleset(fix.ignore))
+			if !reflect.DeepEqual(got, fix.out) {
+				t.Errorf("ImportGraph did not return expected graph:\n\t(GOT): %v\n\t(WNT): %v", got, fix.out)
+			}
+		})
+	}
+}
+
+func TestImportGraphWriters(t *testing.T) {
+	g := importGraphTree().ImportGraph(false, false, nil)
+
+	var b bytes.Buffer
+	if err := g.WriteDOT(&b); err != nil {
+		t.Fatal(err)
+	}
+	wantDOT := `digraph {
+	node [shape=box];
+	"root";
+	"root/_hidden";
+	"root/bad";
+	"root/foo";
+	"ext/a" [shape=ellipse];
+	"ext/b" [shape=ellipse];
+	"ext/c" [shape=ellipse];
+	"root" -> "ext/a";
+	"root" -> "root/foo";
+	"root/_hidden" -> "ext/c";
+	"root/foo" -> "ext/b";
+	"root/foo" -> "root/_hidden";
+}
+`
+	if got := b.String(); got != wantDOT {
+		t.Errorf("unexpected DOT output:\n\t(GOT):\n%s\n\t(WNT):\n%s", got, wantDOT)
+	}
+
+	b.Reset()
+	if err := g.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := `{
+  "importRoot": "root",
+  "internal": {
+    "root": [
+      "ext/a",
+      "root/foo"
+    ],
+    "root/_hidden": [
+      "ext/c"
+    ],
+    "root/bad": [],
+    "root/foo": [
+      "ext/b",
+      "root/_hidden"
+    ]
+  },
+  "external": [
+    "ext/a",
+    "ext/b",
+    "ext/c"
+  ]
+}
+`
+	if got := b.String(); got != wantJSON {
+		t.Errorf("unexpected JSON output:\n\t(GOT):\n%s\n\t(WNT):\n%s", got, wantJSON)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// licenseFilePrefixes is a list of name prefixes for license files.
+	licenseFilePrefixes = []string{
+		"license",
+		"licence",
+		"copying",
+		"unlicense",
+		"copyright",
+		"copyleft",
+	}
+	// legalFileSubstrings contains substrings that are likey part of a legal
+	// declaration file.
+	legalFileSubstrings = []string{
+		"authors",
+		"contributors",
+		"legal",
+		"notice",
+		"disclaimer",
+		"patent",
+		"third-party",
+		"thirdparty",
+	}
+)
+
+// IsLicenseFile checks if the file name indicates that the file is a license,
+// notice or other legal declaration file.
+//
+// Go files, and other files that are built as part of a package, are never
+// considered to be license files.
+func IsLicenseFile(name string) bool {
+	if ext := filepath.Ext(name); ext == ".go" || otherSourceExts[ext] {
+		return false
+	}
+
+	name = strings.ToLower(name)
+
+	for _, prefix := range licenseFilePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	for _, substring := range legalFileSubstrings {
+		if strings.Contains(name, substring) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// licenseFiles returns the sorted subset of names, the entries of dir, that
+// are regular files for which IsLicenseFile returns true.
+func licenseFiles(dir string, names []string) []string {
+	var lf []string
+	for _, name := range names {
+		if !IsLicenseFile(name) {
+			continue
+		}
+		if fi, err := os.Stat(filepath.Join(dir, name)); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		lf = append(lf, name)
+	}
+	sort.Strings(lf)
+	return lf
+}
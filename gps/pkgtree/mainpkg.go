@@ -0,0 +1,148 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MainPackage describes a `package main` package - a command - found in a
+// PackageTree.
+type MainPackage struct {
+	ImportPath  string   // Full import path of the command
+	Dir         string   // Directory containing the command's source
+	Imports     []string // Imports from all non-test go files, across all build constraints
+	Constraints []string // Distinct build constraints found in the command's non-test go files, from //go:build lines, or +build lines in files without one
+	GoFiles     []string // Non-test go files that satisfy the build.Context passed to MainPackages
+}
+
+// Buildable indicates whether at least one of the command's non-test go files
+// satisfied the build.Context passed to MainPackages, and so whether `go build`
+// or `go install` could be expected to produce a binary for it.
+func (mp MainPackage) Buildable() bool {
+	return len(mp.GoFiles) > 0
+}
+
+// MainPackages lists all the main packages in the PackageTree, sorted by import
+// path, along with information about which of their files apply under the
+// provided build.Context. If ctx is nil, build.Default is used.
+//
+// fileRoot must be the same directory that was passed to ListPackages when the
+// PackageTree was created (e.g. a project's directory in vendor/); it is used to
+// locate each command's source. Packages with errors are skipped.
+func (t PackageTree) MainPackages(fileRoot string, ctx *build.Context) ([]MainPackage, error) {
+	if ctx == nil {
+		ctx = &build.Default
+	}
+
+	fileRoot, err := filepath.Abs(fileRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var mps []MainPackage
+	for ip, poe := range t.Packages {
+		if poe.Err != nil || poe.P.Name != "main" {
+			continue
+		}
+
+		mp := MainPackage{
+			ImportPath: ip,
+			Dir:        filepath.Join(fileRoot, filepath.FromSlash(strings.TrimPrefix(ip, t.ImportRoot))),
+			Imports:    poe.P.Imports,
+		}
+		if err = fillMainPackage(&mp, ctx); err != nil {
+			return nil, err
+		}
+		mps = append(mps, mp)
+	}
+
+	sort.Slice(mps, func(i, j int) bool {
+		return mps[i].ImportPath < mps[j].ImportPath
+	})
+	return mps, nil
+}
+
+// fillMainPackage computes the build constraint information for mp. Assumes
+// mp.Dir is set.
+func fillMainPackage(mp *MainPackage, ctx *build.Context) error {
+	var (
+		goBuildPrefix = "//go:build "
+		buildPrefix   = "// +build "
+	)
+
+	gofiles, err := filepath.Glob(filepath.Join(mp.Dir, "*.go"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range gofiles {
+		fname := filepath.Base(file)
+		// Skip underscore-led or dot-led files, and tests, in keeping with
+		// the rest of the toolchain.
+		if fname[0] == '_' || fname[0] == '.' || strings.HasSuffix(fname, "_test.go") {
+			continue
+		}
+
+		// Skip any directories that happened to get caught by glob
+		if stat, err := os.Stat(file); err == nil && stat.IsDir() {
+			continue
+		}
+
+		pf, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil {
+			if os.IsPermission(err) {
+				continue
+			}
+			return err
+		}
+		if pf.Name.Name != "main" {
+			continue
+		}
+
+		// As with the toolchain, a //go:build line supersedes any +build
+		// lines in the same file.
+		var goBuild string
+		var plusBuild []string
+		for _, c := range pf.Comments {
+			// Build constraints must come before the package clause.
+			if c.Pos() > pf.Package {
+				continue
+			}
+			for _, cl := range c.List {
+				switch {
+				case strings.HasPrefix(cl.Text, goBuildPrefix):
+					goBuild = strings.TrimSpace(cl.Text[len(goBuildPrefix):])
+				case strings.HasPrefix(cl.Text, buildPrefix):
+					plusBuild = append(plusBuild, strings.TrimSpace(cl.Text[len(buildPrefix):]))
+				}
+			}
+		}
+		if goBuild != "" {
+			mp.Constraints = append(mp.Constraints, goBuild)
+		} else {
+			mp.Constraints = append(mp.Constraints, plusBuild...)
+		}
+
+		match, err := ctx.MatchFile(mp.Dir, fname)
+		if err != nil {
+			return err
+		}
+		if match {
+			mp.GoFiles = append(mp.GoFiles, fname)
+		}
+	}
+
+	if len(mp.Constraints) > 0 {
+		mp.Constraints = uniq(mp.Constraints)
+	}
+	return nil
+}
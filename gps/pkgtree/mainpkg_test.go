@@ -0,0 +1,106 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"go/build"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMainPackages(t *testing.T) {
+	root := filepath.Join(getTestdataRootDir(t), "src", "mains")
+	ptree, err := ListPackages(root, "mains")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	linux := build.Default
+	linux.GOOS, linux.GOARCH = "linux", "amd64"
+	linux.BuildTags = nil
+
+	darwinTools := linux
+	darwinTools.GOOS = "darwin"
+	darwinTools.BuildTags = []string{"tools"}
+
+	table := map[string]struct {
+		ctx *build.Context
+		out []MainPackage
+	}{
+		"linux": {
+			ctx: &linux,
+			out: []MainPackage{
+				{
+					ImportPath:  "mains/cmd/gobuild",
+					Dir:         filepath.Join(root, "cmd", "gobuild"),
+					Constraints: []string{"tools && !windows"},
+				},
+				{
+					ImportPath: "mains/cmd/linuxonly",
+					Dir:        filepath.Join(root, "cmd", "linuxonly"),
+					GoFiles:    []string{"main_linux.go"},
+				},
+				{
+					ImportPath: "mains/cmd/plain",
+					Dir:        filepath.Join(root, "cmd", "plain"),
+					Imports:    []string{"mains/lib"},
+					GoFiles:    []string{"main.go"},
+				},
+				{
+					ImportPath:  "mains/cmd/tools",
+					Dir:         filepath.Join(root, "cmd", "tools"),
+					Constraints: []string{"tools"},
+				},
+			},
+		},
+		"darwin with tools tag": {
+			ctx: &darwinTools,
+			out: []MainPackage{
+				{
+					ImportPath:  "mains/cmd/gobuild",
+					Dir:         filepath.Join(root, "cmd", "gobuild"),
+					Constraints: []string{"tools && !windows"},
+					GoFiles:     []string{"main.go"},
+				},
+				{
+					ImportPath: "mains/cmd/linuxonly",
+					Dir:        filepath.Join(root, "cmd", "linuxonly"),
+				},
+				{
+					ImportPath: "mains/cmd/plain",
+					Dir:        filepath.Join(root, "cmd", "plain"),
+					Imports:    []string{"mains/lib"},
+					GoFiles:    []string{"main.go"},
+				},
+				{
+					ImportPath:  "mains/cmd/tools",
+					Dir:         filepath.Join(root, "cmd", "tools"),
+					Constraints: []string{"tools"},
+					GoFiles:     []string{"main.go"},
+				},
+			},
+		},
+	}
+
+	for name, fix := range table {
+		fix := fix
+		t.Run(name, func(t *testing.T) {
+			got, err := ptree.MainPackages(root, fix.ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Normalize the empty import lists produced by ListPackages.
+			for i := range got {
+				if len(got[i].Imports) == 0 {
+					got[i].Imports = nil
+				}
+			}
+			if !reflect.DeepEqual(got, fix.out) {
+				t.Errorf("MainPackages did not return expected results:\n\t(GOT): %#v\n\t(WNT): %#v", got, fix.out)
+			}
+		})
+	}
+}
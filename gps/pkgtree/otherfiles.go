@@ -0,0 +1,172 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"bufio"
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// otherSourceExts is the set of non-go file extensions that the go toolchain
+// compiles, links or includes as part of a package.
+//
+// Refer to: https://github.com/golang/go/blob/release-branch.go1.9/src/go/build/build.go#L750
+var otherSourceExts = map[string]bool{
+	".c":       true,
+	".cc":      true,
+	".cpp":     true,
+	".cxx":     true,
+	".m":       true,
+	".h":       true,
+	".hh":      true,
+	".hpp":     true,
+	".hxx":     true,
+	".f":       true,
+	".F":       true,
+	".for":     true,
+	".f90":     true,
+	".s":       true,
+	".S":       true,
+	".swig":    true,
+	".swigcxx": true,
+	".syso":    true,
+}
+
+// otherSourceFiles lists the files directly within dir that the go toolchain
+// would build as part of the package there, other than go files.
+func otherSourceFiles(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range names {
+		// Skip underscore-led or dot-led files, in keeping with the rest of the toolchain.
+		if name[0] == '_' || name[0] == '.' || !otherSourceExts[filepath.Ext(name)] {
+			continue
+		}
+		if fi, err := os.Stat(filepath.Join(dir, name)); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// cgoIncludes finds quoted #include directives in the cgo preambles of pf,
+// returning those that refer to files existing on disk relative to dir.
+//
+// Angle-bracketed includes are ignored, as they refer to system headers.
+func cgoIncludes(dir string, pf *ast.File) []string {
+	var files []string
+	for _, inc := range quotedIncludes(pf) {
+		if rel, ok := relExisting(dir, filepath.Join(dir, filepath.FromSlash(inc))); ok {
+			files = append(files, rel)
+		}
+	}
+	return files
+}
+
+// CgoIncludes returns the slash-separated paths, relative to the directory of
+// the go file src, of the files included by quoted #include directives in its
+// cgo preamble, whether or not they exist. It returns nil if src does not use
+// cgo.
+func CgoIncludes(src []byte) ([]string, error) {
+	pf, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, is := range pf.Imports {
+		if name, _ := strconv.Unquote(is.Path.Value); name == "C" {
+			incs := quotedIncludes(pf)
+			for i, inc := range incs {
+				incs[i] = path.Clean(inc)
+			}
+			return incs, nil
+		}
+	}
+	return nil, nil
+}
+
+// quotedIncludes returns the paths of the quoted #include directives in the
+// comments of pf, as they are written.
+func quotedIncludes(pf *ast.File) []string {
+	var incs []string
+	for _, c := range pf.Comments {
+		for _, line := range strings.Split(c.Text(), "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "#include") {
+				continue
+			}
+			inc, err := strconv.Unquote(strings.TrimSpace(line[len("#include"):]))
+			if err != nil || inc == "" {
+				continue
+			}
+			incs = append(incs, inc)
+		}
+	}
+	return incs
+}
+
+// embedPatterns finds //go:embed directives in src, returning the files and
+// directories, relative to dir, that their patterns match.
+func embedPatterns(dir string, src []byte) []string {
+	directive := []byte("//go:embed")
+	if !bytes.Contains(src, directive) {
+		return nil
+	}
+
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if !bytes.HasPrefix(line, directive) {
+			continue
+		}
+		for _, pattern := range strings.Fields(string(line[len(directive):])) {
+			if unq, err := strconv.Unquote(pattern); err == nil {
+				pattern = unq
+			}
+			matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+			if err != nil {
+				continue
+			}
+			for _, m := range matches {
+				if rel, ok := relExisting(dir, m); ok {
+					files = append(files, rel)
+				}
+			}
+		}
+	}
+	return files
+}
+
+// relExisting returns the slash-separated path of target relative to dir, if
+// target exists.
+func relExisting(dir, target string) (string, bool) {
+	if _, err := os.Stat(target); err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
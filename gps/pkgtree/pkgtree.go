@@ -12,6 +12,7 @@ import (
 	"go/parser"
 	gscan "go/scanner"
 	"go/token"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -28,6 +29,25 @@ type Package struct {
 	CommentPath string   // Import path given in the comment on the package statement
 	Imports     []string // Imports from all go and cgo files
 	TestImports []string // Imports from all go test files (in go/build parlance: both TestImports and XTestImports)
+	OtherFiles  []string // Non-go files plausibly needed to build or run the package, slash-separated and relative to its directory
+	ParseErrors []string // Errors from go files that failed to parse, when listing with ListOptions.TolerateParseErrors
+
+	// ImportPositions maps each of Imports and TestImports to the positions of
+	// the import declarations that introduced it. Only populated when listing
+	// with ListOptions.ImportPositions.
+	ImportPositions map[string][]ImportPosition
+}
+
+// ImportPosition identifies the location of an import declaration within a
+// package's source.
+type ImportPosition struct {
+	File   string // Name of the file, within the package's directory
+	Line   int    // Line number, starting at 1
+	Column int    // Column number, starting at 1 (byte count)
+}
+
+func (p ImportPosition) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
 }
 
 // vcsRoots is a set of directories we should not descend into in ListPackages when
@@ -62,18 +82,83 @@ var vcsRoots = map[string]struct{}{
 // to PackageOrErr - each path under the root that exists will have either a
 // Package, or an error describing why the directory is not a valid package.
 func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
+	return ListPackagesWithOptions(fileRoot, importRoot, ListOptions{})
+}
+
+// ListOptions control the behavior of ListPackagesWithOptions and
+// WalkPackagesWithOptions. The zero value provides the behavior of
+// ListPackages and WalkPackages.
+type ListOptions struct {
+	// TolerateParseErrors causes go files that cannot be parsed to be skipped,
+	// with the errors recorded in Package.ParseErrors, rather than causing the
+	// whole package to be recorded as an error. This keeps a single broken
+	// file from poisoning the analysis of everything that imports the package.
+	//
+	// Packages in which no go files can be parsed are still errors.
+	TolerateParseErrors bool
+
+	// ImportPositions causes the position of every import declaration to be
+	// retained, in Package.ImportPositions, for use in diagnostics.
+	ImportPositions bool
+}
+
+// ListPackagesWithOptions is ListPackages, with its behavior modified by
+// opts.
+func ListPackagesWithOptions(fileRoot, importRoot string, opts ListOptions) (PackageTree, error) {
 	ptree := PackageTree{
 		ImportRoot: importRoot,
 		Packages:   make(map[string]PackageOrErr),
 	}
 
+	err := WalkPackagesWithOptions(fileRoot, importRoot, opts, func(ip string, poe PackageOrErr, licenseFiles []string) error {
+		ptree.Packages[ip] = poe
+		if len(licenseFiles) > 0 {
+			if ptree.LicenseFiles == nil {
+				ptree.LicenseFiles = make(map[string][]string)
+			}
+			ptree.LicenseFiles[ip] = licenseFiles
+		}
+		return nil
+	})
+
+	if err != nil {
+		return PackageTree{}, err
+	}
+
+	return ptree, nil
+}
+
+// WalkPackagesFunc is the type of the function called by WalkPackages for
+// each directory it visits. ip is the directory's import path, poe the result
+// of parsing it, and licenseFiles the names of any license files (see
+// IsLicenseFile) within it.
+//
+// If the function returns filepath.SkipDir, WalkPackages will not descend
+// into the directory. Any other non-nil error stops the walk, and is returned
+// from WalkPackages.
+type WalkPackagesFunc func(ip string, poe PackageOrErr, licenseFiles []string) error
+
+// WalkPackages is the streaming form of ListPackages. Rather than collecting
+// the results into a PackageTree, it calls fn with each directory's results as
+// soon as they have been parsed, in lexical order, so that memory use can
+// remain bounded on very large trees.
+//
+// The fileRoot and importRoot parameters have the same meaning as with
+// ListPackages, and each directory is reported exactly as it would appear in
+// the PackageTree that ListPackages would return.
+func WalkPackages(fileRoot, importRoot string, fn WalkPackagesFunc) error {
+	return WalkPackagesWithOptions(fileRoot, importRoot, ListOptions{}, fn)
+}
+
+// WalkPackagesWithOptions is WalkPackages, with its behavior modified by opts.
+func WalkPackagesWithOptions(fileRoot, importRoot string, opts ListOptions, fn WalkPackagesFunc) error {
 	var err error
 	fileRoot, err = filepath.Abs(fileRoot)
 	if err != nil {
-		return PackageTree{}, err
+		return err
 	}
 
-	err = filepath.Walk(fileRoot, func(wp string, fi os.FileInfo, err error) error {
+	return filepath.Walk(fileRoot, func(wp string, fi os.FileInfo, err error) error {
 		if err != nil && err != filepath.SkipDir {
 			if os.IsPermission(err) {
 				return filepath.SkipDir
@@ -102,6 +187,12 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 			return filepath.SkipDir
 		}
 
+		// Compute the import path. Run the result through ToSlash(), so that
+		// windows file paths are normalized to slashes, as is expected of
+		// import paths.
+		ip := filepath.ToSlash(filepath.Join(importRoot, strings.TrimPrefix(wp, fileRoot)))
+
+		var lf []string
 		{
 			// For Go 1.9 and earlier:
 			//
@@ -123,30 +214,36 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 				}
 				return err
 			}
+
+			// While the directory is open, look for any license files in it.
+			var names []string
+			names, err = f.Readdirnames(-1)
 			f.Close()
+			if err != nil {
+				if os.IsPermission(err) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			lf = licenseFiles(wp, names)
 		}
 
-		// Compute the import path. Run the result through ToSlash(), so that
-		// windows file paths are normalized to slashes, as is expected of
-		// import paths.
-		ip := filepath.ToSlash(filepath.Join(importRoot, strings.TrimPrefix(wp, fileRoot)))
-
 		// Find all the imports, across all os/arch combos
 		p := &build.Package{
 			Dir:        wp,
 			ImportPath: ip,
 		}
-		err = fillPackage(p)
+		var extras pkgExtras
+		extras, err = fillPackage(p, opts)
 
 		if err != nil {
 			switch err.(type) {
 			case gscan.ErrorList, *gscan.Error, *build.NoGoError, *ConflictingImportComments:
 				// Assorted cases in which we've encounter malformed or
 				// nonexistent Go source code.
-				ptree.Packages[ip] = PackageOrErr{
+				return fn(ip, PackageOrErr{
 					Err: err,
-				}
-				return nil
+				}, lf)
 			default:
 				return err
 			}
@@ -158,16 +255,19 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 			Name:        p.Name,
 			Imports:     p.Imports,
 			TestImports: dedupeStrings(p.TestImports, p.XTestImports),
+			OtherFiles:  extras.otherFiles,
+			ParseErrors: extras.parseErrors,
+
+			ImportPositions: extras.importPositions,
 		}
 
 		if pkg.CommentPath != "" && !strings.HasPrefix(pkg.CommentPath, importRoot) {
-			ptree.Packages[ip] = PackageOrErr{
+			return fn(ip, PackageOrErr{
 				Err: &NonCanonicalImportRoot{
 					ImportRoot: importRoot,
 					Canonical:  pkg.CommentPath,
 				},
-			}
-			return nil
+			}, lf)
 		}
 
 		// This area has some...fuzzy rules, but check all the imports for
@@ -185,31 +285,37 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 		}
 
 		if len(lim) > 0 {
-			ptree.Packages[ip] = PackageOrErr{
+			return fn(ip, PackageOrErr{
 				Err: &LocalImportsError{
 					Dir:          wp,
 					ImportPath:   ip,
 					LocalImports: lim,
 				},
-			}
-		} else {
-			ptree.Packages[ip] = PackageOrErr{
-				P: pkg,
-			}
+			}, lf)
 		}
 
-		return nil
+		return fn(ip, PackageOrErr{
+			P: pkg,
+		}, lf)
 	})
+}
 
-	if err != nil {
-		return PackageTree{}, err
-	}
-
-	return ptree, nil
+// pkgExtras holds the information gathered by fillPackage that has no
+// counterpart in build.Package.
+type pkgExtras struct {
+	// The non-go files in or referenced by the package that are plausibly
+	// needed to build or run it; see otherSourceFiles, cgoIncludes and
+	// embedPatterns.
+	otherFiles []string
+	// The errors from files that failed to parse, if parse errors are being
+	// tolerated.
+	parseErrors []string
+	// The positions of import declarations, if requested.
+	importPositions map[string][]ImportPosition
 }
 
 // fillPackage full of info. Assumes p.Dir is set at a minimum
-func fillPackage(p *build.Package) error {
+func fillPackage(p *build.Package, opts ListOptions) (pkgExtras, error) {
 	var buildPrefix = "// +build "
 	var buildFieldSplit = func(r rune) bool {
 		return unicode.IsSpace(r) || r == ','
@@ -217,16 +323,19 @@ func fillPackage(p *build.Package) error {
 
 	gofiles, err := filepath.Glob(filepath.Join(p.Dir, "*.go"))
 	if err != nil {
-		return err
+		return pkgExtras{}, err
 	}
 
 	if len(gofiles) == 0 {
-		return &build.NoGoError{Dir: p.Dir}
+		return pkgExtras{}, &build.NoGoError{Dir: p.Dir}
 	}
 
 	var testImports []string
 	var imports []string
 	var importComments []string
+	var extras pkgExtras
+	var parsed int
+	var firstParseErr error
 	for _, file := range gofiles {
 		// Skip underscore-led or dot-led files, in keeping with the rest of the toolchain.
 		bPrefix := filepath.Base(file)[0]
@@ -239,13 +348,28 @@ func fillPackage(p *build.Package) error {
 			continue
 		}
 
-		pf, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly|parser.ParseComments)
+		src, err := ioutil.ReadFile(file)
 		if err != nil {
 			if os.IsPermission(err) {
 				continue
 			}
-			return err
+			return pkgExtras{}, err
 		}
+
+		fset := token.NewFileSet()
+		pf, err := parser.ParseFile(fset, file, src, parser.ImportsOnly|parser.ParseComments)
+		if err != nil {
+			if !opts.TolerateParseErrors {
+				return pkgExtras{}, err
+			}
+			// Record the problem, and carry on with the rest of the files.
+			if firstParseErr == nil {
+				firstParseErr = err
+			}
+			extras.parseErrors = append(extras.parseErrors, err.Error())
+			continue
+		}
+		parsed++
 		testFile := strings.HasSuffix(file, "_test.go")
 		fname := filepath.Base(file)
 
@@ -291,10 +415,25 @@ func fillPackage(p *build.Package) error {
 			p.GoFiles = append(p.GoFiles, fname)
 		}
 
+		var cgo bool
 		for _, is := range pf.Imports {
 			name, err := strconv.Unquote(is.Path.Value)
 			if err != nil {
-				return err // can't happen?
+				return pkgExtras{}, err // can't happen?
+			}
+			if name == "C" {
+				cgo = true
+			}
+			if opts.ImportPositions {
+				if extras.importPositions == nil {
+					extras.importPositions = make(map[string][]ImportPosition)
+				}
+				pos := fset.Position(is.Pos())
+				extras.importPositions[name] = append(extras.importPositions[name], ImportPosition{
+					File:   fname,
+					Line:   pos.Line,
+					Column: pos.Column,
+				})
 			}
 			if testFile {
 				testImports = append(testImports, name)
@@ -302,10 +441,22 @@ func fillPackage(p *build.Package) error {
 				imports = append(imports, name)
 			}
 		}
+
+		if cgo {
+			extras.otherFiles = append(extras.otherFiles, cgoIncludes(p.Dir, pf)...)
+		}
+		extras.otherFiles = append(extras.otherFiles, embedPatterns(p.Dir, src)...)
 	}
+
+	// Even when tolerating parse errors, a package with no parseable files
+	// at all is no package.
+	if parsed == 0 && firstParseErr != nil {
+		return pkgExtras{}, firstParseErr
+	}
+
 	importComments = uniq(importComments)
 	if len(importComments) > 1 {
-		return &ConflictingImportComments{
+		return pkgExtras{}, &ConflictingImportComments{
 			ImportPath:                p.ImportPath,
 			ConflictingImportComments: importComments,
 		}
@@ -317,7 +468,18 @@ func fillPackage(p *build.Package) error {
 	testImports = uniq(testImports)
 	p.Imports = imports
 	p.TestImports = testImports
-	return nil
+
+	osf, err := otherSourceFiles(p.Dir)
+	if err != nil {
+		return pkgExtras{}, err
+	}
+	extras.otherFiles = append(extras.otherFiles, osf...)
+	if len(extras.otherFiles) > 0 {
+		extras.otherFiles = uniq(extras.otherFiles)
+	} else {
+		extras.otherFiles = nil
+	}
+	return extras, nil
 }
 
 var (
@@ -466,9 +628,14 @@ func missingPkgErr(pkg string) error {
 // packages, starting at the ImportRoot. The results of parsing the files in the
 // directory identified by each import path - a Package or an error - are stored
 // in the Packages map, keyed by that import path.
+//
+// The names of any license or notice files (see IsLicenseFile) found in those
+// same directories are stored in the LicenseFiles map, also keyed by import
+// path. Directories without such files have no entry.
 type PackageTree struct {
-	ImportRoot string
-	Packages   map[string]PackageOrErr
+	ImportRoot   string
+	Packages     map[string]PackageOrErr
+	LicenseFiles map[string][]string
 }
 
 // ToReachMap looks through a PackageTree and computes the list of external
@@ -607,8 +774,9 @@ func (t PackageTree) ToReachMap(main, tests, backprop bool, ignore *IgnoredRules
 // mutations.
 func (t PackageTree) Copy() PackageTree {
 	return PackageTree{
-		ImportRoot: t.ImportRoot,
-		Packages:   CopyPackages(t.Packages, nil),
+		ImportRoot:   t.ImportRoot,
+		Packages:     CopyPackages(t.Packages, nil),
+		LicenseFiles: CopyLicenseFiles(t.LicenseFiles, nil),
 	}
 }
 
@@ -619,7 +787,7 @@ func CopyPackages(p map[string]PackageOrErr, fn func(string, PackageOrErr) (stri
 	// need, then allocate them all at once.
 	strcount := 0
 	for _, poe := range p {
-		strcount = strcount + len(poe.P.Imports) + len(poe.P.TestImports)
+		strcount = strcount + len(poe.P.Imports) + len(poe.P.TestImports) + len(poe.P.OtherFiles) + len(poe.P.ParseErrors)
 	}
 	pool := make([]string, strcount)
 
@@ -630,7 +798,7 @@ func CopyPackages(p map[string]PackageOrErr, fn func(string, PackageOrErr) (stri
 			poe2.Err = poe.Err
 		} else {
 			poe2.P = poe.P
-			il, til := len(poe.P.Imports), len(poe.P.TestImports)
+			il, til, ofl, pel := len(poe.P.Imports), len(poe.P.TestImports), len(poe.P.OtherFiles), len(poe.P.ParseErrors)
 			if il > 0 {
 				poe2.P.Imports, pool = pool[:il], pool[il:]
 				copy(poe2.P.Imports, poe.P.Imports)
@@ -639,6 +807,20 @@ func CopyPackages(p map[string]PackageOrErr, fn func(string, PackageOrErr) (stri
 				poe2.P.TestImports, pool = pool[:til], pool[til:]
 				copy(poe2.P.TestImports, poe.P.TestImports)
 			}
+			if ofl > 0 {
+				poe2.P.OtherFiles, pool = pool[:ofl], pool[ofl:]
+				copy(poe2.P.OtherFiles, poe.P.OtherFiles)
+			}
+			if pel > 0 {
+				poe2.P.ParseErrors, pool = pool[:pel], pool[pel:]
+				copy(poe2.P.ParseErrors, poe.P.ParseErrors)
+			}
+			if len(poe.P.ImportPositions) > 0 {
+				poe2.P.ImportPositions = make(map[string][]ImportPosition, len(poe.P.ImportPositions))
+				for imp, pos := range poe.P.ImportPositions {
+					poe2.P.ImportPositions[imp] = append([]ImportPosition(nil), pos...)
+				}
+			}
 		}
 		if fn != nil {
 			path, poe2 = fn(path, poe2)
@@ -649,6 +831,23 @@ func CopyPackages(p map[string]PackageOrErr, fn func(string, PackageOrErr) (stri
 	return p2
 }
 
+// CopyLicenseFiles returns a deep copy of lf, optionally modifying the keys
+// with fn. A nil map is returned if lf is empty.
+func CopyLicenseFiles(lf map[string][]string, fn func(string) string) map[string][]string {
+	if len(lf) == 0 {
+		return nil
+	}
+
+	lf2 := make(map[string][]string, len(lf))
+	for path, names := range lf {
+		if fn != nil {
+			path = fn(path)
+		}
+		lf2[path] = append([]string(nil), names...)
+	}
+	return lf2
+}
+
 // TrimHiddenPackages returns a new PackageTree where packages that are ignored,
 // or both hidden and unreachable, have been removed.
 //
@@ -701,6 +900,7 @@ func (t PackageTree) TrimHiddenPackages(main, tests bool, ignore *IgnoredRuleset
 	for ip := range t.Packages {
 		if !preserve[ip] {
 			delete(t2.Packages, ip)
+			delete(t2.LicenseFiles, ip)
 		}
 	}
 
@@ -1442,6 +1442,45 @@ func TestListPackages(t *testing.T) {
 				},
 			},
 		},
+		"non-go and license files": {
+			fileRoot:   j("otherfiles"),
+			importRoot: "otherfiles",
+			out: PackageTree{
+				ImportRoot: "otherfiles",
+				Packages: map[string]PackageOrErr{
+					"otherfiles": {
+						P: Package{
+							ImportPath:  "otherfiles",
+							CommentPath: "",
+							Name:        "otherfiles",
+							Imports: []string{
+								"C",
+								"embed",
+							},
+							OtherFiles: []string{
+								"asm_amd64.s",
+								"include/thing.h",
+								"templates/a.tmpl",
+							},
+						},
+					},
+					"otherfiles/include": {
+						Err: &build.NoGoError{
+							Dir: j("otherfiles/include"),
+						},
+					},
+					"otherfiles/templates": {
+						Err: &build.NoGoError{
+							Dir: j("otherfiles/templates"),
+						},
+					},
+				},
+				LicenseFiles: map[string][]string{
+					"otherfiles":         {"LICENSE"},
+					"otherfiles/include": {"NOTICE.txt"},
+				},
+			},
+		},
 	}
 
 	for name, fix := range table {
@@ -1463,6 +1502,9 @@ func TestListPackages(t *testing.T) {
 			}
 
 			if fix.out.ImportRoot != "" && fix.out.Packages != nil {
+				if !reflect.DeepEqual(out.LicenseFiles, fix.out.LicenseFiles) {
+					t.Errorf("Did not get expected LicenseFiles:\n\t(GOT): %#v\n\t(WNT): %#v", out.LicenseFiles, fix.out.LicenseFiles)
+				}
 				if !reflect.DeepEqual(out, fix.out) {
 					if fix.out.ImportRoot != out.ImportRoot {
 						t.Errorf("Expected ImportRoot %s, got %s", fix.out.ImportRoot, out.ImportRoot)
@@ -1509,6 +1551,131 @@ func TestListPackages(t *testing.T) {
 	}
 }
 
+func TestListPackagesTolerateParseErrors(t *testing.T) {
+	srcdir := filepath.Join(getTestdataRootDir(t), "src")
+
+	strict, err := ListPackages(filepath.Join(srcdir, "partbad"), "partbad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strict.Packages["partbad"].Err == nil {
+		t.Error("expected a package error without TolerateParseErrors")
+	}
+
+	opts := ListOptions{TolerateParseErrors: true}
+	tolerant, err := ListPackagesWithOptions(filepath.Join(srcdir, "partbad"), "partbad", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poe := tolerant.Packages["partbad"]
+	if poe.Err != nil {
+		t.Fatalf("expected no package error with TolerateParseErrors, got %s", poe.Err)
+	}
+	if want := []string{"sort"}; !reflect.DeepEqual(poe.P.Imports, want) {
+		t.Errorf("expected imports from the parseable file only:\n\t(GOT): %v\n\t(WNT): %v", poe.P.Imports, want)
+	}
+	if len(poe.P.ParseErrors) != 1 || !strings.Contains(poe.P.ParseErrors[0], "broken.go") {
+		t.Errorf("expected a single parse error for broken.go, got %q", poe.P.ParseErrors)
+	}
+
+	// A package with no parseable files remains an error.
+	bad, err := ListPackagesWithOptions(filepath.Join(srcdir, "bad"), "bad", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bad.Packages["bad"].Err.(scanner.ErrorList); !ok {
+		t.Errorf("expected a scanner.ErrorList for a package with no parseable files, got %#v", bad.Packages["bad"])
+	}
+}
+
+func TestListPackagesImportPositions(t *testing.T) {
+	fileRoot := filepath.Join(getTestdataRootDir(t), "src", "partbad")
+
+	ptree, err := ListPackagesWithOptions(fileRoot, "partbad", ListOptions{TolerateParseErrors: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip := ptree.Packages["partbad"].P.ImportPositions; ip != nil {
+		t.Errorf("expected no import positions unless requested, got %v", ip)
+	}
+
+	ptree, err = ListPackagesWithOptions(fileRoot, "partbad", ListOptions{TolerateParseErrors: true, ImportPositions: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]ImportPosition{
+		"sort": {{File: "good.go", Line: 7, Column: 8}},
+	}
+	got := ptree.Packages["partbad"].P.ImportPositions
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected import positions:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+	if s := got["sort"][0].String(); s != "good.go:7:8" {
+		t.Errorf("unexpected ImportPosition string %q", s)
+	}
+
+	// Positions survive a copy.
+	if cgot := ptree.Copy().Packages["partbad"].P.ImportPositions; !reflect.DeepEqual(cgot, want) {
+		t.Errorf("import positions not copied:\n\t(GOT): %v\n\t(WNT): %v", cgot, want)
+	}
+}
+
+func TestWalkPackages(t *testing.T) {
+	fileRoot := filepath.Join(getTestdataRootDir(t), "src", "otherfiles")
+	want, err := ListPackages(fileRoot, "otherfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := PackageTree{
+		ImportRoot: "otherfiles",
+		Packages:   make(map[string]PackageOrErr),
+	}
+	var order []string
+	err = WalkPackages(fileRoot, "otherfiles", func(ip string, poe PackageOrErr, licenseFiles []string) error {
+		order = append(order, ip)
+		got.Packages[ip] = poe
+		if len(licenseFiles) > 0 {
+			if got.LicenseFiles == nil {
+				got.LicenseFiles = make(map[string][]string)
+			}
+			got.LicenseFiles[ip] = licenseFiles
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WalkPackages results differ from ListPackages:\n\t(GOT): %#v\n\t(WNT): %#v", got, want)
+	}
+	if wantOrder := []string{"otherfiles", "otherfiles/include", "otherfiles/templates"}; !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("unexpected walk order:\n\t(GOT): %v\n\t(WNT): %v", order, wantOrder)
+	}
+
+	// SkipDir prevents descending, and other errors are passed through.
+	order = order[:0]
+	err = WalkPackages(fileRoot, "otherfiles", func(ip string, poe PackageOrErr, licenseFiles []string) error {
+		order = append(order, ip)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 1 {
+		t.Errorf("expected SkipDir on the root to skip all its children, got %v", order)
+	}
+
+	stop := fmt.Errorf("stop")
+	err = WalkPackages(fileRoot, "otherfiles", func(ip string, poe PackageOrErr, licenseFiles []string) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected the callback's error to stop the walk, got %v", err)
+	}
+}
+
 // Transform Table Test that operates solely on the varied_hidden fixture.
 func TestTrimHiddenPackages(t *testing.T) {
 	base, err := ListPackages(filepath.Join(getTestdataRootDir(t), "src", "varied_hidden"), "varied")
@@ -2243,6 +2410,7 @@ func TestCanaryPackageTreeCopy(t *testing.T) {
 	ptreeFields := []string{
 		"ImportRoot",
 		"Packages",
+		"LicenseFiles",
 	}
 	packageFields := []string{
 		"Name",
@@ -2250,6 +2418,9 @@ func TestCanaryPackageTreeCopy(t *testing.T) {
 		"CommentPath",
 		"Imports",
 		"TestImports",
+		"OtherFiles",
+		"ParseErrors",
+		"ImportPositions",
 	}
 
 	fieldNames := func(typ reflect.Type) []string {
@@ -2299,3 +2470,18 @@ func TestPackageTreeCopy(t *testing.T) {
 		t.Errorf("Did not get expected PackageOrErrs:\n\t(GOT): %+v\n\t(WNT): %+v", got, want)
 	}
 }
+
+func TestCgoIncludes(t *testing.T) {
+	incs, err := CgoIncludes([]byte("package p\n\n// #include <stdio.h>\n// #include \"../include/thing.h\"\n// #include \"local.h\"\nimport \"C\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"../include/thing.h", "local.h"}; !reflect.DeepEqual(incs, want) {
+		t.Errorf("unexpected includes:\n\t(GOT): %v\n\t(WNT): %v", incs, want)
+	}
+
+	incs, err = CgoIncludes([]byte("package p\n\n// #include \"thing.h\"\nimport \"fmt\"\n"))
+	if err != nil || incs != nil {
+		t.Errorf("expected no includes without cgo, got %v (%v)", incs, err)
+	}
+}
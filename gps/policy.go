@@ -0,0 +1,217 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Policy restricts which dependencies may be used. Hosts and import paths are
+// enforced as projects are deduced and their sources set up, and licenses and
+// revisions as the solver considers each version, so a dependency the policy
+// disallows can never be selected into a solution. Revisions are enforced on
+// export as well, so a disallowed one is never written out. Each refusal is a
+// *PolicyViolation.
+type Policy struct {
+	AllowedHosts     []string                   // Hosts that sources may be retrieved from, e.g. "github.com"; "*.example.com" allows every host beneath example.com. Empty: any.
+	DeniedPrefixes   []string                   // Import path prefixes, matched on whole path elements, that may not be depended upon.
+	AllowedLicenses  []string                   // SPDX identifiers of the licenses that versions may carry. A version carrying no recognized license, or any other, is refused. Empty: any.
+	AllowedRevisions map[ProjectRoot][]Revision // The only revisions of each project that may be used, such as those approved by a security review. Any other revision, including every revision of a project not in it, is fetched but quarantined: refused rather than used. Nil: any.
+}
+
+// PolicyViolationKind is the rule of a Policy that a PolicyViolation breaks.
+type PolicyViolationKind uint8
+
+const (
+	// ViolationHost is a source on a host that is not allowed.
+	ViolationHost PolicyViolationKind = iota + 1
+	// ViolationImportPath is an import path beneath a denied prefix.
+	ViolationImportPath
+	// ViolationLicense is a version carrying a license that is not allowed,
+	// or no recognized license at all.
+	ViolationLicense
+	// ViolationRevision is a version whose revision is not allowed.
+	ViolationRevision
+)
+
+func (k PolicyViolationKind) String() string {
+	switch k {
+	case ViolationHost:
+		return "host"
+	case ViolationImportPath:
+		return "import path"
+	case ViolationLicense:
+		return "license"
+	case ViolationRevision:
+		return "revision"
+	default:
+		return fmt.Sprintf("PolicyViolationKind(%d)", k)
+	}
+}
+
+// PolicyViolation is the error returned when a Policy refuses a dependency.
+type PolicyViolation struct {
+	Kind    PolicyViolationKind
+	Path    string   // The import path, or for sources, licenses and revisions the project root, that was refused.
+	Version Version  // For licenses and revisions, the version that was refused.
+	Values  []string // The hosts, denied prefix, licenses or revision that broke the rule.
+}
+
+func (e *PolicyViolation) Error() string {
+	switch e.Kind {
+	case ViolationHost:
+		return fmt.Sprintf("policy violation: %s may only be retrieved from hosts that are not allowed: %s", e.Path, strings.Join(e.Values, ", "))
+	case ViolationImportPath:
+		return fmt.Sprintf("policy violation: import path %s is beneath the denied prefix %s", e.Path, strings.Join(e.Values, ", "))
+	case ViolationLicense:
+		if len(e.Values) == 0 {
+			return fmt.Sprintf("policy violation: %s@%s has no recognized license", e.Path, e.Version)
+		}
+		return fmt.Sprintf("policy violation: %s@%s is licensed under %s, which is not allowed", e.Path, e.Version, strings.Join(e.Values, ", "))
+	case ViolationRevision:
+		if _, ok := e.Version.(Revision); ok || len(e.Values) == 0 {
+			return fmt.Sprintf("policy violation: %s@%s is not an allowed revision, and is quarantined", e.Path, e.Version)
+		}
+		return fmt.Sprintf("policy violation: %s@%s is at revision %s, which is not allowed, and is quarantined", e.Path, e.Version, strings.Join(e.Values, ", "))
+	}
+	return fmt.Sprintf("policy violation: %s", e.Path)
+}
+
+// PolicyViolations returns the policy violations that caused err, such as the
+// error returned from Solve when violations left a project without any usable
+// versions. Each distinct violation is returned once.
+func PolicyViolations(err error) []*PolicyViolation {
+	var pvs []*PolicyViolation
+	seen := make(map[string]bool)
+	var walk func(error)
+	walk = func(err error) {
+		switch e := errors.Cause(err).(type) {
+		case *PolicyViolation:
+			if key := e.Error(); !seen[key] {
+				seen[key] = true
+				pvs = append(pvs, e)
+			}
+		case errorSlice:
+			for _, err := range e {
+				walk(err)
+			}
+		case *noVersionError:
+			for _, fv := range e.fails {
+				walk(fv.f)
+			}
+		}
+	}
+	walk(err)
+	return pvs
+}
+
+// checkImportPath returns a *PolicyViolation if path is beneath one of the
+// policy's denied prefixes. A nil policy allows everything.
+func (p *Policy) checkImportPath(path string) error {
+	if p == nil {
+		return nil
+	}
+	for _, prefix := range p.DeniedPrefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if strings.HasPrefix(path, prefix) && isPathPrefixOrEqual(prefix, path) {
+			return &PolicyViolation{Kind: ViolationImportPath, Path: path, Values: []string{prefix}}
+		}
+	}
+	return nil
+}
+
+// allowsHost reports whether sources may be retrieved from the host of u.
+func (p *Policy) allowsHost(u *url.URL) bool {
+	if p == nil || len(p.AllowedHosts) == 0 {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range p.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSources returns those of mbs on allowed hosts. If there are none, it
+// returns a *PolicyViolation for the project root pr instead.
+func (p *Policy) filterSources(pr string, mbs maybeSources) (maybeSources, error) {
+	if p == nil || len(p.AllowedHosts) == 0 {
+		return mbs, nil
+	}
+
+	allowed := make(maybeSources, 0, len(mbs))
+	var hosts []string
+	for _, m := range mbs {
+		if u := m.URL(); p.allowsHost(u) {
+			allowed = append(allowed, m)
+		} else {
+			hosts = appendUnique(hosts, u.Hostname())
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, &PolicyViolation{Kind: ViolationHost, Path: pr, Values: hosts}
+	}
+	return allowed, nil
+}
+
+// checkLicenses returns a *PolicyViolation for version v of the project root
+// pr unless all of its licenses, and at least one, are allowed.
+func (p *Policy) checkLicenses(pr string, v Version, licenses []string) error {
+	if p == nil || len(p.AllowedLicenses) == 0 {
+		return nil
+	}
+	if len(licenses) == 0 {
+		return &PolicyViolation{Kind: ViolationLicense, Path: pr, Version: v}
+	}
+
+	var denied []string
+	for _, l := range licenses {
+		allowed := false
+		for _, al := range p.AllowedLicenses {
+			if strings.EqualFold(l, al) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			denied = append(denied, l)
+		}
+	}
+	if len(denied) > 0 {
+		return &PolicyViolation{Kind: ViolationLicense, Path: pr, Version: v, Values: denied}
+	}
+	return nil
+}
+
+// checkRevision returns a *PolicyViolation for version v, at revision r, of
+// the project root pr, unless r is one of the policy's allowed revisions for
+// pr.
+func (p *Policy) checkRevision(pr ProjectRoot, v Version, r Revision) error {
+	if p == nil || p.AllowedRevisions == nil {
+		return nil
+	}
+	for _, allowed := range p.AllowedRevisions[pr] {
+		if allowed == r {
+			return nil
+		}
+	}
+	return &PolicyViolation{Kind: ViolationRevision, Path: string(pr), Version: v, Values: []string{string(r)}}
+}
+
+func appendUnique(ss []string, s string) []string {
+	for _, have := range ss {
+		if have == s {
+			return ss
+		}
+	}
+	return append(ss, s)
+}
@@ -0,0 +1,211 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestPolicyImportPaths(t *testing.T) {
+	p := &Policy{DeniedPrefixes: []string{"example.com/bad/", "github.com/evil"}}
+	for path, denied := range map[string]bool{
+		"example.com/bad":         true,
+		"example.com/bad/pkg":     true,
+		"example.com/badger":      false,
+		"github.com/evil/project": true,
+		"github.com/evilcorp/foo": false,
+		"github.com/good/evil":    false,
+	} {
+		err := p.checkImportPath(path)
+		if got := err != nil; got != denied {
+			t.Errorf("expected %q to be denied: %v, got %v", path, denied, err)
+		}
+	}
+}
+
+func TestPolicyLicenses(t *testing.T) {
+	p := &Policy{AllowedLicenses: []string{"MIT", "apache-2.0"}}
+	v := NewVersion("v1.0.0")
+	for _, c := range []struct {
+		licenses, denied []string
+		ok               bool
+	}{
+		{[]string{"MIT"}, nil, true},
+		{[]string{"Apache-2.0", "MIT"}, nil, true},
+		{[]string{"GPL-3.0", "MIT"}, []string{"GPL-3.0"}, false},
+		{nil, nil, false},
+	} {
+		err := p.checkLicenses("example.com/a", v, c.licenses)
+		if c.ok {
+			if err != nil {
+				t.Errorf("expected %v to be allowed, got %v", c.licenses, err)
+			}
+			continue
+		}
+		pv, ok := err.(*PolicyViolation)
+		if !ok {
+			t.Errorf("expected a *PolicyViolation for %v, got %v", c.licenses, err)
+			continue
+		}
+		if pv.Kind != ViolationLicense || !reflect.DeepEqual(pv.Values, c.denied) {
+			t.Errorf("unexpected violation for %v: %#v", c.licenses, pv)
+		}
+	}
+}
+
+func TestPolicyRevisions(t *testing.T) {
+	allowed := Revision("a0e06d1e1e1f4c0c3a4b5c6d7e8f9a0b1c2d3e4f")
+	other := Revision("b1f17e2f2f205d1d4b5c6d7e8f9a0b1c2d3e4f50")
+	p := &Policy{AllowedRevisions: map[ProjectRoot][]Revision{"example.com/a": {allowed}}}
+
+	if err := p.checkRevision("example.com/a", NewVersion("v1.0.0"), allowed); err != nil {
+		t.Errorf("expected the allowed revision to be allowed, got %v", err)
+	}
+	for _, c := range []struct {
+		pr ProjectRoot
+		r  Revision
+	}{
+		{"example.com/a", other},
+		{"example.com/b", allowed},
+	} {
+		err := p.checkRevision(c.pr, NewVersion("v1.0.0"), c.r)
+		pv, ok := err.(*PolicyViolation)
+		if !ok || pv.Kind != ViolationRevision || pv.Path != string(c.pr) || !reflect.DeepEqual(pv.Values, []string{string(c.r)}) {
+			t.Errorf("expected a revision violation for %s@%s, got %#v", c.pr, c.r, err)
+		}
+	}
+
+	if err := (&Policy{}).checkRevision("example.com/b", NewVersion("v1.0.0"), other); err != nil {
+		t.Errorf("expected a policy without an allowlist to allow any revision, got %v", err)
+	}
+}
+
+func TestPolicyViolations(t *testing.T) {
+	host := &PolicyViolation{Kind: ViolationHost, Path: "example.com/a", Values: []string{"example.com"}}
+	lic := &PolicyViolation{Kind: ViolationLicense, Path: "example.com/b", Version: NewVersion("v1.0.0")}
+	err := &noVersionError{
+		pn: ProjectIdentifier{ProjectRoot: "example.com/b"},
+		fails: []failedVersion{
+			{v: NewVersion("v1.0.0"), f: lic},
+			{v: NewVersion("v0.9.0"), f: errors.Wrap(errorSlice{host, errors.New("other")}, "wrapped")},
+			{v: NewVersion("v0.8.0"), f: lic},
+		},
+	}
+
+	got := PolicyViolations(err)
+	if want := []*PolicyViolation{lic, host}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected violations %v, got %v", want, got)
+	}
+	if got := PolicyViolations(errors.New("other")); len(got) != 0 {
+		t.Errorf("expected no violations, got %v", got)
+	}
+}
+
+func TestPolicySourceManager(t *testing.T) {
+	srv := newTestRegistry(t, map[string]string{
+		"example.com/Foo/bar@v1.0.0/LICENSE": "GNU GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007\n",
+		"example.com/Foo/bar@v1.0.0/bar.go":  "package bar\n",
+	})
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir:   h.Path("cache"),
+		Logger:     log.New(test.Writer{TB: t}, "", 0),
+		Registries: map[string]string{"example.com": srv.URL + "/go"},
+		Policy: &Policy{
+			AllowedHosts:    []string{"127.0.0.1"},
+			DeniedPrefixes:  []string{"example.com/denied"},
+			AllowedLicenses: []string{"MIT"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	ctx := context.Background()
+	kind := func(err error) PolicyViolationKind {
+		if pv, ok := errors.Cause(err).(*PolicyViolation); ok {
+			return pv.Kind
+		}
+		t.Fatalf("expected a *PolicyViolation, got %v", err)
+		return 0
+	}
+
+	_, err = sm.DeduceProjectRoot(ctx, "example.com/denied/pkg")
+	if k := kind(err); k != ViolationImportPath {
+		t.Errorf("expected an import path violation, got %s", k)
+	}
+
+	_, err = sm.ListVersions(ctx, ProjectIdentifier{ProjectRoot: "github.com/sdboyer/gpkt"})
+	if k := kind(err); k != ViolationHost {
+		t.Errorf("expected a host violation, got %s", k)
+	}
+
+	id := ProjectIdentifier{ProjectRoot: "example.com/Foo/bar"}
+	v := NewVersion("v1.0.0").Pair("v1.0.0")
+	_, err = sm.ListPackages(ctx, id, v)
+	if k := kind(err); k != ViolationLicense {
+		t.Errorf("expected a license violation, got %s", k)
+	}
+	_, _, err = sm.GetManifestAndLock(ctx, id, v, naiveAnalyzer{})
+	if k := kind(err); k != ViolationLicense {
+		t.Errorf("expected a license violation, got %s", k)
+	}
+}
+
+func TestPolicyQuarantine(t *testing.T) {
+	srv := newTestRegistry(t, map[string]string{
+		"example.com/Foo/bar@v1.0.0/bar.go": "package bar\n",
+	})
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir:   h.Path("cache"),
+		Logger:     log.New(test.Writer{TB: t}, "", 0),
+		Registries: map[string]string{"example.com": srv.URL + "/go"},
+		Policy: &Policy{
+			AllowedRevisions: map[ProjectRoot][]Revision{"example.com/Foo/baz": {"v1.0.0"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	// The project's versions can be listed, but none of them used.
+	ctx := context.Background()
+	id := ProjectIdentifier{ProjectRoot: "example.com/Foo/bar"}
+	if _, err = sm.ListVersions(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	v := NewVersion("v1.0.0").Pair("v1.0.0")
+	if _, err = sm.ListPackages(ctx, id, v); !isViolation(err, ViolationRevision) {
+		t.Errorf("expected a revision violation, got %v", err)
+	}
+	to := filepath.Join(h.Path("."), "export")
+	if err = sm.ExportProject(ctx, id, v, to); !isViolation(err, ViolationRevision) {
+		t.Errorf("expected a revision violation, got %v", err)
+	}
+	h.MustNotExist(to)
+}
+
+func isViolation(err error, kind PolicyViolationKind) bool {
+	pv, ok := errors.Cause(err).(*PolicyViolation)
+	return ok && pv.Kind == kind
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Provenance describes where the code of a version of a project came from, for
+// recording alongside it so that what went into a build can later be audited.
+type Provenance struct {
+	// SourceURL is the URL of the source the version was actually retrieved
+	// from, which may be a mirror, registry or redirect target rather than the
+	// project's canonical upstream. It is empty if the source could have been
+	// retrieved from any of several URLs, and was not retrieved by this
+	// process.
+	SourceURL string
+	// VCS is the type of that source, such as "git", "hg" or "registry".
+	VCS string
+	// CommitTime is when the version's revision was committed. It is zero if
+	// the source cannot tell.
+	CommitTime time.Time
+	// Tagger identifies who created the tag naming the version, if the version
+	// is an annotated tag. It is empty otherwise, or if the source cannot tell.
+	Tagger string
+}
+
+// Provenance returns the provenance of version v of the project identified by
+// id, as retrieved by this SourceMgr. Unless SourceManagerConfig.RecordProvenance
+// was set, it is always empty.
+func (sm *SourceMgr) Provenance(ctx context.Context, id ProjectIdentifier, v Version) (Provenance, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return Provenance{}, ErrSourceManagerIsReleased
+	}
+	if !sm.provenance {
+		return Provenance{}, nil
+	}
+
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+	if err != nil {
+		return Provenance{}, err
+	}
+
+	return srcg.provenance(ctx, v)
+}
+
+// provenance returns the provenance of v. Only the local copy of the source is
+// consulted for its commit time and tagger, which are left blank if the copy
+// lacks them, rather than fetching anything more from upstream.
+func (sg *sourceGateway) provenance(ctx context.Context, v Version) (Provenance, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	p := Provenance{VCS: sg.src.sourceType()}
+	ct, isTimer := sg.src.(commitTimer)
+	tl, isLister := sg.src.(tagInfoLister)
+
+	r, err := sg.convertToRevision(ctx, v)
+	if err != nil {
+		return Provenance{}, err
+	}
+	var tag string
+	if t := v.Type(); isLister && (t == IsVersion || t == IsSemver) {
+		tag = v.String()
+		if ti, has := sg.cache.getTagInfo(r, tag); has {
+			p.Tagger = ti.Tagger
+			tag = ""
+		}
+	}
+
+	if isTimer || tag != "" {
+		if err = sg.requireRevision(ctx, r); err != nil {
+			return Provenance{}, err
+		}
+
+		label := fmt.Sprintf("%s@%s", sg.src.upstreamURL(), v)
+		err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctProvenance, func(ctx context.Context) error {
+			if isTimer {
+				p.CommitTime, err = ct.commitTime(ctx, r)
+				if err != nil {
+					return err
+				}
+			}
+			if tag == "" {
+				return nil
+			}
+			tis, err := tl.listTagInfo(ctx)
+			if err != nil {
+				return err
+			}
+			// A tag missing from the local copy, or since moved, is left out,
+			// as its tagger can't be vouched for.
+			if ti, has := tis[tag]; has && ti.Revision == r {
+				sg.cache.setTagInfo(ti)
+				p.Tagger = ti.Tagger
+			}
+			return nil
+		})
+		if err != nil {
+			return Provenance{}, err
+		}
+	}
+
+	// Only now is the local copy sure to exist, and so to have been retrieved
+	// from somewhere, though not necessarily by this process.
+	p.SourceURL = sg.src.upstreamURL()
+	if rr, ok := sg.src.(retrievalReporter); ok {
+		if from, known := rr.retrievedFrom(); !known {
+			p.SourceURL = ""
+		} else if from != "" {
+			p.SourceURL = from
+			return p, nil
+		}
+	}
+	if _, to, moved := sg.movedUpstream(); moved && p.SourceURL != "" {
+		p.SourceURL = to
+	}
+	return p, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestProvenance(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	h.TempDir("mirror")
+	mirrorPath := h.Path("mirror")
+	h.RunGit(mirrorPath, "init")
+	h.RunGit(mirrorPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(mirrorPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(mirrorPath, "commit", "--allow-empty", `--message="Initial commit"`)
+	h.RunGit(mirrorPath, "tag", "-a", "-m", "Release", "v1.0.0")
+	h.RunGit(mirrorPath, "tag", "v1.0.1")
+
+	mirrorURL := "file://" + filepath.ToSlash(mirrorPath)
+	newSM := func(record bool) *SourceMgr {
+		sm, err := NewSourceManager(SourceManagerConfig{
+			Cachedir: h.Path("cache"),
+			Logger:   log.New(test.Writer{TB: t}, "", 0),
+			Mirrors: map[string][]string{
+				"https://github.com/sdboyer/gpkt": {mirrorURL},
+			},
+			ProxyOnly:        true,
+			RecordProvenance: record,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sm
+	}
+
+	ctx := context.Background()
+	id := ProjectIdentifier{ProjectRoot: "github.com/sdboyer/gpkt"}
+	versions := func(sm *SourceMgr) map[string]PairedVersion {
+		vl, err := sm.ListVersions(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pvs := make(map[string]PairedVersion)
+		for _, pv := range vl {
+			pvs[pv.String()] = pv
+		}
+		return pvs
+	}
+
+	sm := newSM(false)
+	p, err := sm.Provenance(ctx, id, versions(sm)["v1.0.0"])
+	sm.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (Provenance{}) {
+		t.Errorf("expected no provenance unless it is recorded, got %+v", p)
+	}
+
+	sm = newSM(true)
+	defer sm.Release()
+	pvs := versions(sm)
+
+	p, err = sm.Provenance(ctx, id, pvs["v1.0.0"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SourceURL != mirrorURL || p.VCS != "git" {
+		t.Errorf("expected the mirror to be recorded as the git source used, got %+v", p)
+	}
+	if p.Tagger != "Test author <test@example.com>" {
+		t.Errorf("expected the annotated tag's tagger, got %q", p.Tagger)
+	}
+	if p.CommitTime.IsZero() || time.Since(p.CommitTime) > time.Hour {
+		t.Errorf("expected the time of the commit just made, got %v", p.CommitTime)
+	}
+
+	p, err = sm.Provenance(ctx, id, pvs["v1.0.1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Tagger != "" || p.CommitTime.IsZero() {
+		t.Errorf("expected a commit time but no tagger for a lightweight tag, got %+v", p)
+	}
+}
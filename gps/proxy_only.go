@@ -0,0 +1,52 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "fmt"
+
+// DirectAccessError is returned in proxy-only mode (see
+// SourceManagerConfig.ProxyOnly) for import paths that could only be deduced,
+// and projects that could only be retrieved, by contacting their upstream
+// directly.
+type DirectAccessError struct {
+	Path string // The import path or project root.
+	URL  string // The upstream that would have been contacted, if known.
+}
+
+func (e *DirectAccessError) Error() string {
+	what := "deducing its root requires contacting its host"
+	if e.URL != "" {
+		what = fmt.Sprintf("retrieving it requires contacting %s", e.URL)
+	}
+	return fmt.Sprintf("%s is not served by any registry, proxy or mirror, and %s, which proxy-only mode forbids", e.Path, what)
+}
+
+// proxySources returns the sources among mbs that can be set up for pr without
+// contacting upstream: those from registries, and sources with mirrors, whose
+// mirrors alone are used, including those pinned to a mirror. If there are
+// none, it returns a *DirectAccessError.
+//
+// Unless sc is in proxy-only mode, mbs are returned as they are.
+func (sc *sourceCoordinator) proxySources(pr string, mbs maybeSources) (maybeSources, error) {
+	if !sc.proxyOnly {
+		return mbs, nil
+	}
+
+	pinned := sc.pinnedMirrors[ProjectRoot(pr)] != ""
+	var allowed maybeSources
+	for _, m := range mbs {
+		if _, ok := m.(maybeRegistrySource); ok || pinned || len(sc.mirrors[m.URL().String()]) > 0 {
+			allowed = append(allowed, m)
+		}
+	}
+	if len(allowed) == 0 {
+		err := &DirectAccessError{Path: pr}
+		if len(mbs) > 0 {
+			err.URL = mbs[0].URL().String()
+		}
+		return nil, err
+	}
+	return allowed, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestProxyOnly(t *testing.T) {
+	requiresBins(t, "git")
+
+	srv := newTestRegistry(t, map[string]string{
+		"example.com/Foo/bar@v1.0.0/bar.go": "package bar\n",
+	})
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	h.TempDir("mirror")
+	mirrorPath := h.Path("mirror")
+	h.RunGit(mirrorPath, "init")
+	h.RunGit(mirrorPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(mirrorPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(mirrorPath, "commit", "--allow-empty", `--message="Initial commit"`)
+	h.RunGit(mirrorPath, "tag", "v1.0.0")
+
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir:   h.Path("cache"),
+		Logger:     log.New(test.Writer{TB: t}, "", 0),
+		Registries: map[string]string{"example.com": srv.URL + "/go"},
+		Mirrors: map[string][]string{
+			"https://github.com/sdboyer/gpkt": {"file://" + filepath.ToSlash(mirrorPath)},
+		},
+		ProxyOnly: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	ctx := context.Background()
+	if _, err = sm.DeduceProjectRoot(ctx, "vanity.example.org/foo"); !isDirectAccess(err) {
+		t.Errorf("expected deducing a vanity import path to be refused, got %v", err)
+	}
+	_, err = sm.ListVersions(ctx, ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"})
+	if !isDirectAccess(err) {
+		t.Errorf("expected a project with neither registry nor mirror to be refused, got %v", err)
+	}
+
+	vl, err := sm.ListVersions(ctx, ProjectIdentifier{ProjectRoot: "example.com/Foo/bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vl) != 1 || vl[0].String() != "v1.0.0" {
+		t.Errorf("expected the registry's version, got %v", vl)
+	}
+
+	// Upstream is never tried, so only what the mirror has is listed.
+	vl, err = sm.ListVersions(ctx, ProjectIdentifier{ProjectRoot: "github.com/sdboyer/gpkt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortPairedForUpgrade(vl)
+	if len(vl) != 2 || vl[0].String() != "v1.0.0" || vl[1].String() != "master" {
+		t.Errorf("expected the mirror's versions, got %v", vl)
+	}
+}
+
+func isDirectAccess(err error) bool {
+	_, ok := errors.Cause(err).(*DirectAccessError)
+	return ok
+}
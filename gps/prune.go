@@ -8,10 +8,12 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/golang/dep/gps/pkgtree"
 	"github.com/golang/dep/internal/fs"
 	"github.com/pkg/errors"
 )
@@ -21,12 +23,16 @@ type PruneOptions uint8
 
 const (
 	// PruneNestedVendorDirs indicates if nested vendor directories should be pruned.
+	// They are removed whole, license files and all, as the go tool would
+	// otherwise still resolve imports to what is left of them.
 	PruneNestedVendorDirs PruneOptions = 1 << iota
 	// PruneUnusedPackages indicates if unused Go packages should be pruned.
+	// License and legal files in their directories are kept.
 	PruneUnusedPackages
 	// PruneNonGoFiles indicates if non-Go files should be pruned.
-	// Files matching licenseFilePrefixes and legalFileSubstrings are kept in
-	// an attempt to comply with legal requirements.
+	// License and legal files (see pkgtree.IsLicenseFile) are kept in an
+	// attempt to comply with legal requirements, as are any files that used
+	// packages need (see pkgtree.Package.OtherFiles).
 	PruneNonGoFiles
 	// PruneGoTestFiles indicates if Go test files should be pruned.
 	PruneGoTestFiles
@@ -154,70 +160,123 @@ func defaultCascadingPruneOptions() CascadingPruneOptions {
 	}
 }
 
-var (
-	// licenseFilePrefixes is a list of name prefixes for license files.
-	licenseFilePrefixes = []string{
-		"license",
-		"licence",
-		"copying",
-		"unlicense",
-		"copyright",
-		"copyleft",
-	}
-	// legalFileSubstrings contains substrings that are likey part of a legal
-	// declaration file.
-	legalFileSubstrings = []string{
-		"authors",
-		"contributors",
-		"legal",
-		"notice",
-		"disclaimer",
-		"patent",
-		"third-party",
-		"thirdparty",
-	}
-)
-
 // PruneProject remove excess files according to the options passed, from
 // the lp directory in baseDir.
 func PruneProject(baseDir string, lp LockedProject, options PruneOptions) error {
 	fsState, err := deriveFilesystemState(baseDir)
 
 	if err != nil {
-		return errors.Wrap(err, "could not derive filesystem state")
+		return wrapError(err, "could not derive filesystem state")
+	}
+
+	// Files that the used packages report needing are never candidates for
+	// pruning, regardless of their names or extensions.
+	if (options & (PruneUnusedPackages | PruneNonGoFiles)) != 0 {
+		needed, err := neededNonGoFiles(baseDir, lp)
+		if err != nil {
+			return wrapError(err, "could not determine non-Go files needed by packages")
+		}
+		fsState.files = withoutNeededFiles(fsState.files, needed)
 	}
 
 	if (options & PruneNestedVendorDirs) != 0 {
 		if err := pruneVendorDirs(fsState); err != nil {
-			return errors.Wrapf(err, "failed to prune nested vendor directories")
+			return wrapErrorf(err, "failed to prune nested vendor directories")
 		}
 	}
 
 	if (options & PruneUnusedPackages) != 0 {
 		if _, err := pruneUnusedPackages(lp, fsState); err != nil {
-			return errors.Wrap(err, "failed to prune unused packages")
+			return wrapError(err, "failed to prune unused packages")
 		}
 	}
 
 	if (options & PruneNonGoFiles) != 0 {
 		if err := pruneNonGoFiles(fsState); err != nil {
-			return errors.Wrap(err, "failed to prune non-Go files")
+			return wrapError(err, "failed to prune non-Go files")
 		}
 	}
 
 	if (options & PruneGoTestFiles) != 0 {
 		if err := pruneGoTestFiles(fsState); err != nil {
-			return errors.Wrap(err, "failed to prune Go test files")
+			return wrapError(err, "failed to prune Go test files")
 		}
 	}
 
 	if err := deleteEmptyDirs(fsState); err != nil {
-		return errors.Wrap(err, "could not delete empty dirs")
+		return wrapError(err, "could not delete empty dirs")
 	}
 
 	return nil
 }
 
+// neededNonGoFiles returns the set of paths, relative to baseDir, that the
+// packages in lp report as needed non-Go files (see pkgtree.Package.OtherFiles).
+// Paths may be directories, in which case their entire contents are needed.
+func neededNonGoFiles(baseDir string, lp LockedProject) (map[string]bool, error) {
+	pr := string(lp.Ident().ProjectRoot)
+	// A broken file shouldn't cause files needed by the rest of its package to
+	// be pruned.
+	ptree, err := pkgtree.ListPackagesWithOptions(baseDir, pr, pkgtree.ListOptions{TolerateParseErrors: true})
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool, len(lp.Packages()))
+	for _, pkg := range lp.Packages() {
+		used[pkg] = true
+	}
+
+	needed := make(map[string]bool)
+	for ip, poe := range ptree.Packages {
+		if poe.Err != nil {
+			continue
+		}
+
+		pkg := strings.TrimPrefix(strings.TrimPrefix(ip, pr), "/")
+		if pkg == "" {
+			pkg = "."
+		}
+		if !used[pkg] {
+			continue
+		}
+
+		for _, f := range poe.P.OtherFiles {
+			rel := path.Join(pkg, f)
+			// Files outside of the project can't be pruned anyway.
+			if rel == ".." || strings.HasPrefix(rel, "../") {
+				continue
+			}
+			needed[filepath.FromSlash(rel)] = true
+		}
+	}
+
+	return needed, nil
+}
+
+// withoutNeededFiles filters out of files those paths that are in needed, or
+// are beneath a directory that is.
+func withoutNeededFiles(files []string, needed map[string]bool) []string {
+	if len(needed) == 0 {
+		return files
+	}
+
+	kept := make([]string, 0, len(files))
+	for _, f := range files {
+		isNeeded := false
+		for p := f; p != "." && p != string(filepath.Separator); p = filepath.Dir(p) {
+			if needed[p] {
+				isNeeded = true
+				break
+			}
+		}
+		if !isNeeded {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
 // pruneVendorDirs deletes all nested vendor directories within baseDir.
 func pruneVendorDirs(fsState filesystemState) error {
 	for _, dir := range fsState.dirs {
@@ -336,7 +395,7 @@ func isSourceFile(path string) bool {
 
 // pruneNonGoFiles delete all non-Go files existing in fsState.
 //
-// Files matching licenseFilePrefixes and legalFileSubstrings are not pruned.
+// License and legal files (see pkgtree.IsLicenseFile) are not pruned.
 func pruneNonGoFiles(fsState filesystemState) error {
 	toDelete := make([]string, 0, len(fsState.files)/4)
 
@@ -363,28 +422,14 @@ func pruneNonGoFiles(fsState filesystemState) error {
 }
 
 // isPreservedFile checks if the file name indicates that the file should be
-// preserved based on licenseFilePrefixes or legalFileSubstrings.
+// preserved because it is a license or legal file (see pkgtree.IsLicenseFile).
 // This applies only to non-source files.
 func isPreservedFile(name string) bool {
 	if isSourceFile(name) {
 		return false
 	}
 
-	name = strings.ToLower(name)
-
-	for _, prefix := range licenseFilePrefixes {
-		if strings.HasPrefix(name, prefix) {
-			return true
-		}
-	}
-
-	for _, substring := range legalFileSubstrings {
-		if strings.Contains(name, substring) {
-			return true
-		}
-	}
-
-	return false
+	return pkgtree.IsLicenseFile(name)
 }
 
 // pruneGoTestFiles deletes all Go test files (*_test.go) in fsState.
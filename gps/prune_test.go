@@ -7,6 +7,7 @@ package gps
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/golang/dep/internal/test"
@@ -126,6 +127,39 @@ func TestPruneProject(t *testing.T) {
 	}
 }
 
+func TestPruneProjectKeepsNeededNonGoFiles(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	pr := "github.com/project/repository"
+	h.TempDir(pr)
+	h.TempFile(filepath.Join(pr, "cgo.go"), "package repository\n\n// #include \"include/thing.h\"\nimport \"C\"\n")
+	h.TempFile(filepath.Join(pr, "include", "thing.h"), "#define THING 1\n")
+	h.TempFile(filepath.Join(pr, "assets.go"), "package repository\n\n//go:embed static\nvar static string\n")
+	h.TempFile(filepath.Join(pr, "static", "index.html"), "<html></html>\n")
+	h.TempFile(filepath.Join(pr, "README.md"), "README\n")
+	h.TempFile(filepath.Join(pr, "unused", "unused.go"), "package unused\n")
+
+	baseDir := h.Path(pr)
+	lp := lockedProject{
+		pi: ProjectIdentifier{
+			ProjectRoot: ProjectRoot(pr),
+		},
+		pkgs: []string{"."},
+	}
+
+	err := PruneProject(baseDir, lp, PruneNonGoFiles|PruneUnusedPackages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.MustExist(filepath.Join(baseDir, "cgo.go"))
+	h.MustExist(filepath.Join(baseDir, "include", "thing.h"))
+	h.MustExist(filepath.Join(baseDir, "static", "index.html"))
+	h.MustNotExist(filepath.Join(baseDir, "README.md"))
+	h.MustNotExist(filepath.Join(baseDir, "unused", "unused.go"))
+}
+
 func TestPruneUnusedPackages(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -0,0 +1,123 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redacted is what credentials are replaced with.
+const redacted = "xxxxx"
+
+// urlUserinfo matches the userinfo of URLs in free text, such as the output of
+// a failed git clone.
+var urlUserinfo = regexp.MustCompile(`\b([a-zA-Z][a-zA-Z0-9+.-]*://)([^/?#\s@'"]+)@`)
+
+// redactor scrubs credentials from the text of errors, logs and audit records:
+// the userinfo of any URL in it, and any of the secrets, such as API tokens,
+// that are known to be in use.
+//
+// A nil *redactor still scrubs userinfo.
+type redactor struct {
+	secrets []string // Longest first, so that none is left partly scrubbed.
+}
+
+// newRedactor returns a redactor for secrets, and for the passwords in the
+// userinfo of urls, whether or not they are later seen in URLs.
+func newRedactor(secrets []string, urls []string) *redactor {
+	r := &redactor{}
+	for _, s := range secrets {
+		if s != "" {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+	for _, rawurl := range urls {
+		u, err := url.Parse(rawurl)
+		if err != nil || u.User == nil {
+			continue
+		}
+		if p, ok := u.User.Password(); ok && p != "" {
+			r.secrets = append(r.secrets, p)
+		} else if user := u.User.Username(); !ok && user != "" && user != "git" && user != "hg" {
+			// A lone username, other than the SSH user of a host, is usually
+			// a token.
+			r.secrets = append(r.secrets, user)
+		}
+	}
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+	return r
+}
+
+// redact returns s with credentials scrubbed from it. The userinfo of URLs is
+// replaced as a whole, unless it's only the git or hg user of an SSH URL.
+func (r *redactor) redact(s string) string {
+	s = urlUserinfo.ReplaceAllStringFunc(s, func(m string) string {
+		sm := urlUserinfo.FindStringSubmatch(m)
+		if sm[2] == "git" || sm[2] == "hg" {
+			return m
+		}
+		return sm[1] + redacted + "@"
+	})
+	if r != nil {
+		for _, secret := range r.secrets {
+			s = strings.Replace(s, secret, redacted, -1)
+		}
+	}
+	return s
+}
+
+// redactErr returns err, or if its message has credentials in it, an error
+// whose message has them scrubbed, but whose cause is still err.
+func (r *redactor) redactErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if scrubbed := r.redact(msg); scrubbed != msg {
+		return &redactedError{err: err, msg: scrubbed}
+	}
+	return err
+}
+
+// redactedError is an error whose message has had credentials scrubbed from
+// it.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Cause returns the original error, so that its type can still be checked.
+func (e *redactedError) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the original error, as Cause does.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactingWriter is an io.Writer that scrubs credentials from what is written
+// through it, such as by a logger.
+type redactingWriter struct {
+	w io.Writer
+	r *redactor
+}
+
+func (rw redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.r.redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,413 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+// A registrySource is a project served by a Go module registry, such as an
+// Artifactory or Nexus Go repository, which speaks the same protocol as a Go
+// module proxy. Versions in a registry are immutable, so each is paired with
+// a Revision of the same name.
+//
+// The local copy of the source holds each version that has been downloaded,
+// extracted into a directory of its own.
+type registrySource struct {
+	base    *url.URL       // The registry's base URL, including any credentials
+	module  string         // The path of the project's module within the registry
+	path    string         // Where the local copy is kept
+	catalog *athensCatalog // If the registry is an Athens proxy, its catalog
+
+	mu       sync.Mutex
+	versions map[string]bool // The versions the registry last listed
+}
+
+func (s *registrySource) sourceType() string {
+	return "registry"
+}
+
+func (s *registrySource) upstreamURL() string {
+	return registryModuleURL(s.base, s.module).String()
+}
+
+func (s *registrySource) existsLocally(ctx context.Context) bool {
+	fi, err := os.Stat(s.path)
+	return err == nil && fi.IsDir()
+}
+
+func (s *registrySource) existsUpstream(ctx context.Context) bool {
+	_, err := s.fetchVersions(ctx)
+	return err == nil
+}
+
+func (s *registrySource) existsCallsListVersions() bool {
+	return true
+}
+
+func (s *registrySource) listVersionsRequiresLocal() bool {
+	return false
+}
+
+func (s *registrySource) initLocal(ctx context.Context) error {
+	if err := os.MkdirAll(s.path, 0777); err != nil {
+		return err
+	}
+	return s.updateLocal(ctx)
+}
+
+// updateLocal only refreshes the list of versions; those already downloaded
+// cannot have changed.
+func (s *registrySource) updateLocal(ctx context.Context) error {
+	_, err := s.fetchVersions(ctx)
+	return err
+}
+
+func (s *registrySource) maybeClean(ctx context.Context) error {
+	return nil
+}
+
+func (s *registrySource) listVersions(ctx context.Context) ([]PairedVersion, error) {
+	vl, err := s.fetchVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pvl := make([]PairedVersion, 0, len(vl))
+	for _, v := range vl {
+		pvl = append(pvl, NewVersion(v).Pair(Revision(v)))
+	}
+	return pvl, nil
+}
+
+func (s *registrySource) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	if _, err := os.Stat(s.versionPath(r)); err == nil {
+		return true, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.versions[string(r)], nil
+}
+
+func (s *registrySource) disambiguateRevision(ctx context.Context, r Revision) (Revision, error) {
+	if present, _ := s.revisionPresentIn(ctx, r); !present {
+		return "", errors.Errorf("%s is not a version of %s in the registry", r, s.module)
+	}
+	return r, nil
+}
+
+func (s *registrySource) getManifestAndLock(ctx context.Context, pr ProjectRoot, r Revision, an ProjectAnalyzer) (Manifest, Lock, error) {
+	dir, err := s.download(ctx, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, l, err := DeriveManifestAndLock(ctx, an, dir, pr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if l != nil && l != Lock(nil) {
+		l = prepLock(l)
+	}
+
+	return prepManifest(m), l, nil
+}
+
+func (s *registrySource) listPackages(ctx context.Context, pr ProjectRoot, r Revision) (pkgtree.PackageTree, error) {
+	dir, err := s.download(ctx, r)
+	if err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	return pkgtree.ListPackages(dir, string(pr))
+}
+
+func (s *registrySource) exportRevisionTo(ctx context.Context, r Revision, to string) error {
+	return s.exportRevisionWithOptions(ctx, r, to, fs.CopyOptions{})
+}
+
+func (s *registrySource) exportLinkedRevisionTo(ctx context.Context, r Revision, to string) error {
+	return s.exportRevisionWithOptions(ctx, r, to, fs.CopyOptions{Hardlink: true})
+}
+
+func (s *registrySource) exportRevisionWithOptions(ctx context.Context, r Revision, to string, opts fs.CopyOptions) error {
+	dir, err := s.download(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	// Only make the parent dir, as CopyDir will balk on trying to write to an
+	// empty but existing dir.
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+	return fs.CopyDirWithOptions(dir, to, opts)
+}
+
+// versionPath returns the directory that version r is extracted into.
+func (s *registrySource) versionPath(r Revision) string {
+	return filepath.Join(s.path, registryEscape(string(r)))
+}
+
+// fetchVersions retrieves the list of the module's versions from the registry,
+// and records it for revisionPresentIn. Versions held in an Athens proxy's
+// catalog are listed too. If there are no versions at all, the one the
+// registry reports as the latest, such as a pseudo-version, is used instead.
+func (s *registrySource) fetchVersions(ctx context.Context) ([]string, error) {
+	rc, err := registryGet(ctx, s.base, s.module, "@v/list")
+	if err != nil {
+		return nil, err
+	}
+	var vl []string
+	sc := bufio.NewScanner(rc)
+	for sc.Scan() {
+		if v := strings.TrimSpace(sc.Text()); v != "" {
+			vl = append(vl, v)
+		}
+	}
+	err = sc.Err()
+	rc.Close()
+	if err != nil {
+		return nil, wrapErrorf(err, "failed to read versions of %s", s.module)
+	}
+
+	if s.catalog != nil {
+		// Not all of Athens' storage backends support the catalog, so the
+		// list from the registry has to do without it.
+		if cvl, err := s.catalog.versions(ctx, s.module); err == nil {
+			seen := make(map[string]bool, len(vl))
+			for _, v := range vl {
+				seen[v] = true
+			}
+			for _, v := range cvl {
+				if !seen[v] {
+					seen[v] = true
+					vl = append(vl, v)
+				}
+			}
+		}
+	}
+
+	if len(vl) == 0 {
+		if rc, err = registryGet(ctx, s.base, s.module, "@latest"); err == nil {
+			var info struct{ Version string }
+			err = json.NewDecoder(rc).Decode(&info)
+			rc.Close()
+			if err != nil {
+				return nil, wrapErrorf(err, "failed to read latest version of %s", s.module)
+			}
+			if info.Version != "" {
+				vl = append(vl, info.Version)
+			}
+		}
+	}
+
+	versions := make(map[string]bool, len(vl))
+	for _, v := range vl {
+		versions[v] = true
+	}
+	s.mu.Lock()
+	s.versions = versions
+	s.mu.Unlock()
+
+	return vl, nil
+}
+
+// download ensures that version r has been downloaded and extracted into the
+// local copy, and returns the directory it was extracted into.
+func (s *registrySource) download(ctx context.Context, r Revision) (string, error) {
+	dir := s.versionPath(r)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	rc, err := registryGet(ctx, s.base, s.module, "@v/"+registryEscape(string(r))+".zip")
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(s.path, "download")
+	if err != nil {
+		rc.Close()
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, rc)
+	rc.Close()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", wrapErrorf(err, "failed to download %s of %s", r, s.module)
+	}
+
+	// Extract somewhere temporary first, so that a failed extraction never
+	// leaves a partial version behind.
+	tmp, err := ioutil.TempDir(s.path, "extract")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err = extractModuleZip(f.Name(), s.module+"@"+string(r)+"/", tmp); err != nil {
+		return "", wrapErrorf(err, "failed to extract %s of %s", r, s.module)
+	}
+	if err = fs.RenameWithFallback(tmp, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// extractModuleZip extracts the module zip file at name into dir. Every file
+// in the zip must be beneath prefix, which is stripped from its name.
+func extractModuleZip(name, prefix, dir string) error {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		rel := strings.TrimPrefix(f.Name, prefix)
+		if rel == f.Name || rel == "" || path.IsAbs(rel) || path.Clean(rel) != strings.TrimSuffix(rel, "/") || rel == ".." || strings.HasPrefix(rel, "../") {
+			return errors.Errorf("invalid path %q in module zip", f.Name)
+		}
+		to := filepath.Join(dir, filepath.FromSlash(rel))
+
+		if f.FileInfo().IsDir() {
+			if err = os.MkdirAll(to, 0777); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = extractZipFile(f, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZipFile(f *zip.File, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	perm := f.Mode().Perm()
+	if perm == 0 {
+		perm = 0666
+	}
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// registryEscape escapes a module path or version for use in a registry URL
+// or file name, as the Go module proxy protocol does: each upper case letter
+// is replaced by an exclamation mark followed by the letter in lower case.
+func registryEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// registryModuleURL returns the URL of module within the registry at base,
+// without any credentials, for use as the identity of the module's source.
+func registryModuleURL(base *url.URL, module string) *url.URL {
+	u := *base
+	u.User = nil
+	u.Path = path.Join(u.Path, registryEscape(module))
+	return &u
+}
+
+// registryGet requests the file at rel, beneath module, from the registry at
+// base, and returns its contents if the registry has it. rel may carry a query.
+func registryGet(ctx context.Context, base *url.URL, module, rel string) (io.ReadCloser, error) {
+	u := *base
+	if i := strings.Index(rel, "?"); i != -1 {
+		rel, u.RawQuery = rel[:i], rel[i+1:]
+	}
+	u.Path = path.Join(u.Path, registryEscape(module), rel)
+
+	what := rel
+	if module != "" {
+		what += " of " + module
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, wrapErrorf(err, "unable to build HTTP request for %s", what)
+	}
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		// Errors from the client include the URL, credentials and all.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return nil, wrapErrorf(err, "failed HTTP request for %s", what)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("registry at %s has no %s: %s", registryModuleURL(base, ""), what, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// maybeRegistrySource is a maybeSource for a module in a Go module registry.
+type maybeRegistrySource struct {
+	base    *url.URL
+	module  string
+	catalog *athensCatalog
+}
+
+func (m maybeRegistrySource) try(ctx context.Context, cachedir string) (source, error) {
+	return &registrySource{
+		base:    m.base,
+		module:  m.module,
+		path:    sourceCachePath(cachedir, m.URL().String()),
+		catalog: m.catalog,
+	}, nil
+}
+
+func (m maybeRegistrySource) URL() *url.URL {
+	return registryModuleURL(m.base, m.module)
+}
+
+func (m maybeRegistrySource) String() string {
+	return fmt.Sprintf("%T: %s", m, ufmt(m.URL()))
+}
@@ -0,0 +1,187 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+// newTestRegistry returns a server acting as a Go module registry beneath /go,
+// serving the module example.com/Foo/bar at v1.0.0, and github.com/alice/a
+// with no tagged versions.
+func newTestRegistry(t *testing.T, files map[string]string) *httptest.Server {
+	var zb bytes.Buffer
+	zw := zip.NewWriter(&zb)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/go/example.com/!foo/bar/@v/list", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.0.0\n"))
+	})
+	mux.HandleFunc("/go/example.com/!foo/bar/@v/v1.0.0.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(zb.Bytes())
+	})
+	mux.HandleFunc("/go/github.com/alice/a/@v/list", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/go/github.com/alice/a/@latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"v0.0.0-20170102030405-c575196502940"}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestRegistrySource(t *testing.T) {
+	srv := newTestRegistry(t, map[string]string{
+		"example.com/Foo/bar@v1.0.0/bar.go":     "package bar\n",
+		"example.com/Foo/bar@v1.0.0/baz/baz.go": "package baz\n",
+	})
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir:   h.Path("cache"),
+		Logger:     log.New(test.Writer{TB: t}, "", 0),
+		Registries: map[string]string{"example.com": srv.URL + "/go", "github.com": srv.URL + "/go"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	ctx := context.Background()
+	root, err := sm.DeduceProjectRoot(ctx, "example.com/Foo/bar/baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != "example.com/Foo/bar" {
+		t.Fatalf("expected the root to be the module in the registry, got %q", root)
+	}
+	if root, err = sm.DeduceProjectRoot(ctx, "github.com/alice/a/sub"); err != nil || root != "github.com/alice/a" {
+		t.Fatalf("expected github.com/alice/a as the root from known path rules, got %q (%v)", root, err)
+	}
+
+	id := ProjectIdentifier{ProjectRoot: "example.com/Foo/bar"}
+	vl, err := sm.ListVersions(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vl) != 1 || vl[0].String() != "v1.0.0" || vl[0].Revision() != "v1.0.0" {
+		t.Fatalf("unexpected versions %v", vl)
+	}
+
+	ptree, err := sm.ListPackages(ctx, id, vl[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, has := ptree.Packages["example.com/Foo/bar/baz"]; !has || len(ptree.Packages) != 2 {
+		t.Errorf("unexpected packages %v", ptree.Packages)
+	}
+
+	to := filepath.Join(h.Path("."), "export")
+	if err = sm.ExportProject(ctx, id, vl[0], to); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(to, "baz", "baz.go"))
+	if err != nil || string(b) != "package baz\n" {
+		t.Errorf("unexpected exported baz.go: %q (%v)", b, err)
+	}
+
+	vl, err = sm.ListVersions(ctx, ProjectIdentifier{ProjectRoot: "github.com/alice/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vl) != 1 || vl[0].String() != "v0.0.0-20170102030405-c575196502940" {
+		t.Errorf("expected only the latest pseudo-version, got %v", vl)
+	}
+}
+
+func TestExtractModuleZipRejectsEscapes(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("out")
+
+	for _, name := range []string{
+		"example.com/a@v1.0.0/../escape",
+		"example.com/a@v1.0.0//abs",
+		"example.com/b@v1.0.0/a.go",
+	} {
+		var zb bytes.Buffer
+		zw := zip.NewWriter(&zb)
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+		zw.Close()
+		h.TempFile("mod.zip", zb.String())
+
+		if err := extractModuleZip(h.Path("mod.zip"), "example.com/a@v1.0.0/", h.Path("out")); err == nil {
+			t.Errorf("expected an error for %q", name)
+		}
+	}
+}
+
+func TestRegistrySourceHardlinkExports(t *testing.T) {
+	srv := newTestRegistry(t, map[string]string{
+		"example.com/Foo/bar@v1.0.0/bar.go": "package bar\n",
+	})
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+
+	for _, normalize := range []bool{false, true} {
+		sm, err := NewSourceManager(SourceManagerConfig{
+			Cachedir:         h.Path("cache"),
+			Logger:           log.New(test.Writer{TB: t}, "", 0),
+			Registries:       map[string]string{"example.com": srv.URL + "/go"},
+			HardlinkExports:  true,
+			NormalizeExports: normalize,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id := ProjectIdentifier{ProjectRoot: "example.com/Foo/bar"}
+		v := NewVersion("v1.0.0").Pair("v1.0.0")
+		var fis []os.FileInfo
+		for _, name := range []string{"a", "b"} {
+			to := filepath.Join(h.Path("."), fmt.Sprintf("export-%t-%s", normalize, name))
+			if err = sm.ExportProject(context.Background(), id, v, to); err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(filepath.Join(to, "bar.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fis = append(fis, fi)
+		}
+		sm.Release()
+
+		if linked := os.SameFile(fis[0], fis[1]); linked == normalize {
+			t.Errorf("expected exports to be linked to the cache only without normalization, got linked %t with normalization %t", linked, normalize)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep/gps/internal/dirhash"
+	"github.com/pkg/errors"
+)
+
+// SignatureRequirement requires that the versions of a project used carry a
+// good signature by one of a set of trusted keys, whether or not the versions
+// of other projects are checked.
+type SignatureRequirement struct {
+	// Keyring is the GnuPG home directory of the keys trusted to sign the
+	// project's versions. Empty: SourceManagerConfig.SignatureKeyring.
+	Keyring string
+	// URL, if non-empty, is where the detached signature of each version is
+	// published, with "{version}" and "{revision}" replaced by those of the
+	// version. Each is a signature of the line that go.sum would record for the
+	// version's contents, treating the project as a module whose path is its
+	// root, such as "example.com/foo v1.2.3 h1:...=\n", so only versions tagged
+	// like vX.Y.Z can be verified this way. If URL is empty, the version's tag,
+	// or for branches and revisions its commit, must be signed instead.
+	URL string
+}
+
+// verifyDetachedSignature checks that the detached signature published at the
+// gateway's signatureURL for v, whose revision is r, is a good one by a key in
+// its keyring, returning that key's fingerprint.
+//
+// caller must hold sg.mu for writing.
+func (sg *sourceGateway) verifyDetachedSignature(ctx context.Context, v Version, r Revision) (string, error) {
+	module := string(sg.signedModule)
+	version, ok := moduleVersion(module, v)
+	if !ok {
+		return "", errors.Errorf("only versions tagged like vX.Y.Z have detached signatures, not %s", v)
+	}
+
+	tmp, err := ioutil.TempDir("", "dep-signature")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	to := filepath.Join(tmp, "src")
+	if err = sg.src.exportRevisionTo(ctx, r, to); err != nil {
+		return "", err
+	}
+	sum, err := dirhash.ModuleHash(to, module, version)
+	if err != nil {
+		return "", err
+	}
+	payload := filepath.Join(tmp, "payload")
+	if err = ioutil.WriteFile(payload, []byte(module+" "+version+" "+sum+"\n"), 0666); err != nil {
+		return "", err
+	}
+
+	u := strings.NewReplacer("{version}", version, "{revision}", string(r)).Replace(sg.signatureURL)
+	sig, err := fetchSignature(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	sigfile := filepath.Join(tmp, "payload.sig")
+	if err = ioutil.WriteFile(sigfile, sig, 0666); err != nil {
+		return "", err
+	}
+
+	cmd := commandContext(ctx, "gpg", "--homedir", sg.keyring, "--batch", "--status-fd", "1", "--verify", sigfile, payload)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", wrapError(err, string(out))
+	}
+	signer := gpgValidSigner(out)
+	if signer == "" {
+		return "", errors.Errorf("no valid signature found:\n%s", out)
+	}
+	return signer, nil
+}
+
+// fetchSignature retrieves the detached signature at u.
+func fetchSignature(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, wrapErrorf(err, "unable to build HTTP request for signature %s", u)
+	}
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		// Errors from the client include the URL, credentials and all.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return nil, wrapError(err, "failed HTTP request for signature")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("no signature found at %s: %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
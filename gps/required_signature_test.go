@@ -0,0 +1,137 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/gps/internal/dirhash"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestRequiredSignatures(t *testing.T) {
+	requiresBins(t, "git", "gpg")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("keyring")
+	keyring := h.Path("keyring")
+	os.Chmod(keyring, 0700)
+	defer exec.Command("gpgconf", "--homedir", keyring, "--kill", "gpg-agent").Run()
+	gpg := func(args ...string) []byte {
+		out, err := exec.Command("gpg", append([]string{"--homedir", keyring, "--batch"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("gpg %s failed: %s\n%s", args, err, out)
+		}
+		return out
+	}
+	gpg("--pinentry-mode", "loopback", "--passphrase", "", "--quick-gen-key", "Test author <test@example.com>", "default", "sign", "never")
+	var fpr string
+	for _, line := range strings.Split(string(gpg("--with-colons", "--list-secret-keys")), "\n") {
+		if f := strings.Split(line, ":"); len(f) > 9 && f[0] == "fpr" {
+			fpr = f[9]
+			break
+		}
+	}
+
+	h.Setenv("GNUPGHOME", keyring)
+	h.TempDir("mirror")
+	mirrorPath := h.Path("mirror")
+	h.RunGit(mirrorPath, "init")
+	h.RunGit(mirrorPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(mirrorPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(mirrorPath, "config", "--local", "user.signingkey", fpr)
+	h.TempFile("mirror/gpkt.go", "package gpkt\n")
+	h.RunGit(mirrorPath, "add", "gpkt.go")
+	h.RunGit(mirrorPath, "commit", `--message="Initial commit"`)
+	h.RunGit(mirrorPath, "tag", "-s", "-m", "Release 1.0.0", "v1.0.0")
+	h.RunGit(mirrorPath, "tag", "-a", "-m", "Release 0.9.0", "v0.9.0")
+
+	id := ProjectIdentifier{ProjectRoot: "github.com/sdboyer/gpkt"}
+	newSM := func(cachedir string, reqs map[ProjectRoot]SignatureRequirement) *SourceMgr {
+		h.TempDir(cachedir)
+		sm, err := NewSourceManager(SourceManagerConfig{
+			Cachedir: h.Path(cachedir),
+			Logger:   log.New(test.Writer{TB: t}, "", 0),
+			Mirrors: map[string][]string{
+				"https://github.com/sdboyer/gpkt": {"file://" + filepath.ToSlash(mirrorPath)},
+			},
+			ProxyOnly:          true,
+			RequiredSignatures: reqs,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sm
+	}
+	ctx := context.Background()
+	export := func(sm *SourceMgr, v string) error {
+		return sm.ExportProject(ctx, id, NewVersion(v), filepath.Join(h.Path("."), "export", v))
+	}
+
+	// Detached signatures are of the line go.sum would record, so work it out
+	// from an unchecked export, and sign it.
+	sm := newSM("cache", nil)
+	to := filepath.Join(h.Path("."), "unchecked")
+	if err := sm.ExportProject(ctx, id, NewVersion("v0.9.0"), to); err != nil {
+		t.Fatal(err)
+	}
+	sm.Release()
+	sum, err := dirhash.ModuleHash(to, "github.com/sdboyer/gpkt", "v0.9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := filepath.Join(h.Path("."), "payload")
+	if err = ioutil.WriteFile(payload, []byte("github.com/sdboyer/gpkt v0.9.0 "+sum+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	sig := gpg("--pinentry-mode", "loopback", "--passphrase", "", "--output", "-", "--detach-sign", payload)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gpkt/v0.9.0.sig" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(sig)
+	}))
+	defer srv.Close()
+
+	// The tag must be signed, even though no keyring is set for everything.
+	sm = newSM("tags", map[ProjectRoot]SignatureRequirement{id.ProjectRoot: {Keyring: keyring}})
+	if err = export(sm, "v1.0.0"); err != nil {
+		t.Errorf("Unexpected error exporting a signed tag: %s", err)
+	}
+	if err = export(sm, "v0.9.0"); err == nil {
+		t.Error("expected an error exporting an unsigned tag of a project required to be signed")
+	}
+	sm.Release()
+
+	sm = newSM("detached", map[ProjectRoot]SignatureRequirement{id.ProjectRoot: {Keyring: keyring, URL: srv.URL + "/gpkt/{version}.sig"}})
+	defer sm.Release()
+	if err = export(sm, "v0.9.0"); err != nil {
+		t.Errorf("Unexpected error exporting a version with a detached signature: %s", err)
+	}
+	if err = export(sm, "v1.0.0"); err == nil {
+		t.Error("expected an error exporting a version with no detached signature published")
+	}
+
+	h.TempDir("nokeyring")
+	if _, err = NewSourceManager(SourceManagerConfig{
+		Cachedir:           h.Path("nokeyring"),
+		RequiredSignatures: map[ProjectRoot]SignatureRequirement{id.ProjectRoot: {}},
+	}); err == nil {
+		t.Error("expected an error requiring signatures with no keyring to verify them with")
+	}
+}
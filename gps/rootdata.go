@@ -5,6 +5,7 @@
 package gps
 
 import (
+	"fmt"
 	"sort"
 
 	"github.com/armon/go-radix"
@@ -137,6 +138,71 @@ func (rd rootdata) getApplicableConstraints(stdLibFn func(string) bool) []workin
 	return ret
 }
 
+// applyScopedConstraints folds the applicable subset of the provided
+// ScopedConstraints into the root manifest's dependency constraints.
+//
+// A scoped constraint is applicable if any of the external imports reachable
+// from its listed packages fall within the constrained ProjectRoot. Applicable
+// constraints are intersected with any existing constraint on the same project.
+//
+// It returns a problem for each scoped constraint that is invalid, in the order
+// of the roots they constrain; the others are still applied.
+func (rd rootdata) applyScopedConstraints(sc ScopedConstraints) []error {
+	if len(sc) == 0 {
+		return nil
+	}
+
+	prs := make([]string, 0, len(sc))
+	for pr := range sc {
+		prs = append(prs, string(pr))
+	}
+	sort.Strings(prs)
+
+	var errs []error
+	rm, _ := rd.rpt.ToReachMap(true, true, false, rd.ir)
+	for _, spr := range prs {
+		pr, scc := ProjectRoot(spr), sc[ProjectRoot(spr)]
+		if len(scc.Packages) == 0 {
+			errs = append(errs, badOptsFailure(fmt.Sprintf("scoped constraint on %s must name at least one root package", pr)))
+			continue
+		}
+
+		var missing bool
+		for _, pkg := range scc.Packages {
+			if _, has := rd.rpt.Packages[pkg]; !has {
+				errs = append(errs, badOptsFailure(fmt.Sprintf("scoped constraint on %s names %s, which is not a package in the root project", pr, pkg)))
+				missing = true
+				break
+			}
+		}
+
+		if missing || !scc.appliesIn(pr, rm) {
+			continue
+		}
+
+		pp := scc.ProjectProperties
+		if pp.Constraint == nil {
+			pp.Constraint = anyConstraint{}
+		}
+		if epp, has := rd.rm.Deps[pr]; has {
+			if pp.Source == "" {
+				pp.Source = epp.Source
+			} else if epp.Source != "" && epp.Source != pp.Source {
+				errs = append(errs, badOptsFailure(fmt.Sprintf("scoped constraint on %s declares source %s, which conflicts with %s", pr, pp.Source, epp.Source)))
+				continue
+			}
+			pp.Constraint = epp.Constraint.Intersect(pp.Constraint)
+			if _, none := pp.Constraint.(noneConstraint); none {
+				errs = append(errs, badOptsFailure(fmt.Sprintf("scoped constraint on %s is disjoint with the unscoped constraint %s", pr, epp.Constraint)))
+				continue
+			}
+		}
+		rd.rm.Deps[pr] = pp
+	}
+
+	return errs
+}
+
 func (rd rootdata) combineConstraints() []workingConstraint {
 	return rd.ovr.overrideAll(rd.rm.DependencyConstraints())
 }
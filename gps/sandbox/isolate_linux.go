@@ -0,0 +1,40 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// nobody is the ID that processes run as within their user namespace when
+// dep itself runs as root, as root would not be bound by the permissions of
+// the read-only copy.
+const nobody = 65534
+
+// isolate has cmd run in user and network namespaces of its own. The network
+// namespace holds nothing but a loopback interface, which is down, so nothing
+// can be reached through it; the user namespace lets unprivileged users create
+// it, and runs cmd as an unprivileged user, even if dep is run as root.
+func isolate(cmd *exec.Cmd) error {
+	uid, gid := os.Getuid(), os.Getgid()
+	cuid, cgid := uid, gid
+	if cuid == 0 {
+		cuid = nobody
+	}
+	if cgid == 0 {
+		cgid = nobody
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: cuid, HostID: uid, Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: cgid, HostID: gid, Size: 1}},
+		Credential:  &syscall.Credential{Uid: uint32(cuid), Gid: uint32(cgid), NoSetGroups: true},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	return nil
+}
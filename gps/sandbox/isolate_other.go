@@ -0,0 +1,18 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package sandbox
+
+import (
+	"os/exec"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+func isolate(cmd *exec.Cmd) error {
+	return errors.Errorf("cutting sandboxed analyzers off from the network is not supported on %s", runtime.GOOS)
+}
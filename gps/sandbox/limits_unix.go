@@ -0,0 +1,35 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package sandbox
+
+import (
+	"syscall"
+	"time"
+)
+
+// applyLimits applies l to the running process.
+func applyLimits(l Limits) error {
+	set := func(resource int, max uint64) error {
+		if max == 0 {
+			return nil
+		}
+		rl := rlimit(max)
+		return syscall.Setrlimit(resource, &rl)
+	}
+
+	cpu := uint64((l.CPU + time.Second - 1) / time.Second)
+	if err := set(syscall.RLIMIT_CPU, cpu); err != nil {
+		return err
+	}
+	if err := set(rlimitMemory, uint64(l.Memory)); err != nil {
+		return err
+	}
+	if err := set(syscall.RLIMIT_FSIZE, uint64(l.FileSize)); err != nil {
+		return err
+	}
+	return set(syscall.RLIMIT_NOFILE, l.OpenFiles)
+}
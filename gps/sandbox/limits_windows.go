@@ -0,0 +1,15 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import "github.com/pkg/errors"
+
+// applyLimits applies l to the running process.
+func applyLimits(l Limits) error {
+	if l != (Limits{}) {
+		return errors.New("resource limits are not supported on windows")
+	}
+	return nil
+}
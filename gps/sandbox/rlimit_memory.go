@@ -0,0 +1,12 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows,!openbsd
+
+package sandbox
+
+import "syscall"
+
+// rlimitMemory is the resource limiting the memory a process can use.
+const rlimitMemory = syscall.RLIMIT_AS
@@ -0,0 +1,11 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import "syscall"
+
+// rlimitMemory is the resource limiting the memory a process can use. OpenBSD
+// does not limit address space, so the data segment is limited instead.
+const rlimitMemory = syscall.RLIMIT_DATA
@@ -0,0 +1,15 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build freebsd dragonfly
+
+package sandbox
+
+import "syscall"
+
+// rlimit returns an Rlimit with both its soft and hard limits set to max.
+// The limits are signed on these platforms.
+func rlimit(max uint64) syscall.Rlimit {
+	return syscall.Rlimit{Cur: int64(max), Max: int64(max)}
+}
@@ -0,0 +1,14 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows,!freebsd,!dragonfly
+
+package sandbox
+
+import "syscall"
+
+// rlimit returns an Rlimit with both its soft and hard limits set to max.
+func rlimit(max uint64) syscall.Rlimit {
+	return syscall.Rlimit{Cur: max, Max: max}
+}
@@ -0,0 +1,223 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sandbox runs gps.ProjectAnalyzers in a separate process, cut off from
+// the network, with only a read-only copy of the tree to analyze, and within
+// resource limits.
+//
+// The process is the program itself, or another that knows the same analyzer,
+// run with ChildEnv set in its environment. Such programs must call Serve,
+// before doing anything else, when ChildEnv is set:
+//
+//	if os.Getenv(sandbox.ChildEnv) != "" {
+//		if err := sandbox.Serve(myAnalyzer{}, os.Stdin, os.Stdout); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//		os.Exit(0)
+//	}
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+// ChildEnv is the environment variable set for sandboxed processes, telling
+// them to call Serve.
+const ChildEnv = "DEP_ANALYZER_SANDBOX"
+
+// maxOutput bounds how much of what a sandboxed process writes is read back,
+// so that it cannot exhaust the memory of its parent.
+const maxOutput = 64 << 20
+
+// Limits are the resource limits a sandboxed process runs within. Zero fields
+// are not limited.
+type Limits struct {
+	CPU       time.Duration // CPU time, rounded up to the second.
+	Memory    int64         // Bytes of address space. The Go runtime reserves much more than it uses, so this must be generous.
+	FileSize  int64         // Bytes of the largest file that may be written.
+	OpenFiles uint64        // Number of files that may be open at once.
+}
+
+// DefaultLimits are limits that dep's own analyzer comfortably runs within.
+var DefaultLimits = Limits{
+	CPU:       time.Minute,
+	Memory:    4 << 30,
+	FileSize:  1 << 20,
+	OpenFiles: 256,
+}
+
+// Exec is a gps.AnalyzerSandbox that runs analyzers in a separate process.
+// Processes are cut off from the network by running them in a network
+// namespace of their own, as an unprivileged user, which is only supported on
+// Linux.
+type Exec struct {
+	Command []string // The program, and its arguments, to run; it must call Serve. Empty: the running executable.
+	Env     []string // Environment variables for the process beyond ChildEnv, which is all it gets otherwise.
+	Limits  Limits
+}
+
+var _ gps.AnalyzerSandbox = Exec{}
+
+// DeriveManifestAndLock runs an in a sandboxed process, on a read-only copy of
+// the tree at path. The process must know an analyzer with the same Info as
+// an.
+func (e Exec) DeriveManifestAndLock(ctx context.Context, an gps.ProjectAnalyzer, path string, importRoot gps.ProjectRoot) (gps.Manifest, gps.Lock, error) {
+	command := e.Command
+	if len(command) == 0 {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot find the executable to sandbox analyzers in")
+		}
+		command = []string{exe}
+	}
+
+	tmp, err := ioutil.TempDir("", "dep-sandbox")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer removeReadOnly(tmp)
+	dir := filepath.Join(tmp, "src")
+	if err = readOnlyCopy(path, dir); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to copy %s for analysis", importRoot)
+	}
+
+	req, err := json.Marshal(request{
+		Analyzer:   an.Info(),
+		Path:       dir,
+		ImportRoot: importRoot,
+		Limits:     e.Limits,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append([]string{ChildEnv + "=1"}, e.Env...)
+	cmd.Stdin = bytes.NewReader(req)
+	var stdout, stderr limitedBuffer
+	stdout.n, stderr.n = maxOutput, 64<<10
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err = isolate(cmd); err != nil {
+		return nil, nil, err
+	}
+
+	if err = cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.Errorf("%s: %s", err, msg)
+		}
+		return nil, nil, errors.Wrapf(err, "sandboxed analysis of %s failed", importRoot)
+	}
+
+	var resp response
+	if err = json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, nil, errors.Wrapf(err, "malformed result from sandboxed analysis of %s", importRoot)
+	}
+	if resp.Err != "" {
+		return nil, nil, errors.New(resp.Err)
+	}
+	return resp.results()
+}
+
+// Serve reads a request for analysis from r, performs it with an, and writes
+// the result to w. It is called in sandboxed processes; see the package
+// documentation.
+//
+// The process's resource limits are applied before anything is analyzed.
+func Serve(an gps.ProjectAnalyzer, r io.Reader, w io.Writer) error {
+	var req request
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return errors.Wrap(err, "malformed request for sandboxed analysis")
+	}
+	if info := an.Info(); info != req.Analyzer {
+		return errors.Errorf("cannot run analyzer %s in a sandbox that knows only %s", req.Analyzer, info)
+	}
+	if err := applyLimits(req.Limits); err != nil {
+		return errors.Wrap(err, "failed to apply resource limits")
+	}
+
+	var resp response
+	m, l, err := an.DeriveManifestAndLock(req.Path, req.ImportRoot)
+	if err == nil {
+		err = resp.set(m, l)
+	}
+	if err != nil {
+		resp = response{Err: err.Error()}
+	}
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// readOnlyCopy copies the tree at from to to, and makes the copy read-only.
+func readOnlyCopy(from, to string) error {
+	if err := fs.CopyDir(from, to); err != nil {
+		return err
+	}
+	// Directories are made read-only last, deepest first, so that nothing
+	// within them still needs changing.
+	var dirs []string
+	err := filepath.Walk(to, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir():
+			dirs = append(dirs, path)
+		case fi.Mode().IsRegular():
+			return os.Chmod(path, fi.Mode().Perm()&^0222)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err = os.Chmod(dirs[i], 0555); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeReadOnly removes the tree at path, which readOnlyCopy may have made
+// read-only.
+func removeReadOnly(path string) error {
+	filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			os.Chmod(path, 0777)
+		}
+		return nil
+	})
+	return os.RemoveAll(path)
+}
+
+// limitedBuffer is a bytes.Buffer that holds at most n bytes. Writes beyond
+// that are discarded.
+type limitedBuffer struct {
+	bytes.Buffer
+	n int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.n - b.Len(); room < len(p) {
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
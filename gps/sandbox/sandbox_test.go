@@ -0,0 +1,136 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/gps"
+)
+
+// testAnalyzer reports, as constraints, whether it could write to the tree it
+// analyzes, and whether it could reach the network.
+type testAnalyzer struct{}
+
+func (testAnalyzer) DeriveManifestAndLock(path string, pr gps.ProjectRoot) (gps.Manifest, gps.Lock, error) {
+	b, err := ioutil.ReadFile(filepath.Join(path, "constraint"))
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := gps.NewSemverConstraint(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, nil, err
+	}
+	deps := gps.ProjectConstraints{
+		"example.com/dep": {Source: "https://example.com/fork", Constraint: c},
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(path, "constraint"), nil, 0666); err == nil {
+		deps["example.com/writable"] = gps.ProjectProperties{Constraint: gps.Any()}
+	}
+	if addr := os.Getenv("TEST_ADDR"); addr != "" {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			deps["example.com/online"] = gps.ProjectProperties{Constraint: gps.Any()}
+		}
+	}
+
+	l := gps.SimpleLock{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "example.com/dep"}, gps.NewVersion("v1.2.0").Pair("abc123"), []string{"."}),
+	}
+	return gps.SimpleManifest{Deps: deps}, l, nil
+}
+
+func (testAnalyzer) Info() gps.ProjectAnalyzerInfo {
+	return gps.ProjectAnalyzerInfo{Name: "test", Version: 1}
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(ChildEnv) != "" {
+		if err := Serve(testAnalyzer{}, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("sandboxing is not supported on %s", runtime.GOOS)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	dir, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "constraint"), []byte("^1.0.0\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	sb := Exec{
+		Command: []string{os.Args[0]},
+		Env:     []string{"TEST_ADDR=" + l.Addr().String()},
+		Limits:  DefaultLimits,
+	}
+	m, lock, err := sb.DeriveManifestAndLock(context.Background(), testAnalyzer{}, dir, "example.com/root")
+	if err != nil {
+		if strings.Contains(err.Error(), "operation not permitted") {
+			t.Skipf("user namespaces are not available: %s", err)
+		}
+		t.Fatal(err)
+	}
+
+	deps := m.DependencyConstraints()
+	if len(deps) != 1 {
+		t.Errorf("expected the analyzer to neither write to the tree nor reach the network, got %v", deps)
+	}
+	pp := deps["example.com/dep"]
+	if pp.Source != "https://example.com/fork" || pp.Constraint.String() != "^1.0.0" {
+		t.Errorf("unexpected constraint on example.com/dep: %+v", pp)
+	}
+	if lps := lock.Projects(); len(lps) != 1 || lps[0].Version().String() != "v1.2.0" {
+		t.Errorf("unexpected lock: %v", lps)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "constraint")); string(b) != "^1.0.0\n" {
+		t.Errorf("expected the tree to be left alone, got %q", b)
+	}
+
+	_, _, err = sb.DeriveManifestAndLock(context.Background(), otherAnalyzer{}, dir, "example.com/root")
+	if err == nil || !strings.Contains(err.Error(), "knows only test.1") {
+		t.Errorf("expected an unknown analyzer to be refused, got %v", err)
+	}
+}
+
+type otherAnalyzer struct{ testAnalyzer }
+
+func (otherAnalyzer) Info() gps.ProjectAnalyzerInfo {
+	return gps.ProjectAnalyzerInfo{Name: "other", Version: 1}
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
+)
+
+// The types in this file are the forms in which requests and results are sent
+// to and from sandboxed processes. gps's own types are mostly interfaces
+// backed by unexported types, which cannot be sent as they are.
+
+type request struct {
+	Analyzer   gps.ProjectAnalyzerInfo
+	Path       string
+	ImportRoot gps.ProjectRoot
+	Limits     Limits
+}
+
+type response struct {
+	Err          string
+	HasManifest  bool
+	Constraints  map[gps.ProjectRoot]constraint
+	HasLock      bool
+	Projects     []lockedProject
+	InputImports []string
+}
+
+type version struct {
+	Revision string
+	Branch   string
+	Version  string
+}
+
+type constraint struct {
+	Source  string
+	Any     bool
+	Semver  string // Set if the constraint is a semver range
+	Version version
+}
+
+type lockedProject struct {
+	Ident    gps.ProjectIdentifier
+	Version  version
+	Packages []string
+}
+
+// set records m and l, either of which may be nil, in resp.
+func (resp *response) set(m gps.Manifest, l gps.Lock) error {
+	if m != nil {
+		resp.HasManifest = true
+		resp.Constraints = make(map[gps.ProjectRoot]constraint)
+		for pr, pp := range m.DependencyConstraints() {
+			c := constraint{Source: pp.Source}
+			switch v := pp.Constraint.(type) {
+			case nil:
+				return errors.Errorf("no constraint on %s", pr)
+			case gps.Version:
+				c.Version = toWireVersion(v)
+			default:
+				if gps.IsAny(v) {
+					c.Any = true
+				} else {
+					c.Semver = v.String()
+				}
+			}
+			resp.Constraints[pr] = c
+		}
+	}
+
+	if l != nil {
+		resp.HasLock = true
+		resp.InputImports = l.InputImports()
+		for _, lp := range l.Projects() {
+			resp.Projects = append(resp.Projects, lockedProject{
+				Ident:    lp.Ident(),
+				Version:  toWireVersion(lp.Version()),
+				Packages: lp.Packages(),
+			})
+		}
+	}
+	return nil
+}
+
+// results returns the manifest and lock recorded in resp.
+func (resp response) results() (gps.Manifest, gps.Lock, error) {
+	var m gps.Manifest
+	if resp.HasManifest {
+		deps := make(gps.ProjectConstraints, len(resp.Constraints))
+		for pr, wc := range resp.Constraints {
+			var c gps.Constraint
+			switch {
+			case wc.Any:
+				c = gps.Any()
+			case wc.Semver != "":
+				var err error
+				if c, err = gps.NewSemverConstraint(wc.Semver); err != nil {
+					return nil, nil, err
+				}
+			default:
+				if c = wc.Version.version(); c == nil {
+					return nil, nil, errors.Errorf("empty constraint on %s", pr)
+				}
+			}
+			deps[pr] = gps.ProjectProperties{Source: wc.Source, Constraint: c}
+		}
+		m = gps.SimpleManifest{Deps: deps}
+	}
+
+	var l gps.Lock
+	if resp.HasLock {
+		sl := lock{inputImports: resp.InputImports}
+		for _, wlp := range resp.Projects {
+			sl.projects = append(sl.projects, gps.NewLockedProject(wlp.Ident, wlp.Version.version(), wlp.Packages))
+		}
+		l = sl
+	}
+	return m, l, nil
+}
+
+// lock is a gps.Lock as sent back from a sandboxed process.
+type lock struct {
+	projects     []gps.LockedProject
+	inputImports []string
+}
+
+func (l lock) Projects() []gps.LockedProject {
+	return l.projects
+}
+
+func (l lock) InputImports() []string {
+	return l.inputImports
+}
+
+func toWireVersion(v gps.Version) version {
+	if v == nil {
+		return version{}
+	}
+	var wv version
+	wv.Revision, wv.Branch, wv.Version = gps.VersionComponentStrings(v)
+	return wv
+}
+
+func (wv version) version() gps.Version {
+	var uv gps.UnpairedVersion
+	switch {
+	case wv.Branch != "":
+		uv = gps.NewBranch(wv.Branch)
+	case wv.Version != "":
+		uv = gps.NewVersion(wv.Version)
+	case wv.Revision != "":
+		return gps.Revision(wv.Revision)
+	default:
+		return nil
+	}
+
+	if wv.Revision != "" {
+		return uv.Pair(gps.Revision(wv.Revision))
+	}
+	return uv
+}
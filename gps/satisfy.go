@@ -23,6 +23,7 @@ func (s *solver) check(a atomWithPackages, pkgonly bool) error {
 	defer func() {
 		if err != nil {
 			s.traceInfo(err)
+			s.emit(VersionRejected{Project: pa.id, Version: pa.v, PackagesOnly: pkgonly, Reason: err})
 		}
 		s.mtr.pop()
 	}()
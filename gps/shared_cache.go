@@ -0,0 +1,52 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// maybeSharedCacheSource is a maybeSource whose git source, if it is not in
+// the cache yet, is cloned from its copy in a shared read-only cache rather
+// than from upstream. Other kinds of sources are set up as usual.
+type maybeSharedCacheSource struct {
+	maybeSource
+	shared []string // The paths the source would have in each shared cache, in order.
+}
+
+func (m maybeSharedCacheSource) try(ctx context.Context, cachedir string) (source, error) {
+	src, err := m.maybeSource.try(ctx, cachedir)
+	if err != nil {
+		return nil, err
+	}
+	if gs, ok := src.(*gitSource); ok {
+		gs.shared = m.shared
+	}
+	return src, nil
+}
+
+// initLocalFromShared clones the local copy from the first of the shared
+// caches to have one, then updates it from upstream or its mirrors, fetching
+// only what the shared copy lacks. It reports false if there is no shared copy
+// that can be cloned, leaving the local copy to be set up from upstream.
+func (s *gitSource) initLocalFromShared(ctx context.Context) (bool, error) {
+	gr, ok := s.repo.(*gitRepo)
+	if !ok {
+		return false, nil
+	}
+	for _, shared := range s.shared {
+		if _, err := os.Stat(filepath.Join(shared, ".git")); err != nil {
+			continue
+		}
+		if err := gr.getFrom(ctx, shared); err != nil {
+			os.RemoveAll(gr.LocalPath())
+			continue
+		}
+		return true, s.updateLocal(ctx)
+	}
+	return false, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestSharedCacheSource(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	h.TempDir("shared")
+	h.TempDir("upstream")
+	upstreamPath := h.Path("upstream")
+	commit := func(dir, msg string) string {
+		h.RunGit(dir, "commit", "--allow-empty", "--message="+msg)
+		out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	h.RunGit(upstreamPath, "init")
+	h.RunGit(upstreamPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(upstreamPath, "config", "--local", "user.name", "Test author")
+	commit(upstreamPath, "Initial commit")
+
+	un := "file://" + filepath.ToSlash(upstreamPath)
+	u, err := url.Parse(un)
+	if err != nil {
+		t.Fatalf("Error parsing URL %s: %s", un, err)
+	}
+	pm := maybeGitSource{url: u}
+
+	// The shared copy has a commit that upstream never had, showing where the
+	// local copy came from, and lacks one that upstream has gained since.
+	sharedPath := maybeSourceCachePath(h.Path("shared"), pm)
+	h.RunGit(h.Path("shared"), "clone", un, sharedPath)
+	h.RunGit(sharedPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(sharedPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(sharedPath, "checkout", "-b", "local")
+	sharedOnly := commit(sharedPath, "Shared commit")
+	h.RunGit(sharedPath, "checkout", "master")
+	latest := commit(upstreamPath, "Second commit")
+
+	ctx := context.Background()
+	mb := maybeSharedCacheSource{maybeSource: pm, shared: []string{filepath.Join(h.Path("."), "missing"), sharedPath}}
+	isrc, err := mb.try(ctx, h.Path("cache"))
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+	}
+	defer isrc.(*gitSource).close()
+	if err = isrc.initLocal(ctx); err != nil {
+		t.Fatalf("Error on cloning git repo from shared cache: %s", err)
+	}
+
+	for _, r := range []string{sharedOnly, latest} {
+		if present, _ := isrc.revisionPresentIn(ctx, Revision(r)); !present {
+			t.Errorf("expected %s to be present locally", r)
+		}
+	}
+	lpath := maybeSourceCachePath(h.Path("cache"), pm)
+	origin, err := exec.Command("git", "-C", lpath, "config", "remote.origin.url").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(origin)); got != un {
+		t.Errorf("expected origin to be upstream %s, got %s", un, got)
+	}
+	if err = exec.Command("git", "-C", sharedPath, "cat-file", "-e", latest).Run(); err == nil {
+		t.Error("expected the shared cache to be left alone")
+	}
+}
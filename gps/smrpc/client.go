@@ -0,0 +1,204 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smrpc
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/rpc"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// Client is a gps.SourceManager that makes requests of a SourceManager served
+// by a Server.
+//
+// Errors returned by the served SourceManager are passed on only as their
+// messages, so their types are lost.
+type Client struct {
+	c   *rpc.Client
+	seq uint64 // Seq of the last call made; accessed atomically
+}
+
+var _ gps.SourceManager = &Client{}
+
+// Dial connects to the Server listening on the unix socket at path.
+func Dial(path string) (*Client, error) {
+	c, err := rpc.Dial("unix", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to source manager at %s", path)
+	}
+	return &Client{c: c}, nil
+}
+
+// NewClient returns a Client that makes requests over conn.
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{c: rpc.NewClient(conn)}
+}
+
+// call makes a request, returning early if ctx is done. In that case, the
+// server is asked to cancel the request, but is not waited for.
+func (c *Client) call(ctx context.Context, method string, args callArgs, reply interface{}) error {
+	seq := atomic.AddUint64(&c.seq, 1)
+	args.setSeq(seq)
+
+	call := c.c.Go(serviceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-ctx.Done():
+		c.c.Go(serviceName+".Cancel", seq, &struct{}{}, make(chan *rpc.Call, 1))
+		return ctx.Err()
+	}
+}
+
+// SourceExists checks if a repository exists, either upstream or in the
+// server's cache, for the provided ProjectIdentifier.
+func (c *Client) SourceExists(ctx context.Context, id gps.ProjectIdentifier) (bool, error) {
+	var exists bool
+	err := c.call(ctx, "SourceExists", &IDArgs{ID: id}, &exists)
+	return exists, err
+}
+
+// SyncSourceFor has the server sync its cache of the source for the provided
+// ProjectIdentifier with upstream.
+func (c *Client) SyncSourceFor(ctx context.Context, id gps.ProjectIdentifier) error {
+	return c.call(ctx, "SyncSourceFor", &IDArgs{ID: id}, &struct{}{})
+}
+
+// ListVersions retrieves a list of the available versions for a given
+// repository name.
+func (c *Client) ListVersions(ctx context.Context, id gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	var wvl []Version
+	if err := c.call(ctx, "ListVersions", &IDArgs{ID: id}, &wvl); err != nil {
+		return nil, err
+	}
+
+	vl := make([]gps.PairedVersion, 0, len(wvl))
+	for _, wv := range wvl {
+		if pv, ok := wv.version().(gps.PairedVersion); ok {
+			vl = append(vl, pv)
+		}
+	}
+	return vl, nil
+}
+
+// ListVersionsMatching retrieves the versions of the given repository that
+// satisfy the provided Constraint, sorted in the order the solver prefers them
+// when upgrading.
+func (c *Client) ListVersionsMatching(ctx context.Context, id gps.ProjectIdentifier, con gps.Constraint) ([]gps.PairedVersion, error) {
+	vl, err := c.ListVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []gps.PairedVersion
+	for _, pv := range vl {
+		if con.Matches(pv) {
+			matching = append(matching, pv)
+		}
+	}
+	gps.SortPairedForUpgrade(matching)
+	return matching, nil
+}
+
+// RevisionPresentIn indicates whether the provided Version is present in the
+// given repository.
+func (c *Client) RevisionPresentIn(ctx context.Context, id gps.ProjectIdentifier, r gps.Revision) (bool, error) {
+	var present bool
+	err := c.call(ctx, "RevisionPresentIn", &RevisionArgs{ID: id, Revision: r}, &present)
+	return present, err
+}
+
+// ListPackages parses the tree of the Go packages at or below root of the
+// provided ProjectIdentifier, at the provided version.
+func (c *Client) ListPackages(ctx context.Context, id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+	var wpt PackageTree
+	if err := c.call(ctx, "ListPackages", &VersionArgs{ID: id, Version: toWireVersion(v)}, &wpt); err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	return wpt.packageTree(), nil
+}
+
+// GetManifestAndLock returns manifest and lock information for the provided
+// root import path.
+//
+// Analyzers run in the client, not the server, so this exports the version to
+// a temporary directory for the analyzer to examine.
+func (c *Client) GetManifestAndLock(ctx context.Context, id gps.ProjectIdentifier, v gps.Version, an gps.ProjectAnalyzer) (gps.Manifest, gps.Lock, error) {
+	td, err := ioutil.TempDir("", "dep-smrpc")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(td)
+
+	to := filepath.Join(td, "src")
+	if err = c.ExportProject(ctx, id, v, to); err != nil {
+		return nil, nil, err
+	}
+	return gps.DeriveManifestAndLock(ctx, an, to, id.ProjectRoot)
+}
+
+// ExportProject has the server write out the tree of the provided
+// ProjectIdentifier, at the provided version, to the provided directory.
+func (c *Client) ExportProject(ctx context.Context, id gps.ProjectIdentifier, v gps.Version, to string) error {
+	to, err := filepath.Abs(to)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, "ExportProject", &ExportArgs{ID: id, Version: toWireVersion(v), To: to}, &struct{}{})
+}
+
+// ExportPrunedProject has the server write out a tree of the provided
+// LockedProject, applying provided pruning rules as appropriate.
+func (c *Client) ExportPrunedProject(ctx context.Context, lp gps.LockedProject, prune gps.PruneOptions, to string) error {
+	to, err := filepath.Abs(to)
+	if err != nil {
+		return err
+	}
+	args := &ExportPrunedArgs{LP: toWireLockedProject(lp), Prune: prune, To: to}
+	return c.call(ctx, "ExportPrunedProject", args, &struct{}{})
+}
+
+// DeduceProjectRoot takes an import path and deduces the corresponding
+// project/source root.
+func (c *Client) DeduceProjectRoot(ctx context.Context, ip string) (gps.ProjectRoot, error) {
+	var root gps.ProjectRoot
+	err := c.call(ctx, "DeduceProjectRoot", &PathArgs{Path: ip}, &root)
+	return root, err
+}
+
+// SourceURLsForPath takes an import path and deduces the set of source URLs
+// that may refer to a canonical upstream source.
+func (c *Client) SourceURLsForPath(ctx context.Context, ip string) ([]*url.URL, error) {
+	var urls []string
+	if err := c.call(ctx, "SourceURLsForPath", &PathArgs{Path: ip}, &urls); err != nil {
+		return nil, err
+	}
+	return urlsFromWire(urls)
+}
+
+// InferConstraint tries to puzzle out what kind of version is given in a
+// string: semver, a revision, or as a fallback, a plain tag.
+func (c *Client) InferConstraint(ctx context.Context, s string, id gps.ProjectIdentifier) (gps.Constraint, error) {
+	var wc Constraint
+	if err := c.call(ctx, "InferConstraint", &InferArgs{S: s, ID: id}, &wc); err != nil {
+		return nil, err
+	}
+	return wc.constraint()
+}
+
+// Release closes the connection to the server. The served SourceManager is
+// not released.
+func (c *Client) Release() {
+	c.c.Close()
+}
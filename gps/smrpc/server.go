@@ -0,0 +1,275 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package smrpc serves a gps.SourceManager over RPC, and provides a
+// gps.SourceManager that is a client of such a server.
+//
+// This allows a single, long-running SourceManager to be shared by many
+// processes, such as successive dep invocations and editor integrations, so
+// that they all benefit from its warm caches, its deduplication of work on the
+// same sources, and its limits on concurrent work. Solving is still done by
+// each client, using the shared SourceManager.
+//
+// Servers and clients are expected to run on the same machine, typically
+// communicating over a unix socket: paths passed to exports are written to by
+// the server as they are.
+package smrpc
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"sync"
+
+	"github.com/golang/dep/gps"
+)
+
+// serviceName is the name under which the SourceManager is registered with the
+// RPC server.
+const serviceName = "SourceManager"
+
+// Server serves a gps.SourceManager to Clients.
+type Server struct {
+	sm  gps.SourceManager
+	sem chan struct{} // If non-nil, bounds the number of concurrent requests
+}
+
+// NewServer returns a Server for sm. If maxConcurrent is positive, at most that
+// many requests are handled at once, across all connections; others wait their
+// turn.
+//
+// Releasing sm remains the responsibility of the caller, once it has stopped
+// serving.
+func NewServer(sm gps.SourceManager, maxConcurrent int) *Server {
+	s := &Server{sm: sm}
+	if maxConcurrent > 0 {
+		s.sem = make(chan struct{}, maxConcurrent)
+	}
+	return s
+}
+
+// Serve accepts connections on l, serving each in its own goroutine, until l
+// fails to accept one. It returns the error from accepting.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves requests made over conn until the client hangs up. Any
+// requests still in progress at that point are canceled.
+func (s *Server) ServeConn(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svc := &service{
+		sm:       s.sm,
+		sem:      s.sem,
+		ctx:      ctx,
+		calls:    make(map[uint64]context.CancelFunc),
+		canceled: make(map[uint64]bool),
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(serviceName, svc); err != nil {
+		// Only possible if service's methods are malformed.
+		panic(err)
+	}
+	// ServeConn waits for calls in progress to finish before returning, so
+	// they are canceled as soon as the client is found to have hung up.
+	srv.ServeConn(hangupConn{Conn: conn, hungup: cancel})
+}
+
+// hangupConn is a net.Conn that calls hungup once reading from it fails, as it
+// does once the other end has closed it.
+type hangupConn struct {
+	net.Conn
+	hungup func()
+}
+
+func (c hangupConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.hungup()
+	}
+	return n, err
+}
+
+// service adapts a gps.SourceManager to the form required by net/rpc, for a
+// single connection.
+type service struct {
+	sm  gps.SourceManager
+	sem chan struct{}   // Shared with all connections
+	ctx context.Context // Canceled once the connection is closed
+
+	mu    sync.Mutex
+	calls map[uint64]context.CancelFunc // Cancels each call in progress, by Seq
+	// Seqs of calls that were canceled before they started. net/rpc handles
+	// each request in its own goroutine, so a Cancel may overtake the call it
+	// cancels.
+	canceled map[uint64]bool
+}
+
+// begin starts the call identified by c, returning the context in which it is
+// to be made and a func to call once it is done. It waits for the call's turn
+// if the number of concurrent requests is limited.
+func (s *service) begin(c Call) (context.Context, func(), error) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	if s.canceled[c.Seq] {
+		delete(s.canceled, c.Seq)
+		cancel()
+	}
+	s.calls[c.Seq] = cancel
+	s.mu.Unlock()
+
+	done := func() {
+		s.mu.Lock()
+		delete(s.calls, c.Seq)
+		s.mu.Unlock()
+		cancel()
+	}
+
+	if s.sem != nil {
+		select {
+		case s.sem <- struct{}{}:
+		case <-ctx.Done():
+			done()
+			return nil, nil, ctx.Err()
+		}
+		return ctx, func() { <-s.sem; done() }, nil
+	}
+	return ctx, done, nil
+}
+
+// Cancel cancels the call identified by seq, if it has not yet finished.
+func (s *service) Cancel(seq uint64, _ *struct{}) error {
+	s.mu.Lock()
+	if cancel, has := s.calls[seq]; has {
+		cancel()
+	} else {
+		s.canceled[seq] = true
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *service) SourceExists(args IDArgs, exists *bool) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	*exists, err = s.sm.SourceExists(ctx, args.ID)
+	return err
+}
+
+func (s *service) SyncSourceFor(args IDArgs, _ *struct{}) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return s.sm.SyncSourceFor(ctx, args.ID)
+}
+
+func (s *service) ListVersions(args IDArgs, versions *[]Version) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	vl, err := s.sm.ListVersions(ctx, args.ID)
+	if err != nil {
+		return err
+	}
+	*versions = make([]Version, len(vl))
+	for i, v := range vl {
+		(*versions)[i] = toWireVersion(v)
+	}
+	return nil
+}
+
+func (s *service) RevisionPresentIn(args RevisionArgs, present *bool) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	*present, err = s.sm.RevisionPresentIn(ctx, args.ID, args.Revision)
+	return err
+}
+
+func (s *service) ListPackages(args VersionArgs, ptree *PackageTree) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	pt, err := s.sm.ListPackages(ctx, args.ID, args.Version.version())
+	if err != nil {
+		return err
+	}
+	*ptree = toWirePackageTree(pt)
+	return nil
+}
+
+func (s *service) ExportProject(args ExportArgs, _ *struct{}) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return s.sm.ExportProject(ctx, args.ID, args.Version.version(), args.To)
+}
+
+func (s *service) ExportPrunedProject(args ExportPrunedArgs, _ *struct{}) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return s.sm.ExportPrunedProject(ctx, args.LP.lockedProject(), args.Prune, args.To)
+}
+
+func (s *service) DeduceProjectRoot(args PathArgs, root *gps.ProjectRoot) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	*root, err = s.sm.DeduceProjectRoot(ctx, args.Path)
+	return err
+}
+
+func (s *service) SourceURLsForPath(args PathArgs, urls *[]string) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	us, err := s.sm.SourceURLsForPath(ctx, args.Path)
+	if err != nil {
+		return err
+	}
+	*urls = toWireURLs(us)
+	return nil
+}
+
+func (s *service) InferConstraint(args InferArgs, c *Constraint) error {
+	ctx, done, err := s.begin(args.Call)
+	if err != nil {
+		return err
+	}
+	defer done()
+	ic, err := s.sm.InferConstraint(ctx, args.S, args.ID)
+	if err != nil {
+		return err
+	}
+	*c = toWireConstraint(ic)
+	return nil
+}
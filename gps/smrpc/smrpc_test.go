@@ -0,0 +1,189 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smrpc
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// fakeSM is a gps.SourceManager that answers from fixed data.
+type fakeSM struct {
+	gps.SourceManager
+	versions []gps.PairedVersion
+	ptree    pkgtree.PackageTree
+	exported []string
+}
+
+func (sm *fakeSM) ListVersions(ctx context.Context, id gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	if id.ProjectRoot == "example.com/missing" {
+		return nil, errors.Errorf("no source for %s", id.ProjectRoot)
+	}
+	return sm.versions, nil
+}
+
+func (sm *fakeSM) ListPackages(ctx context.Context, id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+	return sm.ptree, nil
+}
+
+func (sm *fakeSM) ExportProject(ctx context.Context, id gps.ProjectIdentifier, v gps.Version, to string) error {
+	sm.exported = append(sm.exported, to)
+	return nil
+}
+
+func (sm *fakeSM) SourceURLsForPath(ctx context.Context, ip string) ([]*url.URL, error) {
+	u, err := url.Parse("https://" + ip)
+	return []*url.URL{u}, err
+}
+
+func (sm *fakeSM) InferConstraint(ctx context.Context, s string, id gps.ProjectIdentifier) (gps.Constraint, error) {
+	switch s {
+	case "":
+		return gps.Any(), nil
+	case "master":
+		return gps.NewBranch("master"), nil
+	}
+	return gps.NewSemverConstraintIC(s)
+}
+
+func newTestClient(sm gps.SourceManager) *Client {
+	sconn, cconn := net.Pipe()
+	go NewServer(sm, 1).ServeConn(sconn)
+	return NewClient(cconn)
+}
+
+func TestClientServer(t *testing.T) {
+	sm := &fakeSM{
+		versions: []gps.PairedVersion{
+			gps.NewVersion("v1.0.0").Pair("rev1"),
+			gps.NewVersion("plain").Pair("rev2"),
+			gps.NewBranch("master").Pair("rev3"),
+		},
+		ptree: pkgtree.PackageTree{
+			ImportRoot: "example.com/project",
+			Packages: map[string]pkgtree.PackageOrErr{
+				"example.com/project": {P: pkgtree.Package{
+					Name:       "project",
+					ImportPath: "example.com/project",
+					Imports:    []string{"fmt"},
+				}},
+				"example.com/project/bad": {Err: errors.New("bad package")},
+			},
+		},
+	}
+	c := newTestClient(sm)
+	defer c.Release()
+	id := gps.ProjectIdentifier{ProjectRoot: "example.com/project"}
+
+	vl, err := c.ListVersions(context.Background(), id)
+	if err != nil {
+		t.Fatalf("unexpected error listing versions: %s", err)
+	}
+	if len(vl) != len(sm.versions) {
+		t.Fatalf("expected %d versions, got %v", len(sm.versions), vl)
+	}
+	for i, v := range vl {
+		want := sm.versions[i]
+		if v.Type() != want.Type() || v.String() != want.String() || v.Revision() != want.Revision() {
+			t.Errorf("expected version %s (%s) to survive the round trip, got %s (%s)", want, want.Revision(), v, v.Revision())
+		}
+	}
+
+	if _, err = c.ListVersions(context.Background(), gps.ProjectIdentifier{ProjectRoot: "example.com/missing"}); err == nil {
+		t.Error("expected error from the served SourceManager to be returned")
+	}
+
+	ptree, err := c.ListPackages(context.Background(), id, vl[0])
+	if err != nil {
+		t.Fatalf("unexpected error listing packages: %s", err)
+	}
+	if !reflect.DeepEqual(ptree.Packages["example.com/project"], sm.ptree.Packages["example.com/project"]) {
+		t.Errorf("expected package to survive the round trip, got %#v", ptree.Packages["example.com/project"])
+	}
+	if perr := ptree.Packages["example.com/project/bad"].Err; perr == nil || perr.Error() != "bad package" {
+		t.Errorf("expected package error to survive the round trip, got %v", perr)
+	}
+
+	if err = c.ExportProject(context.Background(), id, vl[0], "relative"); err != nil {
+		t.Fatalf("unexpected error exporting: %s", err)
+	}
+	if len(sm.exported) != 1 || !filepath.IsAbs(sm.exported[0]) {
+		t.Errorf("expected a single export to an absolute path, got %v", sm.exported)
+	}
+
+	urls, err := c.SourceURLsForPath(context.Background(), "example.com/project")
+	if err != nil {
+		t.Fatalf("unexpected error getting source URLs: %s", err)
+	}
+	if len(urls) != 1 || urls[0].String() != "https://example.com/project" {
+		t.Errorf("unexpected source URLs: %v", urls)
+	}
+
+	for _, s := range []string{"", "master", "^1.0.0"} {
+		want, _ := sm.InferConstraint(context.Background(), s, id)
+		got, err := c.InferConstraint(context.Background(), s, id)
+		if err != nil {
+			t.Fatalf("unexpected error inferring constraint %q: %s", s, err)
+		}
+		if got.String() != want.String() || got.Matches(gps.NewVersion("v1.2.0")) != want.Matches(gps.NewVersion("v1.2.0")) {
+			t.Errorf("expected constraint %s for %q, got %s", want, s, got)
+		}
+	}
+}
+
+// blockingSM is a gps.SourceManager whose SyncSourceFor blocks until its
+// context is done, which it then reports.
+type blockingSM struct {
+	gps.SourceManager
+	started, canceled chan struct{}
+}
+
+func (sm *blockingSM) SyncSourceFor(ctx context.Context, id gps.ProjectIdentifier) error {
+	sm.started <- struct{}{}
+	<-ctx.Done()
+	sm.canceled <- struct{}{}
+	return ctx.Err()
+}
+
+func TestServerCancels(t *testing.T) {
+	sm := &blockingSM{started: make(chan struct{}), canceled: make(chan struct{})}
+	c := newTestClient(sm)
+	id := gps.ProjectIdentifier{ProjectRoot: "example.com/project"}
+
+	waitFor := func(ch chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for the served call to be %s", what)
+		}
+	}
+
+	// A call whose context is canceled is canceled on the server too.
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- c.SyncSourceFor(ctx, id) }()
+	waitFor(sm.started, "started")
+	cancel()
+	waitFor(sm.canceled, "canceled")
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("expected the call to fail with context.Canceled, got %v", err)
+	}
+
+	// As is a call in progress when the client hangs up.
+	go c.SyncSourceFor(context.Background(), id)
+	waitFor(sm.started, "started")
+	c.Release()
+	waitFor(sm.canceled, "canceled")
+}
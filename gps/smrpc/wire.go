@@ -0,0 +1,229 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smrpc
+
+import (
+	"net/url"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// The types in this file are the forms in which arguments and results are sent
+// between Client and Server. gps's own types are mostly interfaces backed by
+// unexported types, which cannot be sent as they are.
+
+// Version is the wire form of a gps.Version.
+type Version struct {
+	Revision string
+	Branch   string
+	Version  string
+}
+
+func toWireVersion(v gps.Version) Version {
+	if v == nil {
+		return Version{}
+	}
+	var wv Version
+	wv.Revision, wv.Branch, wv.Version = gps.VersionComponentStrings(v)
+	return wv
+}
+
+func (wv Version) version() gps.Version {
+	var uv gps.UnpairedVersion
+	switch {
+	case wv.Branch != "":
+		uv = gps.NewBranch(wv.Branch)
+	case wv.Version != "":
+		uv = gps.NewVersion(wv.Version)
+	case wv.Revision != "":
+		return gps.Revision(wv.Revision)
+	default:
+		return nil
+	}
+
+	if wv.Revision != "" {
+		return uv.Pair(gps.Revision(wv.Revision))
+	}
+	return uv
+}
+
+// Constraint is the wire form of a gps.Constraint.
+type Constraint struct {
+	Any     bool
+	Semver  string // Set if the constraint is a semver range
+	Version Version
+}
+
+func toWireConstraint(c gps.Constraint) Constraint {
+	if gps.IsAny(c) {
+		return Constraint{Any: true}
+	}
+	if v, ok := c.(gps.Version); ok {
+		return Constraint{Version: toWireVersion(v)}
+	}
+	return Constraint{Semver: c.String()}
+}
+
+func (wc Constraint) constraint() (gps.Constraint, error) {
+	switch {
+	case wc.Any:
+		return gps.Any(), nil
+	case wc.Semver != "":
+		return gps.NewSemverConstraint(wc.Semver)
+	}
+	if v := wc.Version.version(); v != nil {
+		return v, nil
+	}
+	return nil, errors.New("empty constraint")
+}
+
+// LockedProject is the wire form of a gps.LockedProject.
+type LockedProject struct {
+	Ident    gps.ProjectIdentifier
+	Version  Version
+	Packages []string
+}
+
+func toWireLockedProject(lp gps.LockedProject) LockedProject {
+	return LockedProject{
+		Ident:    lp.Ident(),
+		Version:  toWireVersion(lp.Version()),
+		Packages: lp.Packages(),
+	}
+}
+
+func (wlp LockedProject) lockedProject() gps.LockedProject {
+	return gps.NewLockedProject(wlp.Ident, wlp.Version.version(), wlp.Packages)
+}
+
+// PackageOrErr is the wire form of a pkgtree.PackageOrErr. Errors are sent
+// only as their messages, so their types are lost.
+type PackageOrErr struct {
+	P   pkgtree.Package
+	Err string
+}
+
+// PackageTree is the wire form of a pkgtree.PackageTree.
+type PackageTree struct {
+	ImportRoot   string
+	Packages     map[string]PackageOrErr
+	LicenseFiles map[string][]string
+}
+
+func toWirePackageTree(ptree pkgtree.PackageTree) PackageTree {
+	wpt := PackageTree{
+		ImportRoot:   ptree.ImportRoot,
+		Packages:     make(map[string]PackageOrErr, len(ptree.Packages)),
+		LicenseFiles: ptree.LicenseFiles,
+	}
+	for ip, poe := range ptree.Packages {
+		wpoe := PackageOrErr{P: poe.P}
+		if poe.Err != nil {
+			wpoe.Err = poe.Err.Error()
+		}
+		wpt.Packages[ip] = wpoe
+	}
+	return wpt
+}
+
+func (wpt PackageTree) packageTree() pkgtree.PackageTree {
+	ptree := pkgtree.PackageTree{
+		ImportRoot:   wpt.ImportRoot,
+		Packages:     make(map[string]pkgtree.PackageOrErr, len(wpt.Packages)),
+		LicenseFiles: wpt.LicenseFiles,
+	}
+	for ip, wpoe := range wpt.Packages {
+		poe := pkgtree.PackageOrErr{P: wpoe.P}
+		if wpoe.Err != "" {
+			poe.Err = errors.New(wpoe.Err)
+		}
+		ptree.Packages[ip] = poe
+	}
+	return ptree
+}
+
+func toWireURLs(us []*url.URL) []string {
+	s := make([]string, len(us))
+	for i, u := range us {
+		s[i] = u.String()
+	}
+	return s
+}
+
+func urlsFromWire(s []string) ([]*url.URL, error) {
+	us := make([]*url.URL, len(s))
+	for i, su := range s {
+		u, err := url.Parse(su)
+		if err != nil {
+			return nil, err
+		}
+		us[i] = u
+	}
+	return us, nil
+}
+
+// Call identifies a single request made by a Client, so that the Client can
+// have the Server cancel it. Every argument type embeds one.
+type Call struct {
+	Seq uint64
+}
+
+func (c *Call) setSeq(seq uint64) { c.Seq = seq }
+
+// callArgs is implemented by every argument type, through its Call.
+type callArgs interface {
+	setSeq(uint64)
+}
+
+// IDArgs identifies a project.
+type IDArgs struct {
+	Call
+	ID gps.ProjectIdentifier
+}
+
+// PathArgs holds an import path.
+type PathArgs struct {
+	Call
+	Path string
+}
+
+// VersionArgs identifies a version of a project.
+type VersionArgs struct {
+	Call
+	ID      gps.ProjectIdentifier
+	Version Version
+}
+
+// RevisionArgs identifies a revision of a project.
+type RevisionArgs struct {
+	Call
+	ID       gps.ProjectIdentifier
+	Revision gps.Revision
+}
+
+// ExportArgs are the arguments to SourceManager.ExportProject.
+type ExportArgs struct {
+	Call
+	ID      gps.ProjectIdentifier
+	Version Version
+	To      string
+}
+
+// ExportPrunedArgs are the arguments to SourceManager.ExportPrunedProject.
+type ExportPrunedArgs struct {
+	Call
+	LP    LockedProject
+	Prune gps.PruneOptions
+	To    string
+}
+
+// InferArgs are the arguments to SourceManager.InferConstraint.
+type InferArgs struct {
+	Call
+	S  string
+	ID gps.ProjectIdentifier
+}
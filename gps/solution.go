@@ -9,10 +9,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
-	"github.com/pkg/errors"
-	"golang.org/x/sync/errgroup"
+	"github.com/golang/dep/internal/fs"
 )
 
 // A Solution is returned by a solver run. It is mostly just a Lock, with some
@@ -30,6 +30,16 @@ type Solution interface {
 	Attempts() int
 }
 
+// A ReasonedSolution is a Solution that can also explain why each of its
+// projects was selected. The Solutions returned by gps's solver are all
+// ReasonedSolutions.
+type ReasonedSolution interface {
+	Solution
+	// The constraints that drove the selection of each project in the
+	// solution, keyed by project root.
+	PinReasons() PinReasons
+}
+
 type solution struct {
 	// The projects selected by the solver.
 	p []LockedProject
@@ -45,6 +55,74 @@ type solution struct {
 
 	// The solver used in producing this solution
 	solv Solver
+
+	// The constraints on each selected project
+	reasons PinReasons
+}
+
+// PinReasons explains each project in a Solution by the constraints that drove
+// its selection, keyed by project root. The reasons for each project are
+// in order of the root of their dependers, with the root project first.
+type PinReasons map[ProjectRoot][]PinReason
+
+// PinReason is a constraint that one project in a solution, or the root
+// project, put on another.
+type PinReason struct {
+	Depender   ProjectRoot // The project that depends on the pinned one.
+	Version    Version     // The selected version of the depender, or nil if it is the root project.
+	Constraint Constraint  // The constraint the depender put on the pinned project, after any overrides.
+	Overridden bool        // True if the constraint is from an override in the root manifest, in place of the depender's own.
+	Packages   []string    // The packages of the pinned project that the depender imports.
+}
+
+// IsRoot reports whether the constraint was put on by the root project.
+func (r PinReason) IsRoot() bool {
+	return r.Version == nil
+}
+
+// String returns a string like: "github.com/foo/bar@v1.0.0 requires ^1.2.0"
+func (r PinReason) String() string {
+	dep := "(root)"
+	if !r.IsRoot() {
+		dep = fmt.Sprintf("%s@%s", r.Depender, r.Version)
+	}
+	if r.Overridden {
+		return fmt.Sprintf("%s requires %s (overridden)", dep, r.Constraint)
+	}
+	return fmt.Sprintf("%s requires %s", dep, r.Constraint)
+}
+
+// pinReasons returns the PinReasons of the projects selected in sel, whose root
+// project is root.
+func pinReasons(sel *selection, root ProjectRoot) PinReasons {
+	pr := make(PinReasons, len(sel.deps))
+	for id, deps := range sel.deps {
+		// Backtracking can leave behind projects that nothing depends on.
+		if len(deps) == 0 {
+			continue
+		}
+		reasons := make([]PinReason, 0, len(deps))
+		for _, dep := range deps {
+			r := PinReason{
+				Depender:   dep.depender.id.ProjectRoot,
+				Constraint: dep.dep.Constraint,
+				Overridden: dep.dep.overrConstraint,
+				Packages:   append([]string(nil), dep.dep.pl...),
+			}
+			if r.Depender != root {
+				r.Version = dep.depender.v
+			}
+			reasons = append(reasons, r)
+		}
+		sort.SliceStable(reasons, func(i, j int) bool {
+			if reasons[i].IsRoot() != reasons[j].IsRoot() {
+				return reasons[i].IsRoot()
+			}
+			return reasons[i].Depender < reasons[j].Depender
+		})
+		pr[id] = reasons
+	}
+	return pr
 }
 
 // WriteProgress informs about the progress of WriteDepTree.
@@ -65,6 +143,19 @@ func (p WriteProgress) String() string {
 
 const concurrentWriters = 16
 
+// projectWriter is implemented by SourceManagers that can export and prune a
+// project as a single supervised call. WriteDepTree prefers this to calling
+// ExportProject and PruneProject itself.
+type projectWriter interface {
+	writeProject(ctx context.Context, lp LockedProject, prune PruneOptions, to string) error
+}
+
+// exportNormalizer is implemented by SourceManagers that may normalize the
+// trees they export; see SourceManagerConfig.NormalizeExports.
+type exportNormalizer interface {
+	normalizesExports() bool
+}
+
 // WriteDepTree takes a basedir, a Lock and a RootPruneOptions and exports all
 // the projects listed in the lock to the appropriate target location within basedir.
 //
@@ -74,8 +165,27 @@ const concurrentWriters = 16
 // It requires a SourceManager to do the work. Prune options are read from the
 // passed manifest.
 //
+// Up to concurrentWriters projects are written at once. A failure to write one
+// project does not stop the others from being written; if any fail, the
+// returned error reports every failure.
+//
+// Projects are recorded in a journal within basedir as they are completely
+// written. If a previous run into the same basedir failed or was interrupted,
+// projects its journal records as written at the same version are not written
+// again, and everything else it left behind, which may be partially written,
+// is removed. The journal is removed once every project has been written; it
+// is left, along with basedir, if any project fails, so that a later call can
+// pick up where this one left off.
+//
+// If sm normalizes the trees it exports, the whole of basedir is normalized
+// once every project has been written, so that what is pruned from each
+// project, and the directories above them, do not leave it any less
+// reproducible.
+//
+// The projects are exported with ctx, so cancelling it abandons the write.
+//
 // If onWrite is not nil, it will be called after each project write. Calls are ordered and atomic.
-func WriteDepTree(basedir string, l Lock, sm SourceManager, co CascadingPruneOptions, onWrite func(WriteProgress)) error {
+func WriteDepTree(ctx context.Context, basedir string, l Lock, sm SourceManager, co CascadingPruneOptions, onWrite func(WriteProgress)) error {
 	if l == nil {
 		return fmt.Errorf("must provide non-nil Lock to WriteDepTree")
 	}
@@ -84,69 +194,109 @@ func WriteDepTree(basedir string, l Lock, sm SourceManager, co CascadingPruneOpt
 		return err
 	}
 
-	g, ctx := errgroup.WithContext(context.TODO())
+	j, err := openWriteJournal(basedir)
+	if err != nil {
+		return err
+	}
+
 	lps := l.Projects()
+	done := make([]bool, len(lps))
+	for i, p := range lps {
+		pr := p.Ident().ProjectRoot
+		done[i] = j.completed(p, co.PruneOptionsFor(pr), filepath.FromSlash(filepath.Join(basedir, string(pr))))
+	}
+	if err = j.clean(basedir, lps, done); err != nil {
+		j.close()
+		return err
+	}
+
+	pw, _ := sm.(projectWriter)
 	sem := make(chan struct{}, concurrentWriters)
+	errs := make([]error, len(lps))
+	var wg sync.WaitGroup
 	var cnt struct {
 		sync.Mutex
 		i int
 	}
 
 	for i := range lps {
-		p := lps[i] // per-iteration copy
-
-		g.Go(func() error {
-			err := func() error {
-				select {
-				case sem <- struct{}{}:
-					defer func() { <-sem }()
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-
-				ident := p.Ident()
-				projectRoot := string(ident.ProjectRoot)
-				to := filepath.FromSlash(filepath.Join(basedir, projectRoot))
-
-				if err := sm.ExportProject(ctx, ident, p.Version(), to); err != nil {
-					return errors.Wrapf(err, "failed to export %s", projectRoot)
-				}
-
-				err := PruneProject(to, p, co.PruneOptionsFor(ident.ProjectRoot))
-				if err != nil {
-					return errors.Wrapf(err, "failed to prune %s", projectRoot)
-				}
-
-				return ctx.Err()
-			}()
-
-			switch err {
-			case context.Canceled, context.DeadlineExceeded:
-				// Don't report "secondary" errors.
-			default:
-				if onWrite != nil {
-					// Increment and call atomically to prevent re-ordering.
-					cnt.Lock()
-					cnt.i++
-					onWrite(WriteProgress{
-						Count:   cnt.i,
-						Total:   len(lps),
-						LP:      p,
-						Failure: err != nil,
-					})
-					cnt.Unlock()
-				}
+		i, p := i, lps[i] // per-iteration copy
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			pr := p.Ident().ProjectRoot
+			to := filepath.FromSlash(filepath.Join(basedir, string(pr)))
+			prune := co.PruneOptionsFor(pr)
+
+			var err error
+			if !done[i] {
+				err = writeProject(ctx, sm, pw, j, p, prune, to)
 			}
+			errs[i] = err
 
+			if onWrite != nil {
+				// Increment and call atomically to prevent re-ordering.
+				cnt.Lock()
+				cnt.i++
+				onWrite(WriteProgress{
+					Count:   cnt.i,
+					Total:   len(lps),
+					LP:      p,
+					Failure: err != nil,
+				})
+				cnt.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failed errorSlice
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	switch len(failed) {
+	case 0:
+		if err = j.remove(); err != nil {
 			return err
-		})
+		}
+		if n, ok := sm.(exportNormalizer); ok && n.normalizesExports() {
+			return fs.NormalizeTree(basedir)
+		}
+		return nil
+	case 1:
+		j.close()
+		return wrapError(failed[0], "failed to write dep tree")
+	default:
+		j.close()
+		return wrapErrorf(failed, "failed to write %d projects in dep tree", len(failed))
 	}
+}
 
-	err := g.Wait()
-	if err != nil {
-		os.RemoveAll(basedir)
+// writeProject writes p into to, first removing anything an earlier run may
+// have left there, and records it in j once it is complete.
+func writeProject(ctx context.Context, sm SourceManager, pw projectWriter, j *writeJournal, p LockedProject, prune PruneOptions, to string) error {
+	projectRoot := string(p.Ident().ProjectRoot)
+	if err := os.RemoveAll(to); err != nil {
+		return wrapErrorf(err, "failed to clean %s", projectRoot)
+	}
+
+	if pw != nil {
+		if err := pw.writeProject(ctx, p, prune, to); err != nil {
+			return wrapErrorf(err, "failed to write %s", projectRoot)
+		}
+	} else if err := sm.ExportProject(ctx, p.Ident(), p.Version(), to); err != nil {
+		return wrapErrorf(err, "failed to export %s", projectRoot)
+	} else if err = PruneProject(to, p, prune); err != nil {
+		return wrapErrorf(err, "failed to prune %s", projectRoot)
 	}
-	return errors.Wrap(err, "failed to write dep tree")
+	return j.record(p, prune)
 }
 
 func (r solution) Projects() []LockedProject {
@@ -169,6 +319,10 @@ func (r solution) AnalyzerVersion() int {
 	return r.analyzerInfo.Version
 }
 
+func (r solution) PinReasons() PinReasons {
+	return r.reasons
+}
+
 func (r solution) SolverName() string {
 	return r.solv.Name()
 }
@@ -5,15 +5,22 @@
 package gps
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 var basicResult solution
@@ -91,17 +98,17 @@ func testWriteDepTree(t *testing.T) {
 	// Trigger simultaneous fetch of all three to speed up test execution time
 	for _, p := range r.p {
 		go func(pi ProjectIdentifier) {
-			sm.SyncSourceFor(pi)
+			sm.SyncSourceFor(context.Background(), pi)
 		}(p.Ident())
 	}
 
 	// nil lock/result should err immediately
-	err = WriteDepTree(tmp, nil, sm, defaultCascadingPruneOptions(), nil)
+	err = WriteDepTree(context.Background(), tmp, nil, sm, defaultCascadingPruneOptions(), nil)
 	if err == nil {
 		t.Errorf("Should error if nil lock is passed to WriteDepTree")
 	}
 
-	err = WriteDepTree(tmp, r, sm, defaultCascadingPruneOptions(), nil)
+	err = WriteDepTree(context.Background(), tmp, r, sm, defaultCascadingPruneOptions(), nil)
 	if err != nil {
 		t.Errorf("Unexpected error while creating vendor tree: %s", err)
 	}
@@ -117,6 +124,223 @@ func testWriteDepTree(t *testing.T) {
 	}
 }
 
+// exportFailingSM is a SourceManager whose exports fail for the projects in
+// fail, and succeed for all others.
+type exportFailingSM struct {
+	SourceManager
+	fail map[ProjectRoot]bool
+}
+
+func (sm exportFailingSM) ExportProject(ctx context.Context, id ProjectIdentifier, v Version, to string) error {
+	if sm.fail[id.ProjectRoot] {
+		return errors.Errorf("no export for %s", id.ProjectRoot)
+	}
+	return os.MkdirAll(to, 0777)
+}
+
+// writingSM is an exportFailingSM that also writes whole projects itself.
+type writingSM struct {
+	exportFailingSM
+	mu      sync.Mutex
+	written []ProjectRoot
+}
+
+func (sm *writingSM) writeProject(ctx context.Context, lp LockedProject, prune PruneOptions, to string) error {
+	sm.mu.Lock()
+	sm.written = append(sm.written, lp.Ident().ProjectRoot)
+	sm.mu.Unlock()
+	return sm.ExportProject(ctx, lp.Ident(), lp.Version(), to)
+}
+
+func TestWriteDepTreeReportsAllFailures(t *testing.T) {
+	var r solution
+	for _, n := range []string{"a", "b", "c", "d"} {
+		r.p = append(r.p, NewLockedProject(mkPI("example.com/"+n), NewBranch("master").Pair(Revision(n)), nil))
+	}
+	sm := exportFailingSM{fail: map[ProjectRoot]bool{
+		"example.com/b": true,
+		"example.com/d": true,
+	}}
+
+	var failures, writes int
+	onWrite := func(p WriteProgress) {
+		writes++
+		if p.Failure {
+			failures++
+		}
+		if p.Count != writes || p.Total != len(r.p) {
+			t.Errorf("unexpected progress count %d/%d after %d writes", p.Count, p.Total, writes)
+		}
+	}
+
+	tmp, err := ioutil.TempDir("", "writetree")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+	basedir := filepath.Join(tmp, "vendor")
+
+	err = WriteDepTree(context.Background(), basedir, r, sm, defaultCascadingPruneOptions(), onWrite)
+	if err == nil {
+		t.Fatal("expected an error when projects fail to export")
+	}
+	for _, pr := range []string{"example.com/b", "example.com/d"} {
+		if !strings.Contains(err.Error(), "no export for "+pr) {
+			t.Errorf("expected error to report failure of %s, got: %s", pr, err)
+		}
+	}
+	if writes != len(r.p) || failures != 2 {
+		t.Errorf("expected %d writes with 2 failures, got %d with %d", len(r.p), writes, failures)
+	}
+	if _, err = os.Stat(filepath.Join(basedir, writeJournalFilename)); err != nil {
+		t.Errorf("expected journal to be left after failure: %s", err)
+	}
+
+	// SourceManagers that write projects themselves are left to do so, and
+	// only have to write those that failed before.
+	wsm := &writingSM{exportFailingSM: exportFailingSM{}}
+	if err = WriteDepTree(context.Background(), basedir, r, wsm, defaultCascadingPruneOptions(), nil); err != nil {
+		t.Fatalf("unexpected error writing dep tree: %s", err)
+	}
+	sort.Slice(wsm.written, func(i, j int) bool { return wsm.written[i] < wsm.written[j] })
+	if !reflect.DeepEqual(wsm.written, []ProjectRoot{"example.com/b", "example.com/d"}) {
+		t.Errorf("expected only the failed projects to be written by the SourceManager, got %v", wsm.written)
+	}
+}
+
+// normalizingSM is a writingSM that normalizes the trees it exports.
+type normalizingSM struct {
+	*writingSM
+}
+
+func (normalizingSM) normalizesExports() bool { return true }
+
+func TestWriteDepTreeNormalizes(t *testing.T) {
+	var r solution
+	for _, n := range []string{"a", "b"} {
+		r.p = append(r.p, NewLockedProject(mkPI("example.com/"+n), NewBranch("master").Pair(Revision(n)), nil))
+	}
+
+	tmp, err := ioutil.TempDir("", "writetree")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+	basedir := filepath.Join(tmp, "vendor")
+
+	sm := normalizingSM{&writingSM{exportFailingSM: exportFailingSM{}}}
+	if err = WriteDepTree(context.Background(), basedir, r, sm, defaultCascadingPruneOptions(), nil); err != nil {
+		t.Fatalf("unexpected error writing dep tree: %s", err)
+	}
+	for _, dir := range []string{basedir, filepath.Join(basedir, "example.com"), filepath.Join(basedir, "example.com", "a")} {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(fs.NormalizedModTime) || fi.Mode().Perm() != 0755 {
+			t.Errorf("expected %s to be normalized, got mode %s and time %s", dir, fi.Mode(), fi.ModTime())
+		}
+	}
+}
+
+func TestWriteDepTreeResumesFromJournal(t *testing.T) {
+	var r solution
+	for _, n := range []string{"a", "b", "c"} {
+		r.p = append(r.p, NewLockedProject(mkPI("example.com/"+n), NewBranch("master").Pair(Revision(n)), nil))
+	}
+	prune := defaultCascadingPruneOptions()
+
+	tmp, err := ioutil.TempDir("", "writetree")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+	basedir := filepath.Join(tmp, "vendor")
+
+	// Leave behind what an interrupted run would: a completely written project
+	// recorded in the journal, a partially written one that is not, and one
+	// that has since been dropped from the lock.
+	for _, n := range []string{"a", "b", "gone"} {
+		if err = os.MkdirAll(filepath.Join(basedir, "example.com", n), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(basedir, "example.com", n, "leftover"), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j, err := openWriteJournal(basedir)
+	if err != nil {
+		t.Fatalf("unexpected error opening journal: %s", err)
+	}
+	if err = j.record(r.p[0], prune.PruneOptionsFor(r.p[0].Ident().ProjectRoot)); err != nil {
+		t.Fatalf("unexpected error recording project: %s", err)
+	}
+	j.close()
+
+	sm := &writingSM{exportFailingSM: exportFailingSM{}}
+	var writes int
+	onWrite := func(WriteProgress) { writes++ }
+	if err = WriteDepTree(context.Background(), basedir, r, sm, prune, onWrite); err != nil {
+		t.Fatalf("unexpected error writing dep tree: %s", err)
+	}
+
+	if writes != len(r.p) {
+		t.Errorf("expected progress for all %d projects, got %d", len(r.p), writes)
+	}
+	sort.Slice(sm.written, func(i, j int) bool { return sm.written[i] < sm.written[j] })
+	if !reflect.DeepEqual(sm.written, []ProjectRoot{"example.com/b", "example.com/c"}) {
+		t.Errorf("expected only unjournaled projects to be written, got %v", sm.written)
+	}
+	if _, err = os.Stat(filepath.Join(basedir, "example.com", "a", "leftover")); err != nil {
+		t.Errorf("expected journaled project to be left in place: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(basedir, "example.com", "b", "leftover")); !os.IsNotExist(err) {
+		t.Errorf("expected partially written project to be cleaned, stat returned %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(basedir, "example.com", "gone")); !os.IsNotExist(err) {
+		t.Errorf("expected project no longer in the lock to be removed, stat returned %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(basedir, writeJournalFilename)); !os.IsNotExist(err) {
+		t.Errorf("expected journal to be removed after a complete write, stat returned %v", err)
+	}
+}
+
+func TestWriteDepTreeRewritesProjectsWithChangedPackages(t *testing.T) {
+	v := NewBranch("master").Pair(Revision("a"))
+	old := NewLockedProject(mkPI("example.com/a"), v, []string{"foo"})
+	r := solution{p: []LockedProject{NewLockedProject(mkPI("example.com/a"), v, []string{"bar", "foo"})}}
+	prune := defaultCascadingPruneOptions()
+
+	tmp, err := ioutil.TempDir("", "writetree")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+	basedir := filepath.Join(tmp, "vendor")
+
+	// The project was completely written by an interrupted run, but with a
+	// different set of packages than the lock now calls for.
+	if err = os.MkdirAll(filepath.Join(basedir, "example.com", "a"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	j, err := openWriteJournal(basedir)
+	if err != nil {
+		t.Fatalf("unexpected error opening journal: %s", err)
+	}
+	if err = j.record(old, prune.PruneOptionsFor(old.Ident().ProjectRoot)); err != nil {
+		t.Fatalf("unexpected error recording project: %s", err)
+	}
+	j.close()
+
+	sm := &writingSM{exportFailingSM: exportFailingSM{}}
+	if err = WriteDepTree(context.Background(), basedir, r, sm, prune, nil); err != nil {
+		t.Fatalf("unexpected error writing dep tree: %s", err)
+	}
+	if !reflect.DeepEqual(sm.written, []ProjectRoot{"example.com/a"}) {
+		t.Errorf("expected project with changed packages to be rewritten, got %v", sm.written)
+	}
+}
+
 func BenchmarkCreateVendorTree(b *testing.B) {
 	// We're fs-bound here, so restrict to single parallelism
 	b.SetParallelism(1)
@@ -135,7 +359,7 @@ func BenchmarkCreateVendorTree(b *testing.B) {
 
 	// Prefetch the projects before timer starts
 	for _, lp := range r.p {
-		err := sm.SyncSourceFor(lp.Ident())
+		err := sm.SyncSourceFor(context.Background(), lp.Ident())
 		if err != nil {
 			b.Errorf("failed getting project info during prefetch: %s", err)
 			clean = false
@@ -151,7 +375,7 @@ func BenchmarkCreateVendorTree(b *testing.B) {
 			// ease manual inspection
 			os.RemoveAll(exp)
 			b.StartTimer()
-			err = WriteDepTree(exp, r, sm, defaultCascadingPruneOptions(), nil)
+			err = WriteDepTree(context.Background(), exp, r, sm, defaultCascadingPruneOptions(), nil)
 			b.StopTimer()
 			if err != nil {
 				b.Errorf("unexpected error after %v iterations: %s", i, err)
@@ -5,6 +5,7 @@
 package gps
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -178,6 +179,96 @@ var bimodalFixtures = map[string]bimodalFixture{
 			"b 1.1.0",
 		),
 	},
+	// Scoped constraints apply if the constrained project is reachable from one
+	// of the packages named in the scope
+	"scoped constraint activated by import from scope": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+				pkg("root/cmd/tool", "root/foo"),
+				pkg("root/foo", "b"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+			),
+			dsp(mkDepspec("b 1.1.0"),
+				pkg("b"),
+			),
+		},
+		scoped: ScopedConstraints{
+			"b": ScopedConstraint{
+				ProjectProperties: ProjectProperties{Constraint: mkSVC("1.0.0")},
+				Packages:          []string{"root/cmd/tool"},
+			},
+		},
+		r: mksolution(
+			"a 1.0.0",
+			"b 1.0.0",
+		),
+	},
+	// Scoped constraints are ignored if the constrained project is only
+	// reachable from packages outside the scope
+	"scoped constraint not activated by import outside scope": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "b"),
+				pkg("root/cmd/tool", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+			),
+			dsp(mkDepspec("b 1.1.0"),
+				pkg("b"),
+			),
+		},
+		scoped: ScopedConstraints{
+			"b": ScopedConstraint{
+				ProjectProperties: ProjectProperties{Constraint: mkSVC("1.0.0")},
+				Packages:          []string{"root/cmd/tool"},
+			},
+		},
+		r: mksolution(
+			"a 1.0.0",
+			"b 1.1.0",
+		),
+	},
+	// Applicable scoped constraints intersect with unscoped constraints on the
+	// same project
+	"scoped constraint intersects with unscoped constraint": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0", "b ^1.0.0"),
+				pkg("root", "b"),
+				pkg("root/cmd/tool", "b"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+			),
+			dsp(mkDepspec("b 1.1.0"),
+				pkg("b"),
+			),
+			dsp(mkDepspec("b 1.2.0"),
+				pkg("b"),
+			),
+			dsp(mkDepspec("b 2.0.0"),
+				pkg("b"),
+			),
+		},
+		scoped: ScopedConstraints{
+			"b": ScopedConstraint{
+				ProjectProperties: ProjectProperties{Constraint: mkSVC("<1.2.0")},
+				Packages:          []string{"root/cmd/tool"},
+			},
+		},
+		r: mksolution(
+			"b 1.1.0",
+		),
+	},
 	// Import jump is in a dep, and points to a transitive dep - but only in not
 	// the first version we try
 	"transitive bm-add on older version": {
@@ -1314,6 +1405,8 @@ type bimodalFixture struct {
 	fail error
 	// overrides, if any
 	ovr ProjectConstraints
+	// package-scoped root constraints, if any
+	scoped ScopedConstraints
 	// request up/downgrade to all projects
 	changeall bool
 	// pkgs to ignore
@@ -1345,6 +1438,7 @@ func (f bimodalFixture) rootmanifest() RootManifest {
 	m := simpleRootManifest{
 		c:   pcSliceToMap(f.ds[0].deps),
 		ovr: f.ovr,
+		sc:  f.scoped,
 		ig:  pkgtree.NewIgnoredRuleset(f.ignore),
 		req: make(map[string]bool),
 	}
@@ -1401,7 +1495,7 @@ func newbmSM(bmf bimodalFixture) *bmSourceManager {
 	return sm
 }
 
-func (sm *bmSourceManager) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+func (sm *bmSourceManager) ListPackages(ctx context.Context, id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
 	// Deal with address-based root-switching with both case folding and
 	// alternate sources.
 	var src, fsrc, root, froot string
@@ -1448,7 +1542,7 @@ func (sm *bmSourceManager) ListPackages(id ProjectIdentifier, v Version) (pkgtre
 	return pkgtree.PackageTree{}, fmt.Errorf("project %s at version %s could not be found", id, v)
 }
 
-func (sm *bmSourceManager) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+func (sm *bmSourceManager) GetManifestAndLock(ctx context.Context, id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
 	src := toFold(id.normalizedSource())
 	for _, ds := range sm.specs {
 		if src == string(ds.n) && v.Matches(ds.v) {
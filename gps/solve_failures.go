@@ -42,6 +42,16 @@ func (e *noVersionError) Error() string {
 	return buf.String()
 }
 
+// Unwrap returns why each version tried failed, so that errors.Is and
+// errors.As find any of those failures.
+func (e *noVersionError) Unwrap() []error {
+	errs := make([]error, 0, len(e.fails))
+	for _, f := range e.fails {
+		errs = append(errs, f.f)
+	}
+	return errs
+}
+
 func (e *noVersionError) traceString() string {
 	if len(e.fails) == 0 {
 		return fmt.Sprintf("No versions found")
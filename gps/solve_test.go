@@ -12,6 +12,7 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/golang/dep/internal/test"
 )
@@ -260,3 +261,261 @@ func TestRootLockNoVersionPairMatching(t *testing.T) {
 
 	fixtureSolveSimpleChecks(fix, res, err, t)
 }
+
+func TestSolveEvents(t *testing.T) {
+	solveEvents := func(fix basicFixture) []SolveEvent {
+		events := make(chan SolveEvent)
+		var got []SolveEvent
+		done := make(chan struct{})
+		go func() {
+			for e := range events {
+				got = append(got, e)
+				if _, ok := e.(SolveFinished); ok {
+					close(done)
+					return
+				}
+			}
+		}()
+
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			Events:          events,
+		}
+		fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		<-done
+		return got
+	}
+
+	got := solveEvents(basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0", "b 1.0.0"),
+			mkDepspec("a 2.0.0", "b 2.0.0"),
+			mkDepspec("b 1.0.0"),
+		},
+	})
+	want := []SolveEvent{
+		ProjectSelected{Project: mkPI("a"), Version: NewVersion("2.0.0"), Packages: []string{"a"}},
+		VersionRejected{Project: mkPI("b"), Version: NewVersion("1.0.0")},
+		Backtracked{Project: mkPI("a")},
+		ProjectSelected{Project: mkPI("a"), Version: NewVersion("1.0.0"), Packages: []string{"a"}},
+		ProjectSelected{Project: mkPI("b"), Version: NewVersion("1.0.0"), Packages: []string{"b"}},
+	}
+	if len(got) != len(want)+1 {
+		t.Fatalf("expected %d events, got %#v", len(want)+1, got)
+	}
+	for i, e := range want {
+		g := got[i]
+		if r, ok := g.(VersionRejected); ok {
+			if _, ok := r.Reason.(*versionNotAllowedFailure); !ok {
+				t.Errorf("expected b 1.0.0 to be rejected for its version, got %v", r.Reason)
+			}
+			r.Reason = nil
+			g = r
+		}
+		if !reflect.DeepEqual(g, e) {
+			t.Errorf("event %d: expected %#v, got %#v", i, e, g)
+		}
+	}
+	if fin := got[len(got)-1].(SolveFinished); fin.Err != nil || len(fin.Solution.Projects()) != 2 {
+		t.Errorf("expected a solution with 2 projects, got %#v", fin)
+	}
+
+	got = solveEvents(basicFixtures["no version that matches while backtracking"])
+	if fin, ok := got[len(got)-1].(SolveFinished); !ok || fin.Err == nil || fin.Solution != nil {
+		t.Errorf("expected the last event to be a failure, got %#v", got[len(got)-1])
+	}
+}
+
+func TestSolveEventsStopOnCancel(t *testing.T) {
+	fix := basicFixtures["no version that matches while backtracking"]
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+		// Never received from.
+		Events:     make(chan SolveEvent),
+		stdLibFn:   func(string) bool { return false },
+		mkBridgeFn: overrideMkBridge,
+	}
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	solved := make(chan error, 1)
+	go func() {
+		_, err := s.Solve(ctx)
+		solved <- err
+	}()
+	cancel()
+
+	select {
+	case err = <-solved:
+		if err == nil {
+			t.Error("expected a canceled solve to fail")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected a canceled solve to stop waiting on its events to be received")
+	}
+}
+
+func TestSolveAttemptsOnFailure(t *testing.T) {
+	fix := basicFixtures["no valid solution"]
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+		stdLibFn:        func(string) bool { return false },
+		mkBridgeFn:      overrideMkBridge,
+	}
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Solve(context.Background()); err == nil {
+		t.Fatal("expected solving to fail")
+	}
+	// Every version of a and b conflicts with the other, so the solver has to
+	// backtrack once before running out of versions.
+	if a := s.(*solver).Attempts(); a != 1 {
+		t.Errorf("expected the attempt made before failing to be counted, got %d", a)
+	}
+}
+
+func TestSolveProgress(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0", "b 1.0.0"),
+			mkDepspec("a 2.0.0", "b 2.0.0"),
+			mkDepspec("b 1.0.0"),
+		},
+	}
+	var buf bytes.Buffer
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+		Progress:        &buf,
+	}
+	if _, err := fixSolve(params, newdepspecSM(fix.ds, nil), t); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `Solving for root, which imports 1 projects
+Selected a@2.0.0
+Backtracking from a
+Selected a@1.0.0
+Selected b@1.0.0
+Solved with 2 projects after 1 attempts
+`
+	if buf.String() != want {
+		t.Errorf("unexpected progress:\n\t(GOT):\n%s\n\t(WNT):\n%s", buf.String(), want)
+	}
+}
+
+func TestSolvePinReasons(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "b *", "a *"),
+			mkDepspec("a 1.0.0", "b 1.0.0"),
+			mkDepspec("a 2.0.0", "b 2.0.0"),
+			mkDepspec("b 1.0.0"),
+			mkDepspec("b 2.0.0"),
+		},
+		ovr: ProjectConstraints{
+			ProjectRoot("a"): ProjectProperties{
+				Constraint: NewVersion("1.0.0"),
+			},
+		},
+	}
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[ProjectRoot][]string{
+		"a": {"(root) requires 1.0.0 (overridden)"},
+		"b": {"(root) requires *", "a@1.0.0 requires 1.0.0"},
+	}
+	rs, ok := soln.(ReasonedSolution)
+	if !ok {
+		t.Fatalf("expected a ReasonedSolution, got %T", soln)
+	}
+	reasons := rs.PinReasons()
+	if len(reasons) != len(want) {
+		t.Errorf("expected reasons for %d projects, got %v", len(want), reasons)
+	}
+	for pr, wantrs := range want {
+		var got []string
+		for _, r := range reasons[pr] {
+			got = append(got, r.String())
+		}
+		if !reflect.DeepEqual(got, wantrs) {
+			t.Errorf("unexpected reasons for %s:\n\t(GOT): %q\n\t(WNT): %q", pr, got, wantrs)
+		}
+	}
+
+	if r := reasons["b"][1]; r.IsRoot() || r.Depender != "a" || !reflect.DeepEqual(r.Packages, []string{"b"}) {
+		t.Errorf("expected b to be pinned by its package imported from a, got %+v", r)
+	}
+}
+
+func TestSolvePreservesAnnotations(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 1.0.0 arev"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("b 1.0.0 brev"),
+			mkDepspec("b 1.1.0"),
+		},
+	}
+	a, b := mkAtom("a 1.0.0 arev"), mkAtom("b 1.0.0 brev")
+	l := fixLock{
+		Annotate(NewLockedProject(a.id, a.v, []string{"."}), Annotations{"reviewed": "yes"}),
+		Annotate(NewLockedProject(b.id, b.v, []string{"."}), Annotations{"reviewed": "yes"}),
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Lock:            l,
+		ToChange:        []ProjectRoot{"b"},
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lp := range soln.Projects() {
+		got := ProjectAnnotations(lp)
+		switch lp.Ident().ProjectRoot {
+		case "a":
+			if !reflect.DeepEqual(got, Annotations{"reviewed": "yes"}) {
+				t.Errorf("expected the annotations of unchanged a to be preserved, got %v", got)
+			}
+		case "b":
+			if got != nil {
+				t.Errorf("expected the annotations of b to be dropped when it changed, got %v", got)
+			}
+		}
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"container/heap"
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"sort"
 	"strings"
 	"sync"
@@ -97,6 +99,20 @@ type SolveParameters struct {
 	// solving process.
 	TraceLogger *log.Logger
 
+	// Progress, if set, is written a short line of text each time the solver
+	// selects a new project or gives one up, and once solving has finished.
+	// Unlike the output of TraceLogger, it is meant to be shown to users as a
+	// matter of course, to show that solving is getting somewhere.
+	Progress io.Writer
+
+	// Events, if set, is sent a SolveEvent for each step the solver takes, as
+	// an alternative to TraceLogger for tools that need to inspect them. The
+	// solver blocks until each event is received, so the channel must be
+	// drained until SolveFinished is received, or the context passed to Solve
+	// is canceled; once it is, events are dropped instead, SolveFinished
+	// included. It is not closed.
+	Events chan<- SolveEvent
+
 	// stdLibFn is the function to use to recognize standard library import paths.
 	// Only overridden for tests. Defaults to paths.IsStandardImportPath if nil.
 	stdLibFn func(string) bool
@@ -118,6 +134,16 @@ type solver struct {
 	// Logger used exclusively for trace output, or nil to suppress.
 	tl *log.Logger
 
+	// Writer for progress lines, or nil to suppress.
+	progress io.Writer
+
+	// Channel to send solve events on, or nil to suppress.
+	events chan<- SolveEvent
+
+	// Closed when the context of the solving run is done, to stop waiting on
+	// events to be received.
+	done <-chan struct{}
+
 	// The function to use to recognize standard library import paths.
 	stdLibFn func(string) bool
 
@@ -166,20 +192,60 @@ type solver struct {
 }
 
 func (params SolveParameters) toRootdata() (rootdata, error) {
+	rd, errs := params.prepRootdata(false)
+	if len(errs) > 0 {
+		return rootdata{}, errs
+	}
+	return rd, nil
+}
+
+// Validate checks the parameters for all of the problems that Prepare would
+// fail on, and some that it would not, such as a root directory that does not
+// exist, options that contradict each other, and a lock that contradicts
+// itself or the manifest. Where Prepare stops at the first problem it finds,
+// Validate returns every problem it finds, as a ParamErrs, or nil if there are
+// none.
+func (params SolveParameters) Validate() error {
+	if _, errs := params.prepRootdata(true); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// prepRootdata prepares the rootdata for a solve from the parameters, along
+// with every problem it finds with them. Unless strict is set, it only looks
+// for the problems that would keep the solver from running at all; otherwise,
+// it also looks for those that Validate reports, but Prepare lets through.
+func (params SolveParameters) prepRootdata(strict bool) (rootdata, ParamErrs) {
+	var errs ParamErrs
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, badOptsFailure(fmt.Sprintf(format, args...)))
+	}
+
 	if params.ProjectAnalyzer == nil {
-		return rootdata{}, badOptsFailure("must provide a ProjectAnalyzer")
+		add("must provide a ProjectAnalyzer")
 	}
 	if params.RootDir == "" {
-		return rootdata{}, badOptsFailure("params must specify a non-empty root directory")
+		add("params must specify a non-empty root directory")
+	} else if strict {
+		if fi, err := os.Stat(params.RootDir); err != nil {
+			add("could not read project root (%s): %s", params.RootDir, err)
+		} else if !fi.IsDir() {
+			add("project root (%s) is a file, not a directory", params.RootDir)
+		}
 	}
-	if params.RootPackageTree.ImportRoot == "" {
-		return rootdata{}, badOptsFailure("params must include a non-empty import root")
+	root := params.RootPackageTree.ImportRoot
+	if root == "" {
+		add("params must include a non-empty import root")
 	}
 	if len(params.RootPackageTree.Packages) == 0 {
-		return rootdata{}, badOptsFailure("at least one package must be present in the PackageTree")
+		add("at least one package must be present in the PackageTree")
+	}
+	if strict && params.ChangeAll && len(params.ToChange) != 0 {
+		add("update specifically requested for %s, but all projects are to be changed anyway", params.ToChange)
 	}
 	if params.Lock == nil && len(params.ToChange) != 0 {
-		return rootdata{}, badOptsFailure(fmt.Sprintf("update specifically requested for %s, but no lock was provided to upgrade from", params.ToChange))
+		add("update specifically requested for %s, but no lock was provided to upgrade from", params.ToChange)
 	}
 
 	if params.Manifest == nil {
@@ -213,13 +279,14 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 				both = append(both, pkg)
 			}
 		}
+		sort.Strings(both)
 		switch len(both) {
 		case 0:
 			break
 		case 1:
-			return rootdata{}, badOptsFailure(fmt.Sprintf("%q was given as both a required and ignored package", both[0]))
+			add("%q was given as both a required and ignored package", both[0])
 		default:
-			return rootdata{}, badOptsFailure(fmt.Sprintf("multiple packages given as both required and ignored: %s", strings.Join(both, ", ")))
+			add("multiple packages given as both required and ignored: %s", strings.Join(both, ", "))
 		}
 	}
 
@@ -230,39 +297,69 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 			eovr = append(eovr, string(pr))
 		}
 	}
+	sort.Strings(eovr)
+
+	// Maybe it's a little nitpicky to do this (we COULD proceed; empty
+	// overrides have no effect), but this errs on the side of letting the
+	// tool/user know there's bad input. Purely as a principle, that seems
+	// preferable to silently allowing progress with icky input.
+	switch len(eovr) {
+	case 0:
+		break
+	case 1:
+		add("An override was declared for %s, but without any non-zero properties", eovr[0])
+	default:
+		add("Overrides lacked any non-zero properties for multiple project roots: %s", strings.Join(eovr, " "))
+	}
 
-	if eovr != nil {
-		// Maybe it's a little nitpicky to do this (we COULD proceed; empty
-		// overrides have no effect), but this errs on the side of letting the
-		// tool/user know there's bad input. Purely as a principle, that seems
-		// preferable to silently allowing progress with icky input.
-		if len(eovr) > 1 {
-			return rootdata{}, badOptsFailure(fmt.Sprintf("Overrides lacked any non-zero properties for multiple project roots: %s", strings.Join(eovr, " ")))
+	if strict && root != "" {
+		if _, has := params.Manifest.DependencyConstraints()[ProjectRoot(root)]; has {
+			add("a constraint was declared on the root project %s itself", root)
+		}
+		if _, has := rd.ovr[ProjectRoot(root)]; has {
+			add("an override was declared on the root project %s itself", root)
 		}
-		return rootdata{}, badOptsFailure(fmt.Sprintf("An override was declared for %s, but without any non-zero properties", eovr[0]))
 	}
 
 	// Prep safe, normalized versions of root manifest and lock data
 	rd.rm = prepManifest(params.Manifest)
 
+	// Fold in any package-scoped constraints that are applicable to the root
+	// project's reach.
+	if srm, ok := params.Manifest.(ScopedRootManifest); ok {
+		errs = append(errs, rd.applyScopedConstraints(srm.ScopedConstraints())...)
+	}
+
 	if params.Lock != nil {
 		for _, lp := range params.Lock.Projects() {
-			rd.rlm[lp.Ident().ProjectRoot] = lp
+			pr := lp.Ident().ProjectRoot
+			if strict {
+				_, dup := rd.rlm[pr]
+				switch {
+				case dup:
+					add("%s is in the lock more than once", pr)
+				case string(pr) == root:
+					add("the root project %s is in its own lock", pr)
+				case lp.Version() == nil:
+					add("%s is in the lock without a version", pr)
+				}
+			}
+			rd.rlm[pr] = lp
 		}
 
 		// Also keep a prepped one, mostly for the bridge. This is probably
 		// wasteful, but only minimally so, and yay symmetry
 		rd.rl = prepLock(params.Lock)
-	}
 
-	for _, p := range params.ToChange {
-		if _, exists := rd.rlm[p]; !exists {
-			return rootdata{}, badOptsFailure(fmt.Sprintf("cannot update %s as it is not in the lock", p))
+		for _, p := range params.ToChange {
+			if _, exists := rd.rlm[p]; !exists {
+				add("cannot update %s as it is not in the lock", p)
+			}
+			rd.chng[p] = struct{}{}
 		}
-		rd.chng[p] = struct{}{}
 	}
 
-	return rd, nil
+	return rd, errs
 }
 
 // Prepare readies a Solver for use.
@@ -286,6 +383,8 @@ func Prepare(params SolveParameters, sm SourceManager) (Solver, error) {
 
 	s := &solver{
 		tl:       params.TraceLogger,
+		progress: params.Progress,
+		events:   params.Events,
 		stdLibFn: params.stdLibFn,
 		rd:       rd,
 	}
@@ -366,6 +465,13 @@ type Solver interface {
 	Version() int
 }
 
+// Attempts returns the number of times the solver has backtracked and started
+// moving forward again. Once Solve has returned, it is the total for the
+// solving run, whether or not a solution was found.
+func (s *solver) Attempts() int {
+	return s.attempts
+}
+
 func (s *solver) Name() string {
 	return "gps-cdcl"
 }
@@ -374,6 +480,23 @@ func (s *solver) Version() int {
 	return 1
 }
 
+// ParamErrs is returned by SolveParameters.Validate, with each problem it found
+// with the parameters.
+type ParamErrs []error
+
+func (e ParamErrs) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%d problems with the solve parameters:%s", len(e), errorSlice(e).Error())
+}
+
+// Unwrap returns the problems, so that errors.Is and errors.As find any of
+// them.
+func (e ParamErrs) Unwrap() []error {
+	return e
+}
+
 // DeductionErrs maps package import path to errors occurring during deduction.
 type DeductionErrs map[string]error
 
@@ -381,8 +504,23 @@ func (e DeductionErrs) Error() string {
 	return "could not deduce external imports' project roots"
 }
 
+// Unwrap returns the errors for each import path, in order of the path, so that
+// errors.Is and errors.As find any of them.
+func (e DeductionErrs) Unwrap() []error {
+	paths := make([]string, 0, len(e))
+	for path := range e {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	errs := make([]error, 0, len(e))
+	for _, path := range paths {
+		errs = append(errs, e[path])
+	}
+	return errs
+}
+
 // ValidateParams validates the solver parameters to ensure solving can be completed.
-func ValidateParams(params SolveParameters, sm SourceManager) error {
+func ValidateParams(ctx context.Context, params SolveParameters, sm SourceManager) error {
 	// Ensure that all packages are deducible without issues.
 	var deducePkgsGroup sync.WaitGroup
 	deductionErrs := make(DeductionErrs)
@@ -394,7 +532,7 @@ func ValidateParams(params SolveParameters, sm SourceManager) error {
 	}
 
 	deducePkg := func(ip string, sm SourceManager) {
-		_, err := sm.DeduceProjectRoot(ip)
+		_, err := sm.DeduceProjectRoot(ctx, ip)
 		if err != nil {
 			errsMut.Lock()
 			deductionErrs[ip] = err
@@ -427,13 +565,16 @@ func (s *solver) Solve(ctx context.Context) (Solution, error) {
 		return nil, errors.New("solve method can only be run once per instance")
 	}
 	// Make sure the bridge has the context before we start.
-	//s.b.ctx = ctx
+	s.b.setContext(ctx)
+	s.done = ctx.Done()
 
 	// Set up a metrics object
 	s.mtr = newMetrics()
 
 	// Prime the queues with the root project
 	if err := s.selectRoot(); err != nil {
+		s.emit(SolveFinished{Err: err})
+		s.progressf("Solving failed")
 		return nil, err
 	}
 
@@ -448,6 +589,7 @@ func (s *solver) Solve(ctx context.Context) (Solution, error) {
 		}
 		soln.analyzerInfo = s.rd.an.Info()
 		soln.i = s.rd.externalImportList(s.stdLibFn)
+		soln.reasons = pinReasons(s.sel, ProjectRoot(s.rd.rpt.ImportRoot))
 
 		// Convert ProjectAtoms into LockedProjects
 		soln.p = make([]LockedProject, 0, len(all))
@@ -702,7 +844,7 @@ func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []com
 			}
 
 			// Nope, it's actually full-on not there.
-			return nil, nil, fmt.Errorf("package %s does not exist within project %s", pkg, a.a.id)
+			return nil, nil, &PackageNotFoundError{ImportPath: pkg, Project: a.a.id}
 		}
 
 		for _, ex := range ie.External {
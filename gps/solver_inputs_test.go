@@ -5,6 +5,7 @@
 package gps
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"math/rand"
@@ -218,7 +219,7 @@ func TestValidateParams(t *testing.T) {
 			},
 		}
 
-		err = ValidateParams(params, sm)
+		err = ValidateParams(context.Background(), params, sm)
 		if tc.err && err == nil {
 			t.Fatalf("expected an error when deducing package fails, got none")
 		} else if !tc.err && err != nil {
@@ -226,3 +227,81 @@ func TestValidateParams(t *testing.T) {
 		}
 	}
 }
+
+func TestSolveParametersValidate(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("root")
+
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "example.com/root",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"example.com/root": {P: pkgtree.Package{Name: "root", ImportPath: "example.com/root"}},
+		},
+	}
+	v := NewVersion("v1.0.0").Pair("abc")
+	params := SolveParameters{
+		RootDir:         h.Path("root"),
+		RootPackageTree: ptree,
+		ProjectAnalyzer: naiveAnalyzer{},
+		Manifest: simpleRootManifest{
+			c: ProjectConstraints{"example.com/a": ProjectProperties{Constraint: Any()}},
+		},
+		Lock: SimpleLock{
+			NewLockedProject(mkPI("example.com/a"), v, nil),
+		},
+		ToChange: []ProjectRoot{"example.com/a"},
+	}
+	if err := params.Validate(); err != nil {
+		t.Fatalf("unexpected problems with valid params: %s", err)
+	}
+
+	params.RootDir = h.Path("root") + "-missing"
+	params.RootPackageTree = pkgtree.PackageTree{ImportRoot: "example.com/root"}
+	params.ProjectAnalyzer = nil
+	params.ChangeAll = true
+	params.ToChange = []ProjectRoot{"example.com/a", "example.com/b"}
+	params.Lock = SimpleLock{
+		NewLockedProject(mkPI("example.com/a"), v, nil),
+		NewLockedProject(mkPI("example.com/a"), v, nil),
+		NewLockedProject(mkPI("example.com/root"), v, nil),
+	}
+	params.Manifest = simpleRootManifest{
+		c:   ProjectConstraints{"example.com/root": ProjectProperties{Constraint: Any()}},
+		ovr: ProjectConstraints{"example.com/c": ProjectProperties{}},
+		ig:  pkgtree.NewIgnoredRuleset([]string{"example.com/d"}),
+		req: map[string]bool{"example.com/d": true},
+		sc: ScopedConstraints{
+			"example.com/e": {ProjectProperties: ProjectProperties{Constraint: Any()}},
+			"example.com/f": {ProjectProperties: ProjectProperties{Constraint: Any()}, Packages: []string{"example.com/root/missing"}},
+		},
+	}
+
+	err := params.Validate()
+	errs, ok := err.(ParamErrs)
+	if !ok {
+		t.Fatalf("expected ParamErrs, got %T: %v", err, err)
+	}
+	want := []string{
+		"must provide a ProjectAnalyzer",
+		"could not read project root",
+		"at least one package must be present",
+		"but all projects are to be changed anyway",
+		`"example.com/d" was given as both a required and ignored package`,
+		"An override was declared for example.com/c",
+		"a constraint was declared on the root project",
+		"scoped constraint on example.com/e must name at least one root package",
+		"scoped constraint on example.com/f names example.com/root/missing",
+		"example.com/a is in the lock more than once",
+		"the root project example.com/root is in its own lock",
+		"cannot update example.com/b as it is not in the lock",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d problems, got %d:%s", len(want), len(errs), err)
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i].Error(), w) {
+			t.Errorf("problem %d: expected %q, got %q", i, w, errs[i])
+		}
+	}
+}
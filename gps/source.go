@@ -8,10 +8,19 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/golang/dep/gps/internal/dirhash"
 	"github.com/golang/dep/gps/pkgtree"
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/license"
 	"github.com/pkg/errors"
 )
 
@@ -69,6 +78,76 @@ type sourceCoordinator struct {
 	cachedir   string
 	cache      sourceCache
 	logger     *log.Logger
+	// fileDigests is passed on to each sourceGateway; see
+	// sourceGateway.fileDigests.
+	fileDigests bool
+	// sparseExports is passed on to each sourceGateway; see
+	// sourceGateway.sparseExports.
+	sparseExports bool
+	// normalizeExports is passed on to each sourceGateway; see
+	// sourceGateway.normalizeExports.
+	normalizeExports bool
+	// hardlinkExports is passed on to each sourceGateway; see
+	// sourceGateway.hardlinkExports.
+	hardlinkExports bool
+	// backgroundRefresh is passed on to each sourceGateway; see
+	// sourceGateway.backgroundRefresh.
+	backgroundRefresh bool
+	// stateTTLs is shared, read-only, by each sourceGateway; see
+	// sourceGateway.stateTTLs.
+	stateTTLs map[sourceState]time.Duration
+	// If persistNames is set, the sources successfully set up for each folded
+	// source name are persisted in the cachedir, and reused in later runs
+	// instead of deducing them again. Guarded by srcmut.
+	persistNames   bool
+	persisted      map[string]persistedSource
+	persistedDirty bool
+	// usage tracks the disk usage of sources in the cachedir, and evicts them
+	// as needed to stay within quota. Nil if usage is not tracked.
+	usage *sourceUsageTracker
+	// events, if non-nil, receives each SourceEvent in addition to the logger.
+	events eventNotifier
+	// redirects maps the URLs of sources found to have moved upstream to the
+	// URLs they moved to. Guarded by srcmut.
+	redirects map[string]string
+	// nativeGit is whether git sources are set up as native git sources,
+	// rather than ones that use the git binary.
+	nativeGit bool
+	// mirrors maps source URLs to the URLs of their mirrors, in the order in
+	// which they should be failed over to.
+	mirrors map[string][]string
+	// fetchRefspecs maps source URLs to the refspecs restricting what is
+	// fetched from them.
+	fetchRefspecs map[string][]string
+	// keyring is the GnuPG home directory of the keys trusted to sign
+	// versions, if signatures are verified.
+	keyring string
+	// signatures maps the roots of projects whose versions must be signed,
+	// whether or not keyring is set, to what is required of them.
+	signatures map[ProjectRoot]SignatureRequirement
+	// versionFilters maps source URLs to the filters on the versions listed
+	// for them.
+	versionFilters map[string]VersionFilter
+	// versionProvider, if non-nil, is passed on to each sourceGateway; see
+	// sourceGateway.versionProvider.
+	versionProvider VersionProvider
+	// policy, if non-nil, restricts the projects and hosts that sources may
+	// be set up for, and the licenses of the versions they serve.
+	policy *Policy
+	// sandbox, if non-nil, is what ProjectAnalyzers are run in.
+	sandbox AnalyzerSandbox
+	// github, if non-nil, lists the versions of git sources on the GitHub
+	// hosts it has tokens for.
+	github *githubAPI
+	// proxyOnly is whether sources are only set up if they can be retrieved
+	// without contacting upstream.
+	proxyOnly bool
+	// sharedCachedirs are read-only caches, in order, that sources missing
+	// from cachedir are first set up from.
+	sharedCachedirs []string
+	// pinnedMirrors maps project roots to the only mirror or proxy that their
+	// sources may be retrieved through.
+	pinnedMirrors map[ProjectRoot]string
 }
 
 // newSourceCoordinator returns a new sourceCoordinator.
@@ -86,13 +165,182 @@ func newSourceCoordinator(superv *supervisor, deducer deducer, cachedir string,
 		srcs:       make(map[string]*sourceGateway),
 		nameToURL:  make(map[string]string),
 		protoSrcs:  make(map[string][]chan srcReturn),
+		redirects:  make(map[string]string),
 	}
 }
 
 func (sc *sourceCoordinator) close() {
 	if err := sc.cache.close(); err != nil {
-		sc.logger.Println(errors.Wrap(err, "failed to close the source cache"))
+		sc.logger.Println(wrapError(err, "failed to close the source cache"))
 	}
+
+	sc.srcmut.Lock()
+	defer sc.srcmut.Unlock()
+	for url, sg := range sc.srcs {
+		if c, ok := sg.src.(sourceCloser); ok {
+			if err := c.close(); err != nil {
+				sc.logger.Println(wrapErrorf(err, "failed to close source for %s", url))
+			}
+		}
+	}
+
+	if sc.persistNames && sc.persistedDirty {
+		if err := writeSourceNames(sc.cachedir, sc.persisted); err != nil {
+			sc.logger.Println(wrapError(err, "failed to persist source names"))
+		}
+		sc.persistedDirty = false
+	}
+
+	if sc.usage != nil {
+		if err := sc.usage.write(sc.cachedir); err != nil {
+			sc.logger.Println(wrapError(err, "failed to persist source usage"))
+		}
+	}
+}
+
+// notify logs ev, and passes it on to the configured receiver, if any.
+func (sc *sourceCoordinator) notify(ev SourceEvent) {
+	sc.logger.Println(ev)
+	sc.events.notify(ev)
+}
+
+// noteRedirect records that upstream for the source served by sg has moved from
+// one URL to another. The new URL is also served by sg, persisted names using
+// the old URL are updated to use the new one in later runs, and the user is
+// notified so that they can update their manifest and lock.
+//
+// caller must hold sc.srcmut for writing.
+func (sc *sourceCoordinator) noteRedirect(sg *sourceGateway, from, to string) {
+	if sc.redirects[from] == to {
+		return
+	}
+	sc.redirects[from] = to
+
+	if _, has := sc.srcs[to]; !has {
+		sc.srcs[to] = sg
+	}
+	if _, has := sc.nameToURL[to]; !has {
+		sc.nameToURL[to] = to
+	}
+
+	for name, ps := range sc.persisted {
+		if ps.URL == from {
+			ps.URL, ps.MovedFrom = to, from
+			sc.persisted[name] = ps
+			sc.persistedDirty = true
+		}
+	}
+
+	sc.notify(SourceEvent{
+		Type:    SourceRedirected,
+		URL:     from,
+		MovedTo: to,
+		Detail:  fmt.Sprintf("upstream has moved to %s; consider updating the source for this project in the manifest and lock", to),
+	})
+}
+
+// trackUsage enables tracking of the disk usage of sources in the cachedir,
+// evicting least-recently-used sources before setting up new ones if their
+// total size would otherwise exceed quota. If quota is <= 0, nothing is evicted.
+// Either way, quarantined local copies of sources past quarantineMaxAge are
+// pruned.
+func (sc *sourceCoordinator) trackUsage(quota int64) {
+	usage, err := newSourceUsageTracker(sc.cachedir, quota)
+	if err != nil {
+		sc.logger.Println(wrapError(err, "failed to load source usage"))
+	}
+	sc.usage = usage
+
+	pruned, err := usage.pruneQuarantine()
+	for _, path := range pruned {
+		sc.logger.Printf("Pruned %s from the source cache's quarantine", path)
+	}
+	if err != nil {
+		sc.logger.Println(wrapError(err, "failed to prune the source cache's quarantine"))
+	}
+}
+
+// loadPersistedNames enables the persistence of source names, loading those
+// persisted by earlier runs that were set up no earlier than epoch.
+func (sc *sourceCoordinator) loadPersistedNames(epoch time.Time) {
+	names, err := loadSourceNames(sc.cachedir, epoch)
+	if err != nil {
+		sc.logger.Println(wrapError(err, "failed to load persisted source names"))
+	}
+	if names == nil {
+		names = make(map[string]persistedSource)
+	}
+
+	sc.srcmut.Lock()
+	sc.persistNames = true
+	sc.persisted = names
+	sc.srcmut.Unlock()
+}
+
+// persistedSourceFor returns the persisted maybeSource for the folded source
+// name, if there is a valid one.
+func (sc *sourceCoordinator) persistedSourceFor(foldedName string) (maybeSource, bool) {
+	sc.srcmut.RLock()
+	ps, has := sc.persisted[foldedName]
+	sc.srcmut.RUnlock()
+	if !has {
+		return nil, false
+	}
+	return validPersistedSource(ps, sc.cachedir)
+}
+
+// forgetNames drops the name -> URL mappings for all names that are equal to or
+// beneath the given import path prefix, or that contain it, so that subsequent
+// requests for them are deduced afresh. If prefix is empty, all mappings are
+// dropped.
+//
+// Source gateways are retained, as they remain valid for their URLs.
+func (sc *sourceCoordinator) forgetNames(prefix string) {
+	sc.srcmut.Lock()
+	defer sc.srcmut.Unlock()
+
+	if prefix == "" {
+		sc.nameToURL = make(map[string]string)
+		if len(sc.persisted) > 0 {
+			sc.persisted = make(map[string]persistedSource)
+			sc.persistedDirty = true
+		}
+		return
+	}
+
+	fprefix := toFold(prefix)
+	for name := range sc.nameToURL {
+		fname := toFold(name)
+		if (strings.HasPrefix(fname, fprefix) && isPathPrefixOrEqual(fprefix, fname)) ||
+			(strings.HasPrefix(fprefix, fname) && isPathPrefixOrEqual(fname, fprefix)) {
+			delete(sc.nameToURL, name)
+		}
+	}
+	for name := range sc.persisted {
+		if (strings.HasPrefix(name, fprefix) && isPathPrefixOrEqual(fprefix, name)) ||
+			(strings.HasPrefix(fprefix, name) && isPathPrefixOrEqual(name, fprefix)) {
+			delete(sc.persisted, name)
+			sc.persistedDirty = true
+		}
+	}
+}
+
+// existingSourceGatewayFor returns the sourceGateway already set up for id, if
+// there is one, without setting one up.
+func (sc *sourceCoordinator) existingSourceGatewayFor(id ProjectIdentifier) (*sourceGateway, bool) {
+	normalizedName := id.normalizedSource()
+
+	sc.srcmut.RLock()
+	defer sc.srcmut.RUnlock()
+	url, has := sc.nameToURL[normalizedName]
+	if !has {
+		url, has = sc.nameToURL[toFold(normalizedName)]
+	}
+	if !has {
+		return nil, false
+	}
+	srcGate, has := sc.srcs[url]
+	return srcGate, has
 }
 
 func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id ProjectIdentifier) (*sourceGateway, error) {
@@ -100,6 +348,10 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 		return nil, err
 	}
 
+	if err := sc.policy.checkImportPath(string(id.ProjectRoot)); err != nil {
+		return nil, err
+	}
+
 	normalizedName := id.normalizedSource()
 
 	sc.srcmut.RLock()
@@ -165,6 +417,7 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 		rc := make(chan srcReturn, 1)
 		sc.protoSrcs[foldedNormalName] = append(chans, rc)
 		sc.psrcmut.Unlock()
+		sc.supervisor.foldSetup()
 		ret := <-rc
 		return ret.sourceGateway, ret.error
 	}
@@ -172,7 +425,11 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 	sc.protoSrcs[foldedNormalName] = []chan srcReturn{}
 	sc.psrcmut.Unlock()
 
-	doReturn := func(sg *sourceGateway, err error) {
+	// doReturn hands the result to any goroutines folded in with this one, and
+	// returns the error, with any credentials in it, such as those in the URL
+	// of a source that couldn't be set up, scrubbed.
+	doReturn := func(sg *sourceGateway, err error) error {
+		err = sc.supervisor.redact.redactErr(err)
 		ret := srcReturn{sourceGateway: sg, error: err}
 		sc.psrcmut.Lock()
 		for _, rc := range sc.protoSrcs[foldedNormalName] {
@@ -180,14 +437,37 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 		}
 		delete(sc.protoSrcs, foldedNormalName)
 		sc.psrcmut.Unlock()
+		return err
+	}
+
+	// A source persisted from an earlier run lets us skip deduction entirely,
+	// though if it fails to set up, we fall back to deducing afresh.
+	mbs := make(maybeSources, 0, 1)
+	pm, persisted := sc.persistedSourceFor(foldedNormalName)
+	if persisted {
+		mbs = append(mbs, pm)
+	} else {
+		pd, err := sc.deducer.deduceRootPath(ctx, normalizedName)
+		if err != nil {
+			// As in the deducer, don't cache errors so that externally-driven retry
+			// strategies can be constructed.
+			return nil, doReturn(nil, err)
+		}
+		mbs = pd.mb
 	}
 
-	pd, err := sc.deducer.deduceRootPath(ctx, normalizedName)
+	// Sources on hosts the policy does not allow are never set up, nor are
+	// those that can't be retrieved through a pinned mirror, nor, in
+	// proxy-only mode, those that would contact upstream.
+	mbs, err := sc.policy.filterSources(string(id.ProjectRoot), mbs)
+	if err == nil {
+		mbs, err = sc.pinnedSources(id.ProjectRoot, mbs)
+	}
+	if err == nil {
+		mbs, err = sc.proxySources(string(id.ProjectRoot), mbs)
+	}
 	if err != nil {
-		// As in the deducer, don't cache errors so that externally-driven retry
-		// strategies can be constructed.
-		doReturn(nil, err)
-		return nil, err
+		return nil, doReturn(nil, err)
 	}
 
 	// It'd be quite the feat - but not impossible - for a gateway
@@ -210,35 +490,46 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 	defer sc.srcmut.Unlock()
 
 	// Get or create a sourceGateway.
-	var srcGate *sourceGateway
-	var url, unfoldedURL string
-	var errs errorSlice
-	for _, m := range pd.mb {
-		url = m.URL().String()
-		if notFolded {
-			// If the normalizedName and foldedNormalName differ, then we're pretty well
-			// guaranteed that returned URL will also need folding into canonical form.
-			unfoldedURL = url
-			url = toFold(url)
+	srcGate, srcM, url, unfoldedURL, errs := sc.setUpGateway(ctx, id, mbs, notFolded)
+	if srcGate == nil && persisted && ctx.Err() == nil {
+		// The persisted source is no good; drop it, and fall back to deduction.
+		// A call that was cancelled says nothing about the source, though.
+		delete(sc.persisted, foldedNormalName)
+		sc.persistedDirty = true
+
+		sc.srcmut.Unlock()
+		pd, err := sc.deducer.deduceRootPath(ctx, normalizedName)
+		if err == nil {
+			pd.mb, err = sc.policy.filterSources(string(id.ProjectRoot), pd.mb)
 		}
-		if sg, has := sc.srcs[url]; has {
-			srcGate = sg
-			break
+		if err == nil {
+			pd.mb, err = sc.pinnedSources(id.ProjectRoot, pd.mb)
 		}
-		src, err := m.try(ctx, sc.cachedir)
 		if err == nil {
-			cache := sc.cache.newSingleSourceCache(id)
-			srcGate, err = newSourceGateway(ctx, src, sc.supervisor, sc.cachedir, cache)
-			if err == nil {
-				sc.srcs[url] = srcGate
-				break
-			}
+			pd.mb, err = sc.proxySources(string(id.ProjectRoot), pd.mb)
 		}
-		errs = append(errs, err)
+		sc.srcmut.Lock()
+		if err != nil {
+			return nil, doReturn(nil, err)
+		}
+		srcGate, srcM, url, unfoldedURL, errs = sc.setUpGateway(ctx, id, pd.mb, notFolded)
 	}
 	if srcGate == nil {
-		doReturn(nil, errs)
-		return nil, errs
+		return nil, doReturn(nil, errs)
+	}
+
+	if sc.persistNames {
+		if ps, ok := newPersistedSource(srcM); ok {
+			ps.Time = time.Now()
+			if to, moved := sc.redirects[ps.URL]; moved {
+				// Don't make later runs follow the redirect again.
+				ps.URL, ps.MovedFrom = to, ps.URL
+			} else if old, has := sc.persisted[foldedNormalName]; has && old.URL == ps.URL {
+				ps.MovedFrom = old.MovedFrom
+			}
+			sc.persisted[foldedNormalName] = ps
+			sc.persistedDirty = true
+		}
 	}
 
 	// Record the name -> URL mapping, making sure that we also get the
@@ -259,6 +550,126 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 	return srcGate, nil
 }
 
+// setUpGateway returns the sourceGateway for the first of mbs that either
+// already has one, or that can be successfully set up, along with that
+// maybeSource and its URL. If none can, the errors from each are returned.
+//
+// caller must hold sc.srcmut for writing.
+func (sc *sourceCoordinator) setUpGateway(ctx context.Context, id ProjectIdentifier, mbs maybeSources, notFolded bool) (srcGate *sourceGateway, srcM maybeSource, url, unfoldedURL string, errs errorSlice) {
+	for _, m := range mbs {
+		url = m.URL().String()
+		if notFolded {
+			// If the normalizedName and foldedNormalName differ, then we're pretty well
+			// guaranteed that returned URL will also need folding into canonical form.
+			unfoldedURL = url
+			url = toFold(url)
+		}
+		if sg, has := sc.srcs[url]; has {
+			sc.touchSource(m)
+			return sg, m, url, unfoldedURL, nil
+		}
+		sc.maybeMakeRoomFor(m)
+		tm := m
+		if gm, ok := m.(maybeGitSource); ok && sc.nativeGit {
+			tm = maybeNativeGitSource{gm}
+		}
+		pin := sc.pinnedMirrors[id.ProjectRoot]
+		if _, ok := m.(maybeRegistrySource); pin != "" && !ok {
+			tm = maybeMirroredSource{maybeSource: tm, mirrors: []string{pin}, only: true}
+		} else if mirrors := sc.mirrors[m.URL().String()]; len(mirrors) > 0 {
+			tm = maybeMirroredSource{maybeSource: tm, mirrors: mirrors, only: sc.proxyOnly}
+		}
+		if refspecs := sc.fetchRefspecs[m.URL().String()]; len(refspecs) > 0 {
+			tm = maybeRefspecSource{maybeSource: tm, refspecs: refspecs}
+		}
+		if len(sc.sharedCachedirs) > 0 {
+			shared := make([]string, len(sc.sharedCachedirs))
+			for i, dir := range sc.sharedCachedirs {
+				shared[i] = maybeSourceCachePath(dir, m)
+			}
+			tm = maybeSharedCacheSource{maybeSource: tm, shared: shared}
+		}
+		if sc.github != nil && !sc.proxyOnly && sc.github.serves(m.URL()) {
+			tm = maybeGitHubSource{maybeSource: tm, api: sc.github}
+		}
+		src, err := tm.try(ctx, sc.cachedir)
+		if err == nil {
+			cache := sc.cache.newSingleSourceCache(id)
+			srcGate, err = newSourceGateway(ctx, src, sc.supervisor, sc.cachedir, cache)
+			if err == nil {
+				srcGate.maybe = m
+				srcGate.fileDigests = sc.fileDigests
+				srcGate.sparseExports = sc.sparseExports
+				srcGate.normalizeExports = sc.normalizeExports
+				srcGate.hardlinkExports = sc.hardlinkExports
+				srcGate.backgroundRefresh = sc.backgroundRefresh
+				srcGate.stateTTLs = sc.stateTTLs
+				srcGate.events = sc.notify
+				srcGate.keyring = sc.keyring
+				if req, has := sc.signatures[id.ProjectRoot]; has {
+					if req.Keyring != "" {
+						srcGate.keyring = req.Keyring
+					}
+					srcGate.signatureURL = req.URL
+					srcGate.signedModule = id.ProjectRoot
+				}
+				srcGate.versionFilter = sc.versionFilters[m.URL().String()]
+				srcGate.versionProvider = sc.versionProvider
+				srcGate.projectRoot = id.ProjectRoot
+				if srcGate.has(sourceHasLatestVersionList) {
+					// The source listed its versions to show that it exists
+					// upstream, before there was a filter or provider to
+					// apply to them.
+					srcGate.recurateVersions(ctx)
+				}
+				srcGate.policy = sc.policy
+				srcGate.sandbox = sc.sandbox
+				srcGate.pinnedMirror = pin
+				if from, to, moved := srcGate.movedUpstream(); moved {
+					sc.noteRedirect(srcGate, from, to)
+				}
+				srcGate.redirected = func(from, to string) {
+					sc.srcmut.Lock()
+					sc.noteRedirect(srcGate, from, to)
+					sc.srcmut.Unlock()
+				}
+				sc.srcs[url] = srcGate
+				sc.touchSource(m)
+				return srcGate, m, url, unfoldedURL, nil
+			}
+		}
+		errs = append(errs, err)
+	}
+	return nil, nil, url, unfoldedURL, errs
+}
+
+// touchSource records that the source set up from m was used, if usage is
+// being tracked.
+func (sc *sourceCoordinator) touchSource(m maybeSource) {
+	if sc.usage != nil {
+		sc.usage.touch(maybeSourceCachePath(sc.cachedir, m))
+	}
+}
+
+// maybeMakeRoomFor evicts sources from the cachedir as needed to stay within
+// quota, if usage is being tracked and m has not yet been cloned there.
+func (sc *sourceCoordinator) maybeMakeRoomFor(m maybeSource) {
+	if sc.usage == nil {
+		return
+	}
+	if _, err := os.Stat(maybeSourceCachePath(sc.cachedir, m)); !os.IsNotExist(err) {
+		return
+	}
+
+	evicted, err := sc.usage.makeRoom()
+	for _, path := range evicted {
+		sc.logger.Printf("Evicted %s from the source cache to stay within quota", path)
+	}
+	if err != nil {
+		sc.logger.Println(wrapError(err, "failed to make room in the source cache"))
+	}
+}
+
 // sourceGateways manage all incoming calls for data from sources, serializing
 // and caching them as needed.
 type sourceGateway struct {
@@ -266,8 +677,71 @@ type sourceGateway struct {
 	srcState sourceState
 	src      source
 	cache    singleSourceCache
-	mu       sync.Mutex // global lock, serializes all behaviors
+	mu       sync.RWMutex // global lock; serializes all behaviors except pure cache reads
 	suprvsr  *supervisor
+	// The maybeSource from which src was set up, before any wrapping for
+	// mirrors, refspecs and the like. Nil if the gateway was set up directly.
+	maybe maybeSource
+	// If set, every successful export also writes a per-file digest listing
+	// into the root of the exported tree, for later fine-grained verification.
+	fileDigests bool
+	// If set, pruned exports may write out only what will survive pruning, for
+	// sources that support it (see sourceFastPrune).
+	sparseExports bool
+	// If set, every successful export has its file permissions and
+	// modification times normalized (see fs.NormalizeTree).
+	normalizeExports bool
+	// If set, exports may hard link files out of the cache rather than copy
+	// them, for sources that support it (see sourceLinkingExport). This is not
+	// done along with normalizeExports, which would change the cached files.
+	hardlinkExports bool
+	// If set, cached version lists are served without waiting on upstream,
+	// and the latest version list is then retrieved in the background.
+	backgroundRefresh bool
+	refreshing        int32 // 1 while a background version list refresh is in flight
+	// If non-nil, bounds how long each sourceState bit it contains remains
+	// valid once reached, after which it must be reached again. Bits with no
+	// positive TTL never expire.
+	stateTTLs  map[sourceState]time.Duration
+	stateTimes map[sourceState]time.Time // when each bit of srcState was last reached
+	// events receives notice of anything that happens to the source that the
+	// user may want to know about. May be nil.
+	events eventNotifier
+	// redirected, if non-nil, is called when upstream is found to have moved
+	// from one URL to another.
+	redirected func(from, to string)
+	// If non-empty, the GnuPG home directory holding the keys trusted to sign
+	// versions, which must have a good signature by one of them to be used.
+	keyring string
+	// If non-empty, the template of the URL of each version's detached
+	// signature, which is checked rather than its tag or commit. See
+	// SignatureRequirement.URL.
+	signatureURL string
+	// signedModule is the module path that detached signatures are made for.
+	signedModule ProjectRoot
+	// signers maps each tag or revision whose signature has been verified to
+	// the fingerprint of the key that made it. Guarded by mu.
+	signers map[string]string
+	// versionFilter is applied to each version list retrieved from the
+	// source, before it is cached.
+	versionFilter VersionFilter
+	// versionProvider, if non-nil, supplies versions of projectRoot to merge
+	// into each version list retrieved from the source, before it is
+	// filtered.
+	versionProvider VersionProvider
+	projectRoot     ProjectRoot
+	// policy, if non-nil and allowing only some licenses, is checked against
+	// the licenses of each version before its manifest, lock or packages are
+	// served.
+	policy *Policy
+	// licenses maps each revision whose licenses have been detected to those
+	// licenses. Guarded by mu.
+	licenses map[Revision][]string
+	// sandbox, if non-nil, is what ProjectAnalyzers are run in.
+	sandbox AnalyzerSandbox
+	// pinnedMirror, if non-empty, is the only mirror or proxy that the source
+	// may be retrieved through.
+	pinnedMirror string
 }
 
 // newSourceGateway returns a new gateway for src. If the source exists locally,
@@ -277,7 +751,7 @@ func newSourceGateway(ctx context.Context, src source, superv *supervisor, cache
 	local := src.existsLocally(ctx)
 	if local {
 		state |= sourceExistsLocally
-		if err := superv.do(ctx, src.upstreamURL(), ctValidateLocal, func(ctx context.Context) error {
+		if err := superv.doFor(ctx, src.upstreamURL(), src.upstreamURL(), ctValidateLocal, func(ctx context.Context) error {
 			return src.maybeClean(ctx)
 		}); err != nil {
 			return nil, err
@@ -301,6 +775,67 @@ func newSourceGateway(ctx context.Context, src source, superv *supervisor, cache
 	return sg, nil
 }
 
+// readCached calls fn, which must only consult sg.cache, while holding sg.mu
+// for reading, provided the gateway has already reached all of the wanted
+// state. It returns false if the state has not yet been reached or if fn
+// reports a cache miss, in which case the caller should fall back to its fully
+// serialized path.
+//
+// This allows concurrent cache hits to proceed without blocking one another.
+func (sg *sourceGateway) readCached(wanted sourceState, fn func() bool) bool {
+	sg.mu.RLock()
+	defer sg.mu.RUnlock()
+
+	if !sg.has(wanted) {
+		return false
+	}
+	return fn()
+}
+
+// has indicates whether the gateway currently has all of the wanted state,
+// without any of it having expired.
+//
+// caller must hold sg.mu, for reading or writing.
+func (sg *sourceGateway) has(wanted sourceState) bool {
+	return (sg.srcState&^sg.expiredState())&wanted == wanted
+}
+
+// expiredState returns the bits of the gateway's current state that have
+// outlived their TTL.
+//
+// caller must hold sg.mu, for reading or writing.
+func (sg *sourceGateway) expiredState() sourceState {
+	var expired sourceState
+	for flag, ttl := range sg.stateTTLs {
+		if ttl <= 0 || sg.srcState&flag == 0 {
+			continue
+		}
+		// Bits without a recorded time were only ever part of the gateway's
+		// initial state, which is not subject to expiry.
+		if at, has := sg.stateTimes[flag]; has && time.Since(at) > ttl {
+			expired |= flag
+		}
+	}
+	return expired
+}
+
+// addState adds the provided state to the gateway, recording the time at which
+// each of its bits was reached.
+//
+// caller must hold sg.mu for writing.
+func (sg *sourceGateway) addState(state sourceState) {
+	sg.srcState |= state
+	if sg.stateTimes == nil {
+		sg.stateTimes = make(map[sourceState]time.Time)
+	}
+	now := time.Now()
+	for flag := sourceState(1); flag <= state; flag <<= 1 {
+		if state&flag != 0 {
+			sg.stateTimes[flag] = now
+		}
+	}
+}
+
 func (sg *sourceGateway) syncLocal(ctx context.Context) error {
 	sg.mu.Lock()
 	err := sg.require(ctx, sourceExistsLocally|sourceHasLatestLocally)
@@ -326,6 +861,10 @@ func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to stri
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
 
+	if _, err := sg.requireSignature(ctx, v); err != nil {
+		return err
+	}
+
 	err := sg.require(ctx, sourceExistsLocally)
 	if err != nil {
 		return err
@@ -336,8 +875,8 @@ func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to stri
 		return err
 	}
 
-	err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
-		return sg.src.exportRevisionTo(ctx, r, to)
+	err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
+		return sg.exportRevisionTo(ctx, r, to)
 	})
 
 	// It's possible (in git) that we may have tried this against a version that
@@ -346,47 +885,101 @@ func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to stri
 	// and retry.
 	// TODO(sdboyer) It'd be better if we could check the error to see if this
 	// actually was the cause of the problem.
-	if err != nil && sg.srcState&sourceHasLatestLocally == 0 {
+	if err != nil && sg.fetchMightHelp(ctx, r) {
 		if err = sg.require(ctx, sourceHasLatestLocally); err == nil {
-			err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
-				return sg.src.exportRevisionTo(ctx, r, to)
+			sg.suprvsr.retry(ctExportTree, sg.src.upstreamURL())
+			err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
+				return sg.exportRevisionTo(ctx, r, to)
 			})
 		}
 	}
 
+	if err == nil && sg.fileDigests {
+		err = dirhash.WriteFileDigests(to)
+	}
+	if err == nil && sg.normalizeExports {
+		err = fs.NormalizeTree(to)
+	}
+
 	return err
 }
 
+// exportRevisionTo has the source export r to to, linking rather than copying
+// files if the source supports it and the gateway is set to.
+func (sg *sourceGateway) exportRevisionTo(ctx context.Context, r Revision, to string) error {
+	if ls, ok := sg.src.(sourceLinkingExport); ok && sg.hardlinkExports && !sg.normalizeExports {
+		return ls.exportLinkedRevisionTo(ctx, r, to)
+	}
+	return sg.src.exportRevisionTo(ctx, r, to)
+}
+
 func (sg *sourceGateway) exportPrunedVersionTo(ctx context.Context, lp LockedProject, prune PruneOptions, to string) error {
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
 
-	err := sg.require(ctx, sourceExistsLocally)
-	if err != nil {
+	if _, err := sg.requireSignature(ctx, lp.Version()); err != nil {
 		return err
 	}
 
+	// Locked versions are paired with their revision, so this doesn't usually
+	// need to consult the source.
 	r, err := sg.convertToRevision(ctx, lp.Version())
 	if err != nil {
 		return err
 	}
 
-	if fastprune, ok := sg.src.(sourceFastPrune); ok {
-		return sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
-			return fastprune.exportPrunedRevisionTo(ctx, r, lp.Packages(), prune, to)
+	if err = sg.requireRevision(ctx, r); err != nil {
+		return err
+	}
+
+	if fastprune, ok := sg.src.(sourceFastPrune); ok && sg.sparseExports {
+		err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
+			return fastprune.exportPrunedRevisionTo(ctx, r, lp, prune, to)
 		})
+	} else {
+		if err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
+			return sg.exportRevisionTo(ctx, r, to)
+		}); err != nil {
+			return err
+		}
+		err = PruneProject(to, lp, prune)
 	}
 
-	if err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
-		return sg.src.exportRevisionTo(ctx, r, to)
-	}); err != nil {
-		return err
+	if err == nil && sg.fileDigests {
+		err = dirhash.WriteFileDigests(to)
+	}
+	if err == nil && sg.normalizeExports {
+		err = fs.NormalizeTree(to)
 	}
 
-	return PruneProject(to, lp, prune)
+	return err
 }
 
 func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+	if _, err := sg.verifySignature(ctx, v); err != nil {
+		return nil, nil, err
+	}
+	if err := sg.checkLicenses(ctx, pr, v); err != nil {
+		return nil, nil, err
+	}
+	if err := sg.checkRevision(ctx, pr, v); err != nil {
+		return nil, nil, err
+	}
+
+	var m Manifest
+	var l Lock
+	if sg.readCached(0, func() bool {
+		r, has := sg.cache.toRevision(v)
+		if !has {
+			return false
+		}
+		m, l, has = sg.cache.getManifestAndLock(r, an.Info())
+		return has
+	}) {
+		sg.suprvsr.cacheHit(ctGetManifestAndLock, sg.src.upstreamURL())
+		return m, l, nil
+	}
+
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
 
@@ -397,6 +990,7 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 
 	m, l, has := sg.cache.getManifestAndLock(r, an.Info())
 	if has {
+		sg.suprvsr.cacheHit(ctGetManifestAndLock, sg.src.upstreamURL())
 		return m, l, nil
 	}
 
@@ -406,8 +1000,8 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 	}
 
 	label := fmt.Sprintf("%s:%s", sg.src.upstreamURL(), an.Info())
-	err = sg.suprvsr.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
-		m, l, err = sg.src.getManifestAndLock(ctx, pr, r, an)
+	err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctGetManifestAndLock, func(ctx context.Context) error {
+		m, l, err = sg.src.getManifestAndLock(ctx, pr, r, sg.confine(ctx, an))
 		return err
 	})
 
@@ -417,7 +1011,7 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 	// and retry.
 	// TODO(sdboyer) It'd be better if we could check the error to see if this
 	// actually was the cause of the problem.
-	if err != nil && sg.srcState&sourceHasLatestLocally == 0 {
+	if err != nil && sg.fetchMightHelp(ctx, r) {
 		// TODO(sdboyer) we should warn/log/something in adaptive recovery
 		// situations like this
 		err = sg.require(ctx, sourceHasLatestLocally)
@@ -425,8 +1019,9 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 			return nil, nil, err
 		}
 
-		err = sg.suprvsr.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
-			m, l, err = sg.src.getManifestAndLock(ctx, pr, r, an)
+		sg.suprvsr.retry(ctGetManifestAndLock, sg.src.upstreamURL())
+		err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctGetManifestAndLock, func(ctx context.Context) error {
+			m, l, err = sg.src.getManifestAndLock(ctx, pr, r, sg.confine(ctx, an))
 			return err
 		})
 	}
@@ -440,6 +1035,29 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 }
 
 func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Version) (pkgtree.PackageTree, error) {
+	if _, err := sg.verifySignature(ctx, v); err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	if err := sg.checkLicenses(ctx, pr, v); err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	if err := sg.checkRevision(ctx, pr, v); err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+
+	var ptree pkgtree.PackageTree
+	if sg.readCached(0, func() bool {
+		r, has := sg.cache.toRevision(v)
+		if !has {
+			return false
+		}
+		ptree, has = sg.cache.getPackageTree(r, pr)
+		return has
+	}) {
+		sg.suprvsr.cacheHit(ctListPackages, sg.src.upstreamURL())
+		return ptree, nil
+	}
+
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
 
@@ -450,6 +1068,7 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 
 	ptree, has := sg.cache.getPackageTree(r, pr)
 	if has {
+		sg.suprvsr.cacheHit(ctListPackages, sg.src.upstreamURL())
 		return ptree, nil
 	}
 
@@ -459,7 +1078,7 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 	}
 
 	label := fmt.Sprintf("%s:%s", pr, sg.src.upstreamURL())
-	err = sg.suprvsr.do(ctx, label, ctListPackages, func(ctx context.Context) error {
+	err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctListPackages, func(ctx context.Context) error {
 		ptree, err = sg.src.listPackages(ctx, pr, r)
 		return err
 	})
@@ -470,7 +1089,7 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 	// and retry.
 	// TODO(sdboyer) It'd be better if we could check the error to see if this
 	// actually was the cause of the problem.
-	if err != nil && sg.srcState&sourceHasLatestLocally == 0 {
+	if err != nil && sg.fetchMightHelp(ctx, r) {
 		// TODO(sdboyer) we should warn/log/something in adaptive recovery
 		// situations like this
 		err = sg.require(ctx, sourceHasLatestLocally)
@@ -478,7 +1097,8 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 			return pkgtree.PackageTree{}, err
 		}
 
-		err = sg.suprvsr.do(ctx, label, ctListPackages, func(ctx context.Context) error {
+		sg.suprvsr.retry(ctListPackages, sg.src.upstreamURL())
+		err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctListPackages, func(ctx context.Context) error {
 			ptree, err = sg.src.listPackages(ctx, pr, r)
 			return err
 		})
@@ -492,7 +1112,184 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 	return ptree, nil
 }
 
-// caller must hold sg.mu.
+// verifySignature checks that v has a good signature by one of the keys in the
+// gateway's keyring, returning that key's fingerprint. If the gateway has no
+// keyring, nothing is checked, and the fingerprint is empty.
+func (sg *sourceGateway) verifySignature(ctx context.Context, v Version) (string, error) {
+	if sg.keyring == "" {
+		return "", nil
+	}
+
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+	return sg.requireSignature(ctx, v)
+}
+
+// requireSignature is verifySignature, for callers already holding sg.mu.
+//
+// For tags, it is the tag that must be signed. For branches and revisions,
+// there being nothing else to sign, it is the commit. If the gateway has a
+// signatureURL, it is instead the detached signature published there.
+//
+// caller must hold sg.mu for writing.
+func (sg *sourceGateway) requireSignature(ctx context.Context, v Version) (string, error) {
+	if sg.keyring == "" {
+		return "", nil
+	}
+	verify := func(ctx context.Context, v Version, tag string, r Revision) (string, error) {
+		return sg.verifyDetachedSignature(ctx, v, r)
+	}
+	if sg.signatureURL == "" {
+		sv, ok := sg.src.(signatureVerifier)
+		if !ok {
+			return "", errors.Errorf("%s sources do not support signature verification", sg.src.sourceType())
+		}
+		verify = func(ctx context.Context, v Version, tag string, r Revision) (string, error) {
+			return sv.verifySignature(ctx, sg.keyring, tag, r)
+		}
+	}
+
+	r, err := sg.convertToRevision(ctx, v)
+	if err != nil {
+		return "", err
+	}
+	var tag string
+	if t := v.Type(); t == IsVersion || t == IsSemver {
+		tag = v.String()
+	}
+
+	key := "r:" + string(r)
+	if tag != "" {
+		key = "t:" + tag + "@" + string(r)
+	}
+	if signer, has := sg.signers[key]; has {
+		return signer, nil
+	}
+
+	if err = sg.require(ctx, sourceExistsLocally); err != nil {
+		return "", err
+	}
+
+	var signer string
+	label := fmt.Sprintf("%s@%s", sg.src.upstreamURL(), v)
+	err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctVerifySignature, func(ctx context.Context) error {
+		signer, err = verify(ctx, v, tag, r)
+		return err
+	})
+
+	// As with other operations on revisions, the tag or commit may not have
+	// been fetched yet.
+	if err != nil && sg.fetchMightHelp(ctx, r) {
+		if err = sg.require(ctx, sourceHasLatestLocally); err != nil {
+			return "", err
+		}
+		sg.suprvsr.retry(ctVerifySignature, sg.src.upstreamURL())
+		err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctVerifySignature, func(ctx context.Context) error {
+			signer, err = verify(ctx, v, tag, r)
+			return err
+		})
+	}
+	if err != nil {
+		return "", wrapErrorf(err, "signature verification failed for %s", v)
+	}
+
+	if sg.signers == nil {
+		sg.signers = make(map[string]string)
+	}
+	sg.signers[key] = signer
+	return signer, nil
+}
+
+// checkLicenses checks the licenses of v, the version of the project pr,
+// against the gateway's policy. Licenses are detected from the license files
+// in the root of an export of v, so until they have been, which is done once
+// per revision, each check exports the tree.
+func (sg *sourceGateway) checkLicenses(ctx context.Context, pr ProjectRoot, v Version) error {
+	if sg.policy == nil || len(sg.policy.AllowedLicenses) == 0 {
+		return nil
+	}
+
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	r, err := sg.convertToRevision(ctx, v)
+	if err != nil {
+		return err
+	}
+	licenses, has := sg.licenses[r]
+	if !has {
+		if licenses, err = sg.detectLicenses(ctx, r); err != nil {
+			return wrapErrorf(err, "failed to detect licenses of %s", v)
+		}
+		if sg.licenses == nil {
+			sg.licenses = make(map[Revision][]string)
+		}
+		sg.licenses[r] = licenses
+	}
+	return sg.policy.checkLicenses(string(pr), v, licenses)
+}
+
+// checkRevision checks the revision of v, the version of the project pr,
+// against the gateway's policy.
+func (sg *sourceGateway) checkRevision(ctx context.Context, pr ProjectRoot, v Version) error {
+	if sg.policy == nil || sg.policy.AllowedRevisions == nil {
+		return nil
+	}
+
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	r, err := sg.convertToRevision(ctx, v)
+	if err != nil {
+		return err
+	}
+	return sg.policy.checkRevision(pr, v, r)
+}
+
+// detectLicenses exports r somewhere temporary, and detects its licenses.
+//
+// caller must hold sg.mu for writing.
+func (sg *sourceGateway) detectLicenses(ctx context.Context, r Revision) ([]string, error) {
+	if err := sg.require(ctx, sourceExistsLocally); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempDir("", "dep-license")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	var licenses []string
+	detect := func(ctx context.Context) error {
+		to := filepath.Join(tmp, "src")
+		if err := os.RemoveAll(to); err != nil {
+			return err
+		}
+		if err := sg.src.exportRevisionTo(ctx, r, to); err != nil {
+			return err
+		}
+		var err error
+		licenses, err = license.Detect(to)
+		return err
+	}
+
+	label := fmt.Sprintf("%s@%s", sg.src.upstreamURL(), r)
+	err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctCheckLicense, detect)
+
+	// As with other operations on revisions, the revision may not have been
+	// fetched yet.
+	if err != nil && sg.fetchMightHelp(ctx, r) {
+		if err = sg.require(ctx, sourceHasLatestLocally); err != nil {
+			return nil, err
+		}
+		sg.suprvsr.retry(ctCheckLicense, sg.src.upstreamURL())
+		err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctCheckLicense, detect)
+	}
+	return licenses, err
+}
+
+// caller must hold sg.mu for writing.
 func (sg *sourceGateway) convertToRevision(ctx context.Context, v Version) (Revision, error) {
 	// When looking up by Version, there are four states that may have
 	// differing opinions about version->revision mappings:
@@ -512,10 +1309,10 @@ func (sg *sourceGateway) convertToRevision(ctx context.Context, v Version) (Revi
 		return r, nil
 	}
 
-	if sg.srcState&sourceHasLatestVersionList != 0 {
+	if sg.has(sourceHasLatestVersionList) {
 		// We have the latest version list already and didn't get a match, so
 		// this is definitely a failure case.
-		return "", fmt.Errorf("version %q does not exist in source", v)
+		return "", &VersionNotFoundError{Version: v, URL: sg.src.upstreamURL()}
 	}
 
 	// The version list is out of date; it's possible this version might
@@ -527,18 +1324,55 @@ func (sg *sourceGateway) convertToRevision(ctx context.Context, v Version) (Revi
 
 	r, has = sg.cache.toRevision(v)
 	if !has {
-		return "", fmt.Errorf("version %q does not exist in source", v)
+		return "", &VersionNotFoundError{Version: v, URL: sg.src.upstreamURL()}
 	}
 
 	return r, nil
 }
 
+// fetchMightHelp indicates whether an operation on r that failed might succeed
+// after updating the local source from upstream. If r is already present
+// locally, upstream has nothing to offer, so neither the fetch nor the upstream
+// checks it entails are worth waiting on.
+//
+// caller must hold sg.mu for writing.
+func (sg *sourceGateway) fetchMightHelp(ctx context.Context, r Revision) bool {
+	if sg.srcState&sourceHasLatestLocally != 0 {
+		return false
+	}
+	if sg.srcState&sourceExistsLocally == 0 {
+		return true
+	}
+	present, err := sg.src.revisionPresentIn(ctx, r)
+	return err != nil || !present
+}
+
 func (sg *sourceGateway) listVersions(ctx context.Context) ([]PairedVersion, error) {
+	var pvs []PairedVersion
+	if sg.readCached(0, func() bool {
+		if sg.mustRefreshVersions() {
+			return false
+		}
+		var ok bool
+		if pvs, ok = sg.cache.getAllVersions(); ok {
+			sg.maybeRefreshVersions()
+		}
+		return ok
+	}) {
+		sg.suprvsr.cacheHit(ctListVersions, sg.src.upstreamURL())
+		return pvs, nil
+	}
+
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
 
-	if pvs, ok := sg.cache.getAllVersions(); ok {
-		return pvs, nil
+	// Check again, in case another writer filled the cache while we waited.
+	if !sg.mustRefreshVersions() {
+		if pvs, ok := sg.cache.getAllVersions(); ok {
+			sg.maybeRefreshVersions()
+			sg.suprvsr.cacheHit(ctListVersions, sg.src.upstreamURL())
+			return pvs, nil
+		}
 	}
 
 	err := sg.require(ctx, sourceHasLatestVersionList)
@@ -551,7 +1385,85 @@ func (sg *sourceGateway) listVersions(ctx context.Context) ([]PairedVersion, err
 	return nil, nil
 }
 
+func (sg *sourceGateway) listTagInfo(ctx context.Context) ([]TagInfo, error) {
+	pvs, err := sg.listVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tl, ok := sg.src.(tagInfoLister)
+	if !ok {
+		return nil, nil
+	}
+
+	var tags []PairedVersion
+	for _, pv := range pvs {
+		if t := pv.Type(); t == IsVersion || t == IsSemver {
+			tags = append(tags, pv)
+		}
+	}
+
+	// Tags are immutable, for as long as they refer to the same revision, so
+	// cached metadata can be used when upstream hasn't moved them.
+	cached := func() ([]TagInfo, bool) {
+		tis := make([]TagInfo, 0, len(tags))
+		for _, pv := range tags {
+			ti, has := sg.cache.getTagInfo(pv.Revision(), pv.String())
+			if !has {
+				return nil, false
+			}
+			tis = append(tis, ti)
+		}
+		return tis, true
+	}
+	var tis []TagInfo
+	if sg.readCached(0, func() bool {
+		tis, ok = cached()
+		return ok
+	}) {
+		return tis, nil
+	}
+
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if tis, ok = cached(); ok {
+		return tis, nil
+	}
+
+	err = sg.require(ctx, sourceExistsLocally|sourceHasLatestLocally)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]TagInfo
+	label := fmt.Sprintf("%s:tags", sg.src.upstreamURL())
+	err = sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), label, ctListVersions, func(ctx context.Context) error {
+		all, err = tl.listTagInfo(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tis = make([]TagInfo, 0, len(tags))
+	for _, pv := range tags {
+		// Tags not yet fetched, or since moved upstream, are left out.
+		if ti, has := all[pv.String()]; has && ti.Revision == pv.Revision() {
+			sg.cache.setTagInfo(ti)
+			tis = append(tis, ti)
+		}
+	}
+	return tis, nil
+}
+
 func (sg *sourceGateway) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	if sg.readCached(sourceExistsLocally, func() bool {
+		_, exists := sg.cache.getVersionsFor(r)
+		return exists
+	}) {
+		return true, nil
+	}
+
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
 
@@ -564,7 +1476,7 @@ func (sg *sourceGateway) revisionPresentIn(ctx context.Context, r Revision) (boo
 		return true, nil
 	}
 
-	present, err := sg.src.revisionPresentIn(r)
+	present, err := sg.src.revisionPresentIn(ctx, r)
 	if err == nil && present {
 		sg.cache.markRevisionExists(r)
 	}
@@ -583,15 +1495,61 @@ func (sg *sourceGateway) disambiguateRevision(ctx context.Context, r Revision) (
 	return sg.src.disambiguateRevision(ctx, r)
 }
 
+// maybeRefreshVersions starts retrieving the latest version list in the
+// background, if background refresh is enabled, the gateway does not already
+// have the latest version list, and no other refresh is in flight.
+//
+// Errors encountered in the background are dropped; the next call that needs
+// the latest version list will simply try again.
+//
+// caller must hold sg.mu, for reading or writing.
+func (sg *sourceGateway) maybeRefreshVersions() {
+	if !sg.backgroundRefresh || sg.has(sourceHasLatestVersionList) {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&sg.refreshing, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&sg.refreshing, 0)
+
+		// Run under the supervisor so that the SourceMgr can't finish
+		// Release()ing while the refresh is still using the cache.
+		sg.suprvsr.doFor(context.Background(), sg.src.upstreamURL(), sg.src.upstreamURL(), ctBackgroundRefresh, func(ctx context.Context) error {
+			sg.mu.Lock()
+			defer sg.mu.Unlock()
+
+			if sg.has(sourceHasLatestVersionList) {
+				return nil
+			}
+			// Bypass require(), which considers any cached version list to be
+			// good enough.
+			addlState, err := sg.loadLatestVersionList(ctx)
+			sg.addState(addlState)
+			return err
+		})
+	}()
+}
+
+// mustRefreshVersions indicates whether the version list must be retrieved
+// again before it can be served, because its TTL has run out and no background
+// refresh can be relied on to do so.
+//
+// caller must hold sg.mu, for reading or writing.
+func (sg *sourceGateway) mustRefreshVersions() bool {
+	return !sg.backgroundRefresh && sg.expiredState()&sourceHasLatestVersionList != 0
+}
+
 // sourceExistsUpstream verifies that the source exists upstream and that the
 // upstreamURL has not changed and returns any additional sourceState, or an error.
 func (sg *sourceGateway) sourceExistsUpstream(ctx context.Context) (sourceState, error) {
 	if sg.src.existsCallsListVersions() {
 		return sg.loadLatestVersionList(ctx)
 	}
-	err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourcePing, func(ctx context.Context) error {
-		if !sg.src.existsUpstream(ctx) {
-			return errors.Errorf("source does not exist upstream: %s: %s", sg.src.sourceType(), sg.src.upstreamURL())
+	err := sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.sourceType(), ctSourcePing, func(ctx context.Context) error {
+		if !sg.upstreamExists(ctx) {
+			return &SourceNotFoundError{Type: sg.src.sourceType(), URL: sg.src.upstreamURL()}
 		}
 		return nil
 	})
@@ -600,9 +1558,9 @@ func (sg *sourceGateway) sourceExistsUpstream(ctx context.Context) (sourceState,
 
 // initLocal initializes the source locally and returns the resulting sourceState.
 func (sg *sourceGateway) initLocal(ctx context.Context) (sourceState, error) {
-	if err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceInit, func(ctx context.Context) error {
-		err := sg.src.initLocal(ctx)
-		return errors.Wrapf(err, "failed to fetch source for %s", sg.src.upstreamURL())
+	if err := sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.sourceType(), ctSourceInit, func(ctx context.Context) error {
+		err := sg.retrieve(ctx, sg.src.initLocal)
+		return wrapErrorf(err, "failed to fetch source for %s", sg.src.upstreamURL())
 	}); err != nil {
 		return 0, err
 	}
@@ -621,21 +1579,166 @@ func (sg *sourceGateway) loadLatestVersionList(ctx context.Context) (sourceState
 		addlState |= as
 	}
 	var pvl []PairedVersion
-	if err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctListVersions, func(ctx context.Context) error {
+	if err := sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.sourceType(), ctListVersions, func(ctx context.Context) error {
 		var err error
-		pvl, err = sg.src.listVersions(ctx)
-		return errors.Wrapf(err, "failed to list versions for %s", sg.src.upstreamURL())
+		pvl, err = sg.upstreamVersions(ctx)
+		return wrapErrorf(err, "failed to list versions for %s", sg.src.upstreamURL())
 	}); err != nil {
 		return addlState, err
 	}
+	pvl, err := sg.curateVersions(ctx, pvl)
+	if err != nil {
+		return addlState, err
+	}
 	sg.cache.setVersionMap(pvl)
+	if sg.redirected != nil {
+		if from, to, moved := sg.movedUpstream(); moved {
+			sg.redirected(from, to)
+		}
+	}
 	return addlState | sourceHasLatestVersionList, nil
 }
 
+// curateVersions merges the versions supplied by the gateway's version
+// provider into pvl, a version list retrieved from the source, and filters
+// the result.
+func (sg *sourceGateway) curateVersions(ctx context.Context, pvl []PairedVersion) ([]PairedVersion, error) {
+	if sg.versionProvider != nil {
+		provided, err := sg.versionProvider(ctx, sg.projectRoot, sg.maybe.URL().String())
+		if err != nil {
+			return nil, wrapErrorf(err, "failed to get provided versions for %s", sg.projectRoot)
+		}
+		pvl = mergeProvidedVersions(pvl, provided)
+	}
+	return sg.versionFilter.filter(pvl), nil
+}
+
+// recurateVersions curates the version list already cached for the source
+// again. If that fails, the version list is retrieved again when next needed.
+//
+// caller must hold sg.mu, or be the only one with access to sg.
+func (sg *sourceGateway) recurateVersions(ctx context.Context) {
+	if sg.versionProvider == nil && sg.versionFilter.Allow == nil && sg.versionFilter.Deny == nil {
+		return
+	}
+	pvl, ok := sg.cache.getAllVersions()
+	if ok {
+		pvl, err := sg.curateVersions(ctx, pvl)
+		if err == nil {
+			sg.cache.setVersionMap(pvl)
+			return
+		}
+	}
+	sg.srcState &^= sourceHasLatestVersionList
+}
+
+// mergeProvidedVersions returns listed, along with each of provided that
+// there is no version of the same name and type among listed.
+func mergeProvidedVersions(listed, provided []PairedVersion) []PairedVersion {
+	if len(provided) == 0 {
+		return listed
+	}
+	has := make(map[UnpairedVersion]bool, len(listed))
+	for _, pv := range listed {
+		has[pv.Unpair()] = true
+	}
+	merged := make([]PairedVersion, len(listed), len(listed)+len(provided))
+	copy(merged, listed)
+	for _, pv := range provided {
+		if uv := pv.Unpair(); !has[uv] {
+			has[uv] = true
+			merged = append(merged, pv)
+		}
+	}
+	return merged
+}
+
+// movedUpstream reports whether upstream was last found to have moved from the
+// URL that the source talks to, to another.
+func (sg *sourceGateway) movedUpstream() (from, to string, moved bool) {
+	rr, ok := sg.src.(redirectReporter)
+	if !ok {
+		return "", "", false
+	}
+	from, to = rr.redirectedURL()
+	return from, to, to != "" && to != from
+}
+
+// requireRevision ensures that the source exists locally, with at least
+// revision r. If the source does not yet exist locally, then if possible, only
+// r is retrieved, rather than all of the source's history.
+//
+// caller must hold sg.mu for writing.
+func (sg *sourceGateway) requireRevision(ctx context.Context, r Revision) error {
+	rf, ok := sg.src.(sourceRevisionFetcher)
+	if !ok || sg.has(sourceExistsLocally) || sg.src.existsLocally(ctx) {
+		return sg.require(ctx, sourceExistsLocally)
+	}
+
+	if err := sg.auditVCS(ctx, ctSourceInit, func() error {
+		return sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.sourceType(), ctSourceInit, func(ctx context.Context) error {
+			return sg.retrieve(ctx, func(ctx context.Context) error {
+				return rf.initLocalAt(ctx, r)
+			})
+		})
+	}); err != nil {
+		// Not all upstreams will serve a lone revision; retrieve everything.
+		return sg.require(ctx, sourceExistsLocally)
+	}
+	sg.addState(sourceExistsUpstream | sourceExistsLocally)
+	return nil
+}
+
+// recoverCorruptLocal checks whether cause, an error from updating the local
+// copy of the source, is down to that copy being corrupt. If it is, the copy is
+// quarantined and the source is retrieved afresh, and the resulting
+// sourceState is returned. Otherwise, cause is returned.
+//
+// caller must hold sg.mu for writing.
+func (sg *sourceGateway) recoverCorruptLocal(ctx context.Context, cause error) (sourceState, error) {
+	rs, ok := sg.src.(sourceRecoverer)
+	if !ok {
+		return 0, cause
+	}
+
+	var interrupted bool
+	verr := sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.sourceType(), ctValidateLocal, func(ctx context.Context) error {
+		err := rs.verifyLocal(ctx)
+		interrupted = ctx.Err() != nil
+		return err
+	})
+	if verr == nil || interrupted {
+		// Either the local copy is fine, and the problem lies elsewhere, or
+		// we can't tell.
+		return 0, cause
+	}
+
+	moved, err := rs.quarantineLocal(filepath.Join(sg.cachedir, "quarantine"))
+	if err != nil {
+		return 0, wrapErrorf(err, "failed to quarantine corrupt local copy of %s after: %s", sg.src.upstreamURL(), cause)
+	}
+	sg.srcState &^= sourceExistsLocally
+
+	state, err := sg.initLocal(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sg.events.notify(SourceEvent{
+		Type:   SourceRecovered,
+		URL:    sg.src.upstreamURL(),
+		Detail: fmt.Sprintf("local copy was corrupt (%s), so it was moved to %s and retrieved afresh", verr, moved),
+	})
+	return state, nil
+}
+
 // require ensures the sourceGateway has the wanted sourceState, fetching more
 // data if necessary. Returns an error if the state could not be reached.
-// caller must hold sg.mu
+// caller must hold sg.mu for writing
 func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (err error) {
+	// Expired state must be reached again, and without relying on cached data.
+	expired := sg.expiredState() & wanted
+	sg.srcState &^= expired
 	todo := (^sg.srcState) & wanted
 	var flag sourceState = 1
 
@@ -647,20 +1750,34 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (err e
 
 			switch flag {
 			case sourceExistsUpstream:
-				addlState, err = sg.sourceExistsUpstream(ctx)
+				err = sg.auditVCS(ctx, ctSourcePing, func() (err error) {
+					addlState, err = sg.sourceExistsUpstream(ctx)
+					return
+				})
 			case sourceExistsLocally:
 				if !sg.src.existsLocally(ctx) {
-					addlState, err = sg.initLocal(ctx)
+					err = sg.auditVCS(ctx, ctSourceInit, func() (err error) {
+						addlState, err = sg.initLocal(ctx)
+						return
+					})
 				}
 			case sourceHasLatestVersionList:
-				if _, ok := sg.cache.getAllVersions(); !ok {
-					addlState, err = sg.loadLatestVersionList(ctx)
+				if _, ok := sg.cache.getAllVersions(); !ok || expired&flag != 0 {
+					err = sg.auditVCS(ctx, ctListVersions, func() (err error) {
+						addlState, err = sg.loadLatestVersionList(ctx)
+						return
+					})
 				}
 			case sourceHasLatestLocally:
-				err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceFetch, func(ctx context.Context) error {
-					return sg.src.updateLocal(ctx)
+				err = sg.auditVCS(ctx, ctSourceFetch, func() error {
+					return sg.suprvsr.doFor(ctx, sg.src.upstreamURL(), sg.src.sourceType(), ctSourceFetch, func(ctx context.Context) error {
+						return sg.retrieve(ctx, sg.src.updateLocal)
+					})
 				})
 				addlState = sourceExistsUpstream | sourceExistsLocally
+				if err != nil {
+					addlState, err = sg.recoverCorruptLocal(ctx, err)
+				}
 			}
 
 			if err != nil {
@@ -668,7 +1785,7 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (err e
 			}
 
 			checked := flag | addlState
-			sg.srcState |= checked
+			sg.addState(checked)
 			todo &= ^checked
 		}
 
@@ -692,7 +1809,7 @@ type source interface {
 	listVersions(context.Context) ([]PairedVersion, error)
 	getManifestAndLock(context.Context, ProjectRoot, Revision, ProjectAnalyzer) (Manifest, Lock, error)
 	listPackages(context.Context, ProjectRoot, Revision) (pkgtree.PackageTree, error)
-	revisionPresentIn(Revision) (bool, error)
+	revisionPresentIn(context.Context, Revision) (bool, error)
 	disambiguateRevision(context.Context, Revision) (Revision, error)
 	exportRevisionTo(context.Context, Revision, string) error
 	sourceType() string
@@ -704,7 +1821,98 @@ type source interface {
 	listVersionsRequiresLocal() bool
 }
 
+// sourceRecoverer is an optional extension of source, for sources whose local
+// copy can be checked for corruption and moved aside so it can be replaced.
+type sourceRecoverer interface {
+	source
+	// verifyLocal returns an error if the local copy of the source is missing
+	// or corrupt.
+	verifyLocal(context.Context) error
+	// quarantineLocal moves the local copy of the source into dir, and returns
+	// its new location.
+	quarantineLocal(dir string) (string, error)
+}
+
+// signatureVerifier is an optional extension of source, for sources that can
+// check the signatures of versions.
+type signatureVerifier interface {
+	source
+	// verifySignature checks that tag, if non-empty, or else the commit r, has
+	// a good signature by a key in keyring, a GnuPG home directory, and returns
+	// the fingerprint of that key.
+	verifySignature(ctx context.Context, keyring, tag string, r Revision) (string, error)
+}
+
+// tagInfoLister is an optional extension of source, for sources whose tags
+// carry metadata of their own.
+type tagInfoLister interface {
+	source
+	// listTagInfo returns the metadata of each tag in the local copy of the
+	// source, keyed by tag name.
+	listTagInfo(context.Context) (map[string]TagInfo, error)
+}
+
+// redirectReporter is an optional extension of source, for sources that can
+// tell when upstream has moved to another URL.
+type redirectReporter interface {
+	// redirectedURL returns the URL the source talks to upstream, and the URL
+	// that upstream last redirected it to, if any.
+	redirectedURL() (from, to string)
+}
+
+// retrievalReporter is an optional extension of source, for sources that can
+// fail over to URLs other than upstream's.
+type retrievalReporter interface {
+	// retrievedFrom returns the URL that the source was last retrieved or
+	// listed from, if it was not upstream, and whether that is known. It is
+	// not known if the source could have been retrieved from a mirror, but
+	// has been neither retrieved nor listed by this process.
+	retrievedFrom() (string, bool)
+}
+
+// commitTimer is an optional extension of source, for sources that can tell
+// when a revision was committed.
+type commitTimer interface {
+	source
+	// commitTime returns when r, which must exist locally, was committed.
+	commitTime(ctx context.Context, r Revision) (time.Time, error)
+}
+
+// sourceCloser is an optional extension of source, for sources that hold
+// resources, such as long-lived processes, which must be released once the
+// source is no longer needed. close may be called more than once.
+type sourceCloser interface {
+	close() error
+}
+
+// localPather is an optional extension of source, for sources whose local copy
+// is kept in a directory of its own.
+type localPather interface {
+	// localPath returns the directory holding the local copy of the source.
+	localPath() string
+}
+
+// sourceRevisionFetcher is an optional extension of source, for sources that
+// can set up their local copy with just a single revision, for when nothing
+// else is needed from it.
+type sourceRevisionFetcher interface {
+	// initLocalAt sets up the local copy of the source with at least revision
+	// r. Once the local copy is updated, it must be complete.
+	initLocalAt(context.Context, Revision) error
+}
+
 type sourceFastPrune interface {
 	source
-	exportPrunedRevisionTo(context.Context, Revision, []string, PruneOptions, string) error
+	// exportPrunedRevisionTo exports the revision to a directory as
+	// exportRevisionTo does, then prunes it as PruneProject does for the
+	// LockedProject, but may avoid writing out what would be pruned.
+	exportPrunedRevisionTo(context.Context, Revision, LockedProject, PruneOptions, string) error
+}
+
+type sourceLinkingExport interface {
+	source
+	// exportLinkedRevisionTo exports the revision to a directory as
+	// exportRevisionTo does, but hard links files out of the cache where it
+	// can, so the export must not be modified in place.
+	exportLinkedRevisionTo(context.Context, Revision, string) error
 }
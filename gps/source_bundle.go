@@ -0,0 +1,140 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+// BundleSources copies the local copies of the sources for ids out of the
+// cache directory into dir, which must not exist, laying it out as a cache
+// directory of its own. Alongside them, it records the metadata needed to set
+// each source up again without deducing it from its name.
+//
+// Each source is brought up to date before it is copied, so that the bundle
+// holds all of its versions. Once added to another cache directory with
+// UnbundleSources, the sources may be used without network access, provided
+// that the SourceManager using them has a positive CacheAge, so that it reuses
+// the bundled metadata rather than deducing sources afresh.
+func (sm *SourceMgr) BundleSources(ctx context.Context, ids []ProjectIdentifier, dir string) error {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return ErrSourceManagerIsReleased
+	}
+
+	if _, err := os.Stat(dir); err == nil {
+		return errors.Errorf("cannot bundle sources into %s, it already exists", dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "sources"), 0777); err != nil {
+		return err
+	}
+
+	names := make(map[string]persistedSource)
+	copied := make(map[string]bool)
+	for _, id := range ids {
+		ctx := sm.auditProject(ctx, id.ProjectRoot)
+		srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		ps, ok := newPersistedSource(srcg.maybe)
+		if !ok {
+			return errors.Errorf("cannot bundle %s, sources of type %T cannot be set up again without deduction", id, srcg.maybe)
+		}
+		ps.Time = time.Now()
+		names[toFold(id.normalizedSource())] = ps
+
+		// Several names may share a source.
+		if copied[ps.URL] {
+			continue
+		}
+		copied[ps.URL] = true
+		if err = srcg.copyLocalTo(ctx, dir); err != nil {
+			return wrapErrorf(err, "failed to bundle source for %s", id)
+		}
+	}
+
+	return writeSourceNames(dir, names)
+}
+
+// UnbundleSources adds the sources bundled into dir by BundleSources to the
+// cache directory, replacing any local copies of the same sources there. It
+// must be called before the SourceManager is used for any of them.
+func (sm *SourceMgr) UnbundleSources(dir string) error {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return ErrSourceManagerIsReleased
+	}
+
+	bundled, err := loadSourceNames(dir, time.Time{})
+	if err != nil {
+		return wrapErrorf(err, "failed to read bundled sources in %s", dir)
+	}
+
+	sc := sm.srcCoord
+	now := time.Now()
+	for name, ps := range bundled {
+		m, err := ps.maybeSource()
+		if err != nil {
+			return err
+		}
+		from, to := maybeSourceCachePath(dir, m), maybeSourceCachePath(sc.cachedir, m)
+		if err = os.RemoveAll(to); err != nil {
+			return err
+		}
+		if err = fs.CopyDir(from, to); err != nil {
+			return wrapErrorf(err, "failed to unbundle source for %s", name)
+		}
+		ps.Time = now
+		bundled[name] = ps
+	}
+
+	sc.srcmut.Lock()
+	defer sc.srcmut.Unlock()
+	if sc.persistNames {
+		for name, ps := range bundled {
+			sc.persisted[name] = ps
+		}
+		sc.persistedDirty = true
+		return nil
+	}
+
+	// Names aren't persisted by this SourceManager, so it won't write out the
+	// bundled ones on release; merge them into the cache directory's now.
+	names, err := loadSourceNames(sc.cachedir, time.Time{})
+	if err != nil {
+		return err
+	}
+	if names == nil {
+		names = make(map[string]persistedSource)
+	}
+	for name, ps := range bundled {
+		names[name] = ps
+	}
+	return writeSourceNames(sc.cachedir, names)
+}
+
+// copyLocalTo brings the local copy of the source up to date, then copies it
+// into the same place in the cache directory at dir as it has in the gateway's
+// own.
+func (sg *sourceGateway) copyLocalTo(ctx context.Context, dir string) error {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if err := sg.require(ctx, sourceExistsLocally|sourceHasLatestLocally); err != nil {
+		return err
+	}
+	to := maybeSourceCachePath(dir, sg.maybe)
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+	return fs.CopyDir(maybeSourceCachePath(sg.cachedir, sg.maybe), to)
+}
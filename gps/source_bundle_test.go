@@ -0,0 +1,95 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestBundleSources(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("upstream")
+	upstream := h.Path("upstream")
+	h.RunGit(upstream, "init")
+	h.RunGit(upstream, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(upstream, "config", "--local", "user.name", "Test author")
+	h.TempFile("upstream/a.go", "package a\n")
+	h.RunGit(upstream, "add", "a.go")
+	h.RunGit(upstream, "commit", "--message=Initial commit")
+	head, err := exec.Command("git", "-C", upstream, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev := Revision(strings.TrimSpace(string(head)))
+
+	// Set up the source in the first cache directory as if it had been
+	// deduced and cloned in an earlier run, so that nothing needs deducing.
+	id := ProjectIdentifier{ProjectRoot: "example.com/bundled"}
+	ps := persistedSource{Type: "git", URL: "file://" + filepath.ToSlash(upstream), Time: time.Now()}
+	m, err := ps.maybeSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.TempDir("cache1/sources")
+	cache1 := h.Path("cache1")
+	h.RunGit(h.Path("."), "clone", ps.URL, maybeSourceCachePath(cache1, m))
+	if err = writeSourceNames(cache1, map[string]persistedSource{string(id.ProjectRoot): ps}); err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir: cache1,
+		CacheAge: time.Hour,
+		Logger:   log.New(test.Writer{TB: t}, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(h.Path("."), "bundle")
+	err = sm.BundleSources(context.Background(), []ProjectIdentifier{id}, bundle)
+	sm.Release()
+	if err != nil {
+		t.Fatalf("unexpected error bundling sources: %s", err)
+	}
+	h.MustExist(filepath.Join(maybeSourceCachePath(bundle, m), ".git"))
+	h.MustExist(filepath.Join(bundle, sourceNamesFilename))
+
+	// With upstream gone, the bundle must be all that's needed to export the
+	// source's revisions from a fresh cache directory.
+	if err = os.RemoveAll(upstream); err != nil {
+		t.Fatal(err)
+	}
+	h.TempDir("cache2")
+	sm, err = NewSourceManager(SourceManagerConfig{
+		Cachedir: h.Path("cache2"),
+		CacheAge: time.Hour,
+		Logger:   log.New(test.Writer{TB: t}, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+	if err = sm.UnbundleSources(bundle); err != nil {
+		t.Fatalf("unexpected error unbundling sources: %s", err)
+	}
+
+	to := filepath.Join(h.Path("."), "export")
+	if err = sm.ExportProject(context.Background(), id, rev, to); err != nil {
+		t.Fatalf("unexpected error exporting from unbundled source: %s", err)
+	}
+	h.MustExist(filepath.Join(to, "a.go"))
+}
@@ -41,6 +41,14 @@ type singleSourceCache interface {
 	// Get the PackageTree for a given revision.
 	getPackageTree(Revision, ProjectRoot) (pkgtree.PackageTree, bool)
 
+	// Store the metadata of a tag, which is valid for as long as the tag refers
+	// to the same revision.
+	setTagInfo(TagInfo)
+
+	// Get the metadata of the tag with the given name, if it refers to the
+	// given revision.
+	getTagInfo(Revision, string) (TagInfo, bool)
+
 	// Indicate to the cache that an individual revision is known to exist.
 	markRevisionExists(r Revision)
 
@@ -74,10 +82,15 @@ type singleSourceCache interface {
 }
 
 // memoryCache is a sourceCache which creates singleSourceCacheMemory instances.
-type memoryCache struct{}
+type memoryCache struct {
+	// If non-nil, bounds the memory held by all the instances together.
+	lru *memoryLRU
+}
 
-func (memoryCache) newSingleSourceCache(ProjectIdentifier) singleSourceCache {
-	return newMemoryCache()
+func (c memoryCache) newSingleSourceCache(ProjectIdentifier) singleSourceCache {
+	ssc := newMemoryCache().(*singleSourceCacheMemory)
+	ssc.lru = c.lru
+	return ssc
 }
 
 func (memoryCache) close() error { return nil }
@@ -88,16 +101,24 @@ type singleSourceCacheMemory struct {
 	infos map[ProjectAnalyzerInfo]map[Revision]projectInfo
 	// Replaced, never modified. Imports are *relative* (ImportRoot prefix trimmed).
 	ptrees map[Revision]map[string]pkgtree.PackageOrErr
+	lfiles map[Revision]map[string][]string
+	// Tag metadata, keyed by the revision tagged and then the tag name.
+	tags map[Revision]map[string]TagInfo
 	// Replaced, never modified.
 	vList []PairedVersion
 	vMap  map[UnpairedVersion]Revision
 	rMap  map[Revision][]UnpairedVersion
+	// If non-nil, manifests, locks and PackageTrees may be evicted to bound
+	// memory use.
+	lru *memoryLRU
 }
 
 func newMemoryCache() singleSourceCache {
 	return &singleSourceCacheMemory{
 		infos:  make(map[ProjectAnalyzerInfo]map[Revision]projectInfo),
 		ptrees: make(map[Revision]map[string]pkgtree.PackageOrErr),
+		lfiles: make(map[Revision]map[string][]string),
+		tags:   make(map[Revision]map[string]TagInfo),
 		vMap:   make(map[UnpairedVersion]Revision),
 		rMap:   make(map[Revision][]UnpairedVersion),
 	}
@@ -123,22 +144,24 @@ func (c *singleSourceCacheMemory) setManifestAndLock(r Revision, pai ProjectAnal
 		c.rMap[r] = nil
 	}
 	c.mut.Unlock()
+
+	if c.lru != nil {
+		c.lru.add(lruKey{c: c, kind: lruProjectInfo, pai: pai, r: r}, projectInfoSize(m, l))
+	}
 }
 
 func (c *singleSourceCacheMemory) getManifestAndLock(r Revision, pai ProjectAnalyzerInfo) (Manifest, Lock, bool) {
 	c.mut.Lock()
-	defer c.mut.Unlock()
+	pi, has := c.infos[pai][r]
+	c.mut.Unlock()
 
-	inner, has := c.infos[pai]
 	if !has {
 		return nil, nil, false
 	}
-
-	pi, has := inner[r]
-	if has {
-		return pi.Manifest, pi.Lock, true
+	if c.lru != nil {
+		c.lru.touch(lruKey{c: c, kind: lruProjectInfo, pai: pai, r: r})
 	}
-	return nil, nil, false
+	return pi.Manifest, pi.Lock, true
 }
 
 func (c *singleSourceCacheMemory) setPackageTree(r Revision, ptree pkgtree.PackageTree) {
@@ -147,9 +170,13 @@ func (c *singleSourceCacheMemory) setPackageTree(r Revision, ptree pkgtree.Packa
 		poe.P.ImportPath = "" // Don't store this
 		return strings.TrimPrefix(ip, ptree.ImportRoot), poe
 	})
+	lfiles := pkgtree.CopyLicenseFiles(ptree.LicenseFiles, func(ip string) string {
+		return strings.TrimPrefix(ip, ptree.ImportRoot)
+	})
 
 	c.mut.Lock()
 	c.ptrees[r] = pkgs
+	c.lfiles[r] = lfiles
 
 	// Ensure there's at least an entry in the rMap so that the rMap always has
 	// a complete picture of the revisions we know to exist
@@ -157,16 +184,24 @@ func (c *singleSourceCacheMemory) setPackageTree(r Revision, ptree pkgtree.Packa
 		c.rMap[r] = nil
 	}
 	c.mut.Unlock()
+
+	if c.lru != nil {
+		c.lru.add(lruKey{c: c, kind: lruPackageTree, r: r}, packageTreeSize(pkgs, lfiles))
+	}
 }
 
 func (c *singleSourceCacheMemory) getPackageTree(r Revision, pr ProjectRoot) (pkgtree.PackageTree, bool) {
 	c.mut.Lock()
 	rptree, has := c.ptrees[r]
+	rlfiles := c.lfiles[r]
 	c.mut.Unlock()
 
 	if !has {
 		return pkgtree.PackageTree{}, false
 	}
+	if c.lru != nil {
+		c.lru.touch(lruKey{c: c, kind: lruPackageTree, r: r})
+	}
 
 	// Return a copy, with full import paths.
 	pkgs := pkgtree.CopyPackages(rptree, func(rpath string, poe pkgtree.PackageOrErr) (string, pkgtree.PackageOrErr) {
@@ -180,9 +215,44 @@ func (c *singleSourceCacheMemory) getPackageTree(r Revision, pr ProjectRoot) (pk
 	return pkgtree.PackageTree{
 		ImportRoot: string(pr),
 		Packages:   pkgs,
+		LicenseFiles: pkgtree.CopyLicenseFiles(rlfiles, func(rpath string) string {
+			return path.Join(string(pr), rpath)
+		}),
 	}, true
 }
 
+func (c *singleSourceCacheMemory) setTagInfo(ti TagInfo) {
+	c.mut.Lock()
+	inner, has := c.tags[ti.Revision]
+	if !has {
+		inner = make(map[string]TagInfo)
+		c.tags[ti.Revision] = inner
+	}
+	inner[ti.Name] = ti
+	c.mut.Unlock()
+}
+
+func (c *singleSourceCacheMemory) getTagInfo(r Revision, name string) (TagInfo, bool) {
+	c.mut.Lock()
+	ti, has := c.tags[r][name]
+	c.mut.Unlock()
+	return ti, has
+}
+
+// evict drops the value identified by k, which must refer to c. It is called
+// by c.lru with the LRU's mutex held.
+func (c *singleSourceCacheMemory) evict(k lruKey) {
+	c.mut.Lock()
+	switch k.kind {
+	case lruProjectInfo:
+		delete(c.infos[k.pai], k.r)
+	case lruPackageTree:
+		delete(c.ptrees, k.r)
+		delete(c.lfiles, k.r)
+	}
+	c.mut.Unlock()
+}
+
 func (c *singleSourceCacheMemory) setVersionMap(versionList []PairedVersion) {
 	c.mut.Lock()
 	c.vList = versionList
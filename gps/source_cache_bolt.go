@@ -18,12 +18,11 @@ import (
 	"github.com/golang/dep/gps/pkgtree"
 	"github.com/golang/protobuf/proto"
 	"github.com/jmank88/nuts"
-	"github.com/pkg/errors"
 )
 
 // boltCacheFilename is a versioned filename for the bolt cache. The version
 // must be incremented whenever incompatible changes are made.
-const boltCacheFilename = "bolt-v1.db"
+const boltCacheFilename = "bolt-v2.db"
 
 // boltCache manages a bolt.DB cache and provides singleSourceCaches.
 type boltCache struct {
@@ -38,16 +37,34 @@ func newBoltCache(cd string, epoch int64, logger *log.Logger) (*boltCache, error
 	dir := filepath.Dir(path)
 	if fi, err := os.Stat(dir); os.IsNotExist(err) {
 		if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
-			return nil, errors.Wrapf(err, "failed to create source cache directory: %s", dir)
+			return nil, wrapErrorf(err, "failed to create source cache directory: %s", dir)
 		}
 	} else if err != nil {
-		return nil, errors.Wrapf(err, "failed to check source cache directory: %s", dir)
+		return nil, wrapErrorf(err, "failed to check source cache directory: %s", dir)
 	} else if !fi.IsDir() {
-		return nil, errors.Wrapf(err, "source cache path is not directory: %s", dir)
+		return nil, wrapErrorf(err, "source cache path is not directory: %s", dir)
 	}
 	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to open BoltDB cache file %q", path)
+		return nil, wrapErrorf(err, "failed to open BoltDB cache file %q", path)
+	}
+	return &boltCache{
+		db:     db,
+		epoch:  epoch,
+		logger: logger,
+	}, nil
+}
+
+// openSharedBoltCache returns a read-only boltCache backed by the BoltDB file
+// under the shared cache directory cd, or nil if there is none.
+func openSharedBoltCache(cd string, epoch int64, logger *log.Logger) (*boltCache, error) {
+	path := filepath.Join(cd, boltCacheFilename)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, wrapErrorf(err, "failed to open BoltDB cache file %q", path)
 	}
 	return &boltCache{
 		db:     db,
@@ -66,7 +83,7 @@ func (c *boltCache) newSingleSourceCache(pi ProjectIdentifier) singleSourceCache
 
 // close releases all cache resources.
 func (c *boltCache) close() error {
-	return errors.Wrapf(c.db.Close(), "error closing Bolt database %q", c.db.String())
+	return wrapErrorf(c.db.Close(), "error closing Bolt database %q", c.db.String())
 }
 
 // singleSourceCacheBolt implements a singleSourceCache backed by a persistent BoltDB file.
@@ -84,7 +101,7 @@ func (c *boltCache) close() error {
 //	Values: "<revision>"
 //
 // 2) Revision buckets hold (a) manifest and lock data for various ProjectAnalyzers,
-// (b) package trees, and (c) version lists.
+// (b) package trees, (c) version lists, and (d) tag metadata.
 //
 //	Bucket: "r<revision>"
 //
@@ -104,6 +121,12 @@ func (c *boltCache) close() error {
 //	Sub-Bucket: "v<timestamp>"
 //	Keys: "<sequence_number>"
 //	Values: Unpaired Versions serialized via ConstraintMsg
+//
+// d) Tag buckets contain a bucket of fields for each tag referring to the revision:
+//
+//	Sub-Bucket: "t"
+//	Sub-Bucket: "<tag_name>"
+//	Key/Values: TagInfo fields
 type singleSourceCacheBolt struct {
 	*boltCache
 	sourceName []byte
@@ -128,7 +151,7 @@ func (s *singleSourceCacheBolt) setManifestAndLock(rev Revision, ai ProjectAnaly
 			return err
 		}
 		if err := cachePutManifest(mb, m); err != nil {
-			return errors.Wrap(err, "failed to put manifest")
+			return wrapError(err, "failed to put manifest")
 		}
 		if l == nil {
 			return nil
@@ -145,10 +168,10 @@ func (s *singleSourceCacheBolt) setManifestAndLock(rev Revision, ai ProjectAnaly
 		if err != nil {
 			return err
 		}
-		return errors.Wrap(cachePutLock(lb, l), "failed to put lock")
+		return wrapError(cachePutLock(lb, l), "failed to put lock")
 	})
 	if err != nil {
-		s.logger.Println(errors.Wrapf(err, "failed to cache manifest/lock for revision %q, analyzer: %v", rev, ai))
+		s.logger.Println(wrapErrorf(err, "failed to cache manifest/lock for revision %q, analyzer: %v", rev, ai))
 	}
 }
 
@@ -167,7 +190,7 @@ func (s *singleSourceCacheBolt) getManifestAndLock(rev Revision, ai ProjectAnaly
 		var err error
 		m, err = cacheGetManifest(mb)
 		if err != nil {
-			return errors.Wrap(err, "failed to get manifest")
+			return wrapError(err, "failed to get manifest")
 		}
 
 		// Lock
@@ -179,14 +202,14 @@ func (s *singleSourceCacheBolt) getManifestAndLock(rev Revision, ai ProjectAnaly
 		}
 		l, err = cacheGetLock(lb)
 		if err != nil {
-			return errors.Wrap(err, "failed to get lock")
+			return wrapError(err, "failed to get lock")
 		}
 
 		ok = true
 		return nil
 	})
 	if err != nil {
-		s.logger.Println(errors.Wrapf(err, "failed to get cached manifest/lock for revision %q, analyzer: %v", rev, ai))
+		s.logger.Println(wrapErrorf(err, "failed to get cached manifest/lock for revision %q, analyzer: %v", rev, ai))
 	}
 	return
 }
@@ -218,11 +241,16 @@ func (s *singleSourceCacheBolt) setPackageTree(rev Revision, ptree pkgtree.Packa
 			if err := cachePutPackageOrErr(pb, poe); err != nil {
 				return err
 			}
+			if lf := ptree.LicenseFiles[ip]; len(lf) > 0 {
+				if err := cachePutLicenseFiles(pb, lf); err != nil {
+					return err
+				}
+			}
 		}
 		return nil
 	})
 	if err != nil {
-		s.logger.Println(errors.Wrapf(err, "failed to cache package tree for revision %q", rev))
+		s.logger.Println(wrapErrorf(err, "failed to cache package tree for revision %q", rev))
 	}
 }
 
@@ -234,8 +262,14 @@ func (s *singleSourceCacheBolt) getPackageTree(rev Revision, pr ProjectRoot) (pt
 		}
 
 		pkgs := make(map[string]pkgtree.PackageOrErr)
+		var licenses map[string][]string
 		err := ptrees.ForEach(func(rip, _ []byte) error {
-			poe, err := cacheGetPackageOrErr(ptrees.Bucket(rip))
+			pb := ptrees.Bucket(rip)
+			poe, err := cacheGetPackageOrErr(pb)
+			if err != nil {
+				return err
+			}
+			lf, err := cacheGetLicenseFiles(pb)
 			if err != nil {
 				return err
 			}
@@ -249,6 +283,12 @@ func (s *singleSourceCacheBolt) getPackageTree(rev Revision, pr ProjectRoot) (pt
 				poe.P.ImportPath = ip
 			}
 			pkgs[ip] = poe
+			if len(lf) > 0 {
+				if licenses == nil {
+					licenses = make(map[string][]string)
+				}
+				licenses[ip] = lf
+			}
 			return nil
 		})
 		if err != nil {
@@ -256,11 +296,60 @@ func (s *singleSourceCacheBolt) getPackageTree(rev Revision, pr ProjectRoot) (pt
 		}
 		ptree.ImportRoot = string(pr)
 		ptree.Packages = pkgs
+		ptree.LicenseFiles = licenses
+		ok = true
+		return nil
+	})
+	if err != nil {
+		s.logger.Println(wrapErrorf(err, "failed to get cached package tree for revision %q", rev))
+	}
+	return
+}
+
+func (s *singleSourceCacheBolt) setTagInfo(ti TagInfo) {
+	err := s.updateRevBucket(ti.Revision, func(b *bolt.Bucket) error {
+		tags, err := b.CreateBucketIfNotExists(cacheKeyTag)
+		if err != nil {
+			return err
+		}
+		name := []byte(ti.Name)
+		if tags.Bucket(name) != nil {
+			if err := tags.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		tb, err := tags.CreateBucket(name)
+		if err != nil {
+			return err
+		}
+		return cachePutTagInfo(tb, ti)
+	})
+	if err != nil {
+		s.logger.Println(wrapErrorf(err, "failed to cache info for tag %q at revision %q", ti.Name, ti.Revision))
+	}
+}
+
+func (s *singleSourceCacheBolt) getTagInfo(rev Revision, name string) (ti TagInfo, ok bool) {
+	err := s.viewRevBucket(rev, func(b *bolt.Bucket) error {
+		tags := b.Bucket(cacheKeyTag)
+		if tags == nil {
+			return nil
+		}
+		tb := tags.Bucket([]byte(name))
+		if tb == nil {
+			return nil
+		}
+
+		var err error
+		ti, err = cacheGetTagInfo(tb, rev, name)
+		if err != nil {
+			return err
+		}
 		ok = true
 		return nil
 	})
 	if err != nil {
-		s.logger.Println(errors.Wrapf(err, "failed to get cached package tree for revision %q", rev))
+		s.logger.Println(wrapErrorf(err, "failed to get cached info for tag %q at revision %q", name, rev))
 	}
 	return
 }
@@ -270,7 +359,7 @@ func (s *singleSourceCacheBolt) markRevisionExists(rev Revision) {
 		return nil
 	})
 	if err != nil {
-		s.logger.Println(errors.Wrapf(err, "failed to mark revision %q in cache", rev))
+		s.logger.Println(wrapErrorf(err, "failed to mark revision %q in cache", rev))
 	}
 }
 
@@ -301,16 +390,16 @@ func (s *singleSourceCacheBolt) setVersionMap(pvs []PairedVersion) {
 			uv.copyTo(&msg)
 			uvB, err := proto.Marshal(&msg)
 			if err != nil {
-				return errors.Wrapf(err, "failed to serialize UnpairedVersion: %#v", uv)
+				return wrapErrorf(err, "failed to serialize UnpairedVersion: %#v", uv)
 			}
 
 			if err := versions.Put(uvB, []byte(rev)); err != nil {
-				return errors.Wrap(err, "failed to put version->revision")
+				return wrapError(err, "failed to put version->revision")
 			}
 
 			b, err := src.CreateBucketIfNotExists(cacheRevisionName(rev))
 			if err != nil {
-				return errors.Wrapf(err, "failed to create bucket for revision: %s", rev)
+				return wrapErrorf(err, "failed to create bucket for revision: %s", rev)
 			}
 
 			var versions *bolt.Bucket
@@ -321,20 +410,20 @@ func (s *singleSourceCacheBolt) setVersionMap(pvs []PairedVersion) {
 				}
 				versions, err = b.CreateBucket(vk)
 				if err != nil {
-					return errors.Wrapf(err, "failed to create bucket for revision versions: %s", rev)
+					return wrapErrorf(err, "failed to create bucket for revision versions: %s", rev)
 				}
 				revVersions[rev] = versions
 			}
 
 			key.Put(uint64(i))
 			if err := versions.Put(key, uvB); err != nil {
-				return errors.Wrap(err, "failed to put revision->version")
+				return wrapError(err, "failed to put revision->version")
 			}
 		}
 		return nil
 	})
 	if err != nil {
-		s.logger.Println(errors.Wrap(err, "failed to cache version map"))
+		s.logger.Println(wrapError(err, "failed to cache version map"))
 	}
 }
 
@@ -361,7 +450,7 @@ func (s *singleSourceCacheBolt) getVersionsFor(rev Revision) (uvs []UnpairedVers
 		})
 	})
 	if err != nil {
-		s.logger.Println(errors.Wrapf(err, "failed to get cached versions for revision %q", rev))
+		s.logger.Println(wrapErrorf(err, "failed to get cached versions for revision %q", rev))
 		return nil, false
 	}
 	return
@@ -389,7 +478,7 @@ func (s *singleSourceCacheBolt) getAllVersions() (pvs []PairedVersion, ok bool)
 		})
 	})
 	if err != nil {
-		s.logger.Println(errors.Wrap(err, "failed to get all cached versions"))
+		s.logger.Println(wrapError(err, "failed to get all cached versions"))
 		return nil, false
 	}
 	return
@@ -406,7 +495,7 @@ func (s *singleSourceCacheBolt) getRevisionFor(uv UnpairedVersion) (rev Revision
 		uv.copyTo(&msg)
 		b, err := proto.Marshal(&msg)
 		if err != nil {
-			return errors.Wrapf(err, "failed to serialize UnpairedVersion: %#v", uv)
+			return wrapErrorf(err, "failed to serialize UnpairedVersion: %#v", uv)
 		}
 
 		v := versions.Get(b)
@@ -417,7 +506,7 @@ func (s *singleSourceCacheBolt) getRevisionFor(uv UnpairedVersion) (rev Revision
 		return nil
 	})
 	if err != nil {
-		s.logger.Println(errors.Wrapf(err, "failed to get cached revision for unpaired version: %v", uv))
+		s.logger.Println(wrapErrorf(err, "failed to get cached revision for unpaired version: %v", uv))
 	}
 	return
 }
@@ -468,7 +557,7 @@ func (s *singleSourceCacheBolt) toUnpaired(v Version) (uv UnpairedVersion, ok bo
 			return nil
 		})
 		if err != nil {
-			s.logger.Println(errors.Wrapf(err, errMsg, v))
+			s.logger.Println(wrapErrorf(err, errMsg, v))
 		}
 		return
 	default:
@@ -501,7 +590,7 @@ func (s *singleSourceCacheBolt) updateSourceBucket(update func(b *bolt.Bucket) e
 	return s.db.Batch(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists(s.sourceName)
 		if err != nil {
-			return errors.Wrapf(err, "failed to create bucket: %s", s.sourceName)
+			return wrapErrorf(err, "failed to create bucket: %s", s.sourceName)
 		}
 		return update(b)
 	})
@@ -524,7 +613,7 @@ func (s *singleSourceCacheBolt) updateRevBucket(rev Revision, update func(b *bol
 		name := cacheRevisionName(rev)
 		b, err := src.CreateBucketIfNotExists(name)
 		if err != nil {
-			return errors.Wrapf(err, "failed to create bucket: %s", name)
+			return wrapErrorf(err, "failed to create bucket: %s", name)
 		}
 		return update(b)
 	})
@@ -20,17 +20,24 @@ import (
 var (
 	cacheKeyComment      = []byte("c")
 	cacheKeyConstraint   = cacheKeyComment
+	cacheKeyAnnotation   = cacheKeyComment
+	cacheKeyDate         = []byte("d")
 	cacheKeyError        = []byte("e")
 	cacheKeyInputImports = []byte("m")
 	cacheKeyIgnored      = []byte("i")
 	cacheKeyImport       = cacheKeyIgnored
 	cacheKeyLock         = []byte("l")
+	cacheKeyLicenseFile  = cacheKeyLock
 	cacheKeyName         = []byte("n")
+	cacheKeyTagger       = cacheKeyName
+	cacheKeyOtherFile    = []byte("f")
 	cacheKeyOverride     = []byte("o")
 	cacheKeyPTree        = []byte("p")
+	cacheKeyParseError   = cacheKeyPTree
 	cacheKeyRequired     = []byte("r")
 	cacheKeyRevision     = cacheKeyRequired
 	cacheKeyTestImport   = []byte("t")
+	cacheKeyTag          = cacheKeyTestImport
 
 	cacheRevision = byte('r')
 	cacheVersion  = byte('v')
@@ -190,7 +197,7 @@ func cacheGetManifest(b *bolt.Bucket) (RootManifest, error) {
 			return nil
 		})
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to get constraints")
+			return nil, wrapError(err, "failed to get constraints")
 		}
 	}
 
@@ -203,7 +210,7 @@ func cacheGetManifest(b *bolt.Bucket) (RootManifest, error) {
 		})
 		m.ig = pkgtree.NewIgnoredRuleset(igslice)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to get ignored")
+			return nil, wrapError(err, "failed to get ignored")
 		}
 	}
 
@@ -222,7 +229,7 @@ func cacheGetManifest(b *bolt.Bucket) (RootManifest, error) {
 			return nil
 		})
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to get overrides")
+			return nil, wrapError(err, "failed to get overrides")
 		}
 	}
 
@@ -233,7 +240,7 @@ func cacheGetManifest(b *bolt.Bucket) (RootManifest, error) {
 			return nil
 		})
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to get required")
+			return nil, wrapError(err, "failed to get required")
 		}
 	}
 
@@ -310,7 +317,7 @@ func cachePutLock(b *bolt.Bucket, l Lock) error {
 	// Input imports, if present.
 	byt := []byte(strings.Join(l.InputImports(), "#"))
 	if err := b.Put(cacheKeyInputImports, byt); err != nil {
-		return errors.Wrap(err, "failed to put input imports")
+		return wrapError(err, "failed to put input imports")
 	}
 
 	// Projects
@@ -359,23 +366,23 @@ func cacheGetLock(b *bolt.Bucket) (*safeLock, error) {
 			return nil
 		})
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to get locked projects")
+			return nil, wrapError(err, "failed to get locked projects")
 		}
 	}
 	return l, nil
 }
 
 // cachePutPackageOrError stores the pkgtree.PackageOrErr as fields in the bolt.Bucket.
-// Package.ImportPath is ignored.
+// Package.ImportPath and Package.ImportPositions are ignored.
 func cachePutPackageOrErr(b *bolt.Bucket, poe pkgtree.PackageOrErr) error {
 	if poe.Err != nil {
 		err := b.Put(cacheKeyError, []byte(poe.Err.Error()))
-		return errors.Wrapf(err, "failed to put error: %v", poe.Err)
+		return wrapErrorf(err, "failed to put error: %v", poe.Err)
 	}
 	if len(poe.P.CommentPath) > 0 {
 		err := b.Put(cacheKeyComment, []byte(poe.P.CommentPath))
 		if err != nil {
-			return errors.Wrapf(err, "failed to put package: %v", poe.P)
+			return wrapErrorf(err, "failed to put package: %v", poe.P)
 		}
 	}
 	if len(poe.P.Imports) > 0 {
@@ -396,7 +403,7 @@ func cachePutPackageOrErr(b *bolt.Bucket, poe pkgtree.PackageOrErr) error {
 	if len(poe.P.Name) > 0 {
 		err := b.Put(cacheKeyName, []byte(poe.P.Name))
 		if err != nil {
-			return errors.Wrapf(err, "failed to put package: %v", poe.P)
+			return wrapErrorf(err, "failed to put package: %v", poe.P)
 		}
 	}
 
@@ -414,6 +421,36 @@ func cachePutPackageOrErr(b *bolt.Bucket, poe pkgtree.PackageOrErr) error {
 			}
 		}
 	}
+
+	if len(poe.P.OtherFiles) > 0 {
+		of, err := b.CreateBucket(cacheKeyOtherFile)
+		if err != nil {
+			return err
+		}
+		key := make(nuts.Key, nuts.KeyLen(uint64(len(poe.P.OtherFiles)-1)))
+		for i := range poe.P.OtherFiles {
+			v := []byte(poe.P.OtherFiles[i])
+			key.Put(uint64(i))
+			if err := of.Put(key, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(poe.P.ParseErrors) > 0 {
+		pe, err := b.CreateBucket(cacheKeyParseError)
+		if err != nil {
+			return err
+		}
+		key := make(nuts.Key, nuts.KeyLen(uint64(len(poe.P.ParseErrors)-1)))
+		for i := range poe.P.ParseErrors {
+			v := []byte(poe.P.ParseErrors[i])
+			key.Put(uint64(i))
+			if err := pe.Put(key, v); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -447,9 +484,95 @@ func cacheGetPackageOrErr(b *bolt.Bucket) (pkgtree.PackageOrErr, error) {
 			return pkgtree.PackageOrErr{}, err
 		}
 	}
+	if of := b.Bucket(cacheKeyOtherFile); of != nil {
+		err := of.ForEach(func(_, v []byte) error {
+			p.OtherFiles = append(p.OtherFiles, string(v))
+			return nil
+		})
+		if err != nil {
+			return pkgtree.PackageOrErr{}, err
+		}
+	}
+	if pe := b.Bucket(cacheKeyParseError); pe != nil {
+		err := pe.ForEach(func(_, v []byte) error {
+			p.ParseErrors = append(p.ParseErrors, string(v))
+			return nil
+		})
+		if err != nil {
+			return pkgtree.PackageOrErr{}, err
+		}
+	}
 	return pkgtree.PackageOrErr{P: p}, nil
 }
 
+// cachePutLicenseFiles stores the license file names as a bucket of fields in
+// the bolt.Bucket.
+func cachePutLicenseFiles(b *bolt.Bucket, lf []string) error {
+	lb, err := b.CreateBucket(cacheKeyLicenseFile)
+	if err != nil {
+		return err
+	}
+	key := make(nuts.Key, nuts.KeyLen(uint64(len(lf)-1)))
+	for i := range lf {
+		key.Put(uint64(i))
+		if err := lb.Put(key, []byte(lf[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheGetLicenseFiles returns the license file names retrieved from the
+// bolt.Bucket, if any.
+func cacheGetLicenseFiles(b *bolt.Bucket) ([]string, error) {
+	lb := b.Bucket(cacheKeyLicenseFile)
+	if lb == nil {
+		return nil, nil
+	}
+	var lf []string
+	err := lb.ForEach(func(_, v []byte) error {
+		lf = append(lf, string(v))
+		return nil
+	})
+	return lf, err
+}
+
+// cachePutTagInfo stores the TagInfo as fields in the bolt.Bucket. Its name and
+// revision are implied by the buckets it is stored in.
+func cachePutTagInfo(b *bolt.Bucket, ti TagInfo) error {
+	date, err := ti.Date.MarshalBinary()
+	if err != nil {
+		return wrapErrorf(err, "failed to marshal date of tag %q", ti.Name)
+	}
+	if err = b.Put(cacheKeyDate, date); err != nil {
+		return err
+	}
+	if !ti.Annotated {
+		return nil
+	}
+	if err = b.Put(cacheKeyTagger, []byte(ti.Tagger)); err != nil {
+		return err
+	}
+	// The presence of an annotation, even an empty one, marks the tag as
+	// annotated.
+	return b.Put(cacheKeyAnnotation, []byte(ti.Annotation))
+}
+
+// cacheGetTagInfo returns the TagInfo of the tag named name, which refers to
+// r, from the fields in the bolt.Bucket.
+func cacheGetTagInfo(b *bolt.Bucket, r Revision, name string) (TagInfo, error) {
+	ti := TagInfo{Name: name, Revision: r}
+	if err := ti.Date.UnmarshalBinary(b.Get(cacheKeyDate)); err != nil {
+		return TagInfo{}, wrapErrorf(err, "failed to unmarshal date of tag %q", name)
+	}
+	if a := b.Get(cacheKeyAnnotation); a != nil {
+		ti.Annotated = true
+		ti.Annotation = string(a)
+		ti.Tagger = string(b.Get(cacheKeyTagger))
+	}
+	return ti, nil
+}
+
 // cacheTimestampedKey returns a prefixed key with a trailing timestamp.
 func cacheTimestampedKey(pre byte, t time.Time) []byte {
 	b := make([]byte, 9)
@@ -470,7 +593,7 @@ func cachePrefixDelete(tob boltTxOrBucket, pre byte) error {
 	c := tob.Cursor()
 	for k, _ := c.Seek([]byte{pre}); len(k) > 0 && k[0] == pre; k, _ = c.Next() {
 		if err := tob.DeleteBucket(k); err != nil {
-			return errors.Wrapf(err, "failed to delete bucket: %s", k)
+			return wrapErrorf(err, "failed to delete bucket: %s", k)
 		}
 	}
 	return nil
@@ -0,0 +1,166 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// Rough overheads, in bytes, used in estimating the memory held by cached
+// values. Precision is not the goal; it's enough that bigger values count for
+// proportionally more.
+const (
+	lruEntryOverhead  = 256
+	lruStringOverhead = 16
+)
+
+// lruKind is the kind of value referred to by an lruKey.
+type lruKind uint8
+
+const (
+	lruProjectInfo lruKind = iota
+	lruPackageTree
+)
+
+// lruKey identifies a single evictable value in a singleSourceCacheMemory.
+type lruKey struct {
+	c    *singleSourceCacheMemory
+	kind lruKind
+	pai  ProjectAnalyzerInfo // lruProjectInfo only
+	r    Revision
+}
+
+type lruEntry struct {
+	key  lruKey
+	size int64
+}
+
+// memoryLRU bounds the approximate memory held by the manifests, locks and
+// PackageTrees in a set of singleSourceCacheMemory instances, evicting the
+// least recently used when the total grows beyond its limit. Version data is
+// comparatively small, and is never evicted.
+type memoryLRU struct {
+	mu      sync.Mutex // guards all fields
+	limit   int64
+	size    int64
+	order   *list.List // of *lruEntry, most recently used first
+	entries map[lruKey]*list.Element
+}
+
+// newMemoryLRU returns a memoryLRU bounded by limit bytes.
+func newMemoryLRU(limit int64) *memoryLRU {
+	return &memoryLRU{
+		limit:   limit,
+		order:   list.New(),
+		entries: make(map[lruKey]*list.Element),
+	}
+}
+
+// add records that the value for key, of the given size, was just stored, and
+// evicts least recently used values as needed to stay within the limit. The
+// value for key itself is never evicted as a result of its own addition.
+//
+// Values are evicted from their singleSourceCacheMemory while lru.mu is still
+// held, so that a concurrent add of the same key can't be undone by a late
+// eviction. The caller must therefore not hold the mutex of any
+// singleSourceCacheMemory.
+func (lru *memoryLRU) add(key lruKey, size int64) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	if el, has := lru.entries[key]; has {
+		e := el.Value.(*lruEntry)
+		lru.size += size - e.size
+		e.size = size
+		lru.order.MoveToFront(el)
+	} else {
+		lru.entries[key] = lru.order.PushFront(&lruEntry{key: key, size: size})
+		lru.size += size
+	}
+
+	for lru.size > lru.limit && lru.order.Len() > 1 {
+		el := lru.order.Back()
+		e := el.Value.(*lruEntry)
+		lru.order.Remove(el)
+		delete(lru.entries, e.key)
+		lru.size -= e.size
+		e.key.c.evict(e.key)
+	}
+}
+
+// touch records that the value for key was just used.
+func (lru *memoryLRU) touch(key lruKey) {
+	lru.mu.Lock()
+	if el, has := lru.entries[key]; has {
+		lru.order.MoveToFront(el)
+	}
+	lru.mu.Unlock()
+}
+
+// usage returns the approximate number of bytes currently held.
+func (lru *memoryLRU) usage() int64 {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.size
+}
+
+// packageTreeSize estimates the memory held by a cached PackageTree.
+func packageTreeSize(pkgs map[string]pkgtree.PackageOrErr, lfiles map[string][]string) int64 {
+	size := int64(lruEntryOverhead)
+	strs := func(ss []string) {
+		for _, s := range ss {
+			size += lruStringOverhead + int64(len(s))
+		}
+	}
+
+	for ip, poe := range pkgs {
+		size += lruEntryOverhead + int64(len(ip))
+		if poe.Err != nil {
+			continue
+		}
+		p := poe.P
+		size += int64(len(p.Name) + len(p.CommentPath))
+		strs(p.Imports)
+		strs(p.TestImports)
+		strs(p.OtherFiles)
+		strs(p.ParseErrors)
+		for imp, pos := range p.ImportPositions {
+			size += lruStringOverhead + int64(len(imp))
+			for _, ps := range pos {
+				size += lruStringOverhead + int64(len(ps.File)) + 16
+			}
+		}
+	}
+	for ip, files := range lfiles {
+		size += lruStringOverhead + int64(len(ip))
+		strs(files)
+	}
+	return size
+}
+
+// projectInfoSize estimates the memory held by a cached manifest and lock.
+func projectInfoSize(m Manifest, l Lock) int64 {
+	size := int64(lruEntryOverhead)
+	if m != nil {
+		for pr, pp := range m.DependencyConstraints() {
+			size += lruEntryOverhead + int64(len(pr)+len(pp.Source))
+		}
+	}
+	if l != nil {
+		for _, ip := range l.InputImports() {
+			size += lruStringOverhead + int64(len(ip))
+		}
+		for _, lp := range l.Projects() {
+			id := lp.Ident()
+			size += lruEntryOverhead + int64(len(id.ProjectRoot)+len(id.Source))
+			for _, pkg := range lp.Packages() {
+				size += lruStringOverhead + int64(len(pkg))
+			}
+		}
+	}
+	return size
+}
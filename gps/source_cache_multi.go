@@ -108,6 +108,26 @@ func (c *singleSourceMultiCache) getPackageTree(r Revision, pr ProjectRoot) (pkg
 	return pkgtree.PackageTree{}, false
 }
 
+func (c *singleSourceMultiCache) setTagInfo(ti TagInfo) {
+	c.mem.setTagInfo(ti)
+	c.async <- func() { c.disk.setTagInfo(ti) }
+}
+
+func (c *singleSourceMultiCache) getTagInfo(r Revision, name string) (TagInfo, bool) {
+	ti, ok := c.mem.getTagInfo(r, name)
+	if ok {
+		return ti, true
+	}
+
+	ti, ok = c.disk.getTagInfo(r, name)
+	if ok {
+		c.mem.setTagInfo(ti)
+		return ti, true
+	}
+
+	return TagInfo{}, false
+}
+
 func (c *singleSourceMultiCache) markRevisionExists(r Revision) {
 	c.mem.markRevisionExists(r)
 	c.async <- func() { c.disk.markRevisionExists(r) }
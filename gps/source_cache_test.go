@@ -5,6 +5,7 @@
 package gps
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"path"
@@ -23,6 +24,11 @@ func Test_singleSourceCache(t *testing.T) {
 		return memoryCache{}
 	}
 	t.Run("mem", singleSourceCacheTest{newCache: newMem}.run)
+	t.Run("mem/lru", singleSourceCacheTest{
+		newCache: func(*testing.T, string) sourceCache {
+			return memoryCache{lru: newMemoryLRU(1 << 30)}
+		},
+	}.run)
 
 	epoch := time.Now().Unix()
 	newBolt := func(t *testing.T, cachedir string) sourceCache {
@@ -61,6 +67,110 @@ func Test_singleSourceCache(t *testing.T) {
 			return newMultiCache(discardCache{}, bc)
 		},
 	}.run)
+
+	// Values are written to, and so read back from, the first tier.
+	newTiered := func(t *testing.T, cachedir string) sourceCache {
+		bc, err := newBoltCache(cachedir, epoch, log.New(test.Writer{TB: t}, "", 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tieredCache{bc, memoryCache{}}
+	}
+	t.Run("tiered/keepOpen", singleSourceCacheTest{newCache: newTiered}.run)
+	t.Run("tiered/reOpen", singleSourceCacheTest{persistent: true, newCache: newTiered}.run)
+}
+
+func TestTieredCacheShared(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("shared")
+	logger := log.New(test.Writer{TB: t}, "", 0)
+	epoch := time.Now().Unix()
+	id := mkPI("github.com/foo/bar")
+	pvs := []PairedVersion{NewVersion("v1.0.0").Pair("a0e06d1e1e1f4c0c3a4b5c6d7e8f9a0b1c2d3e4f")}
+
+	if sc, err := openSharedBoltCache(h.Path("shared"), epoch, logger); sc != nil || err != nil {
+		t.Fatalf("expected no cache in an empty shared dir, got %v, %v", sc, err)
+	}
+	bc, err := newBoltCache(h.Path("shared"), epoch, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.newSingleSourceCache(id).setVersionMap(pvs)
+	if err = bc.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	shared, err := openSharedBoltCache(h.Path("shared"), epoch, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := tieredCache{memoryCache{}, shared}
+	defer c.close()
+
+	sc := c.newSingleSourceCache(id)
+	if got, ok := sc.getAllVersions(); !ok || !reflect.DeepEqual(got, pvs) {
+		t.Errorf("expected the shared cache's versions %v, got %v", pvs, got)
+	}
+	// The shared cache is read-only, so writes go only to the first tier.
+	sc.setTagInfo(TagInfo{Name: "v1.0.0", Revision: pvs[0].Revision()})
+	if _, ok := sc.getTagInfo(pvs[0].Revision(), "v1.0.0"); !ok {
+		t.Error("expected the write to go to the first tier")
+	}
+}
+
+func TestMemoryCacheLRU(t *testing.T) {
+	const root = "example.com/test"
+	ptree := func(n int) pkgtree.PackageTree {
+		pt := pkgtree.PackageTree{ImportRoot: root, Packages: make(map[string]pkgtree.PackageOrErr)}
+		for i := 0; i < n; i++ {
+			ip := fmt.Sprintf("%s/pkg%d", root, i)
+			pt.Packages[ip] = pkgtree.PackageOrErr{P: pkgtree.Package{ImportPath: ip, Name: "pkg", Imports: []string{"sort", "strings"}}}
+		}
+		return pt
+	}
+	revs := []Revision{"rev0", "rev1", "rev2"}
+
+	// Measure a single tree, then allow for just over two of them.
+	lru := newMemoryLRU(1 << 30)
+	memoryCache{lru: lru}.newSingleSourceCache(mkPI(root)).setPackageTree(revs[0], ptree(10))
+	one := lru.usage()
+
+	mc := memoryCache{lru: newMemoryLRU(one*2 + one/2)}
+	a := mc.newSingleSourceCache(mkPI(root))
+	b := mc.newSingleSourceCache(mkPI("example.com/other"))
+
+	a.setPackageTree(revs[0], ptree(10))
+	b.setPackageTree(revs[1], ptree(10))
+	// Using the first makes the second the least recently used.
+	if _, ok := a.getPackageTree(revs[0], root); !ok {
+		t.Fatal("expected first tree to be cached")
+	}
+	a.setPackageTree(revs[2], ptree(10))
+
+	if _, ok := b.getPackageTree(revs[1], "example.com/other"); ok {
+		t.Error("expected least recently used tree to be evicted, across caches")
+	}
+	for _, r := range []Revision{revs[0], revs[2]} {
+		if _, ok := a.getPackageTree(r, root); !ok {
+			t.Errorf("expected tree for %s to remain cached", r)
+		}
+	}
+	if got := mc.lru.usage(); got != 2*one {
+		t.Errorf("expected usage of two trees (%v), got %v", 2*one, got)
+	}
+
+	// Evicting values doesn't lose track of the revisions.
+	if _, ok := b.getVersionsFor(revs[1]); !ok {
+		t.Error("expected evicted revision to still be known to exist")
+	}
+
+	// A single value larger than the limit is still cached.
+	big := memoryCache{lru: newMemoryLRU(1)}.newSingleSourceCache(mkPI(root))
+	big.setManifestAndLock(revs[0], testAnalyzerInfo, &simpleRootManifest{}, nil)
+	if _, _, ok := big.getManifestAndLock(revs[0], testAnalyzerInfo); !ok {
+		t.Error("expected most recently set value to be cached regardless of the limit")
+	}
 }
 
 var testAnalyzerInfo = ProjectAnalyzerInfo{
@@ -247,9 +357,20 @@ func (test singleSourceCacheTest) run(t *testing.T) {
 							"os",
 							"sort",
 						},
+						OtherFiles: []string{
+							"asm_amd64.s",
+							"include/m1p.h",
+						},
+						ParseErrors: []string{
+							"m1p/broken.go:1:1: expected 'package', found 'EOF'",
+						},
 					},
 				},
 			},
+			LicenseFiles: map[string][]string{
+				root:                   {"LICENSE", "NOTICE"},
+				path.Join(root, "m1p"): {"COPYING"},
+			},
 		}
 		c.setPackageTree(rev, pt)
 
@@ -410,6 +531,69 @@ func (test singleSourceCacheTest) run(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("tagInfo", func(t *testing.T) {
+		sc := test.newCache(t, cpath)
+		c := sc.newSingleSourceCache(pi)
+		defer func() {
+			if err := sc.close(); err != nil {
+				t.Fatal("failed to close cache:", err)
+			}
+		}()
+
+		tags := []TagInfo{
+			{
+				Name:       "v1.0.0",
+				Revision:   "rev1",
+				Annotated:  true,
+				Tagger:     "Test author <test@example.com>",
+				Date:       time.Unix(1500000000, 0),
+				Annotation: "Release 1.0.0\n",
+			},
+			{
+				Name:      "v1.0.1",
+				Revision:  "rev1",
+				Annotated: true,
+				Date:      time.Unix(1500000001, 0),
+			},
+			{
+				Name:     "v0.9.0",
+				Revision: "rev0",
+				Date:     time.Unix(1400000000, 0),
+			},
+		}
+		for _, ti := range tags {
+			c.setTagInfo(ti)
+		}
+
+		if test.persistent {
+			if err := sc.close(); err != nil {
+				t.Fatal("failed to close cache:", err)
+			}
+			sc = test.newCache(t, cpath)
+			c = sc.newSingleSourceCache(pi)
+		}
+
+		for _, want := range tags {
+			got, ok := c.getTagInfo(want.Revision, want.Name)
+			if !ok {
+				t.Errorf("no info found for tag %s", want.Name)
+				continue
+			}
+			if !got.Date.Equal(want.Date) {
+				t.Errorf("unexpected date for tag %s:\n\t(GOT): %s\n\t(WNT): %s", want.Name, got.Date, want.Date)
+			}
+			got.Date = want.Date
+			if got != want {
+				t.Errorf("unexpected info for tag %s:\n\t(GOT): %#v\n\t(WNT): %#v", want.Name, got, want)
+			}
+		}
+
+		// Metadata is only valid for the revision the tag referred to.
+		if _, ok := c.getTagInfo("rev2", "v1.0.0"); ok {
+			t.Error("expected no info for a tag at a different revision")
+		}
+	})
 }
 
 // compareManifests compares two manifests and reports differences as test errors.
@@ -477,6 +661,9 @@ func comparePackageTree(t *testing.T, want, got pkgtree.PackageTree) {
 			}
 		}
 	}
+	if !reflect.DeepEqual(want.LicenseFiles, got.LicenseFiles) {
+		t.Errorf("unexpected license files:\n\t(GOT): %#v\n\t(WNT): %#v", got.LicenseFiles, want.LicenseFiles)
+	}
 }
 
 func projectConstraintsEqual(want, got ProjectConstraints) bool {
@@ -562,6 +749,24 @@ func packageOrErrEqual(a, b pkgtree.PackageOrErr) bool {
 		}
 	}
 
+	if len(a.P.OtherFiles) != len(b.P.OtherFiles) {
+		return false
+	}
+	for i := range a.P.OtherFiles {
+		if a.P.OtherFiles[i] != b.P.OtherFiles[i] {
+			return false
+		}
+	}
+
+	if len(a.P.ParseErrors) != len(b.P.ParseErrors) {
+		return false
+	}
+	for i := range a.P.ParseErrors {
+		if a.P.ParseErrors[i] != b.P.ParseErrors[i] {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -591,6 +796,12 @@ func (singleSourceDiscardCache) getPackageTree(Revision, ProjectRoot) (pkgtree.P
 	return pkgtree.PackageTree{}, false
 }
 
+func (singleSourceDiscardCache) setTagInfo(TagInfo) {}
+
+func (singleSourceDiscardCache) getTagInfo(Revision, string) (TagInfo, bool) {
+	return TagInfo{}, false
+}
+
 func (singleSourceDiscardCache) markRevisionExists(r Revision) {}
 
 func (singleSourceDiscardCache) setVersionMap(versionList []PairedVersion) {}
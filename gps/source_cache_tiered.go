@@ -0,0 +1,131 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// tieredCache is a sourceCache made of others, in order. Reads are answered
+// by the first that can answer them, and writes go only to the first; the
+// rest, such as the caches of shared read-only cache directories, are only
+// read from.
+type tieredCache []sourceCache
+
+// close releases all the tiers' resources, returning the first error.
+func (c tieredCache) close() error {
+	var err error
+	for _, t := range c {
+		if terr := t.close(); err == nil {
+			err = terr
+		}
+	}
+	return err
+}
+
+// newSingleSourceCache returns a singleSourceTieredCache for id.
+func (c tieredCache) newSingleSourceCache(id ProjectIdentifier) singleSourceCache {
+	s := make(singleSourceTieredCache, len(c))
+	for i, t := range c {
+		s[i] = t.newSingleSourceCache(id)
+	}
+	return s
+}
+
+// singleSourceTieredCache checks each of its tiers in order, and sets values
+// only in the first.
+type singleSourceTieredCache []singleSourceCache
+
+func (c singleSourceTieredCache) setManifestAndLock(r Revision, ai ProjectAnalyzerInfo, m Manifest, l Lock) {
+	c[0].setManifestAndLock(r, ai, m, l)
+}
+
+func (c singleSourceTieredCache) getManifestAndLock(r Revision, ai ProjectAnalyzerInfo) (Manifest, Lock, bool) {
+	for _, t := range c {
+		if m, l, ok := t.getManifestAndLock(r, ai); ok {
+			return m, l, true
+		}
+	}
+	return nil, nil, false
+}
+
+func (c singleSourceTieredCache) setPackageTree(r Revision, ptree pkgtree.PackageTree) {
+	c[0].setPackageTree(r, ptree)
+}
+
+func (c singleSourceTieredCache) getPackageTree(r Revision, pr ProjectRoot) (pkgtree.PackageTree, bool) {
+	for _, t := range c {
+		if ptree, ok := t.getPackageTree(r, pr); ok {
+			return ptree, true
+		}
+	}
+	return pkgtree.PackageTree{}, false
+}
+
+func (c singleSourceTieredCache) setTagInfo(ti TagInfo) {
+	c[0].setTagInfo(ti)
+}
+
+func (c singleSourceTieredCache) getTagInfo(r Revision, name string) (TagInfo, bool) {
+	for _, t := range c {
+		if ti, ok := t.getTagInfo(r, name); ok {
+			return ti, true
+		}
+	}
+	return TagInfo{}, false
+}
+
+func (c singleSourceTieredCache) markRevisionExists(r Revision) {
+	c[0].markRevisionExists(r)
+}
+
+func (c singleSourceTieredCache) setVersionMap(pvs []PairedVersion) {
+	c[0].setVersionMap(pvs)
+}
+
+func (c singleSourceTieredCache) getVersionsFor(rev Revision) ([]UnpairedVersion, bool) {
+	for _, t := range c {
+		if uvs, ok := t.getVersionsFor(rev); ok {
+			return uvs, true
+		}
+	}
+	return nil, false
+}
+
+func (c singleSourceTieredCache) getAllVersions() ([]PairedVersion, bool) {
+	for _, t := range c {
+		if pvs, ok := t.getAllVersions(); ok {
+			return pvs, true
+		}
+	}
+	return nil, false
+}
+
+func (c singleSourceTieredCache) getRevisionFor(uv UnpairedVersion) (Revision, bool) {
+	for _, t := range c {
+		if rev, ok := t.getRevisionFor(uv); ok {
+			return rev, true
+		}
+	}
+	return "", false
+}
+
+func (c singleSourceTieredCache) toRevision(v Version) (Revision, bool) {
+	for _, t := range c {
+		if rev, ok := t.toRevision(v); ok {
+			return rev, true
+		}
+	}
+	return "", false
+}
+
+func (c singleSourceTieredCache) toUnpaired(v Version) (UnpairedVersion, bool) {
+	for _, t := range c {
+		if uv, ok := t.toUnpaired(v); ok {
+			return uv, true
+		}
+	}
+	return nil, false
+}
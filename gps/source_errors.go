@@ -29,7 +29,7 @@ func unwrapVcsErr(err error) error {
 	if cause == nil {
 		cause = errors.New(out)
 	} else {
-		cause = errors.Wrap(cause, out)
+		cause = wrapError(cause, out)
 	}
-	return errors.Wrap(cause, msg)
+	return wrapError(cause, msg)
 }
@@ -0,0 +1,55 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "fmt"
+
+// SourceEventType identifies the kind of a SourceEvent.
+type SourceEventType int
+
+const (
+	// SourceRecovered indicates that the local copy of a source in the cache
+	// directory was found to be corrupt, so it was quarantined and the source
+	// was retrieved afresh from upstream.
+	SourceRecovered SourceEventType = iota
+	// SourceRedirected indicates that a source's upstream redirected to
+	// another URL, as happens when a repository is moved or renamed. The
+	// manifest and lock may need updating to refer to the new URL.
+	SourceRedirected
+)
+
+func (t SourceEventType) String() string {
+	switch t {
+	case SourceRecovered:
+		return "source recovered"
+	case SourceRedirected:
+		return "source redirected"
+	default:
+		return fmt.Sprintf("SourceEventType(%d)", int(t))
+	}
+}
+
+// SourceEvent describes something that happened to a source that the user may
+// want to know about, even though the SourceManager was able to carry on.
+type SourceEvent struct {
+	Type    SourceEventType
+	URL     string // Upstream URL of the source
+	MovedTo string // For SourceRedirected, the URL that upstream moved to
+	Detail  string // Human-readable description of what happened
+}
+
+func (e SourceEvent) String() string {
+	return fmt.Sprintf("%s: %s: %s", e.Type, e.URL, e.Detail)
+}
+
+// eventNotifier delivers SourceEvents to a logger and to an optional receiver.
+type eventNotifier func(SourceEvent)
+
+// notify delivers ev, if n is non-nil.
+func (n eventNotifier) notify(ev SourceEvent) {
+	if n != nil {
+		n(ev)
+	}
+}
@@ -7,12 +7,14 @@ package gps
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -74,23 +76,28 @@ func (fl falseLocker) Unlock() error {
 type SourceManager interface {
 	// SourceExists checks if a repository exists, either upstream or in the
 	// SourceManager's central repository cache.
-	SourceExists(ProjectIdentifier) (bool, error)
+	SourceExists(context.Context, ProjectIdentifier) (bool, error)
 
 	// SyncSourceFor will attempt to bring all local information about a source
 	// fully up to date.
-	SyncSourceFor(ProjectIdentifier) error
+	SyncSourceFor(context.Context, ProjectIdentifier) error
 
 	// ListVersions retrieves a list of the available versions for a given
 	// repository name.
-	ListVersions(ProjectIdentifier) ([]PairedVersion, error)
+	ListVersions(context.Context, ProjectIdentifier) ([]PairedVersion, error)
+
+	// ListVersionsMatching retrieves the versions of the given repository that
+	// satisfy the provided Constraint, sorted in the order the solver prefers
+	// them when upgrading.
+	ListVersionsMatching(context.Context, ProjectIdentifier, Constraint) ([]PairedVersion, error)
 
 	// RevisionPresentIn indicates whether the provided Version is present in
 	// the given repository.
-	RevisionPresentIn(ProjectIdentifier, Revision) (bool, error)
+	RevisionPresentIn(context.Context, ProjectIdentifier, Revision) (bool, error)
 
 	// ListPackages parses the tree of the Go packages at or below root of the
 	// provided ProjectIdentifier, at the provided version.
-	ListPackages(ProjectIdentifier, Version) (pkgtree.PackageTree, error)
+	ListPackages(context.Context, ProjectIdentifier, Version) (pkgtree.PackageTree, error)
 
 	// GetManifestAndLock returns manifest and lock information for the provided
 	// root import path.
@@ -98,7 +105,7 @@ type SourceManager interface {
 	// gps currently requires that projects be rooted at their repository root,
 	// necessitating that the ProjectIdentifier's ProjectRoot must also be a
 	// repository root.
-	GetManifestAndLock(ProjectIdentifier, Version, ProjectAnalyzer) (Manifest, Lock, error)
+	GetManifestAndLock(context.Context, ProjectIdentifier, Version, ProjectAnalyzer) (Manifest, Lock, error)
 
 	// ExportProject writes out the tree of the provided import path, at the
 	// provided version, to the provided directory.
@@ -115,12 +122,12 @@ type SourceManager interface {
 
 	// DeduceProjectRoot takes an import path and deduces the corresponding
 	// project/source root.
-	DeduceProjectRoot(ip string) (ProjectRoot, error)
+	DeduceProjectRoot(ctx context.Context, ip string) (ProjectRoot, error)
 
 	// SourceURLsForPath takes an import path and deduces the set of source URLs
 	// that may refer to a canonical upstream source.
 	// In general, these URLs differ only by protocol (e.g. https vs. ssh), not path
-	SourceURLsForPath(ip string) ([]*url.URL, error)
+	SourceURLsForPath(ctx context.Context, ip string) ([]*url.URL, error)
 
 	// Release lets go of any locks held by the SourceManager. Once called, it
 	// is no longer allowed to call methods of that SourceManager; all
@@ -129,7 +136,7 @@ type SourceManager interface {
 
 	// InferConstraint tries to puzzle out what kind of version is given in a string -
 	// semver, a revision, or as a fallback, a plain tag
-	InferConstraint(s string, pi ProjectIdentifier) (Constraint, error)
+	InferConstraint(ctx context.Context, s string, pi ProjectIdentifier) (Constraint, error)
 }
 
 // A ProjectAnalyzer is responsible for analyzing a given path for Manifest and
@@ -149,6 +156,32 @@ type ProjectAnalyzer interface {
 	Info() ProjectAnalyzerInfo
 }
 
+// ContextProjectAnalyzer is a ProjectAnalyzer whose analysis can be cancelled,
+// or bounded in time, along with the rest of the work a SourceManager does.
+// gps calls DeriveManifestAndLockContext in preference to
+// DeriveManifestAndLock on analyzers that implement it.
+type ContextProjectAnalyzer interface {
+	ProjectAnalyzer
+
+	// DeriveManifestAndLockContext performs the same analysis as
+	// DeriveManifestAndLock, but gives up, returning ctx.Err(), if ctx is
+	// cancelled first.
+	DeriveManifestAndLockContext(ctx context.Context, path string, importRoot ProjectRoot) (Manifest, Lock, error)
+}
+
+// DeriveManifestAndLock runs an's analysis of the tree at path, with ctx if an
+// is a ContextProjectAnalyzer. An analyzer that is not can't be interrupted,
+// but isn't started if ctx is already done.
+func DeriveManifestAndLock(ctx context.Context, an ProjectAnalyzer, path string, importRoot ProjectRoot) (Manifest, Lock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if can, ok := an.(ContextProjectAnalyzer); ok {
+		return can.DeriveManifestAndLockContext(ctx, path, importRoot)
+	}
+	return an.DeriveManifestAndLock(path, importRoot)
+}
+
 // ProjectAnalyzerInfo indicates a ProjectAnalyzer's name and version.
 type ProjectAnalyzerInfo struct {
 	Name    string
@@ -171,6 +204,8 @@ type SourceMgr struct {
 	cancelAll   context.CancelFunc    // cancel func to kill all running work
 	deduceCoord *deductionCoordinator // subsystem that manages import path deduction
 	srcCoord    *sourceCoordinator    // subsystem that manages sources
+	checksums   *checksumVerifier     // verifier of versions against a checksum database, if any
+	provenance  bool                  // whether Provenance reports anything
 	sigmut      sync.Mutex            // mutex protecting signal handling setup/teardown
 	qch         chan struct{}         // quit chan for signal handler
 	relonce     sync.Once             // once-er to ensure we only release once
@@ -186,10 +221,130 @@ var ErrSourceManagerIsReleased = fmt.Errorf("this SourceManager has been release
 
 // SourceManagerConfig holds configuration information for creating SourceMgrs.
 type SourceManagerConfig struct {
-	CacheAge       time.Duration // Maximum valid age of cached data. <=0: Don't cache.
-	Cachedir       string        // Where to store local instances of upstream sources.
-	Logger         *log.Logger   // Optional info/warn logger. Discards if nil.
-	DisableLocking bool          // True if the SourceManager should NOT use a lock file to protect the Cachedir from multiple processes.
+	CacheAge          time.Duration            // Maximum valid age of cached data. <=0: Don't cache.
+	Cachedir          string                   // Where to store local instances of upstream sources.
+	Logger            *log.Logger              // Optional info/warn logger. Discards if nil.
+	DisableLocking    bool                     // True if the SourceManager should NOT use a lock file to protect the Cachedir from multiple processes.
+	FileDigests       bool                     // True if exported trees should include a per-file digest listing (see dirhash.FileDigestsName).
+	BackgroundRefresh bool                     // True if cached version lists should be returned immediately, then refreshed from upstream in the background.
+	VersionListTTL    time.Duration            // Maximum time a retrieved version list is treated as the latest. <=0: For the life of the SourceManager.
+	UpstreamTTL       time.Duration            // Maximum time a source is trusted to exist upstream once checked. <=0: For the life of the SourceManager.
+	CacheQuota        int64                    // Maximum bytes of sources to keep in Cachedir; least-recently-used sources are evicted to make room for new ones. <=0: Unlimited.
+	CallTimeouts      CallTimeouts             // Per-operation timeouts for work done on sources. Zero fields use the defaults.
+	SourceEvents      func(SourceEvent)        // Optional receiver of notable events, such as recovery from cache corruption. Events are also logged.
+	Mirrors           map[string][]string      // Mirror URLs for sources, keyed by source URL, to fail over to in order if a source's upstream cannot be reached. Only git sources support mirrors.
+	MemoryCacheLimit  int64                    // Approximate maximum bytes of manifests, locks and PackageTrees to cache in memory; least-recently-used ones are evicted. <=0: Unlimited.
+	SparseExports     bool                     // True if pruning unused packages from a git source should write out only the used packages' directories, and license files above them, in the first place.
+	NormalizeExports  bool                     // True if exported trees should have fixed file permissions and modification times, so that the same revision always produces an identical tree.
+	HardlinkExports   bool                     // True if exports may hard link files out of the cache rather than copy them, where the source supports it. Exported trees must then not be modified in place. Ignored with NormalizeExports.
+	NativeGit         bool                     // True if git sources should use a pure Go implementation of git rather than the git binary. Requires gps to be built with the gogit build tag.
+	SignatureKeyring  string                   // GnuPG home directory of the keys trusted to sign versions. If set, a version is only usable if its tag, or for branches and revisions its commit, has a good signature by one of them. Only git sources support signatures.
+	FetchRefspecs     map[string][]string      // Refspecs restricting what git sources fetch, keyed by source URL, e.g. "+refs/tags/*:refs/tags/*" for only tags, or "^refs/pull/*" to exclude refs. Versions that are not fetched are not listed. Not supported with NativeGit.
+	VersionFilters    map[string]VersionFilter // Filters on the branches and tags listed as versions of sources, keyed by source URL. Filtered out versions are never cached, nor seen by the solver.
+	VersionProvider   VersionProvider          // Optional supplier of versions of projects beyond those their sources list, such as curated release channels from a release database. Its versions are merged into those listed, and filtered along with them.
+	Registries        map[string]string        // Base URLs of Go module registries, such as Artifactory or Nexus Go repositories, keyed by the import path hosts whose projects they serve. Those projects are retrieved only from the registry, never upstream. Credentials may be given in the URLs.
+	Athens            *AthensProxy             // Optional Athens proxy to retrieve all projects through, other than those served by Registries or excluded from it. Versions in its catalog are listed as well as those it reports for each module.
+	ChecksumDB        *ChecksumDB              // Optional checksum database to verify the contents of versions against, through VerifyChecksum.
+	Policy            *Policy                  // Optional restrictions on the hosts, import paths and licenses of dependencies. Anything it disallows is refused with a *PolicyViolation.
+	AnalyzerSandbox   AnalyzerSandbox          // Optional sandbox to run ProjectAnalyzers in, confined, as they read the untrusted contents of dependencies' repositories.
+	NetworkAudit      io.Writer                // Optional log to write a NetworkOperation to, as a line of JSON, for each operation that reaches out over the network. If it is also an io.Closer, it is closed on release.
+	ProxyOnly         bool                     // True if upstreams may never be contacted directly: projects must be served by Registries or Athens, or be git sources with Mirrors, which are used in place of upstream. Anything else fails with a *DirectAccessError.
+	GitHubTokens      map[string]string        // API tokens for GitHub hosts, keyed by host, e.g. "github.com" or that of a GitHub Enterprise server. Git sources on those hosts list their versions through the API, within its rate limit, and with git if it runs out for too long.
+	RecordProvenance  bool                     // True if Provenance should report where versions were retrieved from, when they were committed and who tagged them. Otherwise, it reports nothing.
+	PinnedMirrors     map[ProjectRoot]string   // The mirrors or proxies that projects were last retrieved through, as reported by Mirror, keyed by project root. A pinned project is only ever retrieved through its pinned URL, never upstream nor any other mirror or proxy, so that it can't silently be retrieved from elsewhere.
+	MaxNetworkCalls   int                      // Maximum number of operations that reach out over the network, such as retrieving go get metadata, cloning, fetching and listing versions, to have in flight at once; others wait their turn. <=0: Unlimited.
+	Cassette          *Cassette                // Optional recording to record what is retrieved over the network into, or to replay in its place. Written out on release.
+	SharedCachedirs   []string                 // Optional read-only caches, laid out like Cachedir and shared by a team, e.g. on a network mount or baked into a CI image, checked in order for what Cachedir lacks. Git sources missing from Cachedir are cloned from the first copy of them in these, then brought up to date from upstream, rather than cloned from upstream. If CacheAge > 0, their cached data is read as well. They are never written to.
+
+	// RequiredSignatures are the projects whose versions are only usable if
+	// they have a good signature, whether or not SignatureKeyring is set,
+	// keyed by project root.
+	RequiredSignatures map[ProjectRoot]SignatureRequirement
+}
+
+// VersionFilter restricts which of a source's branches and tags are listed as
+// its versions, by name, such as to keep nightly or CI tags away from the
+// solver. Revisions are never filtered.
+type VersionFilter struct {
+	Allow *regexp.Regexp // If non-nil, only versions whose names match are listed.
+	Deny  *regexp.Regexp // If non-nil, versions whose names match are not listed.
+}
+
+// allows reports whether f lets through a branch or tag named name.
+func (f VersionFilter) allows(name string) bool {
+	if f.Allow != nil && !f.Allow.MatchString(name) {
+		return false
+	}
+	return f.Deny == nil || !f.Deny.MatchString(name)
+}
+
+// filter returns the versions in pvl that f lets through. pvl is returned as
+// is if f is the zero value.
+func (f VersionFilter) filter(pvl []PairedVersion) []PairedVersion {
+	if f.Allow == nil && f.Deny == nil {
+		return pvl
+	}
+	filtered := make([]PairedVersion, 0, len(pvl))
+	for _, pv := range pvl {
+		if pv.Type() == IsRevision || f.allows(pv.String()) {
+			filtered = append(filtered, pv)
+		}
+	}
+	return filtered
+}
+
+// VersionProvider supplies versions of the project root whose source is at the
+// URL source, in addition to those the source lists itself, such as branches
+// standing for release channels that an organization curates elsewhere. It is
+// called each time the source's versions are listed.
+//
+// Each version must be paired with a revision the source has. A version that
+// the source lists itself, by the same name and type, is listed as the source
+// has it instead. An error fails the listing of the source's versions.
+type VersionProvider func(ctx context.Context, root ProjectRoot, source string) ([]PairedVersion, error)
+
+// CallTimeouts bounds how long the SourceManager allows each kind of operation
+// on a source to run before abandoning it, so that a single hung operation
+// cannot stall everything else indefinitely.
+//
+// A zero value selects the default timeout for that kind of operation; a
+// negative value disables its timeout.
+type CallTimeouts struct {
+	HTTPMetadata       time.Duration // Retrieving go get metadata. Default: 1m.
+	SourcePing         time.Duration // Checking for upstream existence. Default: 2m.
+	SourceInit         time.Duration // Initially cloning a source into the cache. Default: 30m.
+	SourceFetch        time.Duration // Updating a source in the cache from upstream. Default: 10m.
+	ListVersions       time.Duration // Retrieving a source's version list. Default: 5m.
+	GetManifestAndLock time.Duration // Reading manifest and lock data. Default: 5m.
+	ListPackages       time.Duration // Parsing a PackageTree. Default: 5m.
+	ExportTree         time.Duration // Writing a code tree out to disk. Default: 10m.
+}
+
+// durations returns the effective timeout for each callType, omitting those
+// that have none.
+func (ct CallTimeouts) durations() map[callType]time.Duration {
+	durs := make(map[callType]time.Duration)
+	for _, t := range []struct {
+		typ      callType
+		val, def time.Duration
+	}{
+		{ctHTTPMetadata, ct.HTTPMetadata, time.Minute},
+		{ctSourcePing, ct.SourcePing, 2 * time.Minute},
+		{ctSourceInit, ct.SourceInit, 30 * time.Minute},
+		{ctSourceFetch, ct.SourceFetch, 10 * time.Minute},
+		{ctListVersions, ct.ListVersions, 5 * time.Minute},
+		{ctGetManifestAndLock, ct.GetManifestAndLock, 5 * time.Minute},
+		{ctListPackages, ct.ListPackages, 5 * time.Minute},
+		{ctExportTree, ct.ExportTree, 10 * time.Minute},
+	} {
+		switch {
+		case t.val > 0:
+			durs[t.typ] = t.val
+		case t.val == 0:
+			durs[t.typ] = t.def
+		}
+	}
+	return durs
 }
 
 // NewSourceManager produces an instance of gps's built-in SourceManager.
@@ -212,6 +367,55 @@ func NewSourceManager(c SourceManagerConfig) (*SourceMgr, error) {
 		c.Logger = log.New(ioutil.Discard, "", 0)
 	}
 
+	// Credentials, whether tokens or those in URLs, must never reach errors or
+	// logs, which may well end up somewhere public, such as a CI log.
+	var secrets, credURLs []string
+	for _, token := range c.GitHubTokens {
+		secrets = append(secrets, token)
+	}
+	for _, base := range c.Registries {
+		credURLs = append(credURLs, base)
+	}
+	for _, mirrors := range c.Mirrors {
+		credURLs = append(credURLs, mirrors...)
+	}
+	if c.Athens != nil {
+		credURLs = append(credURLs, c.Athens.URL)
+	}
+	if c.ChecksumDB != nil {
+		credURLs = append(credURLs, c.ChecksumDB.URL)
+	}
+	redact := newRedactor(secrets, credURLs)
+	c.Logger = log.New(redactingWriter{w: c.Logger.Writer(), r: redact}, c.Logger.Prefix(), c.Logger.Flags())
+
+	registries := make(map[string]*url.URL, len(c.Registries))
+	for host, base := range c.Registries {
+		u, err := url.Parse(base)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, errors.Errorf("invalid base URL %q for the registry serving %s", redact.redact(base), host)
+		}
+		registries[host] = u
+	}
+	var athens *athensProxy
+	if c.Athens != nil {
+		var err error
+		if athens, err = newAthensProxy(*c.Athens); err != nil {
+			return nil, err
+		}
+	}
+	for pr, req := range c.RequiredSignatures {
+		if req.Keyring == "" && c.SignatureKeyring == "" {
+			return nil, errors.Errorf("signatures of %s are required, but there is no keyring to verify them with", pr)
+		}
+	}
+	var checksums *checksumVerifier
+	if c.ChecksumDB != nil {
+		var err error
+		if checksums, err = newChecksumVerifier(*c.ChecksumDB); err != nil {
+			return nil, err
+		}
+	}
+
 	err := fs.EnsureDir(filepath.Join(c.Cachedir, "sources"), 0777)
 	if err != nil {
 		return nil, err
@@ -236,7 +440,7 @@ func NewSourceManager(c SourceManagerConfig) (*SourceMgr, error) {
 	if err != nil {
 		return nil, CouldNotCreateLockError{
 			Path: glpath,
-			Err:  errors.Wrapf(err, "unable to create lock %s", glpath),
+			Err:  wrapErrorf(err, "unable to create lock %s", glpath),
 		}
 	}
 
@@ -283,7 +487,7 @@ func NewSourceManager(c SourceManagerConfig) (*SourceMgr, error) {
 		} else {
 			return nil, CouldNotCreateLockError{
 				Path: glpath,
-				Err:  errors.Wrapf(err, "unable to lock %s", glpath),
+				Err:  wrapErrorf(err, "unable to lock %s", glpath),
 			}
 		}
 		err = lockfile.TryLock()
@@ -291,27 +495,97 @@ func NewSourceManager(c SourceManagerConfig) (*SourceMgr, error) {
 
 	ctx, cf := context.WithCancel(context.TODO())
 	superv := newSupervisor(ctx)
+	superv.timeouts = c.CallTimeouts.durations()
+	superv.redact = redact
+	if c.MaxNetworkCalls > 0 {
+		superv.netSlots = make(chan struct{}, c.MaxNetworkCalls)
+	}
+	if c.NetworkAudit != nil {
+		superv.audit = newNetworkAuditor(c.NetworkAudit)
+		superv.audit.redact = redact
+	}
+	superv.cassette = c.Cassette
+	if c.Cassette != nil {
+		c.Cassette.redact = redact
+	}
 	deducer := newDeductionCoordinator(superv)
+	deducer.registries = registries
+	deducer.athens = athens
+	deducer.policy = c.Policy
+	deducer.proxyOnly = c.ProxyOnly
+
+	mem := memoryCache{}
+	if c.MemoryCacheLimit > 0 {
+		mem.lru = newMemoryLRU(c.MemoryCacheLimit)
+	}
 
-	var sc sourceCache
+	var sc sourceCache = mem
 	if c.CacheAge > 0 {
 		// Try to open the BoltDB cache from disk.
 		epoch := time.Now().Add(-c.CacheAge).Unix()
 		boltCache, err := newBoltCache(c.Cachedir, epoch, c.Logger)
 		if err != nil {
-			c.Logger.Println(errors.Wrapf(err, "failed to open persistent cache %q", c.Cachedir))
+			c.Logger.Println(wrapErrorf(err, "failed to open persistent cache %q", c.Cachedir))
 		} else {
-			sc = newMultiCache(memoryCache{}, boltCache)
+			disk := tieredCache{boltCache}
+			for _, dir := range c.SharedCachedirs {
+				shared, err := openSharedBoltCache(dir, epoch, c.Logger)
+				if err != nil {
+					c.Logger.Println(wrapErrorf(err, "failed to open shared persistent cache %q", dir))
+				} else if shared != nil {
+					disk = append(disk, shared)
+				}
+			}
+			if len(disk) == 1 {
+				sc = newMultiCache(mem, boltCache)
+			} else {
+				sc = newMultiCache(mem, disk)
+			}
 		}
 	}
 
+	srcCoord := newSourceCoordinator(superv, deducer, c.Cachedir, sc, c.Logger)
+	srcCoord.fileDigests = c.FileDigests
+	srcCoord.sparseExports = c.SparseExports
+	srcCoord.normalizeExports = c.NormalizeExports
+	srcCoord.hardlinkExports = c.HardlinkExports
+	srcCoord.backgroundRefresh = c.BackgroundRefresh
+	srcCoord.events = c.SourceEvents
+	srcCoord.mirrors = c.Mirrors
+	srcCoord.nativeGit = c.NativeGit
+	srcCoord.fetchRefspecs = c.FetchRefspecs
+	srcCoord.keyring = c.SignatureKeyring
+	srcCoord.signatures = c.RequiredSignatures
+	srcCoord.versionFilters = c.VersionFilters
+	srcCoord.versionProvider = c.VersionProvider
+	srcCoord.policy = c.Policy
+	srcCoord.sandbox = c.AnalyzerSandbox
+	srcCoord.github = newGitHubAPI(c.GitHubTokens)
+	srcCoord.proxyOnly = c.ProxyOnly
+	srcCoord.sharedCachedirs = c.SharedCachedirs
+	srcCoord.pinnedMirrors = c.PinnedMirrors
+	if c.VersionListTTL > 0 || c.UpstreamTTL > 0 {
+		srcCoord.stateTTLs = map[sourceState]time.Duration{
+			sourceHasLatestVersionList: c.VersionListTTL,
+			sourceExistsUpstream:       c.UpstreamTTL,
+		}
+	}
+	if c.CacheAge > 0 {
+		// Source names are persisted subject to the same age limit as other
+		// cached data.
+		srcCoord.loadPersistedNames(time.Now().Add(-c.CacheAge))
+	}
+	srcCoord.trackUsage(c.CacheQuota)
+
 	sm := &SourceMgr{
 		cachedir:    c.Cachedir,
 		lf:          lockfile,
 		suprvsr:     superv,
 		cancelAll:   cf,
 		deduceCoord: deducer,
-		srcCoord:    newSourceCoordinator(superv, deducer, c.Cachedir, sc, c.Logger),
+		srcCoord:    srcCoord,
+		checksums:   checksums,
+		provenance:  c.RecordProvenance,
 		qch:         make(chan struct{}),
 	}
 
@@ -416,51 +690,110 @@ func (sm *SourceMgr) Release() {
 		sm.cancelAll()
 		sm.suprvsr.wait()
 
-		// Close the source coordinator.
-		sm.srcCoord.close()
+		sm.closeReleased()
+	})
+}
+
+// Shutdown releases the SourceManager, as with Release, but gives calls that
+// are already running until ctx is done to complete on their own. New calls to
+// the SourceManager's methods fail with ErrSourceManagerIsReleased as soon as
+// Shutdown begins.
+//
+// If ctx is done before running calls complete, they are canceled: any VCS
+// commands they are running are killed. Either way, Shutdown waits for all
+// calls to return before closing the cache and removing the lock file, so that
+// neither is left in an inconsistent state. ctx's error is returned if running
+// calls had to be canceled.
+//
+// Calling Shutdown on a SourceManager that has already been released does
+// nothing.
+func (sm *SourceMgr) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&sm.releasing, 1)
 
-		// Close the file handle for the lock file and remove it from disk
-		sm.lf.Unlock()
-		os.Remove(filepath.Join(sm.cachedir, "sm.lock"))
+	var err error
+	sm.relonce.Do(func() {
+		drained := make(chan struct{})
+		go func() {
+			sm.suprvsr.wait()
+			close(drained)
+		}()
 
-		// Close the qch, if non-nil, so the signal handlers run out. This will
-		// also deregister the sig channel, if any has been set up.
-		if sm.qch != nil {
-			close(sm.qch)
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+			sm.cancelAll()
+			<-drained
 		}
+
+		// Cancel and wait again, in case in-flight work kicked off any new
+		// calls after the running ones drained.
+		sm.cancelAll()
+		sm.suprvsr.wait()
+
+		sm.closeReleased()
 	})
+	return err
+}
+
+// closeReleased closes the source coordinator and lock file of a SourceMgr
+// that is being released, once all running calls have returned.
+func (sm *SourceMgr) closeReleased() {
+	// Close the source coordinator.
+	sm.srcCoord.close()
+
+	if sm.suprvsr.audit != nil {
+		sm.suprvsr.audit.close()
+	}
+	if sm.suprvsr.cassette != nil {
+		if err := sm.suprvsr.cassette.close(); err != nil {
+			sm.srcCoord.logger.Println(wrapError(err, "failed to write cassette"))
+		}
+	}
+
+	// Close the file handle for the lock file and remove it from disk
+	sm.lf.Unlock()
+	os.Remove(filepath.Join(sm.cachedir, "sm.lock"))
+
+	// Close the qch, if non-nil, so the signal handlers run out. This will
+	// also deregister the sig channel, if any has been set up.
+	if sm.qch != nil {
+		close(sm.qch)
+	}
 }
 
 // GetManifestAndLock returns manifest and lock information for the provided
 // ProjectIdentifier, at the provided Version. The work of producing the
 // manifest and lock is delegated to the provided ProjectAnalyzer's
 // DeriveManifestAndLock() method.
-func (sm *SourceMgr) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+func (sm *SourceMgr) GetManifestAndLock(ctx context.Context, id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return nil, nil, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return srcg.getManifestAndLock(context.TODO(), id.ProjectRoot, v, an)
+	return srcg.getManifestAndLock(ctx, id.ProjectRoot, v, an)
 }
 
 // ListPackages parses the tree of the Go packages at and below the ProjectRoot
 // of the given ProjectIdentifier, at the given version.
-func (sm *SourceMgr) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+func (sm *SourceMgr) ListPackages(ctx context.Context, id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return pkgtree.PackageTree{}, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		return pkgtree.PackageTree{}, err
 	}
 
-	return srcg.listPackages(context.TODO(), id.ProjectRoot, v)
+	return srcg.listPackages(ctx, id.ProjectRoot, v)
 }
 
 // ListVersions retrieves a list of the available versions for a given
@@ -475,49 +808,213 @@ func (sm *SourceMgr) ListPackages(id ProjectIdentifier, v Version) (pkgtree.Pack
 // calls will return a cached version of the first call's results. if upstream
 // is not accessible (network outage, access issues, or the resource actually
 // went away), an error will be returned.
-func (sm *SourceMgr) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+func (sm *SourceMgr) ListVersions(ctx context.Context, id ProjectIdentifier) ([]PairedVersion, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return nil, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		// TODO(sdboyer) More-er proper-er errors
 		return nil, err
 	}
 
-	return srcg.listVersions(context.TODO())
+	return srcg.listVersions(ctx)
+}
+
+// ListVersionsMatching retrieves the versions of the given project that satisfy
+// c, as ListVersions does, sorted in the order of preference the solver gives
+// them when upgrading: the first is the version that "dep ensure -update"
+// would choose, if nothing else constrained it.
+//
+// Unlike ListVersions, the list is the caller's own to modify.
+func (sm *SourceMgr) ListVersionsMatching(ctx context.Context, id ProjectIdentifier, c Constraint) ([]PairedVersion, error) {
+	pvl, err := sm.ListVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return matchingVersions(pvl, c), nil
+}
+
+// matchingVersions returns a new list of the versions in pvl that satisfy c,
+// sorted for upgrade.
+func matchingVersions(pvl []PairedVersion, c Constraint) []PairedVersion {
+	var matching []PairedVersion
+	for _, pv := range pvl {
+		if c.Matches(pv) {
+			matching = append(matching, pv)
+		}
+	}
+	SortPairedForUpgrade(matching)
+	return matching
+}
+
+// defaultBatchWorkers is the number of concurrent workers ListVersionsBatch
+// uses when none is specified.
+const defaultBatchWorkers = 8
+
+// VersionListResult is the outcome of listing versions for a single project as
+// part of a call to ListVersionsBatch.
+type VersionListResult struct {
+	ID       ProjectIdentifier
+	Versions []PairedVersion
+	Err      error
+}
+
+// ListVersionsBatch retrieves the version lists for each of the provided
+// projects, as with ListVersions, but with up to workers of them in flight at
+// any one time. A workers value <= 0 selects a reasonable default.
+//
+// If fn is non-nil, it is called with each result as soon as it is available,
+// so that callers can report partial results while slow sources are still
+// being worked on. Calls to fn are serialized.
+//
+// Results are returned in the same order as ids, regardless of the order in
+// which they completed. A failure for one project does not prevent the others
+// from being listed; the error is recorded in that project's result. If ctx is
+// canceled, projects not yet attempted fail with the context's error, which is
+// also returned.
+func (sm *SourceMgr) ListVersionsBatch(ctx context.Context, ids []ProjectIdentifier, workers int, fn func(VersionListResult)) ([]VersionListResult, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return nil, ErrSourceManagerIsReleased
+	}
+
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	if workers > len(ids) {
+		workers = len(ids)
+	}
+
+	results := make([]VersionListResult, len(ids))
+	work := make(chan int)
+	var fnmu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				res := VersionListResult{ID: ids[i]}
+				if res.Err = ctx.Err(); res.Err == nil {
+					pctx := sm.auditProject(ctx, ids[i].ProjectRoot)
+					var srcg *sourceGateway
+					if srcg, res.Err = sm.srcCoord.getSourceGatewayFor(pctx, ids[i]); res.Err == nil {
+						res.Versions, res.Err = srcg.listVersions(pctx)
+					}
+				}
+
+				results[i] = res
+				if fn != nil {
+					fnmu.Lock()
+					fn(res)
+					fnmu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range ids {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return results, ctx.Err()
+}
+
+// TagInfo describes a tag in a source, beyond the version and revision it
+// pairs.
+type TagInfo struct {
+	Name     string   // The name of the tag, as given by the version it pairs.
+	Revision Revision // The revision the tag refers to.
+	// Annotated is true if the tag is an annotated tag, with a tagger, date and
+	// annotation of its own, rather than a lightweight tag that merely names
+	// a revision.
+	Annotated bool
+	// Tagger identifies who created an annotated tag, such as
+	// "Jane Doe <jane@example.com>". Empty for lightweight tags.
+	Tagger string
+	// Date is when an annotated tag was created. For lightweight tags, it is
+	// the commit date of the revision tagged.
+	Date time.Time
+	// Annotation is the message of an annotated tag.
+	Annotation string
+}
+
+// ListTagInfo retrieves the metadata of the tags of the given repository: one
+// TagInfo for each tag among the versions ListVersions returns, in the same
+// order. Only git sources have tag metadata; the result is empty for others.
+//
+// Tag metadata is read from the local copy of the source, which is updated from
+// upstream first unless the metadata of every tag is already cached.
+func (sm *SourceMgr) ListTagInfo(ctx context.Context, id ProjectIdentifier) ([]TagInfo, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return nil, ErrSourceManagerIsReleased
+	}
+
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return srcg.listTagInfo(ctx)
+}
+
+// VerifySignature checks that the given version of the given repository has a
+// good signature by one of the keys in SourceManagerConfig.SignatureKeyring,
+// and returns the fingerprint of that key. For tags, it is the tag that must be
+// signed; for branches and revisions, the commit.
+//
+// Versions are checked in the same way before their manifests, locks, packages
+// and trees are served, so it is not necessary to call this first. If there is
+// no keyring, nothing is checked, and the fingerprint returned is empty.
+func (sm *SourceMgr) VerifySignature(ctx context.Context, id ProjectIdentifier, v Version) (string, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return "", ErrSourceManagerIsReleased
+	}
+
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	return srcg.verifySignature(ctx, v)
 }
 
 // RevisionPresentIn indicates whether the provided Revision is present in the given
 // repository.
-func (sm *SourceMgr) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
+func (sm *SourceMgr) RevisionPresentIn(ctx context.Context, id ProjectIdentifier, r Revision) (bool, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return false, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		// TODO(sdboyer) More-er proper-er errors
 		return false, err
 	}
 
-	return srcg.revisionPresentIn(context.TODO(), r)
+	return srcg.revisionPresentIn(ctx, r)
 }
 
 // SourceExists checks if a repository exists, either upstream or in the cache,
 // for the provided ProjectIdentifier.
-func (sm *SourceMgr) SourceExists(id ProjectIdentifier) (bool, error) {
+func (sm *SourceMgr) SourceExists(ctx context.Context, id ProjectIdentifier) (bool, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return false, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		return false, err
 	}
 
-	ctx := context.TODO()
 	if err := srcg.existsInCache(ctx); err == nil {
 		return true, nil
 	}
@@ -531,17 +1028,18 @@ func (sm *SourceMgr) SourceExists(id ProjectIdentifier) (bool, error) {
 // source are up to date with any network-acccesible information.
 //
 // The primary use case for this is prefetching.
-func (sm *SourceMgr) SyncSourceFor(id ProjectIdentifier) error {
+func (sm *SourceMgr) SyncSourceFor(ctx context.Context, id ProjectIdentifier) error {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	return srcg.syncLocal(context.TODO())
+	return srcg.syncLocal(ctx)
 }
 
 // ExportProject writes out the tree of the provided ProjectIdentifier's
@@ -551,10 +1049,14 @@ func (sm *SourceMgr) ExportProject(ctx context.Context, id ProjectIdentifier, v
 		return ErrSourceManagerIsReleased
 	}
 
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
 	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		return err
 	}
+	if err = srcg.checkRevision(ctx, id.ProjectRoot, v); err != nil {
+		return err
+	}
 
 	return srcg.exportVersionTo(ctx, v, to)
 }
@@ -566,14 +1068,31 @@ func (sm *SourceMgr) ExportPrunedProject(ctx context.Context, lp LockedProject,
 		return ErrSourceManagerIsReleased
 	}
 
+	ctx = sm.auditProject(ctx, lp.Ident().ProjectRoot)
 	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, lp.Ident())
 	if err != nil {
 		return err
 	}
+	if err = srcg.checkRevision(ctx, lp.Ident().ProjectRoot, lp.Version()); err != nil {
+		return err
+	}
 
 	return srcg.exportPrunedVersionTo(ctx, lp, prune, to)
 }
 
+func (sm *SourceMgr) normalizesExports() bool {
+	return sm.srcCoord.normalizeExports
+}
+
+// writeProject exports and prunes a project on behalf of WriteDepTree, as a
+// single supervised call. This has no timeout of its own, as it may need to
+// retrieve the source first; the calls it makes are subject to theirs.
+func (sm *SourceMgr) writeProject(ctx context.Context, lp LockedProject, prune PruneOptions, to string) error {
+	return sm.suprvsr.do(ctx, lp.Ident().normalizedSource(), ctWriteProject, func(ctx context.Context) error {
+		return sm.ExportPrunedProject(ctx, lp, prune, to)
+	})
+}
+
 // DeduceProjectRoot takes an import path and deduces the corresponding
 // project/source root.
 //
@@ -581,7 +1100,7 @@ func (sm *SourceMgr) ExportPrunedProject(ctx context.Context, lp LockedProject,
 // determine the root of the path, such as, but not limited to, vanity import
 // paths. (A special exception is written for gopkg.in to minimize network
 // activity, as its behavior is well-structured)
-func (sm *SourceMgr) DeduceProjectRoot(ip string) (ProjectRoot, error) {
+func (sm *SourceMgr) DeduceProjectRoot(ctx context.Context, ip string) (ProjectRoot, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return "", ErrSourceManagerIsReleased
 	}
@@ -592,23 +1111,24 @@ func (sm *SourceMgr) DeduceProjectRoot(ip string) (ProjectRoot, error) {
 		return "", errors.Errorf("%q is not a valid import path", ip)
 	}
 
-	pd, err := sm.deduceCoord.deduceRootPath(context.TODO(), ip)
-	return ProjectRoot(pd.root), err
+	ctx = sm.auditProject(ctx, ProjectRoot(ip))
+	pd, err := sm.deduceCoord.deduceRootPath(ctx, ip)
+	return ProjectRoot(pd.root), sm.suprvsr.redact.redactErr(err)
 }
 
 // InferConstraint tries to puzzle out what kind of version is given in a
 // string. Preference is given first for branches, then semver constraints, then
 // plain tags, and then revisions.
-func (sm *SourceMgr) InferConstraint(s string, pi ProjectIdentifier) (Constraint, error) {
+func (sm *SourceMgr) InferConstraint(ctx context.Context, s string, pi ProjectIdentifier) (Constraint, error) {
 	if s == "" {
 		return Any(), nil
 	}
 
 	// Lookup the string in the repository
 	var version PairedVersion
-	versions, err := sm.ListVersions(pi)
+	versions, err := sm.ListVersions(ctx, pi)
 	if err != nil {
-		return nil, errors.Wrapf(err, "list versions for %s", pi) // means repo does not exist
+		return nil, wrapErrorf(err, "list versions for %s", pi) // means repo does not exist
 	}
 	SortPairedForUpgrade(versions)
 	for _, v := range versions {
@@ -635,7 +1155,7 @@ func (sm *SourceMgr) InferConstraint(s string, pi ProjectIdentifier) (Constraint
 	}
 
 	// Revision, possibly abbreviated
-	r, err := sm.disambiguateRevision(context.TODO(), pi, Revision(s))
+	r, err := sm.disambiguateRevision(ctx, pi, Revision(s))
 	if err == nil {
 		return r, nil
 	}
@@ -646,8 +1166,9 @@ func (sm *SourceMgr) InferConstraint(s string, pi ProjectIdentifier) (Constraint
 // SourceURLsForPath takes an import path and deduces the set of source URLs
 // that may refer to a canonical upstream source.
 // In general, these URLs differ only by protocol (e.g. https vs. ssh), not path
-func (sm *SourceMgr) SourceURLsForPath(ip string) ([]*url.URL, error) {
-	deduced, err := sm.deduceCoord.deduceRootPath(context.TODO(), ip)
+func (sm *SourceMgr) SourceURLsForPath(ctx context.Context, ip string) ([]*url.URL, error) {
+	ctx = sm.auditProject(ctx, ProjectRoot(ip))
+	deduced, err := sm.deduceCoord.deduceRootPath(ctx, ip)
 	if err != nil {
 		return nil, err
 	}
@@ -655,6 +1176,137 @@ func (sm *SourceMgr) SourceURLsForPath(ip string) ([]*url.URL, error) {
 	return deduced.mb.possibleURLs(), nil
 }
 
+// Stats reports counts and latencies of the calls the SourceMgr has made to
+// do its work, by type of call, and for each source by type of call, including
+// how many were avoided by folding them into identical calls already in flight.
+// This is intended to help identify hotspots.
+func (sm *SourceMgr) Stats() SourceManagerStats {
+	return sm.suprvsr.snapshot()
+}
+
+// ResetStats reports what Stats would, and then starts the statistics afresh,
+// so that they can be reported for each phase of a longer operation, such as
+// solving and then writing out vendor.
+func (sm *SourceMgr) ResetStats() SourceManagerStats {
+	return sm.suprvsr.resetStats()
+}
+
+// SourceUsage reports the disk space used by each source in the cache
+// directory, and when each was last used, least recently used first.
+func (sm *SourceMgr) SourceUsage() ([]SourceUsage, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return nil, ErrSourceManagerIsReleased
+	}
+
+	return sm.srcCoord.usage.usage()
+}
+
+// DeductionResult describes a cached import path deduction: the project root
+// that was deduced, and the candidate URLs for its source.
+type DeductionResult struct {
+	Root ProjectRoot
+	URLs []*url.URL
+}
+
+// CachedDeductions lists the import path deductions that the SourceMgr has
+// completed and cached, sorted by root.
+func (sm *SourceMgr) CachedDeductions() ([]DeductionResult, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return nil, ErrSourceManagerIsReleased
+	}
+
+	pds := sm.deduceCoord.cachedDeductions()
+	drs := make([]DeductionResult, len(pds))
+	for i, pd := range pds {
+		drs[i] = DeductionResult{
+			Root: ProjectRoot(pd.root),
+			URLs: pd.mb.possibleURLs(),
+		}
+	}
+	return drs, nil
+}
+
+// DeductionExplanation describes how a SourceMgr deduced the project root and
+// sources of an import path, as reported by SourceMgr.ExplainDeduction.
+type DeductionExplanation struct {
+	ImportPath string
+	DeductionResult
+
+	// Deducer is what deduced the root, such as "known path rules for
+	// github.com", "VCS extension in path" or "go-get metadata".
+	Deducer string
+
+	// Cached is whether the deduction had already been made, for this or
+	// another import path beneath the root, and so was answered from memory.
+	Cached bool
+
+	// Network is whether making the deduction took requests over the network,
+	// whether now or, if Cached, when it was first made.
+	Network bool
+}
+
+// ExplainDeduction deduces the project root of an import path, as
+// DeduceProjectRoot does, and explains how it was deduced. This is meant for
+// finding out why an import path is retrieved from where it is.
+func (sm *SourceMgr) ExplainDeduction(ctx context.Context, ip string) (DeductionExplanation, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return DeductionExplanation{}, ErrSourceManagerIsReleased
+	}
+	if !pathvld.MatchString(ip) {
+		return DeductionExplanation{}, errors.Errorf("%q is not a valid import path", ip)
+	}
+
+	ctx = sm.auditProject(ctx, ProjectRoot(ip))
+	pd, cached, err := sm.deduceCoord.explain(ctx, ip)
+	if err != nil {
+		return DeductionExplanation{}, sm.suprvsr.redact.redactErr(err)
+	}
+	return DeductionExplanation{
+		ImportPath: ip,
+		DeductionResult: DeductionResult{
+			Root: ProjectRoot(pd.root),
+			URLs: pd.mb.possibleURLs(),
+		},
+		Deducer: sm.suprvsr.redact.redact(pd.how.by),
+		Cached:  cached,
+		Network: pd.how.network,
+	}, nil
+}
+
+// InvalidateDeductions discards any cached import path deductions for roots
+// equal to or beneath the given import path prefix, as well as for any root
+// that contains it. Subsequent operations on affected paths will perform
+// deduction again, which may involve network activity.
+//
+// This is useful to recover from stale results, such as a vanity import path
+// whose go-get metadata has since been changed to point elsewhere.
+func (sm *SourceMgr) InvalidateDeductions(prefix string) error {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return ErrSourceManagerIsReleased
+	}
+
+	if prefix == "" {
+		return errors.New("cannot invalidate deductions for an empty import path prefix; use PurgeDeductions")
+	}
+
+	for _, root := range sm.deduceCoord.invalidate(prefix) {
+		sm.srcCoord.forgetNames(root)
+	}
+	sm.srcCoord.forgetNames(prefix)
+	return nil
+}
+
+// PurgeDeductions discards all cached import path deductions.
+func (sm *SourceMgr) PurgeDeductions() error {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return ErrSourceManagerIsReleased
+	}
+
+	sm.deduceCoord.purge()
+	sm.srcCoord.forgetNames("")
+	return nil
+}
+
 // disambiguateRevision looks up a revision in the underlying source, spitting
 // it back out in an unabbreviated, disambiguated form.
 //
@@ -662,7 +1314,8 @@ func (sm *SourceMgr) SourceURLsForPath(ip string) ([]*url.URL, error) {
 // abbreviated git commit hash. disambiguateRevision would return the complete
 // hash.
 func (sm *SourceMgr) disambiguateRevision(ctx context.Context, pi ProjectIdentifier, rev Revision) (Revision, error) {
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), pi)
+	ctx = sm.auditProject(ctx, pi.ProjectRoot)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, pi)
 	if err != nil {
 		return "", err
 	}
@@ -680,11 +1333,18 @@ type durCount struct {
 }
 
 type supervisor struct {
-	ctx     context.Context
-	mu      sync.Mutex // Guards all maps
-	cond    sync.Cond  // Wraps mu so callers can wait until all calls end
-	running map[callInfo]timeCount
-	ran     map[callType]durCount
+	ctx      context.Context
+	mu       sync.Mutex // Guards all maps
+	cond     sync.Cond  // Wraps mu so callers can wait until all calls end
+	running  map[callInfo]timeCount
+	ran      map[callType]durCount
+	timeouts map[callType]time.Duration  // Read-only once calls begin; types without an entry have no timeout
+	stats    map[callStatsKey]*callStats // Call statistics; guarded by mu
+	folds    int                         // Folded source setups; guarded by mu
+	audit    *networkAuditor             // If non-nil, records the network operations that calls do
+	cassette *Cassette                   // If non-nil, records or replays what calls retrieve over the network
+	redact   *redactor                   // Scrubs credentials from the errors of calls
+	netSlots chan struct{}               // If non-nil, holds a token for each network call in flight, up to its capacity
 }
 
 func newSupervisor(ctx context.Context) *supervisor {
@@ -702,6 +1362,12 @@ func newSupervisor(ctx context.Context) *supervisor {
 // counters to ensure the sourceMgr can't finish Release()ing until after all
 // calls have returned.
 func (sup *supervisor) do(inctx context.Context, name string, typ callType, f func(context.Context) error) error {
+	return sup.doFor(inctx, "", name, typ, f)
+}
+
+// doFor is do for a call made on behalf of the source with the upstream URL
+// source, which the call's statistics are also kept under.
+func (sup *supervisor) doFor(inctx context.Context, source, name string, typ callType, f func(context.Context) error) error {
 	ci := callInfo{
 		name: name,
 		typ:  typ,
@@ -713,10 +1379,39 @@ func (sup *supervisor) do(inctx context.Context, name string, typ callType, f fu
 	}
 
 	cctx, cancelFunc := constext.Cons(inctx, octx)
+	if sup.audit != nil {
+		cctx = context.WithValue(cctx, auditCallKey{}, auditCall{a: sup.audit, typ: typ})
+	}
+	if sup.cassette != nil {
+		cctx = context.WithValue(cctx, cassetteKey{}, sup.cassette)
+	}
+	// Waiting for a turn on the network doesn't count against the timeout.
+	if sup.netSlots != nil && typ.usesNetwork() {
+		select {
+		case sup.netSlots <- struct{}{}:
+			defer func() { <-sup.netSlots }()
+		case <-cctx.Done():
+			sup.done(ci)
+			cancelFunc()
+			return cctx.Err()
+		}
+	}
+	timeout, hasTimeout := sup.timeouts[typ]
+	if hasTimeout {
+		var cancelTimeout context.CancelFunc
+		cctx, cancelTimeout = context.WithTimeout(cctx, timeout)
+		defer cancelTimeout()
+	}
+
+	start := time.Now()
 	err = f(cctx)
+	sup.record(typ, source, time.Since(start), err)
+	if hasTimeout && err != nil && cctx.Err() == context.DeadlineExceeded {
+		err = wrapErrorf(err, "%s for %s timed out after %s", typ, name, timeout)
+	}
 	sup.done(ci)
 	cancelFunc()
-	return err
+	return sup.redact.redactErr(err)
 }
 
 func (sup *supervisor) start(ci callInfo) (context.Context, error) {
@@ -798,6 +1493,12 @@ const (
 	ctSourceFetch
 	ctExportTree
 	ctValidateLocal
+	ctBackgroundRefresh
+	ctWriteProject
+	ctVerifySignature
+	ctVerifyChecksum
+	ctCheckLicense
+	ctProvenance
 )
 
 func (ct callType) String() string {
@@ -818,11 +1519,35 @@ func (ct callType) String() string {
 		return "Fetching latest data into local source cache"
 	case ctExportTree:
 		return "Writing code tree out to disk"
+	case ctValidateLocal:
+		return "Validating local source cache"
+	case ctBackgroundRefresh:
+		return "Refreshing version list in the background"
+	case ctWriteProject:
+		return "Writing project into dependency tree"
+	case ctVerifySignature:
+		return "Verifying signature"
+	case ctVerifyChecksum:
+		return "Verifying checksum"
+	case ctCheckLicense:
+		return "Checking licenses"
+	case ctProvenance:
+		return "Reading provenance"
 	default:
 		panic("unknown calltype")
 	}
 }
 
+// usesNetwork reports whether calls of type ct reach out over the network,
+// without making any other calls of their own.
+func (ct callType) usesNetwork() bool {
+	switch ct {
+	case ctHTTPMetadata, ctListVersions, ctSourcePing, ctSourceInit, ctSourceFetch:
+		return true
+	}
+	return false
+}
+
 // callInfo provides metadata about an ongoing call.
 type callInfo struct {
 	name string
@@ -5,6 +5,7 @@
 package gps
 
 import (
+	"context"
 	"log"
 	"reflect"
 	"testing"
@@ -98,7 +99,7 @@ func TestSourceManager_InferConstraint(t *testing.T) {
 			})
 			h.Must(err)
 
-			got, err := sm.InferConstraint(tc.str, tc.project)
+			got, err := sm.InferConstraint(context.Background(), tc.str, tc.project)
 			h.Must(err)
 
 			wantT := reflect.TypeOf(tc.want)
@@ -0,0 +1,148 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sourceNamesFilename is the name of the file, within the cache directory, in
+// which the mapping from source names to successfully set up sources is
+// persisted between runs.
+const sourceNamesFilename = "source-names-v1.json"
+
+// persistedSource records a maybeSource that was successfully set up for a
+// source name, in enough detail to set it up again without deduction.
+type persistedSource struct {
+	Type      string    `json:"type"` // One of "git", "gopkg.in", "bzr", "hg" or "svn"
+	URL       string    `json:"url"`
+	OPath     string    `json:"opath,omitempty"` // gopkg.in only
+	Major     uint64    `json:"major,omitempty"` // gopkg.in only
+	Unstable  bool      `json:"unstable,omitempty"`
+	Time      time.Time `json:"time"`                // When the source was last set up
+	MovedFrom string    `json:"movedFrom,omitempty"` // If upstream moved to URL, the URL it moved from
+}
+
+// newPersistedSource converts m to a persistedSource. It returns false if m is
+// of a type that cannot be persisted.
+func newPersistedSource(m maybeSource) (persistedSource, bool) {
+	switch tm := m.(type) {
+	case maybeGitSource:
+		return persistedSource{Type: "git", URL: tm.url.String()}, true
+	case maybeGopkginSource:
+		return persistedSource{
+			Type:     "gopkg.in",
+			URL:      tm.url.String(),
+			OPath:    tm.opath,
+			Major:    tm.major,
+			Unstable: tm.unstable,
+		}, true
+	case maybeBzrSource:
+		return persistedSource{Type: "bzr", URL: tm.url.String()}, true
+	case maybeHgSource:
+		return persistedSource{Type: "hg", URL: tm.url.String()}, true
+	case maybeSvnSource:
+		return persistedSource{Type: "svn", URL: tm.url.String()}, true
+	}
+	return persistedSource{}, false
+}
+
+// maybeSource reconstructs the maybeSource recorded by ps.
+func (ps persistedSource) maybeSource() (maybeSource, error) {
+	u, err := url.Parse(ps.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ps.Type {
+	case "git":
+		return maybeGitSource{url: u}, nil
+	case "gopkg.in":
+		if ps.OPath == "" {
+			return nil, errors.New("gopkg.in source is missing its original path")
+		}
+		return maybeGopkginSource{opath: ps.OPath, url: u, major: ps.Major, unstable: ps.Unstable}, nil
+	case "bzr":
+		return maybeBzrSource{url: u}, nil
+	case "hg":
+		return maybeHgSource{url: u}, nil
+	case "svn":
+		return maybeSvnSource{url: u}, nil
+	}
+	return nil, errors.Errorf("unknown source type %q", ps.Type)
+}
+
+// validPersistedSource reconstructs the maybeSource recorded by ps, provided
+// that it is usable: its source must still be present in the cache directory,
+// as otherwise nothing is saved by skipping deduction. The exception is a
+// source whose upstream has moved, as deduction would lead back to the old URL.
+func validPersistedSource(ps persistedSource, cachedir string) (maybeSource, bool) {
+	m, err := ps.maybeSource()
+	if err != nil {
+		return nil, false
+	}
+	if ps.MovedFrom != "" {
+		return m, true
+	}
+
+	if fi, err := os.Stat(maybeSourceCachePath(cachedir, m)); err != nil || !fi.IsDir() {
+		return nil, false
+	}
+	return m, true
+}
+
+// loadSourceNames reads the persisted source names from the cache directory,
+// discarding any entries that were last set up before epoch or that are no
+// longer valid. A missing file is not an error.
+func loadSourceNames(cachedir string, epoch time.Time) (map[string]persistedSource, error) {
+	b, err := ioutil.ReadFile(filepath.Join(cachedir, sourceNamesFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]persistedSource
+	if err = json.Unmarshal(b, &all); err != nil {
+		return nil, wrapErrorf(err, "failed to parse %s", sourceNamesFilename)
+	}
+
+	names := make(map[string]persistedSource, len(all))
+	for name, ps := range all {
+		if ps.Time.Before(epoch) {
+			continue
+		}
+		if _, ok := validPersistedSource(ps, cachedir); ok {
+			names[name] = ps
+		}
+	}
+	return names, nil
+}
+
+// writeSourceNames persists names to the cache directory, replacing any
+// previously persisted names.
+func writeSourceNames(cachedir string, names map[string]persistedSource) error {
+	b, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a concurrent reader never sees
+	// a partial file.
+	path := filepath.Join(cachedir, sourceNamesFilename)
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestPersistedSourceRoundTrip(t *testing.T) {
+	for _, m := range []maybeSource{
+		maybeGitSource{url: mkurl("https://github.com/sdboyer/gps")},
+		maybeGopkginSource{opath: "gopkg.in/yaml.v2", url: mkurl("https://github.com/go-yaml/yaml"), major: 2},
+		maybeGopkginSource{opath: "gopkg.in/sdboyer/gps.v1-unstable", url: mkurl("https://github.com/sdboyer/gps"), major: 1, unstable: true},
+		maybeBzrSource{url: mkurl("https://launchpad.net/govcstestbzrrepo")},
+		maybeHgSource{url: mkurl("https://bitbucket.org/golang-dep/dep-test")},
+		maybeSvnSource{url: mkurl("https://example.com/svn/repo")},
+	} {
+		ps, ok := newPersistedSource(m)
+		if !ok {
+			t.Errorf("expected %s to be persistable", m)
+			continue
+		}
+		got, err := ps.maybeSource()
+		if err != nil {
+			t.Errorf("unexpected error reconstructing %s: %s", m, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("maybeSource did not survive persistence:\n\t(GOT): %#v\n\t(WNT): %#v", got, m)
+		}
+	}
+
+	if _, err := (persistedSource{Type: "darcs", URL: "https://example.com/repo"}).maybeSource(); err == nil {
+		t.Error("expected an error for an unknown source type")
+	}
+}
+
+func TestLoadSourceNames(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	cachedir := h.Path("cache")
+
+	// No file yet is fine.
+	names, err := loadSourceNames(cachedir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("expected no names without a persisted file, got %v", names)
+	}
+
+	now := time.Now()
+	present := persistedSource{Type: "git", URL: "https://github.com/sdboyer/gps", Time: now}
+	h.TempDir("cache/sources/https---github.com-sdboyer-gps")
+	all := map[string]persistedSource{
+		"github.com/sdboyer/gps": present,
+		// Not present in the cache directory.
+		"github.com/sdboyer/deptest": {Type: "git", URL: "https://github.com/sdboyer/deptest", Time: now},
+		// Too old.
+		"github.com/sdboyer/old": {Type: "git", URL: "https://github.com/sdboyer/gps", Time: now.Add(-2 * time.Hour)},
+		// Not present in the cache directory, but moved upstream.
+		"github.com/sdboyer/moved": {Type: "git", URL: "https://github.com/sdboyer/newname", MovedFrom: "https://github.com/sdboyer/moved", Time: now},
+		// Garbage.
+		"github.com/sdboyer/bad": {Type: "cvs", URL: "https://github.com/sdboyer/gps", Time: now},
+	}
+	if err = writeSourceNames(cachedir, all); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err = loadSourceNames(cachedir, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected only the valid, recent names to be loaded, got %v", names)
+	}
+	if _, has := names["github.com/sdboyer/moved"]; !has {
+		t.Error("expected a moved source to be loaded though it is not yet in the cache directory")
+	}
+	got := names["github.com/sdboyer/gps"]
+	if !got.Time.Equal(present.Time) {
+		t.Errorf("unexpected time after load: %s, wanted %s", got.Time, present.Time)
+	}
+	got.Time = present.Time
+	if got != present {
+		t.Errorf("unexpected persisted source after load:\n\t(GOT): %v\n\t(WNT): %v", got, present)
+	}
+
+	h.TempFile("cache/"+sourceNamesFilename, "not json")
+	if _, err = loadSourceNames(cachedir, time.Time{}); err == nil {
+		t.Error("expected an error for a corrupt file")
+	}
+}
+
+func TestSourceCoordinatorPersistsNames(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	cachedir := h.Path("cache")
+	h.TempDir("cache/sources/https---github.com-sdboyer-gps")
+
+	sc := newSourceCoordinator(newSupervisor(context.Background()), nil, cachedir, nil, log.New(ioutil.Discard, "", 0))
+	sc.loadPersistedNames(time.Time{})
+	sc.persisted["github.com/sdboyer/gps"] = persistedSource{Type: "git", URL: "https://github.com/sdboyer/gps", Time: time.Now()}
+	sc.persistedDirty = true
+
+	if m, ok := sc.persistedSourceFor("github.com/sdboyer/gps"); !ok {
+		t.Error("expected a persisted source")
+	} else if m.URL().String() != "https://github.com/sdboyer/gps" {
+		t.Errorf("unexpected persisted source %s", m)
+	}
+
+	sc.close()
+	h.MustExist(h.Path("cache/" + sourceNamesFilename))
+
+	sc = newSourceCoordinator(newSupervisor(context.Background()), nil, cachedir, nil, log.New(ioutil.Discard, "", 0))
+	sc.loadPersistedNames(time.Time{})
+	if _, ok := sc.persistedSourceFor("github.com/sdboyer/gps"); !ok {
+		t.Fatal("expected the persisted source to be loaded in a new coordinator")
+	}
+
+	sc.forgetNames("github.com/sdboyer/gps/foo")
+	if _, ok := sc.persistedSourceFor("github.com/sdboyer/gps"); ok {
+		t.Error("expected the persisted source to be forgotten")
+	}
+	sc.close()
+
+	names, err := loadSourceNames(cachedir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("expected forgotten names to be dropped from disk, got %v", names)
+	}
+	if _, err := os.Stat(filepath.Join(cachedir, sourceNamesFilename+".tmp")); !os.IsNotExist(err) {
+		t.Error("expected no temporary file to be left behind")
+	}
+}
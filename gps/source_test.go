@@ -6,12 +6,18 @@ package gps
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/golang/dep/gps/pkgtree"
 	"github.com/golang/dep/internal/test"
@@ -189,3 +195,567 @@ func testSourceGateway(t *testing.T) {
 	t.Run("empty", do(sourceExistsUpstream|sourceHasLatestVersionList))
 	t.Run("exists", do(sourceExistsLocally))
 }
+
+func TestSourceGatewayConcurrentCacheReads(t *testing.T) {
+	rev := Revision("c575196502940c07bf89fd6d95e83a999bb78ad6")
+	pr := ProjectRoot("github.com/example/proj")
+	v := NewVersion("v1.0.0").Pair(rev)
+
+	sg := &sourceGateway{
+		srcState: sourceExistsUpstream | sourceExistsLocally | sourceHasLatestVersionList,
+		src:      &versionListSource{},
+		cache:    newMemoryCache(),
+		suprvsr:  newSupervisor(context.Background()),
+	}
+	sg.cache.setVersionMap([]PairedVersion{v})
+	sg.cache.setManifestAndLock(rev, naiveAnalyzer{}.Info(), &simpleRootManifest{}, nil)
+	sg.cache.setPackageTree(rev, pkgtree.PackageTree{ImportRoot: string(pr)})
+
+	// Hold a read lock for the duration; all of the cache hits below must be
+	// able to proceed alongside it, rather than waiting on the write lock.
+	sg.mu.RLock()
+	defer sg.mu.RUnlock()
+
+	done := make(chan error)
+	go func() {
+		ctx := context.Background()
+		if _, _, err := sg.getManifestAndLock(ctx, pr, v.Unpair(), naiveAnalyzer{}); err != nil {
+			done <- err
+			return
+		}
+		if _, err := sg.listPackages(ctx, pr, v); err != nil {
+			done <- err
+			return
+		}
+		if _, err := sg.listVersions(ctx); err != nil {
+			done <- err
+			return
+		}
+		if present, err := sg.revisionPresentIn(ctx, rev); err != nil || !present {
+			done <- fmt.Errorf("expected revision to be present, got %v, %v", present, err)
+			return
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cache hits blocked on a held read lock")
+	}
+
+	// Each of the calls answered from the cache is counted as such.
+	stats := sg.suprvsr.snapshot()
+	if len(stats.Calls) != 3 {
+		t.Fatalf("expected stats for 3 call types, got %v", stats.Calls)
+	}
+	for _, cs := range stats.Calls {
+		if cs.Issued != 0 || cs.Cached != 1 {
+			t.Errorf("expected a single cache hit for %s, got %+v", cs.Type, cs)
+		}
+	}
+	if len(stats.Sources) != 1 || stats.Sources[0].URL != sg.src.upstreamURL() || len(stats.Sources[0].Calls) != 3 {
+		t.Errorf("expected the cache hits to be counted for %s, got %+v", sg.src.upstreamURL(), stats.Sources)
+	}
+}
+
+// versionListSource is a source that can do little more than list versions,
+// signaling on listed (if non-nil) each time it does so, and report on which
+// revisions are present.
+type versionListSource struct {
+	pvs     []PairedVersion
+	listed  chan struct{}
+	present map[Revision]bool
+	fetches int
+}
+
+func (s *versionListSource) existsLocally(context.Context) bool  { return true }
+func (s *versionListSource) existsUpstream(context.Context) bool { return true }
+func (s *versionListSource) upstreamURL() string                 { return "example.com/versionlist" }
+func (s *versionListSource) initLocal(context.Context) error     { return nil }
+func (s *versionListSource) updateLocal(context.Context) error   { s.fetches++; return nil }
+func (s *versionListSource) maybeClean(context.Context) error    { return nil }
+func (s *versionListSource) sourceType() string                  { return "versionlist" }
+func (s *versionListSource) existsCallsListVersions() bool       { return false }
+func (s *versionListSource) listVersionsRequiresLocal() bool     { return false }
+
+func (s *versionListSource) listVersions(context.Context) ([]PairedVersion, error) {
+	if s.listed != nil {
+		s.listed <- struct{}{}
+	}
+	return s.pvs, nil
+}
+
+func (s *versionListSource) getManifestAndLock(context.Context, ProjectRoot, Revision, ProjectAnalyzer) (Manifest, Lock, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+func (s *versionListSource) listPackages(context.Context, ProjectRoot, Revision) (pkgtree.PackageTree, error) {
+	return pkgtree.PackageTree{}, errors.New("not implemented")
+}
+
+func (s *versionListSource) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	return s.present[r], nil
+}
+
+func (s *versionListSource) disambiguateRevision(_ context.Context, r Revision) (Revision, error) {
+	return r, nil
+}
+
+func (s *versionListSource) exportRevisionTo(context.Context, Revision, string) error {
+	return errors.New("not implemented")
+}
+
+func TestSourceGatewayBackgroundRefresh(t *testing.T) {
+	old := []PairedVersion{NewVersion("v1.0.0").Pair("c575196502940c07bf89fd6d95e83a999bb78ad6")}
+	latest := append(old, NewVersion("v1.1.0").Pair("5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := &versionListSource{pvs: latest, listed: make(chan struct{}, 1)}
+	sg := &sourceGateway{
+		srcState:          sourceExistsUpstream | sourceExistsLocally,
+		src:               src,
+		cache:             newMemoryCache(),
+		suprvsr:           newSupervisor(ctx),
+		backgroundRefresh: true,
+	}
+	sg.cache.setVersionMap(old)
+
+	pvs, err := sg.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvs) != len(old) {
+		t.Fatalf("expected the cached version list to be served first, got %v", pvs)
+	}
+
+	select {
+	case <-src.listed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("version list was not refreshed in the background")
+	}
+
+	// Wait for the refresh to finish with the gateway.
+	sg.mu.Lock()
+	state := sg.srcState
+	sg.mu.Unlock()
+	if state&sourceHasLatestVersionList == 0 {
+		t.Error("expected gateway to have the latest version list after refresh")
+	}
+
+	pvs, err = sg.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvs) != len(latest) {
+		t.Errorf("expected the refreshed version list, got %v", pvs)
+	}
+
+	select {
+	case <-src.listed:
+		t.Error("did not expect another refresh once the latest version list was loaded")
+	default:
+	}
+}
+
+func TestSourceGatewayVersionFilter(t *testing.T) {
+	rev := Revision("c575196502940c07bf89fd6d95e83a999bb78ad6")
+	all := []PairedVersion{
+		NewVersion("v1.0.0").Pair(rev),
+		NewVersion("nightly-20170101").Pair(rev),
+		NewVersion("ci-1234").Pair(rev),
+		NewBranch("master").Pair(rev),
+		NewBranch("ci-scratch").Pair(rev),
+	}
+
+	ctx := context.Background()
+	sg := &sourceGateway{
+		srcState: sourceExistsUpstream | sourceExistsLocally,
+		src:      &versionListSource{pvs: all},
+		cache:    newMemoryCache(),
+		suprvsr:  newSupervisor(ctx),
+		versionFilter: VersionFilter{
+			Allow: regexp.MustCompile(`^(v|master$|nightly-)`),
+			Deny:  regexp.MustCompile(`^(nightly|ci)-`),
+		},
+	}
+
+	pvs, err := sg.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, pv := range pvs {
+		got = append(got, pv.String())
+	}
+	sort.Strings(got)
+	if want := []string{"master", "v1.0.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected versions %v, got %v", want, got)
+	}
+
+	// Filtered out versions must not have been cached, either.
+	if _, has := sg.cache.getRevisionFor(NewVersion("nightly-20170101")); has {
+		t.Error("expected filtered out tag not to be cached")
+	}
+	if _, has := sg.cache.getRevisionFor(NewBranch("master")); !has {
+		t.Error("expected allowed branch to be cached")
+	}
+}
+
+func TestSourceGatewayVersionProvider(t *testing.T) {
+	rev := Revision("c575196502940c07bf89fd6d95e83a999bb78ad6")
+	rev2 := Revision("5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e")
+	listed := []PairedVersion{
+		NewVersion("v1.0.0").Pair(rev),
+		NewBranch("master").Pair(rev2),
+	}
+	u, err := url.Parse("https://github.com/sdboyer/deptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	var gotRoot ProjectRoot
+	var gotSource string
+	var fail error
+	sg := &sourceGateway{
+		srcState: sourceExistsUpstream | sourceExistsLocally,
+		src:      &versionListSource{pvs: listed},
+		maybe:    maybeGitSource{url: u},
+		cache:    newMemoryCache(),
+		suprvsr:  newSupervisor(ctx),
+		versionFilter: VersionFilter{
+			Deny: regexp.MustCompile(`^ci-`),
+		},
+		projectRoot: "github.com/sdboyer/deptest",
+		versionProvider: func(ctx context.Context, root ProjectRoot, source string) ([]PairedVersion, error) {
+			gotRoot, gotSource = root, source
+			return []PairedVersion{
+				NewBranch("stable").Pair(rev),
+				NewVersion("v1.0.0").Pair(rev2),
+				NewBranch("ci-channel").Pair(rev2),
+			}, fail
+		},
+	}
+
+	pvs, err := sg.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotRoot != "github.com/sdboyer/deptest" || gotSource != u.String() {
+		t.Errorf("expected the provider to be asked for the project and its source, got %q, %q", gotRoot, gotSource)
+	}
+	got := make(map[string]Revision)
+	for _, pv := range pvs {
+		got[pv.String()] = pv.Revision()
+	}
+	want := map[string]Revision{"v1.0.0": rev, "master": rev2, "stable": rev}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected versions %v, got %v", want, got)
+	}
+	if r, has := sg.cache.getRevisionFor(NewBranch("stable")); !has || r != rev {
+		t.Error("expected provided branch to be cached")
+	}
+
+	fail = errors.New("release database unavailable")
+	sg.srcState &^= sourceHasLatestVersionList
+	sg.cache = newMemoryCache()
+	if _, err = sg.listVersions(ctx); err == nil {
+		t.Error("expected the provider's failure to fail listing versions")
+	}
+}
+
+func TestSourceGatewayRecurateVersions(t *testing.T) {
+	rev := Revision("c575196502940c07bf89fd6d95e83a999bb78ad6")
+	ctx := context.Background()
+	sg := &sourceGateway{
+		srcState: sourceExistsUpstream | sourceHasLatestVersionList,
+		src:      &versionListSource{},
+		cache:    newMemoryCache(),
+		suprvsr:  newSupervisor(ctx),
+		versionFilter: VersionFilter{
+			Deny: regexp.MustCompile(`^ci-`),
+		},
+	}
+	// As cached while checking that the source exists upstream, before the
+	// filter was set.
+	sg.cache.setVersionMap([]PairedVersion{
+		NewVersion("v1.0.0").Pair(rev),
+		NewVersion("ci-1234").Pair(rev),
+	})
+
+	sg.recurateVersions(ctx)
+	pvs, err := sg.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvs) != 1 || pvs[0].String() != "v1.0.0" {
+		t.Errorf("expected the cached version list to have been filtered, got %v", pvs)
+	}
+}
+
+func TestSourceGatewayStateTTL(t *testing.T) {
+	old := []PairedVersion{NewVersion("v1.0.0").Pair("c575196502940c07bf89fd6d95e83a999bb78ad6")}
+	latest := append(old, NewVersion("v1.1.0").Pair("5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := &versionListSource{pvs: latest, listed: make(chan struct{}, 1)}
+	sg := &sourceGateway{
+		srcState: sourceExistsLocally,
+		src:      src,
+		cache:    newMemoryCache(),
+		suprvsr:  newSupervisor(ctx),
+		stateTTLs: map[sourceState]time.Duration{
+			sourceHasLatestVersionList: time.Hour,
+		},
+	}
+	sg.cache.setVersionMap(old)
+	sg.addState(sourceExistsUpstream | sourceHasLatestVersionList)
+
+	// Still within the TTL, so the cached list is served.
+	pvs, err := sg.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvs) != len(old) || len(src.listed) != 0 {
+		t.Fatalf("expected the cached version list to be served within the TTL, got %v", pvs)
+	}
+
+	// Age the version list past its TTL; the latest list must be retrieved.
+	sg.stateTimes[sourceHasLatestVersionList] = time.Now().Add(-2 * time.Hour)
+	if sg.has(sourceHasLatestVersionList) {
+		t.Error("expected version list state to have expired")
+	}
+	if !sg.has(sourceExistsUpstream | sourceExistsLocally) {
+		t.Error("expected state without a TTL to be retained")
+	}
+
+	pvs, err = sg.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(src.listed) != 1 {
+		t.Error("expected the version list to be retrieved again after expiring")
+	}
+	<-src.listed
+	if len(pvs) != len(latest) {
+		t.Errorf("expected the refreshed version list, got %v", pvs)
+	}
+	if !sg.has(sourceHasLatestVersionList) {
+		t.Error("expected version list state to be reached again")
+	}
+}
+
+func TestSourceGatewaySkipsFetchForLocalRevisions(t *testing.T) {
+	local := Revision("c575196502940c07bf89fd6d95e83a999bb78ad6")
+	remote := Revision("5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := &versionListSource{present: map[Revision]bool{local: true}}
+	sg := &sourceGateway{
+		srcState: sourceExistsLocally,
+		src:      src,
+		cache:    newMemoryCache(),
+		suprvsr:  newSupervisor(ctx),
+	}
+
+	// The export itself always fails, but a fetch could only help if the
+	// revision isn't already present.
+	if err := sg.exportVersionTo(ctx, local, "unused"); err == nil {
+		t.Fatal("expected export to fail")
+	}
+	if src.fetches != 0 {
+		t.Errorf("expected no fetch for a revision that is already local, got %v", src.fetches)
+	}
+	if sg.srcState&sourceExistsUpstream != 0 {
+		t.Error("expected upstream not to be checked for a revision that is already local")
+	}
+
+	if err := sg.exportVersionTo(ctx, remote, "unused"); err == nil {
+		t.Fatal("expected export to fail")
+	}
+	if src.fetches != 1 {
+		t.Errorf("expected a fetch for a revision that is not local, got %v", src.fetches)
+	}
+}
+
+// corruptSource is a versionListSource whose updates fail, and whose local copy
+// may be reported as corrupt, until it is retrieved afresh.
+type corruptSource struct {
+	versionListSource
+	corrupt     bool
+	quarantined []string
+	inits       int
+}
+
+func (s *corruptSource) initLocal(context.Context) error {
+	s.inits++
+	return nil
+}
+
+func (s *corruptSource) updateLocal(context.Context) error {
+	s.fetches++
+	if s.inits == 0 {
+		return errors.New("fatal: bad object HEAD")
+	}
+	return nil
+}
+
+func (s *corruptSource) verifyLocal(context.Context) error {
+	if s.corrupt {
+		return errors.New("missing blob 5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e")
+	}
+	return nil
+}
+
+func (s *corruptSource) quarantineLocal(dir string) (string, error) {
+	to := filepath.Join(dir, "versionlist")
+	s.quarantined = append(s.quarantined, to)
+	s.corrupt = false
+	return to, nil
+}
+
+func TestSourceGatewayRecoversCorruptLocal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var events []SourceEvent
+	newGateway := func(src source) *sourceGateway {
+		return &sourceGateway{
+			srcState: sourceExistsUpstream | sourceExistsLocally,
+			src:      src,
+			cachedir: "cache",
+			cache:    newMemoryCache(),
+			suprvsr:  newSupervisor(ctx),
+			events:   func(ev SourceEvent) { events = append(events, ev) },
+		}
+	}
+
+	// A failed update of an intact local copy is not recoverable.
+	src := &corruptSource{}
+	sg := newGateway(src)
+	if err := sg.syncLocal(ctx); err == nil {
+		t.Fatal("expected update of an intact local copy to fail")
+	}
+	if len(src.quarantined) != 0 || src.inits != 0 || len(events) != 0 {
+		t.Errorf("expected no recovery of an intact local copy, got quarantines %v, %v inits, events %v", src.quarantined, src.inits, events)
+	}
+
+	// A corrupt local copy is quarantined and retrieved afresh.
+	src = &corruptSource{corrupt: true}
+	sg = newGateway(src)
+	if err := sg.syncLocal(ctx); err != nil {
+		t.Fatalf("expected recovery from a corrupt local copy, got %s", err)
+	}
+	if want := []string{filepath.Join("cache", "quarantine", "versionlist")}; len(src.quarantined) != 1 || src.quarantined[0] != want[0] {
+		t.Errorf("expected the local copy to be quarantined to %v, got %v", want, src.quarantined)
+	}
+	if src.inits != 1 {
+		t.Errorf("expected the source to be retrieved afresh once, got %v", src.inits)
+	}
+	if !sg.has(sourceExistsLocally | sourceHasLatestLocally) {
+		t.Errorf("expected the gateway to have the latest source locally, got %s", sg.srcState)
+	}
+	if len(events) != 1 || events[0].Type != SourceRecovered || events[0].URL != src.upstreamURL() {
+		t.Errorf("expected a single recovery event, got %v", events)
+	}
+}
+
+// redirectedSource is a versionListSource whose upstream redirects to another
+// URL once it has been moved.
+type redirectedSource struct {
+	versionListSource
+	movedTo string
+}
+
+func (s *redirectedSource) redirectedURL() (from, to string) {
+	return s.upstreamURL(), s.movedTo
+}
+
+func TestSourceCoordinatorNotesRedirects(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var events []SourceEvent
+	sc := newSourceCoordinator(newSupervisor(ctx), nil, "", nil, log.New(ioutil.Discard, "", 0))
+	sc.events = func(ev SourceEvent) { events = append(events, ev) }
+	sc.persistNames = true
+	sc.persisted = map[string]persistedSource{
+		"example.com/versionlist": {Type: "git", URL: "example.com/versionlist"},
+	}
+
+	src := &redirectedSource{}
+	sg := &sourceGateway{
+		src:     src,
+		cache:   newMemoryCache(),
+		suprvsr: sc.supervisor,
+	}
+	sg.redirected = func(from, to string) {
+		sc.srcmut.Lock()
+		sc.noteRedirect(sg, from, to)
+		sc.srcmut.Unlock()
+	}
+	sc.srcs["example.com/versionlist"] = sg
+
+	// Not moved yet.
+	if _, err := sg.loadLatestVersionList(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 || len(sc.redirects) != 0 {
+		t.Fatalf("expected no redirect to be noted, got %v", events)
+	}
+
+	src.movedTo = "example.com/newname"
+	for i := 0; i < 2; i++ {
+		if _, err := sg.loadLatestVersionList(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected a single event for the redirect, got %v", events)
+	}
+	if ev := events[0]; ev.Type != SourceRedirected || ev.URL != "example.com/versionlist" || ev.MovedTo != "example.com/newname" {
+		t.Errorf("unexpected redirect event %v", ev)
+	}
+	if sc.srcs["example.com/newname"] != sg || sc.nameToURL["example.com/newname"] != "example.com/newname" {
+		t.Error("expected the new URL to be served by the same gateway")
+	}
+	ps := sc.persisted["example.com/versionlist"]
+	if ps.URL != "example.com/newname" || ps.MovedFrom != "example.com/versionlist" || !sc.persistedDirty {
+		t.Errorf("expected the persisted source to be updated to the new URL, got %v", ps)
+	}
+}
+
+func TestSourceCoordinatorMirrorsKeepNativeGit(t *testing.T) {
+	if newNativeGitSource != nil {
+		t.Skip("built with native git support")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	u, err := url.Parse("https://example.com/mirrored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := newSourceCoordinator(newSupervisor(ctx), nil, "", nil, log.New(ioutil.Discard, "", 0))
+	sc.nativeGit = true
+	sc.mirrors = map[string][]string{u.String(): {"https://mirror.example.com/mirrored"}}
+
+	id := mkPI("example.com/mirrored")
+	_, _, _, _, errs := sc.setUpGateway(ctx, id, maybeSources{maybeGitSource{url: u}}, false)
+	// Setting up the mirrored source must still go through the native git
+	// wrapper, which fails in builds without it.
+	if len(errs) != 1 || errs[0] != errNoNativeGit {
+		t.Fatalf("expected errNoNativeGit, got %v", errs)
+	}
+}
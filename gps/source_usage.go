@@ -0,0 +1,339 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sourceUsageFilename is the name of the file, within the cache directory, in
+// which the disk usage and last use of each source is persisted between runs.
+const sourceUsageFilename = "source-usage-v1.json"
+
+// sourceUsageResolution is how far a source's last use must have moved on for
+// using it again to be worth persisting. Without it, the file would be
+// rewritten by nearly every run, for an ordering that only eviction needs, and
+// that only coarsely.
+const sourceUsageResolution = time.Hour
+
+// quarantineMaxAge is how long a corrupt local copy of a source is kept in the
+// cache directory's quarantine/ directory for inspection before it is pruned.
+const quarantineMaxAge = 7 * 24 * time.Hour
+
+// SourceUsage describes the disk space used by a single source in the cache
+// directory.
+type SourceUsage struct {
+	Dir      string    // Path to the source's directory
+	Size     int64     // Bytes used by the files in the source's directory
+	LastUsed time.Time // When the source was last used, as persisted to within an hour
+}
+
+// usageEntry is the persisted form of a SourceUsage.
+type usageEntry struct {
+	Size     int64     `json:"size"`
+	SizedAt  time.Time `json:"sizedAt"` // Size is recomputed if the source was used since
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// sourceUsageTracker tracks how much disk space each source in the cache
+// directory uses, and when it was last used, in order to evict the
+// least-recently-used sources when the cache grows beyond its quota. Quarantined
+// local copies of sources count toward the quota too, and are evicted first.
+type sourceUsageTracker struct {
+	mu         sync.Mutex // guards all fields
+	dir        string     // The cache directory's sources/ directory
+	quarantine string     // The cache directory's quarantine/ directory
+	quota      int64      // <=0: unlimited
+	entries    map[string]usageEntry
+	inUse      map[string]bool // Names of sources used in this run; never evicted
+	dirty      bool
+}
+
+// newSourceUsageTracker returns a tracker for the sources in cachedir, loading
+// any usage information persisted by earlier runs.
+func newSourceUsageTracker(cachedir string, quota int64) (*sourceUsageTracker, error) {
+	t := &sourceUsageTracker{
+		dir:        filepath.Join(cachedir, "sources"),
+		quarantine: filepath.Join(cachedir, "quarantine"),
+		quota:      quota,
+		entries:    make(map[string]usageEntry),
+		inUse:      make(map[string]bool),
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(cachedir, sourceUsageFilename))
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return t, err
+	}
+	if err = json.Unmarshal(b, &t.entries); err != nil {
+		t.entries = make(map[string]usageEntry)
+		return t, wrapErrorf(err, "failed to parse %s", sourceUsageFilename)
+	}
+	return t, nil
+}
+
+// touch records that the source at path was used just now. The tracked usage
+// is only marked as changed if the source had not been used for at least
+// sourceUsageResolution.
+func (t *sourceUsageTracker) touch(path string) {
+	name := filepath.Base(path)
+	now := time.Now()
+
+	t.mu.Lock()
+	e := t.entries[name]
+	if now.Sub(e.LastUsed) >= sourceUsageResolution {
+		t.dirty = true
+	}
+	e.LastUsed = now
+	t.entries[name] = e
+	t.inUse[name] = true
+	t.mu.Unlock()
+}
+
+// usage returns the usage of all sources in the cache directory, least
+// recently used first.
+func (t *sourceUsageTracker) usage() ([]SourceUsage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.usageLocked()
+}
+
+// usageLocked reconciles the tracked entries with the sources on disk, sizing
+// any that are new or have been used since they were last sized, and returns
+// the usage of each, least recently used first.
+//
+// caller must hold t.mu.
+func (t *sourceUsageTracker) usageLocked() ([]SourceUsage, error) {
+	fis, err := ioutil.ReadDir(t.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	onDisk := make(map[string]bool, len(fis))
+	us := make([]SourceUsage, 0, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		name := fi.Name()
+		onDisk[name] = true
+
+		path := filepath.Join(t.dir, name)
+		e, has := t.entries[name]
+		if !has {
+			// An untracked source, probably from before tracking began; the
+			// best guess for its last use is when it last changed.
+			e.LastUsed = fi.ModTime()
+		}
+		if e.SizedAt.IsZero() || e.LastUsed.After(e.SizedAt) {
+			if e.Size, err = dirSize(path); err != nil {
+				return nil, wrapErrorf(err, "failed to compute size of %s", path)
+			}
+			e.SizedAt = time.Now()
+			t.entries[name] = e
+			t.dirty = true
+		}
+
+		us = append(us, SourceUsage{Dir: path, Size: e.Size, LastUsed: e.LastUsed})
+	}
+
+	// Forget sources that are no longer on disk.
+	for name := range t.entries {
+		if !onDisk[name] {
+			delete(t.entries, name)
+			t.dirty = true
+		}
+	}
+
+	sort.Slice(us, func(i, j int) bool {
+		if !us[i].LastUsed.Equal(us[j].LastUsed) {
+			return us[i].LastUsed.Before(us[j].LastUsed)
+		}
+		return us[i].Dir < us[j].Dir
+	})
+	return us, nil
+}
+
+// quarantinedLocked returns the usage of the quarantined local copies of
+// sources, oldest first. LastUsed is when each was quarantined.
+//
+// caller must hold t.mu.
+func (t *sourceUsageTracker) quarantinedLocked() ([]SourceUsage, error) {
+	fis, err := ioutil.ReadDir(t.quarantine)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	us := make([]SourceUsage, 0, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(t.quarantine, fi.Name())
+		size, err := dirSize(path)
+		if err != nil {
+			return nil, wrapErrorf(err, "failed to compute size of %s", path)
+		}
+		us = append(us, SourceUsage{Dir: path, Size: size, LastUsed: quarantinedAt(fi)})
+	}
+
+	sort.Slice(us, func(i, j int) bool {
+		if !us[i].LastUsed.Equal(us[j].LastUsed) {
+			return us[i].LastUsed.Before(us[j].LastUsed)
+		}
+		return us[i].Dir < us[j].Dir
+	})
+	return us, nil
+}
+
+// quarantinedAt returns when the quarantined copy described by fi was moved
+// aside, as recorded in the suffix of its name, falling back to when it last
+// changed.
+func quarantinedAt(fi os.FileInfo) time.Time {
+	name := fi.Name()
+	if i := strings.LastIndexByte(name, '-'); i != -1 {
+		if ns, err := strconv.ParseInt(name[i+1:], 10, 64); err == nil {
+			return time.Unix(0, ns)
+		}
+	}
+	return fi.ModTime()
+}
+
+// pruneQuarantine removes quarantined local copies of sources that have been
+// kept for longer than quarantineMaxAge. It returns the paths of the removed
+// copies.
+func (t *sourceUsageTracker) pruneQuarantine() ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	qs, err := t.quarantinedLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, q := range qs {
+		if time.Since(q.LastUsed) < quarantineMaxAge {
+			break
+		}
+		if err := os.RemoveAll(q.Dir); err != nil {
+			return pruned, wrapErrorf(err, "failed to prune %s", q.Dir)
+		}
+		pruned = append(pruned, q.Dir)
+	}
+	return pruned, nil
+}
+
+// makeRoom evicts quarantined local copies of sources, oldest first, and then
+// least-recently-used sources not used during this run, until the total size
+// of both is under quota, if there is one. It returns the paths of the evicted
+// copies and sources.
+func (t *sourceUsageTracker) makeRoom() ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.quota <= 0 {
+		return nil, nil
+	}
+
+	qs, err := t.quarantinedLocked()
+	if err != nil {
+		return nil, err
+	}
+	us, err := t.usageLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, q := range qs {
+		total += q.Size
+	}
+	for _, u := range us {
+		total += u.Size
+	}
+
+	var evicted []string
+	for _, q := range qs {
+		if total < t.quota {
+			return evicted, nil
+		}
+		if err := os.RemoveAll(q.Dir); err != nil {
+			return evicted, wrapErrorf(err, "failed to evict %s", q.Dir)
+		}
+		total -= q.Size
+		evicted = append(evicted, q.Dir)
+	}
+	for _, u := range us {
+		if total < t.quota {
+			break
+		}
+		name := filepath.Base(u.Dir)
+		if t.inUse[name] {
+			continue
+		}
+		if err := os.RemoveAll(u.Dir); err != nil {
+			return evicted, wrapErrorf(err, "failed to evict %s", u.Dir)
+		}
+		total -= u.Size
+		delete(t.entries, name)
+		t.dirty = true
+		evicted = append(evicted, u.Dir)
+	}
+	return evicted, nil
+}
+
+// write persists the tracked usage to cachedir, if it has changed.
+func (t *sourceUsageTracker) write(cachedir string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.dirty {
+		return nil
+	}
+
+	b, err := json.Marshal(t.entries)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a concurrent reader never sees
+	// a partial file.
+	path := filepath.Join(cachedir, sourceUsageFilename)
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// dirSize returns the total size of the regular files beneath path.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
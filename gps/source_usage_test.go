@@ -0,0 +1,160 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestSourceUsageTracker(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	cachedir := h.Path("cache")
+
+	// Three sources of 100 bytes each, last changed in order.
+	names := []string{"old", "middle", "new"}
+	for i, name := range names {
+		h.TempFile(filepath.Join("cache", "sources", name, "file"), strings.Repeat("x", 60))
+		h.TempFile(filepath.Join("cache", "sources", name, "sub", "file"), strings.Repeat("x", 40))
+		mtime := time.Now().Add(time.Duration(i-len(names)) * time.Hour)
+		if err := os.Chtimes(filepath.Join(cachedir, "sources", name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr, err := newSourceUsageTracker(cachedir, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us, err := tr.usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != len(names) {
+		t.Fatalf("expected usage for %v sources, got %v", len(names), us)
+	}
+	for i, u := range us {
+		if filepath.Base(u.Dir) != names[i] {
+			t.Errorf("expected %s at position %v, least recently used first, got %s", names[i], i, u.Dir)
+		}
+		if u.Size != 100 {
+			t.Errorf("expected %s to use 100 bytes, got %v", u.Dir, u.Size)
+		}
+	}
+
+	// Using the oldest source protects it from eviction in this run, so the
+	// next oldest must go instead.
+	tr.touch(filepath.Join(cachedir, "sources", "old"))
+	evicted, err := tr.makeRoom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 1 || filepath.Base(evicted[0]) != "middle" {
+		t.Errorf("expected only middle to be evicted, got %v", evicted)
+	}
+	h.MustNotExist(filepath.Join(cachedir, "sources", "middle"))
+	h.MustExist(filepath.Join(cachedir, "sources", "old"))
+
+	// Now within quota; nothing more to evict.
+	if evicted, err = tr.makeRoom(); err != nil || len(evicted) != 0 {
+		t.Errorf("expected no evictions within quota, got %v, %v", evicted, err)
+	}
+
+	if err = tr.write(cachedir); err != nil {
+		t.Fatal(err)
+	}
+	tr, err = newSourceUsageTracker(cachedir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err = tr.usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 || filepath.Base(us[0].Dir) != "new" || filepath.Base(us[1].Dir) != "old" {
+		t.Errorf("expected persisted usage to reflect the touch and eviction, got %v", us)
+	}
+
+	// No quota means no evictions, no matter the size.
+	if evicted, err = tr.makeRoom(); err != nil || len(evicted) != 0 {
+		t.Errorf("expected no evictions without a quota, got %v, %v", evicted, err)
+	}
+
+	// Using a source again so soon after it was last used is not worth
+	// persisting, so the file is left alone.
+	usagePath := filepath.Join(cachedir, sourceUsageFilename)
+	if err = os.Remove(usagePath); err != nil {
+		t.Fatal(err)
+	}
+	tr.touch(filepath.Join(cachedir, "sources", "old"))
+	if err = tr.write(cachedir); err != nil {
+		t.Fatal(err)
+	}
+	h.MustNotExist(usagePath)
+
+	// Unlike using one that has not been used in a while.
+	tr.touch(filepath.Join(cachedir, "sources", "new"))
+	if err = tr.write(cachedir); err != nil {
+		t.Fatal(err)
+	}
+	h.MustExist(usagePath)
+}
+
+func TestSourceUsageTrackerQuarantine(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	cachedir := h.Path("cache")
+
+	// A source, and three quarantined copies of 100 bytes each: one past
+	// quarantineMaxAge, and two quarantined an hour apart since.
+	h.TempFile(filepath.Join("cache", "sources", "src", "file"), strings.Repeat("x", 100))
+	now := time.Now()
+	quarantined := []time.Time{now.Add(-quarantineMaxAge - time.Hour), now.Add(-2 * time.Hour), now.Add(-time.Hour)}
+	var qdirs []string
+	for _, at := range quarantined {
+		name := fmt.Sprintf("src-%d", at.UnixNano())
+		h.TempFile(filepath.Join("cache", "quarantine", name, "file"), strings.Repeat("x", 100))
+		qdirs = append(qdirs, filepath.Join(cachedir, "quarantine", name))
+	}
+
+	tr, err := newSourceUsageTracker(cachedir, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the copy past its age is pruned.
+	pruned, err := tr.pruneQuarantine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0] != qdirs[0] {
+		t.Errorf("expected only %s to be pruned, got %v", qdirs[0], pruned)
+	}
+	h.MustNotExist(qdirs[0])
+	h.MustExist(qdirs[1])
+
+	// The remaining copies count toward the quota, and are evicted before the
+	// source, oldest first.
+	evicted, err := tr.makeRoom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 1 || evicted[0] != qdirs[1] {
+		t.Errorf("expected only %s to be evicted, got %v", qdirs[1], evicted)
+	}
+	h.MustNotExist(qdirs[1])
+	h.MustExist(qdirs[2])
+	h.MustExist(filepath.Join(cachedir, "sources", "src"))
+}
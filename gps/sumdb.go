@@ -0,0 +1,166 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/dep/gps/internal/dirhash"
+	"github.com/golang/dep/gps/internal/sumdb"
+	"github.com/pkg/errors"
+)
+
+// ChecksumDB configures verifying the contents of versions against a checksum
+// database, such as sum.golang.org, or an internal one speaking the same
+// protocol.
+type ChecksumDB struct {
+	Key        string // Verifier key of the database, e.g. "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8".
+	URL        string // Base URL the database is served at. Empty: https:// followed by the name in Key.
+	FailClosed bool   // If true, versions that cannot be verified are rejected too, rather than only those whose contents do not match the database.
+}
+
+// ChecksumMismatchError is returned when the contents of a version do not
+// match the hash that a checksum database records for them.
+type ChecksumMismatchError struct {
+	Module, Version string
+	Got, Want       string
+}
+
+func (e ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("contents of %s@%s do not match the checksum database: got %s, want %s", e.Module, e.Version, e.Got, e.Want)
+}
+
+// checksumVerifier verifies the contents of versions against a checksum
+// database, remembering each result.
+type checksumVerifier struct {
+	db         *sumdb.DB
+	failClosed bool
+
+	mu       sync.Mutex
+	verified map[string]string
+}
+
+func newChecksumVerifier(c ChecksumDB) (*checksumVerifier, error) {
+	db, err := sumdb.New(c.Key, c.URL)
+	if err != nil {
+		return nil, err
+	}
+	db.Client = httpClient
+	return &checksumVerifier{
+		db:         db,
+		failClosed: c.FailClosed,
+		verified:   make(map[string]string),
+	}, nil
+}
+
+// VerifyChecksum checks the contents of the given version of the given project
+// against the checksum database in SourceManagerConfig.ChecksumDB, treating
+// the project as a module whose path is its root. It returns the hash that the
+// database records for them, if they match it.
+//
+// Only versions tagged like vX.Y.Z can be verified, as those are the only
+// ones recorded in checksum databases. Unless the database is configured to
+// fail closed, versions that cannot be verified for that or any other reason,
+// such as the database having no record of them, are let through, and the
+// hash returned is empty. If there is no database, nothing is checked.
+//
+// The hash is computed from an export of the version rather than the zip file
+// the go command would make of it, which can leave out files that an export
+// keeps. So unless the database is configured to fail closed, contents that do
+// not match it are let through too, with a warning, rather than failing
+// projects whose contents are genuine.
+func (sm *SourceMgr) VerifyChecksum(ctx context.Context, id ProjectIdentifier, v Version) (string, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return "", ErrSourceManagerIsReleased
+	}
+	cv := sm.checksums
+	if cv == nil {
+		return "", nil
+	}
+
+	ctx = sm.auditProject(ctx, id.ProjectRoot)
+	module := string(id.ProjectRoot)
+	version, ok := moduleVersion(module, v)
+	if !ok {
+		return cv.unverified(sm, errors.Errorf("cannot verify %s at %s against checksum database %s, as only versions tagged like vX.Y.Z are recorded there", module, v, cv.db.Name()))
+	}
+	key := module + "@" + version
+
+	cv.mu.Lock()
+	sum, has := cv.verified[key]
+	cv.mu.Unlock()
+	if has {
+		return sum, nil
+	}
+
+	var want string
+	err := sm.suprvsr.do(ctx, key, ctVerifyChecksum, func(ctx context.Context) error {
+		var err error
+		want, err = cv.db.Lookup(ctx, module, version)
+		return err
+	})
+	if err != nil {
+		return cv.unverified(sm, wrapErrorf(err, "cannot verify %s against checksum database %s", key, cv.db.Name()))
+	}
+
+	tmp, err := ioutil.TempDir("", "dep-sumdb")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	to := filepath.Join(tmp, "src")
+	if err = sm.ExportProject(ctx, id, v, to); err != nil {
+		return "", err
+	}
+	got, err := dirhash.ModuleHash(to, module, version)
+	if err != nil {
+		return "", err
+	}
+	if got != want {
+		return cv.unverified(sm, ChecksumMismatchError{Module: module, Version: version, Got: got, Want: want})
+	}
+
+	cv.mu.Lock()
+	cv.verified[key] = want
+	cv.mu.Unlock()
+	return want, nil
+}
+
+// unverified returns err if the verifier fails closed. Otherwise, it only logs
+// it, and lets the version through.
+func (cv *checksumVerifier) unverified(sm *SourceMgr, err error) (string, error) {
+	if cv.failClosed {
+		return "", err
+	}
+	sm.srcCoord.logger.Println(err)
+	return "", nil
+}
+
+// moduleVersion returns the version of module that v corresponds to, if v is
+// a tag of the form checksum databases record. Tags of major versions above
+// 1 are +incompatible unless module ends in the matching /vN.
+func moduleVersion(module string, v Version) (string, bool) {
+	if pv, ok := v.(PairedVersion); ok {
+		v = pv.Unpair()
+	}
+	sv, ok := v.(semVersion)
+	if !ok || !strings.HasPrefix(sv.String(), "v") {
+		return "", false
+	}
+
+	version := sv.String()
+	if major := sv.sv.Major(); major >= 2 && path.Base(module) != fmt.Sprintf("v%d", major) && !strings.HasSuffix(version, "+incompatible") {
+		version += "+incompatible"
+	}
+	return version, true
+}
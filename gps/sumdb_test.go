@@ -0,0 +1,156 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/dep/gps/internal/dirhash"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestModuleVersion(t *testing.T) {
+	cases := []struct {
+		module string
+		v      Version
+		want   string
+		ok     bool
+	}{
+		{"example.com/a", NewVersion("v1.2.3"), "v1.2.3", true},
+		{"example.com/a", NewVersion("v1.2.3").Pair("abc"), "v1.2.3", true},
+		{"example.com/a", NewVersion("v2.0.0"), "v2.0.0+incompatible", true},
+		{"example.com/a/v2", NewVersion("v2.0.0"), "v2.0.0", true},
+		{"example.com/a", NewVersion("1.2.3"), "", false},
+		{"example.com/a", NewBranch("master"), "", false},
+		{"example.com/a", Revision("abc"), "", false},
+	}
+	for _, c := range cases {
+		got, ok := moduleVersion(c.module, c.v)
+		if got != c.want || ok != c.ok {
+			t.Errorf("moduleVersion(%q, %s): expected (%q, %v), got (%q, %v)", c.module, c.v, c.want, c.ok, got, ok)
+		}
+	}
+}
+
+func TestVerifyChecksumFailClosed(t *testing.T) {
+	// A database that has no records at all.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+
+	id := ProjectIdentifier{ProjectRoot: "example.com/a"}
+	for _, failClosed := range []bool{false, true} {
+		sm, err := NewSourceManager(SourceManagerConfig{
+			Cachedir:       h.Path("cache"),
+			Logger:         log.New(test.Writer{TB: t}, "", 0),
+			DisableLocking: true,
+			ChecksumDB: &ChecksumDB{
+				Key:        "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+				URL:        srv.URL,
+				FailClosed: failClosed,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, v := range []Version{NewVersion("v1.0.0"), NewBranch("master")} {
+			sum, err := sm.VerifyChecksum(context.Background(), id, v)
+			if failClosed && err == nil {
+				t.Errorf("expected %s to be rejected when failing closed", v)
+			}
+			if !failClosed && (err != nil || sum != "") {
+				t.Errorf("expected %s to be let through unverified, got %q (%v)", v, sum, err)
+			}
+		}
+		sm.Release()
+	}
+}
+
+// newTestChecksumDB returns the key of, and a server for, a checksum database
+// holding a single record, hashing version of module as hash.
+func newTestChecksumDB(t *testing.T, module, version, hash string) (string, *httptest.Server) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb := append([]byte{1}, pub...)
+	kh := sha256.Sum256(append([]byte("sum.example.com\n"), kb...))
+	key := fmt.Sprintf("sum.example.com+%x+%s", kh[:4], base64.StdEncoding.EncodeToString(kb))
+
+	// The root of a log of one record is that record's hash.
+	record := fmt.Sprintf("%s %s %s\n", module, version, hash)
+	root := sha256.Sum256(append([]byte{0}, record...))
+	tree := fmt.Sprintf("go.sum database tree\n1\n%s\n", base64.StdEncoding.EncodeToString(root[:]))
+	sig := append(kh[:4:4], ed25519.Sign(priv, []byte(tree))...)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "0\n%s\n%s\n— sum.example.com %s\n", record, tree, base64.StdEncoding.EncodeToString(sig))
+	}))
+	return key, srv
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	files := map[string]string{"example.com/Foo/bar@v1.0.0/bar.go": "package bar\n"}
+	reg := newTestRegistry(t, files)
+	defer reg.Close()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempFile("bar/bar.go", "package bar\n")
+	sum, err := dirhash.ModuleHash(h.Path("bar"), "example.com/Foo/bar", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := ProjectIdentifier{ProjectRoot: "example.com/Foo/bar"}
+	bad := "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	for i, tc := range []struct {
+		hash       string
+		failClosed bool
+	}{{sum, true}, {bad, true}, {bad, false}} {
+		hash := tc.hash
+		key, db := newTestChecksumDB(t, "example.com/Foo/bar", "v1.0.0", hash)
+		h.TempDir(fmt.Sprintf("cache%d", i))
+		sm, err := NewSourceManager(SourceManagerConfig{
+			Cachedir:   h.Path(fmt.Sprintf("cache%d", i)),
+			Logger:     log.New(test.Writer{TB: t}, "", 0),
+			Registries: map[string]string{"example.com": reg.URL + "/go"},
+			ChecksumDB: &ChecksumDB{Key: key, URL: db.URL, FailClosed: tc.failClosed},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := sm.VerifyChecksum(context.Background(), id, NewVersion("v1.0.0").Pair("v1.0.0"))
+		switch {
+		case hash == sum:
+			if err != nil || got != sum {
+				t.Errorf("expected %s to be verified, got %q (%v)", sum, got, err)
+			}
+		case tc.failClosed:
+			if _, ok := err.(ChecksumMismatchError); !ok {
+				t.Errorf("expected a ChecksumMismatchError, got %q (%v)", got, err)
+			}
+		default:
+			if err != nil || got != "" {
+				t.Errorf("expected a mismatch to be let through unverified when failing open, got %q (%v)", got, err)
+			}
+		}
+		sm.Release()
+		db.Close()
+	}
+}
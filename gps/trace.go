@@ -21,6 +21,14 @@ const (
 	innerIndent   = "  "
 )
 
+// progressf writes a line, formatted from format and args, to the solver's
+// progress writer, if it has one.
+func (s *solver) progressf(format string, args ...interface{}) {
+	if s.progress != nil {
+		fmt.Fprintf(s.progress, format+"\n", args...)
+	}
+}
+
 func (s *solver) traceCheckPkgs(bmi bimodalIdentifier) {
 	if s.tl == nil {
 		return
@@ -77,6 +85,10 @@ func (s *solver) traceStartBacktrack(bmi bimodalIdentifier, err error, pkgonly b
 // traceBacktrack is called when a package or project is poppped off during
 // backtracking
 func (s *solver) traceBacktrack(bmi bimodalIdentifier, pkgonly bool) {
+	s.emit(Backtracked{Project: bmi.id, PackagesOnly: pkgonly})
+	if !pkgonly {
+		s.progressf("Backtracking from %s", bmi.id)
+	}
 	if s.tl == nil {
 		return
 	}
@@ -94,6 +106,13 @@ func (s *solver) traceBacktrack(bmi bimodalIdentifier, pkgonly bool) {
 
 // Called just once after solving has finished, whether success or not
 func (s *solver) traceFinish(sol solution, err error) {
+	if err == nil {
+		s.emit(SolveFinished{Solution: sol})
+		s.progressf("Solved with %d projects after %d attempts", len(sol.Projects()), s.attempts)
+	} else {
+		s.emit(SolveFinished{Err: err})
+		s.progressf("Solving failed after %d attempts", s.attempts)
+	}
 	if s.tl == nil {
 		return
 	}
@@ -111,6 +130,7 @@ func (s *solver) traceFinish(sol solution, err error) {
 
 // traceSelectRoot is called just once, when the root project is selected
 func (s *solver) traceSelectRoot(ptree pkgtree.PackageTree, cdeps []completeDep) {
+	s.progressf("Solving for %s, which imports %d projects", s.rd.rpt.ImportRoot, len(cdeps))
 	if s.tl == nil {
 		return
 	}
@@ -134,6 +154,10 @@ func (s *solver) traceSelectRoot(ptree pkgtree.PackageTree, cdeps []completeDep)
 
 // traceSelect is called when an atom is successfully selected
 func (s *solver) traceSelect(awp atomWithPackages, pkgonly bool) {
+	s.emit(ProjectSelected{Project: awp.a.id, Version: awp.a.v, Packages: awp.pl, PackagesOnly: pkgonly})
+	if !pkgonly {
+		s.progressf("Selected %s", a2vs(awp.a))
+	}
 	if s.tl == nil {
 		return
 	}
@@ -0,0 +1,198 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ImportPathProblemKind is the rule of gps's for import paths that an
+// ImportPathProblem breaks.
+type ImportPathProblemKind uint8
+
+const (
+	// ImportPathEmpty is an empty import path.
+	ImportPathEmpty ImportPathProblemKind = iota + 1
+	// ImportPathMalformed is a path that begins or ends with a slash, has an
+	// empty, "." or ".." element, or has a host that is not a valid name.
+	ImportPathMalformed
+	// ImportPathIllegalChar is a path with a character that gps never deduces
+	// a source for.
+	ImportPathIllegalChar
+	// ImportPathNoHost is a path whose first element is not a host name, as
+	// with the paths of standard library packages.
+	ImportPathNoHost
+	// ImportPathHostCase is a path whose host has capital letters. Projects
+	// are only deduced for hosts written in lower case.
+	ImportPathHostCase
+	// ImportPathVCSSuffix is a project root with an element other than its
+	// last that ends in a VCS suffix, such as ".git", which ends the root.
+	ImportPathVCSSuffix
+	// ImportPathNotRoot is a project root on a host with well-known paths,
+	// such as github.com, that is not the root of a project there.
+	ImportPathNotRoot
+)
+
+func (k ImportPathProblemKind) String() string {
+	switch k {
+	case ImportPathEmpty:
+		return "empty"
+	case ImportPathMalformed:
+		return "malformed"
+	case ImportPathIllegalChar:
+		return "illegal character"
+	case ImportPathNoHost:
+		return "no host"
+	case ImportPathHostCase:
+		return "host case"
+	case ImportPathVCSSuffix:
+		return "vcs suffix"
+	case ImportPathNotRoot:
+		return "not a root"
+	default:
+		return fmt.Sprintf("ImportPathProblemKind(%d)", k)
+	}
+}
+
+// ImportPathProblem is a reason that a string is not a plausible import path
+// or project root.
+type ImportPathProblem struct {
+	Kind   ImportPathProblemKind
+	Path   string // The import path or project root with the problem.
+	Detail string // The element or character at fault, or for ImportPathHostCase, ImportPathVCSSuffix and ImportPathNotRoot, what the path should be instead, if known.
+}
+
+func (p *ImportPathProblem) Error() string {
+	switch p.Kind {
+	case ImportPathEmpty:
+		return "import path is empty"
+	case ImportPathMalformed:
+		return fmt.Sprintf("import path %q has a malformed element %q", p.Path, p.Detail)
+	case ImportPathIllegalChar:
+		return fmt.Sprintf("import path %q has an illegal character %q", p.Path, p.Detail)
+	case ImportPathNoHost:
+		return fmt.Sprintf("import path %q does not begin with a host name", p.Path)
+	case ImportPathHostCase:
+		return fmt.Sprintf("import path %q has a host in upper case, should be %q", p.Path, p.Detail)
+	case ImportPathVCSSuffix:
+		return fmt.Sprintf("project root %q continues past a VCS suffix, should be %q", p.Path, p.Detail)
+	case ImportPathNotRoot:
+		if p.Detail == "" {
+			return fmt.Sprintf("project root %q is not a valid project path for its host", p.Path)
+		}
+		return fmt.Sprintf("project root %q is not the root of its project, should be %q", p.Path, p.Detail)
+	}
+	return fmt.Sprintf("import path %q is invalid", p.Path)
+}
+
+const (
+	alnumChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	hostChars  = alnumChars + "-."
+	elemChars  = alnumChars + "-_.~"
+)
+
+var (
+	hostRegex   = regexp.MustCompile(`^` + pathvldHost + `$`)
+	vcsSuffixes = []string{".bzr", ".git", ".hg", ".svn"}
+
+	// knownPathDeducers deduce project roots on hosts with well-known paths,
+	// without going to the network.
+	knownPathDeducers = pathDeducerTrie()
+)
+
+// ValidateImportPath checks whether path is plausibly an import path that gps
+// could deduce a source for, and returns the problems it finds, at most one of
+// each kind, or nil if there are none. It does not go to the network, so a
+// path without problems may still name nothing.
+func ValidateImportPath(path string) []*ImportPathProblem {
+	if path == "" {
+		return []*ImportPathProblem{{Kind: ImportPathEmpty}}
+	}
+
+	var probs []*ImportPathProblem
+	seen := make(map[ImportPathProblemKind]bool)
+	add := func(kind ImportPathProblemKind, detail string) {
+		if !seen[kind] {
+			seen[kind] = true
+			probs = append(probs, &ImportPathProblem{Kind: kind, Path: path, Detail: detail})
+		}
+	}
+
+	elems := strings.Split(path, "/")
+	for i, elem := range elems {
+		switch elem {
+		case "", ".", "..":
+			add(ImportPathMalformed, elem)
+			continue
+		}
+
+		chars := elemChars
+		if i == 0 {
+			chars = hostChars
+		}
+		if j := strings.IndexFunc(elem, func(r rune) bool { return !strings.ContainsRune(chars, r) }); j >= 0 {
+			r, _ := utf8.DecodeRuneInString(elem[j:])
+			add(ImportPathIllegalChar, string(r))
+			continue
+		}
+
+		if i == 0 {
+			switch {
+			case !strings.Contains(elem, "."):
+				add(ImportPathNoHost, elem)
+			case !hostRegex.MatchString(elem):
+				add(ImportPathMalformed, elem)
+			case strings.ToLower(elem) != elem:
+				add(ImportPathHostCase, strings.ToLower(elem)+path[len(elem):])
+			}
+		}
+	}
+
+	// The checks above explain why a path fails pathvld, which is what
+	// deduction actually enforces; catch anything they miss.
+	if len(probs) == 0 && !pathvld.MatchString(path) {
+		add(ImportPathMalformed, "")
+	}
+	return probs
+}
+
+// ValidateProjectRoot checks root as ValidateImportPath checks an import path,
+// and also that it is plausibly the root of a project: that nothing follows a
+// VCS suffix in it, and that on a host with well-known paths, such as
+// github.com, it is exactly the root of a project there.
+func ValidateProjectRoot(root ProjectRoot) []*ImportPathProblem {
+	path := string(root)
+	if probs := ValidateImportPath(path); len(probs) > 0 {
+		return probs
+	}
+
+	if _, d, has := knownPathDeducers.LongestPrefix(path); has {
+		deduced, err := d.deduceRoot(path)
+		if err != nil {
+			return []*ImportPathProblem{{Kind: ImportPathNotRoot, Path: path}}
+		}
+		if deduced != path {
+			return []*ImportPathProblem{{Kind: ImportPathNotRoot, Path: path, Detail: deduced}}
+		}
+		return nil
+	}
+
+	elems := strings.Split(path, "/")
+	for i, elem := range elems[1 : len(elems)-1] {
+		for _, suffix := range vcsSuffixes {
+			if strings.HasSuffix(elem, suffix) {
+				return []*ImportPathProblem{{
+					Kind:   ImportPathVCSSuffix,
+					Path:   path,
+					Detail: strings.Join(elems[:i+2], "/"),
+				}}
+			}
+		}
+	}
+	return nil
+}
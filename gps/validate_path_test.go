@@ -0,0 +1,82 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateImportPath(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want []ImportPathProblem
+	}{
+		{path: "github.com/golang/dep/gps"},
+		{path: "example.com/foo.git/bar_baz~1"},
+		{path: "example.com:8080/foo", want: []ImportPathProblem{{Kind: ImportPathIllegalChar, Detail: ":"}}},
+		{path: "", want: []ImportPathProblem{{Kind: ImportPathEmpty}}},
+		{path: "/github.com/golang/dep", want: []ImportPathProblem{{Kind: ImportPathMalformed}}},
+		{path: "github.com/golang//dep", want: []ImportPathProblem{{Kind: ImportPathMalformed}}},
+		{path: "github.com/golang/dep/", want: []ImportPathProblem{{Kind: ImportPathMalformed}}},
+		{path: "github.com/golang/../dep", want: []ImportPathProblem{{Kind: ImportPathMalformed, Detail: ".."}}},
+		{path: "example..com/foo", want: []ImportPathProblem{{Kind: ImportPathMalformed, Detail: "example..com"}}},
+		{path: "github.com/golang/d p", want: []ImportPathProblem{{Kind: ImportPathIllegalChar, Detail: " "}}},
+		{path: "github.com/gölang/dep", want: []ImportPathProblem{{Kind: ImportPathIllegalChar, Detail: "ö"}}},
+		{path: "exa_mple.com/foo", want: []ImportPathProblem{{Kind: ImportPathIllegalChar, Detail: "_"}}},
+		{path: "net/http", want: []ImportPathProblem{{Kind: ImportPathNoHost, Detail: "net"}}},
+		{path: "GitHub.com/golang/dep", want: []ImportPathProblem{{Kind: ImportPathHostCase, Detail: "github.com/golang/dep"}}},
+		{
+			path: "GitHub.com/golang//d@p",
+			want: []ImportPathProblem{
+				{Kind: ImportPathHostCase, Detail: "github.com/golang//d@p"},
+				{Kind: ImportPathMalformed},
+				{Kind: ImportPathIllegalChar, Detail: "@"},
+			},
+		},
+	} {
+		var got []ImportPathProblem
+		for _, p := range ValidateImportPath(tc.path) {
+			if p.Path != tc.path {
+				t.Errorf("%q: expected problem to be with %q, got %q", tc.path, tc.path, p.Path)
+			}
+			if p.Error() == "" {
+				t.Errorf("%q: expected problem %s to have a message", tc.path, p.Kind)
+			}
+			got = append(got, ImportPathProblem{Kind: p.Kind, Detail: p.Detail})
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: expected problems %v, got %v", tc.path, tc.want, got)
+		}
+		if len(got) == 0 && !pathvld.MatchString(tc.path) {
+			t.Errorf("%q: expected a path without problems to be accepted by deduction", tc.path)
+		}
+	}
+}
+
+func TestValidateProjectRoot(t *testing.T) {
+	for _, tc := range []struct {
+		root ProjectRoot
+		want []ImportPathProblem
+	}{
+		{root: "github.com/golang/dep"},
+		{root: "gopkg.in/yaml.v2"},
+		{root: "example.com/foo/bar"},
+		{root: "example.com/foo.git"},
+		{root: "net/http", want: []ImportPathProblem{{Kind: ImportPathNoHost, Detail: "net"}}},
+		{root: "github.com/golang/dep/gps", want: []ImportPathProblem{{Kind: ImportPathNotRoot, Detail: "github.com/golang/dep"}}},
+		{root: "github.com/golang", want: []ImportPathProblem{{Kind: ImportPathNotRoot}}},
+		{root: "example.com/foo.git/bar", want: []ImportPathProblem{{Kind: ImportPathVCSSuffix, Detail: "example.com/foo.git"}}},
+		{root: "example.com/a/foo.hg/bar/baz", want: []ImportPathProblem{{Kind: ImportPathVCSSuffix, Detail: "example.com/a/foo.hg"}}},
+	} {
+		var got []ImportPathProblem
+		for _, p := range ValidateProjectRoot(tc.root) {
+			got = append(got, ImportPathProblem{Kind: p.Kind, Detail: p.Detail})
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: expected problems %v, got %v", tc.root, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+)
+
+// gitBatchChecker checks for the presence of commits in a local git repository
+// using a single long-lived `git cat-file --batch-check` process, rather than
+// spawning a process per check. Solvers tend to check many revisions in quick
+// succession, so this saves a great deal of process startup overhead.
+//
+// The process is started on first use, and runs until close is called.
+type gitBatchChecker struct {
+	mu  sync.Mutex // guards all fields, and serializes checks
+	dir string     // The repository's local path
+	c   cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+func newGitBatchChecker(dir string) *gitBatchChecker {
+	return &gitBatchChecker{dir: dir}
+}
+
+// start starts the cat-file process.
+//
+// caller must hold b.mu.
+func (b *gitBatchChecker) start() error {
+	c := commandContext(context.Background(), "git", "cat-file", "--batch-check")
+	c.SetDir(b.dir)
+
+	in, err := c.Cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := c.Cmd.StdoutPipe()
+	if err != nil {
+		in.Close()
+		return err
+	}
+	if err = c.Cmd.Start(); err != nil {
+		in.Close()
+		return wrapErrorf(err, "failed to start git cat-file in %s", b.dir)
+	}
+
+	b.c, b.in, b.out = c, in, bufio.NewReader(out)
+	return nil
+}
+
+// hasCommit reports whether rev names a commit that is present in the
+// repository.
+func (b *gitBatchChecker) hasCommit(rev string) (bool, error) {
+	if rev == "" || strings.ContainsAny(rev, "\r\n") {
+		// Can't be expressed as a query, let alone name a commit.
+		return false, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.in == nil {
+		if err := b.start(); err != nil {
+			return false, err
+		}
+	}
+
+	// Peeling to a commit both rejects other object types and accepts tags
+	// that point at commits, as git rev-parse --verify does for refs.
+	if _, err := io.WriteString(b.in, rev+"^{commit}\n"); err != nil {
+		b.stop()
+		return false, wrapError(err, "failed to query git cat-file")
+	}
+	line, err := b.out.ReadString('\n')
+	if err != nil {
+		b.stop()
+		return false, wrapError(err, "failed to read from git cat-file")
+	}
+
+	// Found objects are reported as "<sha> <type> <size>"; anything else is
+	// "<query> missing" or "<query> ambiguous".
+	fields := strings.Fields(line)
+	return len(fields) == 3 && fields[1] == "commit", nil
+}
+
+// close stops the cat-file process, if it is running. The process is started
+// again if hasCommit is called afterwards.
+func (b *gitBatchChecker) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stop()
+}
+
+// stop stops the cat-file process, if it is running.
+//
+// caller must hold b.mu.
+func (b *gitBatchChecker) stop() error {
+	if b.in == nil {
+		return nil
+	}
+
+	// cat-file exits cleanly at the end of its input.
+	b.in.Close()
+	err := b.c.Cmd.Wait()
+	b.c, b.in, b.out = cmd{}, nil, nil
+	return err
+}
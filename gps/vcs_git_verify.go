@@ -0,0 +1,250 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExportMismatchError indicates that the files written out by an export of a
+// revision do not match those recorded in the revision itself. This suggests
+// the export was taken from a working copy that was dirty, or that was changed
+// while the export was in progress.
+type ExportMismatchError struct {
+	Revision Revision
+	Path     string   // The directory the revision was exported to
+	Files    []string // Slash-separated paths of the files that do not match
+}
+
+func (e *ExportMismatchError) Error() string {
+	const max = 5
+	files := e.Files
+	if len(files) > max {
+		files = append(files[:max:max], fmt.Sprintf("and %d more", len(e.Files)-max))
+	}
+	return fmt.Sprintf("export of %s to %s does not match the revision: %s differ",
+		e.Revision, e.Path, strings.Join(files, ", "))
+}
+
+// CaseCollisionError indicates that a revision contains paths that differ only
+// by case, and so cannot be exported intact to a case-insensitive filesystem:
+// one would silently overwrite, or be merged with, the other.
+type CaseCollisionError struct {
+	Revision Revision
+	Path     string // The directory the revision was to be exported to
+	// Each element lists the slash-separated paths, of files or directories,
+	// that collide with each other.
+	Collisions [][]string
+}
+
+func (e *CaseCollisionError) Error() string {
+	colls := make([]string, len(e.Collisions))
+	for i, c := range e.Collisions {
+		colls[i] = strings.Join(c, " and ")
+	}
+	return fmt.Sprintf("cannot export %s to %s, as it is on a case-insensitive filesystem and these paths differ only by case: %s",
+		e.Revision, e.Path, strings.Join(colls, "; "))
+}
+
+// caseCollisions returns the groups of files, and of the directories
+// containing them, among the slash-separated paths files, whose paths differ
+// only by case. Groups are returned sorted.
+func caseCollisions(files []string) [][]string {
+	spellings := make(map[string]map[string]bool)
+	add := func(p string) {
+		lp := strings.ToLower(p)
+		if spellings[lp] == nil {
+			spellings[lp] = make(map[string]bool)
+		}
+		spellings[lp][p] = true
+	}
+	for _, f := range files {
+		add(f)
+		for dir := path.Dir(f); dir != "."; dir = path.Dir(dir) {
+			add(dir)
+		}
+	}
+
+	var colls [][]string
+	for _, sp := range spellings {
+		if len(sp) < 2 {
+			continue
+		}
+		c := make([]string, 0, len(sp))
+		for p := range sp {
+			c = append(c, p)
+		}
+		sort.Strings(c)
+		colls = append(colls, c)
+	}
+	sort.Slice(colls, func(i, j int) bool { return colls[i][0] < colls[j][0] })
+	return colls
+}
+
+// gitTreeEntry is a single file listed by git ls-tree.
+type gitTreeEntry struct {
+	mode string
+	hash string
+	path string
+}
+
+// parseGitLsTree parses the output of git ls-tree -r -z.
+func parseGitLsTree(out []byte) ([]gitTreeEntry, error) {
+	var entries []gitTreeEntry
+	for _, line := range bytes.Split(out, []byte{0}) {
+		if len(line) == 0 {
+			continue
+		}
+		// <mode> SP <type> SP <object> TAB <file>
+		tab := bytes.IndexByte(line, '\t')
+		if tab < 0 {
+			return nil, errors.Errorf("unexpected git ls-tree output: %q", line)
+		}
+		fields := bytes.Fields(line[:tab])
+		if len(fields) != 3 {
+			return nil, errors.Errorf("unexpected git ls-tree output: %q", line)
+		}
+		entries = append(entries, gitTreeEntry{
+			mode: string(fields[0]),
+			hash: string(fields[2]),
+			path: string(line[tab+1:]),
+		})
+	}
+	return entries, nil
+}
+
+// gitBlobHash computes the hash git gives a blob with the contents of r, which
+// is size bytes long.
+func gitBlobHash(r io.Reader, size int64) (string, error) {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashExportedFile computes the git blob hash of the file at path, as exported
+// for a tree entry with the given mode.
+func hashExportedFile(path, mode string) (string, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if mode == "120000" && fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		return gitBlobHash(strings.NewReader(filepath.ToSlash(target)), int64(len(target)))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return gitBlobHash(f, fi.Size())
+}
+
+// lsTree lists the files in rev.
+func (s *gitSource) lsTree(ctx context.Context, rev Revision) ([]gitTreeEntry, error) {
+	cmd := commandContext(ctx, "git", "ls-tree", "-r", "-z", "--full-tree", rev.String())
+	cmd.SetDir(s.repo.LocalPath())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, wrapError(err, string(out))
+	}
+	return parseGitLsTree(out)
+}
+
+// exportedEntries returns those of entries that are written out by an export
+// of paths, or of every file if paths is nil. Submodules are never exported.
+func exportedEntries(entries []gitTreeEntry, paths []string) []gitTreeEntry {
+	var want map[string]bool
+	if paths != nil {
+		want = make(map[string]bool, len(paths))
+		for _, p := range paths {
+			want[p] = true
+		}
+	}
+
+	exported := make([]gitTreeEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.mode == "160000" || want != nil && !want[e.path] {
+			continue
+		}
+		exported = append(exported, e)
+	}
+	return exported
+}
+
+// verifyExportedRevision checks that the files in paths, or every file if paths
+// is nil, written out from rev to the directory to, match the contents recorded
+// for them in rev. It returns an *ExportMismatchError if any do not.
+func (s *gitSource) verifyExportedRevision(ctx context.Context, rev Revision, to string, paths []string) error {
+	entries, err := s.lsTree(ctx, rev)
+	if err != nil {
+		return err
+	}
+	return s.verifyExportedEntries(ctx, rev, to, exportedEntries(entries, paths))
+}
+
+// verifyExportedEntries checks that entries, written out from rev to the
+// directory to, match the contents recorded for them in rev. It returns an
+// *ExportMismatchError if any do not.
+//
+// Files that git would have transformed on checkout, such as by line ending
+// conversion, are rehashed by git itself before being reported.
+func (s *gitSource) verifyExportedEntries(ctx context.Context, rev Revision, to string, entries []gitTreeEntry) error {
+	var mismatched []string
+	for _, e := range entries {
+		file := filepath.Join(to, filepath.FromSlash(e.path))
+		h, err := hashExportedFile(file, e.mode)
+		if err == nil && h != e.hash {
+			h, err = s.hashWithFilters(ctx, e.path, file)
+		}
+		if err != nil || h != e.hash {
+			mismatched = append(mismatched, e.path)
+		}
+	}
+
+	if len(mismatched) > 0 {
+		return &ExportMismatchError{Revision: rev, Path: to, Files: mismatched}
+	}
+	return nil
+}
+
+// hashWithFilters has git compute the hash of file as if it were checked in at
+// path, applying any filters, such as line ending conversion, configured for
+// the repository.
+func (s *gitSource) hashWithFilters(ctx context.Context, path, file string) (string, error) {
+	cmd := commandContext(ctx, "git", "hash-object", "--path="+path, "--", file)
+	cmd.SetDir(s.repo.LocalPath())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", wrapError(err, string(out))
+	}
+	// Warnings about the conversion may precede the hash.
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); gitHashRE.MatchString(line) {
+			return line, nil
+		}
+	}
+	return "", errors.Errorf("unexpected git hash-object output: %q", out)
+}
@@ -0,0 +1,233 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// hgCommandServer runs hg commands in a local repository using a single
+// long-lived `hg serve --cmdserver pipe` process, rather than spawning a
+// process per command. Starting hg is slow, as it is written in Python, so this
+// saves a great deal of overhead for sources that are queried repeatedly.
+//
+// The process is started on first use, and runs until close is called.
+//
+// See https://www.mercurial-scm.org/wiki/CommandServer for the protocol.
+type hgCommandServer struct {
+	mu  sync.Mutex // guards all fields, and serializes commands
+	dir string     // The repository's local path
+	c   cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+func newHgCommandServer(dir string) *hgCommandServer {
+	return &hgCommandServer{dir: dir}
+}
+
+// hgExitError is returned when an hg command run by an hgCommandServer fails.
+type hgExitError struct {
+	args []string
+	code int32
+}
+
+func (e *hgExitError) Error() string {
+	return fmt.Sprintf("hg %s: exit status %d", strings.Join(e.args, " "), e.code)
+}
+
+// run runs hg with args, returning the command's combined output. If ctx is
+// cancelled while the command runs, the server is killed.
+func (s *hgCommandServer) run(ctx context.Context, args ...string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.in == nil {
+		if err := s.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	done := make(chan struct{})
+	killed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = s.c.Cmd.Process.Kill()
+			killed <- true
+		case <-done:
+			killed <- false
+		}
+	}()
+
+	out, err := runHgCommand(s.in, s.out, args)
+	close(done)
+
+	if <-killed {
+		s.stop()
+		return out, ctx.Err()
+	}
+	if _, ok := err.(*hgExitError); err != nil && !ok {
+		// The protocol is out of step, so the server can't be used again.
+		s.stop()
+	}
+	return out, err
+}
+
+// start starts the command server, and reads its hello message.
+//
+// caller must hold s.mu.
+func (s *hgCommandServer) start() error {
+	c := commandContext(context.Background(), "hg", "serve", "--cmdserver", "pipe")
+	c.SetDir(s.dir)
+	// As with hgSource.hgCmd, keep extensions from interfering with our
+	// expectations regarding the output of commands.
+	c.Cmd.Env = append(c.Cmd.Env, "HGRCPATH=")
+
+	in, err := c.Cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := c.Cmd.StdoutPipe()
+	if err != nil {
+		in.Close()
+		return err
+	}
+	if err = c.Cmd.Start(); err != nil {
+		in.Close()
+		return wrapErrorf(err, "failed to start hg command server in %s", s.dir)
+	}
+
+	s.c, s.in, s.out = c, in, bufio.NewReader(out)
+	if err = readHgHello(s.out); err != nil {
+		s.stop()
+		return wrapErrorf(err, "failed to start hg command server in %s", s.dir)
+	}
+	return nil
+}
+
+// close stops the command server, if it is running. The server is started
+// again if run is called afterwards.
+func (s *hgCommandServer) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stop()
+}
+
+// stop stops the command server, if it is running.
+//
+// caller must hold s.mu.
+func (s *hgCommandServer) stop() error {
+	if s.in == nil {
+		return nil
+	}
+
+	// The command server exits cleanly at the end of its input.
+	s.in.Close()
+	err := s.c.Cmd.Wait()
+	s.c, s.in, s.out = cmd{}, nil, nil
+	return err
+}
+
+// readHgChunk reads the header of a message from an hg command server, which
+// is its channel, followed by the big-endian length of its data.
+func readHgChunk(r io.Reader) (channel byte, length uint32, err error) {
+	var hdr [5]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return 0, 0, err
+	}
+	return hdr[0], binary.BigEndian.Uint32(hdr[1:]), nil
+}
+
+// readHgHello reads the message with which an hg command server introduces
+// itself, and checks that it is capable of running commands.
+func readHgHello(r io.Reader) error {
+	ch, n, err := readHgChunk(r)
+	if err != nil {
+		return err
+	}
+	if ch != 'o' {
+		return errors.Errorf("unexpected hg command server channel %q in hello message", ch)
+	}
+	hello := make([]byte, n)
+	if _, err = io.ReadFull(r, hello); err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(hello), "\n") {
+		if !strings.HasPrefix(line, "capabilities:") {
+			continue
+		}
+		for _, c := range strings.Fields(strings.TrimPrefix(line, "capabilities:")) {
+			if c == "runcommand" {
+				return nil
+			}
+		}
+	}
+	return errors.New("hg command server cannot run commands")
+}
+
+// runHgCommand runs hg with args on the command server that reads from w and
+// writes to r, returning the command's combined output, and an *hgExitError if
+// it fails.
+func runHgCommand(w io.Writer, r io.Reader, args []string) ([]byte, error) {
+	data := []byte(strings.Join(args, "\x00"))
+	req := make([]byte, 0, len("runcommand\n")+4+len(data))
+	req = append(req, "runcommand\n"...)
+	req = append(req, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(req[len(req)-4:], uint32(len(data)))
+	req = append(req, data...)
+	if _, err := w.Write(req); err != nil {
+		return nil, wrapError(err, "failed to send command to hg command server")
+	}
+
+	var out bytes.Buffer
+	for {
+		ch, n, err := readHgChunk(r)
+		if err != nil {
+			return out.Bytes(), wrapError(err, "failed to read from hg command server")
+		}
+
+		switch ch {
+		case 'o', 'e':
+			if _, err = io.CopyN(&out, r, int64(n)); err != nil {
+				return out.Bytes(), wrapError(err, "failed to read from hg command server")
+			}
+		case 'r':
+			var code int32
+			if err = binary.Read(r, binary.BigEndian, &code); err != nil {
+				return out.Bytes(), wrapError(err, "failed to read from hg command server")
+			}
+			if code != 0 {
+				return out.Bytes(), &hgExitError{args: args, code: code}
+			}
+			return out.Bytes(), nil
+		case 'I', 'L':
+			// Commands aren't meant to need input; answer with none.
+			if _, err = w.Write([]byte{0, 0, 0, 0}); err != nil {
+				return out.Bytes(), wrapError(err, "failed to send input to hg command server")
+			}
+		default:
+			// Channels named in upper case must be handled; others may be
+			// ignored.
+			if ch >= 'A' && ch <= 'Z' {
+				return out.Bytes(), errors.Errorf("unexpected hg command server channel %q", ch)
+			}
+			if _, err = io.CopyN(ioutil.Discard, r, int64(n)); err != nil {
+				return out.Bytes(), wrapError(err, "failed to read from hg command server")
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// writeHgChunk writes a message from a fake hg command server.
+func writeHgChunk(w io.Writer, channel byte, data []byte) {
+	hdr := []byte{channel, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+	w.Write(append(hdr, data...))
+}
+
+func hgResult(code int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(code))
+	return b
+}
+
+func TestHgCommandServerProtocol(t *testing.T) {
+	var srv bytes.Buffer
+	writeHgChunk(&srv, 'o', []byte("capabilities: getencoding runcommand\nencoding: UTF-8"))
+	// A successful command, with output on both channels and a request for
+	// input along the way, and optional debug output to ignore.
+	writeHgChunk(&srv, 'o', []byte("tip  "))
+	writeHgChunk(&srv, 'd', []byte("debug"))
+	// Input requests carry the length wanted, rather than data.
+	srv.Write([]byte{'L', 0, 0, 16, 0})
+	writeHgChunk(&srv, 'e', []byte("warning\n"))
+	writeHgChunk(&srv, 'r', hgResult(0))
+	// A failed command.
+	writeHgChunk(&srv, 'e', []byte("abort: unknown revision\n"))
+	writeHgChunk(&srv, 'r', hgResult(255))
+	// A required channel that isn't understood.
+	writeHgChunk(&srv, 'X', nil)
+
+	r := bufio.NewReader(&srv)
+	if err := readHgHello(r); err != nil {
+		t.Fatalf("unexpected error reading hello: %s", err)
+	}
+
+	var req bytes.Buffer
+	out, err := runHgCommand(&req, r, []string{"tags", "--debug"})
+	if err != nil {
+		t.Fatalf("unexpected error running command: %s", err)
+	}
+	if string(out) != "tip  warning\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	wantReq := "runcommand\n\x00\x00\x00\x0ctags\x00--debug" + "\x00\x00\x00\x00"
+	if req.String() != wantReq {
+		t.Errorf("expected request %q, got %q", wantReq, req.String())
+	}
+
+	out, err = runHgCommand(&req, r, []string{"log", "-r", "nope"})
+	if ee, ok := err.(*hgExitError); !ok || ee.code != 255 {
+		t.Errorf("expected exit status 255, got %v", err)
+	}
+	if !strings.HasPrefix(string(out), "abort:") {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	if _, err = runHgCommand(&req, r, []string{"status"}); err == nil {
+		t.Error("expected an error on an unknown required channel")
+	}
+}
+
+func TestHgCommandServerHelloWithoutRunCommand(t *testing.T) {
+	var srv bytes.Buffer
+	writeHgChunk(&srv, 'o', []byte("capabilities: getencoding\nencoding: UTF-8"))
+	if err := readHgHello(&srv); err == nil {
+		t.Error("expected an error from a server that cannot run commands")
+	}
+}
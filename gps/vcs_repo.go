@@ -33,28 +33,49 @@ type ensureCleaner interface {
 	ensureClean(context.Context) error
 }
 
+// integrityChecker is an optional extension of ctxRepo.
+type integrityChecker interface {
+	// checkIntegrity returns an error if the local repository is corrupt, for
+	// example because objects it refers to are missing.
+	checkIntegrity(context.Context) error
+}
+
 // original implementation of these methods come from
 // https://github.com/Masterminds/vcs
 
 type gitRepo struct {
 	*vcs.GitRepo
+	// refspecs, if non-empty, restrict what is fetched from the remote to the
+	// refs they match, in place of all of its branches and tags.
+	refspecs []string
 }
 
 func newVcsRemoteErrorOr(err error, args []string, out, msg string) error {
 	if err == context.Canceled || err == context.DeadlineExceeded {
 		return err
 	}
-	return vcs.NewRemoteError(msg, errors.Wrapf(err, "command failed: %v", args), out)
+	return vcs.NewRemoteError(msg, wrapErrorf(err, "command failed: %v", args), out)
 }
 
 func newVcsLocalErrorOr(err error, args []string, out, msg string) error {
 	if err == context.Canceled || err == context.DeadlineExceeded {
 		return err
 	}
-	return vcs.NewLocalError(msg, errors.Wrapf(err, "command failed: %v", args), out)
+	return vcs.NewLocalError(msg, wrapErrorf(err, "command failed: %v", args), out)
 }
 
 func (r *gitRepo) get(ctx context.Context) error {
+	return r.getFrom(ctx, r.Remote())
+}
+
+// getFrom clones the repository from remote, which may be a mirror of the
+// repository's own remote. Either way, the clone's origin is left as the
+// latter, so that the clone is indistinguishable from one taken directly.
+func (r *gitRepo) getFrom(ctx context.Context, remote string) error {
+	if len(r.refspecs) > 0 {
+		return r.getRefspecsFrom(ctx, remote)
+	}
+
 	cmd := commandContext(
 		ctx,
 		"git",
@@ -62,7 +83,7 @@ func (r *gitRepo) get(ctx context.Context) error {
 		"--recursive",
 		"-v",
 		"--progress",
-		r.Remote(),
+		remote,
 		r.LocalPath(),
 	)
 	// Ensure no prompting for PWs
@@ -72,18 +93,102 @@ func (r *gitRepo) get(ctx context.Context) error {
 			"unable to get repository")
 	}
 
+	if remote == r.Remote() {
+		return nil
+	}
+	cmd = commandContext(ctx, "git", "remote", "set-url", r.RemoteLocation, r.Remote())
+	cmd.SetDir(r.LocalPath())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return newVcsLocalErrorOr(err, cmd.Args(), string(out),
+			"unable to restore remote after cloning from mirror")
+	}
+	return nil
+}
+
+// getRefspecsFrom sets up the repository with only the refs matched by
+// r.refspecs, fetched from remote, rather than cloning everything. Nothing is
+// checked out, as there may be no branch to check out.
+func (r *gitRepo) getRefspecsFrom(ctx context.Context, remote string) error {
+	if err := os.MkdirAll(r.LocalPath(), 0777); err != nil {
+		return err
+	}
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", r.RemoteLocation, r.Remote()},
+		append([]string{"fetch", "--no-tags", remote}, r.refspecs...),
+	} {
+		cmd := commandContext(ctx, "git", args...)
+		cmd.SetDir(r.LocalPath())
+		// Ensure no prompting for PWs
+		cmd.SetEnv(append([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ()...))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.RemoveAll(r.LocalPath())
+			return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
+				"unable to get repository")
+		}
+	}
+	return nil
+}
+
+// getRevision sets up the repository with only rev, a commit hash, and none of
+// its history, which is far quicker than cloning everything when nothing else
+// is needed. Servers may refuse to serve commits by hash, in which case the
+// partial repository is removed.
+func (r *gitRepo) getRevision(ctx context.Context, rev string) error {
+	if err := os.MkdirAll(r.LocalPath(), 0777); err != nil {
+		return err
+	}
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", r.RemoteLocation, r.Remote()},
+		{"fetch", "--depth", "1", r.RemoteLocation, rev},
+		// Leave it checked out, as a clone would be.
+		{"checkout", "--quiet", rev},
+	} {
+		cmd := commandContext(ctx, "git", args...)
+		cmd.SetDir(r.LocalPath())
+		// Ensure no prompting for PWs
+		cmd.SetEnv(append([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ()...))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.RemoveAll(r.LocalPath())
+			return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
+				"unable to get revision from repository")
+		}
+	}
 	return nil
 }
 
+// isShallow reports whether the repository lacks some of its history, as it
+// does after getRevision.
+func (r *gitRepo) isShallow() bool {
+	_, err := os.Stat(filepath.Join(r.LocalPath(), ".git", "shallow"))
+	return err == nil
+}
+
 func (r *gitRepo) fetch(ctx context.Context) error {
-	cmd := commandContext(
-		ctx,
-		"git",
-		"fetch",
-		"--tags",
-		"--prune",
-		r.RemoteLocation,
-	)
+	return r.fetchFrom(ctx, r.Remote())
+}
+
+// fetchFrom updates the repository from remote, which may be a mirror of the
+// repository's own remote.
+func (r *gitRepo) fetchFrom(ctx context.Context, remote string) error {
+	args := []string{"fetch", "--tags", "--prune", r.RemoteLocation}
+	if remote != r.Remote() {
+		// Put the mirror's branches where they'd be had they come from the
+		// remote itself.
+		args = []string{"fetch", "--tags", "--prune", remote, "+refs/heads/*:refs/remotes/" + r.RemoteLocation + "/*"}
+	}
+	if len(r.refspecs) > 0 {
+		// Only what the refspecs match is wanted, from wherever it comes.
+		args = append([]string{"fetch", "--no-tags", "--prune", remote}, r.refspecs...)
+	}
+	if r.isShallow() {
+		// Being up to date includes having all of the history.
+		args = append(args[:1], append([]string{"--unshallow"}, args[1:]...)...)
+	}
+	cmd := commandContext(ctx, "git", args...)
 	cmd.SetDir(r.LocalPath())
 	// Ensure no prompting for PWs
 	cmd.SetEnv(append([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ()...))
@@ -159,6 +264,22 @@ func (r *gitRepo) defendAgainstSubmodules(ctx context.Context) error {
 	return nil
 }
 
+func (r *gitRepo) checkIntegrity(ctx context.Context) error {
+	cmd := commandContext(
+		ctx,
+		"git",
+		"fsck",
+		"--connectivity-only",
+		"--no-dangling",
+	)
+	cmd.SetDir(r.LocalPath())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return newVcsLocalErrorOr(err, cmd.Args(), string(out),
+			"repository failed integrity check")
+	}
+	return nil
+}
+
 func (r *gitRepo) ensureClean(ctx context.Context) error {
 	cmd := commandContext(
 		ctx,
@@ -268,6 +389,9 @@ func (r *bzrRepo) updateVersion(ctx context.Context, version string) error {
 
 type hgRepo struct {
 	*vcs.HgRepo
+	// If non-nil, used to run commands in the local repository without
+	// spawning a process per command.
+	server *hgCommandServer
 }
 
 func (r *hgRepo) get(ctx context.Context) error {
@@ -287,10 +411,20 @@ func (r *hgRepo) fetch(ctx context.Context) error {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
 			"unable to fetch latest changes")
 	}
+	// Make sure the command server sees what was pulled.
+	r.closeServer()
 	return nil
 }
 
 func (r *hgRepo) updateVersion(ctx context.Context, version string) error {
+	if r.server != nil {
+		if out, err := r.server.run(ctx, "update", version); err != nil {
+			return newVcsRemoteErrorOr(err, []string{"hg", "update", version}, string(out),
+				"unable to update checked out version")
+		}
+		return nil
+	}
+
 	cmd := commandContext(ctx, "hg", "update", version)
 	cmd.SetDir(r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
@@ -301,19 +435,43 @@ func (r *hgRepo) updateVersion(ctx context.Context, version string) error {
 	return nil
 }
 
+// closeServer stops the command server, if there is one.
+func (r *hgRepo) closeServer() error {
+	if r.server == nil {
+		return nil
+	}
+	return r.server.close()
+}
+
 type svnRepo struct {
 	*vcs.SvnRepo
+	// If sparse is set, the working copy is checked out without any of the
+	// repository's files, which may be enormous, as only its metadata is
+	// needed to look up revisions. The files of a revision are fetched only
+	// when it is exported; see exportRevision.
+	sparse bool
 }
 
-func (r *svnRepo) get(ctx context.Context) error {
+// remoteURL returns the URL of the repository, with local paths made into
+// file URLs, as svn requires.
+func (r *svnRepo) remoteURL() string {
 	remote := r.Remote()
 	if strings.HasPrefix(remote, "/") {
 		remote = "file://" + remote
 	} else if runtime.GOOS == "windows" && filepath.VolumeName(remote) != "" {
 		remote = "file:///" + remote
 	}
+	return remote
+}
+
+func (r *svnRepo) get(ctx context.Context) error {
+	args := []string{"checkout"}
+	if r.sparse {
+		args = append(args, "--depth", "empty")
+	}
+	args = append(args, r.remoteURL(), r.LocalPath())
 
-	cmd := commandContext(ctx, "svn", "checkout", remote, r.LocalPath())
+	cmd := commandContext(ctx, "svn", args...)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
 			"unable to get repository")
@@ -350,14 +508,6 @@ func (r *svnRepo) CommitInfo(id string) (*vcs.CommitInfo, error) {
 	// svn info does provide details for these but does not have elements like
 	// the commit message.
 	if id == "HEAD" || id == "BASE" {
-		type commit struct {
-			Revision string `xml:"revision,attr"`
-		}
-
-		type info struct {
-			Commit commit `xml:"entry>commit"`
-		}
-
 		cmd := commandContext(ctx, "svn", "info", "-r", id, "--xml")
 		cmd.SetDir(r.LocalPath())
 		out, err := cmd.CombinedOutput()
@@ -366,13 +516,11 @@ func (r *svnRepo) CommitInfo(id string) (*vcs.CommitInfo, error) {
 				"unable to retrieve commit information")
 		}
 
-		infos := new(info)
-		if err := xml.Unmarshal(out, &infos); err != nil {
+		id, err = parseSvnInfoRevision(out)
+		if err != nil {
 			return nil, newVcsLocalErrorOr(err, cmd.Args(), string(out),
 				"unable to retrieve commit information")
 		}
-
-		id = infos.Commit.Revision
 		if id == "" {
 			return nil, vcs.ErrRevisionUnavailable
 		}
@@ -423,3 +571,58 @@ func (r *svnRepo) CommitInfo(id string) (*vcs.CommitInfo, error) {
 
 	return ci, nil
 }
+
+// latestRevision returns the latest revision in which anything under the
+// repository's URL changed, asking the repository itself rather than
+// consulting, or updating, the working copy.
+func (r *svnRepo) latestRevision(ctx context.Context) (string, error) {
+	cmd := commandContext(ctx, "svn", "info", "-r", "HEAD", "--xml", r.remoteURL())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", newVcsRemoteErrorOr(err, cmd.Args(), string(out),
+			"unable to retrieve latest revision")
+	}
+
+	rev, err := parseSvnInfoRevision(out)
+	if err != nil {
+		return "", newVcsLocalErrorOr(err, cmd.Args(), string(out),
+			"unable to retrieve latest revision")
+	}
+	if rev == "" {
+		return "", vcs.ErrRevisionUnavailable
+	}
+	return rev, nil
+}
+
+// exportRevision writes out the files of revision rev, and only that revision,
+// straight from the repository to the new directory to. Unlike updating the
+// working copy to rev, this works for sparse working copies, and leaves no svn
+// metadata in to.
+func (r *svnRepo) exportRevision(ctx context.Context, rev, to string) error {
+	// The peg revision makes sure that the path is looked up as of rev, in
+	// case it has since been moved or deleted.
+	cmd := commandContext(ctx, "svn", "export", "--quiet", "-r", rev, r.remoteURL()+"@"+rev, to)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
+			"unable to export revision")
+	}
+	return nil
+}
+
+// parseSvnInfoRevision returns the revision of the last commit to the entry
+// described by out, the output of `svn info --xml`, or "" if there is none.
+func parseSvnInfoRevision(out []byte) (string, error) {
+	type commit struct {
+		Revision string `xml:"revision,attr"`
+	}
+
+	type info struct {
+		Commit commit `xml:"entry>commit"`
+	}
+
+	infos := new(info)
+	if err := xml.Unmarshal(out, &infos); err != nil {
+		return "", err
+	}
+	return infos.Commit.Revision, nil
+}
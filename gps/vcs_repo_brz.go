@@ -0,0 +1,293 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/vcs"
+)
+
+var (
+	bzrBinaryOnce sync.Once
+	bzrBinaryName string
+)
+
+// bzrBinary returns the command to run for bzr sources: bzr itself, if it is
+// installed, or otherwise brz, from breezy, bzr's successor. brz is a drop-in
+// replacement for bzr, though some of its output differs.
+func bzrBinary() string {
+	bzrBinaryOnce.Do(func() {
+		bzrBinaryName = "bzr"
+		if _, err := exec.LookPath("bzr"); err != nil {
+			if _, err = exec.LookPath("brz"); err == nil {
+				bzrBinaryName = "brz"
+			}
+		}
+	})
+	return bzrBinaryName
+}
+
+// trimBzrRevisionID returns the revision id in b, the output of a bzr or brz
+// command. Some versions of brz print revision ids as Python byte string
+// literals, such as b'user@example.com-20170101000000-abcdef', rather than
+// bare, as bzr does.
+func trimBzrRevisionID(b []byte) []byte {
+	b = bytes.TrimSpace(b)
+	if len(b) >= 3 && b[0] == 'b' && b[len(b)-1] == b[1] && (b[1] == '\'' || b[1] == '"') {
+		return b[2 : len(b)-1]
+	}
+	return b
+}
+
+// brzRepo is a ctxRepo for bzr repositories that uses brz, for when only
+// breezy is installed. The vcs package's BzrRepo cannot be used then, as it
+// requires the bzr binary.
+type brzRepo struct {
+	remote, local string
+}
+
+func newBrzRepo(remote, local string) (*brzRepo, error) {
+	if ltype, err := vcs.DetectVcsFromFS(local); err == nil && ltype != vcs.Bzr {
+		// Found a VCS other than bzr.
+		return nil, vcs.ErrWrongVCS
+	}
+	return &brzRepo{remote: remote, local: local}, nil
+}
+
+func (r *brzRepo) Vcs() vcs.Type {
+	return vcs.Bzr
+}
+
+func (r *brzRepo) Remote() string {
+	return r.remote
+}
+
+func (r *brzRepo) LocalPath() string {
+	return r.local
+}
+
+func (r *brzRepo) get(ctx context.Context) error {
+	basePath := filepath.Dir(filepath.FromSlash(r.local))
+	if _, err := os.Stat(basePath); os.IsNotExist(err) {
+		err = os.MkdirAll(basePath, 0755)
+		if err != nil {
+			return newVcsLocalErrorOr(err, nil, "", "unable to create directory")
+		}
+	}
+
+	cmd := commandContext(ctx, "brz", "branch", r.remote, r.local)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
+			"unable to get repository")
+	}
+
+	return nil
+}
+
+func (r *brzRepo) fetch(ctx context.Context) error {
+	cmd := commandContext(ctx, "brz", "pull")
+	cmd.SetDir(r.local)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
+			"unable to update repository")
+	}
+	return nil
+}
+
+func (r *brzRepo) updateVersion(ctx context.Context, version string) error {
+	cmd := commandContext(ctx, "brz", "update", "-r", version)
+	cmd.SetDir(r.local)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return newVcsLocalErrorOr(err, cmd.Args(), string(out),
+			"unable to update checked out version")
+	}
+	return nil
+}
+
+func (r *brzRepo) Get() error {
+	return r.get(context.TODO())
+}
+
+func (r *brzRepo) Init() error {
+	if err := os.MkdirAll(r.local, 0755); err != nil {
+		return vcs.NewLocalError("Unable to create directory", err, "")
+	}
+	if out, err := r.RunFromDir("brz", "init"); err != nil {
+		return vcs.NewLocalError("Unable to initialize repository", err, string(out))
+	}
+	return nil
+}
+
+func (r *brzRepo) Update() error {
+	if err := r.fetch(context.TODO()); err != nil {
+		return err
+	}
+	if out, err := r.RunFromDir("brz", "update"); err != nil {
+		return vcs.NewRemoteError("Unable to update repository", err, string(out))
+	}
+	return nil
+}
+
+func (r *brzRepo) UpdateVersion(version string) error {
+	return r.updateVersion(context.TODO(), version)
+}
+
+func (r *brzRepo) Version() (string, error) {
+	out, err := r.RunFromDir("brz", "revno", "--tree")
+	if err != nil {
+		return "", vcs.NewLocalError("Unable to retrieve checked out version", err, string(out))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (r *brzRepo) Current() (string, error) {
+	tip, err := r.CommitInfo("-1")
+	if err != nil {
+		return "", err
+	}
+
+	curr, err := r.Version()
+	if err != nil {
+		return "", err
+	}
+
+	if tip.Commit == curr {
+		return "-1", nil
+	}
+
+	ts, err := r.TagsFromCommit(curr)
+	if err != nil {
+		return "", err
+	}
+	if len(ts) > 0 {
+		return ts[0], nil
+	}
+
+	return curr, nil
+}
+
+func (r *brzRepo) Date() (time.Time, error) {
+	out, err := r.RunFromDir("brz", "version-info", "--custom", "--template={date}")
+	if err != nil {
+		return time.Time{}, vcs.NewLocalError("Unable to retrieve revision date", err, string(out))
+	}
+	t, err := time.Parse("2006-01-02 15:04:05 -0700", strings.TrimSpace(string(out)))
+	if err != nil {
+		return time.Time{}, vcs.NewLocalError("Unable to retrieve revision date", err, string(out))
+	}
+	return t, nil
+}
+
+func (r *brzRepo) CheckLocal() bool {
+	_, err := os.Stat(filepath.Join(r.local, ".bzr"))
+	return err == nil
+}
+
+func (r *brzRepo) Branches() ([]string, error) {
+	// As with bzr, each branch is a repository of its own.
+	return nil, nil
+}
+
+func (r *brzRepo) Tags() ([]string, error) {
+	return r.tags("tags")
+}
+
+func (r *brzRepo) TagsFromCommit(id string) ([]string, error) {
+	return r.tags("tags", "-r", id)
+}
+
+// tags runs brz with args, returning the tag named on each line of its output.
+func (r *brzRepo) tags(args ...string) ([]string, error) {
+	out, err := r.RunFromDir("brz", args...)
+	if err != nil {
+		return nil, vcs.NewLocalError("Unable to retrieve tags", err, string(out))
+	}
+
+	var tags []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			tags = append(tags, fields[0])
+		}
+	}
+	return tags, nil
+}
+
+func (r *brzRepo) IsReference(ref string) bool {
+	_, err := r.RunFromDir("brz", "revno", "-r", ref)
+	return err == nil
+}
+
+func (r *brzRepo) IsDirty() bool {
+	out, err := r.RunFromDir("brz", "diff")
+	return err != nil || len(out) != 0
+}
+
+func (r *brzRepo) CommitInfo(id string) (*vcs.CommitInfo, error) {
+	out, err := r.RunFromDir("brz", "log", "-r"+id, "--log-format=long")
+	if err != nil {
+		return nil, vcs.ErrRevisionUnavailable
+	}
+
+	ci := &vcs.CommitInfo{}
+	const format = "Mon 2006-01-02 15:04:05 -0700"
+	var message []string
+	var inMessage bool
+	for _, l := range strings.Split(string(out), "\n") {
+		switch {
+		case inMessage:
+			message = append(message, l)
+		case strings.HasPrefix(l, "revno:"):
+			ci.Commit = strings.TrimSpace(strings.TrimPrefix(l, "revno:"))
+		case strings.HasPrefix(l, "committer:"):
+			ci.Author = strings.TrimSpace(strings.TrimPrefix(l, "committer:"))
+		case strings.HasPrefix(l, "timestamp:"):
+			ts := strings.TrimSpace(strings.TrimPrefix(l, "timestamp:"))
+			ci.Date, err = time.Parse(format, ts)
+			if err != nil {
+				return nil, vcs.NewLocalError("Unable to retrieve commit information", err, string(out))
+			}
+		case strings.TrimSpace(l) == "message:":
+			inMessage = true
+		}
+	}
+	ci.Message = strings.TrimSpace(strings.Join(message, ""))
+
+	// Didn't find the revision
+	if ci.Author == "" {
+		return nil, vcs.ErrRevisionUnavailable
+	}
+
+	return ci, nil
+}
+
+func (r *brzRepo) Ping() bool {
+	_, err := exec.Command("brz", "info", r.remote).CombinedOutput()
+	return err == nil
+}
+
+func (r *brzRepo) RunFromDir(cmd string, args ...string) ([]byte, error) {
+	return r.CmdFromDir(cmd, args...).CombinedOutput()
+}
+
+func (r *brzRepo) CmdFromDir(cmd string, args ...string) *exec.Cmd {
+	c := exec.Command(cmd, args...)
+	c.Dir = r.local
+	return c
+}
+
+func (r *brzRepo) ExportDir(dir string) error {
+	if out, err := r.RunFromDir("brz", "export", dir); err != nil {
+		return vcs.NewLocalError("Unable to export source", err, string(out))
+	}
+	return nil
+}
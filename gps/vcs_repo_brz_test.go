@@ -0,0 +1,22 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "testing"
+
+func TestTrimBzrRevisionID(t *testing.T) {
+	cases := map[string]string{
+		"matt@mattfarina.com-20150731135137-pbphasfppmygpl68\n":   "matt@mattfarina.com-20150731135137-pbphasfppmygpl68",
+		" b'matt@mattfarina.com-20150731135137-pbphasfppmygpl68'": "matt@mattfarina.com-20150731135137-pbphasfppmygpl68",
+		`b"matt@mattfarina.com-20150731135137-pbphasfppmygpl68"`:  "matt@mattfarina.com-20150731135137-pbphasfppmygpl68",
+		"bob@example.com-20170101000000-abcdef":                   "bob@example.com-20170101000000-abcdef",
+		"b'unterminated":                                          "b'unterminated",
+	}
+	for in, want := range cases {
+		if got := string(trimBzrRevisionID([]byte(in))); got != want {
+			t.Errorf("trimBzrRevisionID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
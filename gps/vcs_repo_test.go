@@ -9,6 +9,8 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -71,7 +73,7 @@ func testSvnRepo(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	repo := &svnRepo{rep}
+	repo := &svnRepo{SvnRepo: rep}
 
 	// Do an initial checkout.
 	err = repo.get(ctx)
@@ -141,6 +143,89 @@ func testSvnRepo(t *testing.T) {
 	}
 }
 
+func testSvnSparseRepo(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("Skipping slow test in short mode")
+	}
+	requiresBins(t, "svn")
+
+	ctx := context.Background()
+	tempDir, err := ioutil.TempDir("", "go-vcs-svn-sparse-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = os.RemoveAll(tempDir)
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	rep, err := vcs.NewSvnRepo("https://github.com/Masterminds/VCSTestRepo/trunk", filepath.Join(tempDir, "VCSTestRepo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &svnRepo{SvnRepo: rep, sparse: true}
+
+	if err = repo.get(ctx); err != nil {
+		t.Fatalf("Unable to checkout SVN repo. Err was %s", err)
+	}
+	if !repo.CheckLocal() {
+		t.Fatal("Problem checking out repo or SVN CheckLocal is not working")
+	}
+	if _, err = os.Stat(filepath.Join(repo.LocalPath(), "README.md")); !os.IsNotExist(err) {
+		t.Errorf("expected no files in sparse working copy, got %v", err)
+	}
+
+	// Revisions can still be looked up without any files.
+	if _, err = repo.CommitInfo("2"); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := repo.latestRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest == "" || latest == "2" {
+		t.Errorf("unexpected latest revision %q", latest)
+	}
+
+	to := filepath.Join(tempDir, "export")
+	if err = repo.exportRevision(ctx, "2", to); err != nil {
+		t.Fatalf("Unable to export SVN revision. Err was %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(to, "README.md")); err != nil {
+		t.Errorf("expected README.md in export: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(to, ".svn")); !os.IsNotExist(err) {
+		t.Errorf("expected no svn metadata in export, got %v", err)
+	}
+}
+
+func TestParseSvnInfoRevision(t *testing.T) {
+	out := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<info>
+<entry kind="dir" path="trunk" revision="5">
+<url>https://example.com/svn/trunk</url>
+<commit revision="4">
+<author>someone</author>
+</commit>
+</entry>
+</info>`)
+	rev, err := parseSvnInfoRevision(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != "4" {
+		t.Errorf("expected revision 4, got %q", rev)
+	}
+
+	if _, err = parseSvnInfoRevision([]byte("svn: E170000: not xml")); err == nil {
+		t.Error("expected an error parsing non-XML output")
+	}
+}
+
 func testHgRepo(t *testing.T) {
 	t.Parallel()
 
@@ -166,7 +251,7 @@ func testHgRepo(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	repo := &hgRepo{rep}
+	repo := &hgRepo{HgRepo: rep}
 
 	// Do an initial clone.
 	err = repo.get(ctx)
@@ -226,7 +311,7 @@ func testGitRepo(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	repo := &gitRepo{rep}
+	repo := &gitRepo{GitRepo: rep}
 
 	// Do an initial clone.
 	err = repo.get(ctx)
@@ -346,3 +431,50 @@ func testBzrRepo(t *testing.T) {
 		t.Fatalf("Current failed to detect Bzr on rev 2 of branch. Got version: %s", v)
 	}
 }
+
+func TestGitRepoCheckIntegrity(t *testing.T) {
+	requiresBins(t, "git")
+
+	tempDir, err := ioutil.TempDir("", "go-vcs-git-integrity-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=gps", "-c", "user.email=gps@example.com"}, args...)...)
+		cmd.Dir = tempDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, out)
+		}
+	}
+	git("init")
+	git("remote", "add", "origin", gitRemoteTestRepo)
+	if err = ioutil.WriteFile(filepath.Join(tempDir, "file"), []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "file")
+	git("commit", "-m", "initial")
+
+	rep, err := vcs.NewGitRepo(gitRemoteTestRepo, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &gitRepo{GitRepo: rep}
+
+	ctx := context.Background()
+	if err = repo.checkIntegrity(ctx); err != nil {
+		t.Fatalf("expected an intact repository to pass, got %s", err)
+	}
+
+	// Remove the blob for file, leaving the commit that refers to it dangling.
+	blob := filepath.Join(tempDir, ".git", "objects", "08", "39b2e9412b314cb8bb9a20f587aa13752ae310")
+	os.Chmod(blob, 0644)
+	if err = os.Remove(blob); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repo.checkIntegrity(ctx); err == nil {
+		t.Error("expected a repository with a missing object to fail")
+	}
+}
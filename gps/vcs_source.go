@@ -8,10 +8,16 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/golang/dep/gps/pkgtree"
@@ -23,6 +29,10 @@ type baseVCSSource struct {
 	repo ctxRepo
 }
 
+func (bs *baseVCSSource) localPath() string {
+	return bs.repo.LocalPath()
+}
+
 func (bs *baseVCSSource) sourceType() string {
 	return string(bs.repo.Vcs())
 }
@@ -61,7 +71,7 @@ func (bs *baseVCSSource) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 		return nil, nil, unwrapVcsErr(err)
 	}
 
-	m, l, err := an.DeriveManifestAndLock(bs.repo.LocalPath(), pr)
+	m, l, err := DeriveManifestAndLock(ctx, an, bs.repo.LocalPath(), pr)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -73,10 +83,19 @@ func (bs *baseVCSSource) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 	return prepManifest(m), l, nil
 }
 
-func (bs *baseVCSSource) revisionPresentIn(r Revision) (bool, error) {
+func (bs *baseVCSSource) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
 	return bs.repo.IsReference(string(r)), nil
 }
 
+// commitTime returns the date recorded for r by the VCS.
+func (bs *baseVCSSource) commitTime(ctx context.Context, r Revision) (time.Time, error) {
+	ci, err := bs.repo.CommitInfo(string(r))
+	if err != nil {
+		return time.Time{}, unwrapVcsErr(err)
+	}
+	return ci.Date, nil
+}
+
 // initLocal clones/checks out the upstream repository to disk for the first
 // time.
 func (bs *baseVCSSource) initLocal(ctx context.Context) error {
@@ -123,6 +142,34 @@ func (bs *baseVCSSource) maybeClean(ctx context.Context) error {
 	return nil
 }
 
+// verifyLocal returns an error if the local repository is missing or corrupt.
+func (bs *baseVCSSource) verifyLocal(ctx context.Context) error {
+	if !bs.repo.CheckLocal() {
+		return errors.Errorf("no local repository at %s", bs.repo.LocalPath())
+	}
+
+	ic, ok := bs.repo.(integrityChecker)
+	if !ok {
+		return nil
+	}
+	return unwrapVcsErr(ic.checkIntegrity(ctx))
+}
+
+// quarantineLocal moves the local repository aside into dir, leaving it for
+// inspection, and returns its new location.
+func (bs *baseVCSSource) quarantineLocal(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+
+	lp := bs.repo.LocalPath()
+	to := filepath.Join(dir, fmt.Sprintf("%s-%d", filepath.Base(lp), time.Now().UnixNano()))
+	if err := fs.RenameWithFallback(lp, to); err != nil {
+		return "", err
+	}
+	return to, nil
+}
+
 func (bs *baseVCSSource) listPackages(ctx context.Context, pr ProjectRoot, r Revision) (ptree pkgtree.PackageTree, err error) {
 	err = bs.repo.updateVersion(ctx, r.String())
 
@@ -157,18 +204,397 @@ var (
 // all standard git remotes.
 type gitSource struct {
 	baseVCSSource
+	redirmu   sync.Mutex // guards redirect, retrieved and wasRetrieved
+	redirect  string     // URL that upstream last redirected to, if any
+	retrieved string     // mirror that the source was last retrieved or listed from, if any
+	// wasRetrieved is whether the source has been retrieved or listed at all,
+	// and so whether retrieved is known.
+	wasRetrieved bool
+	// mirrors are the URLs, in order, of mirrors to fail over to when the
+	// upstream URL cannot be reached.
+	mirrors []string
+	// mirrorsOnly is whether upstream is never to be contacted, leaving only
+	// the mirrors.
+	mirrorsOnly bool
+	// If non-nil, used to check for the presence of revisions without
+	// spawning a process per check.
+	batch *gitBatchChecker
+	// If non-nil, used to list versions instead of ls-remote.
+	github *githubAPI
+	// shared are the paths, in order, that copies of the repository would
+	// have in shared read-only caches, to clone instead of upstream.
+	shared []string
+}
+
+func (s *gitSource) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	if s.batch == nil || !s.repo.CheckLocal() {
+		return s.baseVCSSource.revisionPresentIn(ctx, r)
+	}
+	present, err := s.batch.hasCommit(string(r))
+	if err != nil {
+		// Fall back to checking the slow way.
+		return s.baseVCSSource.revisionPresentIn(ctx, r)
+	}
+	return present, nil
+}
+
+// close releases the revision checking process, if it is running.
+func (s *gitSource) close() error {
+	if s.batch == nil {
+		return nil
+	}
+	return s.batch.close()
+}
+
+func (s *gitSource) quarantineLocal(dir string) (string, error) {
+	// The revision checking process must not keep running in the old location.
+	s.close()
+	return s.baseVCSSource.quarantineLocal(dir)
+}
+
+func (s *gitSource) setMirrors(urls []string, only bool) {
+	s.mirrors = urls
+	s.mirrorsOnly = only
+}
+
+// errMirrorsOnly is what contacting upstream fails with, when only mirrors may
+// be contacted.
+var errMirrorsOnly = errors.New("upstream may not be contacted directly, only its mirrors")
+
+func (s *gitSource) setFetchRefspecs(refspecs []string) {
+	if gr, ok := s.repo.(*gitRepo); ok {
+		gr.refspecs = refspecs
+	}
+}
+
+// fetchRefspecs returns the refspecs restricting what is fetched from
+// upstream, if any.
+func (s *gitSource) fetchRefspecs() []string {
+	if gr, ok := s.repo.(*gitRepo); ok {
+		return gr.refspecs
+	}
+	return nil
+}
+
+// refspecsMatch reports whether ref, the full name of a ref upstream, is
+// fetched by refspecs: whether it matches the source of one of them, and none
+// of the negative ones, prefixed with ^, that exclude refs.
+func refspecsMatch(refspecs []string, ref string) bool {
+	var matched bool
+	for _, spec := range refspecs {
+		if strings.HasPrefix(spec, "^") {
+			if refPatternMatch(spec[1:], ref) {
+				return false
+			}
+			continue
+		}
+		src := strings.TrimPrefix(spec, "+")
+		if i := strings.IndexByte(src, ':'); i != -1 {
+			src = src[:i]
+		}
+		if refPatternMatch(src, ref) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// refPatternMatch reports whether ref matches pattern, the source side of a
+// refspec, which may include a single * matching any sequence of characters.
+func refPatternMatch(pattern, ref string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i == -1 {
+		return pattern == ref
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	return len(ref) >= len(prefix)+len(suffix) &&
+		strings.HasPrefix(ref, prefix) && strings.HasSuffix(ref, suffix)
+}
+
+// existsUpstream reports whether upstream, or failing that any mirror, can be
+// reached.
+func (s *gitSource) existsUpstream(ctx context.Context) bool {
+	if !s.mirrorsOnly && s.baseVCSSource.existsUpstream(ctx) {
+		return true
+	}
+	for _, m := range s.mirrors {
+		if _, err := s.lsRemote(ctx, m); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// initLocal clones upstream to disk for the first time, failing over to each
+// mirror in turn if it cannot be cloned.
+func (s *gitSource) initLocal(ctx context.Context) error {
+	if ok, err := s.initLocalFromShared(ctx); ok {
+		return err
+	}
+
+	err := errMirrorsOnly
+	if !s.mirrorsOnly {
+		err = s.baseVCSSource.initLocal(ctx)
+	}
+	gr, ok := s.repo.(*gitRepo)
+	if !ok {
+		return err
+	}
+	var from string
+	for _, m := range s.mirrors {
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		err = unwrapVcsErr(gr.getFrom(ctx, m))
+		from = m
+	}
+	if err == nil {
+		s.setRetrievedFrom(from)
+	}
+	return err
+}
+
+// initLocalAt sets up the local copy with only revision r, rather than
+// cloning the whole of upstream.
+func (s *gitSource) initLocalAt(ctx context.Context, r Revision) error {
+	gr, ok := s.repo.(*gitRepo)
+	if !ok {
+		return errors.New("not a git repository")
+	}
+	if s.mirrorsOnly {
+		return errMirrorsOnly
+	}
+	return unwrapVcsErr(gr.getRevision(ctx, string(r)))
+}
+
+// updateLocal updates the local copy from upstream, failing over to each
+// mirror in turn if it cannot be updated.
+func (s *gitSource) updateLocal(ctx context.Context) error {
+	err := errMirrorsOnly
+	if !s.mirrorsOnly {
+		err = s.baseVCSSource.updateLocal(ctx)
+	}
+	gr, ok := s.repo.(*gitRepo)
+	if !ok {
+		return err
+	}
+	var from string
+	for _, m := range s.mirrors {
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		err = unwrapVcsErr(gr.fetchFrom(ctx, m))
+		from = m
+	}
+	if err == nil {
+		s.setRetrievedFrom(from)
+		// Make sure the revision checking process sees what was fetched.
+		s.close()
+	}
+	return err
+}
+
+func (s *gitSource) setRetrievedFrom(url string) {
+	s.redirmu.Lock()
+	s.retrieved = url
+	s.wasRetrieved = true
+	s.redirmu.Unlock()
+}
+
+func (s *gitSource) retrievedFrom() (string, bool) {
+	s.redirmu.Lock()
+	defer s.redirmu.Unlock()
+	// Without mirrors, there is nowhere but upstream it could have come from.
+	return s.retrieved, s.wasRetrieved || len(s.mirrors) == 0
+}
+
+// gitRedirectPrefix introduces the warning git emits when the remote redirects
+// it to another URL.
+const gitRedirectPrefix = "warning: redirecting to "
+
+// noteRedirect records the URL that upstream redirected to, if out, the output
+// of a git command that talked to upstream, reports one.
+//
+// git reports temporary and permanent redirects alike, but only follows those
+// on its initial request; in practice, these are overwhelmingly due to
+// repositories having been moved or renamed.
+func (s *gitSource) noteRedirect(out []byte) {
+	var to string
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if bytes.HasPrefix(line, []byte(gitRedirectPrefix)) {
+			to = strings.TrimSuffix(string(line[len(gitRedirectPrefix):]), "/")
+			if !strings.HasSuffix(s.repo.Remote(), ".git") {
+				// git adds the suffix itself when trying the remote.
+				to = strings.TrimSuffix(to, ".git")
+			}
+			break
+		}
+	}
+
+	s.redirmu.Lock()
+	s.redirect = to
+	s.redirmu.Unlock()
+}
+
+func (s *gitSource) redirectedURL() (from, to string) {
+	s.redirmu.Lock()
+	defer s.redirmu.Unlock()
+	return s.repo.Remote(), s.redirect
 }
 
 func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to string) error {
+	return s.checkoutRevisionTo(ctx, rev, to, nil)
+}
+
+// exportPrunedRevisionTo writes out only those parts of rev that can survive
+// pruning of unused packages, then prunes them as usual. For projects of which
+// only a few packages are used, this is far quicker than writing everything
+// out only to delete most of it.
+//
+// As with a full export, license files are kept from every directory, as are
+// the files that the used packages' cgo preambles include from elsewhere in
+// the project, which pruning keeps too. Other files outside of the used
+// packages' directories are assumed not to be needed by them.
+func (s *gitSource) exportPrunedRevisionTo(ctx context.Context, rev Revision, lp LockedProject, prune PruneOptions, to string) error {
+	var files, paths []string
+	if prune&PruneUnusedPackages != 0 {
+		cmd := commandContext(ctx, "git", "ls-tree", "-r", "-z", "--name-only", rev.String())
+		cmd.SetDir(s.repo.LocalPath())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return wrapError(err, string(out))
+		}
+		files = strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+		paths = sparseExportPaths(files, lp.Packages())
+	}
+
+	if err := s.checkoutRevisionTo(ctx, rev, to, paths); err != nil {
+		return err
+	}
+
+	// What the packages include can only be found once they are written out.
+	if paths != nil {
+		incs, err := sparseIncludePaths(to, files, paths, lp.Packages())
+		if err != nil {
+			return err
+		}
+		if len(incs) > 0 {
+			if err = s.checkoutRevisionTo(ctx, rev, to, incs); err != nil {
+				return err
+			}
+		}
+	}
+	return PruneProject(to, lp, prune)
+}
+
+// sparseExportPaths returns those of files, the slash-separated paths of all
+// files in a revision, which are needed to export the packages pkgs: the files
+// in and beneath the packages' directories, and every license file, as pruning
+// never removes those. It returns nil if every file is needed.
+func sparseExportPaths(files []string, pkgs []string) []string {
+	for _, pkg := range pkgs {
+		if pkg == "." {
+			return nil
+		}
+	}
+
+	var paths []string
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		if isPreservedFile(path.Base(f)) {
+			paths = append(paths, f)
+			continue
+		}
+		dir := path.Dir(f)
+		for _, pkg := range pkgs {
+			if dir == pkg || strings.HasPrefix(dir, pkg+"/") {
+				paths = append(paths, f)
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// sparseIncludePaths returns those of files, the slash-separated paths of all
+// files in a revision, that are included by the cgo preambles of the go files
+// of the packages pkgs, as written out beneath to, and are not already among
+// exported.
+func sparseIncludePaths(to string, files, exported, pkgs []string) ([]string, error) {
+	all := make(map[string]bool, len(files))
+	for _, f := range files {
+		all[f] = true
+	}
+	for _, f := range exported {
+		all[f] = false
+	}
+
+	var incs []string
+	for _, pkg := range pkgs {
+		dir := filepath.Join(to, filepath.FromSlash(pkg))
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, fi := range fis {
+			if !fi.Mode().IsRegular() || !strings.HasSuffix(fi.Name(), ".go") {
+				continue
+			}
+			src, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+			if err != nil {
+				return nil, err
+			}
+			// Files that can't be parsed can't be built either.
+			rels, _ := pkgtree.CgoIncludes(src)
+			for _, rel := range rels {
+				if f := path.Join(pkg, rel); all[f] {
+					incs = append(incs, f)
+					all[f] = false
+				}
+			}
+		}
+	}
+	return incs, nil
+}
+
+// checkoutRevisionTo writes out paths, or every file if paths is nil, from rev
+// to the directory to, then verifies that what was written matches rev. If to
+// is on a case-insensitive filesystem, and any of the paths to be written out
+// differ only by case, it returns a *CaseCollisionError without writing any.
+func (s *gitSource) checkoutRevisionTo(ctx context.Context, rev Revision, to string, paths []string) error {
 	r := s.repo
 
-	if err := os.MkdirAll(to, 0777); err != nil {
+	entries, err := s.lsTree(ctx, rev)
+	if err != nil {
+		return err
+	}
+	entries = exportedEntries(entries, paths)
+
+	if err = os.MkdirAll(to, 0777); err != nil {
 		return err
 	}
 
+	// On a case-insensitive filesystem, files whose paths differ only by case
+	// would be silently written over each other.
+	if sensitive, err := fs.IsCaseSensitiveFilesystem(to); err == nil && !sensitive {
+		files := make([]string, len(entries))
+		for i, e := range entries {
+			files[i] = e.path
+		}
+		if colls := caseCollisions(files); len(colls) > 0 {
+			return &CaseCollisionError{Revision: rev, Path: to, Collisions: colls}
+		}
+	}
+
 	// Back up original index
 	idx, bak := filepath.Join(r.LocalPath(), ".git", "index"), filepath.Join(r.LocalPath(), ".git", "origindex")
-	err := fs.RenameWithFallback(idx, bak)
+	err = fs.RenameWithFallback(idx, bak)
 	if err != nil {
 		return err
 	}
@@ -180,7 +606,7 @@ func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to strin
 		cmd := commandContext(ctx, "git", "read-tree", rev.String())
 		cmd.SetDir(r.LocalPath())
 		if out, err := cmd.CombinedOutput(); err != nil {
-			return errors.Wrap(err, string(out))
+			return wrapError(err, string(out))
 		}
 	}
 
@@ -195,15 +621,22 @@ func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to strin
 	// though we have a bunch of housekeeping to do to set up, then tear
 	// down, the sparse checkout controls, as well as restore the original
 	// index and HEAD.
+	//
+	// core.longpaths lets git for Windows write out files whose paths exceed
+	// MAX_PATH; it is ignored elsewhere.
 	{
-		cmd := commandContext(ctx, "git", "checkout-index", "-a", "--prefix="+to)
+		cmd := commandContext(ctx, "git", "-c", "core.longpaths=true", "checkout-index", "-a", "--prefix="+to)
+		if paths != nil {
+			cmd = commandContext(ctx, "git", "-c", "core.longpaths=true", "checkout-index", "-z", "--stdin", "--prefix="+to)
+			cmd.Cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00"))
+		}
 		cmd.SetDir(r.LocalPath())
 		if out, err := cmd.CombinedOutput(); err != nil {
-			return errors.Wrap(err, string(out))
+			return wrapError(err, string(out))
 		}
 	}
 
-	return nil
+	return s.verifyExportedEntries(ctx, rev, to, entries)
 }
 
 func (s *gitSource) isValidHash(hash []byte) bool {
@@ -214,10 +647,12 @@ func (*gitSource) existsCallsListVersions() bool {
 	return true
 }
 
-func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, err error) {
+// lsRemote returns the output of git ls-remote for remote, which is expected to
+// be either upstream or one of its mirrors.
+func (s *gitSource) lsRemote(ctx context.Context, remote string) ([]byte, error) {
 	r := s.repo
 
-	cmd := commandContext(ctx, "git", "ls-remote", r.Remote())
+	cmd := commandContext(ctx, "git", "ls-remote", remote)
 	// We want to invoke from a place where it's not possible for there to be a
 	// .git file instead of a .git directory, as git ls-remote will choke on the
 	// former and erroneously quit. However, we can't be sure that the repo
@@ -232,9 +667,45 @@ func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, er
 	cmd.SetEnv(append([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ()...))
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return nil, errors.Wrap(err, string(out))
+		return nil, wrapError(err, string(out))
+	}
+	return out, nil
+}
+
+func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, err error) {
+	if s.github != nil && !s.mirrorsOnly {
+		if u, perr := url.Parse(s.repo.Remote()); perr == nil {
+			vlist, err = s.github.listVersions(ctx, u, s.fetchRefspecs())
+			if err == nil {
+				return vlist, nil
+			}
+			// Repositories the token has no access to may still be reachable
+			// with git's own credentials, and git is not subject to the
+			// token's rate limit.
+		}
 	}
 
+	var out []byte
+	err = errMirrorsOnly
+	if !s.mirrorsOnly {
+		out, err = s.lsRemote(ctx, s.repo.Remote())
+		if err == nil {
+			s.noteRedirect(out)
+		}
+	}
+	var from string
+	for _, m := range s.mirrors {
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		out, err = s.lsRemote(ctx, m)
+		from = m
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.setRetrievedFrom(from)
+
 	all := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
 	if len(all) == 1 && len(all[0]) == 0 {
 		return nil, fmt.Errorf("no data returned from ls-remote")
@@ -268,6 +739,7 @@ func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, er
 	// erroneous non-default branch in their lock file.
 	var headrev Revision
 	var onedef, multidef, defmaster bool
+	refspecs := s.fetchRefspecs()
 
 	smap := make(map[string]int)
 	uniq := 0
@@ -281,6 +753,11 @@ func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, er
 		if len(pair) < 45 || pair[40] != '\t' || !s.isValidHash(pair[:40]) {
 			continue
 		}
+		if len(refspecs) > 0 && string(pair[41:]) != "HEAD" &&
+			!refspecsMatch(refspecs, strings.TrimSuffix(string(pair[41:]), "^{}")) {
+			// Versions that aren't fetched can't be used.
+			continue
+		}
 		if string(pair[41:]) == "HEAD" {
 			// If HEAD is present, it's always first
 			headrev = Revision(pair[:40])
@@ -351,6 +828,129 @@ func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, er
 	return
 }
 
+// verifySignature checks the signature of tag, if non-empty, or else of the
+// commit r, with git verify-tag or git verify-commit, using only the keys in
+// keyring.
+func (s *gitSource) verifySignature(ctx context.Context, keyring, tag string, r Revision) (string, error) {
+	args := []string{"verify-commit", "--raw", string(r)}
+	if tag != "" {
+		args = []string{"verify-tag", "--raw", "refs/tags/" + tag}
+	}
+	cmd := commandContext(ctx, "git", args...)
+	cmd.SetDir(s.repo.LocalPath())
+	cmd.SetEnv(append([]string{"GNUPGHOME=" + keyring}, os.Environ()...))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", wrapError(err, string(out))
+	}
+
+	signer := gpgValidSigner(out)
+	if signer == "" {
+		return "", errors.Errorf("no valid signature found:\n%s", out)
+	}
+	if tag != "" {
+		// The tag must still refer to the revision it's paired with, lest the
+		// signature be for something else.
+		cmd = commandContext(ctx, "git", "rev-parse", "--verify", "refs/tags/"+tag+"^{commit}")
+		cmd.SetDir(s.repo.LocalPath())
+		out, err = cmd.CombinedOutput()
+		if err != nil {
+			return "", wrapError(err, string(out))
+		}
+		if rev := Revision(bytes.TrimSpace(out)); rev != r {
+			return "", errors.Errorf("tag %s refers to %s locally, not %s", tag, rev, r)
+		}
+	}
+	return signer, nil
+}
+
+// commitTime returns the committer date of r, which git's CommitInfo, giving
+// the author date, does not.
+func (s *gitSource) commitTime(ctx context.Context, r Revision) (time.Time, error) {
+	cmd := commandContext(ctx, "git", "show", "-s", "--format=%ct", string(r))
+	cmd.SetDir(s.repo.LocalPath())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return time.Time{}, wrapError(err, string(out))
+	}
+	secs, err := strconv.ParseInt(string(bytes.TrimSpace(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, wrapErrorf(err, "unexpected commit date of %s", r)
+	}
+	return time.Unix(secs, 0), nil
+}
+
+// gpgValidSigner returns the fingerprint of the key that made the signature
+// reported valid in out, GnuPG's machine-readable status output, or the empty
+// string if there is none.
+func gpgValidSigner(out []byte) string {
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) >= 3 && f[0] == "[GNUPG:]" && f[1] == "VALIDSIG" {
+			return f[2]
+		}
+	}
+	return ""
+}
+
+// gitTagInfoFormat is the git for-each-ref format from which parseGitTagInfo
+// reads the metadata of tags. Fields are separated by NULs, and the annotation,
+// which may span lines, is last, so each tag's output ends with a NUL and a
+// newline.
+const gitTagInfoFormat = "%(refname)%00%(objecttype)%00%(objectname)%00%(*objectname)%00" +
+	"%(taggername)%00%(taggeremail)%00%(taggerdate:unix)%00%(committerdate:unix)%00" +
+	"%(contents)%00"
+
+// listTagInfo reads the metadata of the tags in the local copy.
+func (s *gitSource) listTagInfo(ctx context.Context) (map[string]TagInfo, error) {
+	cmd := commandContext(ctx, "git", "for-each-ref", "--format="+gitTagInfoFormat, "refs/tags")
+	cmd.SetDir(s.repo.LocalPath())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, wrapError(err, string(out))
+	}
+	return parseGitTagInfo(out)
+}
+
+// parseGitTagInfo parses the output of git for-each-ref with gitTagInfoFormat.
+func parseGitTagInfo(out []byte) (map[string]TagInfo, error) {
+	tis := make(map[string]TagInfo)
+	for _, rec := range bytes.Split(out, []byte("\x00\n")) {
+		if len(bytes.TrimSpace(rec)) == 0 {
+			continue
+		}
+		f := strings.Split(string(rec), "\x00")
+		if len(f) != 9 {
+			return nil, errors.Errorf("unexpected tag metadata from git: %q", rec)
+		}
+
+		ti := TagInfo{
+			Name:     strings.TrimPrefix(f[0], "refs/tags/"),
+			Revision: Revision(f[2]),
+		}
+		date := f[7]
+		if f[1] == "tag" {
+			ti.Annotated = true
+			ti.Revision = Revision(f[3])
+			ti.Tagger = strings.TrimSpace(f[4] + " " + f[5])
+			ti.Annotation = f[8]
+			date = f[6]
+		} else if f[1] != "commit" {
+			// Tags of trees and blobs aren't versions.
+			continue
+		}
+		if date != "" {
+			secs, err := strconv.ParseInt(date, 10, 64)
+			if err != nil {
+				return nil, wrapErrorf(err, "unexpected date of tag %q", ti.Name)
+			}
+			ti.Date = time.Unix(secs, 0)
+		}
+		tis[ti.Name] = ti
+	}
+	return tis, nil
+}
+
 // gopkginSource is a specialized git source that performs additional filtering
 // according to the input URL.
 type gopkginSource struct {
@@ -470,20 +1070,20 @@ func (s *bzrSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 	r := s.repo
 
 	// Now, list all the tags
-	tagsCmd := commandContext(ctx, "bzr", "tags", "--show-ids", "-v")
+	tagsCmd := commandContext(ctx, bzrBinary(), "tags", "--show-ids", "-v")
 	tagsCmd.SetDir(r.LocalPath())
 	out, err := tagsCmd.CombinedOutput()
 	if err != nil {
-		return nil, errors.Wrap(err, string(out))
+		return nil, wrapError(err, string(out))
 	}
 
 	all := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
 
-	viCmd := commandContext(ctx, "bzr", "version-info", "--custom", "--template={revision_id}", "--revision=branch:.")
+	viCmd := commandContext(ctx, bzrBinary(), "version-info", "--custom", "--template={revision_id}", "--revision=branch:.")
 	viCmd.SetDir(r.LocalPath())
 	branchrev, err := viCmd.CombinedOutput()
 	if err != nil {
-		return nil, errors.Wrap(err, string(branchrev))
+		return nil, wrapError(err, string(branchrev))
 	}
 
 	vlist := make([]PairedVersion, 0, len(all)+1)
@@ -492,14 +1092,14 @@ func (s *bzrSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 	for _, line := range all {
 		idx := bytes.IndexByte(line, 32) // space
 		v := NewVersion(string(line[:idx]))
-		r := Revision(bytes.TrimSpace(line[idx:]))
+		r := Revision(trimBzrRevisionID(line[idx:]))
 		vlist = append(vlist, v.Pair(r))
 	}
 
 	// Last, add the default branch, hardcoding the visual representation of it
 	// that bzr uses when operating in the workflow mode we're using.
 	v := newDefaultBranch("(default)")
-	vlist = append(vlist, v.Pair(Revision(string(branchrev))))
+	vlist = append(vlist, v.Pair(Revision(trimBzrRevisionID(branchrev))))
 
 	return vlist, nil
 }
@@ -549,14 +1149,51 @@ func (s *hgSource) hgCmd(ctx context.Context, args ...string) cmd {
 	return cmd
 }
 
+// hg runs hg with args in the local repository, returning its combined output.
+// The repository's command server is used, if it has one.
+func (s *hgSource) hg(ctx context.Context, args ...string) ([]byte, error) {
+	if hr, ok := s.repo.(*hgRepo); ok && hr.server != nil {
+		return hr.server.run(ctx, args...)
+	}
+	return s.hgCmd(ctx, args...).CombinedOutput()
+}
+
+func (s *hgSource) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	hr, ok := s.repo.(*hgRepo)
+	if !ok || hr.server == nil || !hr.CheckLocal() {
+		return s.baseVCSSource.revisionPresentIn(ctx, r)
+	}
+	_, err := hr.server.run(ctx, "log", "-r", string(r), "--template", "{node}")
+	if _, failed := err.(*hgExitError); failed {
+		return false, nil
+	} else if err != nil {
+		// Fall back to checking the slow way.
+		return s.baseVCSSource.revisionPresentIn(ctx, r)
+	}
+	return true, nil
+}
+
+// close stops the command server, if it is running.
+func (s *hgSource) close() error {
+	if hr, ok := s.repo.(*hgRepo); ok {
+		return hr.closeServer()
+	}
+	return nil
+}
+
+func (s *hgSource) quarantineLocal(dir string) (string, error) {
+	// The command server must not keep running in the old location.
+	s.close()
+	return s.baseVCSSource.quarantineLocal(dir)
+}
+
 func (s *hgSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 	var vlist []PairedVersion
 
 	// Now, list all the tags
-	tagsCmd := s.hgCmd(ctx, "tags", "--debug", "--verbose")
-	out, err := tagsCmd.CombinedOutput()
+	out, err := s.hg(ctx, "tags", "--debug", "--verbose")
 	if err != nil {
-		return nil, errors.Wrap(err, string(out))
+		return nil, wrapError(err, string(out))
 	}
 
 	all := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
@@ -588,11 +1225,10 @@ func (s *hgSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 	// bookmarks next, because the presence of the magic @ bookmark has to
 	// determine how we handle the branches
 	var magicAt bool
-	bookmarksCmd := s.hgCmd(ctx, "bookmarks", "--debug")
-	out, err = bookmarksCmd.CombinedOutput()
+	out, err = s.hg(ctx, "bookmarks", "--debug")
 	if err != nil {
 		// better nothing than partial and misleading
-		return nil, errors.Wrap(err, string(out))
+		return nil, wrapError(err, string(out))
 	}
 
 	out = bytes.TrimSpace(out)
@@ -622,11 +1258,10 @@ func (s *hgSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 		}
 	}
 
-	cmd := s.hgCmd(ctx, "branches", "-c", "--debug")
-	out, err = cmd.CombinedOutput()
+	out, err = s.hg(ctx, "branches", "-c", "--debug")
 	if err != nil {
 		// better nothing than partial and misleading
-		return nil, errors.Wrap(err, string(out))
+		return nil, wrapError(err, string(out))
 	}
 
 	all = bytes.Split(bytes.TrimSpace(out), []byte("\n"))
@@ -653,3 +1288,80 @@ func (s *hgSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 
 	return vlist, nil
 }
+
+// svnSource is a generic svn repository implementation that should work with
+// all standard subversion servers.
+//
+// Its working copy is sparse, holding none of the repository's files, which
+// may be enormous. Instead, the latest revision is looked up from, and
+// revisions are exported straight from, the repository itself.
+type svnSource struct {
+	baseVCSSource
+}
+
+func (s *svnSource) svnRepo() *svnRepo {
+	return s.repo.(*svnRepo)
+}
+
+func (s *svnSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
+	rev, err := s.svnRepo().latestRevision(ctx)
+	if err != nil {
+		return nil, unwrapVcsErr(err)
+	}
+
+	// svn has no tags or branches of its own, only the conventional layout of
+	// directories, so the repository is a single line of development. Use the
+	// same visual representation for it as for bzr's default branch.
+	return []PairedVersion{newDefaultBranch("(default)").Pair(Revision(rev))}, nil
+}
+
+func (s *svnSource) exportRevisionTo(ctx context.Context, rev Revision, to string) error {
+	// svn export creates to itself, so only make the parent dir.
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+
+	return unwrapVcsErr(s.svnRepo().exportRevision(ctx, string(rev), to))
+}
+
+// withExport exports rev to a temporary directory, and calls fn with it. The
+// sparse working copy has none of rev's files to inspect.
+func (s *svnSource) withExport(ctx context.Context, rev Revision, fn func(dir string) error) error {
+	td, err := ioutil.TempDir("", "gps-svn")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+
+	dir := filepath.Join(td, "src")
+	if err = s.exportRevisionTo(ctx, rev, dir); err != nil {
+		return err
+	}
+	return fn(dir)
+}
+
+func (s *svnSource) listPackages(ctx context.Context, pr ProjectRoot, r Revision) (ptree pkgtree.PackageTree, err error) {
+	err = s.withExport(ctx, r, func(dir string) error {
+		var lerr error
+		ptree, lerr = pkgtree.ListPackages(dir, string(pr))
+		return lerr
+	})
+	return
+}
+
+func (s *svnSource) getManifestAndLock(ctx context.Context, pr ProjectRoot, r Revision, an ProjectAnalyzer) (m Manifest, l Lock, err error) {
+	err = s.withExport(ctx, r, func(dir string) error {
+		var derr error
+		m, l, derr = DeriveManifestAndLock(ctx, an, dir, pr)
+		return derr
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if l != nil && l != Lock(nil) {
+		l = prepLock(l)
+	}
+
+	return prepManifest(m), l, nil
+}
@@ -0,0 +1,347 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build gogit
+
+package gps
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func init() {
+	newNativeGitSource = func(ctx context.Context, u *url.URL, path string) (source, error) {
+		return &nativeGitSource{url: u.String(), path: path}, nil
+	}
+}
+
+// nativeGitFetchSpecs are the refs fetched into the local copy of a native git
+// source. Unlike a plain clone, tags are fetched whether or not they are
+// reachable from a branch, as any of them may be selected as a version.
+var nativeGitFetchSpecs = []config.RefSpec{
+	"+refs/heads/*:refs/remotes/origin/*",
+	"+refs/tags/*:refs/tags/*",
+}
+
+// nativeGitSource is a git source that uses go-git, a pure Go implementation of
+// git, rather than the git binary.
+//
+// Its local copy is an ordinary git repository, so it may be used
+// interchangeably with a gitSource at the same place in the cache.
+type nativeGitSource struct {
+	url  string // The upstream URL
+	path string // The location of the local copy
+}
+
+func (s *nativeGitSource) localPath() string {
+	return s.path
+}
+
+func (s *nativeGitSource) sourceType() string {
+	return "git"
+}
+
+func (s *nativeGitSource) upstreamURL() string {
+	return s.url
+}
+
+func (*nativeGitSource) existsCallsListVersions() bool {
+	return false
+}
+
+func (*nativeGitSource) listVersionsRequiresLocal() bool {
+	return false
+}
+
+func (s *nativeGitSource) open() (*git.Repository, error) {
+	r, err := git.PlainOpen(s.path)
+	return r, wrapErrorf(err, "failed to open git repository at %s", s.path)
+}
+
+func (s *nativeGitSource) existsLocally(ctx context.Context) bool {
+	_, err := s.open()
+	return err == nil
+}
+
+func (s *nativeGitSource) remote() *git.Remote {
+	return git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{s.url},
+	})
+}
+
+func (s *nativeGitSource) existsUpstream(ctx context.Context) bool {
+	_, err := s.remote().List(&git.ListOptions{})
+	return err == nil
+}
+
+func (s *nativeGitSource) initLocal(ctx context.Context) error {
+	_, err := git.PlainCloneContext(ctx, s.path, false, &git.CloneOptions{
+		URL:        s.url,
+		NoCheckout: true,
+		Tags:       git.AllTags,
+	})
+	if err != nil {
+		os.RemoveAll(s.path)
+		return wrapErrorf(err, "failed to clone %s", s.url)
+	}
+	return s.updateLocal(ctx)
+}
+
+func (s *nativeGitSource) updateLocal(ctx context.Context) error {
+	r, err := s.open()
+	if err != nil {
+		return err
+	}
+	err = r.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   nativeGitFetchSpecs,
+		Tags:       git.AllTags,
+		Force:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return wrapErrorf(err, "failed to fetch from %s", s.url)
+	}
+	return nil
+}
+
+func (s *nativeGitSource) maybeClean(ctx context.Context) error {
+	return nil
+}
+
+// listVersions lists the versions advertised by upstream, in the same way as
+// gitSource.listVersions does from the output of git ls-remote.
+func (s *nativeGitSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
+	refs, err := s.remote().List(&git.ListOptions{})
+	if err != nil {
+		return nil, wrapErrorf(err, "failed to list refs of %s", s.url)
+	}
+	if len(refs) == 0 {
+		return nil, errors.Errorf("no refs advertised by %s", s.url)
+	}
+
+	// If upstream advertises which branch HEAD refers to, that is the default
+	// branch. Otherwise, as with git ls-remote, any branch at HEAD's revision
+	// may be.
+	var defbranch plumbing.ReferenceName
+	var headrev plumbing.Hash
+	for _, ref := range refs {
+		if ref.Name() != plumbing.HEAD {
+			continue
+		}
+		if ref.Type() == plumbing.SymbolicReference {
+			defbranch = ref.Target()
+		} else {
+			headrev = ref.Hash()
+		}
+	}
+
+	var vlist []PairedVersion
+	var onedef, multidef, defmaster bool
+	tags := make(map[string]int)
+	for _, ref := range refs {
+		name := ref.Name()
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+
+		switch {
+		case name.IsBranch():
+			var isdef bool
+			if defbranch != "" {
+				isdef = name == defbranch
+			} else {
+				isdef = ref.Hash() == headrev
+			}
+			n := name.Short()
+			if isdef {
+				if onedef {
+					multidef = true
+				}
+				onedef = true
+				if n == "master" {
+					defmaster = true
+				}
+			}
+			vlist = append(vlist, branchVersion{
+				name:      n,
+				isDefault: isdef,
+			}.Pair(Revision(ref.Hash().String())).(PairedVersion))
+		case name.IsTag():
+			vstr := strings.TrimPrefix(name.String(), "refs/tags/")
+			peeled := strings.HasSuffix(vstr, "^{}")
+			vstr = strings.TrimSuffix(vstr, "^{}")
+			v := NewVersion(vstr).Pair(Revision(ref.Hash().String()))
+			if i, has := tags[vstr]; has {
+				// Prefer the revision of the commit an annotated tag refers
+				// to over that of the tag object itself.
+				if peeled {
+					vlist[i] = v
+				}
+				continue
+			}
+			tags[vstr] = len(vlist)
+			vlist = append(vlist, v)
+		}
+	}
+
+	// There were multiple default branches, but one was master. So, go through
+	// and strip the default flag from all the non-master branches.
+	if multidef && defmaster {
+		for k, pv := range vlist {
+			if bv, ok := pv.Unpair().(branchVersion); ok {
+				if bv.name != "master" && bv.isDefault {
+					bv.isDefault = false
+					vlist[k] = bv.Pair(pv.Revision())
+				}
+			}
+		}
+	}
+
+	return vlist, nil
+}
+
+func (s *nativeGitSource) commit(r Revision) (*object.Commit, error) {
+	repo, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	c, err := repo.CommitObject(plumbing.NewHash(string(r)))
+	return c, wrapErrorf(err, "failed to find revision %s in %s", r, s.path)
+}
+
+func (s *nativeGitSource) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	if !gitHashRE.MatchString(string(r)) {
+		return false, nil
+	}
+	_, err := s.commit(r)
+	return err == nil, nil
+}
+
+func (s *nativeGitSource) disambiguateRevision(ctx context.Context, r Revision) (Revision, error) {
+	repo, err := s.open()
+	if err != nil {
+		return "", err
+	}
+	h, err := repo.ResolveRevision(plumbing.Revision(r))
+	if err != nil {
+		return "", wrapErrorf(err, "failed to resolve revision %s in %s", r, s.path)
+	}
+	return Revision(h.String()), nil
+}
+
+// checkout checks out revision r in the local copy, so that its tree may be
+// examined there.
+func (s *nativeGitSource) checkout(r Revision) error {
+	repo, err := s.open()
+	if err != nil {
+		return err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return wrapErrorf(err, "failed to get work tree of %s", s.path)
+	}
+	err = wt.Checkout(&git.CheckoutOptions{
+		Hash:  plumbing.NewHash(string(r)),
+		Force: true,
+	})
+	return wrapErrorf(err, "failed to check out %s in %s", r, s.path)
+}
+
+func (s *nativeGitSource) getManifestAndLock(ctx context.Context, pr ProjectRoot, r Revision, an ProjectAnalyzer) (Manifest, Lock, error) {
+	if err := s.checkout(r); err != nil {
+		return nil, nil, err
+	}
+
+	m, l, err := DeriveManifestAndLock(ctx, an, s.path, pr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if l != nil && l != Lock(nil) {
+		l = prepLock(l)
+	}
+
+	return prepManifest(m), l, nil
+}
+
+func (s *nativeGitSource) listPackages(ctx context.Context, pr ProjectRoot, r Revision) (pkgtree.PackageTree, error) {
+	if err := s.checkout(r); err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	return pkgtree.ListPackages(s.path, string(pr))
+}
+
+// exportRevisionTo writes out the tree of revision r directly from the object
+// store, without checking it out in the local copy first. As with gitSource,
+// submodules are not included.
+func (s *nativeGitSource) exportRevisionTo(ctx context.Context, r Revision, to string) error {
+	c, err := s.commit(r)
+	if err != nil {
+		return err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return wrapErrorf(err, "failed to read tree of %s", r)
+	}
+
+	if err = os.MkdirAll(to, 0777); err != nil {
+		return err
+	}
+	return tree.Files().ForEach(func(f *object.File) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return writeGitFile(f, filepath.Join(to, filepath.FromSlash(f.Name)))
+	})
+}
+
+// writeGitFile writes out f, a file from a git tree, to path.
+func writeGitFile(f *object.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	if f.Mode == filemode.Symlink {
+		target, err := f.Contents()
+		if err != nil {
+			return wrapErrorf(err, "failed to read symlink %s", f.Name)
+		}
+		return os.Symlink(target, path)
+	}
+
+	mode, err := f.Mode.ToOSFileMode()
+	if err != nil {
+		return wrapErrorf(err, "unexpected mode for %s", f.Name)
+	}
+	rc, err := f.Reader()
+	if err != nil {
+		return wrapErrorf(err, "failed to read %s", f.Name)
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,40 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// newNativeGitSource, if non-nil, sets up a git source at path, in the cache,
+// that talks to upstream u using a pure Go implementation of git rather than
+// the git binary. It is only set when gps is built with the gogit build tag.
+var newNativeGitSource func(ctx context.Context, u *url.URL, path string) (source, error)
+
+// errNoNativeGit is returned on trying to set up a native git source when gps
+// has been built without support for them.
+var errNoNativeGit = errors.New("native git sources are not supported by this build; rebuild with -tags gogit, or use the git binary")
+
+// maybeNativeGitSource is a maybeGitSource to be set up as a native git source
+// rather than one that uses the git binary. It occupies the same place in the
+// cache as the maybeGitSource it wraps.
+type maybeNativeGitSource struct {
+	maybeGitSource
+}
+
+func (m maybeNativeGitSource) try(ctx context.Context, cachedir string) (source, error) {
+	if newNativeGitSource == nil {
+		return nil, errNoNativeGit
+	}
+	return newNativeGitSource(ctx, m.url, sourceCachePath(cachedir, m.url.String()))
+}
+
+func (m maybeNativeGitSource) String() string {
+	return fmt.Sprintf("%T: %s", m, ufmt(m.url))
+}
@@ -17,7 +17,9 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/Masterminds/vcs"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -28,7 +30,8 @@ func TestSlowVcs(t *testing.T) {
 	t.Run("bzr-repo", testBzrRepo)
 	t.Run("bzr-source", testBzrSourceInteractions)
 	t.Run("svn-repo", testSvnRepo)
-	// TODO(sdboyer) svn-source
+	t.Run("svn-sparse-repo", testSvnSparseRepo)
+	t.Run("svn-source", testSvnSourceInteractions)
 	t.Run("hg-repo", testHgRepo)
 	t.Run("hg-source", testHgSourceInteractions)
 	t.Run("git-repo", testGitRepo)
@@ -93,7 +96,7 @@ func testGitSourceInteractions(t *testing.T) {
 
 	vlist := hidePair(pvlist)
 	// check that an expected rev is present
-	is, err := src.revisionPresentIn(Revision("4a54adf81c75375d26d376459c00d5ff9b703e5e"))
+	is, err := src.revisionPresentIn(ctx, Revision("4a54adf81c75375d26d376459c00d5ff9b703e5e"))
 	if err != nil {
 		t.Errorf("Unexpected error while checking revision presence: %s", err)
 	} else if !is {
@@ -122,7 +125,7 @@ func testGitSourceInteractions(t *testing.T) {
 	}
 
 	// recheck that rev is present, this time interacting with cache differently
-	is, err = src.revisionPresentIn(Revision("30605f6ac35fcb075ad0bfa9296f90a7d891523e"))
+	is, err = src.revisionPresentIn(ctx, Revision("30605f6ac35fcb075ad0bfa9296f90a7d891523e"))
 	if err != nil {
 		t.Errorf("Unexpected error while re-checking revision presence: %s", err)
 	} else if !is {
@@ -192,7 +195,7 @@ func testGopkginSourceInteractions(t *testing.T) {
 
 		// check that an expected rev is present
 		rev := evl[0].(PairedVersion).Revision()
-		is, err := src.revisionPresentIn(rev)
+		is, err := src.revisionPresentIn(ctx, rev)
 		if err != nil {
 			t.Errorf("Unexpected error while checking revision presence: %s", err)
 		} else if !is {
@@ -231,7 +234,7 @@ func testGopkginSourceInteractions(t *testing.T) {
 		}
 
 		// recheck that rev is present, this time interacting with cache differently
-		is, err = src.revisionPresentIn(rev)
+		is, err = src.revisionPresentIn(ctx, rev)
 		if err != nil {
 			t.Errorf("Unexpected error while re-checking revision presence: %s", err)
 		} else if !is {
@@ -356,7 +359,7 @@ func testBzrSourceInteractions(t *testing.T) {
 	}
 
 	// check that an expected rev is present
-	is, err := src.revisionPresentIn(Revision("matt@mattfarina.com-20150731135137-pbphasfppmygpl68"))
+	is, err := src.revisionPresentIn(ctx, Revision("matt@mattfarina.com-20150731135137-pbphasfppmygpl68"))
 	if err != nil {
 		t.Errorf("Unexpected error while checking revision presence: %s", err)
 	} else if !is {
@@ -395,7 +398,7 @@ func testBzrSourceInteractions(t *testing.T) {
 	}
 
 	// recheck that rev is present, this time interacting with cache differently
-	is, err = src.revisionPresentIn(Revision("matt@mattfarina.com-20150731135137-pbphasfppmygpl68"))
+	is, err = src.revisionPresentIn(ctx, Revision("matt@mattfarina.com-20150731135137-pbphasfppmygpl68"))
 	if err != nil {
 		t.Errorf("Unexpected error while re-checking revision presence: %s", err)
 	} else if !is {
@@ -403,6 +406,85 @@ func testBzrSourceInteractions(t *testing.T) {
 	}
 }
 
+func testSvnSourceInteractions(t *testing.T) {
+	t.Parallel()
+
+	// This test is slow, so skip it on -short
+	if testing.Short() {
+		t.Skip("Skipping svn source version fetching test in short mode")
+	}
+	requiresBins(t, "svn", "svnadmin")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	h.TempFile("r1/a.go", "package repo\n")
+	h.TempFile("r2/sub/b.go", "package sub\n")
+
+	run := func(name string, args ...string) {
+		if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+			t.Fatalf("%s %s failed: %s\n%s", name, strings.Join(args, " "), err, out)
+		}
+	}
+
+	// A local repository, with a second revision that adds a subpackage.
+	repoPath := filepath.Join(h.Path("."), "repo")
+	run("svnadmin", "create", repoPath)
+	p := filepath.ToSlash(repoPath)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	u := &url.URL{Scheme: "file", Path: p}
+	run("svn", "import", "-m", "r1", h.Path("r1"), u.String())
+
+	ctx := context.Background()
+	isrc, err := maybeSvnSource{url: u}.try(ctx, h.Path("cache"))
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up svnSource for test repo: %s", err)
+	}
+	src, ok := isrc.(*svnSource)
+	if !ok {
+		t.Fatalf("Expected a svnSource, got a %T", isrc)
+	}
+	if err = src.initLocal(ctx); err != nil {
+		t.Fatalf("Error on checking out svn repo: %s", err)
+	}
+
+	// The working copy is sparse.
+	if _, err = os.Stat(filepath.Join(src.localPath(), "a.go")); !os.IsNotExist(err) {
+		t.Errorf("expected no files in the working copy, got %v", err)
+	}
+
+	run("svn", "import", "-m", "r2", h.Path("r2"), u.String())
+
+	// The latest revision comes straight from the repository, without updating
+	// the working copy.
+	vlist, err := src.listVersions(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error getting version pairs from svn repo: %s", err)
+	}
+	want := []PairedVersion{newDefaultBranch("(default)").Pair(Revision("2"))}
+	if !reflect.DeepEqual(vlist, want) {
+		t.Errorf("unexpected versions:\n\t(GOT): %#v\n\t(WNT): %#v", vlist, want)
+	}
+
+	to := filepath.Join(h.Path("."), "export", "r1")
+	if err = src.exportRevisionTo(ctx, Revision("1"), to); err != nil {
+		t.Fatalf("Unexpected error exporting revision 1: %s", err)
+	}
+	h.MustExist(filepath.Join(to, "a.go"))
+	h.MustNotExist(filepath.Join(to, "sub"))
+	h.MustNotExist(filepath.Join(to, ".svn"))
+
+	ptree, err := src.listPackages(ctx, ProjectRoot("example.com/repo"), Revision("2"))
+	if err != nil {
+		t.Fatalf("Unexpected error listing packages at revision 2: %s", err)
+	}
+	if _, has := ptree.Packages["example.com/repo/sub"]; !has {
+		t.Errorf("expected the subpackage added in revision 2 to be listed, got %v", ptree.Packages)
+	}
+}
+
 func testHgSourceInteractions(t *testing.T) {
 	t.Parallel()
 
@@ -457,7 +539,7 @@ func testHgSourceInteractions(t *testing.T) {
 		}
 
 		// check that an expected rev is present
-		is, err := src.revisionPresentIn(Revision("103d1bddef2199c80aad7c42041223083d613ef9"))
+		is, err := src.revisionPresentIn(ctx, Revision("103d1bddef2199c80aad7c42041223083d613ef9"))
 		if err != nil {
 			t.Errorf("Unexpected error while checking revision presence: %s", err)
 		} else if !is {
@@ -503,7 +585,7 @@ func testHgSourceInteractions(t *testing.T) {
 		}
 
 		// recheck that rev is present, this time interacting with cache differently
-		is, err = src.revisionPresentIn(Revision("103d1bddef2199c80aad7c42041223083d613ef9"))
+		is, err = src.revisionPresentIn(ctx, Revision("103d1bddef2199c80aad7c42041223083d613ef9"))
 		if err != nil {
 			t.Errorf("Unexpected error while re-checking revision presence: %s", err)
 		} else if !is {
@@ -687,7 +769,7 @@ func TestGitSourceAdaptiveCleanup(t *testing.T) {
 
 	mkSM()
 	id := mkPI("github.com/sdboyer/gpkt")
-	err = sm.SyncSourceFor(id)
+	err = sm.SyncSourceFor(context.Background(), id)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -709,7 +791,7 @@ func TestGitSourceAdaptiveCleanup(t *testing.T) {
 	}
 
 	mkSM()
-	err = sm.SyncSourceFor(id)
+	err = sm.SyncSourceFor(context.Background(), id)
 	if err != nil {
 		t.Fatalf("choked after adding dummy file: %q", err)
 	}
@@ -723,7 +805,7 @@ func TestGitSourceAdaptiveCleanup(t *testing.T) {
 	os.Remove(readmePath)
 
 	mkSM()
-	err = sm.SyncSourceFor(id)
+	err = sm.SyncSourceFor(context.Background(), id)
 	if err != nil {
 		t.Fatalf("choked after removing known file: %q", err)
 	}
@@ -739,7 +821,7 @@ func TestGitSourceAdaptiveCleanup(t *testing.T) {
 	}
 
 	mkSM()
-	err = sm.SyncSourceFor(id)
+	err = sm.SyncSourceFor(context.Background(), id)
 	if err != nil {
 		t.Fatalf("choked after removing .git/objects directory: %q", err)
 	}
@@ -867,3 +949,797 @@ func requiresBins(t *testing.T, bins ...string) {
 		}
 	}
 }
+
+func TestGitSourceNoteRedirect(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+
+	for _, tc := range []struct {
+		remote, out, want string
+	}{
+		{
+			remote: "https://github.com/sdboyer/oldname",
+			out:    "warning: redirecting to https://github.com/sdboyer/newname.git/\nc575196502940c07bf89fd6d95e83a999bb78ad6\tHEAD\n",
+			want:   "https://github.com/sdboyer/newname",
+		},
+		{
+			remote: "https://github.com/sdboyer/oldname.git",
+			out:    "warning: redirecting to https://github.com/sdboyer/newname.git/\n",
+			want:   "https://github.com/sdboyer/newname.git",
+		},
+		{
+			remote: "https://github.com/sdboyer/oldname",
+			out:    "c575196502940c07bf89fd6d95e83a999bb78ad6\tHEAD\n",
+		},
+	} {
+		r, err := vcs.NewGitRepo(tc.remote, filepath.Join(h.Path("smcache"), "repo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := &gitSource{baseVCSSource: baseVCSSource{repo: &gitRepo{GitRepo: r}}}
+
+		src.noteRedirect([]byte(tc.out))
+		from, to := src.redirectedURL()
+		if from != tc.remote || to != tc.want {
+			t.Errorf("unexpected redirect for %q from %s:\n\t(GOT): %s -> %q\n\t(WNT): %s -> %q", tc.out, tc.remote, from, to, tc.remote, tc.want)
+		}
+	}
+}
+
+func TestGitSourceMirrorFailover(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	cpath := h.Path("smcache")
+	os.Mkdir(filepath.Join(cpath, "sources"), 0777)
+
+	h.TempDir("mirror")
+	mirrorPath := h.Path("mirror")
+	h.RunGit(mirrorPath, "init")
+	h.RunGit(mirrorPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(mirrorPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(mirrorPath, "commit", "--allow-empty", `--message="Initial commit"`)
+
+	// The primary upstream doesn't exist, so everything must come from the
+	// mirror.
+	primary := "file://" + filepath.ToSlash(filepath.Join(h.Path("."), "primary"))
+	mirror := "file://" + filepath.ToSlash(mirrorPath)
+	u, err := url.Parse(primary)
+	if err != nil {
+		t.Fatalf("Error parsing URL %s: %s", primary, err)
+	}
+	pm := maybeGitSource{url: u}
+	mb := maybeMirroredSource{maybeSource: pm, mirrors: []string{mirror}}
+
+	ctx := context.Background()
+	isrc, err := mb.try(ctx, cpath)
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+	}
+	defer isrc.(*gitSource).close()
+	if !isrc.existsUpstream(ctx) {
+		t.Error("expected upstream to exist by way of the mirror")
+	}
+	if err = isrc.initLocal(ctx); err != nil {
+		t.Fatalf("Error on cloning git repo from mirror: %s", err)
+	}
+
+	// The clone belongs in the primary's place in the cache, and must still
+	// refer to the primary as its origin.
+	lpath := maybeSourceCachePath(cpath, pm)
+	h.MustExist(lpath)
+	origin, err := exec.Command("git", "-C", lpath, "config", "remote.origin.url").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(origin)); got != primary {
+		t.Errorf("expected origin to remain %s, got %s", primary, got)
+	}
+
+	pvlist, err := isrc.listVersions(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error getting version pairs from mirror: %s", err)
+	}
+	if len(pvlist) != 1 {
+		t.Errorf("Unexpected version pair length:\n\t(GOT): %d\n\t(WNT): %d", len(pvlist), 1)
+	}
+
+	h.RunGit(mirrorPath, "commit", "--allow-empty", `--message="Second commit"`)
+	if err = isrc.updateLocal(ctx); err != nil {
+		t.Fatalf("Error on updating git repo from mirror: %s", err)
+	}
+	head, err := exec.Command("git", "-C", mirrorPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if present, _ := isrc.revisionPresentIn(ctx, Revision(strings.TrimSpace(string(head)))); !present {
+		t.Error("expected the mirror's latest commit to be fetched")
+	}
+
+	// Sources that can't fail over can't be mirrored.
+	mb = maybeMirroredSource{maybeSource: maybeHgSource{url: u}, mirrors: []string{mirror}}
+	if _, err = mb.try(ctx, cpath); err == nil {
+		t.Error("expected an error setting up a mirrored hg source")
+	}
+}
+
+func TestRefspecsMatch(t *testing.T) {
+	cases := []struct {
+		refspecs []string
+		ref      string
+		want     bool
+	}{
+		{[]string{"+refs/tags/*:refs/tags/*"}, "refs/tags/v1.0.0", true},
+		{[]string{"+refs/tags/*:refs/tags/*"}, "refs/heads/master", false},
+		{[]string{"refs/heads/master:refs/remotes/origin/master"}, "refs/heads/master", true},
+		{[]string{"refs/heads/master:refs/remotes/origin/master"}, "refs/heads/master2", false},
+		{[]string{"+refs/heads/release-*:refs/remotes/origin/release-*"}, "refs/heads/release-1.2", true},
+		{[]string{"+refs/heads/release-*:refs/remotes/origin/release-*"}, "refs/heads/dev", false},
+		{[]string{"+refs/*:refs/*", "^refs/pull/*"}, "refs/heads/master", true},
+		{[]string{"+refs/*:refs/*", "^refs/pull/*"}, "refs/pull/1/head", false},
+		{[]string{"^refs/pull/*", "+refs/*:refs/*"}, "refs/pull/1/head", false},
+		{[]string{"^refs/pull/*"}, "refs/heads/master", false},
+	}
+
+	for _, tc := range cases {
+		if got := refspecsMatch(tc.refspecs, tc.ref); got != tc.want {
+			t.Errorf("refspecsMatch(%q, %q) = %v, want %v", tc.refspecs, tc.ref, got, tc.want)
+		}
+	}
+}
+
+func TestGitSourceFetchRefspecs(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	cpath := h.Path("smcache")
+	os.Mkdir(filepath.Join(cpath, "sources"), 0777)
+
+	h.TempDir("repo")
+	repoPath := h.Path("repo")
+	h.RunGit(repoPath, "init")
+	h.RunGit(repoPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(repoPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(repoPath, "commit", "--allow-empty", `--message="Initial commit"`)
+	h.RunGit(repoPath, "tag", "v1.0.0")
+	h.RunGit(repoPath, "commit", "--allow-empty", `--message="Untagged commit"`)
+
+	tagged, err := exec.Command("git", "-C", repoPath, "rev-parse", "v1.0.0").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	untagged, err := exec.Command("git", "-C", repoPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse("file://" + filepath.ToSlash(repoPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb := maybeRefspecSource{
+		maybeSource: maybeGitSource{url: u},
+		refspecs:    []string{"+refs/tags/*:refs/tags/*"},
+	}
+
+	ctx := context.Background()
+	isrc, err := mb.try(ctx, cpath)
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+	}
+	defer isrc.(*gitSource).close()
+
+	pvlist, err := isrc.listVersions(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error getting version pairs from git repo: %s", err)
+	}
+	want := []PairedVersion{NewVersion("v1.0.0").Pair(Revision(strings.TrimSpace(string(tagged))))}
+	if !reflect.DeepEqual(pvlist, want) {
+		t.Errorf("Unexpected versions:\n\t(GOT): %s\n\t(WNT): %s", pvlist, want)
+	}
+
+	if err = isrc.initLocal(ctx); err != nil {
+		t.Fatalf("Error on cloning git repo: %s", err)
+	}
+	if present, _ := isrc.revisionPresentIn(ctx, Revision(strings.TrimSpace(string(tagged)))); !present {
+		t.Error("expected the tagged commit to be fetched")
+	}
+	if present, _ := isrc.revisionPresentIn(ctx, Revision(strings.TrimSpace(string(untagged)))); present {
+		t.Error("expected the untagged commit not to be fetched")
+	}
+
+	h.RunGit(repoPath, "tag", "v1.1.0")
+	if err = isrc.updateLocal(ctx); err != nil {
+		t.Fatalf("Error on updating git repo: %s", err)
+	}
+	if present, _ := isrc.revisionPresentIn(ctx, Revision(strings.TrimSpace(string(untagged)))); !present {
+		t.Error("expected the newly tagged commit to be fetched")
+	}
+
+	// Sources that can't be restricted can't be given refspecs.
+	mb = maybeRefspecSource{maybeSource: maybeHgSource{url: u}, refspecs: mb.refspecs}
+	if _, err = mb.try(ctx, cpath); err == nil {
+		t.Error("expected an error setting up an hg source with refspecs")
+	}
+}
+
+func TestParseGitTagInfo(t *testing.T) {
+	const (
+		commit = "1234567890123456789012345678901234567890"
+		tagobj = "abcdefabcdefabcdefabcdefabcdefabcdefabcd"
+	)
+	out := "refs/tags/v1.0.0\x00tag\x00" + tagobj + "\x00" + commit + "\x00Test author\x00<test@example.com>\x001500000000\x00\x00Release 1.0.0\n\nMultiple lines.\n\x00\n" +
+		"refs/tags/v0.9.0\x00commit\x00" + commit + "\x00\x00\x00\x00\x001400000000\x00\x00\n" +
+		"refs/tags/tree\x00tree\x00" + tagobj + "\x00\x00\x00\x00\x00\x00\x00\n"
+
+	got, err := parseGitTagInfo([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]TagInfo{
+		"v1.0.0": {
+			Name:       "v1.0.0",
+			Revision:   commit,
+			Annotated:  true,
+			Tagger:     "Test author <test@example.com>",
+			Date:       time.Unix(1500000000, 0),
+			Annotation: "Release 1.0.0\n\nMultiple lines.\n",
+		},
+		"v0.9.0": {
+			Name:     "v0.9.0",
+			Revision: commit,
+			Date:     time.Unix(1400000000, 0),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected tag info:\n\t(GOT): %#v\n\t(WNT): %#v", got, want)
+	}
+
+	if _, err = parseGitTagInfo([]byte("refs/tags/v1.0.0\x00commit\x00\n")); err == nil {
+		t.Error("expected an error parsing truncated output")
+	}
+}
+
+func TestGitSourceListTagInfo(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	cpath := h.Path("smcache")
+	os.Mkdir(filepath.Join(cpath, "sources"), 0777)
+
+	h.TempDir("repo")
+	repoPath := h.Path("repo")
+	h.RunGit(repoPath, "init")
+	h.RunGit(repoPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(repoPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(repoPath, "commit", "--allow-empty", `--message="Initial commit"`)
+	h.RunGit(repoPath, "tag", "v0.9.0")
+	h.RunGit(repoPath, "tag", "-a", "-m", "Release 1.0.0", "v1.0.0")
+
+	u, err := url.Parse("file://" + filepath.ToSlash(repoPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	src, err := maybeGitSource{url: u}.try(ctx, cpath)
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+	}
+	defer src.(*gitSource).close()
+	sg, err := newSourceGateway(ctx, src, newSupervisor(ctx), cpath, newMemoryCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tis, err := sg.listTagInfo(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error listing tag info: %s", err)
+	}
+	if len(tis) != 2 {
+		t.Fatalf("expected info for 2 tags, got %#v", tis)
+	}
+	byName := make(map[string]TagInfo)
+	for _, ti := range tis {
+		byName[ti.Name] = ti
+		if ti.Date.IsZero() {
+			t.Errorf("expected a date for tag %s", ti.Name)
+		}
+		if _, ok := sg.cache.getTagInfo(ti.Revision, ti.Name); !ok {
+			t.Errorf("expected info for tag %s to be cached", ti.Name)
+		}
+	}
+	if ti := byName["v0.9.0"]; ti.Annotated || ti.Tagger != "" {
+		t.Errorf("expected v0.9.0 to be a lightweight tag, got %#v", ti)
+	}
+	ti := byName["v1.0.0"]
+	if !ti.Annotated || ti.Tagger != "Test author <test@example.com>" || ti.Annotation != "Release 1.0.0\n" {
+		t.Errorf("unexpected info for annotated tag v1.0.0: %#v", ti)
+	}
+	if ti.Revision != byName["v0.9.0"].Revision {
+		t.Errorf("expected both tags to refer to the same commit, got %s and %s", ti.Revision, byName["v0.9.0"].Revision)
+	}
+}
+
+func TestGpgValidSigner(t *testing.T) {
+	out := `[GNUPG:] NEWSIG
+[GNUPG:] KEY_CONSIDERED 0123456789ABCDEF0123456789ABCDEF01234567 0
+[GNUPG:] GOODSIG 89ABCDEF01234567 Test author <test@example.com>
+[GNUPG:] VALIDSIG 0123456789ABCDEF0123456789ABCDEF01234567 2017-01-01 1483228800 0 4 0 22 10 00 0123456789ABCDEF0123456789ABCDEF01234567
+`
+	if got := gpgValidSigner([]byte(out)); got != "0123456789ABCDEF0123456789ABCDEF01234567" {
+		t.Errorf("unexpected signer %q", got)
+	}
+	if got := gpgValidSigner([]byte("[GNUPG:] ERRSIG 89ABCDEF01234567 22 10 00 1483228800 9 -\n")); got != "" {
+		t.Errorf("expected no signer, got %q", got)
+	}
+}
+
+func TestGitSourceVerifySignature(t *testing.T) {
+	requiresBins(t, "git", "gpg")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	cpath := h.Path("smcache")
+	os.Mkdir(filepath.Join(cpath, "sources"), 0777)
+
+	// A keyring holding a key to sign with, and another holding nothing.
+	h.TempDir("keyring")
+	keyring := h.Path("keyring")
+	os.Chmod(keyring, 0700)
+	h.TempDir("empty")
+	empty := h.Path("empty")
+	os.Chmod(empty, 0700)
+	defer exec.Command("gpgconf", "--homedir", keyring, "--kill", "gpg-agent").Run()
+	defer exec.Command("gpgconf", "--homedir", empty, "--kill", "gpg-agent").Run()
+
+	gpg := func(args ...string) []byte {
+		out, err := exec.Command("gpg", append([]string{"--homedir", keyring, "--batch"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("gpg %s failed: %s\n%s", args, err, out)
+		}
+		return out
+	}
+	gpg("--pinentry-mode", "loopback", "--passphrase", "", "--quick-gen-key", "Test author <test@example.com>", "default", "sign", "never")
+	var fpr string
+	for _, line := range strings.Split(string(gpg("--with-colons", "--list-secret-keys")), "\n") {
+		if f := strings.Split(line, ":"); len(f) > 9 && f[0] == "fpr" {
+			fpr = f[9]
+			break
+		}
+	}
+
+	h.Setenv("GNUPGHOME", keyring)
+	h.TempDir("repo")
+	repoPath := h.Path("repo")
+	h.RunGit(repoPath, "init")
+	h.RunGit(repoPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(repoPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(repoPath, "config", "--local", "user.signingkey", fpr)
+	h.RunGit(repoPath, "commit", "--allow-empty", "-S", `--message="Signed commit"`)
+	h.RunGit(repoPath, "tag", "-s", "-m", "Release 1.0.0", "v1.0.0")
+	h.RunGit(repoPath, "tag", "-a", "-m", "Release 0.9.0", "v0.9.0")
+	h.RunGit(repoPath, "branch", "release")
+
+	rev, err := exec.Command("git", "-C", repoPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Revision(strings.TrimSpace(string(rev)))
+
+	u, err := url.Parse("file://" + filepath.ToSlash(repoPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	newGateway := func(keyring string) *sourceGateway {
+		src, err := maybeGitSource{url: u}.try(ctx, cpath)
+		if err != nil {
+			t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+		}
+		sg, err := newSourceGateway(ctx, src, newSupervisor(ctx), cpath, newMemoryCache())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sg.keyring = keyring
+		return sg
+	}
+
+	sg := newGateway(keyring)
+	defer sg.src.(*gitSource).close()
+	for _, v := range []Version{NewVersion("v1.0.0"), NewVersion("v1.0.0").Pair(r), r, NewBranch("release")} {
+		signer, err := sg.verifySignature(ctx, v)
+		if err != nil {
+			t.Errorf("Unexpected error verifying signature of %s: %s", v, err)
+		} else if signer != fpr {
+			t.Errorf("expected %s to be signed by %s, got %q", v, fpr, signer)
+		}
+	}
+
+	if _, err = sg.verifySignature(ctx, NewVersion("v0.9.0")); err == nil {
+		t.Error("expected an error verifying an unsigned tag")
+	}
+	if err = sg.exportVersionTo(ctx, NewVersion("v0.9.0"), filepath.Join(h.Path("."), "export")); err == nil {
+		t.Error("expected an error exporting an unsigned tag")
+	}
+	// A tag paired with a revision other than its own isn't trusted.
+	if _, err = sg.verifySignature(ctx, NewVersion("v1.0.0").Pair("0123456789012345678901234567890123456789")); err == nil {
+		t.Error("expected an error verifying a tag paired with another revision")
+	}
+
+	untrusted := newGateway(empty)
+	defer untrusted.src.(*gitSource).close()
+	if _, err = untrusted.verifySignature(ctx, NewVersion("v1.0.0")); err == nil {
+		t.Error("expected an error verifying a tag signed by an untrusted key")
+	}
+
+	// Without a keyring, nothing is checked.
+	if signer, err := newGateway("").verifySignature(ctx, NewVersion("v0.9.0")); err != nil || signer != "" {
+		t.Errorf("expected no verification without a keyring, got %q, %v", signer, err)
+	}
+}
+
+func TestGitSourceBatchedRevisionPresentIn(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	cpath := h.Path("smcache")
+	os.Mkdir(filepath.Join(cpath, "sources"), 0777)
+
+	h.TempDir("repo")
+	repoPath := h.Path("repo")
+	h.RunGit(repoPath, "init")
+	h.RunGit(repoPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(repoPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(repoPath, "commit", "--allow-empty", `--message="Initial commit"`)
+	h.RunGit(repoPath, "tag", "-a", "v1.0.0", "-m", "v1.0.0")
+
+	revParse := func(rev string) Revision {
+		out, err := exec.Command("git", "-C", repoPath, "rev-parse", rev).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Revision(strings.TrimSpace(string(out)))
+	}
+
+	un := "file://" + filepath.ToSlash(repoPath)
+	u, err := url.Parse(un)
+	if err != nil {
+		t.Fatalf("Error parsing URL %s: %s", un, err)
+	}
+
+	ctx := context.Background()
+	isrc, err := maybeGitSource{url: u}.try(ctx, cpath)
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+	}
+	src := isrc.(*gitSource)
+	defer src.close()
+	if err = src.initLocal(ctx); err != nil {
+		t.Fatalf("Error on cloning git repo: %s", err)
+	}
+
+	for rev, want := range map[Revision]bool{
+		revParse("HEAD"):                           true,
+		revParse("v1.0.0"):                         true, // An annotated tag object, peeled to its commit
+		"5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e": false,
+		"":           false,
+		"HEAD\nHEAD": false,
+	} {
+		got, err := src.revisionPresentIn(ctx, rev)
+		if err != nil {
+			t.Errorf("unexpected error checking for %q: %s", rev, err)
+		}
+		if got != want {
+			t.Errorf("unexpected presence of %q:\n\t(GOT): %v\n\t(WNT): %v", rev, got, want)
+		}
+	}
+
+	// All of the checks should have shared a single process.
+	src.batch.mu.Lock()
+	running := src.batch.in != nil
+	src.batch.mu.Unlock()
+	if !running {
+		t.Fatal("expected the batch process to be running")
+	}
+
+	// Revisions that arrive with an update must be seen.
+	h.RunGit(repoPath, "commit", "--allow-empty", `--message="Second commit"`)
+	if err = src.updateLocal(ctx); err != nil {
+		t.Fatalf("Error on updating git repo: %s", err)
+	}
+	if got, _ := src.revisionPresentIn(ctx, revParse("HEAD")); !got {
+		t.Error("expected a fetched revision to be present")
+	}
+
+	if err = src.close(); err != nil {
+		t.Errorf("unexpected error closing the batch process: %s", err)
+	}
+	if got, _ := src.revisionPresentIn(ctx, revParse("HEAD")); !got {
+		t.Error("expected the batch process to restart after being closed")
+	}
+}
+
+func TestGitSourceExportLockedRevisionShallow(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	cpath := h.Path("smcache")
+	os.Mkdir(filepath.Join(cpath, "sources"), 0777)
+
+	h.TempDir("repo")
+	repoPath := h.Path("repo")
+	h.RunGit(repoPath, "init")
+	h.RunGit(repoPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(repoPath, "config", "--local", "user.name", "Test author")
+	h.RunGit(repoPath, "config", "--local", "uploadpack.allowReachableSHA1InWant", "true")
+	h.TempFile("repo/file.go", "package repo")
+	h.RunGit(repoPath, "add", "file.go")
+	h.RunGit(repoPath, "commit", `--message="Initial commit"`)
+	h.RunGit(repoPath, "commit", "--allow-empty", `--message="Second commit"`)
+
+	revParse := func(rev string) Revision {
+		out, err := exec.Command("git", "-C", repoPath, "rev-parse", rev).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Revision(strings.TrimSpace(string(out)))
+	}
+	locked, latest := revParse("HEAD~1"), revParse("HEAD")
+
+	un := "file://" + filepath.ToSlash(repoPath)
+	u, err := url.Parse(un)
+	if err != nil {
+		t.Fatalf("Error parsing URL %s: %s", un, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	isrc, err := maybeGitSource{url: u}.try(ctx, cpath)
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+	}
+	src := isrc.(*gitSource)
+	defer src.close()
+
+	sg := &sourceGateway{
+		src:      src,
+		cachedir: cpath,
+		cache:    newMemoryCache(),
+		suprvsr:  newSupervisor(ctx),
+	}
+	lp := NewLockedProject(mkPI("example.com/repo"), NewBranch("master").Pair(locked), nil)
+	to := filepath.Join(h.Path("."), "vendor", "example.com", "repo")
+	if err = sg.exportPrunedVersionTo(ctx, lp, 0, to); err != nil {
+		t.Fatalf("Unexpected error exporting locked revision: %s", err)
+	}
+	h.MustExist(filepath.Join(to, "file.go"))
+
+	// Only the locked revision should have been fetched.
+	gr := src.repo.(*gitRepo)
+	if !gr.isShallow() {
+		t.Error("expected only the locked revision to be fetched")
+	}
+	if present, _ := src.revisionPresentIn(ctx, latest); present {
+		t.Error("expected revisions beyond the locked one not to be fetched")
+	}
+	if !sg.has(sourceExistsLocally) || sg.has(sourceHasLatestLocally) {
+		t.Errorf("unexpected gateway state after fetching a single revision: %s", sg.srcState)
+	}
+
+	// Updating must complete the history.
+	if err = sg.syncLocal(ctx); err != nil {
+		t.Fatalf("Unexpected error updating shallow repository: %s", err)
+	}
+	if gr.isShallow() {
+		t.Error("expected an update to fetch the full history")
+	}
+	if present, _ := src.revisionPresentIn(ctx, latest); !present {
+		t.Error("expected the latest revision to be present after updating")
+	}
+}
+
+func TestSparseExportPaths(t *testing.T) {
+	files := []string{
+		"LICENSE",
+		"root.go",
+		"pkg/LICENSE",
+		"pkg/pkg.go",
+		"pkg/used/used.go",
+		"pkg/used/testdata/data.txt",
+		"pkg/usedother/other.go",
+		"pkg/unused/COPYING",
+		"pkg/unused/unused.go",
+	}
+
+	got := sparseExportPaths(files, []string{"pkg/used"})
+	want := []string{
+		"LICENSE",
+		"pkg/LICENSE",
+		"pkg/used/used.go",
+		"pkg/used/testdata/data.txt",
+		"pkg/unused/COPYING",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected sparse export paths:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	if got := sparseExportPaths(files, []string{"pkg/used", "."}); got != nil {
+		t.Errorf("expected every file to be needed when the root package is used, got %v", got)
+	}
+}
+
+func TestGitSourceExportPrunedRevisionTo(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	cpath := h.Path("smcache")
+	os.Mkdir(filepath.Join(cpath, "sources"), 0777)
+
+	h.TempDir("repo")
+	repoPath := h.Path("repo")
+	h.RunGit(repoPath, "init")
+	h.RunGit(repoPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(repoPath, "config", "--local", "user.name", "Test author")
+	h.TempFile("repo/LICENSE", "license")
+	h.TempFile("repo/root.go", "package root")
+	h.TempFile("repo/used/used.go", "package used")
+	h.TempFile("repo/used/cgo.go", "package used\n\n// #include \"../include/thing.h\"\nimport \"C\"\n")
+	h.TempFile("repo/include/thing.h", "int thing();")
+	h.TempFile("repo/include/other.h", "int other();")
+	h.TempFile("repo/unused/LICENSE", "license")
+	h.TempFile("repo/unused/unused.go", "package unused")
+	h.RunGit(repoPath, "add", ".")
+	h.RunGit(repoPath, "commit", `--message="Initial commit"`)
+
+	un := "file://" + filepath.ToSlash(repoPath)
+	u, err := url.Parse(un)
+	if err != nil {
+		t.Fatalf("Error parsing URL %s: %s", un, err)
+	}
+
+	ctx := context.Background()
+	isrc, err := maybeGitSource{url: u}.try(ctx, cpath)
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+	}
+	src := isrc.(*gitSource)
+	defer src.close()
+	if err = src.initLocal(ctx); err != nil {
+		t.Fatalf("Error on cloning git repo: %s", err)
+	}
+
+	out, err := exec.Command("git", "-C", repoPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev := Revision(strings.TrimSpace(string(out)))
+	lp := NewLockedProject(mkPI("example.com/repo"), rev, []string{"used"})
+
+	to := filepath.Join(h.Path("."), "vendor", "example.com", "repo")
+	if err = src.exportPrunedRevisionTo(ctx, rev, lp, PruneUnusedPackages, to); err != nil {
+		t.Fatalf("Unexpected error exporting pruned revision: %s", err)
+	}
+	h.MustExist(filepath.Join(to, "LICENSE"))
+	h.MustExist(filepath.Join(to, "used", "used.go"))
+	h.MustNotExist(filepath.Join(to, "root.go"))
+	h.MustExist(filepath.Join(to, "unused", "LICENSE"))
+	// Included by a used package, so kept as pruning would keep it.
+	h.MustExist(filepath.Join(to, "include", "thing.h"))
+	// Never written out, rather than pruned away.
+	h.MustNotExist(filepath.Join(to, "unused", "unused.go"))
+	h.MustNotExist(filepath.Join(to, "include", "other.h"))
+}
+
+func TestGitSourceExportVerification(t *testing.T) {
+	requiresBins(t, "git")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	cpath := h.Path("smcache")
+	os.Mkdir(filepath.Join(cpath, "sources"), 0777)
+
+	h.TempDir("repo")
+	repoPath := h.Path("repo")
+	h.RunGit(repoPath, "init")
+	h.RunGit(repoPath, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(repoPath, "config", "--local", "user.name", "Test author")
+	h.TempFile("repo/LICENSE", "license")
+	h.TempFile("repo/pkg/pkg.go", "package pkg")
+	h.RunGit(repoPath, "add", ".")
+	h.RunGit(repoPath, "commit", `--message="Initial commit"`)
+
+	un := "file://" + filepath.ToSlash(repoPath)
+	u, err := url.Parse(un)
+	if err != nil {
+		t.Fatalf("Error parsing URL %s: %s", un, err)
+	}
+
+	ctx := context.Background()
+	isrc, err := maybeGitSource{url: u}.try(ctx, cpath)
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+	}
+	src := isrc.(*gitSource)
+	defer src.close()
+	if err = src.initLocal(ctx); err != nil {
+		t.Fatalf("Error on cloning git repo: %s", err)
+	}
+
+	out, err := exec.Command("git", "-C", repoPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev := Revision(strings.TrimSpace(string(out)))
+
+	to := filepath.Join(h.Path("."), "vendor", "example.com", "repo")
+	if err = src.exportRevisionTo(ctx, rev, to); err != nil {
+		t.Fatalf("Unexpected error exporting revision: %s", err)
+	}
+	if err = src.verifyExportedRevision(ctx, rev, to, nil); err != nil {
+		t.Fatalf("Unexpected error verifying untouched export: %s", err)
+	}
+
+	// Simulate an export that picked up changes not in the revision.
+	h.TempFile("vendor/example.com/repo/pkg/pkg.go", "package changed")
+	os.Remove(filepath.Join(to, "LICENSE"))
+	err = src.verifyExportedRevision(ctx, rev, to, nil)
+	merr, ok := err.(*ExportMismatchError)
+	if !ok {
+		t.Fatalf("expected an *ExportMismatchError, got %T: %v", err, err)
+	}
+	if merr.Revision != rev || !reflect.DeepEqual(merr.Files, []string{"LICENSE", "pkg/pkg.go"}) {
+		t.Errorf("unexpected mismatch reported: %s", merr)
+	}
+
+	// Only the files that were exported are checked.
+	if err = src.verifyExportedRevision(ctx, rev, to, []string{"LICENSE"}); err == nil {
+		t.Error("expected removed file to be reported as mismatched")
+	}
+	h.TempFile("vendor/example.com/repo/LICENSE", "license")
+	if err = src.verifyExportedRevision(ctx, rev, to, []string{"LICENSE"}); err != nil {
+		t.Errorf("Unexpected error verifying only restored file: %s", err)
+	}
+}
+
+func TestCaseCollisions(t *testing.T) {
+	files := []string{
+		"README.md",
+		"Readme.md",
+		"pkg/file.go",
+		"Pkg/other.go",
+		"pkg/sub/a.go",
+		"pkg/sub/b.go",
+		"unique.go",
+	}
+	want := [][]string{
+		{"Pkg", "pkg"},
+		{"README.md", "Readme.md"},
+	}
+	if got := caseCollisions(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected case collisions:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	if got := caseCollisions([]string{"a/b.go", "a/c.go", "B.go"}); got != nil {
+		t.Errorf("expected no collisions, got %v", got)
+	}
+
+	err := &CaseCollisionError{Revision: "abc", Path: "to", Collisions: want}
+	if !strings.Contains(err.Error(), "Pkg and pkg; README.md and Readme.md") {
+		t.Errorf("expected error to list collisions, got: %s", err)
+	}
+}
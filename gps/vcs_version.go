@@ -15,23 +15,23 @@ import (
 func VCSVersion(path string) (Version, error) {
 	repo, err := vcs.NewRepo("", path)
 	if err != nil {
-		return nil, errors.Wrapf(err, "creating new repo for root: %s", path)
+		return nil, wrapErrorf(err, "creating new repo for root: %s", path)
 	}
 
 	ver, err := repo.Current()
 	if err != nil {
-		return nil, errors.Wrapf(err, "finding current branch/version for root: %s", path)
+		return nil, wrapErrorf(err, "finding current branch/version for root: %s", path)
 	}
 
 	rev, err := repo.Version()
 	if err != nil {
-		return nil, errors.Wrapf(err, "getting repo version for root: %s", path)
+		return nil, wrapErrorf(err, "getting repo version for root: %s", path)
 	}
 
 	// First look through tags.
 	tags, err := repo.Tags()
 	if err != nil {
-		return nil, errors.Wrapf(err, "getting repo tags for root: %s", path)
+		return nil, wrapErrorf(err, "getting repo tags for root: %s", path)
 	}
 	// Try to match the current version to a tag.
 	if contains(tags, ver) {
@@ -46,7 +46,7 @@ func VCSVersion(path string) (Version, error) {
 	// Look for the current branch.
 	branches, err := repo.Branches()
 	if err != nil {
-		return nil, errors.Wrapf(err, "getting repo branch for root: %s", path)
+		return nil, wrapErrorf(err, "getting repo branch for root: %s", path)
 	}
 	// Try to match the current version to a branch.
 	if contains(branches, ver) {
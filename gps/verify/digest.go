@@ -11,13 +11,13 @@ import (
 	"encoding/hex"
 	"fmt"
 	"hash"
-	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/golang/dep/gps/internal/dirhash"
 	"github.com/pkg/errors"
 )
 
@@ -25,106 +25,8 @@ import (
 // the directory hasher.
 //
 //   1: SHA256, as implemented in crypto/sha256
-const HashVersion = 1
-
-const osPathSeparator = string(filepath.Separator)
-
-// lineEndingReader is a `io.Reader` that converts CRLF sequences to LF.
-//
-// When cloning or checking out repositories, some Version Control Systems,
-// VCSs, on some supported Go Operating System architectures, GOOS, will
-// automatically convert line endings that end in a single line feed byte, LF,
-// to line endings that end in a two byte sequence of carriage return, CR,
-// followed by LF. This LF to CRLF conversion would cause otherwise identical
-// versioned files to have different on disk contents simply based on which VCS
-// and GOOS are involved. Different file contents for the same file would cause
-// the resultant hashes to differ. In order to ensure file contents normalize
-// and produce the same hash, this structure wraps an io.Reader that modifies
-// the file's contents when it is read, translating all CRLF sequences to LF.
-type lineEndingReader struct {
-	src             io.Reader // source io.Reader from which this reads
-	prevReadEndedCR bool      // used to track whether final byte of previous Read was CR
-}
-
-// newLineEndingReader returns a new lineEndingReader that reads from the
-// specified source io.Reader.
-func newLineEndingReader(src io.Reader) *lineEndingReader {
-	return &lineEndingReader{src: src}
-}
-
-var crlf = []byte("\r\n")
-
-// Read consumes bytes from the structure's source io.Reader to fill the
-// specified slice of bytes. It converts all CRLF byte sequences to LF, and
-// handles cases where CR and LF straddle across two Read operations.
-func (f *lineEndingReader) Read(buf []byte) (int, error) {
-	buflen := len(buf)
-	if f.prevReadEndedCR {
-		// Read one fewer bytes so we have room if the first byte of the
-		// upcoming Read is not a LF, in which case we will need to insert
-		// trailing CR from previous read.
-		buflen--
-	}
-	nr, er := f.src.Read(buf[:buflen])
-	if nr > 0 {
-		if f.prevReadEndedCR && buf[0] != '\n' {
-			// Having a CRLF split across two Read operations is rare, so the
-			// performance impact of copying entire buffer to the right by one
-			// byte, while suboptimal, will at least will not happen very
-			// often. This negative performance impact is mitigated somewhat on
-			// many Go compilation architectures, GOARCH, because the `copy`
-			// builtin uses a machine opcode for performing the memory copy on
-			// possibly overlapping regions of memory. This machine opcodes is
-			// not instantaneous and does require multiple CPU cycles to
-			// complete, but is significantly faster than the application
-			// looping through bytes.
-			copy(buf[1:nr+1], buf[:nr]) // shift data to right one byte
-			buf[0] = '\r'               // insert the previous skipped CR byte at start of buf
-			nr++                        // pretend we read one more byte
-		}
-
-		// Remove any CRLF sequences in the buffer using `bytes.Index` because,
-		// like the `copy` builtin on many GOARCHs, it also takes advantage of a
-		// machine opcode to search for byte patterns.
-		var searchOffset int // index within buffer from whence the search will commence for each loop; set to the index of the end of the previous loop.
-		var shiftCount int   // each subsequenct shift operation needs to shift bytes to the left by one more position than the shift that preceded it.
-		previousIndex := -1  // index of previously found CRLF; -1 means no previous index
-		for {
-			index := bytes.Index(buf[searchOffset:nr], crlf)
-			if index == -1 {
-				break
-			}
-			index += searchOffset // convert relative index to absolute
-			if previousIndex != -1 {
-				// shift substring between previous index and this index
-				copy(buf[previousIndex-shiftCount:], buf[previousIndex+1:index])
-				shiftCount++ // next shift needs to be 1 byte to the left
-			}
-			previousIndex = index
-			searchOffset = index + 2 // start next search after len(crlf)
-		}
-		if previousIndex != -1 {
-			// handle final shift
-			copy(buf[previousIndex-shiftCount:], buf[previousIndex+1:nr])
-			shiftCount++
-		}
-		nr -= shiftCount // shorten byte read count by number of shifts executed
-
-		// When final byte from a read operation is CR, do not emit it until
-		// ensure first byte on next read is not LF.
-		if f.prevReadEndedCR = buf[nr-1] == '\r'; f.prevReadEndedCR {
-			nr-- // pretend byte was never read from source
-		}
-	} else if f.prevReadEndedCR {
-		// Reading from source returned nothing, but this struct is sitting on a
-		// trailing CR from previous Read, so let's give it to client now.
-		buf[0] = '\r'
-		nr = 1
-		er = nil
-		f.prevReadEndedCR = false // prevent infinite loop
-	}
-	return nr, er
-}
+//   2: As 1, but excluding any per-file digest listing at the root of the tree
+const HashVersion = 2
 
 // writeBytesWithNull appends the specified data to the specified hash, followed by
 // the NULL byte, in order to make accidental hash collisions less likely.
@@ -134,15 +36,6 @@ func writeBytesWithNull(h hash.Hash, data []byte) {
 	_, _ = h.Write(append(data, 0))
 }
 
-// dirWalkClosure is used to reduce number of allocation involved in closing
-// over these variables.
-type dirWalkClosure struct {
-	someCopyBufer []byte // allocate once and reuse for each file copy
-	someModeBytes []byte // allocate once and reuse for each node
-	someDirLen    int
-	someHash      hash.Hash
-}
-
 // DigestFromDirectory returns a hash of the specified directory contents, which
 // will match the hash computed for any directory on any supported Go platform
 // whose contents exactly match the specified directory.
@@ -156,40 +49,16 @@ type dirWalkClosure struct {
 // is an empty directory, a non-empty directory, an empty file, or a non-empty file.
 //
 // Symbolic links are excluded, as they are not considered valid elements in the
-// definition of a Go module.
+// definition of a Go module. So is any per-file digest listing written by
+// WriteFileDigests.
 func DigestFromDirectory(osDirname string) (VersionedDigest, error) {
-	osDirname = filepath.Clean(osDirname)
-
 	// Create a single hash instance for the entire operation, rather than a new
 	// hash for each node we encounter.
+	someHash := sha256.New()
+	someCopyBuffer := make([]byte, 4*1024) // only allocate a single page
+	someModeBytes := make([]byte, 4)       // scratch place to store encoded os.FileMode (uint32)
 
-	closure := dirWalkClosure{
-		someCopyBufer: make([]byte, 4*1024), // only allocate a single page
-		someModeBytes: make([]byte, 4),      // scratch place to store encoded os.FileMode (uint32)
-		someDirLen:    len(osDirname) + len(osPathSeparator),
-		someHash:      sha256.New(),
-	}
-
-	err := filepath.Walk(osDirname, func(osPathname string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Completely ignore symlinks.
-		if info.Mode()&os.ModeSymlink != 0 {
-			return nil
-		}
-
-		var osRelative string
-		if len(osPathname) > closure.someDirLen {
-			osRelative = osPathname[closure.someDirLen:]
-		}
-
-		switch filepath.Base(osRelative) {
-		case "vendor", ".bzr", ".git", ".hg", ".svn":
-			return filepath.SkipDir
-		}
-
+	err := dirhash.Walk(osDirname, func(osPathname, osRelative string, modeType os.FileMode) error {
 		// We could make our own enum-like data type for encoding the file type,
 		// but Go's runtime already gives us architecture independent file
 		// modes, as discussed in `os/types.go`:
@@ -203,14 +72,13 @@ func DigestFromDirectory(osDirname string) (VersionedDigest, error) {
 		// node, and can ignore append, exclusive, temporary, setuid, setgid,
 		// permission bits, and sticky bits, which are coincident to bits which
 		// declare type of the file system node.
-		modeType := info.Mode() & os.ModeType
 		var shouldSkip bool // skip some types of file system nodes
 
 		switch {
 		case modeType&os.ModeDir > 0:
 			mt = os.ModeDir
 			// This func does not need to enumerate children, because
-			// filepath.Walk will do that for us.
+			// dirhash.Walk will do that for us.
 			shouldSkip = true
 		case modeType&os.ModeNamedPipe > 0:
 			mt = os.ModeNamedPipe
@@ -227,32 +95,22 @@ func DigestFromDirectory(osDirname string) (VersionedDigest, error) {
 		// the node names, node types, and node contents. Added benefit is that
 		// empty directories, named pipes, sockets, and devices. Use
 		// `filepath.ToSlash` to ensure relative pathname is os-agnostic.
-		writeBytesWithNull(closure.someHash, []byte(filepath.ToSlash(osRelative)))
+		writeBytesWithNull(someHash, []byte(filepath.ToSlash(osRelative)))
 
-		binary.LittleEndian.PutUint32(closure.someModeBytes, uint32(mt)) // encode the type of mode
-		writeBytesWithNull(closure.someHash, closure.someModeBytes)      // and write to hash
+		binary.LittleEndian.PutUint32(someModeBytes, uint32(mt)) // encode the type of mode
+		writeBytesWithNull(someHash, someModeBytes)              // and write to hash
 
 		if shouldSkip {
 			return nil // nothing more to do for some of the node types
 		}
 
 		// If we get here, node is a regular file.
-		fh, err := os.Open(osPathname)
+		bytesWritten, err := dirhash.CopyFile(someHash, osPathname, someCopyBuffer) // fast copy of file contents to hash
 		if err != nil {
-			return errors.Wrap(err, "cannot Open")
-		}
-
-		var bytesWritten int64
-		bytesWritten, err = io.CopyBuffer(closure.someHash, newLineEndingReader(fh), closure.someCopyBufer) // fast copy of file contents to hash
-		err = errors.Wrap(err, "cannot Copy")                                                               // errors.Wrap only wraps non-nil, so skip extra check
-		writeBytesWithNull(closure.someHash, []byte(strconv.FormatInt(bytesWritten, 10)))                   // 10: format file size as base 10 integer
-
-		// Close the file handle to the open file without masking
-		// possible previous error value.
-		if er := fh.Close(); err == nil {
-			err = errors.Wrap(er, "cannot Close")
+			return err
 		}
-		return err
+		writeBytesWithNull(someHash, []byte(strconv.FormatInt(bytesWritten, 10))) // 10: format file size as base 10 integer
+		return nil
 	})
 
 	if err != nil {
@@ -261,7 +119,7 @@ func DigestFromDirectory(osDirname string) (VersionedDigest, error) {
 
 	return VersionedDigest{
 		HashVersion: HashVersion,
-		Digest:      closure.someHash.Sum(nil),
+		Digest:      someHash.Sum(nil),
 	}, nil
 }
 
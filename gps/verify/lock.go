@@ -15,4 +15,23 @@ type VerifiableProject struct {
 	gps.LockedProject
 	PruneOpts gps.PruneOptions
 	Digest    VersionedDigest
+	// SignedBy is the fingerprint of the key whose signature on the project's
+	// version was verified, if signatures were verified.
+	SignedBy string
+	// Sum is the hash of the project's version as a module, as verified
+	// against a checksum database, if it was verified.
+	Sum string
+	// Mirror is the URL of the mirror or proxy that the project was retrieved
+	// through, if it was not retrieved from upstream, to keep retrieving it
+	// through.
+	Mirror string
+	// Provenance records where the project's version was retrieved from, if
+	// it was recorded.
+	Provenance gps.Provenance
+}
+
+// Annotations returns the annotations of the LockedProject vp composes, which
+// are set by annotating it with gps.Annotate.
+func (vp VerifiableProject) Annotations() gps.Annotations {
+	return gps.ProjectAnnotations(vp.LockedProject)
 }
@@ -28,7 +28,9 @@ type LockSatisfaction struct {
 	// but absent from the inputs.
 	ExcessImports []string
 	// UnmatchedConstraints reports any normal, non-override constraint rules that
-	// were not satisfied by the corresponding LockedProject in the Lock.
+	// were not satisfied by the corresponding LockedProject in the Lock. If the
+	// manifest is a gps.ScopedRootManifest, any applicable scoped constraint on
+	// a project is intersected with its normal constraint, as the solver does.
 	UnmetConstraints map[gps.ProjectRoot]ConstraintMismatch
 	// UnmatchedOverrides reports any override rules that were not satisfied by the
 	// corresponding LockedProject in the Lock.
@@ -125,6 +127,10 @@ func LockSatisfiesInputs(l gps.Lock, m gps.RootManifest, ptree pkgtree.PackageTr
 
 	eff := findEffectualConstraints(m, ininputs)
 	ovr, constraints := m.Overrides(), m.DependencyConstraints()
+	var scoped gps.ScopedConstraints
+	if srm, ok := m.(gps.ScopedRootManifest); ok {
+		scoped = srm.ScopedConstraints().Applicable(rm)
+	}
 
 	for _, lp := range l.Projects() {
 		pr := lp.Ident().ProjectRoot
@@ -141,9 +147,21 @@ func LockSatisfiesInputs(l gps.Lock, m gps.RootManifest, ptree pkgtree.PackageTr
 			continue
 		}
 
-		if pp, has := constraints[pr]; has && eff[string(pr)] && !pp.Constraint.Matches(lp.Version()) {
+		var c gps.Constraint
+		if pp, has := constraints[pr]; has && eff[string(pr)] {
+			c = pp.Constraint
+		}
+		if scc, has := scoped[pr]; has && scc.Constraint != nil {
+			if c == nil {
+				c = scc.Constraint
+			} else {
+				c = c.Intersect(scc.Constraint)
+			}
+		}
+
+		if c != nil && !c.Matches(lp.Version()) {
 			lsat.UnmetConstraints[pr] = ConstraintMismatch{
-				C: pp.Constraint,
+				C: c,
 				V: lp.Version(),
 			}
 		}
@@ -184,6 +184,119 @@ func TestLockSatisfaction(t *testing.T) {
 	}
 }
 
+// scopedRootManifest is a simpleRootManifest with scoped constraints.
+type scopedRootManifest struct {
+	simpleRootManifest
+	sc gps.ScopedConstraints
+}
+
+func (m scopedRootManifest) ScopedConstraints() gps.ScopedConstraints {
+	return m.sc
+}
+
+func TestLockSatisfactionScoped(t *testing.T) {
+	fooversion := gps.NewVersion("v1.0.0").Pair("foorev1")
+	bazversion := gps.NewVersion("v2.0.0").Pair("bazrev1")
+	l := safeLock{
+		i: []string{"foo.com/bar", "baz.com/qux"},
+		p: []gps.LockedProject{
+			newVerifiableProject(mkPI("foo.com/bar"), fooversion, []string{"."}),
+			newVerifiableProject(mkPI("baz.com/qux"), bazversion, []string{"."}),
+		},
+	}
+
+	// Only current/cmd reaches baz.com/qux.
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "current",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"current": {
+				P: pkgtree.Package{
+					Name:       "current",
+					ImportPath: "current",
+					Imports:    []string{"foo.com/bar"},
+				},
+			},
+			"current/cmd": {
+				P: pkgtree.Package{
+					Name:       "main",
+					ImportPath: "current/cmd",
+					Imports:    []string{"baz.com/qux/sub"},
+				},
+			},
+		},
+	}
+
+	scoped := func(pr string, c gps.Constraint, pkgs ...string) gps.ScopedConstraints {
+		return gps.ScopedConstraints{
+			gps.ProjectRoot(pr): {
+				ProjectProperties: gps.ProjectProperties{Constraint: c},
+				Packages:          pkgs,
+			},
+		}
+	}
+	c2, _ := gps.NewSemverConstraint("^2.0.0")
+
+	tt := map[string]struct {
+		sc    gps.ScopedConstraints
+		c     gps.ProjectConstraints
+		ovr   gps.ProjectConstraints
+		unmet gps.Constraint
+	}{
+		"acceptable scoped constraint": {
+			sc: scoped("baz.com/qux", bazversion.Unpair(), "current/cmd"),
+		},
+		"unacceptable scoped constraint": {
+			sc:    scoped("baz.com/qux", fooversion.Unpair(), "current/cmd"),
+			unmet: fooversion.Unpair(),
+		},
+		"inapplicable scoped constraint": {
+			sc: scoped("baz.com/qux", fooversion.Unpair(), "current"),
+		},
+		"scoped constraint intersected with unscoped": {
+			sc: scoped("baz.com/qux", bazversion.Unpair(), "current/cmd"),
+			c:  gps.ProjectConstraints{"baz.com/qux": {Constraint: c2}},
+		},
+		"scoped constraint disjoint with unscoped": {
+			sc:    scoped("baz.com/qux", fooversion.Unpair(), "current/cmd"),
+			c:     gps.ProjectConstraints{"baz.com/qux": {Constraint: c2}},
+			unmet: c2.Intersect(fooversion.Unpair()),
+		},
+		"override wins over scoped constraint": {
+			sc:  scoped("baz.com/qux", fooversion.Unpair(), "current/cmd"),
+			ovr: gps.ProjectConstraints{"baz.com/qux": {Constraint: bazversion.Unpair()}},
+		},
+	}
+
+	for name, fix := range tt {
+		fix := fix
+		t.Run(name, func(t *testing.T) {
+			m := scopedRootManifest{
+				simpleRootManifest: simpleRootManifest{
+					c:   fix.c,
+					ovr: fix.ovr,
+					req: map[string]bool{},
+				},
+				sc: fix.sc,
+			}
+			lsat := LockSatisfiesInputs(l, m, ptree)
+
+			unmet, has := lsat.UnmetConstraints["baz.com/qux"]
+			if fix.unmet == nil {
+				if has {
+					t.Errorf("expected the constraints on baz.com/qux to be met, got %s unmet", unmet.C)
+				}
+				return
+			}
+			if !has {
+				t.Fatal("expected the constraints on baz.com/qux to be unmet")
+			}
+			if unmet.C.String() != fix.unmet.String() || unmet.V != bazversion {
+				t.Errorf("expected %s to be unmet by %s, got %s unmet by %s", fix.unmet, bazversion, unmet.C, unmet.V)
+			}
+		})
+	}
+}
+
 func (ls LockSatisfaction) unsatTypes() lockUnsatisfactionDimension {
 	var dims lockUnsatisfactionDimension
 
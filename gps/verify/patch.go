@@ -0,0 +1,342 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps/internal/dirhash"
+	"github.com/pkg/errors"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffEdits bounds the work done to find the smallest diff of a file. Files
+// that differ by more lines than this are shown as wholly replaced.
+const maxDiffEdits = 2000
+
+// DiffTrees writes to w a unified diff of the changes that turn the tree at
+// osOldDir into the one at osNewDir, such as a fresh export of a project and
+// its vendored copy, in a form that patch -p1 and git apply understand.
+// Pathnames in it are slash-separated, relative to the roots of the trees, and
+// prefixed with oldPrefix or newPrefix, such as "a/vendor/example.com/foo/".
+//
+// Files only in one tree are diffed against /dev/null, and binary files are
+// only reported to differ. Per-file digest listings are left out, as they are
+// not part of the project.
+func DiffTrees(w io.Writer, osOldDir, osNewDir, oldPrefix, newPrefix string) error {
+	oldFiles, err := treeFiles(osOldDir)
+	if err != nil {
+		return err
+	}
+	newFiles, err := treeFiles(osNewDir)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(oldFiles)+len(newFiles))
+	for path := range oldFiles {
+		paths = append(paths, path)
+	}
+	for path := range newFiles {
+		if _, has := oldFiles[path]; !has {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	bw := bufio.NewWriter(w)
+	for _, path := range paths {
+		oldName, newName := oldPrefix+path, newPrefix+path
+		var a, b []byte
+		if osPath, has := oldFiles[path]; has {
+			if a, err = readTreeFile(osPath); err != nil {
+				return err
+			}
+		} else {
+			oldName = "/dev/null"
+		}
+		if osPath, has := newFiles[path]; has {
+			if b, err = readTreeFile(osPath); err != nil {
+				return err
+			}
+		} else {
+			newName = "/dev/null"
+		}
+
+		if bytes.Equal(a, b) && oldName != "/dev/null" && newName != "/dev/null" {
+			continue
+		}
+		if isBinary(a) || isBinary(b) {
+			fmt.Fprintf(bw, "Binary files %s and %s differ\n", oldName, newName)
+			continue
+		}
+		fmt.Fprintf(bw, "--- %s\n+++ %s\n", oldName, newName)
+		writeHunks(bw, diffLines(splitLines(a), splitLines(b)))
+	}
+	return bw.Flush()
+}
+
+// treeFiles maps the slash-separated pathnames of the regular files and
+// symlinks in the tree rooted at osDirname, relative to it, to their OS
+// pathnames. A missing tree has no files.
+func treeFiles(osDirname string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(osDirname, func(osPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if osPath == osDirname && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(osDirname, osPath)
+		if err != nil {
+			return err
+		}
+		if rel == dirhash.FileDigestsName {
+			return nil
+		}
+		if info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0 {
+			files[filepath.ToSlash(rel)] = osPath
+		}
+		return nil
+	})
+	return files, errors.Wrapf(err, "cannot list files in %s", osDirname)
+}
+
+// readTreeFile returns the contents of the file at osPath, or if it is a
+// symlink, the pathname it refers to.
+func readTreeFile(osPath string) ([]byte, error) {
+	fi, err := os.Lstat(osPath)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(osPath)
+		return []byte(target), err
+	}
+	return ioutil.ReadFile(osPath)
+}
+
+// isBinary reports whether b looks like the contents of a binary file, in the
+// same way as git and GNU diff: by having a NUL byte near the start.
+func isBinary(b []byte) bool {
+	if len(b) > 8000 {
+		b = b[:8000]
+	}
+	return bytes.IndexByte(b, 0) != -1
+}
+
+// splitLines splits b into lines, each keeping its newline, if it has one.
+func splitLines(b []byte) []string {
+	var lines []string
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n') + 1
+		if i == 0 {
+			i = len(b)
+		}
+		lines = append(lines, string(b[:i]))
+		b = b[i:]
+	}
+	return lines
+}
+
+// diffLine is a line of a unified diff: a line of the old file that is kept
+// (' ') or deleted ('-'), or a line of the new one that is inserted ('+').
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines returns the lines of a diff from a to b, using Myers' algorithm,
+// which finds one with the fewest deletions and insertions.
+func diffLines(a, b []string) []diffLine {
+	// Lines common to the start and end of both are kept, so leave them out
+	// of the search.
+	var pre, suf int
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var dl []diffLine
+	for _, line := range a[:pre] {
+		dl = append(dl, diffLine{' ', line})
+	}
+	dl = append(dl, myersDiff(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, line := range a[len(a)-suf:] {
+		dl = append(dl, diffLine{' ', line})
+	}
+	return dl
+}
+
+// myersDiff returns the lines of a diff from a to b with the fewest edits, or
+// if there are more than maxDiffEdits, one deleting all of a and inserting
+// all of b.
+func myersDiff(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	// v[k] is the furthest x reached on diagonal k, offset so that k may be
+	// negative. trace[d] is the part of v that step d started from.
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	found := -1
+	for d := 0; d <= n+m && d <= maxDiffEdits && found < 0; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = d
+				break
+			}
+		}
+	}
+
+	if found < 0 {
+		dl := make([]diffLine, 0, n+m)
+		for _, line := range a {
+			dl = append(dl, diffLine{'-', line})
+		}
+		for _, line := range b {
+			dl = append(dl, diffLine{'+', line})
+		}
+		return dl
+	}
+
+	// Walk back from the end through each step's edit, collecting the lines
+	// in reverse.
+	var rev []diffLine
+	x, y := n, m
+	for d := found; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+		var pk int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := at(pk)
+		py := px - pk
+		// The edit was an insertion if it moved down from diagonal k+1, and a
+		// deletion if it moved right from k-1, followed by kept lines.
+		mx, my := px+1, py
+		if pk == k+1 {
+			mx, my = px, py+1
+		}
+		for x > mx && y > my {
+			rev = append(rev, diffLine{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if pk == k+1 {
+			rev = append(rev, diffLine{'+', b[py]})
+		} else {
+			rev = append(rev, diffLine{'-', a[px]})
+		}
+		x, y = px, py
+	}
+	for x > 0 && y > 0 {
+		rev = append(rev, diffLine{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+
+	dl := make([]diffLine, len(rev))
+	for i, line := range rev {
+		dl[len(rev)-1-i] = line
+	}
+	return dl
+}
+
+// writeHunks writes the hunks of dl, each change with up to diffContext kept
+// lines around it, and changes that close together in the same hunk.
+func writeHunks(w io.Writer, dl []diffLine) {
+	// The number of lines of the old and new files before each line of dl.
+	aBefore, bBefore := make([]int, len(dl)+1), make([]int, len(dl)+1)
+	for i, line := range dl {
+		aBefore[i+1], bBefore[i+1] = aBefore[i], bBefore[i]
+		if line.op != '+' {
+			aBefore[i+1]++
+		}
+		if line.op != '-' {
+			bBefore[i+1]++
+		}
+	}
+
+	for i := 0; i < len(dl); {
+		for i < len(dl) && dl[i].op == ' ' {
+			i++
+		}
+		if i == len(dl) {
+			break
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(dl) {
+			if dl[end].op != ' ' {
+				end++
+				continue
+			}
+			j := end
+			for j < len(dl) && dl[j].op == ' ' {
+				j++
+			}
+			if j == len(dl) || j-end > 2*diffContext {
+				if end += diffContext; end > j {
+					end = j
+				}
+				break
+			}
+			end = j
+		}
+
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(aBefore[start], aBefore[end]), hunkRange(bBefore[start], bBefore[end]))
+		for _, line := range dl[start:end] {
+			fmt.Fprintf(w, "%c%s", line.op, line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				fmt.Fprint(w, "\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+}
+
+// hunkRange formats the range of lines from after line from up to and
+// including line to, as it appears in a hunk header.
+func hunkRange(from, to int) string {
+	if from == to {
+		// An empty range is given by the line it follows.
+		return fmt.Sprintf("%d,0", from)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
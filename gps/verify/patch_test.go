@@ -0,0 +1,134 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/gps/internal/dirhash"
+)
+
+func TestDiffTrees(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "dep-patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	write := func(path, contents string) {
+		path = filepath.Join(tmp, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("old/a.go", "package a\n\nfunc A() {}\n")
+	write("new/a.go", "package a\n\nfunc A() { panic(1) }\n")
+	write("old/same.go", "package a\n")
+	write("new/same.go", "package a\n")
+	write("old/gone.go", "package a\n// gone")
+	write("new/sub/added.go", "package sub\n")
+	write("old/bin", "\x00\x01")
+	write("new/bin", "\x00\x02")
+	write("new/"+dirhash.FileDigestsName, "ignored\n")
+
+	var buf bytes.Buffer
+	if err = DiffTrees(&buf, filepath.Join(tmp, "old"), filepath.Join(tmp, "new"), "a/vendor/x/", "b/vendor/x/"); err != nil {
+		t.Fatal(err)
+	}
+	want := `--- a/vendor/x/a.go
++++ b/vendor/x/a.go
+@@ -1,3 +1,3 @@
+ package a
+` + " " + `
+-func A() {}
++func A() { panic(1) }
+Binary files a/vendor/x/bin and b/vendor/x/bin differ
+--- a/vendor/x/gone.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package a
+-// gone
+\ No newline at end of file
+--- /dev/null
++++ b/vendor/x/sub/added.go
+@@ -0,0 +1,1 @@
++package sub
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected diff:\n(GOT):\n%s\n(WNT):\n%s", got, want)
+	}
+
+	// A missing tree has no files, so everything in the other is added.
+	buf.Reset()
+	if err = DiffTrees(&buf, filepath.Join(tmp, "missing"), filepath.Join(tmp, "new"), "a/", "b/"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "--- /dev/null\n+++ b/a.go\n") {
+		t.Errorf("expected files to be diffed against /dev/null, got:\n%s", buf.String())
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	// lcs returns the length of the longest common subsequence of a and b,
+	// which a diff with the fewest edits keeps.
+	lcs := func(a, b []string) int {
+		l := make([][]int, len(a)+1)
+		for i := range l {
+			l[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					l[i][j] = l[i+1][j+1] + 1
+				} else if l[i+1][j] > l[i][j+1] {
+					l[i][j] = l[i+1][j]
+				} else {
+					l[i][j] = l[i][j+1]
+				}
+			}
+		}
+		return l[0][0]
+	}
+
+	r := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		l := make([]string, r.Intn(12))
+		for i := range l {
+			l[i] = string('a'+rune(r.Intn(4))) + "\n"
+		}
+		return l
+	}
+	for i := 0; i < 500; i++ {
+		a, b := lines(), lines()
+		var gotA, gotB []string
+		var kept int
+		for _, line := range diffLines(a, b) {
+			switch line.op {
+			case ' ':
+				gotA, gotB = append(gotA, line.text), append(gotB, line.text)
+				kept++
+			case '-':
+				gotA = append(gotA, line.text)
+			case '+':
+				gotB = append(gotB, line.text)
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diff of %q and %q does not reproduce them", a, b)
+		}
+		if want := lcs(a, b); kept != want {
+			t.Fatalf("diff of %q and %q keeps %d lines, want %d", a, b, kept, want)
+		}
+	}
+}
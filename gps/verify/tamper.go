@@ -0,0 +1,106 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang/dep/gps/internal/dirhash"
+	"github.com/pkg/errors"
+)
+
+// ErrNoFileDigests is returned by DiffFileDigests for a project tree that has
+// no per-file digest listing to compare against, such as one exported without
+// SourceManagerConfig.FileDigests set.
+var ErrNoFileDigests = errors.New("no per-file digest listing recorded for project")
+
+// FileChanges lists the files in a project tree that have changed since its
+// per-file digest listing was recorded, when the project was exported. Each
+// list holds slash-separated pathnames relative to the project root, in
+// lexical order.
+type FileChanges struct {
+	Added, Removed, Modified []string
+}
+
+// Changed reports whether any files have been added, removed, or modified.
+func (fc FileChanges) Changed() bool {
+	return len(fc.Added) > 0 || len(fc.Removed) > 0 || len(fc.Modified) > 0
+}
+
+// DiffFileDigests compares the regular files in the project tree rooted at
+// osDirname against the per-file digest listing recorded in it, and returns
+// those that differ. ErrNoFileDigests is returned if there is no listing.
+//
+// Files are digested in the same way as for the listing, so line ending
+// normalization by a VCS does not register as a change.
+func DiffFileDigests(osDirname string) (FileChanges, error) {
+	fh, err := os.Open(filepath.Join(osDirname, dirhash.FileDigestsName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return FileChanges{}, ErrNoFileDigests
+		}
+		return FileChanges{}, errors.Wrap(err, "cannot open file digests")
+	}
+	recorded, err := dirhash.ReadFileDigests(fh)
+	fh.Close()
+	if err != nil {
+		return FileChanges{}, errors.Wrapf(err, "cannot read file digests for %s", osDirname)
+	}
+
+	current, err := dirhash.DigestFiles(osDirname)
+	if err != nil {
+		return FileChanges{}, errors.Wrapf(err, "cannot compute file digests for %s", osDirname)
+	}
+
+	var fc FileChanges
+	for path, digest := range current {
+		if want, has := recorded[path]; !has {
+			fc.Added = append(fc.Added, path)
+		} else if !bytes.Equal(digest, want) {
+			fc.Modified = append(fc.Modified, path)
+		}
+	}
+	for path := range recorded {
+		if _, has := current[path]; !has {
+			fc.Removed = append(fc.Removed, path)
+		}
+	}
+	sort.Strings(fc.Added)
+	sort.Strings(fc.Removed)
+	sort.Strings(fc.Modified)
+
+	return fc, nil
+}
+
+// CheckVendorFiles runs DiffFileDigests on the tree of each of the projects,
+// given as slash-separated project roots, under the vendor directory at
+// osDirname. It returns the changes to each project that has changed; projects
+// that are missing, or have no per-file digest listing, are skipped, as
+// CheckDepTree already reports on the former, and there is nothing to compare
+// against for the latter.
+func CheckVendorFiles(osDirname string, projects []string) (map[string]FileChanges, error) {
+	changes := make(map[string]FileChanges)
+	for _, pr := range projects {
+		osProjectDir := filepath.Join(osDirname, filepath.FromSlash(pr))
+		if _, err := os.Stat(osProjectDir); os.IsNotExist(err) {
+			continue
+		}
+
+		fc, err := DiffFileDigests(osProjectDir)
+		if err == ErrNoFileDigests {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if fc.Changed() {
+			changes[pr] = fc
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep/gps/internal/dirhash"
+)
+
+func TestCheckVendorFiles(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	write := func(path, contents string) {
+		path = filepath.Join(vendor, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("github.com/alice/tampered/a.go", "package a\n")
+	write("github.com/alice/tampered/b.go", "package a\n")
+	write("github.com/alice/tampered/sub/c.go", "package sub\n")
+	write("github.com/bob/intact/d.go", "package intact\n")
+	write("github.com/bob/unrecorded/e.go", "package unrecorded\n")
+	for _, pr := range []string{"github.com/alice/tampered", "github.com/bob/intact"} {
+		if err = dirhash.WriteFileDigests(filepath.Join(vendor, filepath.FromSlash(pr))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("github.com/alice/tampered/a.go", "package a\n\nvar injected = true\n")
+	write("github.com/alice/tampered/sub/extra.go", "package sub\n")
+	if err = os.Remove(filepath.Join(vendor, "github.com", "alice", "tampered", "b.go")); err != nil {
+		t.Fatal(err)
+	}
+	// Line ending changes don't count as modifications.
+	write("github.com/bob/intact/d.go", "package intact\r\n")
+
+	if _, err = DiffFileDigests(filepath.Join(vendor, "github.com", "bob", "unrecorded")); err != ErrNoFileDigests {
+		t.Errorf("expected ErrNoFileDigests for a project with no listing, got %v", err)
+	}
+
+	got, err := CheckVendorFiles(vendor, []string{
+		"github.com/alice/tampered",
+		"github.com/bob/intact",
+		"github.com/bob/unrecorded",
+		"github.com/carol/missing",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]FileChanges{
+		"github.com/alice/tampered": {
+			Added:    []string{"sub/extra.go"},
+			Removed:  []string{"b.go"},
+			Modified: []string{"a.go"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected changes:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
@@ -700,7 +700,7 @@ func SortPairedForUpgrade(vl []PairedVersion) {
 //
 // Sorting for downgrade will result in the following slice:
 //
-//  [v1.0.0 v1.1.0 v1.1.0-alpha1 footag devel master f6e74e8d]
+//  [v1.0.0 v1.1.0 v1.1.0-alpha1 master devel footag f6e74e8d]
 func SortForDowngrade(vl []Version) {
 	sort.Sort(downgradeVersionSorter(vl))
 }
@@ -711,6 +711,34 @@ func SortPairedForDowngrade(vl []PairedVersion) {
 	sort.Sort(pvdowngradeVersionSorter(vl))
 }
 
+// CompareForUpgrade compares l and r by the order that SortForUpgrade, and so
+// the solver, visits versions in when upgrading. It returns -1 if l comes
+// first, 1 if r does, and 0 if neither does, as when they are the same
+// version paired with different revisions.
+//
+// It is for ordering versions for display, or in a tool, just as the solver
+// would: sorting with it is the same as sorting with SortForUpgrade.
+func CompareForUpgrade(l, r Version) int {
+	return vcmp(l, r, false)
+}
+
+// CompareForDowngrade compares l and r by the order that SortForDowngrade, and
+// so the solver, visits versions in when downgrading. It returns -1 if l comes
+// first, 1 if r does, and 0 if neither does.
+func CompareForDowngrade(l, r Version) int {
+	return vcmp(l, r, true)
+}
+
+func vcmp(l, r Version, down bool) int {
+	switch {
+	case vLess(l, r, down):
+		return -1
+	case vLess(r, l, down):
+		return 1
+	}
+	return 0
+}
+
 type upgradeVersionSorter []Version
 
 func (vs upgradeVersionSorter) Len() int {
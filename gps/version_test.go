@@ -54,6 +54,36 @@ func TestVersionSorts(t *testing.T) {
 		rev, // revs
 	}
 
+	for i, l := range eup {
+		for j, r := range eup {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := CompareForUpgrade(l, r); got != want {
+				t.Errorf("Expected CompareForUpgrade(%s, %s) to be %d, got %d", l, r, want, got)
+			}
+		}
+	}
+	for i, l := range edown {
+		for j, r := range edown {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := CompareForDowngrade(l, r); got != want {
+				t.Errorf("Expected CompareForDowngrade(%s, %s) to be %d, got %d", l, r, want, got)
+			}
+		}
+	}
+	if got := CompareForUpgrade(NewVersion("1.0.0"), v3); got != 0 {
+		t.Errorf("Expected a version to compare equal to itself paired, got %d", got)
+	}
+
 	SortForUpgrade(up)
 	var wrong []int
 	for k, v := range up {
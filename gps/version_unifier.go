@@ -0,0 +1,109 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+// VersionUnifier pairs versions and revisions with one another using the
+// versions a project's source has upstream, as returned by
+// SourceManager.ListVersions, and matches them against constraints as the
+// solver does.
+//
+// The solver only ever sees paired versions, so whether a Version satisfies a
+// Constraint can depend on what it is paired with: the revision-typed
+// constraint "abc123" is satisfied by the branch "master" only if that is
+// where master is upstream. A tool comparing a Lock against what is upstream
+// should pair the versions it has before matching them, and a VersionUnifier
+// does both.
+//
+// A VersionUnifier is immutable, and safe for concurrent use.
+type VersionUnifier struct {
+	pvl  []PairedVersion
+	vMap map[UnpairedVersion]PairedVersion
+	rMap map[Revision][]PairedVersion
+}
+
+// NewVersionUnifier creates a VersionUnifier from the versions upstream has
+// for a project. The list is copied, and not modified.
+func NewVersionUnifier(upstream []PairedVersion) *VersionUnifier {
+	pvl := make([]PairedVersion, len(upstream))
+	copy(pvl, upstream)
+	SortPairedForUpgrade(pvl)
+
+	vu := &VersionUnifier{
+		pvl:  pvl,
+		vMap: make(map[UnpairedVersion]PairedVersion, len(pvl)),
+		rMap: make(map[Revision][]PairedVersion, len(pvl)),
+	}
+	for _, pv := range pvl {
+		vu.vMap[pv.Unpair()] = pv
+		vu.rMap[pv.Revision()] = append(vu.rMap[pv.Revision()], pv)
+	}
+	return vu
+}
+
+// Versions returns the upstream versions, sorted for upgrade.
+func (vu *VersionUnifier) Versions() []PairedVersion {
+	pvl := make([]PairedVersion, len(vu.pvl))
+	copy(pvl, vu.pvl)
+	return pvl
+}
+
+// PairVersion returns v paired with the revision it is at upstream, or nil if
+// there is no such version upstream.
+func (vu *VersionUnifier) PairVersion(v UnpairedVersion) PairedVersion {
+	return vu.vMap[v]
+}
+
+// PairRevision returns the versions upstream that are at r, sorted for
+// upgrade, or nil if there are none.
+func (vu *VersionUnifier) PairRevision(r Revision) []PairedVersion {
+	pvl := vu.rMap[r]
+	if len(pvl) == 0 {
+		return nil
+	}
+	return append([]PairedVersion(nil), pvl...)
+}
+
+// Pair returns v as the solver would see it. An UnpairedVersion is paired with
+// the revision it is at upstream, if it exists there. A PairedVersion is
+// returned as is, even if upstream has since moved on, as is a Revision: a
+// revision may be tagged many times over, and none of those versions is what
+// was asked for.
+func (vu *VersionUnifier) Pair(v Version) Version {
+	if uv, ok := v.(UnpairedVersion); ok {
+		if pv := vu.PairVersion(uv); pv != nil {
+			return pv
+		}
+	}
+	return v
+}
+
+// Matches reports whether v satisfies c, once paired.
+func (vu *VersionUnifier) Matches(c Constraint, v Version) bool {
+	return c.Matches(vu.Pair(v))
+}
+
+// Latest returns the upstream version that satisfies c and that an upgrade
+// would prefer over all others that do, or nil if none satisfies c.
+func (vu *VersionUnifier) Latest(c Constraint) PairedVersion {
+	for _, pv := range vu.pvl {
+		if c.Matches(pv) {
+			return pv
+		}
+	}
+	return nil
+}
+
+// Moved reports whether the version of a locked project is no longer at the
+// revision it was locked to upstream, as when a branch gains commits or a tag
+// is moved. Versions that are not paired, or are missing upstream, have not
+// moved.
+func (vu *VersionUnifier) Moved(v Version) bool {
+	pv, ok := v.(PairedVersion)
+	if !ok {
+		return false
+	}
+	upv := vu.PairVersion(pv.Unpair())
+	return upv != nil && upv.Revision() != pv.Revision()
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVersionUnifier(t *testing.T) {
+	upstream := []PairedVersion{
+		NewBranch("master").Pair("rev2"),
+		NewVersion("v1.0.0").Pair("rev1"),
+		NewVersion("v1.1.0").Pair("rev2"),
+		NewVersion("v2.0.0").Pair("rev3"),
+	}
+	vu := NewVersionUnifier(upstream)
+
+	if pv := vu.PairVersion(NewBranch("master")); pv == nil || pv.Revision() != "rev2" {
+		t.Errorf("expected master to be paired with rev2, got %v", pv)
+	}
+	if pv := vu.PairVersion(NewBranch("dev")); pv != nil {
+		t.Errorf("expected no pairing for a missing branch, got %v", pv)
+	}
+	want := []PairedVersion{NewVersion("v1.1.0").Pair("rev2"), NewBranch("master").Pair("rev2")}
+	if got := vu.PairRevision("rev2"); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected versions at rev2:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+	if got := vu.PairRevision("rev4"); got != nil {
+		t.Errorf("expected no versions at rev4, got %v", got)
+	}
+
+	// Pairing is what lets a version satisfy a constraint of another type.
+	if Revision("rev2").Matches(NewBranch("master")) {
+		t.Error("expected an unpaired branch not to match a revision")
+	}
+	if !vu.Matches(Revision("rev2"), NewBranch("master")) {
+		t.Error("expected master to match the revision it is at")
+	}
+	if vu.Matches(Revision("rev1"), NewBranch("master")) {
+		t.Error("expected master not to match a revision it is not at")
+	}
+	if vu.Matches(Revision("rev2"), NewBranch("master").Pair("rev1")) {
+		t.Error("expected a paired version to keep its own revision")
+	}
+
+	c, _ := NewSemverConstraintIC("v1.0.0")
+	if got := vu.Latest(c); got == nil || got.String() != "v1.1.0" {
+		t.Errorf("expected v1.1.0 to be the latest matching ^1.0.0, got %v", got)
+	}
+	if got := vu.Latest(none); got != nil {
+		t.Errorf("expected nothing to match none, got %v", got)
+	}
+
+	if !vu.Moved(NewBranch("master").Pair("rev1")) {
+		t.Error("expected master to have moved from rev1")
+	}
+	if vu.Moved(NewBranch("master").Pair("rev2")) || vu.Moved(Revision("rev1")) || vu.Moved(NewBranch("dev").Pair("rev1")) {
+		t.Error("expected only a version at another revision upstream to have moved")
+	}
+
+	// The upstream list is the caller's own.
+	if upstream[0].String() != "master" {
+		t.Error("expected the upstream list not to be sorted in place")
+	}
+}
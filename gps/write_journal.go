@@ -0,0 +1,186 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// writeJournalFilename is the name of the file, within the basedir passed to
+// WriteDepTree, that records which projects have been completely written. It
+// is removed once the whole tree has been written.
+const writeJournalFilename = ".dep-write-journal"
+
+// journalEntry records a single project that was completely written into a
+// dep tree, in enough detail to tell whether it can be reused by a later run.
+type journalEntry struct {
+	Root     ProjectRoot  `json:"root"`
+	Source   string       `json:"source,omitempty"`
+	Version  string       `json:"version"`
+	Revision Revision     `json:"revision,omitempty"`
+	Prune    PruneOptions `json:"prune"`
+	Packages []string     `json:"packages,omitempty"`
+}
+
+func newJournalEntry(lp LockedProject, prune PruneOptions) journalEntry {
+	je := journalEntry{
+		Root:    lp.Ident().ProjectRoot,
+		Source:  lp.Ident().Source,
+		Version: lp.Version().String(),
+		Prune:   prune,
+	}
+	if pkgs := lp.Packages(); len(pkgs) > 0 {
+		je.Packages = make([]string, len(pkgs))
+		copy(je.Packages, pkgs)
+		sort.Strings(je.Packages)
+	}
+	switch tv := lp.Version().(type) {
+	case Revision:
+		je.Revision = tv
+	case PairedVersion:
+		je.Revision = tv.Revision()
+	}
+	return je
+}
+
+func (je journalEntry) eq(other journalEntry) bool {
+	if je.Root != other.Root || je.Source != other.Source || je.Version != other.Version ||
+		je.Revision != other.Revision || je.Prune != other.Prune || len(je.Packages) != len(other.Packages) {
+		return false
+	}
+	for i, pkg := range je.Packages {
+		if pkg != other.Packages[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeJournal is an append-only record of the projects written into a dep
+// tree. A run of WriteDepTree that is interrupted leaves the journal behind,
+// allowing the next run into the same basedir to skip the projects it lists.
+type writeJournal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	done map[ProjectRoot]journalEntry
+}
+
+// openWriteJournal opens the journal within basedir, creating it if it does
+// not exist, and reads the entries left in it by an earlier run. Malformed
+// entries, as may be left by a run interrupted mid-write, are ignored.
+func openWriteJournal(basedir string) (*writeJournal, error) {
+	path := filepath.Join(basedir, writeJournalFilename)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, wrapError(err, "failed to open write journal")
+	}
+
+	j := &writeJournal{
+		path: path,
+		f:    f,
+		done: make(map[ProjectRoot]journalEntry),
+	}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var je journalEntry
+		if json.Unmarshal(s.Bytes(), &je) == nil {
+			j.done[je.Root] = je
+		}
+	}
+	if err = s.Err(); err != nil {
+		f.Close()
+		return nil, wrapError(err, "failed to read write journal")
+	}
+	return j, nil
+}
+
+// completed reports whether the journal records that lp, with the same
+// packages, was completely written to dir with the given prune options, and
+// dir still exists.
+func (j *writeJournal) completed(lp LockedProject, prune PruneOptions, dir string) bool {
+	je, has := j.done[lp.Ident().ProjectRoot]
+	if !has || !je.eq(newJournalEntry(lp, prune)) {
+		return false
+	}
+	fi, err := os.Stat(dir)
+	return err == nil && fi.IsDir()
+}
+
+// clean removes everything within basedir that an earlier run may have left
+// behind, other than the journal and the projects of lps that done marks as
+// completely written: projects that were partially written, and those that are
+// no longer in the lock.
+func (j *writeJournal) clean(basedir string, lps []LockedProject, done []bool) error {
+	keep := make(map[string]bool)
+	ancestors := make(map[string]bool)
+	for i, p := range lps {
+		if !done[i] {
+			continue
+		}
+		dir := filepath.FromSlash(string(p.Ident().ProjectRoot))
+		keep[dir] = true
+		for d := filepath.Dir(dir); d != "."; d = filepath.Dir(d) {
+			ancestors[d] = true
+		}
+	}
+
+	return filepath.Walk(basedir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(basedir, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case rel == "." || rel == writeJournalFilename:
+			return nil
+		case keep[rel]:
+			return filepath.SkipDir
+		case ancestors[rel] && fi.IsDir():
+			return nil
+		}
+		if err = os.RemoveAll(path); err != nil {
+			return wrapErrorf(err, "failed to clean %s", path)
+		}
+		if fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// record durably appends an entry to the journal for lp, which has been
+// completely written.
+func (j *writeJournal) record(lp LockedProject, prune PruneOptions) error {
+	b, err := json.Marshal(newJournalEntry(lp, prune))
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err = j.f.Write(append(b, '\n')); err != nil {
+		return wrapError(err, "failed to record project in write journal")
+	}
+	return wrapError(j.f.Sync(), "failed to sync write journal")
+}
+
+// close closes the journal, leaving it in place for a later run.
+func (j *writeJournal) close() error {
+	return j.f.Close()
+}
+
+// remove closes and removes the journal, as the dep tree is complete.
+func (j *writeJournal) remove() error {
+	j.f.Close()
+	return os.Remove(j.path)
+}
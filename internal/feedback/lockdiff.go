@@ -6,8 +6,6 @@ package feedback
 
 import (
 	"fmt"
-	"sort"
-	"strings"
 
 	"github.com/golang/dep/gps"
 )
@@ -61,65 +59,19 @@ type LockedProjectDiff struct {
 	Packages []StringDiff
 }
 
-// DiffLocks compares two locks and identifies the differences between them.
-// Returns nil if there are no differences.
+// DiffLocks compares two locks and identifies the differences between them,
+// as found by gps.DiffLocks. Returns nil if there are no differences.
 func DiffLocks(l1, l2 gps.Lock) *LockDiff {
-	// Default nil locks to empty locks, so that we can still generate a diff
-	if l1 == nil {
-		l1 = gps.SimpleLock{}
-	}
-	if l2 == nil {
-		l2 = gps.SimpleLock{}
-	}
-
-	p1, p2 := l1.Projects(), l2.Projects()
-
-	p1 = sortLockedProjects(p1)
-	p2 = sortLockedProjects(p2)
-
-	diff := LockDiff{}
-
-	var i2next int
-	for i1 := 0; i1 < len(p1); i1++ {
-		lp1 := p1[i1]
-		pr1 := lp1.Ident().ProjectRoot
-
-		var matched bool
-		for i2 := i2next; i2 < len(p2); i2++ {
-			lp2 := p2[i2]
-			pr2 := lp2.Ident().ProjectRoot
-
-			switch strings.Compare(string(pr1), string(pr2)) {
-			case 0: // Found a matching project
-				matched = true
-				pdiff := DiffProjects(lp1, lp2)
-				if pdiff != nil {
-					diff.Modify = append(diff.Modify, *pdiff)
-				}
-				i2next = i2 + 1 // Don't evaluate to this again
-			case +1: // Found a new project
-				add := buildLockedProjectDiff(lp2)
-				diff.Add = append(diff.Add, add)
-				i2next = i2 + 1 // Don't evaluate to this again
-				continue        // Keep looking for a matching project
-			case -1: // Project has been removed, handled below
-				continue
-			}
-
-			break // Done evaluating this project, move onto the next
+	var diff LockDiff
+	for _, pd := range gps.DiffLocks(l1, l2).Projects {
+		switch {
+		case pd.Has(gps.ProjectAdded):
+			diff.Add = append(diff.Add, buildLockedProjectDiff(pd))
+		case pd.Has(gps.ProjectRemoved):
+			diff.Remove = append(diff.Remove, buildLockedProjectDiff(pd))
+		default:
+			diff.Modify = append(diff.Modify, buildLockedProjectDiff(pd))
 		}
-
-		if !matched {
-			remove := buildLockedProjectDiff(lp1)
-			diff.Remove = append(diff.Remove, remove)
-		}
-	}
-
-	// Anything that still hasn't been evaluated are adds
-	for i2 := i2next; i2 < len(p2); i2++ {
-		lp2 := p2[i2]
-		add := buildLockedProjectDiff(lp2)
-		diff.Add = append(diff.Add, add)
 	}
 
 	if len(diff.Add) == 0 && len(diff.Remove) == 0 && len(diff.Modify) == 0 {
@@ -128,129 +80,62 @@ func DiffLocks(l1, l2 gps.Lock) *LockDiff {
 	return &diff
 }
 
-func buildLockedProjectDiff(lp gps.LockedProject) LockedProjectDiff {
-	s2 := lp.Ident().Source
-	r2, b2, v2 := gps.VersionComponentStrings(lp.Version())
-
-	var rev, version, branch, source *StringDiff
-	if s2 != "" {
-		source = &StringDiff{Previous: s2, Current: s2}
-	}
-	if r2 != "" {
-		rev = &StringDiff{Previous: r2, Current: r2}
-	}
-	if b2 != "" {
-		branch = &StringDiff{Previous: b2, Current: b2}
-	}
-	if v2 != "" {
-		version = &StringDiff{Previous: v2, Current: v2}
-	}
-
-	add := LockedProjectDiff{
-		Name:     lp.Ident().ProjectRoot,
-		Source:   source,
-		Revision: rev,
-		Version:  version,
-		Branch:   branch,
-		Packages: make([]StringDiff, len(lp.Packages())),
-	}
-	for i, pkg := range lp.Packages() {
-		add.Packages[i] = StringDiff{Previous: pkg, Current: pkg}
-	}
-	return add
-}
-
 // DiffProjects compares two projects and identifies the differences between them.
 // Returns nil if there are no differences.
 func DiffProjects(lp1, lp2 gps.LockedProject) *LockedProjectDiff {
-	diff := LockedProjectDiff{Name: lp1.Ident().ProjectRoot}
-
-	s1 := lp1.Ident().Source
-	s2 := lp2.Ident().Source
-	if s1 != s2 {
-		diff.Source = &StringDiff{Previous: s1, Current: s2}
+	pd := gps.DiffLockedProjects(lp1, lp2)
+	if pd.Changes == 0 {
+		return nil // The projects are equivalent
 	}
+	diff := buildLockedProjectDiff(pd)
+	return &diff
+}
 
-	r1, b1, v1 := gps.VersionComponentStrings(lp1.Version())
-	r2, b2, v2 := gps.VersionComponentStrings(lp2.Version())
-	if r1 != r2 {
-		diff.Revision = &StringDiff{Previous: r1, Current: r2}
-	}
-	if b1 != b2 {
-		diff.Branch = &StringDiff{Previous: b1, Current: b2}
-	}
-	if v1 != v2 {
-		diff.Version = &StringDiff{Previous: v1, Current: v2}
+// buildLockedProjectDiff renders pd. A project that was added or removed is
+// shown as it is, with every field populated, rather than as a difference.
+func buildLockedProjectDiff(pd gps.ProjectDiff) LockedProjectDiff {
+	whole := pd.Has(gps.ProjectAdded | gps.ProjectRemoved)
+	lp1, lp2 := pd.Old, pd.New
+	if lp1 == nil {
+		lp1 = lp2
+	} else if lp2 == nil {
+		lp2 = lp1
 	}
 
-	p1 := lp1.Packages()
-	p2 := lp2.Packages()
-	if !sort.StringsAreSorted(p1) {
-		p1 = make([]string, len(p1))
-		copy(p1, lp1.Packages())
-		sort.Strings(p1)
-	}
-	if !sort.StringsAreSorted(p2) {
-		p2 = make([]string, len(p2))
-		copy(p2, lp2.Packages())
-		sort.Strings(p2)
+	field := func(s1, s2 string) *StringDiff {
+		if s1 != s2 || (whole && s1 != "") {
+			return &StringDiff{Previous: s1, Current: s2}
+		}
+		return nil
 	}
-
-	var i2next int
-	for i1 := 0; i1 < len(p1); i1++ {
-		pkg1 := p1[i1]
-
-		var matched bool
-		for i2 := i2next; i2 < len(p2); i2++ {
-			pkg2 := p2[i2]
-
-			switch strings.Compare(pkg1, pkg2) {
-			case 0: // Found matching package
-				matched = true
-				i2next = i2 + 1 // Don't evaluate to this again
-			case +1: // Found a new package
-				add := StringDiff{Current: pkg2}
-				diff.Packages = append(diff.Packages, add)
-				i2next = i2 + 1 // Don't evaluate to this again
-				continue        // Keep looking for a match
-			case -1: // Package has been removed (handled below)
-				continue
-			}
-
-			break // Done evaluating this package, move onto the next
+	r1, b1, v1 := gps.VersionComponentStrings(lp1.Version())
+	r2, b2, v2 := gps.VersionComponentStrings(lp2.Version())
+	diff := LockedProjectDiff{
+		Name:     pd.Root,
+		Source:   field(lp1.Ident().Source, lp2.Ident().Source),
+		Revision: field(r1, r2),
+		Branch:   field(b1, b2),
+		Version:  field(v1, v2),
+	}
+
+	if whole {
+		diff.Packages = make([]StringDiff, len(lp1.Packages()))
+		for i, pkg := range lp1.Packages() {
+			diff.Packages[i] = StringDiff{Previous: pkg, Current: pkg}
 		}
-
-		if !matched {
-			diff.Packages = append(diff.Packages, StringDiff{Previous: pkg1})
+		return diff
+	}
+
+	// Interleave the added and removed packages, in order.
+	added, removed := pd.PackagesAdded, pd.PackagesRemoved
+	for len(added) > 0 || len(removed) > 0 {
+		if len(removed) == 0 || (len(added) > 0 && added[0] < removed[0]) {
+			diff.Packages = append(diff.Packages, StringDiff{Current: added[0]})
+			added = added[1:]
+		} else {
+			diff.Packages = append(diff.Packages, StringDiff{Previous: removed[0]})
+			removed = removed[1:]
 		}
 	}
-
-	// Anything that still hasn't been evaluated are adds
-	for i2 := i2next; i2 < len(p2); i2++ {
-		pkg2 := p2[i2]
-		add := StringDiff{Current: pkg2}
-		diff.Packages = append(diff.Packages, add)
-	}
-
-	if diff.Source == nil && diff.Version == nil && diff.Revision == nil && len(diff.Packages) == 0 {
-		return nil // The projects are equivalent
-	}
-	return &diff
-}
-
-// sortLockedProjects returns a sorted copy of lps, or itself if already sorted.
-func sortLockedProjects(lps []gps.LockedProject) []gps.LockedProject {
-	if len(lps) <= 1 || sort.SliceIsSorted(lps, func(i, j int) bool {
-		return lps[i].Ident().Less(lps[j].Ident())
-	}) {
-		return lps
-	}
-
-	cp := make([]gps.LockedProject, len(lps))
-	copy(cp, lps)
-
-	sort.Slice(cp, func(i, j int) bool {
-		return cp[i].Ident().Less(cp[j].Ident())
-	})
-	return cp
+	return diff
 }
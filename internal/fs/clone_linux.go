@@ -0,0 +1,31 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build 386 amd64 arm arm64 riscv64 s390x
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request, _IOW(0x94, 9, int), which is not
+// defined by the syscall package, nor by the vendored x/sys/unix. Its value
+// depends on how the architecture encodes ioctl requests, so this file is only
+// built for those that use the generic encoding; cloning is not supported on
+// others, such as mips and ppc64.
+const ficlone = 0x40049409
+
+// cloneFile makes dst share the contents of src, copy-on-write, using the
+// FICLONE ioctl. This is supported by btrfs and xfs, among others; on other
+// filesystems, or across filesystems, it returns an error and dst is left
+// unchanged.
+func cloneFile(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux linux,!386,!amd64,!arm,!arm64,!riscv64,!s390x
+
+package fs
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile is not supported on this platform, so always returns an error.
+func cloneFile(dst, src *os.File) error {
+	return errors.New("cloning files is not supported on this platform")
+}
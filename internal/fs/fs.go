@@ -157,6 +157,8 @@ func EquivalentPaths(p1, p2 string) (bool, error) {
 // copying in the event of a cross-device link error. If the fallback copy
 // succeeds, src is still removed, emulating normal rename behavior.
 func RenameWithFallback(src, dst string) error {
+	src, dst = LongPath(src), LongPath(dst)
+
 	_, err := os.Stat(src)
 	if err != nil {
 		return errors.Wrapf(err, "cannot stat %s", src)
@@ -351,11 +353,30 @@ var (
 	errDstExist  = errors.New("destination already exists")
 )
 
+// CopyOptions control how files are copied by CopyDirWithOptions.
+type CopyOptions struct {
+	// Hardlink permits files to be hard linked to their source, rather than
+	// cloned or copied. Linked files share their contents
+	// and permissions with the source, so this is only safe if neither is
+	// going to be modified in place.
+	Hardlink bool
+}
+
 // CopyDir recursively copies a directory tree, attempting to preserve permissions.
 // Source directory must exist, destination directory must *not* exist.
+//
+// Where the filesystem supports it, files are cloned (reflinked) rather than
+// having their contents copied, which is much faster and uses no extra space
+// until either copy is modified.
 func CopyDir(src, dst string) error {
-	src = filepath.Clean(src)
-	dst = filepath.Clean(dst)
+	return CopyDirWithOptions(src, dst, CopyOptions{})
+}
+
+// CopyDirWithOptions recursively copies a directory tree as CopyDir does, with
+// the given options.
+func CopyDirWithOptions(src, dst string, opts CopyOptions) error {
+	src = LongPath(filepath.Clean(src))
+	dst = LongPath(filepath.Clean(dst))
 
 	// We use os.Lstat() here to ensure we don't fall in a loop where a symlink
 	// actually links to a one of its parent directories.
@@ -389,13 +410,13 @@ func CopyDir(src, dst string) error {
 		dstPath := filepath.Join(dst, entry.Name())
 
 		if entry.IsDir() {
-			if err = CopyDir(srcPath, dstPath); err != nil {
+			if err = CopyDirWithOptions(srcPath, dstPath, opts); err != nil {
 				return errors.Wrap(err, "copying directory failed")
 			}
 		} else {
 			// This will include symlinks, which is what we want when
 			// copying things.
-			if err = copyFile(srcPath, dstPath); err != nil {
+			if err = copyFileWithOptions(srcPath, dstPath, opts); err != nil {
 				return errors.Wrap(err, "copying file failed")
 			}
 		}
@@ -408,7 +429,16 @@ func CopyDir(src, dst string) error {
 // by dst. The file will be created if it does not already exist. If the
 // destination file exists, all its contents will be replaced by the contents
 // of the source file. The file mode will be copied from the source.
-func copyFile(src, dst string) (err error) {
+func copyFile(src, dst string) error {
+	return copyFileWithOptions(src, dst, CopyOptions{})
+}
+
+// copyFileWithOptions copies the file named src to the file named by dst as
+// copyFile does, cloning it where possible. With opts.Hardlink, the file is
+// linked instead, if it can be.
+func copyFileWithOptions(src, dst string, opts CopyOptions) (err error) {
+	src, dst = LongPath(src), LongPath(dst)
+
 	if sym, err := IsSymlink(src); err != nil {
 		return errors.Wrap(err, "symlink check failed")
 	} else if sym {
@@ -431,6 +461,14 @@ func copyFile(src, dst string) (err error) {
 		}
 	}
 
+	if opts.Hardlink {
+		// Linking is cheaper still than cloning. It fails if dst exists, in
+		// which case its contents are replaced as usual.
+		if os.Link(src, dst) == nil {
+			return nil
+		}
+	}
+
 	in, err := os.Open(src)
 	if err != nil {
 		return
@@ -442,9 +480,12 @@ func copyFile(src, dst string) (err error) {
 		return
 	}
 
-	if _, err = io.Copy(out, in); err != nil {
-		out.Close()
-		return
+	// Clone the file if the filesystem allows it; otherwise, copy it.
+	if cloneFile(out, in) != nil {
+		if _, err = io.Copy(out, in); err != nil {
+			out.Close()
+			return
+		}
 	}
 
 	// Check for write errors on Close
@@ -457,13 +498,11 @@ func copyFile(src, dst string) (err error) {
 		return
 	}
 
-	// Temporary fix for Go < 1.9
+	// dst is already in extended-length form if needed, which also works
+	// around os.Chmod not doing so itself in Go < 1.9.
 	//
 	// See: https://github.com/golang/dep/issues/774
 	// and https://github.com/golang/go/issues/20829
-	if runtime.GOOS == "windows" {
-		dst = fixLongPath(dst)
-	}
 	err = os.Chmod(dst, si.Mode())
 
 	return
@@ -563,6 +602,23 @@ func IsSymlink(path string) (bool, error) {
 	return l.Mode()&os.ModeSymlink == os.ModeSymlink, nil
 }
 
+// LongPath returns the form of path to use when operating on it, so that
+// operations on deeply nested files do not fail. On Windows, this is the
+// extended-length (\\?\-prefixed) form of path if it is too long to be used
+// as is; relative paths are made absolute in order to be converted. On other
+// platforms, path is returned unmodified.
+func LongPath(path string) string {
+	if runtime.GOOS != "windows" || len(path) < 248 {
+		return path
+	}
+	if !isAbs(path) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	return fixLongPath(path)
+}
+
 // fixLongPath returns the extended-length (\\?\-prefixed) form of
 // path when needed, in order to avoid the default 260 character file
 // path limit imposed by Windows. If path is not easily converted to
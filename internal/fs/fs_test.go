@@ -473,6 +473,61 @@ func TestCopyDir(t *testing.T) {
 	}
 }
 
+func TestCopyDirWithOptionsHardlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	if err = os.MkdirAll(filepath.Join(srcdir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"myfile", filepath.Join("subdir", "file")}
+	for _, f := range files {
+		if err = ioutil.WriteFile(filepath.Join(srcdir, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	destdir := filepath.Join(dir, "dest")
+	if err = CopyDirWithOptions(srcdir, destdir, CopyOptions{Hardlink: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		sfi, err := os.Stat(filepath.Join(srcdir, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dfi, err := os.Stat(filepath.Join(destdir, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(sfi, dfi) {
+			t.Errorf("expected %s to be hard linked to its source", f)
+		}
+	}
+
+	// Without the option, files must never be linked.
+	copydir := filepath.Join(dir, "copy")
+	if err = CopyDir(srcdir, copydir); err != nil {
+		t.Fatal(err)
+	}
+	sfi, err := os.Stat(filepath.Join(srcdir, "myfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfi, err := os.Stat(filepath.Join(copydir, "myfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(sfi, cfi) {
+		t.Error("expected copied file not to be linked to its source")
+	}
+}
+
 func TestCopyDirFail_SrcInaccessible(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		// XXX: setting permissions works differently in
@@ -755,6 +810,60 @@ func TestCopyFileLongFilePath(t *testing.T) {
 	}
 }
 
+func TestCopyDirLongPath(t *testing.T) {
+	h := test.NewHelper(t)
+	h.TempDir(".")
+	defer h.Cleanup()
+
+	// Nest the file deeply enough to exceed MAX_PATH on Windows.
+	src := filepath.Join(h.Path("."), "src")
+	nested := src
+	for len(nested) <= 300 {
+		nested = filepath.Join(nested, "directory")
+	}
+	if err := os.MkdirAll(LongPath(nested), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(LongPath(filepath.Join(nested, "file")), []byte("contents"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(h.Path("."), "dst")
+	if err := CopyDir(src, dst); err != nil {
+		t.Fatalf("unexpected error while copying directory: %v", err)
+	}
+
+	copied := filepath.Join(dst, strings.TrimPrefix(nested, src), "file")
+	got, err := ioutil.ReadFile(LongPath(copied))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "contents" {
+		t.Fatalf("expected: contents, got: %s", got)
+	}
+}
+
+func TestLongPath(t *testing.T) {
+	long := string(os.PathSeparator) + strings.Repeat("directory"+string(os.PathSeparator), 30)
+	if runtime.GOOS == "windows" {
+		long = `C:` + long
+	}
+
+	got := LongPath(long)
+	if runtime.GOOS != "windows" {
+		if got != long {
+			t.Fatalf("expected path to be unmodified, got %s", got)
+		}
+		return
+	}
+	if !strings.HasPrefix(got, `\\?\C:\directory\`) {
+		t.Fatalf("expected extended-length path, got %s", got)
+	}
+	if short := `C:\directory`; LongPath(short) != short {
+		t.Fatalf("expected short path to be unmodified, got %s", LongPath(short))
+	}
+}
+
 // C:\Users\appveyor\AppData\Local\Temp\1\gotest639065787\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890\dir4567890
 
 func TestCopyFileFail(t *testing.T) {
@@ -0,0 +1,71 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NormalizedModTime is the modification time given to everything in a tree by
+// NormalizeTree. It is the earliest time representable in a zip archive, so as
+// not to trouble tools that cannot handle earlier ones.
+var NormalizedModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// NormalizeTree sets the permissions and modification times of everything in
+// the tree rooted at root to fixed values, so that trees with the same contents
+// are identical regardless of the umask, filesystem or time they were written
+// with.
+//
+// Directories are given mode 0755; files are given mode 0755 if they were
+// executable by their owner, and 0644 otherwise. All are given a modification
+// time of NormalizedModTime. Symlinks are left as they are, as their own
+// permissions and times cannot portably be set.
+func NormalizeTree(root string) error {
+	root = LongPath(root)
+
+	var dirs []string
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		var mode os.FileMode = 0644
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			return nil
+		case fi.IsDir():
+			// Directories' times change as their contents are modified, so
+			// are set once all their contents have been.
+			dirs = append(dirs, path)
+			mode = 0755
+		case fi.Mode()&0100 != 0:
+			mode = 0755
+		}
+
+		if fi.Mode().Perm() != mode {
+			if err = os.Chmod(path, mode); err != nil {
+				return err
+			}
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		return os.Chtimes(path, NormalizedModTime, NormalizedModTime)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to normalize %s", root)
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err = os.Chtimes(dirs[i], NormalizedModTime, NormalizedModTime); err != nil {
+			return errors.Wrapf(err, "failed to normalize %s", root)
+		}
+	}
+	return nil
+}
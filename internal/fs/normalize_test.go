@@ -0,0 +1,66 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestNormalizeTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	if err = os.MkdirAll(filepath.Join(root, "subdir"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]os.FileMode{
+		"file":                          0600,
+		"script":                        0750,
+		filepath.Join("subdir", "file"): 0664,
+	}
+	for name, mode := range files {
+		fn := filepath.Join(root, name)
+		if err = ioutil.WriteFile(fn, []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+		// Not subject to the umask, unlike the mode passed to WriteFile.
+		if err = os.Chmod(fn, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = NormalizeTree(root); err != nil {
+		t.Fatalf("unexpected error normalizing tree: %s", err)
+	}
+
+	want := map[string]os.FileMode{
+		".":                             0755,
+		"subdir":                        0755,
+		"file":                          0644,
+		"script":                        0755,
+		filepath.Join("subdir", "file"): 0644,
+	}
+	for name, mode := range want {
+		fi, err := os.Stat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Windows only has a read-only bit.
+		if runtime.GOOS != "windows" && fi.Mode().Perm() != mode {
+			t.Errorf("expected %s to have mode %v, got %v", name, mode, fi.Mode().Perm())
+		}
+		if !fi.ModTime().Equal(NormalizedModTime) {
+			t.Errorf("expected %s to have modification time %s, got %s", name, NormalizedModTime, fi.ModTime())
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package base
 
 import (
+	"context"
 	"log"
 	"strings"
 
@@ -37,7 +38,7 @@ func NewImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *Import
 
 // isTag determines if the specified value is a tag (plain or semver).
 func (i *Importer) isTag(pi gps.ProjectIdentifier, value string) (bool, gps.Version, error) {
-	versions, err := i.SourceManager.ListVersions(pi)
+	versions, err := i.SourceManager.ListVersions(context.TODO(), pi)
 	if err != nil {
 		return false, nil, errors.Wrapf(err, "unable to list versions for %s(%s)", pi.ProjectRoot, pi.Source)
 	}
@@ -61,7 +62,7 @@ func (i *Importer) isTag(pi gps.ProjectIdentifier, value string) (bool, gps.Vers
 // manifest, then finally the revision.
 func (i *Importer) lookupVersionForLockedProject(pi gps.ProjectIdentifier, c gps.Constraint, rev gps.Revision) (gps.Version, error) {
 	// Find the version that goes with this revision, if any
-	versions, err := i.SourceManager.ListVersions(pi)
+	versions, err := i.SourceManager.ListVersions(context.TODO(), pi)
 	if err != nil {
 		return rev, errors.Wrapf(err, "Unable to lookup the version represented by %s in %s(%s). Falling back to locking the revision only.", rev, pi.ProjectRoot, pi.Source)
 	}
@@ -130,7 +131,7 @@ func (i *Importer) loadPackages(packages []ImportedPackage) []importedProject {
 
 	projects := make(map[gps.ProjectRoot]*importedProject, len(packages))
 	for _, pkg := range packages {
-		pr, err := i.SourceManager.DeduceProjectRoot(pkg.Name)
+		pr, err := i.SourceManager.DeduceProjectRoot(context.TODO(), pkg.Name)
 		if err != nil {
 			i.Logger.Printf(
 				"  Warning: Skipping project. Cannot determine the project root for %s: %s\n",
@@ -203,7 +204,7 @@ func (i *Importer) ImportPackages(packages []ImportedPackage, defaultConstraintF
 		}
 
 		var err error
-		pc.Constraint, err = i.SourceManager.InferConstraint(prj.ConstraintHint, pc.Ident)
+		pc.Constraint, err = i.SourceManager.InferConstraint(context.TODO(), prj.ConstraintHint, pc.Ident)
 		if err != nil {
 			pc.Constraint = gps.Any()
 		}
@@ -320,7 +321,7 @@ func (i *Importer) isDefaultSource(projectRoot gps.ProjectRoot, sourceURL string
 		return true, nil
 	}
 
-	sourceURLs, err := i.SourceManager.SourceURLsForPath(string(projectRoot))
+	sourceURLs, err := i.SourceManager.SourceURLsForPath(context.TODO(), string(projectRoot))
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,251 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomod
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/internal/importers/base"
+	"github.com/pkg/errors"
+)
+
+const gomodfile = "go.mod"
+
+// pseudoVersion matches the versions the go command gives to untagged
+// revisions.
+var pseudoVersion = regexp.MustCompile(`-(?:[0-9A-Za-z.]*\.)?[0-9]{14}-[0-9a-f]{12}(\+incompatible)?$`)
+
+// Importer imports go.mod configuration into the dep configuration format.
+type Importer struct {
+	*base.Importer
+
+	requires []gomodRequirement
+}
+
+// NewImporter for go.mod.
+func NewImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *Importer {
+	return &Importer{Importer: base.NewImporter(logger, verbose, sm)}
+}
+
+// Name of the importer.
+func (g *Importer) Name() string {
+	return "gomod"
+}
+
+// HasDepMetadata checks if a directory contains config that the importer can handle.
+func (g *Importer) HasDepMetadata(dir string) bool {
+	path := filepath.Join(dir, gomodfile)
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+
+	return true
+}
+
+// Import the config found in the directory.
+func (g *Importer) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, l := g.convert(pr)
+	return m, l, nil
+}
+
+// gomodRequirement is a requirement of a go.mod file, after any replacement of
+// the module with another has been applied.
+type gomodRequirement struct {
+	modulePath string
+	version    string
+	source     string
+}
+
+func (g *Importer) load(projectDir string) error {
+	g.Logger.Println("Detected go.mod configuration files...")
+	path := filepath.Join(projectDir, gomodfile)
+	if g.Verbose {
+		g.Logger.Printf("  Loading %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open %s", path)
+	}
+	defer f.Close()
+
+	var block string
+	replacements := make(map[string]gomodRequirement)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var directive string
+		directive, block, err = parseGomodLine(scanner.Text(), block)
+		if err != nil {
+			g.Logger.Printf("  Warning: Skipping line. Unable to parse: %s\n", err)
+			continue
+		}
+
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "require":
+			req, err := parseRequire(fields[1:])
+			if err != nil {
+				g.Logger.Printf("  Warning: Skipping line. Unable to parse: %s\n", err)
+				continue
+			}
+			g.requires = append(g.requires, req)
+		case "replace":
+			from, to, err := parseReplace(fields[1:])
+			if err != nil {
+				g.Logger.Printf("  Warning: Skipping line. Unable to parse: %s\n", err)
+				continue
+			}
+			if to.version == "" {
+				g.Logger.Printf("  Warning: Ignoring the replacement of %s by the local directory %s\n", from, to.modulePath)
+				continue
+			}
+			replacements[from] = to
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		g.Logger.Printf("  Warning: Ignoring errors found while parsing %s: %s\n", path, err)
+	}
+
+	for i, req := range g.requires {
+		if to, ok := replacements[req.modulePath]; ok {
+			if to.modulePath != req.modulePath {
+				req.source = to.modulePath
+			}
+			req.version = to.version
+			g.requires[i] = req
+		}
+	}
+
+	return nil
+}
+
+// parseGomodLine returns the directive on line, with the keyword of block, the
+// directive block it is within, if any, prepended. It also returns the block
+// that the next line is within.
+func parseGomodLine(line, block string) (directive, next string, err error) {
+	if i := strings.Index(line, "//"); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+
+	switch {
+	case line == "":
+		return "", block, nil
+	case block != "":
+		if line == ")" {
+			return "", "", nil
+		}
+		return block + " " + line, block, nil
+	case strings.HasSuffix(line, "("):
+		fields := strings.Fields(strings.TrimSuffix(line, "("))
+		if len(fields) != 1 {
+			return "", "", fmt.Errorf("invalid go.mod block: %s", line)
+		}
+		return "", fields[0], nil
+	}
+	return line, "", nil
+}
+
+func parseRequire(args []string) (gomodRequirement, error) {
+	if len(args) != 2 {
+		return gomodRequirement{}, fmt.Errorf("invalid go.mod requirement: %s", strings.Join(args, " "))
+	}
+	path, err := unquote(args[0])
+	if err != nil {
+		return gomodRequirement{}, err
+	}
+	return gomodRequirement{modulePath: path, version: args[1]}, nil
+}
+
+// parseReplace parses the arguments of a replace directive, returning the
+// path of the module replaced and its replacement. The replacement of a module
+// by a local directory has no version.
+func parseReplace(args []string) (string, gomodRequirement, error) {
+	invalid := fmt.Errorf("invalid go.mod replacement: %s", strings.Join(args, " "))
+
+	var arrow int
+	for arrow < len(args) && args[arrow] != "=>" {
+		arrow++
+	}
+	if arrow == 0 || arrow > 2 || arrow == len(args) {
+		return "", gomodRequirement{}, invalid
+	}
+
+	from, err := unquote(args[0])
+	if err != nil {
+		return "", gomodRequirement{}, err
+	}
+	switch to := args[arrow+1:]; len(to) {
+	case 1:
+		dir, err := unquote(to[0])
+		return from, gomodRequirement{modulePath: dir}, err
+	case 2:
+		req, err := parseRequire(to)
+		return from, req, err
+	}
+	return "", gomodRequirement{}, invalid
+}
+
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	u, err := strconv.Unquote(s)
+	return u, errors.Wrapf(err, "invalid quoted string %s", s)
+}
+
+func (g *Importer) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock) {
+	g.Logger.Println("Converting from go.mod ...")
+
+	packages := make([]base.ImportedPackage, 0, len(g.requires))
+	for _, req := range g.requires {
+		// Validate
+		if req.modulePath == "" {
+			g.Logger.Println(
+				"  Warning: Skipping project. Invalid go.mod configuration, module path is required",
+			)
+			continue
+		}
+
+		if pseudoVersion.MatchString(req.version) {
+			// Only an abbreviated revision can be recovered from these.
+			g.Logger.Printf(
+				"  Warning: Skipping import of untagged version %s. "+
+					"The solve step will add the dependency to the lock if needed: %q\n",
+				req.version, req.modulePath,
+			)
+			continue
+		}
+
+		version := strings.TrimSuffix(req.version, "+incompatible")
+		packages = append(packages, base.ImportedPackage{
+			Name:           req.modulePath,
+			Source:         req.source,
+			LockHint:       version,
+			ConstraintHint: version,
+		})
+	}
+
+	g.ImportPackages(packages, true)
+	return g.Manifest, g.Lock
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomod
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/internal/importers/importertest"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestGomodConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importertest.TestCase
+		requires []gomodRequirement
+	}{
+		"module": {
+			importertest.TestCase{
+				WantConstraint: importertest.V1Constraint,
+				WantRevision:   importertest.V1Rev,
+				WantVersion:    importertest.V1Tag,
+			},
+			[]gomodRequirement{
+				{
+					modulePath: importertest.Project,
+					version:    importertest.V1Tag,
+				},
+			},
+		},
+		"missing module path": {
+			importertest.TestCase{
+				WantWarning: "Warning: Skipping project. Invalid go.mod configuration, module path is required",
+			},
+			[]gomodRequirement{{version: importertest.V1Tag}},
+		},
+		"pseudo-version": {
+			importertest.TestCase{
+				WantWarning: fmt.Sprintf(
+					"  Warning: Skipping import of untagged version v1.0.1-0.20170413152506-9b670d143bfb. "+
+						"The solve step will add the dependency to the lock if needed: %q",
+					importertest.Project,
+				),
+			},
+			[]gomodRequirement{{modulePath: importertest.Project, version: "v1.0.1-0.20170413152506-9b670d143bfb"}},
+		},
+	}
+
+	for name, testCase := range testCases {
+		name := name
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			err := testCase.Execute(t, func(logger *log.Logger, sm gps.SourceManager) (*dep.Manifest, *dep.Lock) {
+				g := NewImporter(logger, true, sm)
+				g.requires = testCase.requires
+				return g.convert(importertest.RootProject)
+			})
+			if err != nil {
+				t.Fatalf("%#v", err)
+			}
+		})
+	}
+}
+
+func TestGomodConfig_Load(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir(filepath.Join("src", importertest.RootProject))
+	h.TempCopy(filepath.Join(importertest.RootProject, gomodfile), gomodfile)
+	projectRoot := h.Path(importertest.RootProject)
+
+	output := &bytes.Buffer{}
+	g := NewImporter(log.New(output, "", 0), false, nil)
+	if !g.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect the go.mod file")
+	}
+	h.Must(g.load(projectRoot))
+
+	want := []gomodRequirement{
+		{modulePath: "github.com/carolynvs/deptest-importers", version: "v1.1.0"},
+		{modulePath: "github.com/sdboyer/deptest", version: "v1.0.0", source: "github.com/carolynvs/deptest"},
+		{modulePath: "github.com/sdboyer/deptestdos", version: "v2.0.0+incompatible"},
+	}
+	if !reflect.DeepEqual(g.requires, want) {
+		t.Errorf("unexpected requirements:\n\t(GOT): %+v\n\t(WNT): %+v", g.requires, want)
+	}
+	if !strings.Contains(output.String(), "Ignoring the replacement of github.com/golang/local by the local directory ../local") {
+		t.Errorf("expected a warning about the local replacement, got %q", output.String())
+	}
+}
+
+func TestGomodConfig_LoadInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"github.com/sdboyer/deptest"},
+		{"github.com/sdboyer/deptest", "v1.0.0", "v1.0.1"},
+		{`"github.com/sdboyer/deptest`, "v1.0.0"},
+	} {
+		if _, err := parseRequire(args); err == nil {
+			t.Errorf("expected an error parsing the requirement %q", args)
+		}
+	}
+	for _, args := range [][]string{
+		{"github.com/sdboyer/deptest", "github.com/carolynvs/deptest"},
+		{"=>", "github.com/carolynvs/deptest", "v1.0.0"},
+		{"github.com/sdboyer/deptest", "=>"},
+	} {
+		if _, _, err := parseReplace(args); err == nil {
+			t.Errorf("expected an error parsing the replacement %q", args)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/golang/notexist
+
+require (
+	github.com/carolynvs/deptest-importers v1.1.0
+	github.com/sdboyer/deptest v0.8.1-0.20170413152506-3f4c3bea144e // indirect
+)
+
+require "github.com/sdboyer/deptestdos" v2.0.0+incompatible
+
+replace github.com/sdboyer/deptest => github.com/carolynvs/deptest v1.0.0
+
+replace github.com/golang/local => ../local
@@ -5,6 +5,7 @@
 package govendor
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"log"
@@ -132,7 +133,7 @@ func (g *Importer) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock) {
 			}
 
 			var ignorePattern string
-			_, err := g.SourceManager.DeduceProjectRoot(i)
+			_, err := g.SourceManager.DeduceProjectRoot(context.TODO(), i)
 			if err == nil { // external package
 				ignorePattern = i
 			} else { // relative package path in the current project
@@ -12,6 +12,7 @@ import (
 	"github.com/golang/dep/internal/importers/glide"
 	"github.com/golang/dep/internal/importers/glock"
 	"github.com/golang/dep/internal/importers/godep"
+	"github.com/golang/dep/internal/importers/gomod"
 	"github.com/golang/dep/internal/importers/govend"
 	"github.com/golang/dep/internal/importers/govendor"
 	"github.com/golang/dep/internal/importers/gvt"
@@ -31,15 +32,39 @@ type Importer interface {
 	HasDepMetadata(dir string) bool
 }
 
+// builders construct each importer, in the order they are tried.
+var builders = []func(logger *log.Logger, verbose bool, sm gps.SourceManager) Importer{
+	func(logger *log.Logger, verbose bool, sm gps.SourceManager) Importer {
+		return glide.NewImporter(logger, verbose, sm)
+	},
+	func(logger *log.Logger, verbose bool, sm gps.SourceManager) Importer {
+		return godep.NewImporter(logger, verbose, sm)
+	},
+	func(logger *log.Logger, verbose bool, sm gps.SourceManager) Importer {
+		return vndr.NewImporter(logger, verbose, sm)
+	},
+	func(logger *log.Logger, verbose bool, sm gps.SourceManager) Importer {
+		return govend.NewImporter(logger, verbose, sm)
+	},
+	func(logger *log.Logger, verbose bool, sm gps.SourceManager) Importer {
+		return gvt.NewImporter(logger, verbose, sm)
+	},
+	func(logger *log.Logger, verbose bool, sm gps.SourceManager) Importer {
+		return govendor.NewImporter(logger, verbose, sm)
+	},
+	func(logger *log.Logger, verbose bool, sm gps.SourceManager) Importer {
+		return glock.NewImporter(logger, verbose, sm)
+	},
+	func(logger *log.Logger, verbose bool, sm gps.SourceManager) Importer {
+		return gomod.NewImporter(logger, verbose, sm)
+	},
+}
+
 // BuildAll returns a slice of all the importers.
 func BuildAll(logger *log.Logger, verbose bool, sm gps.SourceManager) []Importer {
-	return []Importer{
-		glide.NewImporter(logger, verbose, sm),
-		godep.NewImporter(logger, verbose, sm),
-		vndr.NewImporter(logger, verbose, sm),
-		govend.NewImporter(logger, verbose, sm),
-		gvt.NewImporter(logger, verbose, sm),
-		govendor.NewImporter(logger, verbose, sm),
-		glock.NewImporter(logger, verbose, sm),
+	importers := make([]Importer, len(builders))
+	for i, build := range builders {
+		importers[i] = build(logger, verbose, sm)
 	}
+	return importers
 }
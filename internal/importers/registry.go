@@ -0,0 +1,111 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package importers
+
+import (
+	"log"
+	"strings"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
+)
+
+// FormatAnalyzer is a gps.ProjectAnalyzer for the configuration of a single
+// dependency manager.
+type FormatAnalyzer interface {
+	gps.ProjectAnalyzer
+
+	// HasDepMetadata checks if a directory contains config that the analyzer can handle.
+	HasDepMetadata(dir string) bool
+}
+
+// Registry is a gps.ProjectAnalyzer that analyzes a dependency with the first
+// of its analyzers to find configuration it can handle in the dependency's
+// tree, so that the constraints declared by dependencies that are managed with
+// other tools are honored while solving.
+type Registry struct {
+	analyzers []FormatAnalyzer
+}
+
+// NewRegistry returns a Registry of dep's own analyzer, followed by analyzers
+// for each of the named importers, in order.
+func NewRegistry(names []string, logger *log.Logger, verbose bool, sm gps.SourceManager) (*Registry, error) {
+	r := &Registry{}
+	r.Register(dep.Analyzer{})
+	for _, name := range names {
+		var found bool
+		for _, build := range builders {
+			if build(logger, verbose, sm).Name() == name {
+				r.Register(importerAnalyzer{name: name, build: func() Importer { return build(logger, verbose, sm) }})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("no analyzer for %q configuration", name)
+		}
+	}
+	return r, nil
+}
+
+// Register adds a to the analyzers of r, to be tried after the others.
+func (r *Registry) Register(a FormatAnalyzer) {
+	r.analyzers = append(r.analyzers, a)
+}
+
+// DeriveManifestAndLock returns the manifest and lock of the first analyzer to
+// find configuration at path, or nil if none do.
+func (r *Registry) DeriveManifestAndLock(path string, n gps.ProjectRoot) (gps.Manifest, gps.Lock, error) {
+	for _, a := range r.analyzers {
+		if a.HasDepMetadata(path) {
+			return a.DeriveManifestAndLock(path, n)
+		}
+	}
+	return nil, nil, nil
+}
+
+// Info returns the names of the analyzers of r, which determine the results of
+// its analysis.
+func (r *Registry) Info() gps.ProjectAnalyzerInfo {
+	names := make([]string, len(r.analyzers))
+	for i, a := range r.analyzers {
+		names[i] = a.Info().String()
+	}
+	return gps.ProjectAnalyzerInfo{
+		Name:    strings.Join(names, "+"),
+		Version: 1,
+	}
+}
+
+// importerAnalyzer adapts an Importer into a FormatAnalyzer. Importers collect
+// what they import, so each analysis is done by a new one.
+type importerAnalyzer struct {
+	name  string
+	build func() Importer
+}
+
+func (a importerAnalyzer) HasDepMetadata(dir string) bool {
+	return a.build().HasDepMetadata(dir)
+}
+
+func (a importerAnalyzer) DeriveManifestAndLock(path string, n gps.ProjectRoot) (gps.Manifest, gps.Lock, error) {
+	m, l, err := a.build().Import(path, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Avoid returning typed nils, which aren't nil interfaces.
+	if l == nil {
+		return m, nil, nil
+	}
+	return m, l, nil
+}
+
+func (a importerAnalyzer) Info() gps.ProjectAnalyzerInfo {
+	return gps.ProjectAnalyzerInfo{
+		Name:    a.name,
+		Version: 1,
+	}
+}
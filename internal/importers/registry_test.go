@@ -0,0 +1,73 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package importers
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+// fileAnalyzer handles any directory containing a file with its name.
+type fileAnalyzer string
+
+func (a fileAnalyzer) HasDepMetadata(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, string(a)))
+	return err == nil
+}
+
+func (a fileAnalyzer) DeriveManifestAndLock(string, gps.ProjectRoot) (gps.Manifest, gps.Lock, error) {
+	return gps.SimpleManifest{Deps: gps.ProjectConstraints{"github.com/" + gps.ProjectRoot(a): {}}}, nil, nil
+}
+
+func (a fileAnalyzer) Info() gps.ProjectAnalyzerInfo {
+	return gps.ProjectAnalyzerInfo{Name: string(a), Version: 2}
+}
+
+func TestRegistry(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempFile("both/"+dep.ManifestName, "")
+	h.TempFile("both/fake", "")
+	h.TempFile("fake/fake", "")
+	h.TempDir("none")
+
+	logger := log.New(ioutil.Discard, "", 0)
+	r, err := NewRegistry([]string{"glide", "gomod"}, logger, false, nil)
+	h.Must(err)
+	r.Register(fileAnalyzer("fake"))
+
+	if got, want := r.Info().Name, "dep.1+glide.1+gomod.1+fake.2"; got != want {
+		t.Errorf("expected the registry to be named %q, got %q", want, got)
+	}
+
+	// dep's own configuration takes precedence over any other.
+	m, _, err := r.DeriveManifestAndLock(h.Path("both"), "github.com/golang/notexist")
+	h.Must(err)
+	if _, ok := m.(*dep.Manifest); !ok {
+		t.Errorf("expected dep's manifest, got %#v", m)
+	}
+
+	m, _, err = r.DeriveManifestAndLock(h.Path("fake"), "github.com/golang/notexist")
+	h.Must(err)
+	if _, ok := m.DependencyConstraints()["github.com/fake"]; !ok {
+		t.Errorf("expected the fake analyzer's manifest, got %#v", m)
+	}
+
+	m, l, err := r.DeriveManifestAndLock(h.Path("none"), "github.com/golang/notexist")
+	if m != nil || l != nil || err != nil {
+		t.Errorf("expected no analysis of a tree without configuration, got %#v, %#v, %v", m, l, err)
+	}
+
+	if _, err := NewRegistry([]string{"glide", "maven"}, logger, false, nil); err == nil {
+		t.Error("expected an error for an unknown analyzer")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package license recognizes common open source licenses by their texts.
+package license
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// licenseSignatures identifies common licenses by phrases, in lower case and
+// with whitespace collapsed, that all appear in their texts; typically their
+// titles. They are checked in order, so a license must come before any whose
+// phrases are a subset of its own.
+var licenseSignatures = []struct {
+	id      string
+	phrases []string
+}{
+	{"Apache-2.0", []string{"apache license version 2.0"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"AGPL-3.0", []string{"gnu affero general public license version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license version 3"}},
+	{"GPL-2.0", []string{"gnu general public license version 2"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+	{"CC0-1.0", []string{"cc0 1.0 universal"}},
+}
+
+// Identify returns the SPDX identifier of the license whose text is text, or
+// the empty string if it is not recognized.
+func Identify(text string) string {
+	// Collapse whitespace, so that phrases broken across lines still match.
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	for _, sig := range licenseSignatures {
+		matched := true
+		for _, phrase := range sig.phrases {
+			if !strings.Contains(text, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return sig.id
+		}
+	}
+	return ""
+}
+
+// Detect returns the sorted SPDX identifiers of the licenses recognized in the
+// license files (see pkgtree.IsLicenseFile) directly within dir. A dir that
+// does not exist has no licenses.
+func Detect(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() || !pkgtree.IsLicenseFile(fi.Name()) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if id := Identify(string(b)); id != "" {
+			found[id] = true
+		}
+	}
+
+	var ids []string
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,26 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package license
+
+import "testing"
+
+func TestIdentify(t *testing.T) {
+	cases := []struct {
+		text, want string
+	}{
+		{"Permission is hereby granted, free of charge, to any person obtaining a copy\nof this software", "MIT"},
+		{"                                 Apache License\n                           Version 2.0, January 2004\n", "Apache-2.0"},
+		{"GNU GENERAL PUBLIC LICENSE\n Version 3, 29 June 2007\n... use the GNU Lesser General Public License instead of this License.", "GPL-3.0"},
+		{"GNU LESSER GENERAL PUBLIC LICENSE\n Version 3, 29 June 2007\n", "LGPL-3.0"},
+		{"Redistribution and use in source and binary forms, with or without\nmodification, are permitted. Neither the name of Bob", "BSD-3-Clause"},
+		{"Redistribution and use in source and binary forms, with or without\nmodification, are permitted.", "BSD-2-Clause"},
+		{"All rights reserved.", ""},
+	}
+	for _, c := range cases {
+		if got := Identify(c.text); got != c.want {
+			t.Errorf("Identify(%q): expected %q, got %q", c.text, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package notices generates a single file of the license and notice texts of
+// a project's vendored dependencies, as is commonly needed to comply with
+// their licenses when distributing what is built from them.
+package notices
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/golang/dep/internal/license"
+	"github.com/pkg/errors"
+)
+
+// FileName is the name of the notices file, in the root of a project.
+const FileName = "THIRD_PARTY_NOTICES"
+
+// rule separates the sections for each project.
+var rule = strings.Repeat("=", 80)
+
+// Write writes to w the texts of the license and notice files (see
+// pkgtree.IsLicenseFile) anywhere within the vendored copy, in vendorDir, of
+// each of the projects in l, under a header naming the project and its locked
+// version. Projects with no such files are listed as having none.
+//
+// What is written depends only on l and the files, so it is the same each time
+// unless they change.
+func Write(w io.Writer, l gps.Lock, vendorDir string) error {
+	bw := bufio.NewWriter(w)
+	for i, lp := range l.Projects() {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		pr := string(lp.Ident().ProjectRoot)
+		fmt.Fprintf(bw, "%s\n%s\n%s\n", rule, header(pr, lp.Version()), rule)
+
+		dir := filepath.Join(vendorDir, filepath.FromSlash(pr))
+		files, err := licenseFiles(dir)
+		if err != nil {
+			return errors.Wrapf(err, "failed to find license files of %s", pr)
+		}
+		if len(files) == 0 {
+			fmt.Fprint(bw, "\nNo license or notice files were found.\n")
+			continue
+		}
+
+		for _, f := range files {
+			b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f)))
+			if err != nil {
+				return errors.Wrapf(err, "failed to read license file of %s", pr)
+			}
+			if id := license.Identify(string(b)); id != "" {
+				f += " (" + id + ")"
+			}
+			fmt.Fprintf(bw, "\n--- %s ---\n\n", f)
+			bw.Write(b)
+			if len(b) > 0 && !bytes.HasSuffix(b, []byte("\n")) {
+				fmt.Fprintln(bw)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// header describes the project pr at v, by its version and revision, if it has
+// both.
+func header(pr string, v gps.Version) string {
+	switch tv := v.(type) {
+	case gps.PairedVersion:
+		if r := tv.Revision(); r != "" {
+			return fmt.Sprintf("%s %s (%s)", pr, tv.Unpair(), r)
+		}
+		return fmt.Sprintf("%s %s", pr, tv.Unpair())
+	case nil:
+		return pr
+	default:
+		return fmt.Sprintf("%s %s", pr, tv)
+	}
+}
+
+// licenseFiles returns the sorted, slash-separated paths, relative to dir, of
+// the license files anywhere within it. A dir that does not exist has none.
+func licenseFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || !pkgtree.IsLicenseFile(info.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package notices
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/gps"
+)
+
+func TestWrite(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "notices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	for name, contents := range map[string]string{
+		"github.com/alice/a/LICENSE":        "Permission is hereby granted, free of charge, to any person\n",
+		"github.com/alice/a/NOTICE":         "Includes work by Dave",
+		"github.com/alice/a/sub/PATENTS":    "Additional grant of patent rights\n",
+		"github.com/alice/a/license.go":     "package a\n",
+		"github.com/alice/a/sub/README.md":  "Read me\n",
+		"github.com/carol/c/AUTHORS":        "Carol\n",
+		"github.com/carol/c/vendor/x/y.txt": "not a notice\n",
+	} {
+		path := filepath.Join(vendor, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := gps.SimpleLock{
+		gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/alice/a"},
+			gps.NewVersion("v1.0.0").Pair("c575196502940c07bf89fd6d95e83a999bb78ad6"),
+			nil,
+		),
+		gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/bob/b"},
+			gps.Revision("5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e"),
+			nil,
+		),
+		gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/carol/c"},
+			gps.NewBranch("master").Pair("a9d1f9f4bcc5ab6c5c2b2dfa3d7e0fd4ac2b4a31"),
+			nil,
+		),
+	}
+
+	var buf bytes.Buffer
+	if err = Write(&buf, l, vendor); err != nil {
+		t.Fatal(err)
+	}
+
+	rule := strings.Repeat("=", 80)
+	want := rule + `
+github.com/alice/a v1.0.0 (c575196502940c07bf89fd6d95e83a999bb78ad6)
+` + rule + `
+
+--- LICENSE (MIT) ---
+
+Permission is hereby granted, free of charge, to any person
+
+--- NOTICE ---
+
+Includes work by Dave
+
+--- sub/PATENTS ---
+
+Additional grant of patent rights
+
+` + rule + `
+github.com/bob/b 5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e
+` + rule + `
+
+No license or notice files were found.
+
+` + rule + `
+github.com/carol/c master (a9d1f9f4bcc5ab6c5c2b2dfa3d7e0fd4ac2b4a31)
+` + rule + `
+
+--- AUTHORS ---
+
+Carol
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected notices:\n(GOT):\n%s\n(WNT):\n%s", got, want)
+	}
+}
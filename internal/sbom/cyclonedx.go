@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type cdxComponent struct {
+	Type               string           `json:"type"`
+	BOMRef             string           `json:"bom-ref,omitempty"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	PURL               string           `json:"purl,omitempty"`
+	Licenses           []cdxLicense     `json:"licenses,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty    `json:"properties,omitempty"`
+}
+
+type cdxLicense struct {
+	License struct {
+		ID string `json:"id"`
+	} `json:"license"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// WriteCycloneDX writes d to w as a CycloneDX 1.4 document, in JSON.
+func WriteCycloneDX(w io.Writer, d Document) error {
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + d.UUID,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: d.Created.UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Name: d.Tool, Version: d.ToolVersion}},
+			Component: cdxComponent{Type: "application", Name: d.Name},
+		},
+		Components: []cdxComponent{},
+	}
+
+	for _, c := range d.Components {
+		comp := cdxComponent{
+			Type:    "library",
+			BOMRef:  c.purl(),
+			Name:    c.Name,
+			Version: c.Version,
+			PURL:    c.purl(),
+		}
+		if comp.Version == "" {
+			comp.Version = c.Revision
+		}
+		for _, id := range c.Licenses {
+			var l cdxLicense
+			l.License.ID = id
+			comp.Licenses = append(comp.Licenses, l)
+		}
+		if c.Source != "" {
+			comp.ExternalReferences = []cdxExternalRef{{Type: "vcs", URL: c.Source}}
+		}
+		if c.Revision != "" {
+			comp.Properties = []cdxProperty{{Name: "dep:revision", Value: c.Revision}}
+		}
+		bom.Components = append(bom.Components, comp)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bom)
+}
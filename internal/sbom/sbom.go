@@ -0,0 +1,104 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sbom generates software bills of materials, inventories of a
+// project's dependencies, from its lock, in the SPDX and CycloneDX formats.
+package sbom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/internal/license"
+	"github.com/pkg/errors"
+)
+
+// Component describes a single locked project.
+type Component struct {
+	Name     string   // The project root.
+	Version  string   // The locked branch or tag, if any.
+	Revision string   // The locked revision.
+	Source   string   // The URL of the project's source.
+	Licenses []string // SPDX identifiers of the licenses detected in the project, if any.
+}
+
+// Document is a bill of materials for a project.
+type Document struct {
+	Name        string    // The root of the project described.
+	Tool        string    // The name of the generating tool.
+	ToolVersion string    // The version of the generating tool.
+	Created     time.Time // When the document was generated.
+	UUID        string    // A unique identifier for the document.
+	Components  []Component
+}
+
+// New returns a Document for the project rooted at name, generated now by
+// version toolVersion of tool, with a new random UUID.
+func New(name, tool, toolVersion string, components []Component) (Document, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return Document{}, errors.Wrap(err, "failed to generate document UUID")
+	}
+	// Mark it as a version 4, variant 1 (random) UUID.
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return Document{
+		Name:        name,
+		Tool:        tool,
+		ToolVersion: toolVersion,
+		Created:     time.Now().UTC(),
+		UUID:        fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]),
+		Components:  components,
+	}, nil
+}
+
+// Components returns a Component for each of the projects in l, in order.
+//
+// sourceURL is used to resolve the URL of each project's source. If vendorDir
+// is non-empty, licenses are detected from the license files in the root of
+// each project's directory in it; projects that are not vendored are left
+// without licenses.
+func Components(l gps.Lock, sourceURL func(gps.ProjectIdentifier) (string, error), vendorDir string) ([]Component, error) {
+	var cs []Component
+	for _, lp := range l.Projects() {
+		id := lp.Ident()
+		c := Component{Name: string(id.ProjectRoot)}
+
+		switch v := lp.Version().(type) {
+		case gps.PairedVersion:
+			c.Version, c.Revision = v.Unpair().String(), string(v.Revision())
+		case gps.Revision:
+			c.Revision = string(v)
+		}
+
+		var err error
+		if c.Source, err = sourceURL(id); err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve source URL for %s", id)
+		}
+
+		if vendorDir != "" {
+			c.Licenses, err = license.Detect(filepath.Join(vendorDir, filepath.FromSlash(c.Name)))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to detect licenses of %s", id)
+			}
+		}
+
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// purl returns the package URL identifying c, which is versioned by its
+// version, if it has one, or else its revision.
+func (c Component) purl() string {
+	v := c.Version
+	if v == "" {
+		v = c.Revision
+	}
+	return fmt.Sprintf("pkg:golang/%s@%s", c.Name, v)
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/gps"
+)
+
+const mitLicense = `Copyright (c) 2017 Alice
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction.
+`
+
+func TestComponents(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "sbom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	alice := filepath.Join(vendor, "github.com", "alice", "a")
+	if err = os.MkdirAll(alice, 0777); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range map[string]string{
+		"LICENSE":    mitLicense,
+		"COPYING":    "GNU GENERAL PUBLIC LICENSE\nVersion 2, June 1991\n",
+		"AUTHORS":    "Alice\n",
+		"license.go": "package a\n\n// Permission is hereby granted, free of charge\n",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(alice, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := gps.SimpleLock{
+		gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/alice/a"},
+			gps.NewVersion("v1.0.0").Pair("c575196502940c07bf89fd6d95e83a999bb78ad6"),
+			nil,
+		),
+		gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/bob/b", Source: "github.com/carol/b"},
+			gps.Revision("5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e"),
+			nil,
+		),
+	}
+	sourceURL := func(id gps.ProjectIdentifier) (string, error) {
+		if id.Source != "" {
+			return "https://" + id.Source, nil
+		}
+		return "https://" + string(id.ProjectRoot), nil
+	}
+
+	got, err := Components(l, sourceURL, vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Component{
+		{
+			Name:     "github.com/alice/a",
+			Version:  "v1.0.0",
+			Revision: "c575196502940c07bf89fd6d95e83a999bb78ad6",
+			Source:   "https://github.com/alice/a",
+			Licenses: []string{"GPL-2.0", "MIT"},
+		},
+		{
+			Name:     "github.com/bob/b",
+			Revision: "5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e",
+			Source:   "https://github.com/carol/b",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected components:\n\t(GOT): %#v\n\t(WNT): %#v", got, want)
+	}
+}
+
+func testDocument() Document {
+	return Document{
+		Name:        "github.com/example/root",
+		Tool:        "dep",
+		ToolVersion: "v0.5.0",
+		Created:     time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+		UUID:        "3e671687-395b-41f5-a30f-a58921a69b79",
+		Components: []Component{
+			{
+				Name:     "github.com/alice/a",
+				Version:  "v1.0.0",
+				Revision: "c575196502940c07bf89fd6d95e83a999bb78ad6",
+				Source:   "https://github.com/alice/a",
+				Licenses: []string{"GPL-2.0", "MIT"},
+			},
+			{
+				Name:     "github.com/bob/b",
+				Revision: "5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e",
+			},
+		},
+	}
+}
+
+func TestWriteSPDX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSPDX(&buf, testDocument()); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SPDXVersion != "SPDX-2.3" || doc.CreationInfo.Created != "2017-01-02T03:04:05Z" {
+		t.Errorf("unexpected document header: %+v", doc)
+	}
+	if len(doc.Packages) != 2 || len(doc.Relationships) != 2 {
+		t.Fatalf("expected 2 packages described, got %+v", doc)
+	}
+
+	a, b := doc.Packages[0], doc.Packages[1]
+	if a.VersionInfo != "v1.0.0" || a.DownloadLocation != "https://github.com/alice/a" || a.LicenseDeclared != "GPL-2.0 AND MIT" {
+		t.Errorf("unexpected package: %+v", a)
+	}
+	if a.ExternalRefs[0].ReferenceLocator != "pkg:golang/github.com/alice/a@v1.0.0" {
+		t.Errorf("unexpected purl %q", a.ExternalRefs[0].ReferenceLocator)
+	}
+	if b.VersionInfo != "5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e" || b.DownloadLocation != spdxNoAssertion || b.LicenseDeclared != spdxNoAssertion {
+		t.Errorf("unexpected package: %+v", b)
+	}
+	if doc.Relationships[1].RelatedSPDXElement != b.SPDXID {
+		t.Errorf("expected the document to describe %s, got %+v", b.SPDXID, doc.Relationships[1])
+	}
+}
+
+func TestWriteCycloneDX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCycloneDX(&buf, testDocument()); err != nil {
+		t.Fatal(err)
+	}
+
+	var bom cdxBOM
+	if err := json.Unmarshal(buf.Bytes(), &bom); err != nil {
+		t.Fatal(err)
+	}
+	if bom.SerialNumber != "urn:uuid:3e671687-395b-41f5-a30f-a58921a69b79" || bom.Metadata.Component.Name != "github.com/example/root" {
+		t.Errorf("unexpected BOM header: %+v", bom)
+	}
+	if len(bom.Components) != 2 {
+		t.Fatalf("expected 2 components, got %+v", bom.Components)
+	}
+
+	a, b := bom.Components[0], bom.Components[1]
+	if a.PURL != "pkg:golang/github.com/alice/a@v1.0.0" || len(a.Licenses) != 2 || a.Licenses[1].License.ID != "MIT" {
+		t.Errorf("unexpected component: %+v", a)
+	}
+	if a.ExternalReferences[0].URL != "https://github.com/alice/a" || a.Properties[0].Value != "c575196502940c07bf89fd6d95e83a999bb78ad6" {
+		t.Errorf("unexpected component: %+v", a)
+	}
+	if b.Version != "5f55bd0aea1b08cba2dbf3acdd5f3f9f7808cd1e" || b.ExternalReferences != nil {
+		t.Errorf("unexpected component: %+v", b)
+	}
+}
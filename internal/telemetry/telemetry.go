@@ -0,0 +1,109 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package telemetry reports anonymized statistics about solves to an endpoint
+// configured by the user, so that the health of dependency management can be
+// monitored across many projects. Nothing is reported unless an endpoint is
+// configured.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
+)
+
+// Timeout bounds how long Send waits for the endpoint, so that an unavailable
+// one cannot hold up dep for long.
+const Timeout = 5 * time.Second
+
+// Report holds anonymized statistics about a single solve. It only has counts,
+// durations and the kinds of calls made, never the names of projects, their
+// sources or anything on disk.
+type Report struct {
+	Command         string       `json:"command"`           // The dep command that solved, such as "ensure".
+	DepVersion      string       `json:"dep_version"`       // The version of dep that solved.
+	GOOS            string       `json:"goos"`              // The operating system dep ran on.
+	GOARCH          string       `json:"goarch"`            // The architecture dep ran on.
+	Succeeded       bool         `json:"succeeded"`         // Whether a solution was found.
+	Projects        int          `json:"projects"`          // Projects in the solution; zero if none was found.
+	SolveDurationMs int64        `json:"solve_duration_ms"` // Time spent solving, in milliseconds.
+	Backtracks      int          `json:"backtracks"`        // Times the solver backtracked, whether or not a solution was found.
+	CacheHitRate    float64      `json:"cache_hit_rate"`    // Fraction of calls on sources answered from the cache.
+	Calls           []CallReport `json:"calls"`             // Counts for each kind of call made on sources.
+}
+
+// CallReport counts the calls of a single kind made on sources during a solve.
+type CallReport struct {
+	Type   string `json:"type"`
+	Issued int    `json:"issued"`
+	Cached int    `json:"cached"`
+	Folded int    `json:"folded"`
+	Failed int    `json:"failed"`
+}
+
+// NewReport returns a Report for a solve that took d, backtracked backtracks
+// times and returned soln and err, and during which the source manager made the
+// calls in stats.
+func NewReport(soln gps.Solution, err error, backtracks int, d time.Duration, stats gps.SourceManagerStats) Report {
+	r := Report{
+		GOOS:            runtime.GOOS,
+		GOARCH:          runtime.GOARCH,
+		Succeeded:       err == nil && soln != nil,
+		SolveDurationMs: int64(d / time.Millisecond),
+		Backtracks:      backtracks,
+		Calls:           make([]CallReport, 0, len(stats.Calls)),
+	}
+	if r.Succeeded {
+		r.Projects = len(soln.Projects())
+	}
+
+	var issued, cached int
+	for _, cs := range stats.Calls {
+		r.Calls = append(r.Calls, CallReport{
+			Type:   cs.Type,
+			Issued: cs.Issued,
+			Cached: cs.Cached,
+			Folded: cs.Folded,
+			Failed: cs.Failed,
+		})
+		issued += cs.Issued
+		cached += cs.Cached
+	}
+	if issued+cached > 0 {
+		r.CacheHitRate = float64(cached) / float64(issued+cached)
+	}
+	return r
+}
+
+// Send posts r, as JSON, to the endpoint URL, giving up after Timeout.
+func Send(ctx context.Context, endpoint string, r Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode telemetry report")
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to build telemetry request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to send telemetry report")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("telemetry endpoint rejected report: %s", resp.Status)
+	}
+	return nil
+}
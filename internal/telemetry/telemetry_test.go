@@ -0,0 +1,109 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
+)
+
+type fakeSolution struct {
+	gps.Solution
+	projects []gps.LockedProject
+	attempts int
+}
+
+func (s fakeSolution) Projects() []gps.LockedProject { return s.projects }
+func (s fakeSolution) Attempts() int                 { return s.attempts }
+
+func TestNewReport(t *testing.T) {
+	soln := fakeSolution{
+		projects: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v1.0.0"), nil),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}, gps.NewVersion("v2.0.0"), nil),
+		},
+		attempts: 3,
+	}
+	stats := gps.SourceManagerStats{
+		Calls: []gps.CallStats{
+			{Type: "list-versions", Issued: 2, Cached: 4, Failed: 1},
+			{Type: "list-packages", Issued: 1, Cached: 1, Folded: 2},
+		},
+	}
+
+	r := NewReport(soln, nil, soln.Attempts(), 1500*time.Millisecond, stats)
+	if !r.Succeeded || r.Projects != 2 || r.Backtracks != 3 || r.SolveDurationMs != 1500 {
+		t.Errorf("unexpected report of a successful solve: %+v", r)
+	}
+	if r.CacheHitRate != 5.0/8 {
+		t.Errorf("expected a cache hit rate of %v, got %v", 5.0/8, r.CacheHitRate)
+	}
+	want := []CallReport{
+		{Type: "list-versions", Issued: 2, Cached: 4, Failed: 1},
+		{Type: "list-packages", Issued: 1, Cached: 1, Folded: 2},
+	}
+	if len(r.Calls) != len(want) {
+		t.Fatalf("expected %v call reports, got %v", len(want), r.Calls)
+	}
+	for i := range want {
+		if r.Calls[i] != want[i] {
+			t.Errorf("call report %d:\n\t(GOT): %+v\n\t(WNT): %+v", i, r.Calls[i], want[i])
+		}
+	}
+
+	// Nothing identifies the projects solved for.
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "sdboyer") {
+		t.Errorf("expected the report to be anonymized, got %s", b)
+	}
+
+	r = NewReport(nil, errors.New("no solution"), 2, time.Second, gps.SourceManagerStats{})
+	if r.Succeeded || r.Projects != 0 || r.Backtracks != 2 || r.CacheHitRate != 0 {
+		t.Errorf("unexpected report of a failed solve: %+v", r)
+	}
+}
+
+func TestSend(t *testing.T) {
+	var got Report
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	want := Report{Command: "ensure", Succeeded: true, Projects: 4, Calls: []CallReport{}}
+	if err := Send(context.Background(), srv.URL, want); err != nil {
+		t.Fatal(err)
+	}
+	if got.Command != want.Command || !got.Succeeded || got.Projects != want.Projects {
+		t.Errorf("endpoint received %+v, want %+v", got, want)
+	}
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer rejecting.Close()
+	if err := Send(context.Background(), rejecting.URL, want); err == nil {
+		t.Error("expected an error from an endpoint that rejects reports")
+	}
+}
@@ -6,8 +6,13 @@ package dep
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
+	"time"
 
 	"github.com/golang/dep/gps"
 	"github.com/golang/dep/gps/verify"
@@ -56,6 +61,15 @@ type rawLockedProject struct {
 	Packages  []string `toml:"packages"`
 	PruneOpts string   `toml:"pruneopts"`
 	Digest    string   `toml:"digest"`
+	SignedBy  string   `toml:"signed-by,omitempty"`
+	Sum       string   `toml:"sum,omitempty"`
+	SourceURL string   `toml:"source-url,omitempty"`
+	VCS       string   `toml:"vcs,omitempty"`
+	Committed string   `toml:"commit-time,omitempty"`
+	Tagger    string   `toml:"tagger,omitempty"`
+	Mirror    string   `toml:"mirror,omitempty"`
+
+	Annotations map[string]string `toml:"annotations,omitempty"`
 }
 
 func readLock(r io.Reader) (*Lock, error) {
@@ -107,7 +121,15 @@ func fromRawLock(raw rawLock) (*Lock, error) {
 
 		var err error
 		vp := verify.VerifiableProject{
-			LockedProject: gps.NewLockedProject(id, v, ld.Packages),
+			LockedProject: gps.Annotate(gps.NewLockedProject(id, v, ld.Packages), ld.Annotations),
+			SignedBy:      ld.SignedBy,
+			Sum:           ld.Sum,
+			Mirror:        ld.Mirror,
+			Provenance: gps.Provenance{
+				SourceURL: ld.SourceURL,
+				VCS:       ld.VCS,
+				Tagger:    ld.Tagger,
+			},
 		}
 		if ld.Digest != "" {
 			vp.Digest, err = verify.ParseVersionedDigest(ld.Digest)
@@ -115,6 +137,12 @@ func fromRawLock(raw rawLock) (*Lock, error) {
 				return nil, err
 			}
 		}
+		if ld.Committed != "" {
+			vp.Provenance.CommitTime, err = time.Parse(time.RFC3339, ld.Committed)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid commit-time for %s", ld.Name)
+			}
+		}
 
 		po, err := gps.ParsePruneOptions(ld.PruneOpts)
 		if err != nil {
@@ -160,6 +188,63 @@ func (l *Lock) HasProjectWithRoot(root gps.ProjectRoot) bool {
 	return false
 }
 
+// PinnedMirrors returns the mirrors and proxies that the projects in the lock
+// were retrieved through, keyed by project root, for those that were.
+func (l *Lock) PinnedMirrors() map[gps.ProjectRoot]string {
+	pins := make(map[gps.ProjectRoot]string)
+	for _, lp := range l.Projects() {
+		if vp, ok := lp.(verify.VerifiableProject); ok && vp.Mirror != "" {
+			pins[lp.Ident().ProjectRoot] = vp.Mirror
+		}
+	}
+	return pins
+}
+
+// UnpinnedProjects returns the roots of the projects in the lock that are not
+// pinned to a revision, such as those locked to a bare branch or version, in
+// the order they are locked.
+func (l *Lock) UnpinnedProjects() []gps.ProjectRoot {
+	var unpinned []gps.ProjectRoot
+	for _, lp := range l.Projects() {
+		var r gps.Revision
+		switch v := lp.Version().(type) {
+		case gps.Revision:
+			r = v
+		case gps.PairedVersion:
+			r = v.Revision()
+		}
+		if r == "" {
+			unpinned = append(unpinned, lp.Ident().ProjectRoot)
+		}
+	}
+	return unpinned
+}
+
+// recordedSourceURL returns url, or if it is empty, the source URL that the lock
+// records the project at root being retrieved from, if any. l may be nil.
+func (l *Lock) recordedSourceURL(root gps.ProjectRoot, url string) string {
+	if url != "" || l == nil {
+		return url
+	}
+	for _, lp := range l.P {
+		if vp, ok := lp.(verify.VerifiableProject); ok && lp.Ident().ProjectRoot == root {
+			return vp.Provenance.SourceURL
+		}
+	}
+	return ""
+}
+
+// UnpinMirrors forgets the mirrors and proxies that the projects in the lock
+// were retrieved through.
+func (l *Lock) UnpinMirrors() {
+	for k, lp := range l.Projects() {
+		if vp, ok := lp.(verify.VerifiableProject); ok {
+			vp.Mirror = ""
+			l.P[k] = vp
+		}
+	}
+}
+
 func (l *Lock) dup() *Lock {
 	l2 := &Lock{
 		SolveMeta: l.SolveMeta,
@@ -207,7 +292,17 @@ func (l *Lock) toRaw() rawLock {
 		// by failing hard if those expectations aren't met.
 		vp := lp.(verify.VerifiableProject)
 		ld.Digest = vp.Digest.String()
+		ld.SignedBy = vp.SignedBy
+		ld.Sum = vp.Sum
+		ld.Mirror = vp.Mirror
+		ld.SourceURL = vp.Provenance.SourceURL
+		ld.VCS = vp.Provenance.VCS
+		ld.Tagger = vp.Provenance.Tagger
+		if !vp.Provenance.CommitTime.IsZero() {
+			ld.Committed = vp.Provenance.CommitTime.UTC().Format(time.RFC3339)
+		}
 		ld.PruneOpts = (vp.PruneOpts & ^gps.PruneNestedVendorDirs).String()
+		ld.Annotations = vp.Annotations()
 
 		raw.Projects = append(raw.Projects, ld)
 	}
@@ -230,6 +325,8 @@ func (l *Lock) MarshalTOML() ([]byte, error) {
 //
 // Data is defensively copied wherever necessary to ensure the resulting *Lock
 // shares no memory with the input solution.
+//
+// The projects in the resulting lock have no digests; DigestLock fills them in.
 func LockFromSolution(in gps.Solution, prune gps.CascadingPruneOptions) *Lock {
 	p := in.Projects()
 
@@ -257,3 +354,40 @@ func LockFromSolution(in gps.Solution, prune gps.CascadingPruneOptions) *Lock {
 
 	return l
 }
+
+// DigestLock fills in the digest of each project in l, along with whatever of
+// its signer, checksum, mirror and provenance sm is able to report, just as
+// writing l out alongside a vendor directory would. Each project is exported,
+// pruned by its own prune options, to a temporary directory to be hashed, so
+// nothing is written to any project.
+//
+// The projects in l must be VerifiableProjects, as those in a lock made by
+// LockFromSolution are.
+func DigestLock(ctx context.Context, l *Lock, sm gps.SourceManager) error {
+	dir, err := ioutil.TempDir("", "dep-digest")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	for k, lp := range l.P {
+		vp, ok := lp.(verify.VerifiableProject)
+		if !ok {
+			return errors.Errorf("cannot digest %s, it has no prune options", lp.Ident().ProjectRoot)
+		}
+
+		to := filepath.Join(dir, filepath.FromSlash(string(lp.Ident().ProjectRoot)))
+		if err := sm.ExportPrunedProject(ctx, vp.LockedProject, vp.PruneOpts, to); err != nil {
+			return errors.Wrapf(err, "failed to export %s", lp.Ident().ProjectRoot)
+		}
+		vp.Digest, err = verify.DigestFromDirectory(to)
+		if err != nil {
+			return errors.Wrapf(err, "failed to hash %s", lp.Ident().ProjectRoot)
+		}
+		if err := verifyProject(ctx, sm, &vp); err != nil {
+			return err
+		}
+		l.P[k] = vp
+	}
+	return nil
+}
@@ -5,11 +5,16 @@
 package dep
 
 import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/gpstest"
 	"github.com/golang/dep/gps/verify"
 	"github.com/golang/dep/internal/test"
 )
@@ -70,6 +75,15 @@ func TestReadLock(t *testing.T) {
 					HashVersion: verify.HashVersion,
 					Digest:      []byte("foo"),
 				},
+				SignedBy: "0123456789ABCDEF0123456789ABCDEF01234567",
+				Sum:      "h1:8X1gzZpR+nVQLAht+L/foqOeX2l9DTZoaIPbEQHxsds=",
+				Mirror:   "https://mirror.example.com/golang/dep",
+				Provenance: gps.Provenance{
+					SourceURL:  "https://mirror.example.com/golang/dep",
+					VCS:        "git",
+					CommitTime: time.Date(2017, time.June, 1, 18, 20, 31, 0, time.UTC),
+					Tagger:     "Jane Doe <jane@example.com>",
+				},
 			},
 		},
 	}
@@ -132,6 +146,15 @@ func TestWriteLock(t *testing.T) {
 					HashVersion: verify.HashVersion,
 					Digest:      []byte("foo"),
 				},
+				SignedBy: "0123456789ABCDEF0123456789ABCDEF01234567",
+				Sum:      "h1:8X1gzZpR+nVQLAht+L/foqOeX2l9DTZoaIPbEQHxsds=",
+				Mirror:   "https://mirror.example.com/golang/dep",
+				Provenance: gps.Provenance{
+					SourceURL:  "https://mirror.example.com/golang/dep",
+					VCS:        "git",
+					CommitTime: time.Date(2017, time.June, 1, 18, 20, 31, 0, time.UTC),
+					Tagger:     "Jane Doe <jane@example.com>",
+				},
 			},
 		},
 	}
@@ -152,6 +175,113 @@ func TestWriteLock(t *testing.T) {
 	}
 }
 
+func TestLockAnnotations(t *testing.T) {
+	annotations := gps.Annotations{"build": "42", "reviewed-by": "Jane Doe <jane@example.com>"}
+	l := &Lock{
+		P: []gps.LockedProject{
+			verify.VerifiableProject{
+				LockedProject: gps.Annotate(gps.NewLockedProject(
+					gps.ProjectIdentifier{ProjectRoot: "github.com/golang/dep"},
+					gps.NewVersion("0.12.2").Pair("d05d5aca9f895d19e9265839bffeadd74a2d2ecb"),
+					[]string{"."},
+				), annotations),
+			},
+			verify.VerifiableProject{
+				LockedProject: gps.NewLockedProject(
+					gps.ProjectIdentifier{ProjectRoot: "github.com/pkg/errors"},
+					gps.NewVersion("v0.8.0").Pair("645ef00459ed84a119197bfb8d8205042c6df63d"),
+					[]string{"."},
+				),
+			},
+		},
+	}
+
+	data, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "[projects.annotations]"); n != 1 {
+		t.Errorf("expected one project to have annotations, got %d in:\n%s", n, data)
+	}
+
+	l2, err := readLock(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gps.ProjectAnnotations(l2.P[0]); !reflect.DeepEqual(got, annotations) {
+		t.Errorf("expected the annotations to be read back, got %v", got)
+	}
+	if got := gps.ProjectAnnotations(l2.P[1]); got != nil {
+		t.Errorf("expected no annotations, got %v", got)
+	}
+}
+
+func TestLockPinnedMirrors(t *testing.T) {
+	l := &Lock{
+		P: []gps.LockedProject{
+			verify.VerifiableProject{
+				LockedProject: gps.NewLockedProject(
+					gps.ProjectIdentifier{ProjectRoot: "github.com/golang/dep"},
+					gps.NewVersion("0.12.2").Pair("d05d5aca9f895d19e9265839bffeadd74a2d2ecb"),
+					[]string{"."},
+				),
+				Mirror: "https://mirror.example.com/golang/dep",
+			},
+			verify.VerifiableProject{
+				LockedProject: gps.NewLockedProject(
+					gps.ProjectIdentifier{ProjectRoot: "github.com/pkg/errors"},
+					gps.NewVersion("v0.8.0").Pair("645ef00459ed84a119197bfb8d8205042c6df63d"),
+					[]string{"."},
+				),
+			},
+		},
+	}
+
+	want := map[gps.ProjectRoot]string{"github.com/golang/dep": "https://mirror.example.com/golang/dep"}
+	if got := l.PinnedMirrors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected pins %v, got %v", want, got)
+	}
+
+	l.UnpinMirrors()
+	if got := l.PinnedMirrors(); len(got) != 0 {
+		t.Errorf("expected no pins once unpinned, got %v", got)
+	}
+	if got := (*Lock)(nil).PinnedMirrors(); len(got) != 0 {
+		t.Errorf("expected no pins without a lock, got %v", got)
+	}
+}
+
+func TestLockUnpinnedProjects(t *testing.T) {
+	lp := func(root string, v gps.Version) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(root)}, v, []string{"."})
+	}
+	l := &Lock{
+		P: []gps.LockedProject{
+			lp("github.com/a/branch", gps.NewBranch("master").Pair("")),
+			lp("github.com/b/paired", gps.NewVersion("v1.0.0").Pair("d05d5aca9f895d19e9265839bffeadd74a2d2ecb")),
+			lp("github.com/c/revision", gps.Revision("645ef00459ed84a119197bfb8d8205042c6df63d")),
+			lp("github.com/d/version", gps.NewVersion("v0.8.0")),
+		},
+	}
+
+	want := []gps.ProjectRoot{"github.com/a/branch", "github.com/d/version"}
+	if got := l.UnpinnedProjects(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected unpinned projects %v, got %v", want, got)
+	}
+
+	if err := (&Ctx{}).CheckPinnedRevisions(l); err != nil {
+		t.Errorf("expected unpinned projects to be allowed unless strict, got %s", err)
+	}
+	c := &Ctx{StrictRevisions: true}
+	err := c.CheckPinnedRevisions(l)
+	if err == nil || !strings.Contains(err.Error(), "github.com/a/branch, github.com/d/version") {
+		t.Errorf("expected an error naming the unpinned projects, got %v", err)
+	}
+	if err = c.CheckPinnedRevisions(&Lock{P: l.P[1:3]}); err != nil {
+		t.Errorf("unexpected error for a lock pinned to revisions: %s", err)
+	}
+}
+
 func TestReadLockErrors(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -177,3 +307,59 @@ func TestReadLockErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestDigestLock(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	f := gpstest.NewFixture()
+	f.Version("example.com/a", gps.NewVersion("v1.0.0")).
+		File("a.go", "package a\n")
+	c := gpstest.Case{
+		Fixture: f,
+		Root:    "example.com/root",
+		Imports: []string{"example.com/a"},
+	}
+	soln, err := c.Solve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prune := gps.CascadingPruneOptions{DefaultOptions: gps.PruneNestedVendorDirs | gps.PruneGoTestFiles}
+	l := LockFromSolution(soln, prune)
+	if err := DigestLock(context.Background(), l, f.SourceManager()); err != nil {
+		t.Fatal(err)
+	}
+
+	h.TempDir("a")
+	if err := ioutil.WriteFile(filepath.Join(h.Path("a"), "a.go"), []byte("package a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	want, err := verify.DigestFromDirectory(h.Path("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.P) != 1 {
+		t.Fatalf("expected 1 project in the lock, got %d", len(l.P))
+	}
+	vp := l.P[0].(verify.VerifiableProject)
+	if !reflect.DeepEqual(vp.Digest, want) {
+		t.Errorf("unexpected digest:\n\t(GOT): %s\n\t(WNT): %s", vp.Digest, want)
+	}
+	if vp.PruneOpts != prune.DefaultOptions {
+		t.Errorf("expected prune options %s, got %s", prune.DefaultOptions, vp.PruneOpts)
+	}
+	if _, err := l.MarshalTOML(); err != nil {
+		t.Errorf("failed to marshal digested lock: %s", err)
+	}
+}
+
+func TestDigestLockRequiresPruneOptions(t *testing.T) {
+	l := &Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "example.com/a"}, gps.NewVersion("v1.0.0").Pair("abc"), nil),
+	}}
+	if err := DigestLock(context.Background(), l, gpstest.NewFixture().SourceManager()); err == nil {
+		t.Error("expected an error digesting a project without prune options")
+	}
+}
@@ -6,6 +6,7 @@ package dep
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"reflect"
@@ -29,9 +30,11 @@ var (
 	errInvalidRequired     = errors.Errorf("%q must be a TOML list of strings", "required")
 	errInvalidIgnored      = errors.Errorf("%q must be a TOML list of strings", "ignored")
 	errInvalidNoVerify     = errors.Errorf("%q must be a TOML list of strings", "noverify")
+	errInvalidAnalyzers    = errors.Errorf("%q must be a TOML list of strings", "analyzers")
 	errInvalidPrune        = errors.Errorf("%q must be a TOML table of booleans", "prune")
 	errInvalidPruneProject = errors.Errorf("%q must be a TOML array of tables", "prune.project")
 	errInvalidMetadata     = errors.New("metadata should be a TOML table")
+	errInvalidSignature    = errors.Errorf("%q must be a TOML array of tables", "signature")
 
 	errInvalidProjectRoot = errors.New("ProjectRoot name validation failed")
 
@@ -48,12 +51,19 @@ var (
 type Manifest struct {
 	Constraints gps.ProjectConstraints
 	Ovr         gps.ProjectConstraints
+	Scoped      gps.ScopedConstraints
 
 	Ignored  []string
 	Required []string
 
 	NoVerify []string
 
+	// Analyzers names the other dependency managers whose configuration is
+	// read from dependencies that don't have dep's own.
+	Analyzers []string
+
+	Signatures map[gps.ProjectRoot]gps.SignatureRequirement
+
 	PruneOptions gps.CascadingPruneOptions
 }
 
@@ -63,15 +73,23 @@ type rawManifest struct {
 	Ignored      []string        `toml:"ignored,omitempty"`
 	Required     []string        `toml:"required,omitempty"`
 	NoVerify     []string        `toml:"noverify,omitempty"`
+	Analyzers    []string        `toml:"analyzers,omitempty"`
+	Signatures   []rawSignature  `toml:"signature,omitempty"`
 	PruneOptions rawPruneOptions `toml:"prune,omitempty"`
 }
 
 type rawProject struct {
-	Name     string `toml:"name"`
-	Branch   string `toml:"branch,omitempty"`
-	Revision string `toml:"revision,omitempty"`
-	Version  string `toml:"version,omitempty"`
-	Source   string `toml:"source,omitempty"`
+	Name     string   `toml:"name"`
+	Branch   string   `toml:"branch,omitempty"`
+	Revision string   `toml:"revision,omitempty"`
+	Version  string   `toml:"version,omitempty"`
+	Source   string   `toml:"source,omitempty"`
+	Scope    []string `toml:"scope,omitempty"`
+}
+
+type rawSignature struct {
+	Name string `toml:"name"`
+	URL  string `toml:"url,omitempty"`
 }
 
 type rawPruneOptions struct {
@@ -162,6 +180,15 @@ func validateManifest(s string) ([]error, error) {
 								if reflect.TypeOf(value).Kind() != reflect.Map {
 									warns = append(warns, fmt.Errorf("metadata in %q should be a TOML table", prop))
 								}
+							case "scope":
+								if prop != "constraint" {
+									warns = append(warns, fmt.Errorf("invalid key %q in %q", key, prop))
+									break
+								}
+								// Check if scope is a TOML list of strings
+								if rawList, ok := value.([]interface{}); !ok || (len(rawList) > 0 && reflect.TypeOf(rawList[0]).Kind() != reflect.String) {
+									warns = append(warns, fmt.Errorf("scope in %q should be a TOML list of strings", prop))
+								}
 							default:
 								// unknown/invalid key
 								warns = append(warns, fmt.Errorf("invalid key %q in %q", key, prop))
@@ -186,7 +213,7 @@ func validateManifest(s string) ([]error, error) {
 					return warns, errInvalidOverride
 				}
 			}
-		case "ignored", "required", "noverify":
+		case "ignored", "required", "noverify", "analyzers":
 			valid := true
 			if rawList, ok := val.([]interface{}); ok {
 				// Check element type of the array. TOML doesn't let mixing of types in
@@ -208,6 +235,27 @@ func validateManifest(s string) ([]error, error) {
 				if prop == "noverify" {
 					return warns, errInvalidNoVerify
 				}
+				if prop == "analyzers" {
+					return warns, errInvalidAnalyzers
+				}
+			}
+		case "signature":
+			rawSigs, ok := val.([]interface{})
+			if !ok || (len(rawSigs) > 0 && reflect.TypeOf(rawSigs[0]).Kind() != reflect.Map) {
+				return warns, errInvalidSignature
+			}
+			for _, v := range rawSigs {
+				props := v.(map[string]interface{})
+				for key := range props {
+					switch key {
+					case "name", "url":
+					default:
+						warns = append(warns, fmt.Errorf("invalid key %q in %q", key, prop))
+					}
+				}
+				if _, ok := props["name"]; !ok {
+					warns = append(warns, errNoName)
+				}
 			}
 		case "prune":
 			pruneWarns, err := validatePruneOptions(val, true)
@@ -297,13 +345,13 @@ func checkRedundantPruneOptions(co gps.CascadingPruneOptions) (warns []error) {
 // ValidateProjectRoots validates the project roots present in manifest.
 func ValidateProjectRoots(c *Ctx, m *Manifest, sm gps.SourceManager) error {
 	// Channel to receive all the errors
-	errorCh := make(chan error, len(m.Constraints)+len(m.Ovr))
+	errorCh := make(chan error, len(m.Constraints)+len(m.Ovr)+len(m.PruneOptions.PerProjectOptions)+len(m.Signatures))
 
 	var wg sync.WaitGroup
 
 	validate := func(pr gps.ProjectRoot) {
 		defer wg.Done()
-		origPR, err := sm.DeduceProjectRoot(string(pr))
+		origPR, err := sm.DeduceProjectRoot(context.TODO(), string(pr))
 		if err != nil {
 			errorCh <- err
 		} else if origPR != pr {
@@ -323,6 +371,10 @@ func ValidateProjectRoots(c *Ctx, m *Manifest, sm gps.SourceManager) error {
 		wg.Add(1)
 		go validate(pr)
 	}
+	for pr := range m.Signatures {
+		wg.Add(1)
+		go validate(pr)
+	}
 
 	wg.Wait()
 	close(errorCh)
@@ -376,12 +428,26 @@ func fromRawManifest(raw rawManifest, buf *bytes.Buffer) (*Manifest, error) {
 	m.Ignored = raw.Ignored
 	m.Required = raw.Required
 	m.NoVerify = raw.NoVerify
+	m.Analyzers = raw.Analyzers
 
 	for i := 0; i < len(raw.Constraints); i++ {
 		name, prj, err := toProject(raw.Constraints[i])
 		if err != nil {
 			return nil, err
 		}
+		if scope := raw.Constraints[i].Scope; len(scope) > 0 {
+			if m.Scoped == nil {
+				m.Scoped = make(gps.ScopedConstraints)
+			}
+			if _, exists := m.Scoped[name]; exists {
+				return nil, errors.Errorf("multiple scoped dependencies specified for %s, can only specify one", name)
+			}
+			m.Scoped[name] = gps.ScopedConstraint{
+				ProjectProperties: prj,
+				Packages:          scope,
+			}
+			continue
+		}
 		if _, exists := m.Constraints[name]; exists {
 			return nil, errors.Errorf("multiple dependencies specified for %s, can only specify one", name)
 		}
@@ -399,6 +465,17 @@ func fromRawManifest(raw rawManifest, buf *bytes.Buffer) (*Manifest, error) {
 		m.Ovr[name] = prj
 	}
 
+	for _, sig := range raw.Signatures {
+		name := gps.ProjectRoot(sig.Name)
+		if m.Signatures == nil {
+			m.Signatures = make(map[gps.ProjectRoot]gps.SignatureRequirement)
+		}
+		if _, exists := m.Signatures[name]; exists {
+			return nil, errors.Errorf("multiple signature requirements specified for %s, can only specify one", name)
+		}
+		m.Signatures[name] = gps.SignatureRequirement{URL: sig.URL}
+	}
+
 	// TODO(sdboyer) it is awful that we have to do this manual extraction
 	tree, err := toml.Load(buf.String())
 	if err != nil {
@@ -505,11 +582,9 @@ func toProject(raw rawProject) (n gps.ProjectRoot, pp gps.ProjectProperties, err
 			return n, pp, errors.Errorf("multiple constraints specified for %s, can only specify one", n)
 		}
 
-		// always semver if we can
-		pp.Constraint, err = gps.NewSemverConstraintIC(raw.Version)
+		pp.Constraint, err = gps.ParseConstraint(raw.Version)
 		if err != nil {
-			// but if not, fall back on plain versions
-			pp.Constraint = gps.NewVersion(raw.Version)
+			return n, pp, errors.Wrapf(err, "invalid version for %s", n)
 		}
 	} else if raw.Revision != "" {
 		pp.Constraint = gps.Revision(raw.Revision)
@@ -536,16 +611,22 @@ func (m *Manifest) MarshalTOML() ([]byte, error) {
 // toRaw converts the manifest into a representation suitable to write to the manifest file
 func (m *Manifest) toRaw() rawManifest {
 	raw := rawManifest{
-		Constraints: make([]rawProject, 0, len(m.Constraints)),
+		Constraints: make([]rawProject, 0, len(m.Constraints)+len(m.Scoped)),
 		Overrides:   make([]rawProject, 0, len(m.Ovr)),
 		Ignored:     m.Ignored,
 		Required:    m.Required,
 		NoVerify:    m.NoVerify,
+		Analyzers:   m.Analyzers,
 	}
 
 	for n, prj := range m.Constraints {
 		raw.Constraints = append(raw.Constraints, toRawProject(n, prj))
 	}
+	for n, sc := range m.Scoped {
+		rp := toRawProject(n, sc.ProjectProperties)
+		rp.Scope = sc.Packages
+		raw.Constraints = append(raw.Constraints, rp)
+	}
 	sort.Sort(sortedRawProjects(raw.Constraints))
 
 	for n, prj := range m.Ovr {
@@ -553,6 +634,13 @@ func (m *Manifest) toRaw() rawManifest {
 	}
 	sort.Sort(sortedRawProjects(raw.Overrides))
 
+	for n, req := range m.Signatures {
+		raw.Signatures = append(raw.Signatures, rawSignature{Name: string(n), URL: req.URL})
+	}
+	sort.Slice(raw.Signatures, func(i, j int) bool {
+		return raw.Signatures[i].Name < raw.Signatures[j].Name
+	})
+
 	raw.PruneOptions = toRawPruneOptions(m.PruneOptions)
 
 	return raw
@@ -572,7 +660,15 @@ func (s sortedRawProjects) Less(i, j int) bool {
 		return false
 	}
 
-	return l.Source < r.Source
+	if l.Source < r.Source {
+		return true
+	}
+	if r.Source < l.Source {
+		return false
+	}
+
+	// Unscoped constraints sort ahead of scoped ones on the same project.
+	return len(l.Scope) < len(r.Scope)
 }
 
 func toRawProject(name gps.ProjectRoot, project gps.ProjectProperties) rawProject {
@@ -611,6 +707,12 @@ func (m *Manifest) DependencyConstraints() gps.ProjectConstraints {
 	return m.Constraints
 }
 
+// ScopedConstraints returns a list of project-level constraints that apply only
+// when the project is reachable from particular root packages.
+func (m *Manifest) ScopedConstraints() gps.ScopedConstraints {
+	return m.Scoped
+}
+
 // Overrides returns a list of project-level override constraints.
 func (m *Manifest) Overrides() gps.ProjectConstraints {
 	return m.Ovr
@@ -633,6 +735,9 @@ func (m *Manifest) HasConstraintsOn(root gps.ProjectRoot) bool {
 	if _, has := m.Ovr[root]; has {
 		return true
 	}
+	if _, has := m.Scoped[root]; has {
+		return true
+	}
 
 	return false
 }
@@ -107,6 +107,98 @@ func TestWriteManifest(t *testing.T) {
 	}
 }
 
+func TestReadWriteScopedManifest(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/scoped.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	got, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("should have read manifest correctly, but got err %q", err)
+	}
+
+	c, _ := gps.NewSemverConstraintIC("0.12.0")
+	sc, _ := gps.NewSemverConstraintIC("0.12.1")
+	wantc := gps.ProjectConstraints{
+		gps.ProjectRoot("github.com/golang/dep"): {
+			Constraint: c,
+		},
+	}
+	wants := gps.ScopedConstraints{
+		gps.ProjectRoot("github.com/golang/dep"): {
+			ProjectProperties: gps.ProjectProperties{
+				Constraint: sc,
+			},
+			Packages: []string{"github.com/foo/bar/cmd/bar"},
+		},
+	}
+
+	if !reflect.DeepEqual(got.Constraints, wantc) {
+		t.Errorf("Valid manifest's dependencies did not parse as expected:\n\t(GOT): %v\n\t(WNT): %v", got.Constraints, wantc)
+	}
+	if !reflect.DeepEqual(got.Scoped, wants) {
+		t.Errorf("Valid manifest's scoped dependencies did not parse as expected:\n\t(GOT): %v\n\t(WNT): %v", got.Scoped, wants)
+	}
+	if !got.HasConstraintsOn("github.com/golang/dep") {
+		t.Error("expected manifest to report constraints on github.com/golang/dep")
+	}
+
+	b, err := got.MarshalTOML()
+	if err != nil {
+		t.Fatalf("error while marshaling valid manifest to TOML: %q", err)
+	}
+
+	want := h.GetTestFileString(golden)
+	if string(b) != want {
+		if *test.UpdateGolden {
+			if err = h.WriteTestFile(golden, string(b)); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			t.Errorf("valid manifest did not marshal to TOML as expected:\n(GOT):\n%s\n(WNT):\n%s", string(b), want)
+		}
+	}
+}
+
+func TestReadWriteSignatureManifest(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/signature.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	got, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("should have read manifest correctly, but got err %q", err)
+	}
+
+	want := map[gps.ProjectRoot]gps.SignatureRequirement{
+		"github.com/golang/dep":  {},
+		"github.com/sdboyer/gps": {URL: "https://example.com/gps/{version}.sig"},
+	}
+	if !reflect.DeepEqual(got.Signatures, want) {
+		t.Errorf("Valid manifest's signature requirements did not parse as expected:\n\t(GOT): %v\n\t(WNT): %v", got.Signatures, want)
+	}
+
+	b, err := got.MarshalTOML()
+	if err != nil {
+		t.Fatalf("error while marshaling valid manifest to TOML: %q", err)
+	}
+
+	wantTOML := h.GetTestFileString(golden)
+	if string(b) != wantTOML {
+		if *test.UpdateGolden {
+			if err = h.WriteTestFile(golden, string(b)); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			t.Errorf("valid manifest did not marshal to TOML as expected:\n(GOT):\n%s\n(WNT):\n%s", string(b), wantTOML)
+		}
+	}
+}
+
 func TestReadManifestErrors(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -119,6 +211,7 @@ func TestReadManifestErrors(t *testing.T) {
 		{"multiple constraints", "manifest/error1.toml"},
 		{"multiple dependencies", "manifest/error2.toml"},
 		{"multiple overrides", "manifest/error3.toml"},
+		{"invalid version", "manifest/error4.toml"},
 	}
 
 	for _, tst := range tests {
@@ -156,6 +249,22 @@ func TestValidateManifest(t *testing.T) {
 			wantWarn:  []error{},
 			wantError: errInvalidRequired,
 		},
+		{
+			name: "valid analyzers",
+			tomlString: `
+			analyzers = ["glide", "gomod"]
+			`,
+			wantWarn:  []error{},
+			wantError: nil,
+		},
+		{
+			name: "invalid analyzers",
+			tomlString: `
+			analyzers = "glide"
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidAnalyzers,
+		},
 		{
 			name: "empty required",
 			tomlString: `
@@ -181,6 +290,43 @@ func TestValidateManifest(t *testing.T) {
 			wantWarn:  []error{},
 			wantError: errInvalidRequired,
 		},
+		{
+			name: "valid scoped constraint",
+			tomlString: `
+			[[constraint]]
+			  name = "github.com/foo/bar"
+			  version = "1.0.0"
+			  scope = ["github.com/baz/qux/cmd/qux"]
+			`,
+			wantWarn:  []error{},
+			wantError: nil,
+		},
+		{
+			name: "invalid scoped constraint",
+			tomlString: `
+			[[constraint]]
+			  name = "github.com/foo/bar"
+			  version = "1.0.0"
+			  scope = "github.com/baz/qux/cmd/qux"
+			`,
+			wantWarn: []error{
+				errors.New("scope in \"constraint\" should be a TOML list of strings"),
+			},
+			wantError: nil,
+		},
+		{
+			name: "scoped override",
+			tomlString: `
+			[[override]]
+			  name = "github.com/foo/bar"
+			  version = "1.0.0"
+			  scope = ["github.com/baz/qux/cmd/qux"]
+			`,
+			wantWarn: []error{
+				errors.New("invalid key \"scope\" in \"override\""),
+			},
+			wantError: nil,
+		},
 		{
 			name: "valid ignored",
 			tomlString: `
@@ -338,6 +484,36 @@ func TestValidateManifest(t *testing.T) {
 			wantWarn:  []error{},
 			wantError: errInvalidOverride,
 		},
+		{
+			name: "valid signature",
+			tomlString: `
+			[[signature]]
+			  name = "github.com/foo/bar"
+			  url = "https://example.com/bar/{version}.sig"
+			`,
+			wantWarn:  []error{},
+			wantError: nil,
+		},
+		{
+			name: "invalid signature fields",
+			tomlString: `
+			[[signature]]
+			  keyring = "keys"
+			`,
+			wantWarn: []error{
+				errors.New("invalid key \"keyring\" in \"signature\""),
+				errNoName,
+			},
+			wantError: nil,
+		},
+		{
+			name: "invalid signature",
+			tomlString: `
+			signature = ["github.com/foo/bar"]
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidSignature,
+		},
 		{
 			name: "invalid fields",
 			tomlString: `
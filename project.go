@@ -5,6 +5,7 @@
 package dep
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -46,6 +47,18 @@ func findProjectRoot(from string) (string, error) {
 	}
 }
 
+// FindProjectRoot searches from the directory from upwards for the root of a
+// project: the directory its manifest file is in. Unlike Ctx.LoadProject, it
+// reads nothing. It returns the empty string, and no error, if from is not
+// within a project.
+func FindProjectRoot(from string) (string, error) {
+	root, err := findProjectRoot(from)
+	if err == errProjectNotFound {
+		return "", nil
+	}
+	return root, err
+}
+
 // checkGopkgFilenames validates filename case for the manifest and lock files.
 //
 // This is relevant on case-insensitive file systems like the defaults in Windows and
@@ -235,7 +248,7 @@ func (p *Project) GetDirectDependencyNames(sm gps.SourceManager) (map[gps.Projec
 
 	directDeps := map[gps.ProjectRoot]bool{}
 	for _, ip := range reach {
-		pr, err := sm.DeduceProjectRoot(ip)
+		pr, err := sm.DeduceProjectRoot(context.TODO(), ip)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,54 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
+)
+
+// readRevisionAllowlist reads a revision allowlist from the file at path. See
+// parseRevisionAllowlist for its format.
+func readRevisionAllowlist(path string) (map[gps.ProjectRoot][]gps.Revision, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open revision allowlist")
+	}
+	defer f.Close()
+
+	allowed, err := parseRevisionAllowlist(f)
+	return allowed, errors.Wrapf(err, "failed to read revision allowlist %s", path)
+}
+
+// parseRevisionAllowlist parses a list of the revisions of each project that
+// may be used. Each line holds a project root and a revision, separated by
+// whitespace, such as:
+//
+//	github.com/pkg/errors 645ef00459ed84a119197bfb8d8205042c6df63d
+//
+// Blank lines, and lines starting with #, are ignored. The result is never
+// nil, so that an empty list allows nothing.
+func parseRevisionAllowlist(r io.Reader) (map[gps.ProjectRoot][]gps.Revision, error) {
+	allowed := make(map[gps.ProjectRoot][]gps.Revision)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("line %d: expected a project root and a revision, got %q", n, line)
+		}
+		pr := gps.ProjectRoot(fields[0])
+		allowed[pr] = append(allowed[pr], gps.Revision(fields[1]))
+	}
+	return allowed, s.Err()
+}
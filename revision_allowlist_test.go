@@ -0,0 +1,39 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/gps"
+)
+
+func TestParseRevisionAllowlist(t *testing.T) {
+	got, err := parseRevisionAllowlist(strings.NewReader(`# Reviewed 2017-10-01
+github.com/pkg/errors 645ef00459ed84a119197bfb8d8205042c6df63d
+
+github.com/pkg/errors	30136e27e2ac8d167177e8a583aa4c3fea5be833
+github.com/sdboyer/deptest ff2948a2ac8f538c4ecd55962e919d1e13e74baf
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[gps.ProjectRoot][]gps.Revision{
+		"github.com/pkg/errors":      {"645ef00459ed84a119197bfb8d8205042c6df63d", "30136e27e2ac8d167177e8a583aa4c3fea5be833"},
+		"github.com/sdboyer/deptest": {"ff2948a2ac8f538c4ecd55962e919d1e13e74baf"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if got, err = parseRevisionAllowlist(strings.NewReader("")); err != nil || got == nil {
+		t.Errorf("expected an empty allowlist to allow nothing, got %v, %v", got, err)
+	}
+	if _, err = parseRevisionAllowlist(strings.NewReader("github.com/pkg/errors\n")); err == nil {
+		t.Error("expected an error for a line without a revision")
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/nightlyone/lockfile"
+	"github.com/pkg/errors"
+)
+
+// txnDirName is the directory in the project root in which SafeWriter and
+// DeltaWriter stage what they write. Staging beside the files being replaced
+// keeps every rename that puts them into place on one filesystem.
+const txnDirName = ".dep-txn"
+
+// txnJournalName is the file in txnDirName listing the renames of a write
+// being committed. Until it is removed, the write has not taken effect.
+const txnJournalName = "journal.json"
+
+// txnResumableName is what, in txnDirName, is kept when a write fails or is
+// interrupted before it commits: the staged vendor tree, which gps.WriteDepTree
+// journals as it writes, so that the next write resumes rather than starts it
+// afresh.
+const txnResumableName = "vendor"
+
+// txnLockName is the file in the project root that is held as a lock while a
+// write is staged and committed, and while an interrupted one is rolled back,
+// so that no two dep processes write to, or roll back, the same project at
+// once. It only exists while the lock is held.
+const txnLockName = ".dep-txn.lock"
+
+// txnRename is a rename of From to To, both relative to the project root.
+type txnRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// writeTxn moves files staged in txnDirName into a project root as a single
+// unit, so that the manifest, lock and vendor tree are either all replaced or
+// all left as they were.
+//
+// Every rename is journaled before the first is made, and the journal is
+// removed once the last is done. If the renames are interrupted, by an error
+// or by a crash, undoing those that were made restores the previous files;
+// RecoverInterruptedWrite does so for a process that did not finish.
+type writeTxn struct {
+	root       string
+	dir        string
+	lf         lockfile.Lockfile
+	renames    []txnRename
+	committing bool // Whether commit has been called.
+}
+
+// newWriteTxn takes the lock on writing to root, rolls back any write
+// interrupted in it, and creates a staging directory for a new one, holding
+// nothing but what a previous write left to resume. The lock is held until
+// cleanup.
+func newWriteTxn(root string) (*writeTxn, error) {
+	lf, err := lockWrites(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = recoverInterruptedWrite(root); err != nil {
+		lf.Unlock()
+		return nil, err
+	}
+
+	dir := filepath.Join(root, txnDirName)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		lf.Unlock()
+		return nil, errors.Wrap(err, "error while creating staging dir for writing manifest/lock/vendor")
+	}
+	return &writeTxn{root: root, dir: dir, lf: lf}, nil
+}
+
+// lockWrites waits for, and takes, the lock on writing to root. A lock left
+// behind by a process that has since died is taken over.
+func lockWrites(root string) (lockfile.Lockfile, error) {
+	abs, err := filepath.Abs(filepath.Join(root, txnLockName))
+	if err != nil {
+		return "", err
+	}
+	lf, err := lockfile.New(abs)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to create lock %s", abs)
+	}
+
+	for {
+		err = lf.TryLock()
+		if err == nil {
+			return lf, nil
+		}
+		if t, ok := err.(interface {
+			Temporary() bool
+		}); !ok || !t.Temporary() {
+			return "", errors.Wrapf(err, "unable to lock %s", abs)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// staged returns the path at which the file or directory name, relative to
+// the project root, is staged.
+func (t *writeTxn) staged(name string) string {
+	return filepath.Join(t.dir, name)
+}
+
+// move arranges for from to be renamed to to on commit, both relative to the
+// project root.
+func (t *writeTxn) move(from, to string) {
+	t.renames = append(t.renames, txnRename{From: from, To: to})
+}
+
+// replace arranges for the staged name to replace name in the project root on
+// commit. The current name, if any, is kept in the staging directory until
+// the write commits.
+func (t *writeTxn) replace(name string) {
+	if _, err := os.Lstat(filepath.Join(t.root, name)); !os.IsNotExist(err) {
+		t.move(name, filepath.Join(txnDirName, name+".orig"))
+	}
+	t.move(filepath.Join(txnDirName, name), name)
+}
+
+// commit journals and then makes the renames. If any fails, those already
+// made are undone before the error is returned.
+func (t *writeTxn) commit() error {
+	t.committing = true
+	jpath := filepath.Join(t.dir, txnJournalName)
+	if err := writeTxnJournal(jpath, t.renames); err != nil {
+		return err
+	}
+
+	for i, r := range t.renames {
+		err := fs.RenameWithFallback(filepath.Join(t.root, r.From), filepath.Join(t.root, r.To))
+		if err == nil {
+			continue
+		}
+		if rerr := undoRenames(t.root, t.renames[:i]); rerr != nil {
+			return errors.Errorf("failed to move %s into place: %v; rolling back also failed, and will be retried by the next dep command: %v", r.To, err, rerr)
+		}
+		os.Remove(jpath)
+		return errors.Wrapf(err, "failed to move %s into place", r.To)
+	}
+
+	if err := os.Remove(jpath); err != nil {
+		if rerr := undoRenames(t.root, t.renames); rerr != nil {
+			return errors.Errorf("failed to commit write: %v; rolling back also failed, and will be retried by the next dep command: %v", err, rerr)
+		}
+		return errors.Wrap(err, "failed to commit write")
+	}
+	return nil
+}
+
+// cleanup removes the staging directory, along with the files that were
+// replaced, and releases the lock on writing. It leaves the staging directory
+// in place if the journal could not be rolled back, so that the next write
+// can finish the job, and keeps what the next write can resume if the write
+// failed before it was committed.
+func (t *writeTxn) cleanup() {
+	if _, err := os.Stat(filepath.Join(t.dir, txnJournalName)); os.IsNotExist(err) {
+		if t.committing {
+			os.RemoveAll(t.dir)
+		} else {
+			clearStaging(t.dir)
+		}
+	}
+	t.lf.Unlock()
+}
+
+// RecoverInterruptedWrite rolls back a write of the manifest, lock and vendor
+// tree in the project root that was interrupted before it committed, and
+// reports whether there was one to roll back. It is safe to call when no
+// write was interrupted; a write in progress in another process is waited for
+// rather than rolled back.
+//
+// SafeWriter and DeltaWriter do this before every write, so it need only be
+// called to recover without writing anything. A vendor tree staged by a write
+// that had not started to commit is kept, for the next write to resume.
+func RecoverInterruptedWrite(root string) (bool, error) {
+	lf, err := lockWrites(root)
+	if err != nil {
+		return false, err
+	}
+	defer lf.Unlock()
+	return recoverInterruptedWrite(root)
+}
+
+// HasInterruptedWrite reports whether a write of the manifest, lock and vendor
+// tree in the project root was interrupted before it committed, and has yet
+// to be rolled back, leaving them out of step. It only looks, so that it is
+// safe to call from commands that do not write.
+func HasInterruptedWrite(root string) bool {
+	if _, err := os.Stat(filepath.Join(root, txnDirName, txnJournalName)); err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(filepath.Join(root, txnLockName))
+	if err != nil {
+		return true
+	}
+	// A journal with a live owner of the lock is a write still in progress.
+	_, err = lockfile.Lockfile(abs).GetOwner()
+	return err != nil
+}
+
+// recoverInterruptedWrite is RecoverInterruptedWrite, for a caller that holds
+// the lock on writing to root.
+func recoverInterruptedWrite(root string) (bool, error) {
+	dir := filepath.Join(root, txnDirName)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	jpath := filepath.Join(dir, txnJournalName)
+	b, err := ioutil.ReadFile(jpath)
+	if os.IsNotExist(err) {
+		// The write was either interrupted while staging, before anything
+		// was moved into place, or after it committed. Only in the former
+		// case is there anything left to resume.
+		return false, clearStaging(dir)
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to read journal of interrupted write")
+	}
+
+	var renames []txnRename
+	if err = json.Unmarshal(b, &renames); err != nil {
+		return false, errors.Wrapf(err, "failed to parse journal of interrupted write %s", jpath)
+	}
+	if err = undoRenames(root, renames); err != nil {
+		return false, errors.Wrap(err, "failed to roll back interrupted write")
+	}
+	if err = os.Remove(jpath); err != nil {
+		return false, errors.Wrap(err, "failed to remove journal of interrupted write")
+	}
+	return true, errors.Wrapf(os.RemoveAll(dir), "failed to remove %s", dir)
+}
+
+// clearStaging removes everything in the staging directory dir but what may be
+// resumed, and dir itself if nothing is left.
+func clearStaging(dir string) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", dir)
+	}
+	keep := false
+	for _, fi := range fis {
+		if fi.Name() == txnResumableName && fi.IsDir() {
+			keep = true
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(dir, fi.Name())); err != nil {
+			return errors.Wrapf(err, "failed to remove %s", dir)
+		}
+	}
+	if keep {
+		return nil
+	}
+	return errors.Wrapf(os.Remove(dir), "failed to remove %s", dir)
+}
+
+// undoRenames reverses, in reverse order, each of renames that was made. A
+// rename was made if its destination exists and its source does not.
+func undoRenames(root string, renames []txnRename) error {
+	for i := len(renames) - 1; i >= 0; i-- {
+		from, to := filepath.Join(root, renames[i].From), filepath.Join(root, renames[i].To)
+		if _, err := os.Lstat(to); err != nil {
+			continue
+		}
+		if _, err := os.Lstat(from); !os.IsNotExist(err) {
+			continue
+		}
+		if err := fs.RenameWithFallback(to, from); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTxnJournal durably writes renames to path.
+func writeTxnJournal(path string, renames []txnRename) error {
+	b, err := json.Marshal(renames)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal write journal")
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "failed to create write journal")
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	return errors.Wrap(err, "failed to write journal")
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestWriteTxn(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	// stage sets up root with an old lock and vendor tree, and a transaction
+	// replacing both with new ones.
+	stage := func(root string) *writeTxn {
+		h.TempFile(root+"/"+LockName, "old")
+		h.TempFile(root+"/vendor/a/a.go", "old")
+		txn, err := newWriteTxn(h.Path(root))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.TempFile(root+"/"+txnDirName+"/"+LockName, "new")
+		h.TempFile(root+"/"+txnDirName+"/vendor/a/a.go", "new")
+		txn.replace("vendor")
+		txn.replace(LockName)
+		return txn
+	}
+	expect := func(root, want string) {
+		t.Helper()
+		for _, name := range []string{LockName, "vendor/a/a.go"} {
+			b, err := ioutil.ReadFile(h.Path(root + "/" + name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != want {
+				t.Errorf("expected %s to be %q, got %q", name, want, b)
+			}
+		}
+		h.MustNotExist(filepath.Join(h.Path(root), txnDirName))
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		txn := stage("commit")
+		if err := txn.commit(); err != nil {
+			t.Fatal(err)
+		}
+		txn.cleanup()
+		expect("commit", "new")
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		txn := stage("failed")
+		txn.move("missing", "moved")
+		if err := txn.commit(); err == nil {
+			t.Fatal("expected a failed rename to fail the commit")
+		}
+		txn.cleanup()
+		expect("failed", "old")
+	})
+
+	t.Run("crashed", func(t *testing.T) {
+		// Make the journal and the renames of vendor, but not of the lock, as
+		// if dep had been killed part of the way through.
+		txn := stage("crashed")
+		h.Must(writeTxnJournal(filepath.Join(txn.dir, txnJournalName), txn.renames))
+		for _, r := range txn.renames[:2] {
+			h.Must(fs.RenameWithFallback(filepath.Join(txn.root, r.From), filepath.Join(txn.root, r.To)))
+		}
+
+		// The lock of the killed write would have been taken over.
+		h.Must(txn.lf.Unlock())
+		if !HasInterruptedWrite(txn.root) {
+			t.Error("expected the interrupted write to be reported")
+		}
+
+		rolledBack, err := RecoverInterruptedWrite(txn.root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rolledBack {
+			t.Error("expected the interrupted write to be rolled back")
+		}
+		expect("crashed", "old")
+
+		if rolledBack, err = RecoverInterruptedWrite(txn.root); rolledBack || err != nil {
+			t.Errorf("expected nothing to roll back, got %v, %v", rolledBack, err)
+		}
+		if HasInterruptedWrite(txn.root) {
+			t.Error("expected no interrupted write to be reported once rolled back")
+		}
+	})
+
+	t.Run("staging", func(t *testing.T) {
+		// A write killed while staging, before it journaled anything, leaves
+		// its vendor tree for the next write to resume, and nothing else.
+		txn := stage("staging")
+		h.Must(txn.lf.Unlock())
+		if HasInterruptedWrite(txn.root) {
+			t.Error("expected a write interrupted while staging not to be reported")
+		}
+
+		txn, err := newWriteTxn(txn.root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.MustExist(txn.staged("vendor/a/a.go"))
+		h.MustNotExist(txn.staged(LockName))
+		txn.cleanup()
+		h.MustExist(txn.staged("vendor/a/a.go"))
+	})
+
+	t.Run("in progress", func(t *testing.T) {
+		// A write that is journaled, but whose lock is held by another live
+		// process, is still in progress rather than interrupted.
+		txn := stage("progress")
+		h.Must(writeTxnJournal(filepath.Join(txn.dir, txnJournalName), txn.renames))
+		h.Must(txn.lf.Unlock())
+		h.TempFile("progress/"+txnLockName, fmt.Sprintf("%d\n", os.Getppid()))
+		if HasInterruptedWrite(txn.root) {
+			t.Error("expected a write in progress in another process not to be reported as interrupted")
+		}
+	})
+
+	t.Run("released", func(t *testing.T) {
+		txn := stage("released")
+		h.MustExist(filepath.Join(txn.root, txnLockName))
+		txn.cleanup()
+		h.MustNotExist(filepath.Join(txn.root, txnLockName))
+	})
+}
@@ -69,6 +69,7 @@ var lockFileComment = []byte(`# This file is autogenerated, do not edit; changes
 type SafeWriter struct {
 	Manifest     *Manifest
 	lock         *Lock
+	oldLock      *Lock
 	lockDiff     verify.LockDelta
 	writeVendor  bool
 	writeLock    bool
@@ -94,6 +95,7 @@ func NewSafeWriter(manifest *Manifest, oldLock, newLock *Lock, vendor VendorBeha
 	sw := &SafeWriter{
 		Manifest:     manifest,
 		lock:         newLock,
+		oldLock:      oldLock,
 		pruneOptions: prune,
 	}
 
@@ -181,10 +183,12 @@ func (sw SafeWriter) validate(root string, sm gps.SourceManager) error {
 // the absolute path of root dir in which to write. sm is only required if
 // vendor is being written.
 //
-// It first writes to a temp dir, then moves them in place if and only if all
-// the write operations succeeded. It also does its best to roll back if any
-// moves fail. This mostly guarantees that dep cannot exit with a partial write
-// that would leave an undefined state on disk.
+// It first writes to a staging dir in root, then moves them in place if and
+// only if all the write operations succeeded. The moves are journaled, and
+// rolled back if any fails, or by the next dep command if dep is killed while
+// making them. So dep cannot leave a partial write, such as a lock that does
+// not match vendor, on disk. A vendor tree that fails to be written is kept
+// staged, and the next Write finishes it rather than starting over.
 //
 // If logger is not nil, progress will be logged after each project write.
 func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool, logger *log.Logger) error {
@@ -198,15 +202,13 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool, lo
 		return nil
 	}
 
-	mpath := filepath.Join(root, ManifestName)
-	lpath := filepath.Join(root, LockName)
 	vpath := filepath.Join(root, "vendor")
 
-	td, err := ioutil.TempDir(os.TempDir(), "dep")
+	txn, err := newWriteTxn(root)
 	if err != nil {
-		return errors.Wrap(err, "error while creating temp dir for writing manifest/lock/vendor")
+		return err
 	}
-	defer os.RemoveAll(td)
+	defer txn.cleanup()
 
 	if sw.HasManifest() {
 		// Always write the example text to the bottom of the TOML file.
@@ -222,7 +224,7 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool, lo
 			initOutput = exampleTOML
 		}
 
-		if err = ioutil.WriteFile(filepath.Join(td, ManifestName), append(initOutput, tb...), 0666); err != nil {
+		if err = ioutil.WriteFile(txn.staged(ManifestName), append(initOutput, tb...), 0666); err != nil {
 			return errors.Wrap(err, "failed to write manifest file to temp dir")
 		}
 	}
@@ -234,17 +236,21 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool, lo
 				logger.Println(progress)
 			}
 		}
-		err = gps.WriteDepTree(filepath.Join(td, "vendor"), sw.lock, sm, sw.pruneOptions, onWrite)
+		err = gps.WriteDepTree(context.TODO(), txn.staged("vendor"), sw.lock, sm, sw.pruneOptions, onWrite)
 		if err != nil {
 			return errors.Wrap(err, "error while writing out vendor tree")
 		}
 
 		for k, lp := range sw.lock.Projects() {
 			vp := lp.(verify.VerifiableProject)
-			vp.Digest, err = verify.DigestFromDirectory(filepath.Join(td, "vendor", string(lp.Ident().ProjectRoot)))
+			vp.Digest, err = verify.DigestFromDirectory(filepath.Join(txn.staged("vendor"), string(lp.Ident().ProjectRoot)))
 			if err != nil {
 				return errors.Wrapf(err, "error while hashing tree of %s in vendor", lp.Ident().ProjectRoot)
 			}
+			vp.Provenance.SourceURL = sw.oldLock.recordedSourceURL(lp.Ident().ProjectRoot, vp.Provenance.SourceURL)
+			if err = verifyProject(context.TODO(), sm, &vp); err != nil {
+				return err
+			}
 			sw.lock.P[k] = vp
 		}
 	}
@@ -255,107 +261,27 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool, lo
 			return errors.Wrap(err, "failed to marshal lock to TOML")
 		}
 
-		if err = ioutil.WriteFile(filepath.Join(td, LockName), append(lockFileComment, l...), 0666); err != nil {
+		if err = ioutil.WriteFile(txn.staged(LockName), append(lockFileComment, l...), 0666); err != nil {
 			return errors.Wrap(err, "failed to write lock file to temp dir")
 		}
 	}
 
-	// Ensure vendor/.git is preserved if present
-	if hasDotGit(vpath) {
-		err = fs.RenameWithFallback(filepath.Join(vpath, ".git"), filepath.Join(td, "vendor/.git"))
-		if _, ok := err.(*os.LinkError); ok {
-			return errors.Wrap(err, "failed to preserve vendor/.git")
-		}
-	}
-
-	// Move the existing files and dirs to the temp dir while we put the new
-	// ones in, to provide insurance against errors for as long as possible.
-	type pathpair struct {
-		from, to string
+	// Everything is staged. Move it into place together, keeping
+	// vendor/.git if present, so that a failure or crash part of the way
+	// through can never leave a lock that does not match vendor.
+	if sw.writeVendor && hasDotGit(vpath) {
+		txn.move(filepath.Join("vendor", ".git"), filepath.Join(txnDirName, "vendor", ".git"))
 	}
-	var restore []pathpair
-	var failerr error
-	var vendorbak string
-
 	if sw.HasManifest() {
-		if _, err := os.Stat(mpath); err == nil {
-			// Move out the old one.
-			tmploc := filepath.Join(td, ManifestName+".orig")
-			failerr = fs.RenameWithFallback(mpath, tmploc)
-			if failerr != nil {
-				goto fail
-			}
-			restore = append(restore, pathpair{from: tmploc, to: mpath})
-		}
-
-		// Move in the new one.
-		failerr = fs.RenameWithFallback(filepath.Join(td, ManifestName), mpath)
-		if failerr != nil {
-			goto fail
-		}
-	}
-
-	if sw.writeLock {
-		if _, err := os.Stat(lpath); err == nil {
-			// Move out the old one.
-			tmploc := filepath.Join(td, LockName+".orig")
-
-			failerr = fs.RenameWithFallback(lpath, tmploc)
-			if failerr != nil {
-				goto fail
-			}
-			restore = append(restore, pathpair{from: tmploc, to: lpath})
-		}
-
-		// Move in the new one.
-		failerr = fs.RenameWithFallback(filepath.Join(td, LockName), lpath)
-		if failerr != nil {
-			goto fail
-		}
-	}
-
-	if sw.writeVendor {
-		if _, err := os.Stat(vpath); err == nil {
-			// Move out the old vendor dir. just do it into an adjacent dir, to
-			// try to mitigate the possibility of a pointless cross-filesystem
-			// move with a temp directory.
-			vendorbak = vpath + ".orig"
-			if _, err := os.Stat(vendorbak); err == nil {
-				// If the adjacent dir already exists, bite the bullet and move
-				// to a proper tempdir.
-				vendorbak = filepath.Join(td, ".vendor.orig")
-			}
-
-			failerr = fs.RenameWithFallback(vpath, vendorbak)
-			if failerr != nil {
-				goto fail
-			}
-			restore = append(restore, pathpair{from: vendorbak, to: vpath})
-		}
-
-		// Move in the new one.
-		failerr = fs.RenameWithFallback(filepath.Join(td, "vendor"), vpath)
-		if failerr != nil {
-			goto fail
-		}
+		txn.replace(ManifestName)
 	}
-
-	// Renames all went smoothly. The deferred os.RemoveAll will get the temp
-	// dir, but if we wrote vendor, we have to clean that up directly
 	if sw.writeVendor {
-		// Nothing we can really do about an error at this point, so ignore it
-		os.RemoveAll(vendorbak)
+		txn.replace("vendor")
 	}
-
-	return nil
-
-fail:
-	// If we failed at any point, move all the things back into place, then bail.
-	for _, pair := range restore {
-		// Nothing we can do on err here, as we're already in recovery mode.
-		fs.RenameWithFallback(pair.from, pair.to)
+	if sw.writeLock {
+		txn.replace(LockName)
 	}
-	return failerr
+	return txn.commit()
 }
 
 // PrintPreparedActions logs the actions a call to Write would perform.
@@ -402,6 +328,74 @@ func (sw *SafeWriter) PrintPreparedActions(output *log.Logger, verbose bool) err
 	return nil
 }
 
+// signatureVerifier is implemented by SourceManagers that can verify the
+// signatures of versions, such as *gps.SourceMgr. It returns the fingerprint of
+// the signing key, or the empty string if signatures are not being verified.
+type signatureVerifier interface {
+	VerifySignature(context.Context, gps.ProjectIdentifier, gps.Version) (string, error)
+}
+
+// checksumVerifier is implemented by SourceManagers that can verify the
+// contents of versions against a checksum database, such as *gps.SourceMgr. It
+// returns the verified hash, or the empty string if nothing was verified.
+type checksumVerifier interface {
+	VerifyChecksum(context.Context, gps.ProjectIdentifier, gps.Version) (string, error)
+}
+
+// provenanceRecorder is implemented by SourceManagers that can report where
+// versions came from, such as *gps.SourceMgr. It returns an empty Provenance if
+// provenance is not being recorded.
+type provenanceRecorder interface {
+	Provenance(context.Context, gps.ProjectIdentifier, gps.Version) (gps.Provenance, error)
+}
+
+// mirrorReporter is implemented by SourceManagers that can report the mirror or
+// proxy that a project was retrieved through, such as *gps.SourceMgr. It
+// returns the empty string if it was retrieved from upstream, and whether that
+// is known.
+type mirrorReporter interface {
+	Mirror(context.Context, gps.ProjectIdentifier) (string, bool, error)
+}
+
+// verifyProject fills in the SignedBy, Sum, Mirror and Provenance of vp, each
+// only if sm is able to report it. The Mirror and Provenance.SourceURL already
+// in vp are kept if sm can't tell where the project was retrieved from, as
+// when nothing was retrieved for it in this run, so that the lock does not
+// change merely because its sources were cached.
+func verifyProject(ctx context.Context, sm gps.SourceManager, vp *verify.VerifiableProject) error {
+	id, v := vp.Ident(), vp.Version()
+	var err error
+	if sv, ok := sm.(signatureVerifier); ok {
+		if vp.SignedBy, err = sv.VerifySignature(ctx, id, v); err != nil {
+			return errors.Wrapf(err, "failed to verify signature of %s", id.ProjectRoot)
+		}
+	}
+	if cv, ok := sm.(checksumVerifier); ok {
+		if vp.Sum, err = cv.VerifyChecksum(ctx, id, v); err != nil {
+			return errors.Wrapf(err, "failed to verify checksum of %s", id.ProjectRoot)
+		}
+	}
+	if mr, ok := sm.(mirrorReporter); ok {
+		mirror, known, err := mr.Mirror(ctx, id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to find mirror of %s", id.ProjectRoot)
+		}
+		if known {
+			vp.Mirror = mirror
+		}
+	}
+	if pr, ok := sm.(provenanceRecorder); ok {
+		recorded := vp.Provenance.SourceURL
+		if vp.Provenance, err = pr.Provenance(ctx, id, v); err != nil {
+			return errors.Wrapf(err, "failed to read provenance of %s", id.ProjectRoot)
+		}
+		if vp.Provenance.SourceURL == "" && vp.Provenance.VCS != "" {
+			vp.Provenance.SourceURL = recorded
+		}
+	}
+	return nil
+}
+
 // hasDotGit checks if a given path has .git file or directory in it.
 func hasDotGit(path string) bool {
 	gitfilepath := filepath.Join(path, ".git")
@@ -414,6 +408,7 @@ func hasDotGit(path string) bool {
 // have changed.
 type DeltaWriter struct {
 	lock      *Lock
+	oldLock   *Lock
 	lockDiff  verify.LockDelta
 	vendorDir string
 	changed   map[gps.ProjectRoot]changeType
@@ -426,6 +421,7 @@ const (
 	hashMismatch changeType = iota + 1
 	hashVersionMismatch
 	hashAbsent
+	mirrorUnpinned
 	noVerify
 	solveChanged
 	pruneOptsChanged
@@ -441,6 +437,7 @@ const (
 func NewDeltaWriter(p *Project, newLock *Lock, behavior VendorBehavior) (TreeWriter, error) {
 	dw := &DeltaWriter{
 		lock:      newLock,
+		oldLock:   p.Lock,
 		vendorDir: filepath.Join(p.AbsRoot, "vendor"),
 		changed:   make(map[gps.ProjectRoot]changeType),
 		behavior:  behavior,
@@ -503,6 +500,24 @@ func NewDeltaWriter(p *Project, newLock *Lock, behavior VendorBehavior) (TreeWri
 		}
 	}
 
+	// Projects no longer pinned to the mirror or proxy they were retrieved
+	// through are retrieved again, so that where they come from now is what's
+	// recorded.
+	for _, lp := range p.Lock.Projects() {
+		pr := lp.Ident().ProjectRoot
+		if vp, ok := lp.(verify.VerifiableProject); !ok || vp.Mirror == "" {
+			continue
+		}
+		if _, has := dw.changed[pr]; has {
+			continue
+		}
+		for _, nlp := range newLock.Projects() {
+			if vp, ok := nlp.(verify.VerifiableProject); ok && nlp.Ident().ProjectRoot == pr && vp.Mirror == "" {
+				dw.changed[pr] = mirrorUnpinned
+			}
+		}
+	}
+
 	// Apply noverify last, as it should only supersede changeTypes with lower
 	// values. It is NOT applied if no existing change is registered.
 	for _, spr := range p.Manifest.NoVerify {
@@ -530,8 +545,9 @@ func NewDeltaWriter(p *Project, newLock *Lock, behavior VendorBehavior) (TreeWri
 // Write executes the planned changes.
 //
 // This writes recreated projects to a new directory, then moves in existing,
-// unchanged projects from the original vendor directory. If any failures occur,
-// reasonable attempts are made to roll back the changes.
+// unchanged projects from the original vendor directory, and the new vendor
+// directory and lock into place, as a single journaled write like that of
+// SafeWriter.Write.
 func (dw *DeltaWriter) Write(path string, sm gps.SourceManager, examples bool, logger *log.Logger) error {
 	// TODO(sdboyer) remove path from the signature for this
 	if path != filepath.Dir(dw.vendorDir) {
@@ -542,18 +558,25 @@ func (dw *DeltaWriter) Write(path string, sm gps.SourceManager, examples bool, l
 		logger = log.New(ioutil.Discard, "", 0)
 	}
 
-	lpath := filepath.Join(path, LockName)
 	vpath := dw.vendorDir
 
-	// Write the modified projects to a new adjacent directory. We use an
-	// adjacent directory to minimize the possibility of cross-filesystem renames
-	// becoming expensive copies, and to make removal of unneeded projects implicit
+	// Write the modified projects to a new vendor directory staged beside the
+	// original. Staging it there keeps renames from becoming expensive
+	// cross-filesystem copies, and makes removal of unneeded projects implicit
 	// and automatic.
-	vnewpath := filepath.Join(filepath.Dir(vpath), ".vendor-new")
-	if _, err := os.Stat(vnewpath); err == nil {
-		return errors.Errorf("scratch directory %s already exists, please remove it", vnewpath)
+	txn, err := newWriteTxn(path)
+	if err != nil {
+		return err
+	}
+	defer txn.cleanup()
+
+	// Only the projects that changed are written, so a vendor tree left
+	// staged by an earlier write, for it to resume, is of no use.
+	vnewpath := txn.staged("vendor")
+	if err = os.RemoveAll(vnewpath); err != nil {
+		return errors.Wrapf(err, "error while removing stale scratch directory at %s", vnewpath)
 	}
-	err := os.MkdirAll(vnewpath, os.FileMode(0777))
+	err = os.MkdirAll(vnewpath, os.FileMode(0777))
 	if err != nil {
 		return errors.Wrapf(err, "error while creating scratch directory at %s", vnewpath)
 	}
@@ -606,15 +629,29 @@ func (dw *DeltaWriter) Write(path string, sm gps.SourceManager, examples bool, l
 			return errors.Wrapf(err, "failed to hash %s", pr)
 		}
 
+		// The export already required a good signature, if the SourceManager
+		// verifies them, so this only retrieves who made it.
+		ver := verify.VerifiableProject{LockedProject: projs[pr]}
+		if vp, ok := projs[pr].(verify.VerifiableProject); ok {
+			ver.Mirror = vp.Mirror
+			ver.Provenance.SourceURL = vp.Provenance.SourceURL
+		}
+		ver.Provenance.SourceURL = dw.oldLock.recordedSourceURL(pr, ver.Provenance.SourceURL)
+		if err = verifyProject(context.TODO(), sm, &ver); err != nil {
+			return err
+		}
+
 		// Update the new Lock with verification information.
 		for k, lp := range dw.lock.P {
 			if lp.Ident().ProjectRoot == pr {
-				vp := lp.(verify.VerifiableProject)
-				vp.Digest = digest
 				dw.lock.P[k] = verify.VerifiableProject{
 					LockedProject: lp,
 					PruneOpts:     po,
 					Digest:        digest,
+					SignedBy:      ver.SignedBy,
+					Sum:           ver.Sum,
+					Mirror:        ver.Mirror,
+					Provenance:    ver.Provenance,
 				}
 			}
 		}
@@ -626,16 +663,19 @@ func (dw *DeltaWriter) Write(path string, sm gps.SourceManager, examples bool, l
 		return errors.Wrap(err, "failed to marshal lock to TOML")
 	}
 
-	if err = ioutil.WriteFile(lpath, append(lockFileComment, l...), 0666); err != nil {
+	if err = ioutil.WriteFile(txn.staged(LockName), append(lockFileComment, l...), 0666); err != nil {
 		return errors.Wrap(err, "failed to write new lock file")
 	}
 
 	if dw.behavior == VendorNever {
-		return os.RemoveAll(vnewpath)
+		txn.replace(LockName)
+		return txn.commit()
 	}
 
 	// Changed projects are fully populated. Now, iterate over the lock's
-	// projects and move any remaining ones not in the changed list to vnewpath.
+	// projects and arrange for any remaining ones not in the changed list to
+	// be moved to vnewpath. They stay where they are until the write commits,
+	// so that the original vendor directory is intact if it fails.
 	for _, lp := range dw.lock.Projects() {
 		pr := lp.Ident().ProjectRoot
 		tgt := filepath.Join(vnewpath, string(pr))
@@ -645,10 +685,10 @@ func (dw *DeltaWriter) Write(path string, sm gps.SourceManager, examples bool, l
 		}
 
 		if _, has := dw.changed[pr]; !has {
-			err = fs.RenameWithFallback(filepath.Join(vpath, string(pr)), tgt)
-			if err != nil {
+			if _, err = os.Lstat(filepath.Join(vpath, string(pr))); err != nil {
 				return errors.Wrapf(err, "error moving unchanged project %s into scratch vendor dir", pr)
 			}
+			txn.move(filepath.Join("vendor", string(pr)), filepath.Join(txnDirName, "vendor", string(pr)))
 		}
 	}
 
@@ -666,23 +706,14 @@ func (dw *DeltaWriter) Write(path string, sm gps.SourceManager, examples bool, l
 		}
 	}
 
-	// Ensure vendor/.git is preserved if present
+	// Move the new vendor directory and lock into place together, keeping
+	// vendor/.git if present.
 	if hasDotGit(vpath) {
-		err = fs.RenameWithFallback(filepath.Join(vpath, ".git"), filepath.Join(vnewpath, "vendor/.git"))
-		if _, ok := err.(*os.LinkError); ok {
-			return errors.Wrap(err, "failed to preserve vendor/.git")
-		}
-	}
-	err = os.RemoveAll(vpath)
-	if err != nil {
-		return errors.Wrap(err, "failed to remove original vendor directory")
-	}
-	err = fs.RenameWithFallback(vnewpath, vpath)
-	if err != nil {
-		return errors.Wrap(err, "failed to put new vendor directory into place")
+		txn.move(filepath.Join("vendor", ".git"), filepath.Join(txnDirName, "vendor", ".git"))
 	}
-
-	return nil
+	txn.replace("vendor")
+	txn.replace(LockName)
+	return txn.commit()
 }
 
 // changeExplanation outputs a string explaining what changed for each different
@@ -723,6 +754,8 @@ func changeExplanation(c changeType, lpd verify.LockedProjectDelta) string {
 		return "hashing algorithm mismatch"
 	case hashAbsent:
 		return "hash digest absent from lock"
+	case mirrorUnpinned:
+		return "no longer pinned to a mirror"
 	case projectAdded:
 		return "new project"
 	case missingFromTree:
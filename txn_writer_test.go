@@ -5,13 +5,17 @@
 package dep
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/verify"
 	"github.com/golang/dep/internal/test"
 	"github.com/pkg/errors"
 )
@@ -469,3 +473,107 @@ func TestSafeWriter_VendorDotGitPreservedWithForceVendor(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// exportingSM is a SourceManager that exports an empty project, failing for
+// those in fail, and records those it exported.
+type exportingSM struct {
+	gps.SourceManager
+	fail     map[gps.ProjectRoot]bool
+	mu       sync.Mutex
+	exported []gps.ProjectRoot
+}
+
+func (sm *exportingSM) ExportProject(ctx context.Context, id gps.ProjectIdentifier, v gps.Version, to string) error {
+	if sm.fail[id.ProjectRoot] {
+		return errors.Errorf("no export for %s", id.ProjectRoot)
+	}
+	sm.mu.Lock()
+	sm.exported = append(sm.exported, id.ProjectRoot)
+	sm.mu.Unlock()
+	if err := os.MkdirAll(to, 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(to, "a.go"), []byte("package a\n"), 0666)
+}
+
+func TestSafeWriter_ResumesFailedVendorWrite(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("project")
+	root := h.Path("project")
+
+	var lock Lock
+	for _, n := range []string{"a", "b", "c"} {
+		lock.P = append(lock.P, verify.VerifiableProject{
+			LockedProject: gps.NewLockedProject(
+				gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot("example.com/" + n)},
+				gps.NewBranch("master").Pair(gps.Revision(n)),
+				[]string{"."},
+			),
+		})
+	}
+	sw, err := NewSafeWriter(nil, nil, &lock, VendorAlways, defaultCascadingPruneOptions(), nil)
+	h.Must(err)
+
+	sm := &exportingSM{fail: map[gps.ProjectRoot]bool{"example.com/b": true}}
+	if err = sw.Write(root, sm, false, nil); err == nil {
+		t.Fatal("expected the write to fail when a project fails to export")
+	}
+	h.MustNotExist(filepath.Join(root, "vendor"))
+	h.MustNotExist(filepath.Join(root, LockName))
+	h.MustExist(filepath.Join(root, txnDirName, "vendor", "example.com", "a", "a.go"))
+
+	// The next write only exports what the failed one did not.
+	sm = &exportingSM{}
+	h.Must(sw.Write(root, sm, false, nil))
+	if !reflect.DeepEqual(sm.exported, []gps.ProjectRoot{"example.com/b"}) {
+		t.Errorf("expected only the failed project to be exported, got %v", sm.exported)
+	}
+	for _, n := range []string{"a", "b", "c"} {
+		h.MustExist(filepath.Join(root, "vendor", "example.com", n, "a.go"))
+	}
+	h.MustExist(filepath.Join(root, LockName))
+	h.MustNotExist(filepath.Join(root, txnDirName))
+}
+
+// provenanceSM is a SourceManager that reports the mirror and source URL of
+// projects in known, and that it can't tell for any others.
+type provenanceSM struct {
+	gps.SourceManager
+	known map[gps.ProjectRoot]string
+}
+
+func (sm provenanceSM) Mirror(ctx context.Context, id gps.ProjectIdentifier) (string, bool, error) {
+	url, known := sm.known[id.ProjectRoot]
+	return url, known, nil
+}
+
+func (sm provenanceSM) Provenance(ctx context.Context, id gps.ProjectIdentifier, v gps.Version) (gps.Provenance, error) {
+	return gps.Provenance{SourceURL: sm.known[id.ProjectRoot], VCS: "git"}, nil
+}
+
+func TestVerifyProjectKeepsUnknownProvenance(t *testing.T) {
+	sm := provenanceSM{known: map[gps.ProjectRoot]string{"example.com/known": "https://mirror.example.org/known"}}
+	for _, root := range []gps.ProjectRoot{"example.com/known", "example.com/unknown"} {
+		vp := verify.VerifiableProject{
+			LockedProject: gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: root}, gps.Revision("abc"), []string{"."}),
+			Mirror:        "https://recorded.example.org",
+			Provenance:    gps.Provenance{SourceURL: "https://recorded.example.org"},
+		}
+		if err := verifyProject(context.Background(), sm, &vp); err != nil {
+			t.Fatal(err)
+		}
+
+		want, has := sm.known[root]
+		if !has {
+			want = "https://recorded.example.org"
+		}
+		if vp.Mirror != want || vp.Provenance.SourceURL != want {
+			t.Errorf("%s: expected mirror and source URL %q, got %q and %q", root, want, vp.Mirror, vp.Provenance.SourceURL)
+		}
+		if vp.Provenance.VCS != "git" {
+			t.Errorf("%s: expected the rest of the provenance to be reported afresh, got %+v", root, vp.Provenance)
+		}
+	}
+}
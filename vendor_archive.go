@@ -0,0 +1,91 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+// WriteVendorArchive writes the vendor tree rooted at vendorDir to w as a
+// gzipped tar archive, with every entry beneath vendor/.
+//
+// The archive depends only on the tree's contents: entries are written in
+// lexical order, with the modification time fs.NormalizedModTime, no owner,
+// and modes normalized as fs.NormalizeTree does. The same tree therefore
+// always produces the same bytes, and so the same digest, when written by the
+// same version of dep. Only directories, regular files and symlinks are
+// included.
+func WriteVendorArchive(w io.Writer, vendorDir string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := filepath.Walk(vendorDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(vendorDir, path)
+		if err != nil {
+			return err
+		}
+
+		hdr := &tar.Header{
+			Name:    filepath.ToSlash(filepath.Join("vendor", rel)),
+			ModTime: fs.NormalizedModTime,
+		}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = filepath.ToSlash(link)
+			hdr.Mode = 0777
+		case fi.IsDir():
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+			hdr.Mode = 0755
+		case fi.Mode().IsRegular():
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = fi.Size()
+			hdr.Mode = 0644
+			if fi.Mode()&0100 != 0 {
+				hdr.Mode = 0755
+			}
+		default:
+			return nil
+		}
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to archive %s", vendorDir)
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestWriteVendorArchive(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	archive := func(dir string, mode os.FileMode, mtime time.Time) []byte {
+		h.TempFile(dir+"/github.com/a/b/b.go", "package b\n")
+		h.TempFile(dir+"/github.com/a/b/run.sh", "#!/bin/sh\n")
+		h.TempFile(dir+"/github.com/a/a.go", "package a\n")
+		h.Must(os.Chmod(h.Path(dir+"/github.com/a/b/b.go"), mode))
+		h.Must(os.Chmod(h.Path(dir+"/github.com/a/b/run.sh"), 0700))
+		for _, p := range []string{"/github.com/a/b/b.go", "/github.com/a/b/run.sh", "/github.com/a/a.go", "/github.com/a/b", ""} {
+			h.Must(os.Chtimes(h.Path(dir+p), mtime, mtime))
+		}
+
+		var buf bytes.Buffer
+		if err := WriteVendorArchive(&buf, h.Path(dir)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	a := archive("one", 0600, time.Now())
+	b := archive("two", 0664, time.Now().Add(-time.Hour))
+	if !bytes.Equal(a, b) {
+		t.Error("expected vendor trees with the same contents to produce identical archives")
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	var names []string
+	modes := make(map[string]int64)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		modes[hdr.Name] = hdr.Mode
+		if hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || !hdr.ModTime.Equal(time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("expected %s to have no owner and a fixed time, got %+v", hdr.Name, hdr)
+		}
+	}
+
+	want := []string{
+		"vendor/",
+		"vendor/github.com/",
+		"vendor/github.com/a/",
+		"vendor/github.com/a/a.go",
+		"vendor/github.com/a/b/",
+		"vendor/github.com/a/b/b.go",
+		"vendor/github.com/a/b/run.sh",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected entries %v, got %v", want, names)
+	}
+	if modes["vendor/github.com/a/b/b.go"] != 0644 || modes["vendor/github.com/a/"] != 0755 {
+		t.Errorf("expected normalized modes, got %v", modes)
+	}
+	if runtime.GOOS != "windows" && modes["vendor/github.com/a/b/run.sh"] != 0755 {
+		t.Errorf("expected executables to stay executable, got %o", modes["vendor/github.com/a/b/run.sh"])
+	}
+}